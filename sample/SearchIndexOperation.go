@@ -521,3 +521,39 @@ func BoolQuery(client *tablestore.TableStoreClient, tableName string, indexName
 		fmt.Println("RowCount: ", len(searchResponse.Rows))
 	}
 }
+
+/**
+ * 查询表中Col_Long这一列大于3的数据，按照Col_Keyword这一列折叠(去重)，每个Col_Keyword的值只返回一行。
+ */
+func CollapseQuery(client *tablestore.TableStoreClient, tableName string, indexName string) {
+	searchRequest := &tablestore.SearchRequest{}
+	searchRequest.SetTableName(tableName)
+	searchRequest.SetIndexName(indexName)
+	searchQuery := search.NewSearchQuery()
+	rangeQuery := &search.RangeQuery{}
+	rangeQuery.FieldName = "Col_Long"
+	rangeQuery.GT(3)
+	searchQuery.SetQuery(rangeQuery)
+	searchQuery.SetCollapse(&search.Collapse{
+		FieldName: "Col_Keyword", // 设置按照哪个字段折叠，该字段需要开启排序与统计功能
+	})
+	searchQuery.SetLimit(20)
+	searchRequest.SetSearchQuery(searchQuery)
+	searchRequest.SetColumnsToGet(&tablestore.ColumnsToGet{
+		ReturnAll: true,
+	})
+	searchResponse, err := client.Search(searchRequest)
+	if err != nil {
+		fmt.Printf("%#v", err)
+		return
+	}
+	fmt.Println("IsAllSuccess: ", searchResponse.IsAllSuccess) // 查看返回结果是否完整
+	fmt.Println("RowCount: ", len(searchResponse.Rows))
+	for _, row := range searchResponse.Rows {
+		jsonBody, err := json.Marshal(row)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println("Row: ", string(jsonBody))
+	}
+}
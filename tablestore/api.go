@@ -2,11 +2,14 @@ package tablestore
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
 	"github.com/golang/protobuf/proto"
+	"io"
 	"math/rand"
 	"net"
 	"net/http"
@@ -67,19 +70,17 @@ var currentGetHttpClientFunc GetHttpClient = func() IHttpClient {
 	return &TableStoreHttpClient{}
 }
 
-// Constructor: to create the client of OTS service. 传入config
-// 构造函数：创建OTS服务的客户端。
-func NewClientWithConfig(endPoint, instanceName, accessKeyId, accessKeySecret string, securityToken string, config *TableStoreConfig) *TableStoreClient {
-	tableStoreClient := new(TableStoreClient)
-	tableStoreClient.endPoint = endPoint
-	tableStoreClient.instanceName = instanceName
-	tableStoreClient.accessKeyId = accessKeyId
-	tableStoreClient.accessKeySecret = accessKeySecret
-	tableStoreClient.securityToken = securityToken
-	if config == nil {
-		config = NewDefaultTableStoreConfig()
+// SetHttpClient makes the client send requests through httpClient, e.g. to
+// record or replay them in tests. httpClient.New is called with an
+// http.Client built from the client config.
+func SetHttpClient(httpClient IHttpClient) ClientOption {
+	return func(client *TableStoreClient) {
+		httpClient.New(newHttpClient(client.config))
+		client.httpClient = httpClient
 	}
-	tableStoreClient.config = config
+}
+
+func newHttpClient(config *TableStoreConfig) *http.Client {
 	tableStoreTransportProxy := &http.Transport{
 		MaxIdleConnsPerHost: config.MaxIdleConnections,
 		Dial: (&net.Dialer{
@@ -87,26 +88,105 @@ func NewClientWithConfig(endPoint, instanceName, accessKeyId, accessKeySecret st
 		}).Dial,
 	}
 
-	tableStoreClient.httpClient = currentGetHttpClientFunc()
-
-	httpClient := &http.Client{
+	return &http.Client{
 		Transport: tableStoreTransportProxy,
-		Timeout:   tableStoreClient.config.HTTPTimeout.RequestTimeout,
+		Timeout:   config.HTTPTimeout.RequestTimeout,
+	}
+}
+
+// Constructor: to create the client of OTS service. 传入config
+// 构造函数：创建OTS服务的客户端。
+func NewClientWithConfig(endPoint, instanceName, accessKeyId, accessKeySecret string, securityToken string, config *TableStoreConfig) *TableStoreClient {
+	tableStoreClient := new(TableStoreClient)
+	tableStoreClient.endPoint = endPoint
+	tableStoreClient.instanceName = instanceName
+	tableStoreClient.credentials = newCredentials(accessKeyId, accessKeySecret, securityToken)
+	if config == nil {
+		config = NewDefaultTableStoreConfig()
 	}
-	tableStoreClient.httpClient.New(httpClient)
+	snapshot := *config
+	tableStoreClient.config = &snapshot
+	tableStoreClient.httpClient = currentGetHttpClientFunc()
+	tableStoreClient.httpClient.New(newHttpClient(config))
 
-	tableStoreClient.random = rand.New(rand.NewSource(time.Now().Unix()))
+	tableStoreClient.random = rand.New(&lockedSource{source: rand.NewSource(time.Now().Unix())})
+	tableStoreClient.capabilities = new(capabilities)
 
 	return tableStoreClient
 }
 
 // 请求服务端
-func (tableStoreClient *TableStoreClient) doRequestWithRetry(uri string, req, resp proto.Message, responseInfo *ResponseInfo) error {
-	end := time.Now().Add(tableStoreClient.config.MaxRetryTime)
-	url := fmt.Sprintf("%s%s", tableStoreClient.endPoint, uri)
+func (tableStoreClient *TableStoreClient) doRequestWithRetry(uri string, req, resp proto.Message, responseInfo *ResponseInfo) (err error) {
+	if tableStoreClient.dryRun && writeUris[uri] {
+		return tableStoreClient.planWrite(uri, req, resp)
+	}
+	if err := tableStoreClient.unsupportedError(actionOf(uri)); err != nil {
+		return err
+	}
+	start := time.Now()
+	table := tableOf(req)
+	retryTimes, maxRetryTime := tableStoreClient.retryPolicy(table)
+	end := start.Add(maxRetryTime)
+	var body, respBody []byte
+	if metrics := tableStoreClient.metrics; metrics != nil {
+		action := actionOf(uri)
+		metrics.RequestStarted(action)
+		defer func() {
+			metrics.RequestFinished(action, time.Since(start), err)
+			if read, write := consumedOf(resp); err == nil && read+write > 0 {
+				metrics.CapacityConsumed(action, read, write)
+			}
+			if sizes, ok := metrics.(PayloadSizeSink); ok {
+				sizes.PayloadSize(action, tableOf(req), len(body), len(respBody))
+			}
+		}()
+	}
+	ctx := tableStoreClient.context()
+	if tableStoreClient.audit != nil {
+		defer func() {
+			tableStoreClient.auditCall(ctx, uri, req, resp, err)
+		}()
+	}
+	var i uint
+	var requestId, lastCode string
+	defer func() {
+		responseInfo.TotalLatency = time.Since(start)
+	}()
+	if tracer := tableStoreClient.tracer; tracer != nil {
+		var span Span
+		ctx, span = tracer.StartSpan(ctx, "TableStore."+actionOf(uri))
+		span.SetAttribute("db.system", "tablestore")
+		span.SetAttribute("db.operation", actionOf(uri))
+		span.SetAttribute("tablestore.table", tableOf(req))
+		if id := CorrelationIdFrom(ctx); id != "" {
+			span.SetAttribute("tablestore.correlation_id", id)
+		}
+		defer func() {
+			span.SetAttribute("tablestore.attempts", int64(i+1))
+			span.SetAttribute("tablestore.request_id", requestId)
+			if err == nil {
+				read, write := consumedOf(resp)
+				span.SetAttribute("tablestore.read_cu", read)
+				span.SetAttribute("tablestore.write_cu", write)
+			} else {
+				if lastCode != "" {
+					span.SetAttribute("tablestore.error_code", lastCode)
+				}
+				span.RecordError(err)
+			}
+			span.End()
+		}()
+	}
+	if stats := tableStoreClient.stats; stats != nil {
+		defer func() {
+			var read, write int64
+			if err == nil {
+				read, write = consumedOf(resp)
+			}
+			stats.record(actionOf(uri), tableOf(req), time.Since(start), i, read, write, err, lastCode)
+		}()
+	}
 	/* request body */
-	var body []byte
-	var err error
 	if req != nil {
 		body, err = proto.Marshal(req)
 		if err != nil {
@@ -117,37 +197,86 @@ func (tableStoreClient *TableStoreClient) doRequestWithRetry(uri string, req, re
 	}
 
 	var value int64
-	var i uint
-	var respBody []byte
-	var requestId string
+	if tableStoreClient.slowRequestThreshold > 0 {
+		defer func() {
+			if elapsed := time.Since(start); elapsed > tableStoreClient.slowRequestThreshold {
+				tableStoreClient.logContext(ctx, LogWarn, "slow request", LogField("action", uri), LogField("elapsed", elapsed),
+					LogField("retries", i), LogField("requestId", requestId))
+			}
+		}()
+	}
+	if defaults := tableStoreClient.defaultsOf(table); defaults != nil && defaults.CUBudget > 0 {
+		if err = defaults.budget.wait(ctx, defaults.CUBudget); err != nil {
+			return err
+		}
+		defer func() {
+			if err == nil {
+				read, write := consumedOf(resp)
+				defaults.budget.spend(read + write)
+			}
+		}()
+	}
 	for i = 0; ; i++ {
 		var statusCode int
 
-		respBody, err, statusCode, requestId = tableStoreClient.doRequest(url, uri, body, resp)
+		respBody, err, statusCode, requestId = tableStoreClient.invoke(ctx, uri, body, resp)
 		responseInfo.RequestId = requestId
+		responseInfo.Attempts++
 
 		if err == nil {
 			break
 		} else {
-
+			e := new(otsprotocol.Error)
+			var errn error
 			if len(respBody) <= 0 {
-				return err
+				lastCode = ""
+				// requests of retryAmbiguous clients whose response is lost
+				// may have been applied, and are retried
+				if !tableStoreClient.retryAmbiguous || !isTransportError(err) {
+					tableStoreClient.logContext(ctx, LogWarn, "request failed", LogField("action", uri), LogField("retries", i), LogField("error", err))
+					return tableStoreClient.checkUnsupported(uri, statusCode, "", err)
+				}
+				errn = err
+			} else {
+				errn = proto.Unmarshal(respBody, e)
+				lastCode = e.GetCode()
+				if isThrottled(lastCode) {
+					responseInfo.ThrottledAttempts++
+				}
 			}
-			e := new(otsprotocol.Error)
-			errn := proto.Unmarshal(respBody, e)
 
-			value = getNextPause(tableStoreClient, errn, e, i, end, value, uri, statusCode)
+			value = nextPause(tableStoreClient, retryTimes, errn, e, i, end, value, uri, statusCode)
 
-			// fmt.Println("hit retry", uri, err, *e.Code, value)
 			if value <= 0 {
-				if errn != nil {
-					return fmt.Errorf("decode resp failed: %s: %s: %s %s", errn, err, string(respBody), requestId)
+				if len(respBody) <= 0 {
+					tableStoreClient.logContext(ctx, LogWarn, "request failed", LogField("action", uri), LogField("retries", i), LogField("error", err))
+					return tableStoreClient.checkUnsupported(uri, statusCode, "", err)
+				} else if errn != nil {
+					tableStoreClient.logContext(ctx, LogWarn, "request failed", LogField("action", uri), LogField("retries", i),
+						LogField("status", statusCode), LogField("error", errn), LogField("requestId", requestId))
+					return tableStoreClient.checkUnsupported(uri, statusCode, "", fmt.Errorf("decode resp failed: %s: %s: %s %s", errn, err, string(respBody), requestId))
 				} else {
-					return fmt.Errorf("%s %s %s", *e.Code, *e.Message, requestId)
+					tableStoreClient.logContext(ctx, LogWarn, "request failed", LogField("action", uri), LogField("retries", i),
+						LogField("status", statusCode), LogField("code", e.GetCode()), LogField("requestId", requestId))
+					return tableStoreClient.checkUnsupported(uri, statusCode, e.GetCode(), fmt.Errorf("%s %s %s", *e.Code, *e.Message, requestId))
 				}
 			}
 
-			time.Sleep(time.Duration(value) * time.Millisecond)
+			level, msg := LogInfo, "request retried"
+			if isThrottled(e.GetCode()) {
+				level, msg = LogWarn, "request throttled"
+			}
+			if tableStoreClient.metrics != nil {
+				tableStoreClient.metrics.RequestRetried(actionOf(uri), e.GetCode(), isThrottled(e.GetCode()))
+			}
+			tableStoreClient.logContext(ctx, level, msg, LogField("action", uri), LogField("attempt", i+1), LogField("status", statusCode),
+				LogField("code", e.GetCode()), LogField("pause", time.Duration(value)*time.Millisecond), LogField("requestId", requestId))
+
+			select {
+			case <-time.After(time.Duration(value) * time.Millisecond):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
 		}
 	}
 
@@ -164,9 +293,14 @@ func (tableStoreClient *TableStoreClient) doRequestWithRetry(uri string, req, re
 }
 
 func getNextPause(tableStoreClient *TableStoreClient, err error, serverError *otsprotocol.Error, count uint, end time.Time, lastInterval int64, action string, statusCode int) int64 {
-	if tableStoreClient.config.RetryTimes <= count || time.Now().After(end) {
+	return nextPause(tableStoreClient, tableStoreClient.config.RetryTimes, err, serverError, count, end, lastInterval, action, statusCode)
+}
+
+func nextPause(tableStoreClient *TableStoreClient, retryTimes uint, err error, serverError *otsprotocol.Error, count uint, end time.Time, lastInterval int64, action string, statusCode int) int64 {
+	if retryTimes <= count || time.Now().After(end) {
 		return 0
-	} else if err == nil && !shouldRetry(*serverError.Code, *serverError.Message, action, statusCode) {
+	} else if err == nil && !shouldRetry(*serverError.Code, *serverError.Message, action, statusCode) &&
+		!(tableStoreClient.retryAmbiguous && isAmbiguous(serverError.GetCode(), statusCode)) {
 		return 0
 	} else {
 		value := lastInterval*2 + tableStoreClient.random.Int63n(DefaultRetryInterval-1) + 1
@@ -183,14 +317,27 @@ func shouldRetry(errorCode string, errorMsg string, action string, httpStatus in
 		return true
 	}
 
-	serverError := httpStatus >= 500 && httpStatus <= 599
-	if isIdempotent(action) &&
-		(errorCode == STORAGE_TIMEOUT || errorCode == INTERNAL_SERVER_ERROR || errorCode == SERVER_UNAVAILABLE || serverError) {
+	if isIdempotent(action) && isAmbiguous(errorCode, httpStatus) {
 		return true
 	}
 	return false
 }
 
+// isAmbiguous reports whether a request failing with errorCode and httpStatus
+// may have been applied.
+func isAmbiguous(errorCode string, httpStatus int) bool {
+	serverError := httpStatus >= 500 && httpStatus <= 599
+	return errorCode == STORAGE_TIMEOUT || errorCode == INTERNAL_SERVER_ERROR || errorCode == SERVER_UNAVAILABLE || serverError
+}
+
+// isTransportError reports whether a request failed without a response, or
+// with a truncated one, e.g. for a timeout or a reset connection, rather than
+// before it was sent.
+func isTransportError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
 func retryNotMatterActions(errorCode string, errorMsg string) bool {
 	if errorCode == ROW_OPERATION_CONFLICT || errorCode == NOT_ENOUGH_CAPACITY_UNIT ||
 		errorCode == TABLE_NOT_READY || errorCode == PARTITION_UNAVAILABLE ||
@@ -201,6 +348,11 @@ func retryNotMatterActions(errorCode string, errorMsg string) bool {
 	}
 }
 
+// isThrottled reports whether a request failed for lack of capacity.
+func isThrottled(errorCode string) bool {
+	return errorCode == NOT_ENOUGH_CAPACITY_UNIT || errorCode == SERVER_BUSY || errorCode == QUOTA_EXHAUSTED
+}
+
 func isIdempotent(action string) bool {
 	if action == batchGetRowUri || action == describeTableUri ||
 		action == getRangeUri || action == getRowUri ||
@@ -211,36 +363,49 @@ func isIdempotent(action string) bool {
 	}
 }
 
-func (tableStoreClient *TableStoreClient) doRequest(url string, uri string, body []byte, resp proto.Message) ([]byte, error, int, string) {
+func (tableStoreClient *TableStoreClient) doRequest(ctx context.Context, url string, uri string, body []byte, resp proto.Message) ([]byte, error, int, string) {
 	hreq, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
 	if err != nil {
 		return nil, err, 0, ""
 	}
+	hreq = hreq.WithContext(ctx)
 	/* set headers */
 	hreq.Header.Set("User-Agent", userAgent)
 
 	date := time.Now().UTC().Format(xOtsDateFormat)
 
 	hreq.Header.Set(xOtsDate, date)
-	hreq.Header.Set(xOtsApiversion, ApiVersion)
-	hreq.Header.Set(xOtsAccesskeyid, tableStoreClient.accessKeyId)
+	version := tableStoreClient.apiVersion
+	if version == "" {
+		version = ApiVersion
+	}
+	hreq.Header.Set(xOtsApiversion, version)
+	credentials := tableStoreClient.currentCredentials()
+	hreq.Header.Set(xOtsAccesskeyid, credentials.accessKeyId)
 	hreq.Header.Set(xOtsInstanceName, tableStoreClient.instanceName)
+	if id := CorrelationIdFrom(ctx); id != "" {
+		header := tableStoreClient.correlationHeader
+		if header == "" {
+			header = DefaultCorrelationHeader
+		}
+		hreq.Header.Set(header, id)
+	}
 
 	md5Byte := md5.Sum(body)
 	md5Base64 := base64.StdEncoding.EncodeToString(md5Byte[:16])
 	hreq.Header.Set(xOtsContentmd5, md5Base64)
 
-	otshead := createOtsHeaders(tableStoreClient.accessKeySecret)
+	otshead := createOtsHeaders(credentials.accessKeySecret)
 	otshead.set(xOtsDate, date)
-	otshead.set(xOtsApiversion, ApiVersion)
-	otshead.set(xOtsAccesskeyid, tableStoreClient.accessKeyId)
-	if tableStoreClient.securityToken != "" {
-		hreq.Header.Set(xOtsHeaderStsToken, tableStoreClient.securityToken)
-		otshead.set(xOtsHeaderStsToken, tableStoreClient.securityToken)
+	otshead.set(xOtsApiversion, version)
+	otshead.set(xOtsAccesskeyid, credentials.accessKeyId)
+	if credentials.securityToken != "" {
+		hreq.Header.Set(xOtsHeaderStsToken, credentials.securityToken)
+		otshead.set(xOtsHeaderStsToken, credentials.securityToken)
 	}
 	otshead.set(xOtsContentmd5, md5Base64)
 	otshead.set(xOtsInstanceName, tableStoreClient.instanceName)
-	sign, err := otshead.signature(uri, "POST", tableStoreClient.accessKeySecret)
+	sign, err := otshead.signature(uri, "POST", credentials.accessKeySecret)
 
 	if err != nil {
 		return nil, err, 0, ""
@@ -271,6 +436,10 @@ func (tableStoreClient *TableStoreClient) CreateTable(request *CreateTableReques
 		return nil, errCreateTableNoPrimaryKey
 	}
 
+	if err := validateTableMeta(request.TableMeta); err != nil {
+		return nil, err
+	}
+
 	req := new(otsprotocol.CreateTableRequest)
 	req.TableMeta = new(otsprotocol.TableMeta)
 	req.TableMeta.TableName = proto.String(request.TableMeta.TableName)
@@ -288,7 +457,7 @@ func (tableStoreClient *TableStoreClient) CreateTable(request *CreateTableReques
 	}
 
 	for _, key := range request.TableMeta.SchemaEntry {
-		keyType := otsprotocol.PrimaryKeyType(*key.Type)
+		keyType := key.Type.ConvertToPbPrimaryKeyType()
 		if key.Option != nil {
 			keyOption := otsprotocol.PrimaryKeyOption(*key.Option)
 			req.TableMeta.PrimaryKey = append(req.TableMeta.PrimaryKey, &otsprotocol.PrimaryKeySchema{Name: key.Name, Type: &keyType, Option: &keyOption})
@@ -418,7 +587,7 @@ func (tableStoreClient *TableStoreClient) DescribeTable(request *DescribeTableRe
 	responseTableMeta.TableName = *resp.TableMeta.TableName
 
 	for _, key := range resp.TableMeta.PrimaryKey {
-		keyType := PrimaryKeyType(*key.Type)
+		keyType := ConvertPbPrimaryKeyType(*key.Type)
 
 		// enable it when we support kep option in describe table
 		if key.Option != nil {
@@ -428,6 +597,9 @@ func (tableStoreClient *TableStoreClient) DescribeTable(request *DescribeTableRe
 			responseTableMeta.SchemaEntry = append(responseTableMeta.SchemaEntry, &PrimaryKeySchema{Name: key.Name, Type: &keyType})
 		}
 	}
+	for _, column := range resp.TableMeta.DefinedColumn {
+		responseTableMeta.AddDefinedColumn(*column.Name, ConvertPbDefinedColumnType(*column.Type))
+	}
 	response.TableMeta = responseTableMeta
 	response.TableOption = &TableOption{TimeToAlive: int(*resp.TableOptions.TimeToLive), MaxVersion: int(*resp.TableOptions.MaxVersions)}
 	if resp.StreamDetails != nil && *resp.StreamDetails.EnableStream {
@@ -515,6 +687,13 @@ func (tableStoreClient *TableStoreClient) PutRow(request *PutRowRequest) (*PutRo
 	if request.PutRowChange == nil {
 		return nil, nil
 	}
+	if err := request.PutRowChange.frozen.hold(); err != nil {
+		return nil, err
+	}
+	defer request.PutRowChange.frozen.release()
+	if err := request.PutRowChange.Err(); err != nil {
+		return nil, err
+	}
 
 	req := new(otsprotocol.PutRowRequest)
 	req.TableName = proto.String(request.PutRowChange.TableName)
@@ -544,13 +723,13 @@ func (tableStoreClient *TableStoreClient) PutRow(request *PutRowRequest) (*PutRo
 	response.ConsumedCapacityUnit.Write = *resp.Consumed.CapacityUnit.Write
 
 	if request.PutRowChange.ReturnType == ReturnType_RT_PK {
-		rows, err := readRowsWithHeader(bytes.NewReader(resp.Row))
+		row, err := readRowWithHeader(resp.Row)
 		if err != nil {
 			return response, err
 		}
 
-		for _, pk := range rows[0].primaryKey {
-			pkColumn := &PrimaryKeyColumn{ColumnName: string(pk.cellName), Value: pk.cellValue.Value}
+		for _, pk := range row.primaryKey {
+			pkColumn := &PrimaryKeyColumn{ColumnName: pk.columnName(), Value: pk.cellValue.Value}
 			response.PrimaryKey.PrimaryKeys = append(response.PrimaryKey.PrimaryKeys, pkColumn)
 		}
 	}
@@ -561,6 +740,13 @@ func (tableStoreClient *TableStoreClient) PutRow(request *PutRowRequest) (*PutRo
 // Delete row with pk
 // @param DeleteRowRequest
 func (tableStoreClient *TableStoreClient) DeleteRow(request *DeleteRowRequest) (*DeleteRowResponse, error) {
+	if err := request.DeleteRowChange.frozen.hold(); err != nil {
+		return nil, err
+	}
+	defer request.DeleteRowChange.frozen.release()
+	if err := request.DeleteRowChange.Err(); err != nil {
+		return nil, err
+	}
 	req := new(otsprotocol.DeleteRowRequest)
 	req.TableName = proto.String(request.DeleteRowChange.TableName)
 	req.Condition = request.DeleteRowChange.getCondition()
@@ -582,6 +768,14 @@ func (tableStoreClient *TableStoreClient) DeleteRow(request *DeleteRowRequest) (
 //
 // @param getrowrequest
 func (tableStoreClient *TableStoreClient) GetRow(request *GetRowRequest) (*GetRowResponse, error) {
+	if err := request.SingleRowQueryCriteria.frozen.hold(); err != nil {
+		return nil, err
+	}
+	defer request.SingleRowQueryCriteria.frozen.release()
+	if err := request.SingleRowQueryCriteria.PrimaryKey.Err(); err != nil {
+		return nil, err
+	}
+	request = tableStoreClient.getRowDefaults(request)
 	req := new(otsprotocol.GetRowRequest)
 	resp := new(otsprotocol.GetRowResponse)
 
@@ -631,18 +825,18 @@ func (tableStoreClient *TableStoreClient) GetRow(request *GetRowRequest) (*GetRo
 		return response, nil
 	}
 
-	rows, err := readRowsWithHeader(bytes.NewReader(resp.Row))
+	row, err := tableStoreClient.newReader(resp.Row, make(interner)).readSingleRow()
 	if err != nil {
 		return nil, err
 	}
 
-	for _, pk := range rows[0].primaryKey {
-		pkColumn := &PrimaryKeyColumn{ColumnName: string(pk.cellName), Value: pk.cellValue.Value}
+	for _, pk := range row.primaryKey {
+		pkColumn := &PrimaryKeyColumn{ColumnName: pk.columnName(), Value: pk.cellValue.Value}
 		response.PrimaryKey.PrimaryKeys = append(response.PrimaryKey.PrimaryKeys, pkColumn)
 	}
 
-	for _, cell := range rows[0].cells {
-		dataColumn := &AttributeColumn{ColumnName: string(cell.cellName), Value: cell.cellValue.Value, Timestamp: cell.cellTimestamp}
+	for _, cell := range row.cells {
+		dataColumn := &AttributeColumn{ColumnName: cell.columnName(), Value: cell.value(), Timestamp: cell.cellTimestamp}
 		response.Columns = append(response.Columns, dataColumn)
 	}
 
@@ -652,6 +846,13 @@ func (tableStoreClient *TableStoreClient) GetRow(request *GetRowRequest) (*GetRo
 // Update row
 // @param UpdateRowRequest
 func (tableStoreClient *TableStoreClient) UpdateRow(request *UpdateRowRequest) (*UpdateRowResponse, error) {
+	if err := request.UpdateRowChange.frozen.hold(); err != nil {
+		return nil, err
+	}
+	defer request.UpdateRowChange.frozen.release()
+	if err := request.UpdateRowChange.Err(); err != nil {
+		return nil, err
+	}
 	req := new(otsprotocol.UpdateRowRequest)
 	resp := new(otsprotocol.UpdateRowResponse)
 
@@ -671,7 +872,34 @@ func (tableStoreClient *TableStoreClient) UpdateRow(request *UpdateRowRequest) (
 
 // Batch Get Row
 // @param BatchGetRowRequest
+// Rows failing with retryable errors, such as throttling, are read again as
+// long as the retry policy allows, their results replacing their failures.
 func (tableStoreClient *TableStoreClient) BatchGetRow(request *BatchGetRowRequest) (*BatchGetRowResponse, error) {
+	for i, criteria := range request.MultiRowQueryCriteria {
+		if err := criteria.frozen.hold(); err != nil {
+			for _, held := range request.MultiRowQueryCriteria[:i] {
+				held.frozen.release()
+			}
+			return nil, err
+		}
+	}
+	defer func() {
+		for _, criteria := range request.MultiRowQueryCriteria {
+			criteria.frozen.release()
+		}
+	}()
+	request = tableStoreClient.batchGetRowDefaults(request)
+	start := time.Now()
+	response, err := tableStoreClient.batchGetRow(request)
+	if err != nil {
+		return nil, err
+	}
+	tableStoreClient.retryFailedRows(request, response)
+	response.TotalLatency = time.Since(start)
+	return response, nil
+}
+
+func (tableStoreClient *TableStoreClient) batchGetRow(request *BatchGetRowRequest) (*BatchGetRowResponse, error) {
 	req := new(otsprotocol.BatchGetRowRequest)
 
 	var tablesInBatch []*otsprotocol.TableInBatchGetRowRequest
@@ -707,6 +935,9 @@ func (tableStoreClient *TableStoreClient) BatchGetRow(request *BatchGetRowReques
 		}
 
 		for _, pk := range Criteria.PrimaryKey {
+			if err := pk.Err(); err != nil {
+				return nil, err
+			}
 			pkWithBytes := pk.Build(false)
 			table.PrimaryKey = append(table.PrimaryKey, pkWithBytes)
 		}
@@ -722,6 +953,7 @@ func (tableStoreClient *TableStoreClient) BatchGetRow(request *BatchGetRowReques
 		return nil, err
 	}
 
+	names := make(interner)
 	for _, table := range resp.Tables {
 		index := int32(0)
 		for _, row := range table.Rows {
@@ -732,18 +964,18 @@ func (tableStoreClient *TableStoreClient) BatchGetRow(request *BatchGetRowReques
 			} else {
 				// len == 0 means row not exist
 				if len(row.Row) > 0 {
-					rows, err := readRowsWithHeader(bytes.NewReader(row.Row))
+					plainRow, err := tableStoreClient.newReader(row.Row, names).readSingleRow()
 					if err != nil {
 						return nil, err
 					}
 
-					for _, pk := range rows[0].primaryKey {
-						pkColumn := &PrimaryKeyColumn{ColumnName: string(pk.cellName), Value: pk.cellValue.Value}
+					for _, pk := range plainRow.primaryKey {
+						pkColumn := &PrimaryKeyColumn{ColumnName: pk.columnName(), Value: pk.cellValue.Value}
 						rowResult.PrimaryKey.PrimaryKeys = append(rowResult.PrimaryKey.PrimaryKeys, pkColumn)
 					}
 
-					for _, cell := range rows[0].cells {
-						dataColumn := &AttributeColumn{ColumnName: string(cell.cellName), Value: cell.cellValue.Value, Timestamp: cell.cellTimestamp}
+					for _, cell := range plainRow.cells {
+						dataColumn := &AttributeColumn{ColumnName: cell.columnName(), Value: cell.value(), Timestamp: cell.cellTimestamp}
 						rowResult.Columns = append(rowResult.Columns, dataColumn)
 					}
 				}
@@ -762,10 +994,43 @@ func (tableStoreClient *TableStoreClient) BatchGetRow(request *BatchGetRowReques
 // Batch Write Row
 // @param BatchWriteRowRequest
 func (tableStoreClient *TableStoreClient) BatchWriteRow(request *BatchWriteRowRequest) (*BatchWriteRowResponse, error) {
+	if err := request.frozen.hold(); err != nil {
+		return nil, err
+	}
+	defer request.frozen.release()
+	var changes []RowChange
+	for _, group := range request.RowChangesGroupByTable {
+		changes = append(changes, group...)
+	}
+	release, err := holdRowChanges(changes...)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	for _, change := range changes {
+		if err := change.Err(); err != nil {
+			return nil, err
+		}
+	}
 	req := new(otsprotocol.BatchWriteRowRequest)
+	if request.IsAtomic {
+		if err := request.atomicErr(); err != nil {
+			return nil, err
+		}
+		req.XXX_unrecognized = isAtomicField
+	}
 
 	var tablesInBatch []*otsprotocol.TableInBatchWriteRowRequest
 
+	// all rows are serialized into a single buffer
+	size := 0
+	for _, value := range request.RowChangesGroupByTable {
+		for _, row := range value {
+			size += row.serializedSize()
+		}
+	}
+	buffer := bytes.NewBuffer(make([]byte, 0, size))
+
 	for key, value := range request.RowChangesGroupByTable {
 		table := new(otsprotocol.TableInBatchWriteRowRequest)
 		table.TableName = proto.String(key)
@@ -773,7 +1038,9 @@ func (tableStoreClient *TableStoreClient) BatchWriteRow(request *BatchWriteRowRe
 		for _, row := range value {
 			rowInBatch := &otsprotocol.RowInBatchWriteRowRequest{}
 			rowInBatch.Condition = row.getCondition()
-			rowInBatch.RowChange = row.Serialize()
+			start := buffer.Len()
+			row.serializeTo(buffer)
+			rowInBatch.RowChange = buffer.Bytes()[start:buffer.Len():buffer.Len()]
 			rowInBatch.Type = row.getOperationType().Enum()
 			table.Rows = append(table.Rows, rowInBatch)
 		}
@@ -807,12 +1074,12 @@ func (tableStoreClient *TableStoreClient) BatchWriteRow(request *BatchWriteRowRe
 				}
 
 				for _, pk := range (rows[0].primaryKey) {
-					pkColumn := &PrimaryKeyColumn{ColumnName: string(pk.cellName), Value: pk.cellValue.Value}
+					pkColumn := &PrimaryKeyColumn{ColumnName: pk.columnName(), Value: pk.cellValue.Value}
 					rowResult.PrimaryKey.PrimaryKeys = append(rowResult.PrimaryKey.PrimaryKeys, pkColumn)
 				}
 
 				for _, cell := range (rows[0].cells) {
-					dataColumn := &DataColumn{ColumnName: string(cell.cellName), Value: cell.cellValue.Value}
+					dataColumn := &DataColumn{ColumnName: cell.columnName(), Value: cell.cellValue.Value}
 					rowResult.Columns = append(rowResult.Columns, dataColumn)
 				}
 
@@ -829,6 +1096,38 @@ func (tableStoreClient *TableStoreClient) BatchWriteRow(request *BatchWriteRowRe
 // Get Range
 // @param GetRangeRequest
 func (tableStoreClient *TableStoreClient) GetRange(request *GetRangeRequest) (*GetRangeResponse, error) {
+	rows, err := tableStoreClient.GetRangeRows(request)
+	if err != nil {
+		return nil, err
+	}
+	response := &GetRangeResponse{ConsumedCapacityUnit: rows.ConsumedCapacityUnit, NextStartPrimaryKey: rows.NextStartPrimaryKey, ResponseInfo: rows.ResponseInfo}
+	for {
+		row, err := rows.Next()
+		if err == io.EOF {
+			return response, nil
+		}
+		if err != nil {
+			return response, err
+		}
+		response.Rows = append(response.Rows, row)
+	}
+}
+
+// GetRangeRows reads a page of rows as GetRange does, but decodes them one at
+// a time, as they are read by Next, instead of all at once, so that large pages
+// are held in memory serialized and a row at a time.
+func (tableStoreClient *TableStoreClient) GetRangeRows(request *GetRangeRequest) (*RangeRows, error) {
+	if err := request.RangeRowQueryCriteria.frozen.hold(); err != nil {
+		return nil, err
+	}
+	defer request.RangeRowQueryCriteria.frozen.release()
+	if err := request.RangeRowQueryCriteria.StartPrimaryKey.Err(); err != nil {
+		return nil, err
+	}
+	if err := request.RangeRowQueryCriteria.EndPrimaryKey.Err(); err != nil {
+		return nil, err
+	}
+	request = tableStoreClient.getRangeDefaults(request)
 	req := new(otsprotocol.GetRangeRequest)
 	req.TableName = proto.String(request.RangeRowQueryCriteria.TableName)
 	req.Direction = request.RangeRowQueryCriteria.Direction.ToDirection().Enum()
@@ -871,7 +1170,7 @@ func (tableStoreClient *TableStoreClient) GetRange(request *GetRangeRequest) (*G
 	req.ExclusiveEndPrimaryKey = request.RangeRowQueryCriteria.EndPrimaryKey.Build(false)
 
 	resp := new(otsprotocol.GetRangeResponse)
-	response := &GetRangeResponse{ConsumedCapacityUnit: &ConsumedCapacityUnit{}}
+	response := &RangeRows{ConsumedCapacityUnit: &ConsumedCapacityUnit{}}
 	if err := tableStoreClient.doRequestWithRetry(getRangeUri, req, resp, &response.ResponseInfo); err != nil {
 		return nil, err
 	}
@@ -879,47 +1178,22 @@ func (tableStoreClient *TableStoreClient) GetRange(request *GetRangeRequest) (*G
 	response.ConsumedCapacityUnit.Read = *resp.Consumed.CapacityUnit.Read
 	response.ConsumedCapacityUnit.Write = *resp.Consumed.CapacityUnit.Write
 	if len(resp.NextStartPrimaryKey) != 0 {
-		currentRows, err := readRowsWithHeader(bytes.NewReader(resp.NextStartPrimaryKey))
+		currentRow, err := readRowWithHeader(resp.NextStartPrimaryKey)
 		if err != nil {
 			return nil, err
 		}
 
 		response.NextStartPrimaryKey = &PrimaryKey{}
-		for _, pk := range currentRows[0].primaryKey {
-			pkColumn := &PrimaryKeyColumn{ColumnName: string(pk.cellName), Value: pk.cellValue.Value}
+		for _, pk := range currentRow.primaryKey {
+			pkColumn := &PrimaryKeyColumn{ColumnName: pk.columnName(), Value: pk.cellValue.Value}
 			response.NextStartPrimaryKey.PrimaryKeys = append(response.NextStartPrimaryKey.PrimaryKeys, pkColumn)
 		}
 	}
 
-	if len(resp.Rows) == 0 {
-		return response, nil
-	}
-
-	rows, err := readRowsWithHeader(bytes.NewReader(resp.Rows))
-	if err != nil {
-		return response, err
-	}
-
-	for _, row := range rows {
-		currentRow := &Row{}
-		currentpk := new(PrimaryKey)
-		for _, pk := range row.primaryKey {
-			pkColumn := &PrimaryKeyColumn{ColumnName: string(pk.cellName), Value: pk.cellValue.Value}
-			currentpk.PrimaryKeys = append(currentpk.PrimaryKeys, pkColumn)
-		}
-
-		currentRow.PrimaryKey = currentpk
-
-		for _, cell := range row.cells {
-			dataColumn := &AttributeColumn{ColumnName: string(cell.cellName), Value: cell.cellValue.Value, Timestamp: cell.cellTimestamp}
-			currentRow.Columns = append(currentRow.Columns, dataColumn)
-		}
-
-		response.Rows = append(response.Rows, currentRow)
+	if len(resp.Rows) != 0 {
+		response.reader = tableStoreClient.newReader(resp.Rows, make(interner))
 	}
-
 	return response, nil
-
 }
 
 func (client *TableStoreClient) ListStream(req *ListStreamRequest) (*ListStreamResponse, error) {
@@ -999,83 +1273,22 @@ func (client *TableStoreClient) GetShardIterator(req *GetShardIteratorRequest) (
 }
 
 func (client TableStoreClient) GetStreamRecord(req *GetStreamRecordRequest) (*GetStreamRecordResponse, error) {
-	pbReq := &otsprotocol.GetStreamRecordRequest{
-		ShardIterator: (*string)(req.ShardIterator)}
-	if req.Limit != nil {
-		pbReq.Limit = req.Limit
-	}
-
-	pbResp := otsprotocol.GetStreamRecordResponse{}
-	resp := GetStreamRecordResponse{}
-	if err := client.doRequestWithRetry(getStreamRecordUri, pbReq, &pbResp, &resp.ResponseInfo); err != nil {
+	records, err := client.GetStreamRecords(req)
+	if err != nil {
 		return nil, err
 	}
-
-	if pbResp.NextShardIterator != nil {
-		resp.NextShardIterator = (*ShardIterator)(pbResp.NextShardIterator)
-	}
-	records := make([]*StreamRecord, len(pbResp.StreamRecords))
-	for i, pbRecord := range pbResp.StreamRecords {
-		record := StreamRecord{}
-		records[i] = &record
-
-		switch *pbRecord.ActionType {
-		case otsprotocol.ActionType_PUT_ROW:
-			record.Type = AT_Put
-		case otsprotocol.ActionType_UPDATE_ROW:
-			record.Type = AT_Update
-		case otsprotocol.ActionType_DELETE_ROW:
-			record.Type = AT_Delete
+	resp := GetStreamRecordResponse{NextShardIterator: records.NextShardIterator, ResponseInfo: records.ResponseInfo}
+	resp.Records = make([]*StreamRecord, 0, len(records.records))
+	for {
+		record, err := records.Next()
+		if err == io.EOF {
+			return &resp, nil
 		}
-
-		plainRows, err := readRowsWithHeader(bytes.NewReader(pbRecord.Record))
 		if err != nil {
 			return nil, err
 		}
-		Assert(len(plainRows) == 1,
-			"There must be exactly one row in a StreamRecord.")
-		plainRow := plainRows[0]
-		pkey := PrimaryKey{}
-		record.PrimaryKey = &pkey
-		pkey.PrimaryKeys = make([]*PrimaryKeyColumn, len(plainRow.primaryKey))
-		for i, pk := range plainRow.primaryKey {
-			pkc := PrimaryKeyColumn{
-				ColumnName: string(pk.cellName),
-				Value:      pk.cellValue.Value}
-			pkey.PrimaryKeys[i] = &pkc
-		}
-		Assert(plainRow.extension != nil,
-			"extension in a stream record is required.")
-		record.Info = plainRow.extension
-		record.Columns = make([]*RecordColumn, len(plainRow.cells))
-		for i, plainCell := range plainRow.cells {
-			cell := RecordColumn{}
-			record.Columns[i] = &cell
-
-			name := string(plainCell.cellName)
-			cell.Name = &name
-			if plainCell.cellValue != nil {
-				cell.Type = RCT_Put
-			} else {
-				if plainCell.cellTimestamp > 0 {
-					cell.Type = RCT_DeleteOneVersion
-				} else {
-					cell.Type = RCT_DeleteAllVersions
-				}
-			}
-			switch cell.Type {
-			case RCT_Put:
-				cell.Value = plainCell.cellValue.Value
-				fallthrough
-			case RCT_DeleteOneVersion:
-				cell.Timestamp = &plainCell.cellTimestamp
-			case RCT_DeleteAllVersions:
-				break
-			}
-		}
+		resp.Records = append(resp.Records, record)
 	}
-	resp.Records = records
-	return &resp, nil
 }
 
 func (client TableStoreClient) ComputeSplitPointsBySize(req *ComputeSplitPointsBySizeRequest) (*ComputeSplitPointsBySizeResponse, error) {
@@ -1090,8 +1303,8 @@ func (client TableStoreClient) ComputeSplitPointsBySize(req *ComputeSplitPointsB
 		return nil, err
 	}
 
-	fmt.Println(len(pbResp.SplitPoints))
-	fmt.Println(len(pbResp.Locations))
+	client.log(LogDebug, "split points computed", LogField("table", req.TableName),
+		LogField("splitPoints", len(pbResp.SplitPoints)), LogField("locations", len(pbResp.Locations)))
 
 	beginPk := &PrimaryKey{}
 	endPk := &PrimaryKey{}
@@ -1103,14 +1316,14 @@ func (client TableStoreClient) ComputeSplitPointsBySize(req *ComputeSplitPointsB
 	nowPk := endPk
 
 	for _, pbRecord := range pbResp.SplitPoints {
-		plainRows, err := readRowsWithHeader(bytes.NewReader(pbRecord))
+		plainRow, err := readRowWithHeader(pbRecord)
 		if err != nil {
 			return nil, err
 		}
 
 		nowPk = &PrimaryKey{}
-		for _, pk := range plainRows[0].primaryKey {
-			nowPk.AddPrimaryKeyColumn(string(pk.cellName), pk.cellValue.Value)
+		for _, pk := range plainRow.primaryKey {
+			nowPk.AddPrimaryKeyColumn(pk.columnName(), pk.cellValue.Value)
 		}
 
 		if len(pbResp.Schema) > 1 {
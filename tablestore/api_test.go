@@ -1,17 +1,30 @@
 package tablestore
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/search"
+	"github.com/golang/protobuf/proto"
 	. "gopkg.in/check.v1"
+	"io"
+	"io/ioutil"
+	"math"
 	"math/rand"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+	"unicode/utf8"
 )
 
 // Hook up gocheck into the "go test" runner.
@@ -1298,6 +1311,480 @@ func (s *TableStoreSuite) TestMockHttpClientCase(c *C) {
 	fmt.Println("TestMockHttpClientCase finished")
 }
 
+func (s *TableStoreSuite) TestInterceptor(c *C) {
+	var calls []string
+	busy, _ := proto.Marshal(&otsprotocol.Error{Code: proto.String(SERVER_BUSY), Message: proto.String("busy")})
+	tables, _ := proto.Marshal(&otsprotocol.ListTableResponse{TableNames: []string{"t"}})
+	outer := func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		calls = append(calls, "outer "+uri)
+		return next(uri, body)
+	}
+	inner := func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		calls = append(calls, "inner "+uri)
+		if len(calls) < 4 {
+			return busy, fmt.Errorf("busy"), 503, "r1"
+		}
+		return tables, nil, 200, "r2"
+	}
+
+	// the interceptors answer without sending anything
+	client := NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(outer), AddInterceptor(inner))
+	resp, err := client.ListTable()
+	c.Assert(err, IsNil)
+	c.Check(resp.TableNames, DeepEquals, []string{"t"})
+	c.Check(resp.RequestId, Equals, "r2")
+	c.Check(calls, DeepEquals, []string{"outer /ListTable", "inner /ListTable", "outer /ListTable", "inner /ListTable"})
+}
+
+type recordLogger struct {
+	entries []string
+}
+
+func (logger *recordLogger) Log(level LogLevel, msg string, fields ...Field) {
+	logger.entries = append(logger.entries, level.String()+" "+msg)
+}
+
+func (s *TableStoreSuite) TestLogger(c *C) {
+	calls := 0
+	busy, _ := proto.Marshal(&otsprotocol.Error{Code: proto.String(SERVER_BUSY), Message: proto.String("busy")})
+	conflict, _ := proto.Marshal(&otsprotocol.Error{Code: proto.String(ROW_OPERATION_CONFLICT), Message: proto.String("conflict")})
+	invalid, _ := proto.Marshal(&otsprotocol.Error{Code: proto.String("OTSParameterInvalid"), Message: proto.String("invalid")})
+	tables, _ := proto.Marshal(&otsprotocol.ListTableResponse{TableNames: []string{"t"}})
+	interceptor := func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		calls++
+		switch calls {
+		case 1:
+			return busy, fmt.Errorf("busy"), 503, "r1"
+		case 2:
+			return conflict, fmt.Errorf("conflict"), 409, "r2"
+		case 3:
+			return tables, nil, 200, "r3"
+		}
+		return invalid, fmt.Errorf("invalid"), 400, "r4"
+	}
+
+	logger := new(recordLogger)
+	client := NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(interceptor), SetLogger(logger), SetSlowRequestThreshold(time.Nanosecond))
+	_, err := client.ListTable()
+	c.Assert(err, IsNil)
+	c.Check(logger.entries, DeepEquals, []string{"WARN request throttled", "INFO request retried", "WARN slow request"})
+
+	logger.entries = nil
+	_, err = client.ListTable()
+	c.Check(err, NotNil)
+	c.Check(logger.entries, DeepEquals, []string{"WARN request failed", "WARN slow request"})
+
+	var b strings.Builder
+	stdLogger := NewStdLogger(&b, LogInfo)
+	stdLogger.Log(LogDebug, "hidden")
+	stdLogger.Log(LogWarn, "request throttled", LogField("action", "/PutRow"), LogField("attempt", 1))
+	c.Check(strings.HasSuffix(b.String(), " WARN request throttled action=/PutRow attempt=1\n"), Equals, true)
+	c.Check(strings.Count(b.String(), "\n"), Equals, 1)
+}
+
+type recordTracer struct {
+	spans []*recordSpan
+}
+
+type recordSpan struct {
+	name       string
+	attributes map[string]interface{}
+	err        error
+	ended      bool
+}
+
+func (tracer *recordTracer) StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	span := &recordSpan{name: name, attributes: make(map[string]interface{})}
+	tracer.spans = append(tracer.spans, span)
+	return ctx, span
+}
+
+func (span *recordSpan) SetAttribute(key string, value interface{}) { span.attributes[key] = value }
+func (span *recordSpan) RecordError(err error)                      { span.err = err }
+func (span *recordSpan) End()                                       { span.ended = true }
+
+func (s *TableStoreSuite) TestTracer(c *C) {
+	calls := 0
+	busy, _ := proto.Marshal(&otsprotocol.Error{Code: proto.String(SERVER_BUSY), Message: proto.String("busy")})
+	invalid, _ := proto.Marshal(&otsprotocol.Error{Code: proto.String("OTSParameterInvalid"), Message: proto.String("invalid")})
+	put, _ := proto.Marshal(&otsprotocol.PutRowResponse{Consumed: &otsprotocol.ConsumedCapacity{
+		CapacityUnit: &otsprotocol.CapacityUnit{Read: proto.Int32(0), Write: proto.Int32(1)}}})
+	interceptor := func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		calls++
+		switch calls {
+		case 1:
+			return busy, fmt.Errorf("busy"), 503, "r1"
+		case 2:
+			return put, nil, 200, "r2"
+		case 3:
+			return invalid, fmt.Errorf("invalid"), 400, "r3"
+		}
+		return busy, fmt.Errorf("busy"), 503, "r4"
+	}
+
+	tracer := new(recordTracer)
+	client := NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(interceptor), SetTracer(tracer))
+	change := &PutRowChange{TableName: "t", PrimaryKey: new(PrimaryKey)}
+	change.PrimaryKey.AddPrimaryKeyColumn("pk", "a")
+	change.AddColumn("col", int64(1))
+	change.SetCondition(RowExistenceExpectation_IGNORE)
+	_, err := client.PutRow(&PutRowRequest{PutRowChange: change})
+	c.Assert(err, IsNil)
+	c.Assert(tracer.spans, HasLen, 1)
+	span := tracer.spans[0]
+	c.Check(span.name, Equals, "TableStore.PutRow")
+	c.Check(span.ended, Equals, true)
+	c.Check(span.attributes, DeepEquals, map[string]interface{}{
+		"db.system": "tablestore", "db.operation": "PutRow", "tablestore.table": "t", "tablestore.attempts": int64(2),
+		"tablestore.request_id": "r2", "tablestore.read_cu": int64(0), "tablestore.write_cu": int64(1),
+	})
+
+	_, err = client.PutRow(&PutRowRequest{PutRowChange: change})
+	c.Assert(err, NotNil)
+	span = tracer.spans[1]
+	c.Check(span.err, Equals, err)
+	c.Check(span.attributes["tablestore.error_code"], Equals, "OTSParameterInvalid")
+
+	// retries stop once the context of the call is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.WithContext(ctx).PutRow(&PutRowRequest{PutRowChange: change})
+	c.Check(err, Equals, context.Canceled)
+	c.Check(calls, Equals, 4)
+	c.Check(tracer.spans[2].attributes["tablestore.attempts"], Equals, int64(1))
+}
+
+type fieldsLogger []Field
+
+func (logger *fieldsLogger) Log(level LogLevel, msg string, fields ...Field) {
+	*logger = append(*logger, fields...)
+}
+
+func (s *TableStoreSuite) TestCorrelationId(c *C) {
+	currentGetHttpClientFunc = func() IHttpClient {
+		return &mockHttpClient{error: fmt.Errorf("unreachable")}
+	}
+	defer func() {
+		currentGetHttpClientFunc = func() IHttpClient {
+			return &TableStoreHttpClient{}
+		}
+	}()
+
+	logger := new(fieldsLogger)
+	tracer := new(recordTracer)
+	client := NewClient("http://127.0.0.1:0", "a", "b", "c", SetLogger(logger), SetTracer(tracer))
+	ctx := WithCorrelationId(context.Background(), "trace-1")
+	_, err := client.WithContext(ctx).ListTable()
+	c.Assert(err, NotNil)
+	mock := client.httpClient.(*mockHttpClient)
+	c.Check(mock.request.Header.Get(DefaultCorrelationHeader), Equals, "trace-1")
+	c.Check(*logger, DeepEquals, fieldsLogger{LogField("action", "/ListTable"), LogField("retries", uint(0)),
+		LogField("error", err), LogField("correlationId", "trace-1")})
+	c.Check(tracer.spans[0].attributes["tablestore.correlation_id"], Equals, "trace-1")
+
+	// no header without a correlation id
+	_, err = client.ListTable()
+	c.Assert(err, NotNil)
+	c.Check(mock.request.Header.Get(DefaultCorrelationHeader), Equals, "")
+
+	client = NewClient("http://127.0.0.1:0", "a", "b", "c", SetCorrelationHeader("X-Request-Trace"))
+	client.WithContext(ctx).ListTable()
+	c.Check(client.httpClient.(*mockHttpClient).request.Header.Get("X-Request-Trace"), Equals, "trace-1")
+}
+
+func (s *TableStoreSuite) TestStatsReporter(c *C) {
+	calls := 0
+	busy, _ := proto.Marshal(&otsprotocol.Error{Code: proto.String(SERVER_BUSY), Message: proto.String("busy")})
+	invalid, _ := proto.Marshal(&otsprotocol.Error{Code: proto.String("OTSParameterInvalid"), Message: proto.String("invalid")})
+	put, _ := proto.Marshal(&otsprotocol.PutRowResponse{Consumed: &otsprotocol.ConsumedCapacity{
+		CapacityUnit: &otsprotocol.CapacityUnit{Read: proto.Int32(0), Write: proto.Int32(1)}}})
+	interceptor := func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		calls++
+		switch calls {
+		case 1:
+			return busy, fmt.Errorf("busy"), 503, "r1"
+		case 2, 3:
+			return put, nil, 200, "r2"
+		}
+		return invalid, fmt.Errorf("invalid"), 400, "r4"
+	}
+
+	var snapshots []*StatsSnapshot
+	reporter := NewStatsReporter(time.Hour, func(snapshot *StatsSnapshot) {
+		snapshots = append(snapshots, snapshot)
+	})
+	client := NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(interceptor), SetStatsReporter(reporter))
+	for _, table := range []string{"t", "t", "u"} {
+		change := &PutRowChange{TableName: table, PrimaryKey: new(PrimaryKey)}
+		change.PrimaryKey.AddPrimaryKeyColumn("pk", "a")
+		change.AddColumn("col", int64(1))
+		change.SetCondition(RowExistenceExpectation_IGNORE)
+		client.PutRow(&PutRowRequest{PutRowChange: change})
+	}
+	reporter.Stop()
+
+	c.Assert(snapshots, HasLen, 1)
+	ops := snapshots[0].Operations
+	c.Assert(ops, HasLen, 2)
+	c.Check(ops[0].Action, Equals, "PutRow")
+	c.Check(ops[0].Table, Equals, "t")
+	c.Check(ops[0].Requests, Equals, int64(2))
+	c.Check(ops[0].Retries, Equals, int64(1))
+	c.Check(ops[0].RetryRatio(), Equals, 0.5)
+	c.Check(ops[0].WriteCU, Equals, int64(2))
+	c.Check(ops[0].ErrorRate(), Equals, float64(0))
+	c.Check(ops[0].P50 <= ops[0].P99, Equals, true)
+	c.Check(ops[1].Table, Equals, "u")
+	c.Check(ops[1].Errors, DeepEquals, map[string]int64{"OTSParameterInvalid": 1})
+	c.Check(ops[1].ErrorRate(), Equals, float64(1))
+
+	// nothing is reported without calls
+	reporter.Flush()
+	c.Check(snapshots, HasLen, 1)
+}
+
+func (s *TableStoreSuite) TestRetryTelemetry(c *C) {
+	calls := 0
+	busy, _ := proto.Marshal(&otsprotocol.Error{Code: proto.String(SERVER_BUSY), Message: proto.String("busy")})
+	timeout, _ := proto.Marshal(&otsprotocol.Error{Code: proto.String(STORAGE_TIMEOUT), Message: proto.String("timeout")})
+	get, _ := proto.Marshal(&otsprotocol.GetRowResponse{Row: []byte{}, Consumed: &otsprotocol.ConsumedCapacity{
+		CapacityUnit: &otsprotocol.CapacityUnit{Read: proto.Int32(1), Write: proto.Int32(0)}}})
+	interceptor := func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		calls++
+		switch calls {
+		case 1, 2:
+			return busy, fmt.Errorf("busy"), 503, "r1"
+		case 3:
+			return timeout, fmt.Errorf("timeout"), 500, "r3"
+		}
+		return get, nil, 200, "r4"
+	}
+	client := NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(interceptor))
+	criteria := &SingleRowQueryCriteria{TableName: "t", PrimaryKey: new(PrimaryKey), MaxVersion: 1}
+	criteria.PrimaryKey.AddPrimaryKeyColumn("pk", "a")
+	start := time.Now()
+	resp, err := client.GetRow(&GetRowRequest{SingleRowQueryCriteria: criteria})
+	c.Assert(err, IsNil)
+	c.Check(resp.RequestId, Equals, "r4")
+	c.Check(resp.Attempts, Equals, 4)
+	c.Check(resp.ThrottledAttempts, Equals, 2)
+	c.Check(resp.TotalLatency > 0 && resp.TotalLatency <= time.Since(start), Equals, true)
+
+	resp, err = client.GetRow(&GetRowRequest{SingleRowQueryCriteria: criteria})
+	c.Assert(err, IsNil)
+	c.Check(resp.Attempts, Equals, 1)
+	c.Check(resp.ThrottledAttempts, Equals, 0)
+}
+
+func (s *TableStoreSuite) TestDryRun(c *C) {
+	var sent []string
+	get, _ := proto.Marshal(&otsprotocol.GetRowResponse{Row: []byte{}, Consumed: &otsprotocol.ConsumedCapacity{
+		CapacityUnit: &otsprotocol.CapacityUnit{Read: proto.Int32(1), Write: proto.Int32(0)}}})
+	interceptor := func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		sent = append(sent, uri)
+		return get, nil, 200, "r1"
+	}
+	var planned []PlannedWrite
+	logger := new(fieldsLogger)
+	client := NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(interceptor), SetLogger(logger),
+		SetDryRun(func(write PlannedWrite) { planned = append(planned, write) }))
+
+	change := func(table string, size int) *PutRowChange {
+		change := &PutRowChange{TableName: table, PrimaryKey: new(PrimaryKey)}
+		change.PrimaryKey.AddPrimaryKeyColumn("pk", "a")
+		change.AddColumn("col", make([]byte, size))
+		change.SetCondition(RowExistenceExpectation_IGNORE)
+		return change
+	}
+	put, err := client.PutRow(&PutRowRequest{PutRowChange: change("t", 10)})
+	c.Assert(err, IsNil)
+	c.Check(put.ConsumedCapacityUnit.Write, Equals, int32(1))
+	batch := &BatchWriteRowRequest{}
+	batch.AddRowChange(change("t", 10))
+	batch.AddRowChange(change("u", 5000))
+	written, err := client.BatchWriteRow(batch)
+	c.Assert(err, IsNil)
+	c.Check(written.TableToRowsResult["u"][0].IsSucceed, Equals, true)
+	c.Check(written.TableToRowsResult["u"][0].ConsumedCapacityUnit.Write, Equals, int32(2))
+	_, err = client.DeleteTable(&DeleteTableRequest{TableName: "t"})
+	c.Assert(err, IsNil)
+
+	// reads are sent
+	criteria := &SingleRowQueryCriteria{TableName: "t", PrimaryKey: change("t", 0).PrimaryKey, MaxVersion: 1}
+	_, err = client.GetRow(&GetRowRequest{SingleRowQueryCriteria: criteria})
+	c.Assert(err, IsNil)
+	c.Check(sent, DeepEquals, []string{"/GetRow"})
+
+	c.Assert(planned, HasLen, 3)
+	c.Check(planned[0].Action, Equals, "PutRow")
+	c.Check(planned[0].Table, Equals, "t")
+	c.Check(planned[0].Rows, Equals, 1)
+	c.Check(planned[0].Size > 10, Equals, true)
+	c.Check(planned[1].Rows, Equals, 2)
+	c.Check(planned[1].WriteCU, Equals, int64(3))
+	c.Check(planned[2].Action, Equals, "DeleteTable")
+	c.Check((*logger)[:2], DeepEquals, fieldsLogger{LogField("action", "/PutRow"), LogField("table", "t")})
+
+	// invalid writes fail as they would when sent
+	batch = &BatchWriteRowRequest{}
+	for i := 0; i <= maxBatchWriteRows; i++ {
+		batch.AddRowChange(change("t", 1))
+	}
+	_, err = client.BatchWriteRow(batch)
+	c.Check(err, NotNil)
+	c.Check(planned, HasLen, 3)
+}
+
+func (s *TableStoreSuite) TestEstimateCU(c *C) {
+	pk := new(PrimaryKey)
+	pk.AddPrimaryKeyColumn("pk", "a")
+	pk.AddPrimaryKeyColumnWithAutoIncrement("seq")
+
+	put := &PutRowChange{TableName: "t", PrimaryKey: pk}
+	put.AddColumn("int", int64(1))
+	c.Check(EstimateWriteCU(put), Equals, int64(1))
+	// 14 bytes of pk, 11 of int and 4 of the name of blob
+	put.AddColumn("blob", make([]byte, 4096-29))
+	c.Check(EstimateWriteCU(put), Equals, int64(1))
+	put.AddColumn("bool", true)
+	c.Check(EstimateWriteCU(put), Equals, int64(2))
+
+	update := &UpdateRowChange{TableName: "t", PrimaryKey: pk}
+	update.PutColumn("s", string(make([]byte, 10000)))
+	update.DeleteColumn("old")
+	c.Check(EstimateWriteCU(update), Equals, int64(3))
+	c.Check(EstimateWriteCU(&DeleteRowChange{TableName: "t", PrimaryKey: pk}), Equals, int64(1))
+
+	row := &Row{PrimaryKey: pk, Columns: []*AttributeColumn{{ColumnName: "c", Value: make([]byte, 8192)}}}
+	c.Check(EstimateReadCU(row), Equals, int64(3))
+	c.Check(EstimateReadCU(nil), Equals, int64(1))
+}
+
+func (s *TableStoreSuite) TestRangeToken(c *C) {
+	query := func() *RangeRowQueryCriteria {
+		start, end := new(PrimaryKey), new(PrimaryKey)
+		start.AddPrimaryKeyColumn("user", "u1")
+		start.AddPrimaryKeyColumnWithMinValue("ts")
+		end.AddPrimaryKeyColumn("user", "u1")
+		end.AddPrimaryKeyColumnWithMaxValue("ts")
+		return &RangeRowQueryCriteria{TableName: "t", StartPrimaryKey: start, EndPrimaryKey: end, MaxVersion: 1,
+			Filter: NewSingleColumnCondition("col", CT_EQUAL, int64(1))}
+	}
+	next := new(PrimaryKey)
+	next.AddPrimaryKeyColumn("user", "u1")
+	next.AddPrimaryKeyColumn("ts", int64(42))
+
+	token := EncodeRangeToken(query(), next)
+	c.Check(EncodeRangeToken(query(), nil), Equals, "")
+	resumed := query()
+	c.Assert(DecodeRangeToken(token, resumed), IsNil)
+	c.Check(resumed.StartPrimaryKey.Build(false), DeepEquals, next.Build(false))
+	unchanged := query()
+	c.Assert(DecodeRangeToken("", unchanged), IsNil)
+	c.Check(unchanged.StartPrimaryKey, DeepEquals, query().StartPrimaryKey)
+
+	// tokens of other queries are rejected
+	other := query()
+	other.Filter = NewSingleColumnCondition("col", CT_EQUAL, int64(2))
+	c.Check(DecodeRangeToken(token, other), Equals, ErrInvalidRangeToken)
+	other = query()
+	other.Direction = BACKWARD
+	c.Check(DecodeRangeToken(token, other), Equals, ErrInvalidRangeToken)
+	c.Check(DecodeRangeToken("not a token", query()), Equals, ErrInvalidRangeToken)
+	c.Check(DecodeRangeToken(token[:len(token)-3], query()), Equals, ErrInvalidRangeToken)
+}
+
+func (s *TableStoreSuite) TestVersions(c *C) {
+	resp := &GetRowResponse{Columns: []*AttributeColumn{
+		{ColumnName: "a", Value: int64(1), Timestamp: 100},
+		{ColumnName: "b", Value: "x", Timestamp: 150},
+		{ColumnName: "a", Value: int64(3), Timestamp: 300},
+		{ColumnName: "a", Value: int64(2), Timestamp: 200},
+	}}
+	c.Check(Versions(resp.Columns, "a"), DeepEquals, []VersionedValue{{300, int64(3)}, {200, int64(2)}, {100, int64(1)}})
+	c.Check(Versions(resp.Columns, "c"), IsNil)
+
+	columnMap := resp.GetColumnMap()
+	c.Check(columnMap.GetVersions("b"), DeepEquals, []VersionedValue{{150, "x"}})
+	version, ok := columnMap.GetLatestBefore("a", 300)
+	c.Check(ok, Equals, true)
+	c.Check(version, DeepEquals, VersionedValue{200, int64(2)})
+	version, ok = GetLatestBefore(resp.Columns, "a", 1000)
+	c.Check(version.Value, Equals, int64(3))
+	_, ok = columnMap.GetLatestBefore("a", 100)
+	c.Check(ok, Equals, false)
+}
+
+func (s *TableStoreSuite) TestLifetime(c *C) {
+	now := time.Unix(1000000, 0)
+	timestamp, err := TimestampForLifetime(now, 86400, time.Hour)
+	c.Assert(err, IsNil)
+	c.Check(timestamp, Equals, int64(1000000+3600-86400)*1000)
+	expiry, ok := ExpiresAt(timestamp, 86400)
+	c.Check(ok, Equals, true)
+	c.Check(expiry.Equal(now.Add(time.Hour)), Equals, true)
+	_, ok = ExpiresAt(timestamp, -1)
+	c.Check(ok, Equals, false)
+	_, err = TimestampForLifetime(now, -1, time.Hour)
+	c.Check(err, NotNil)
+	_, err = TimestampForLifetime(now, 60, time.Hour)
+	c.Check(err, NotNil)
+
+	row := &Row{Columns: []*AttributeColumn{{ColumnName: "a", Timestamp: 1000}, {ColumnName: "b", Timestamp: 5000}}}
+	expiry, ok = RowExpiresAt(row, 10)
+	c.Check(ok, Equals, true)
+	c.Check(expiry.Equal(time.Unix(15, 0)), Equals, true)
+	_, ok = RowExpiresAt(&Row{}, 10)
+	c.Check(ok, Equals, false)
+
+	put := new(PutRowChange)
+	put.AddColumn("a", int64(1))
+	c.Assert(put.SetLifetime(86400, time.Hour), IsNil)
+	c.Check(put.Columns[0].Timestamp, Not(Equals), int64(0))
+	update := new(UpdateRowChange)
+	update.PutColumn("a", int64(1))
+	update.DeleteColumn("b")
+	c.Assert(update.SetLifetime(86400, time.Hour), IsNil)
+	c.Check(update.Columns[0].HasTimestamp, Equals, true)
+	c.Check(update.Columns[1].HasTimestamp, Equals, false)
+}
+
+func (s *TableStoreSuite) TestSerializeRowChange(c *C) {
+	pk := new(PrimaryKey)
+	pk.AddPrimaryKeyColumn("pk1", "key")
+	pk.AddPrimaryKeyColumn("pk2", []byte("binary"))
+	pk.AddPrimaryKeyColumnWithAutoIncrement("pk3")
+
+	putRowChange := &PutRowChange{TableName: "t", PrimaryKey: pk}
+	putRowChange.AddColumn("string", "value")
+	putRowChange.AddColumn("int", int64(-1))
+	putRowChange.AddColumn("double", 0.5)
+	putRowChange.AddColumn("bool", false)
+	putRowChange.AddColumnWithTimestamp("blob", []byte{1, 2}, 1500000000000)
+
+	updateRowChange := &UpdateRowChange{TableName: "t", PrimaryKey: pk}
+	updateRowChange.PutColumn("string", "value")
+	updateRowChange.DeleteColumn("deleted")
+	updateRowChange.DeleteColumnWithTimestamp("version", 1500000000000)
+
+	// same encoding as the intermediate cells
+	c.Check(putRowChange.Serialize(), DeepEquals, buildRowPutChange(pk, putRowChange.Columns).Build())
+	c.Check(updateRowChange.Serialize(), DeepEquals, buildRowUpdateChange(pk, updateRowChange.Columns).Build())
+	c.Check(len(putRowChange.Serialize()), Equals, putRowChange.serializedSize())
+
+	rangePk := new(PrimaryKey)
+	rangePk.AddPrimaryKeyColumn("pk1", int64(1))
+	rangePk.AddPrimaryKeyColumnWithMinValue("pk2")
+	rangePk.AddPrimaryKeyColumnWithMaxValue("pk3")
+	decoded, err := DecodePrimaryKey(rangePk.Build(false))
+	c.Assert(err, IsNil)
+	c.Check(decoded, DeepEquals, rangePk)
+
+	// a row is written into a single allocation
+	c.Check(testing.AllocsPerRun(10, func() { putRowChange.Serialize() }), Equals, float64(1))
+	c.Check(testing.AllocsPerRun(10, func() { updateRowChange.Serialize() }), Equals, float64(1))
+}
+
 func (s *TableStoreSuite) TestUnit(c *C) {
 	otshead := createOtsHeaders("test")
 	otshead.set(xOtsApiversion, ApiVersion)
@@ -1377,7 +1864,7 @@ func (s *TableStoreSuite) TestUnit(c *C) {
 
 func SetSth() ClientOption {
 	return func(client *TableStoreClient) {
-		fmt.Println(client.accessKeyId)
+		fmt.Println(client.currentCredentials().accessKeyId)
 	}
 }
 
@@ -1393,12 +1880,14 @@ func CreatePutRowChange(pkValue, colValue string) *PutRowChange {
 }
 
 type mockHttpClient struct {
+	request    *http.Request
 	response   *http.Response
 	error      error
 	httpClient *http.Client
 }
 
 func (mockHttpClient *mockHttpClient) Do(req *http.Request) (*http.Response, error) {
+	mockHttpClient.request = req
 	return mockHttpClient.response, mockHttpClient.error
 }
 
@@ -1479,6 +1968,2120 @@ func PrepareDataInRangeTableWithTimestamp(key1 string, key2 string, value string
 	return error
 }
 
+func (s *TableStoreSuite) TestDiffRows(c *C) {
+	pk := &PrimaryKey{}
+	pk.AddPrimaryKeyColumn("pk1", "row")
+	oldRow := Row{PrimaryKey: pk, Columns: []*AttributeColumn{
+		{ColumnName: "same", Value: []byte("a")},
+		{ColumnName: "changed", Value: int64(2), Timestamp: 2},
+		{ColumnName: "changed", Value: int64(1), Timestamp: 1},
+		{ColumnName: "removed", Value: "x"},
+	}}
+	newRow := Row{PrimaryKey: pk, Columns: []*AttributeColumn{
+		{ColumnName: "same", Value: []byte("a")},
+		{ColumnName: "changed", Value: int64(3)},
+		{ColumnName: "added", Value: true},
+	}}
+
+	change := DiffRows(oldRow, newRow)
+	c.Assert(change, NotNil)
+	c.Assert(change.PrimaryKey, Equals, pk)
+	c.Assert(change.Condition.RowExistenceExpectation, Equals, RowExistenceExpectation_EXPECT_EXIST)
+	c.Assert(len(change.Columns), Equals, 3)
+	c.Assert(change.Columns[0].ColumnName, Equals, "changed")
+	c.Assert(change.Columns[0].Value, Equals, int64(3))
+	c.Assert(change.Columns[1].ColumnName, Equals, "added")
+	c.Assert(change.Columns[2].ColumnName, Equals, "removed")
+	c.Assert(change.Columns[2].Type, Equals, byte(DELETE_ALL_VERSION))
+
+	c.Assert(DiffRows(newRow, newRow), IsNil)
+}
+
+func (s *TableStoreSuite) TestBatchResponses(c *C) {
+	pk := func(v string) *PrimaryKey {
+		pk := new(PrimaryKey)
+		pk.AddPrimaryKeyColumn("pk", v)
+		return pk
+	}
+	busy := Error{Code: SERVER_BUSY, Message: "busy"}
+	invalid := Error{Code: "OTSConditionCheckFail", Message: "condition check failed"}
+	timeout := Error{Code: STORAGE_TIMEOUT, Message: "timeout"}
+
+	write := new(BatchWriteRowRequest)
+	for _, v := range []string{"a", "b", "c"} {
+		change := &PutRowChange{TableName: "t", PrimaryKey: pk(v)}
+		change.AddColumn("col", v)
+		write.AddRowChange(change)
+	}
+	write.AddRowChange(&DeleteRowChange{TableName: "u", PrimaryKey: pk("d")})
+	writeResponse := &BatchWriteRowResponse{TableToRowsResult: map[string][]RowResult{
+		"t": {{TableName: "t", IsSucceed: true, Index: 0}, {TableName: "t", Error: busy, Index: 1}, {TableName: "t", Error: invalid, Index: 2}},
+		"u": {{TableName: "u", Error: timeout, Index: 0}},
+	}}
+	c.Check(writeResponse.SucceededRows(), HasLen, 1)
+	failed := writeResponse.FailedRows()
+	c.Assert(failed, HasLen, 3)
+	c.Check(failed[0].Index, Equals, int32(1))
+	c.Check(failed[2].TableName, Equals, "u")
+	retry := writeResponse.RetryableFailedRequest(write)
+	c.Assert(retry, NotNil)
+	c.Check(retry.RowChangesGroupByTable, HasLen, 1)
+	c.Check(retry.RowChangesGroupByTable["t"], DeepEquals, []RowChange{write.RowChangesGroupByTable["t"][1]})
+
+	writeResponse.TableToRowsResult["t"][1].Error = invalid
+	c.Check(writeResponse.RetryableFailedRequest(write), IsNil)
+
+	get := &BatchGetRowRequest{MultiRowQueryCriteria: []*MultiRowQueryCriteria{
+		{TableName: "t", PrimaryKey: []*PrimaryKey{pk("a"), pk("b")}, MaxVersion: 1},
+		{TableName: "u", PrimaryKey: []*PrimaryKey{pk("c")}, MaxVersion: 1},
+		{TableName: "t", PrimaryKey: []*PrimaryKey{pk("d")}, MaxVersion: 2},
+	}}
+	getResponse := &BatchGetRowResponse{TableToRowsResult: map[string][]RowResult{
+		"t": {{TableName: "t", IsSucceed: true, Index: 0}, {TableName: "t", Error: invalid, Index: 1}, {TableName: "t", Error: timeout, Index: 0}},
+		"u": {{TableName: "u", Error: busy, Index: 0}},
+	}}
+	c.Check(getResponse.SucceededRows(), HasLen, 1)
+	c.Check(getResponse.FailedRows(), HasLen, 3)
+	retryGet := getResponse.RetryableFailedRequest(get)
+	c.Assert(retryGet, NotNil)
+	c.Assert(retryGet.MultiRowQueryCriteria, HasLen, 2)
+	c.Check(retryGet.MultiRowQueryCriteria[0].TableName, Equals, "u")
+	c.Check(retryGet.MultiRowQueryCriteria[1].PrimaryKey, DeepEquals, []*PrimaryKey{get.MultiRowQueryCriteria[2].PrimaryKey[0]})
+	c.Check(retryGet.MultiRowQueryCriteria[1].MaxVersion, Equals, 2)
+	c.Check(get.MultiRowQueryCriteria[2].PrimaryKey, HasLen, 1)
+}
+
+func (s *TableStoreSuite) TestRowExists(c *C) {
+	pk := func(v string) *PrimaryKey {
+		pk := new(PrimaryKey)
+		pk.AddPrimaryKeyColumn("pk", v)
+		pk.AddPrimaryKeyColumn("id", int64(1))
+		return pk
+	}
+	consumed := &otsprotocol.ConsumedCapacity{CapacityUnit: &otsprotocol.CapacityUnit{Read: proto.Int32(1), Write: proto.Int32(0)}}
+	var requests []proto.Message
+	interceptor := func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		switch uri {
+		case getRowUri:
+			req := new(otsprotocol.GetRowRequest)
+			proto.Unmarshal(body, req)
+			requests = append(requests, req)
+			resp := &otsprotocol.GetRowResponse{Row: []byte{}, Consumed: consumed}
+			if bytes.Contains(req.PrimaryKey, []byte("yes")) {
+				resp.Row = (&PutRowChange{PrimaryKey: pk("yes")}).Serialize()
+			}
+			data, _ := proto.Marshal(resp)
+			return data, nil, 200, "r"
+		case batchGetRowUri:
+			req := new(otsprotocol.BatchGetRowRequest)
+			proto.Unmarshal(body, req)
+			requests = append(requests, req)
+			table := &otsprotocol.TableInBatchGetRowResponse{TableName: req.Tables[0].TableName}
+			for _, key := range req.Tables[0].PrimaryKey {
+				result := &otsprotocol.RowInBatchGetRowResponse{IsOk: proto.Bool(true), Row: []byte{}, Consumed: consumed}
+				if bytes.Contains(key, []byte("yes")) {
+					result.Row = (&PutRowChange{PrimaryKey: pk("yes")}).Serialize()
+				} else if bytes.Contains(key, []byte("busy")) {
+					result = &otsprotocol.RowInBatchGetRowResponse{IsOk: proto.Bool(false), Error: &otsprotocol.Error{Code: proto.String(SERVER_BUSY), Message: proto.String("busy")}}
+				}
+				table.Rows = append(table.Rows, result)
+			}
+			data, _ := proto.Marshal(&otsprotocol.BatchGetRowResponse{Tables: []*otsprotocol.TableInBatchGetRowResponse{table}})
+			return data, nil, 200, "r"
+		}
+		return nil, fmt.Errorf("unexpected %s", uri), 400, "r"
+	}
+	client := NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(interceptor))
+
+	exists, err := client.RowExists("t", pk("yes"))
+	c.Assert(err, IsNil)
+	c.Check(exists, Equals, true)
+	exists, err = client.RowExists("t", pk("no"))
+	c.Assert(err, IsNil)
+	c.Check(exists, Equals, false)
+	get := requests[0].(*otsprotocol.GetRowRequest)
+	c.Check(get.ColumnsToGet, DeepEquals, []string{"pk"})
+	c.Check(get.GetMaxVersions(), Equals, int32(1))
+	_, err = client.RowExists("t", new(PrimaryKey))
+	c.Check(err, Equals, errInvalidInput)
+
+	requests = nil
+	var pks []*PrimaryKey
+	for i := 0; i < 150; i++ {
+		if i%3 == 0 {
+			pks = append(pks, pk("yes"))
+		} else {
+			pks = append(pks, pk("no"))
+		}
+	}
+	all, err := client.BatchRowExists("t", pks)
+	c.Assert(err, IsNil)
+	c.Assert(all, HasLen, 150)
+	for i, exists := range all {
+		c.Check(exists, Equals, i%3 == 0)
+	}
+	c.Assert(requests, HasLen, 2)
+	batch := requests[1].(*otsprotocol.BatchGetRowRequest)
+	c.Check(batch.Tables[0].PrimaryKey, HasLen, 50)
+	c.Check(batch.Tables[0].ColumnsToGet, DeepEquals, []string{"pk"})
+
+	_, err = client.BatchRowExists("t", []*PrimaryKey{pk("yes"), pk("busy")})
+	c.Check(err, ErrorMatches, "OTSServerBusy busy.*")
+}
+
+func (s *TableStoreSuite) TestConditionalWrites(c *C) {
+	exists := false
+	var expectations []otsprotocol.RowExistenceExpectation
+	consumed := &otsprotocol.ConsumedCapacity{CapacityUnit: &otsprotocol.CapacityUnit{Read: proto.Int32(0), Write: proto.Int32(1)}}
+	fail, _ := proto.Marshal(&otsprotocol.Error{Code: proto.String(CONDITION_CHECK_FAIL), Message: proto.String("Condition check failed.")})
+	interceptor := func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		var condition *otsprotocol.Condition
+		var resp proto.Message
+		switch uri {
+		case putRowUri:
+			req := new(otsprotocol.PutRowRequest)
+			proto.Unmarshal(body, req)
+			condition, resp = req.Condition, &otsprotocol.PutRowResponse{Consumed: consumed}
+		case updateRowUri:
+			req := new(otsprotocol.UpdateRowRequest)
+			proto.Unmarshal(body, req)
+			condition, resp = req.Condition, &otsprotocol.UpdateRowResponse{Consumed: consumed}
+		}
+		expectations = append(expectations, condition.GetRowExistence())
+		if (condition.GetRowExistence() == otsprotocol.RowExistenceExpectation_EXPECT_NOT_EXIST) == exists {
+			return fail, fmt.Errorf("condition"), 403, "r"
+		}
+		exists = true
+		data, _ := proto.Marshal(resp)
+		return data, nil, 200, "r"
+	}
+	client := NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(interceptor))
+	pk := new(PrimaryKey)
+	pk.AddPrimaryKeyColumn("pk", "a")
+
+	update := &UpdateRowChange{TableName: "t", PrimaryKey: pk}
+	update.PutColumn("col", int64(2))
+	_, err := client.UpdateRowIfExist(update)
+	c.Check(err, Equals, ErrRowNotExist)
+
+	put := &PutRowChange{TableName: "t", PrimaryKey: pk}
+	put.AddColumn("col", int64(1))
+	put.SetCondition(RowExistenceExpectation_IGNORE)
+	_, err = client.PutRowIfNotExist(put)
+	c.Check(err, IsNil)
+	_, err = client.PutRowIfNotExist(put)
+	c.Check(err, Equals, ErrRowAlreadyExists)
+	c.Check(put.Condition.RowExistenceExpectation, Equals, RowExistenceExpectation_IGNORE)
+	_, err = client.PutRow(&PutRowRequest{PutRowChange: &PutRowChange{TableName: "t", PrimaryKey: pk, Condition: &RowCondition{RowExistenceExpectation: RowExistenceExpectation_EXPECT_NOT_EXIST}}})
+	c.Check(IsConditionCheckFail(err), Equals, true)
+	c.Check(IsConditionCheckFail(ErrRowAlreadyExists), Equals, false)
+	c.Check(IsConditionCheckFail(nil), Equals, false)
+
+	_, err = client.UpdateRowIfExist(update)
+	c.Check(err, IsNil)
+	c.Check(update.Condition, IsNil)
+	c.Check(expectations, DeepEquals, []otsprotocol.RowExistenceExpectation{otsprotocol.RowExistenceExpectation_EXPECT_EXIST,
+		otsprotocol.RowExistenceExpectation_EXPECT_NOT_EXIST, otsprotocol.RowExistenceExpectation_EXPECT_NOT_EXIST,
+		otsprotocol.RowExistenceExpectation_EXPECT_NOT_EXIST, otsprotocol.RowExistenceExpectation_EXPECT_EXIST})
+}
+
+// pagingClient returns rows of the primary key 0 to 29, at most 7 per page.
+type pagingClient struct {
+	TableStoreApi
+	limits []int32
+}
+
+func (client *pagingClient) GetRange(request *GetRangeRequest) (*GetRangeResponse, error) {
+	criteria := request.RangeRowQueryCriteria
+	client.limits = append(client.limits, criteria.Limit)
+	resp := &GetRangeResponse{ConsumedCapacityUnit: &ConsumedCapacityUnit{Read: 1}}
+	resp.Attempts = 1
+	id := criteria.StartPrimaryKey.PrimaryKeys[0].Value.(int64)
+	for ; id < 30 && len(resp.Rows) < 7 && (criteria.Limit == 0 || len(resp.Rows) < int(criteria.Limit)); id++ {
+		row := &Row{PrimaryKey: new(PrimaryKey), Columns: []*AttributeColumn{{ColumnName: "col", Value: "0123456789"}}}
+		row.PrimaryKey.AddPrimaryKeyColumn("pk", id)
+		resp.Rows = append(resp.Rows, row)
+	}
+	if id < 30 {
+		resp.NextStartPrimaryKey = new(PrimaryKey)
+		resp.NextStartPrimaryKey.AddPrimaryKeyColumn("pk", id)
+	}
+	return resp, nil
+}
+
+func (s *TableStoreSuite) TestReadRange(c *C) {
+	client := new(pagingClient)
+	criteria := &RangeRowQueryCriteria{TableName: "t", StartPrimaryKey: new(PrimaryKey), EndPrimaryKey: new(PrimaryKey), MaxVersion: 1, Limit: 12}
+	criteria.StartPrimaryKey.AddPrimaryKeyColumn("pk", int64(0))
+	criteria.EndPrimaryKey.AddPrimaryKeyColumnWithMaxValue("pk")
+	request := &GetRangeRequest{RangeRowQueryCriteria: criteria}
+
+	resp, err := ReadRange(client, request, ReadRangeOptions{})
+	c.Assert(err, IsNil)
+	c.Check(resp.Rows, HasLen, 12)
+	c.Check(resp.NextStartPrimaryKey.PrimaryKeys[0].Value, Equals, int64(12))
+	c.Check(resp.ConsumedCapacityUnit.Read, Equals, int32(2))
+	c.Check(resp.Attempts, Equals, 2)
+	c.Check(client.limits, DeepEquals, []int32{12, 5})
+	c.Check(criteria.Limit, Equals, int32(12))
+	c.Check(criteria.StartPrimaryKey.PrimaryKeys[0].Value, Equals, int64(0))
+
+	// the whole range
+	criteria.Limit = 0
+	resp, err = ReadRange(client, request, ReadRangeOptions{})
+	c.Assert(err, IsNil)
+	c.Check(resp.Rows, HasLen, 30)
+	c.Check(resp.NextStartPrimaryKey, IsNil)
+
+	// rows of 2+8+3+10 bytes
+	resp, err = ReadRange(client, request, ReadRangeOptions{MaxBytes: 200})
+	c.Assert(err, IsNil)
+	c.Check(resp.Rows, HasLen, 14)
+	c.Check(resp.NextStartPrimaryKey.PrimaryKeys[0].Value, Equals, int64(14))
+}
+
+func (s *TableStoreSuite) TestColumnSet(c *C) {
+	summary := MustColumnSet("user", "status", "total")
+	c.Check(summary.Names(), DeepEquals, []string{"user", "status", "total"})
+	c.Check(summary.Contains("status"), Equals, true)
+	c.Check(summary.Contains("blob"), Equals, false)
+
+	for _, names := range [][]string{nil, {"user", "user"}, {""}, {"1st"}, {"a-b"}, {strings.Repeat("a", 256)}} {
+		_, err := NewColumnSet(names...)
+		c.Check(err, NotNil, Commentf("%q", names))
+	}
+	_, err := NewColumnSet("_x", "A1", strings.Repeat("a", 255))
+	c.Check(err, IsNil)
+
+	detail, err := summary.Include("items", "status", "items")
+	c.Assert(err, IsNil)
+	c.Check(detail.Names(), DeepEquals, []string{"user", "status", "total", "items"})
+	_, err = summary.Include("bad name")
+	c.Check(err, NotNil)
+	public, err := detail.Exclude("user")
+	c.Assert(err, IsNil)
+	c.Check(public.Names(), DeepEquals, []string{"status", "total", "items"})
+	c.Check(summary.Names(), HasLen, 3)
+	_, err = summary.Exclude("user", "status", "total")
+	c.Check(err, NotNil)
+
+	single := &SingleRowQueryCriteria{ColumnsToGet: []string{"other"}}
+	single.SetColumnSet(summary)
+	c.Check(single.ColumnsToGet, DeepEquals, []string{"user", "status", "total"})
+	single.ColumnsToGet[0] = "changed"
+	c.Check(summary.Names()[0], Equals, "user")
+	multi := new(MultiRowQueryCriteria)
+	multi.SetColumnSet(public)
+	c.Check(multi.ColumnsToGet, DeepEquals, []string{"status", "total", "items"})
+	ranged := &RangeRowQueryCriteria{ColumnsToGet: []string{"other"}}
+	ranged.SetColumnSet(nil)
+	c.Check(ranged.ColumnsToGet, IsNil)
+}
+
+func (s *TableStoreSuite) TestFrozenFilter(c *C) {
+	condition := Col("status").Equal("open")
+	frozen := condition.Freeze()
+	c.Check(frozen.Serialize(), DeepEquals, condition.Serialize())
+	c.Check(frozen.Filter(), Equals, ColumnFilter(condition))
+	c.Check(Freeze(frozen), Equals, frozen)
+	c.Check(proto.Equal(frozen.ToFilter(), condition.ToFilter()), Equals, true)
+
+	// frozen filters are not serialized again
+	condition.ColumnValue = "closed"
+	c.Check(frozen.Serialize(), Not(DeepEquals), condition.Serialize())
+
+	composite := AllOf(frozen, Col("total").GreaterThan(int64(10)))
+	plain := AllOf(Col("status").Equal("open"), Col("total").GreaterThan(int64(10)))
+	c.Check(composite.Serialize(), DeepEquals, plain.Serialize())
+	c.Check(composite.Freeze().Serialize(), DeepEquals, plain.Serialize())
+	page := &PaginationFilter{Offset: 1, Limit: 2}
+	c.Check(page.Freeze().Serialize(), DeepEquals, page.Serialize())
+}
+
+func (s *TableStoreSuite) TestDecodeColumnFilter(c *C) {
+	regex := NewSingleColumnValueRegexFilter("log", CT_GREATER_THAN, NewValueTransferRule("t=(\\d+)", Variant_INTEGER), int64(1))
+	missing := Col("status").Equal("open")
+	missing.FilterIfMissing = true
+	for _, filter := range []ColumnFilter{
+		missing,
+		AnyOf(Col("total").GreaterThan(int64(10)), NoneOf(Col("paid").Equal(true)), regex),
+		&PaginationFilter{Offset: 1, Limit: 2},
+		missing.Freeze(),
+	} {
+		decoded, err := DecodeColumnFilter(filter.Serialize())
+		c.Assert(err, IsNil)
+		c.Check(decoded.Serialize(), DeepEquals, filter.Serialize())
+	}
+	decoded, err := DecodeColumnFilter(regex.Serialize())
+	c.Assert(err, IsNil)
+	c.Check(decoded, DeepEquals, ColumnFilter(regex))
+
+	_, err = DecodeColumnFilter([]byte{0xff})
+	c.Check(err, NotNil)
+}
+
+// wideRowClient holds a row of the columns c00 to c24 whose values are their
+// names, the columns of even numbers as binaries.
+type wideRowClient struct {
+	TableStoreApi
+	reads int
+}
+
+func (client *wideRowClient) GetRow(request *GetRowRequest) (*GetRowResponse, error) {
+	client.reads++
+	criteria := request.SingleRowQueryCriteria
+	page := criteria.Filter.(*PaginationFilter)
+	resp := &GetRowResponse{PrimaryKey: *criteria.PrimaryKey}
+	for i := 0; i < 25 && len(resp.Columns) < int(page.Limit); i++ {
+		name := fmt.Sprintf("c%02d", i)
+		if criteria.StartColumn != nil && name < *criteria.StartColumn || criteria.EndColumn != nil && name >= *criteria.EndColumn {
+			continue
+		}
+		var value interface{} = name
+		if i%2 == 0 {
+			value = []byte(name)
+		}
+		resp.Columns = append(resp.Columns, &AttributeColumn{ColumnName: name, Value: value})
+	}
+	return resp, nil
+}
+
+func (s *TableStoreSuite) TestColumnIterator(c *C) {
+	client := new(wideRowClient)
+	criteria := &SingleRowQueryCriteria{TableName: "t", PrimaryKey: new(PrimaryKey), MaxVersion: 1}
+	criteria.PrimaryKey.AddPrimaryKeyColumn("pk", "a")
+	criteria.SetStartColumn("c03")
+	criteria.SetEndtColumn("c20")
+	it := NewColumnIterator(client, criteria, 4)
+	var names []string
+	for {
+		column, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+		names = append(names, column.ColumnName)
+	}
+	c.Check(names, HasLen, 17)
+	c.Check(names[0], Equals, "c03")
+	c.Check(names[16], Equals, "c19")
+	c.Check(client.reads, Equals, 6)
+	c.Check(*criteria.StartColumn, Equals, "c03")
+	c.Check(criteria.Filter, IsNil)
+
+	client.reads = 0
+	criteria.EndColumn = nil
+	data, err := ioutil.ReadAll(NewColumnReader(NewColumnIterator(client, criteria, 0)))
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, "c03c04c05c06c07c08c09c10c11c12c13c14c15c16c17c18c19c20c21c22c23c24")
+	c.Check(client.reads, Equals, 23)
+
+	criteria.Filter = &PaginationFilter{Limit: 1}
+	_, err = NewColumnIterator(client, criteria, 1).Next()
+	c.Check(err, NotNil)
+}
+
+// fallbackClient fails the rows of keys starting with "big" in BatchGetRow,
+// and the rows of keys starting with "bigger" in GetRow.
+type fallbackClient struct {
+	TableStoreApi
+	gets []*SingleRowQueryCriteria
+}
+
+func (client *fallbackClient) BatchGetRow(request *BatchGetRowRequest) (*BatchGetRowResponse, error) {
+	response := &BatchGetRowResponse{TableToRowsResult: make(map[string][]RowResult)}
+	for _, criteria := range request.MultiRowQueryCriteria {
+		for _, pk := range criteria.PrimaryKey {
+			result := RowResult{TableName: criteria.TableName, IsSucceed: true, PrimaryKey: *pk, Index: int32(len(response.TableToRowsResult[criteria.TableName]))}
+			if strings.HasPrefix(pk.PrimaryKeys[0].Value.(string), "big") {
+				result = RowResult{TableName: criteria.TableName, Error: Error{Code: "OTSParameterInvalid", Message: "response too large"}, Index: result.Index}
+			}
+			response.TableToRowsResult[criteria.TableName] = append(response.TableToRowsResult[criteria.TableName], result)
+		}
+	}
+	return response, nil
+}
+
+func (client *fallbackClient) GetRow(request *GetRowRequest) (*GetRowResponse, error) {
+	criteria := request.SingleRowQueryCriteria
+	client.gets = append(client.gets, criteria)
+	key := criteria.PrimaryKey.PrimaryKeys[0].Value.(string)
+	if strings.HasPrefix(key, "bigger") {
+		return nil, fmt.Errorf("OTSParameterInvalid response too large")
+	}
+	resp := &GetRowResponse{PrimaryKey: *criteria.PrimaryKey, ConsumedCapacityUnit: &ConsumedCapacityUnit{Read: 100}}
+	resp.Columns = []*AttributeColumn{{ColumnName: "blob", Value: []byte(key)}}
+	return resp, nil
+}
+
+func (s *TableStoreSuite) TestBatchGetRowWithFallback(c *C) {
+	pk := func(v string) *PrimaryKey {
+		pk := new(PrimaryKey)
+		pk.AddPrimaryKeyColumn("pk", v)
+		return pk
+	}
+	client := new(fallbackClient)
+	request := &BatchGetRowRequest{MultiRowQueryCriteria: []*MultiRowQueryCriteria{
+		{TableName: "t", PrimaryKey: []*PrimaryKey{pk("a"), pk("big1")}, ColumnsToGet: []string{"blob"}, MaxVersion: 1},
+		{TableName: "u", PrimaryKey: []*PrimaryKey{pk("bigger")}, MaxVersion: 1},
+		{TableName: "t", PrimaryKey: []*PrimaryKey{pk("big2")}, MaxVersion: 2},
+	}}
+	resp, err := BatchGetRowWithFallback(client, request)
+	c.Assert(err, IsNil)
+	c.Check(client.gets, HasLen, 3)
+	c.Check(client.gets[0].ColumnsToGet, DeepEquals, []string{"blob"})
+	c.Check(client.gets[2].MaxVersion, Equals, int32(2))
+
+	t := resp.TableToRowsResult["t"]
+	c.Assert(t, HasLen, 3)
+	c.Check(t[0].IsSucceed, Equals, true)
+	c.Check(t[0].Columns, HasLen, 0)
+	c.Check(t[1].IsSucceed, Equals, true)
+	c.Check(t[1].Index, Equals, int32(1))
+	c.Check(t[1].PrimaryKey.PrimaryKeys[0].Value, Equals, "big1")
+	c.Check(t[1].Columns[0].Value, DeepEquals, []byte("big1"))
+	c.Check(t[1].ConsumedCapacityUnit.Read, Equals, int32(100))
+	c.Check(t[2].Columns[0].Value, DeepEquals, []byte("big2"))
+	u := resp.TableToRowsResult["u"]
+	c.Check(u[0].IsSucceed, Equals, false)
+	c.Check(u[0].Error.Message, Equals, "response too large")
+	c.Check(resp.FailedRows(), HasLen, 1)
+}
+
+func (s *TableStoreSuite) TestTableDefaults(c *C) {
+	var sent []*otsprotocol.GetRowRequest
+	calls := 0
+	busy, _ := proto.Marshal(&otsprotocol.Error{Code: proto.String(SERVER_BUSY), Message: proto.String("busy")})
+	get, _ := proto.Marshal(&otsprotocol.GetRowResponse{Row: []byte{}, Consumed: &otsprotocol.ConsumedCapacity{
+		CapacityUnit: &otsprotocol.CapacityUnit{Read: proto.Int32(1), Write: proto.Int32(0)}}})
+	interceptor := func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		calls++
+		req := new(otsprotocol.GetRowRequest)
+		proto.Unmarshal(body, req)
+		if req.GetTableName() == "busy" {
+			return busy, fmt.Errorf("busy"), 503, "r1"
+		}
+		sent = append(sent, req)
+		return get, nil, 200, "r1"
+	}
+	client := NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(interceptor),
+		SetTableDefaults("t", TableDefaults{MaxVersion: 1, Filter: NewSingleColumnCondition("c", CT_EQUAL, "x"), Columns: MustColumnSet("c", "d")}),
+		SetTableDefaults("busy", TableDefaults{RetryTimes: 2}),
+		SetTableDefaults("budget", TableDefaults{MaxVersion: 1, CUBudget: 1}))
+
+	criteria := &SingleRowQueryCriteria{TableName: "t", PrimaryKey: new(PrimaryKey)}
+	criteria.PrimaryKey.AddPrimaryKeyColumn("pk", "a")
+	_, err := client.GetRow(&GetRowRequest{SingleRowQueryCriteria: criteria})
+	c.Assert(err, IsNil)
+	c.Check(sent[0].GetMaxVersions(), Equals, int32(1))
+	c.Check(sent[0].ColumnsToGet, DeepEquals, []string{"c", "d"})
+	c.Check(sent[0].Filter, NotNil)
+	c.Check(criteria.MaxVersion, Equals, int32(0))
+	c.Check(criteria.ColumnsToGet, IsNil)
+
+	criteria.MaxVersion = 3
+	criteria.ColumnsToGet = []string{"e"}
+	_, err = client.GetRow(&GetRowRequest{SingleRowQueryCriteria: criteria})
+	c.Assert(err, IsNil)
+	c.Check(sent[1].GetMaxVersions(), Equals, int32(3))
+	c.Check(sent[1].ColumnsToGet, DeepEquals, []string{"e"})
+
+	other := &SingleRowQueryCriteria{TableName: "other", PrimaryKey: criteria.PrimaryKey, MaxVersion: 1}
+	_, err = client.GetRow(&GetRowRequest{SingleRowQueryCriteria: other})
+	c.Assert(err, IsNil)
+	c.Check(sent[2].ColumnsToGet, IsNil)
+	c.Check(sent[2].Filter, IsNil)
+
+	calls = 0
+	busyCriteria := &SingleRowQueryCriteria{TableName: "busy", PrimaryKey: criteria.PrimaryKey, MaxVersion: 1}
+	resp, err := client.GetRow(&GetRowRequest{SingleRowQueryCriteria: busyCriteria})
+	c.Check(err, NotNil)
+	c.Check(resp, IsNil)
+	c.Check(calls, Equals, 3)
+
+	budgetCriteria := &SingleRowQueryCriteria{TableName: "budget", PrimaryKey: criteria.PrimaryKey}
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		_, err = client.GetRow(&GetRowRequest{SingleRowQueryCriteria: budgetCriteria})
+		c.Assert(err, IsNil)
+	}
+	c.Check(time.Since(start) >= 500*time.Millisecond, Equals, true)
+}
+
+func (s *TableStoreSuite) TestValidation(c *C) {
+	pk := new(PrimaryKey)
+	pk.AddPrimaryKeyColumn("id", "a")
+	pk.AddPrimaryKeyColumn("seq", int64(1))
+	c.Check(pk.Err(), IsNil)
+	c.Check(new(PrimaryKey).Err(), NotNil)
+
+	invalid := new(PrimaryKey)
+	invalid.AddPrimaryKeyColumnWithAutoIncrement("id")
+	invalid.AddPrimaryKeyColumn("", "a")
+	invalid.AddPrimaryKeyColumn("n", 1)
+	invalid.AddPrimaryKeyColumn("n", strings.Repeat("x", 2000))
+	err := invalid.Err()
+	c.Assert(err, NotNil)
+	c.Check(err.(*ValidationError).Errors, HasLen, 5)
+	c.Check(strings.HasPrefix(err.Error(), "[tablestore] invalid request: partition key id auto increment; invalid column name"), Equals, true)
+
+	bound := new(PrimaryKey)
+	bound.AddPrimaryKeyColumnWithMinValue("id")
+	c.Check(bound.Err(), IsNil)
+
+	put := &PutRowChange{TableName: "t", PrimaryKey: pk}
+	put.AddColumn("a", "x")
+	put.AddColumn("b", int64(1))
+	c.Check(put.Err(), IsNil)
+	put.AddColumn("c", 1)
+	put.AddColumn("1d", true)
+	put.AddColumn("e", make([]byte, 3<<20))
+	c.Check(put.Err().(*ValidationError).Errors, HasLen, 3)
+	c.Check((&PutRowChange{TableName: "t", PrimaryKey: bound}).Err(), NotNil)
+
+	update := &UpdateRowChange{PrimaryKey: pk}
+	update.PutColumn("a", "x")
+	update.DeleteColumn("b")
+	c.Check(update.Err().(*ValidationError).Errors, HasLen, 1)
+	update.TableName = "t"
+	c.Check(update.Err(), IsNil)
+
+	c.Check((&DeleteRowChange{TableName: "t", PrimaryKey: pk}).Err(), IsNil)
+	c.Check((&DeleteRowChange{TableName: "t"}).Err(), NotNil)
+}
+
+type userId string
+
+func (s *TableStoreSuite) TestValidatedWrites(c *C) {
+	put, _ := proto.Marshal(&otsprotocol.PutRowResponse{Consumed: &otsprotocol.ConsumedCapacity{CapacityUnit: &otsprotocol.CapacityUnit{Read: proto.Int32(0), Write: proto.Int32(1)}}})
+	var sent [][]byte
+	client := NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		req := new(otsprotocol.PutRowRequest)
+		proto.Unmarshal(body, req)
+		sent = append(sent, req.Row)
+		return put, nil, http.StatusOK, "r"
+	}))
+
+	// values of named string and []byte types set without the builders are
+	// written as their underlying types
+	pk := &PrimaryKey{PrimaryKeys: []*PrimaryKeyColumn{{ColumnName: "id", Value: userId("u1")}}}
+	change := &PutRowChange{TableName: "t", PrimaryKey: pk, Condition: &RowCondition{RowExistenceExpectation: RowExistenceExpectation_IGNORE},
+		Columns: []AttributeColumn{{ColumnName: "raw", Value: json.RawMessage(`{"a":0}`)}}}
+	c.Assert(change.Err(), IsNil)
+	_, err := client.PutRow(&PutRowRequest{PutRowChange: change})
+	c.Assert(err, IsNil)
+	c.Assert(sent, HasLen, 1)
+	decodedPk, columns, _, err := DecodeRowChange(sent[0])
+	c.Assert(err, IsNil)
+	c.Check(decodedPk.PrimaryKeys[0].Value, Equals, "u1")
+	c.Check(columns[0].Value, DeepEquals, []byte(`{"a":0}`))
+
+	// invalid changes fail before they are sent
+	sent = nil
+	invalid := &PutRowChange{TableName: "t", PrimaryKey: pk, Condition: change.Condition, Columns: []AttributeColumn{{ColumnName: "m", Value: map[string]int{}}}}
+	_, err = client.PutRow(&PutRowRequest{PutRowChange: invalid})
+	c.Check(err, FitsTypeOf, &ValidationError{})
+	update := &UpdateRowChange{TableName: "t", PrimaryKey: pk, Condition: change.Condition, Columns: []ColumnToUpdate{{ColumnName: "m", Value: 1}}}
+	_, err = client.UpdateRow(&UpdateRowRequest{UpdateRowChange: update})
+	c.Check(err, FitsTypeOf, &ValidationError{})
+	badPk := &PrimaryKey{PrimaryKeys: []*PrimaryKeyColumn{{ColumnName: "id", Value: 1.5}}}
+	_, err = client.DeleteRow(&DeleteRowRequest{DeleteRowChange: &DeleteRowChange{TableName: "t", PrimaryKey: badPk, Condition: change.Condition}})
+	c.Check(err, FitsTypeOf, &ValidationError{})
+	batch := new(BatchWriteRowRequest)
+	batch.AddRowChange(change)
+	batch.AddRowChange(invalid)
+	_, err = client.BatchWriteRow(batch)
+	c.Check(err, FitsTypeOf, &ValidationError{})
+	c.Check(sent, HasLen, 0)
+}
+
+func (s *TableStoreSuite) TestPrimaryKeyValue(c *C) {
+	typed := new(PrimaryKey)
+	typed.AddPrimaryKeyValue("a", PKString("x"))
+	typed.AddPrimaryKeyValue("b", PKInt64(1))
+	typed.AddPrimaryKeyValue("c", PKBinary([]byte{1}))
+	typed.AddPrimaryKeyValue("d", PKAutoIncr())
+	legacy := new(PrimaryKey)
+	legacy.AddPrimaryKeyColumn("a", "x")
+	legacy.AddPrimaryKeyColumn("b", PKInt64(1))
+	legacy.AddPrimaryKeyColumn("c", []byte{1})
+	legacy.AddPrimaryKeyColumnWithAutoIncrement("d")
+	c.Check(typed, DeepEquals, legacy)
+	c.Check(typed.Build(false), DeepEquals, legacy.Build(false))
+
+	value, err := typed.PrimaryKeys[1].PrimaryKeyValue()
+	c.Assert(err, IsNil)
+	i, ok := value.AsInt64()
+	c.Check(i, Equals, int64(1))
+	c.Check(ok, Equals, true)
+	_, ok = value.AsString()
+	c.Check(ok, Equals, false)
+	t, ok := value.Type()
+	c.Check(t, Equals, PrimaryKeyType_INTEGER)
+	value, err = typed.PrimaryKeys[3].PrimaryKeyValue()
+	c.Assert(err, IsNil)
+	c.Check(value.Option(), Equals, AUTO_INCREMENT)
+	c.Check(value.String(), Equals, "auto-incr")
+	c.Check(PKInfMin().String(), Equals, "-inf")
+	c.Check(PKInfMax().Option(), Equals, MAX)
+
+	_, err = (&PrimaryKeyColumn{ColumnName: "a", Value: 1}).PrimaryKeyValue()
+	c.Check(err, NotNil)
+	_, err = NewPrimaryKeyValue(PrimaryKeyValue{})
+	c.Check(err, NotNil)
+	c.Check(typed.Err(), IsNil)
+	typed.AddPrimaryKeyValue("e", PrimaryKeyValue{})
+	c.Check(typed.Err(), ErrorMatches, ".*primary key column e of the invalid zero PrimaryKeyValue.*")
+
+	// invalid primary keys fail the requests sending them, before they are
+	// sent
+	sent := 0
+	client := NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		sent++
+		return nil, errors.New("connection refused"), 0, ""
+	}))
+	_, err = client.GetRow(&GetRowRequest{SingleRowQueryCriteria: &SingleRowQueryCriteria{TableName: "t", PrimaryKey: typed, MaxVersion: 1}})
+	c.Check(err, FitsTypeOf, &ValidationError{})
+	multi := &MultiRowQueryCriteria{TableName: "t", MaxVersion: 1}
+	multi.AddRow(legacy)
+	multi.AddRow(&PrimaryKey{PrimaryKeys: []*PrimaryKeyColumn{{ColumnName: "a", Value: 1}}})
+	_, err = client.BatchGetRow(&BatchGetRowRequest{MultiRowQueryCriteria: []*MultiRowQueryCriteria{multi}})
+	c.Check(err, FitsTypeOf, &ValidationError{})
+	_, err = client.GetRange(&GetRangeRequest{RangeRowQueryCriteria: &RangeRowQueryCriteria{TableName: "t", StartPrimaryKey: legacy, EndPrimaryKey: typed, MaxVersion: 1}})
+	c.Check(err, FitsTypeOf, &ValidationError{})
+	_, err = client.DeleteRow(&DeleteRowRequest{DeleteRowChange: &DeleteRowChange{TableName: "t", PrimaryKey: typed, Condition: &RowCondition{RowExistenceExpectation: RowExistenceExpectation_IGNORE}}})
+	c.Check(err, FitsTypeOf, &ValidationError{})
+	c.Check(sent, Equals, 0)
+}
+
+func (s *TableStoreSuite) TestClone(c *C) {
+	pk := new(PrimaryKey)
+	pk.AddPrimaryKeyColumn("id", []byte("a"))
+	put := &PutRowChange{TableName: "t", PrimaryKey: pk}
+	put.AddColumn("b", []byte("x"))
+	put.SetCondition(RowExistenceExpectation_IGNORE)
+	put.SetColumnCondition(NewSingleColumnCondition("c", CT_EQUAL, "x"))
+	clone := put.Clone()
+	c.Check(clone, DeepEquals, put)
+	c.Check(clone.Serialize(), DeepEquals, put.Serialize())
+	pk.PrimaryKeys[0].Value.([]byte)[0] = 'z'
+	put.Columns[0].Value.([]byte)[0] = 'z'
+	put.AddColumn("d", int64(1))
+	*put.Condition.ColumnCondition.(*SingleColumnCondition).ColumnName = "z"
+	c.Check(clone.PrimaryKey.PrimaryKeys[0].Value, DeepEquals, []byte("a"))
+	c.Check(clone.Columns, HasLen, 1)
+	c.Check(clone.Columns[0].Value, DeepEquals, []byte("x"))
+	c.Check(*clone.Condition.ColumnCondition.(*SingleColumnCondition).ColumnName, Equals, "c")
+
+	batch := new(BatchWriteRowRequest)
+	batch.AddRowChange(put)
+	batch.AddRowChange(&DeleteRowChange{TableName: "t", PrimaryKey: pk, Condition: &RowCondition{}})
+	batchClone := batch.Clone()
+	c.Check(batchClone, DeepEquals, batch)
+	c.Check(batchClone.RowChangesGroupByTable["t"][0] != RowChange(put), Equals, true)
+
+	criteria := &RangeRowQueryCriteria{TableName: "t", StartPrimaryKey: pk, EndPrimaryKey: pk, ColumnsToGet: []string{"b"}, TimeRange: &TimeRange{Start: 1},
+		Filter: &CompositeColumnValueFilter{Operator: LO_AND, Filters: []ColumnFilter{&PaginationFilter{Limit: 1}}}}
+	start := "b"
+	criteria.StartColumn = &start
+	get := (&GetRangeRequest{RangeRowQueryCriteria: criteria}).Clone()
+	c.Check(get.RangeRowQueryCriteria, DeepEquals, criteria)
+	criteria.ColumnsToGet[0] = "z"
+	criteria.TimeRange.Start = 2
+	criteria.Filter.(*CompositeColumnValueFilter).Filters[0].(*PaginationFilter).Limit = 2
+	c.Check(get.RangeRowQueryCriteria.ColumnsToGet, DeepEquals, []string{"b"})
+	c.Check(get.RangeRowQueryCriteria.TimeRange.Start, Equals, int64(1))
+	c.Check(get.RangeRowQueryCriteria.Filter.(*CompositeColumnValueFilter).Filters[0].(*PaginationFilter).Limit, Equals, int32(1))
+
+	multi := &MultiRowQueryCriteria{TableName: "t", MaxVersion: 1}
+	multi.AddRow(pk)
+	c.Check((&BatchGetRowRequest{MultiRowQueryCriteria: []*MultiRowQueryCriteria{multi}}).Clone().MultiRowQueryCriteria[0], DeepEquals, multi)
+}
+
+func (s *TableStoreSuite) TestFrozenRequests(c *C) {
+	put, _ := proto.Marshal(&otsprotocol.PutRowResponse{Consumed: &otsprotocol.ConsumedCapacity{CapacityUnit: &otsprotocol.CapacityUnit{Read: proto.Int32(0), Write: proto.Int32(1)}}})
+	batch, _ := proto.Marshal(&otsprotocol.BatchWriteRowResponse{})
+	pk := new(PrimaryKey)
+	pk.AddPrimaryKeyColumn("id", "a")
+	change := &PutRowChange{TableName: "t", PrimaryKey: pk}
+	change.AddColumn("col", int64(1))
+	change.SetCondition(RowExistenceExpectation_IGNORE)
+	var sent [][]byte
+	// the caller modifies the requests while they are written
+	var inFlight func()
+	client := NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		sent = append(sent, body)
+		if inFlight != nil {
+			inFlight()
+		}
+		switch uri {
+		case batchWriteRowUri:
+			return batch, nil, http.StatusOK, "r"
+		case putRowUri:
+			return put, nil, http.StatusOK, "r"
+		}
+		return nil, errors.New("connection refused"), 0, ""
+	}))
+
+	// requests are not held once the calls return, and may be reused
+	_, err := client.PutRow(&PutRowRequest{PutRowChange: change})
+	c.Assert(err, IsNil)
+	change.AddColumn("other", int64(2))
+	c.Check(change.Columns, HasLen, 2)
+	c.Check(change.Err(), IsNil)
+	_, err = client.PutRow(&PutRowRequest{PutRowChange: change})
+	c.Assert(err, IsNil)
+
+	// modifications while they are held are not applied, and fail the
+	// request
+	inFlight = func() {
+		change.AddColumn("z", int64(3))
+		c.Check(change.SetLifetime(60, time.Minute), Equals, errFrozenRequest)
+	}
+	_, err = client.PutRow(&PutRowRequest{PutRowChange: change})
+	c.Assert(err, IsNil)
+	inFlight = nil
+	c.Check(change.Columns, HasLen, 2)
+	c.Check(change.Err(), ErrorMatches, ".*request modified while the client held it.*")
+	sent = nil
+	_, err = client.PutRow(&PutRowRequest{PutRowChange: change})
+	c.Check(err, Equals, errFrozenRequest)
+	c.Check(sent, HasLen, 0)
+
+	// clones are not failed by the writes to the original
+	clone := change.Clone()
+	c.Check(clone.Err(), IsNil)
+	clone.AddColumn("z", int64(3))
+	c.Check(clone.Columns, HasLen, 3)
+
+	request := new(BatchWriteRowRequest)
+	request.AddRowChange(clone)
+	inFlight = func() {
+		request.AddRowChange(change.Clone())
+		clone.AddColumn("y", "y")
+	}
+	_, err = client.BatchWriteRow(request)
+	c.Assert(err, IsNil)
+	inFlight = nil
+	c.Check(request.RowChangesGroupByTable["t"], HasLen, 1)
+	c.Check(clone.Columns, HasLen, 3)
+	_, err = client.BatchWriteRow(request)
+	c.Check(err, Equals, errFrozenRequest)
+	_, err = client.BatchWriteRow(&BatchWriteRowRequest{RowChangesGroupByTable: map[string][]RowChange{"t": {clone}}})
+	c.Check(err, Equals, errFrozenRequest)
+	_, err = client.BatchWriteRow(request.Clone())
+	c.Check(err, IsNil)
+
+	// held until the calls return, even if they fail
+	criteria := &RangeRowQueryCriteria{TableName: "t", StartPrimaryKey: pk, EndPrimaryKey: pk, MaxVersion: 1}
+	inFlight = func() { criteria.AddColumnToGet("col") }
+	_, err = client.GetRangeRows(&GetRangeRequest{RangeRowQueryCriteria: criteria})
+	c.Check(err, NotNil)
+	c.Check(criteria.ColumnsToGet, HasLen, 0)
+	_, err = client.GetRangeRows(&GetRangeRequest{RangeRowQueryCriteria: criteria})
+	c.Check(err, Equals, errFrozenRequest)
+
+	multi := &MultiRowQueryCriteria{TableName: "t", MaxVersion: 1}
+	multi.AddRow(pk)
+	inFlight = nil
+	client.BatchGetRow(&BatchGetRowRequest{MultiRowQueryCriteria: []*MultiRowQueryCriteria{multi}})
+	multi.AddRow(pk)
+	c.Check(multi.PrimaryKey, HasLen, 2)
+	inFlight = func() { multi.AddRow(pk) }
+	client.BatchGetRow(&BatchGetRowRequest{MultiRowQueryCriteria: []*MultiRowQueryCriteria{multi}})
+	c.Check(multi.PrimaryKey, HasLen, 2)
+	inFlight = nil
+	_, err = client.BatchGetRow(&BatchGetRowRequest{MultiRowQueryCriteria: []*MultiRowQueryCriteria{multi}})
+	c.Check(err, Equals, errFrozenRequest)
+}
+
+func (s *TableStoreSuite) TestConcurrentClient(c *C) {
+	busy, _ := proto.Marshal(&otsprotocol.Error{Code: proto.String(SERVER_BUSY), Message: proto.String("busy")})
+	get, _ := proto.Marshal(&otsprotocol.GetRowResponse{Row: []byte{}, Consumed: &otsprotocol.ConsumedCapacity{
+		CapacityUnit: &otsprotocol.CapacityUnit{Read: proto.Int32(1), Write: proto.Int32(0)}}})
+	var lock sync.Mutex
+	requests, mixed := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests++
+		n := requests
+		if strings.TrimPrefix(r.Header.Get(xOtsAccesskeyid), "id") != strings.TrimPrefix(r.Header.Get(xOtsHeaderStsToken), "token") {
+			mixed++
+		}
+		lock.Unlock()
+		if n%3 == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write(busy)
+			return
+		}
+		w.Write(get)
+	}))
+	defer server.Close()
+
+	config := NewDefaultTableStoreConfig()
+	client := NewClientWithConfig(server.URL, "instance", "id0", "secret", "token0", config)
+	config.RetryTimes = 0
+	criteria := &SingleRowQueryCriteria{TableName: "t", PrimaryKey: new(PrimaryKey), MaxVersion: 1}
+	criteria.PrimaryKey.AddPrimaryKeyColumn("pk", "a")
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10 && errs[i] == nil; j++ {
+				_, errs[i] = client.WithContext(context.Background()).GetRow(&GetRowRequest{SingleRowQueryCriteria: criteria})
+			}
+		}(i)
+	}
+	for i := 1; i <= 20; i++ {
+		client.SetCredentials(fmt.Sprintf("id%d", i), "secret", fmt.Sprintf("token%d", i))
+	}
+	wg.Wait()
+	for _, err := range errs {
+		c.Check(err, IsNil)
+	}
+	c.Check(requests > 80, Equals, true)
+	c.Check(mixed, Equals, 0)
+}
+
+func (s *TableStoreSuite) TestGetRangeRows(c *C) {
+	var rows []*Row
+	for i := 0; i < 3; i++ {
+		pk := new(PrimaryKey)
+		pk.AddPrimaryKeyColumn("pk", fmt.Sprintf("k%d", i))
+		rows = append(rows, &Row{PrimaryKey: pk, Columns: []*AttributeColumn{{ColumnName: "col", Value: int64(i), Timestamp: 1}}})
+	}
+	page, _ := proto.Marshal(&otsprotocol.GetRangeResponse{Rows: EncodeRows(rows), Consumed: &otsprotocol.ConsumedCapacity{
+		CapacityUnit: &otsprotocol.CapacityUnit{Read: proto.Int32(3), Write: proto.Int32(0)}}})
+	corrupted, _ := proto.Marshal(&otsprotocol.GetRangeResponse{Rows: EncodeRows(rows)[:20], Consumed: &otsprotocol.ConsumedCapacity{
+		CapacityUnit: &otsprotocol.CapacityUnit{Read: proto.Int32(3), Write: proto.Int32(0)}}})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get(xOtsInstanceName) {
+		case "chunked":
+			w.Write(page[:10])
+			w.(http.Flusher).Flush()
+			w.Write(page[10:])
+		case "corrupted":
+			w.Write(corrupted)
+		case "oversize":
+			w.Header().Set("Content-Length", strconv.Itoa(maxResponseSize+1))
+		default:
+			w.Write(page)
+		}
+	}))
+	defer server.Close()
+
+	criteria := &RangeRowQueryCriteria{TableName: "t", StartPrimaryKey: new(PrimaryKey), EndPrimaryKey: new(PrimaryKey), MaxVersion: 1}
+	criteria.StartPrimaryKey.AddPrimaryKeyColumnWithMinValue("pk")
+	criteria.EndPrimaryKey.AddPrimaryKeyColumnWithMaxValue("pk")
+	request := &GetRangeRequest{RangeRowQueryCriteria: criteria}
+	for _, instance := range []string{"sized", "chunked"} {
+		client := NewClient(server.URL, instance, "a", "b")
+		resp, err := client.GetRange(request)
+		c.Assert(err, IsNil)
+		c.Check(resp.Rows, DeepEquals, rows)
+		c.Check(resp.ConsumedCapacityUnit.Read, Equals, int32(3))
+
+		it, err := client.GetRangeRows(request)
+		c.Assert(err, IsNil)
+		for _, row := range rows {
+			next, err := it.Next()
+			c.Assert(err, IsNil)
+			c.Check(next, DeepEquals, row)
+		}
+		_, err = it.Next()
+		c.Check(err, Equals, io.EOF)
+		_, err = it.Next()
+		c.Check(err, Equals, io.EOF)
+	}
+
+	it, err := NewClient(server.URL, "corrupted", "a", "b").GetRangeRows(request)
+	c.Assert(err, IsNil)
+	_, err = it.Next()
+	c.Assert(err, NotNil)
+	_, again := it.Next()
+	c.Check(again, Equals, err)
+
+	_, err = NewClient(server.URL, "oversize", "a", "b").GetRange(request)
+	c.Check(err, ErrorMatches, ".*response of 67108865 bytes.*")
+}
+
+func (s *TableStoreSuite) TestSearchScores(c *C) {
+	var encoded [][]byte
+	for i := 0; i < 2; i++ {
+		pk := new(PrimaryKey)
+		pk.AddPrimaryKeyColumn("pk", fmt.Sprintf("k%d", i))
+		encoded = append(encoded, EncodeRows([]*Row{{PrimaryKey: pk}}))
+	}
+	hits := proto.NewBuffer(nil)
+	for _, score := range []float64{2.5, 0.75} {
+		hit := proto.NewBuffer(nil)
+		hit.EncodeVarint(1<<3 | proto.WireVarint)
+		hit.EncodeVarint(7)
+		hit.EncodeVarint(3<<3 | proto.WireFixed64)
+		hit.EncodeFixed64(math.Float64bits(score))
+		hits.EncodeVarint(5<<3 | proto.WireBytes)
+		hits.EncodeRawBytes(hit.Bytes())
+	}
+	scored, _ := proto.Marshal(&otsprotocol.SearchResponse{TotalHits: proto.Int64(10), Rows: encoded, IsAllSucceeded: proto.Bool(true)})
+	scored = append(scored, hits.Bytes()...)
+	bare, _ := proto.Marshal(&otsprotocol.SearchResponse{Rows: encoded})
+	// a hit with a truncated score
+	corrupted := append(append([]byte{}, bare...), 5<<3|proto.WireBytes, 2, 3<<3|proto.WireFixed64, 0)
+
+	var body []byte
+	interceptor := func(uri string, _ []byte, next Invoker) ([]byte, error, int, string) {
+		return body, nil, http.StatusOK, "r"
+	}
+	client := NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(interceptor))
+	request := &SearchRequest{TableName: "t", IndexName: "i", SearchQuery: search.NewSearchQuery()}
+
+	body = scored
+	resp, err := client.Search(request)
+	c.Assert(err, IsNil)
+	c.Check(resp.GetTotalCount(), Equals, int64(10))
+	c.Check(resp.GetIsAllSucceeded(), Equals, true)
+	c.Check(resp.Rows, HasLen, 2)
+	c.Check(resp.Scores, DeepEquals, []float64{2.5, 0.75})
+	score, ok := resp.GetScore(1)
+	c.Check(score, Equals, 0.75)
+	c.Check(ok, Equals, true)
+	_, ok = resp.GetScore(2)
+	c.Check(ok, Equals, false)
+
+	body = bare
+	resp, err = client.Search(request)
+	c.Assert(err, IsNil)
+	c.Check(resp.GetTotalCount(), Equals, int64(-1))
+	c.Check(resp.GetIsAllSucceeded(), Equals, false)
+	c.Check(resp.Scores, IsNil)
+
+	body = corrupted
+	_, err = client.Search(request)
+	c.Check(err, Equals, errCorruptedSearchResponse)
+
+	resp = nil
+	c.Check(resp.GetTotalCount(), Equals, int64(-1))
+}
+
+func (s *TableStoreSuite) TestSearchRouting(c *C) {
+	setting := &IndexSetting{RoutingFields: []string{"tenant", "user"}}
+	c.Check(setting.Err(), IsNil)
+	c.Check((&IndexSetting{RoutingFields: []string{"tenant", "", "tenant"}}).Err(), ErrorMatches, `.*invalid column name.*routing field tenant repeated`)
+
+	pk := new(PrimaryKey)
+	pk.AddPrimaryKeyColumn("user", "u1")
+	pk.AddPrimaryKeyColumn("tenant", "t1")
+	pk.AddPrimaryKeyColumn("id", int64(1))
+	value, err := setting.RoutingValue(pk)
+	c.Assert(err, IsNil)
+	c.Check(value.PrimaryKeys, DeepEquals, []*PrimaryKeyColumn{{ColumnName: "tenant", Value: "t1"}, {ColumnName: "user", Value: "u1"}})
+	_, err = (&IndexSetting{RoutingFields: []string{"shard"}}).RoutingValue(pk)
+	c.Check(err, ErrorMatches, `\[tablestore\] missing routing field shard`)
+
+	request := &SearchRequest{TableName: "t", IndexName: "i", SearchQuery: search.NewSearchQuery()}
+	req, err := request.AddRoutingValue(value).ProtoBuffer()
+	c.Assert(err, IsNil)
+	c.Check(req.RoutingValues, HasLen, 1)
+	_, err = request.AddRoutingValue(new(PrimaryKey)).ProtoBuffer()
+	c.Check(err, ErrorMatches, `\[tablestore\] empty routing value`)
+
+	calls := 0
+	interceptor := func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		calls++
+		return nil, nil, http.StatusOK, "r"
+	}
+	client := NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(interceptor))
+	_, err = client.CreateSearchIndex(&CreateSearchIndexRequest{TableName: "t", IndexName: "i", IndexSchema: &IndexSchema{
+		IndexSetting: &IndexSetting{RoutingFields: []string{"tenant", "tenant"}}}})
+	c.Check(err, NotNil)
+	c.Check(calls, Equals, 0)
+}
+
+func (s *TableStoreSuite) TestSearchCollapse(c *C) {
+	var query otsprotocol.SearchQuery
+	interceptor := func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		req := new(otsprotocol.SearchRequest)
+		if err := proto.Unmarshal(body, req); err != nil {
+			return nil, err, 0, ""
+		}
+		if err := proto.Unmarshal(req.SearchQuery, &query); err != nil {
+			return nil, err, 0, ""
+		}
+		resp, _ := proto.Marshal(&otsprotocol.SearchResponse{TotalHits: proto.Int64(0), IsAllSucceeded: proto.Bool(true)})
+		return resp, nil, http.StatusOK, "r"
+	}
+	client := NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(interceptor))
+	searchQuery := search.NewSearchQuery().SetCollapse(&search.Collapse{FieldName: "merchant"})
+	_, err := client.Search(&SearchRequest{TableName: "t", IndexName: "i", SearchQuery: searchQuery})
+	c.Assert(err, IsNil)
+	c.Check(query.GetCollapse().GetFieldName(), Equals, "merchant")
+
+	searchQuery.SetCollapse(&search.Collapse{})
+	_, err = client.Search(&SearchRequest{TableName: "t", IndexName: "i", SearchQuery: searchQuery})
+	c.Check(err, ErrorMatches, "Collapse: fieldName not set.")
+}
+
+type nestedItem struct {
+	Name  string  `json:"name"`
+	Price float64 `json:"price"`
+}
+
+func (s *TableStoreSuite) TestNested(c *C) {
+	value, err := EncodeNested([]nestedItem{{"a", 1.5}, {"b", 2}})
+	c.Assert(err, IsNil)
+	c.Check(value, Equals, `[{"name":"a","price":1.5},{"name":"b","price":2}]`)
+	_, err = EncodeNested(nestedItem{"a", 1})
+	c.Check(err, ErrorMatches, `.*not an array`)
+
+	var items []nestedItem
+	c.Assert(DecodeNested(value, &items), IsNil)
+	c.Check(items, DeepEquals, []nestedItem{{"a", 1.5}, {"b", 2}})
+	var objects []map[string]interface{}
+	c.Assert(DecodeNested([]byte(value), &objects), IsNil)
+	c.Check(objects[1]["name"], Equals, "b")
+	c.Check(DecodeNested(int64(1), &objects), ErrorMatches, `.*not a string`)
+	c.Check(DecodeNested("{", &objects), ErrorMatches, `\[tablestore\] invalid nested value.*`)
+
+	query := &search.NestedQuery{Path: "items", Query: &search.TermQuery{FieldName: "items.name", Term: "a"}, ScoreMode: search.ScoreMode_Max}
+	pb, err := query.ProtoBuffer()
+	c.Assert(err, IsNil)
+	nested := new(otsprotocol.NestedQuery)
+	c.Assert(proto.Unmarshal(pb.Query, nested), IsNil)
+	c.Check(nested.GetPath(), Equals, "items")
+	c.Check(nested.GetScoreMode(), Equals, otsprotocol.ScoreMode_SCORE_MODE_MAX)
+	_, err = (&search.NestedQuery{Path: "items"}).ProtoBuffer()
+	c.Check(err, ErrorMatches, "NestedQuery: query not set.")
+	_, err = (&search.NestedQuery{Path: "items", Query: query.Query, ScoreMode: 9}).ProtoBuffer()
+	c.Check(err, ErrorMatches, "NestedQuery: unknown score mode.")
+}
+
+func (s *TableStoreSuite) TestExistsAndNull(c *C) {
+	row := &Row{Columns: []*AttributeColumn{
+		{ColumnName: "name", Value: "", Timestamp: 1},
+		{ColumnName: "age", Value: int64(1), Timestamp: 1},
+		{ColumnName: "age", Value: int64(2), Timestamp: 2},
+	}}
+	value, ok := row.LookupColumn("name")
+	c.Check(ok, Equals, true)
+	c.Check(IsEmptyValue(value), Equals, true)
+	value, ok = row.LookupColumn("age")
+	c.Check(value, Equals, int64(2))
+	c.Check(IsEmptyValue(value), Equals, false)
+	c.Check(row.HasColumn("email"), Equals, false)
+	c.Check(IsEmptyValue([]byte{}), Equals, true)
+	response := &GetRowResponse{Columns: row.Columns}
+	c.Check(response.HasColumn("name"), Equals, true)
+	c.Check(response.HasColumn("email"), Equals, false)
+
+	pb, err := (&search.ExistsQuery{FieldName: "email"}).ProtoBuffer()
+	c.Assert(err, IsNil)
+	c.Check(int32(pb.GetType()), Equals, int32(16))
+	// ExistsQuery has the layout of a PrefixQuery without prefix
+	exists := new(otsprotocol.PrefixQuery)
+	c.Assert(proto.Unmarshal(pb.Query, exists), IsNil)
+	c.Check(exists.GetFieldName(), Equals, "email")
+	_, err = (&search.ExistsQuery{}).ProtoBuffer()
+	c.Check(err, ErrorMatches, "ExistsQuery: fieldName not set.")
+
+	pb, err = search.NewIsNullQuery("email").ProtoBuffer()
+	c.Assert(err, IsNil)
+	isNull := new(otsprotocol.BoolQuery)
+	c.Assert(proto.Unmarshal(pb.Query, isNull), IsNil)
+	c.Check(isNull.MustNotQueries, HasLen, 1)
+	c.Check(int32(isNull.MustNotQueries[0].GetType()), Equals, int32(16))
+}
+
+func (s *TableStoreSuite) TestGeo(c *C) {
+	point, err := search.ParseGeoPoint("30.5, 120.25")
+	c.Assert(err, IsNil)
+	c.Check(point, Equals, search.GeoPoint{Lat: 30.5, Lon: 120.25})
+	c.Check(point.String(), Equals, "30.5,120.25")
+	_, err = search.ParseGeoPoint("91,0")
+	c.Check(err, ErrorMatches, `GeoPoint: latitude 91 out of .*`)
+	_, err = search.NewGeoPoint(0, -181)
+	c.Check(err, NotNil)
+
+	topLeft, bottomRight := search.BoundingBox(search.GeoPoint{}, 111195)
+	c.Check(math.Abs(topLeft.Lat-1) < 1e-3 && math.Abs(bottomRight.Lat+1) < 1e-3, Equals, true)
+	c.Check(math.Abs(topLeft.Lon+1) < 1e-3 && math.Abs(bottomRight.Lon-1) < 1e-3, Equals, true)
+	topLeft, bottomRight = search.BoundingBox(search.GeoPoint{Lat: 60, Lon: 179.5}, 111195)
+	c.Check(math.Abs(topLeft.Lon-177.5) < 1e-2 && math.Abs(bottomRight.Lon+178.5) < 1e-2, Equals, true)
+	topLeft, bottomRight = search.BoundingBox(search.GeoPoint{Lat: 89.5}, 111195)
+	c.Check(topLeft, Equals, search.GeoPoint{Lat: 90, Lon: -180})
+	c.Check(bottomRight.Lon, Equals, 180.0)
+
+	box, err := search.NewGeoBoundingBoxQuery("location", search.GeoPoint{}, 111195)
+	c.Assert(err, IsNil)
+	corner, err := search.ParseGeoPoint(box.TopLeft)
+	c.Assert(err, IsNil)
+	c.Check(math.Abs(corner.Lat-1) < 1e-3 && math.Abs(corner.Lon+1) < 1e-3, Equals, true)
+	_, err = search.NewGeoDistanceQuery("location", point, 0)
+	c.Check(err, NotNil)
+
+	square := []search.GeoPoint{{Lat: 0, Lon: 0}, {Lat: 0, Lon: 1}, {Lat: 1, Lon: 1}, {Lat: 1, Lon: 0}}
+	polygon, err := search.NewGeoPolygonQuery("location", square)
+	c.Assert(err, IsNil)
+	c.Check(polygon.Points, DeepEquals, []string{"0,0", "0,1", "1,1", "1,0"})
+	wkt, err := search.PolygonWKT(square)
+	c.Assert(err, IsNil)
+	c.Check(wkt, Equals, "POLYGON((0 0, 1 0, 1 1, 0 1, 0 0))")
+	c.Check(square, HasLen, 4)
+	_, err = search.PolygonWKT([]search.GeoPoint{{Lat: 0, Lon: 0}, {Lat: 1, Lon: 1}, {Lat: 0, Lon: 0}})
+	c.Check(err, ErrorMatches, "GeoPolygon: less than 3 distinct points.")
+}
+
+func (s *TableStoreSuite) TestDateAggregation(c *C) {
+	shanghai := time.FixedZone("CST", 8*3600)
+	millis := DateFormat{Location: shanghai}
+	t, err := millis.Parse(int64(1500000000123))
+	c.Assert(err, IsNil)
+	c.Check(t.Equal(time.Unix(1500000000, 123000000)), Equals, true)
+	c.Check(t.Location(), Equals, shanghai)
+	c.Check(millis.Format(t), Equals, int64(1500000000123))
+	_, err = millis.Parse("2017")
+	c.Check(err, ErrorMatches, `.*not epoch milliseconds`)
+
+	layout := DateFormat{Layout: "2006-01-02 15:04:05", Location: shanghai}
+	t, err = layout.Parse("2017-07-14 10:40:00")
+	c.Assert(err, IsNil)
+	c.Check(t.UTC().Format(time.RFC3339), Equals, "2017-07-14T02:40:00Z")
+	c.Check(layout.Format(t.UTC()), Equals, "2017-07-14 10:40:00")
+
+	var orders []otsprotocol.SortOrder
+	interceptor := func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		req := new(otsprotocol.SearchRequest)
+		query := new(otsprotocol.SearchQuery)
+		if err := proto.Unmarshal(body, req); err != nil {
+			return nil, err, 0, ""
+		}
+		if err := proto.Unmarshal(req.SearchQuery, query); err != nil {
+			return nil, err, 0, ""
+		}
+		fieldSort := query.GetSort().GetSorter()[0].GetFieldSort()
+		orders = append(orders, fieldSort.GetOrder())
+		pk := new(PrimaryKey)
+		pk.AddPrimaryKeyColumn("pk", "a")
+		value := "2017-07-14 10:40:00"
+		if fieldSort.GetOrder() == otsprotocol.SortOrder_SORT_ORDER_ASC {
+			value = "2017-07-01 00:00:00"
+		}
+		row := EncodeRows([]*Row{{PrimaryKey: pk, Columns: []*AttributeColumn{{ColumnName: fieldSort.GetFieldName(), Value: value, Timestamp: 1}}}})
+		resp, _ := proto.Marshal(&otsprotocol.SearchResponse{TotalHits: proto.Int64(1), Rows: [][]byte{row}, IsAllSucceeded: proto.Bool(true)})
+		return resp, nil, http.StatusOK, "r"
+	}
+	client := NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(interceptor))
+	aggregation := &DateAggregation{TableName: "t", IndexName: "i", FieldName: "created", Format: layout}
+	max, ok, err := aggregation.Max(client)
+	c.Assert(err, IsNil)
+	c.Check(ok, Equals, true)
+	c.Check(max.Format("2006-01-02 15:04"), Equals, "2017-07-14 10:40")
+	min, ok, err := aggregation.Min(client)
+	c.Assert(err, IsNil)
+	c.Check(min.Day(), Equals, 1)
+	c.Check(orders, DeepEquals, []otsprotocol.SortOrder{otsprotocol.SortOrder_SORT_ORDER_DESC, otsprotocol.SortOrder_SORT_ORDER_ASC})
+}
+
+func (s *TableStoreSuite) TestAtomicBatchWriteRow(c *C) {
+	var unrecognized [][]byte
+	interceptor := func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		req := new(otsprotocol.BatchWriteRowRequest)
+		if err := proto.Unmarshal(body, req); err != nil {
+			return nil, err, 0, ""
+		}
+		unrecognized = append(unrecognized, req.XXX_unrecognized)
+		resp := new(otsprotocol.BatchWriteRowResponse)
+		for _, table := range req.Tables {
+			result := &otsprotocol.TableInBatchWriteRowResponse{TableName: table.TableName}
+			for range table.Rows {
+				result.Rows = append(result.Rows, &otsprotocol.RowInBatchWriteRowResponse{IsOk: proto.Bool(true), Consumed: &otsprotocol.ConsumedCapacity{
+					CapacityUnit: &otsprotocol.CapacityUnit{Read: proto.Int32(0), Write: proto.Int32(1)}}})
+			}
+			resp.Tables = append(resp.Tables, result)
+		}
+		data, _ := proto.Marshal(resp)
+		return data, nil, http.StatusOK, "r"
+	}
+	client := NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(interceptor))
+	change := func(user string, id int64) RowChange {
+		pk := new(PrimaryKey)
+		pk.AddPrimaryKeyColumn("user", user)
+		pk.AddPrimaryKeyColumn("id", id)
+		change := &PutRowChange{TableName: "t", PrimaryKey: pk}
+		change.AddColumn("col", id)
+		change.SetCondition(RowExistenceExpectation_IGNORE)
+		return change
+	}
+
+	request := &BatchWriteRowRequest{IsAtomic: true}
+	request.AddRowChange(change("u1", 1))
+	request.AddRowChange(change("u1", 2))
+	resp, err := client.BatchWriteRow(request)
+	c.Assert(err, IsNil)
+	c.Check(resp.TableToRowsResult["t"], HasLen, 2)
+	c.Check(request.Clone().IsAtomic, Equals, true)
+
+	request.IsAtomic = false
+	_, err = client.BatchWriteRow(request)
+	c.Assert(err, IsNil)
+	c.Check(unrecognized, DeepEquals, [][]byte{{3<<3 | proto.WireVarint, 1}, nil})
+
+	request.IsAtomic = true
+	request.AddRowChange(change("u2", 3))
+	_, err = client.BatchWriteRow(request)
+	c.Check(err, ErrorMatches, `\[tablestore\] atomic batch write of table t: partition keys u1 and u2 differ`)
+	c.Check(unrecognized, HasLen, 2)
+}
+
+type indexWaitClient struct {
+	TableStoreApi
+	phases []SyncPhase
+	calls  int
+}
+
+func (client *indexWaitClient) phase() SyncPhase {
+	phase := client.phases[len(client.phases)-1]
+	if client.calls < len(client.phases) {
+		phase = client.phases[client.calls]
+	}
+	client.calls++
+	return phase
+}
+
+func (client *indexWaitClient) DescribeTable(request *DescribeTableRequest) (*DescribeTableResponse, error) {
+	resp := &DescribeTableResponse{}
+	if phase := client.phase(); phase >= 0 {
+		resp.IndexMetas = []*IndexMeta{{IndexName: "i", SyncPhase: phase}}
+	}
+	return resp, nil
+}
+
+func (client *indexWaitClient) DescribeSearchIndex(request *DescribeSearchIndexRequest) (*DescribeSearchIndexResponse, error) {
+	return &DescribeSearchIndexResponse{SyncStat: &SyncStat{SyncPhase: client.phase()}}, nil
+}
+
+func (s *TableStoreSuite) TestWaitIndexReady(c *C) {
+	meta := &otsprotocol.IndexMeta{Name: proto.String("i"), IndexType: otsprotocol.IndexType_IT_GLOBAL_INDEX.Enum()}
+	c.Check(ConvertPbIndexMetaToIndexMeta(meta).SyncPhase, Equals, SyncPhase(0))
+	meta.XXX_unrecognized = []byte{6<<3 | proto.WireVarint, 2}
+	c.Check(ConvertPbIndexMetaToIndexMeta(meta).SyncPhase, Equals, SyncPhase_FULL)
+	meta.XXX_unrecognized = []byte{6<<3 | proto.WireVarint, 3}
+	c.Check(ConvertPbIndexMetaToIndexMeta(meta).SyncPhase, Equals, SyncPhase_INCR)
+
+	// missing, then building
+	client := &indexWaitClient{phases: []SyncPhase{-1, SyncPhase_FULL, SyncPhase_INCR}}
+	c.Assert(WaitIndexReady(context.Background(), client, "t", "i", time.Millisecond), IsNil)
+	c.Check(client.calls, Equals, 3)
+	client = &indexWaitClient{phases: []SyncPhase{0}}
+	c.Assert(WaitIndexReady(context.Background(), client, "t", "i", time.Millisecond), IsNil)
+	c.Check(client.calls, Equals, 1)
+
+	client = &indexWaitClient{phases: []SyncPhase{SyncPhase_FULL, SyncPhase_INCR}}
+	c.Assert(WaitSearchIndexReady(context.Background(), client, "t", "i", time.Millisecond), IsNil)
+	c.Check(client.calls, Equals, 2)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	client = &indexWaitClient{phases: []SyncPhase{SyncPhase_FULL}}
+	c.Check(WaitSearchIndexReady(ctx, client, "t", "i", time.Millisecond), Equals, context.DeadlineExceeded)
+}
+
+type auditRecords []*AuditRecord
+
+func (records *auditRecords) Audit(record *AuditRecord) {
+	*records = append(*records, record)
+}
+
+func (s *TableStoreSuite) TestAuditSink(c *C) {
+	pk := func(user string) *PrimaryKey {
+		pk := new(PrimaryKey)
+		pk.AddPrimaryKeyColumn("user", user)
+		return pk
+	}
+	row := &PutRowChange{TableName: "users", PrimaryKey: pk("u2")}
+	row.AddColumn("name", "bob")
+	interceptor := func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		consumed := &otsprotocol.ConsumedCapacity{CapacityUnit: &otsprotocol.CapacityUnit{Read: proto.Int32(1), Write: proto.Int32(1)}}
+		var resp proto.Message
+		switch uri {
+		case updateRowUri:
+			resp = &otsprotocol.UpdateRowResponse{Consumed: consumed}
+		case getRangeUri:
+			resp = &otsprotocol.GetRangeResponse{Consumed: consumed, Rows: row.Serialize()}
+		default:
+			return nil, fmt.Errorf("unexpected %s", uri), 0, ""
+		}
+		data, _ := proto.Marshal(resp)
+		return data, nil, http.StatusOK, "r"
+	}
+	var records auditRecords
+	client := NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(interceptor), SetAuditSink(&records, "users"))
+	ctx := WithPrincipal(context.Background(), "alice")
+	c.Check(PrincipalFrom(ctx), Equals, "alice")
+	c.Check(PrincipalFrom(context.Background()), Equals, "")
+
+	update := &UpdateRowChange{TableName: "users", PrimaryKey: pk("u1")}
+	update.PutColumn("name", "al")
+	update.SetCondition(RowExistenceExpectation_IGNORE)
+	_, err := client.WithContext(ctx).UpdateRow(&UpdateRowRequest{UpdateRowChange: update})
+	c.Assert(err, IsNil)
+
+	criteria := &RangeRowQueryCriteria{TableName: "users", StartPrimaryKey: new(PrimaryKey), EndPrimaryKey: new(PrimaryKey), MaxVersion: 1}
+	criteria.StartPrimaryKey.AddPrimaryKeyColumnWithMinValue("user")
+	criteria.EndPrimaryKey.AddPrimaryKeyColumnWithMaxValue("user")
+	_, err = client.WithContext(ctx).GetRange(&GetRangeRequest{RangeRowQueryCriteria: criteria})
+	c.Assert(err, IsNil)
+
+	criteria.TableName = "public"
+	_, err = client.GetRange(&GetRangeRequest{RangeRowQueryCriteria: criteria})
+	c.Assert(err, IsNil)
+
+	_, err = client.GetRow(&GetRowRequest{SingleRowQueryCriteria: &SingleRowQueryCriteria{TableName: "users", PrimaryKey: pk("u3"), MaxVersion: 1}})
+	c.Assert(err, NotNil)
+
+	c.Assert(records, HasLen, 3)
+	c.Check(records[0].Principal, Equals, "alice")
+	c.Check(records[0].Action, Equals, "UpdateRow")
+	c.Check(records[0].Write, Equals, true)
+	c.Check(records[0].PrimaryKeys, DeepEquals, []*PrimaryKey{pk("u1")})
+	c.Check(records[1].Action, Equals, "GetRange")
+	c.Check(records[1].Write, Equals, false)
+	c.Check(records[1].PrimaryKeys, DeepEquals, []*PrimaryKey{pk("u2")})
+	c.Check(records[2].Principal, Equals, "")
+	c.Check(records[2].PrimaryKeys, DeepEquals, []*PrimaryKey{pk("u3")})
+	c.Check(records[2].Err, NotNil)
+}
+
+func (s *TableStoreSuite) TestPutRowIdempotent(c *C) {
+	pk := new(PrimaryKey)
+	pk.AddPrimaryKeyColumn("id", "order1")
+	change := &PutRowChange{TableName: "orders", PrimaryKey: pk}
+	change.AddColumn("amount", int64(10))
+	token := NewIdempotencyToken()
+	c.Check(token, HasLen, 32)
+	c.Check(NewIdempotencyToken(), Not(Equals), token)
+
+	// the row stored by the fake service
+	var stored []byte
+	conflict, _ := proto.Marshal(&otsprotocol.Error{Code: proto.String(CONDITION_CHECK_FAIL), Message: proto.String("Condition check failed.")})
+	puts := 0
+	interceptor := func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		var resp proto.Message
+		switch uri {
+		case putRowUri:
+			puts++
+			if stored != nil {
+				return conflict, fmt.Errorf("conflict"), 403, "r"
+			}
+			req := new(otsprotocol.PutRowRequest)
+			proto.Unmarshal(body, req)
+			stored = req.Row
+			if puts == 1 {
+				// applied, but the response is lost
+				return nil, &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}, 0, ""
+			}
+			resp = &otsprotocol.PutRowResponse{Consumed: &otsprotocol.ConsumedCapacity{CapacityUnit: &otsprotocol.CapacityUnit{Read: proto.Int32(0), Write: proto.Int32(1)}}}
+		case getRowUri:
+			resp = &otsprotocol.GetRowResponse{Consumed: &otsprotocol.ConsumedCapacity{CapacityUnit: &otsprotocol.CapacityUnit{Read: proto.Int32(1), Write: proto.Int32(0)}}, Row: stored}
+		default:
+			return nil, fmt.Errorf("unexpected %s", uri), 0, ""
+		}
+		data, _ := proto.Marshal(resp)
+		return data, nil, http.StatusOK, "r"
+	}
+	client := NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(interceptor))
+
+	resp, err := client.PutRowIdempotent(change, token)
+	c.Assert(err, IsNil)
+	c.Check(resp.PrimaryKey, DeepEquals, *pk)
+	c.Check(puts, Equals, 2)
+	c.Check(change.Columns, HasLen, 1)
+
+	// retried by the caller
+	_, err = client.PutRowIdempotent(change, token)
+	c.Check(err, IsNil)
+	// another logical write of the row
+	_, err = client.PutRowIdempotent(change, NewIdempotencyToken())
+	c.Check(err, Equals, ErrRowAlreadyExists)
+
+	auto := new(PrimaryKey)
+	auto.AddPrimaryKeyColumnWithAutoIncrement("id")
+	_, err = client.PutRowIdempotent(&PutRowChange{TableName: "orders", PrimaryKey: auto}, token)
+	c.Check(err, Equals, ErrAutoIncrementToken)
+
+	// failures are retried by the client only, within the retry policy of
+	// the table, and only if the put may have been applied
+	timeout, _ := proto.Marshal(&otsprotocol.Error{Code: proto.String(STORAGE_TIMEOUT), Message: proto.String("Operation timeout.")})
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+	refused := errors.New("refused by interceptor")
+	// the failures of the next puts, which succeed afterwards
+	var failures []string
+	puts = 0
+	interceptor = func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		puts++
+		if len(failures) > 0 {
+			failure := failures[0]
+			failures = failures[1:]
+			switch failure {
+			case "timeout":
+				return timeout, fmt.Errorf("timeout"), 503, "r"
+			case "bad gateway":
+				return []byte("<html>"), fmt.Errorf("bad gateway"), 502, ""
+			case "reset":
+				return nil, reset, 0, ""
+			case "refused":
+				return nil, refused, 0, ""
+			}
+		}
+		data, _ := proto.Marshal(&otsprotocol.PutRowResponse{Consumed: &otsprotocol.ConsumedCapacity{CapacityUnit: &otsprotocol.CapacityUnit{Read: proto.Int32(0), Write: proto.Int32(1)}}})
+		return data, nil, http.StatusOK, "r"
+	}
+	client = NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(interceptor), SetTableDefaults("orders", TableDefaults{RetryTimes: 2}))
+
+	puts, failures = 0, []string{"timeout", "reset"}
+	_, err = client.PutRowIdempotent(change, token)
+	c.Check(err, IsNil)
+	c.Check(puts, Equals, 3)
+
+	puts, failures = 0, []string{"reset", "reset", "reset", "reset"}
+	_, err = client.PutRowIdempotent(change, token)
+	c.Check(err, Equals, reset)
+	c.Check(puts, Equals, 3)
+
+	puts, failures = 0, []string{"bad gateway", "bad gateway", "bad gateway", "bad gateway"}
+	_, err = client.PutRowIdempotent(change, token)
+	c.Check(err, NotNil)
+	c.Check(puts, Equals, 3)
+
+	puts, failures = 0, []string{"refused"}
+	_, err = client.PutRowIdempotent(change, token)
+	c.Check(err, Equals, refused)
+	c.Check(puts, Equals, 1)
+
+	// other puts are not retried on transport errors
+	plain := change.Clone()
+	plain.SetCondition(RowExistenceExpectation_IGNORE)
+	puts, failures = 0, []string{"reset"}
+	_, err = client.PutRow(&PutRowRequest{PutRowChange: plain})
+	c.Check(err, Equals, reset)
+	c.Check(puts, Equals, 1)
+}
+
+func (s *TableStoreSuite) TestBatchGetRowPartialRetry(c *C) {
+	pk := func(v string) *PrimaryKey {
+		pk := new(PrimaryKey)
+		pk.AddPrimaryKeyColumn("pk", v)
+		return pk
+	}
+	consumed := &otsprotocol.ConsumedCapacity{CapacityUnit: &otsprotocol.CapacityUnit{Read: proto.Int32(1), Write: proto.Int32(0)}}
+	// number of times each row is busy
+	busy := map[string]int{"b": 1, "d": 2, "e": 2, "never": 100}
+	var sent [][]string
+	interceptor := func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		req := new(otsprotocol.BatchGetRowRequest)
+		proto.Unmarshal(body, req)
+		resp := new(otsprotocol.BatchGetRowResponse)
+		var keys []string
+		for _, table := range req.Tables {
+			result := &otsprotocol.TableInBatchGetRowResponse{TableName: table.TableName}
+			for _, key := range table.PrimaryKey {
+				decoded, _ := DecodePrimaryKey(key)
+				v := decoded.PrimaryKeys[0].Value.(string)
+				keys = append(keys, table.GetTableName()+"/"+v)
+				row := &otsprotocol.RowInBatchGetRowResponse{IsOk: proto.Bool(true), Row: (&PutRowChange{PrimaryKey: pk(v)}).Serialize(), Consumed: consumed}
+				if busy[v] > 0 {
+					busy[v]--
+					row = &otsprotocol.RowInBatchGetRowResponse{IsOk: proto.Bool(false), Error: &otsprotocol.Error{Code: proto.String(SERVER_BUSY), Message: proto.String("busy")}}
+				} else if v == "invalid" {
+					row = &otsprotocol.RowInBatchGetRowResponse{IsOk: proto.Bool(false), Error: &otsprotocol.Error{Code: proto.String("OTSParameterInvalid"), Message: proto.String("invalid")}}
+				}
+				result.Rows = append(result.Rows, row)
+			}
+			resp.Tables = append(resp.Tables, result)
+		}
+		sent = append(sent, keys)
+		data, _ := proto.Marshal(resp)
+		return data, nil, 200, "r"
+	}
+	client := NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(interceptor))
+	client.config.RetryTimes = 3
+	request := &BatchGetRowRequest{MultiRowQueryCriteria: []*MultiRowQueryCriteria{
+		{TableName: "t", PrimaryKey: []*PrimaryKey{pk("a"), pk("b"), pk("invalid")}, MaxVersion: 1},
+		{TableName: "u", PrimaryKey: []*PrimaryKey{pk("d"), pk("never")}, MaxVersion: 1},
+		{TableName: "t", PrimaryKey: []*PrimaryKey{pk("e")}, MaxVersion: 1},
+	}}
+	resp, err := client.BatchGetRow(request)
+	c.Assert(err, IsNil)
+	c.Check(sent, DeepEquals, [][]string{
+		{"t/a", "t/b", "t/invalid", "u/d", "u/never", "t/e"},
+		{"t/b", "u/d", "u/never", "t/e"},
+		{"u/d", "u/never", "t/e"},
+		{"u/never"},
+	})
+	c.Check(resp.Attempts, Equals, 4)
+	t := resp.TableToRowsResult["t"]
+	c.Assert(t, HasLen, 4)
+	for i, v := range []string{"a", "b", "", "e"} {
+		c.Check(t[i].Index, Equals, int32(i))
+		if v != "" {
+			c.Check(t[i].IsSucceed, Equals, true)
+			c.Check(t[i].PrimaryKey.PrimaryKeys[0].Value, Equals, v)
+		}
+	}
+	c.Check(t[2].Error.Code, Equals, "OTSParameterInvalid")
+	u := resp.TableToRowsResult["u"]
+	c.Check(u[0].IsSucceed, Equals, true)
+	c.Check(u[1].IsSucceed, Equals, false)
+	c.Check(u[1].Index, Equals, int32(1))
+	c.Check(u[1].Error.Code, Equals, SERVER_BUSY)
+}
+
+func (s *TableStoreSuite) TestColumnNameInterning(c *C) {
+	var rows []*Row
+	for i := 0; i < 100; i++ {
+		pk := new(PrimaryKey)
+		pk.AddPrimaryKeyColumn("pk", int64(i))
+		rows = append(rows, &Row{PrimaryKey: pk, Columns: []*AttributeColumn{{ColumnName: "a", Value: "x"}, {ColumnName: "b", Value: int64(i)}}})
+	}
+	r := newPlainBufferReader(EncodeRows(rows))
+	c.Assert(r.readHeader(), IsNil)
+	var names []string
+	for r.more() {
+		row, err := r.readRow()
+		c.Assert(err, IsNil)
+		for _, cell := range row.cells {
+			names = append(names, cell.columnName())
+		}
+	}
+	c.Check(names, HasLen, 200)
+	c.Check(r.names, HasLen, 3)
+	c.Check(r.names["b"], Equals, "b")
+
+	name := []byte("b")
+	c.Check(testing.AllocsPerRun(10, func() { r.names.intern(name) }), Equals, float64(0))
+	many := make(interner)
+	for i := 0; i < 2*maxInternedNames; i++ {
+		many.intern([]byte(strconv.Itoa(i)))
+	}
+	c.Check(many, HasLen, maxInternedNames)
+	// cells built to be written are not interned
+	c.Check((&PlainBufferCell{cellName: []byte("c")}).columnName(), Equals, "c")
+}
+
+func (s *TableStoreSuite) TestNextPooled(c *C) {
+	var rows []*Row
+	for i := 0; i < 100; i++ {
+		pk := new(PrimaryKey)
+		pk.AddPrimaryKeyColumn("pk", int64(i))
+		row := &Row{PrimaryKey: pk, Columns: []*AttributeColumn{{ColumnName: "a", Value: int64(i), Timestamp: 1}}}
+		if i%2 == 0 {
+			row.Columns = append(row.Columns, &AttributeColumn{ColumnName: "b", Value: "x", Timestamp: 1})
+		}
+		rows = append(rows, row)
+	}
+	it := &RangeRows{reader: newPlainBufferReader(EncodeRows(rows))}
+	for _, row := range rows {
+		next, err := it.NextPooled()
+		c.Assert(err, IsNil)
+		c.Check(next.PrimaryKey, DeepEquals, row.PrimaryKey)
+		c.Check(next.Columns, DeepEquals, row.Columns)
+		columns := next.Columns
+		next.Release()
+		c.Check(next.Columns, HasLen, 0)
+		c.Check(columns[0].Value, IsNil)
+	}
+	_, err := it.NextPooled()
+	c.Check(err, Equals, io.EOF)
+
+	// rows of Next are not pooled
+	it = &RangeRows{reader: newPlainBufferReader(EncodeRows(rows[:1]))}
+	next, err := it.Next()
+	c.Assert(err, IsNil)
+	next.Release()
+	c.Check(next.Columns, DeepEquals, rows[0].Columns)
+
+	// rows released twice are leased once
+	it = &RangeRows{reader: newPlainBufferReader(EncodeRows(rows[:3]))}
+	next, err = it.NextPooled()
+	c.Assert(err, IsNil)
+	next.Release()
+	next.Release()
+	first, err := it.NextPooled()
+	c.Assert(err, IsNil)
+	second, err := it.NextPooled()
+	c.Assert(err, IsNil)
+	c.Check(first != second, Equals, true)
+	c.Check(first.PrimaryKey.PrimaryKeys[0].Value, Equals, int64(1))
+	c.Check(second.PrimaryKey.PrimaryKeys[0].Value, Equals, int64(2))
+}
+
+func (s *TableStoreSuite) TestStreamRecordsPooled(c *C) {
+	// the sequence info of the records, of epoch 1, timestamp 2 and row index 3
+	extension := []byte{TAG_EXTENSION, 0, 0, 0, 0, TAG_SEQ_INFO, 0, 0, 0, 0, TAG_SEQ_INFO_EPOCH, 1, 0, 0, 0,
+		TAG_SEQ_INFO_TS, 2, 0, 0, 0, 0, 0, 0, 0, TAG_SEQ_INFO_ROW_INDEX, 3, 0, 0, 0}
+	resp := &otsprotocol.GetStreamRecordResponse{NextShardIterator: proto.String("next")}
+	for i := 0; i < 3; i++ {
+		pk := new(PrimaryKey)
+		pk.AddPrimaryKeyColumn("pk", int64(i))
+		row := EncodeRows([]*Row{{PrimaryKey: pk, Columns: []*AttributeColumn{{ColumnName: "a", Value: int64(i), Timestamp: 1}}}})
+		// the extension goes before the checksum of the row
+		record := append(append(append([]byte{}, row[:len(row)-2]...), extension...), row[len(row)-2:]...)
+		resp.StreamRecords = append(resp.StreamRecords, &otsprotocol.GetStreamRecordResponse_StreamRecord{
+			ActionType: otsprotocol.ActionType_UPDATE_ROW.Enum(), Record: record})
+	}
+	data, _ := proto.Marshal(resp)
+	client := NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		return data, nil, http.StatusOK, "r"
+	}))
+	iterator := ShardIterator("it")
+
+	records, err := client.GetStreamRecords(&GetStreamRecordRequest{ShardIterator: &iterator})
+	c.Assert(err, IsNil)
+	c.Check(*records.NextShardIterator, Equals, ShardIterator("next"))
+	var leased []*StreamRecord
+	for i := 0; i < 3; i++ {
+		record, err := records.NextPooled()
+		c.Assert(err, IsNil)
+		c.Check(record.Type, Equals, AT_Update)
+		c.Check(*record.Info, Equals, RecordSequenceInfo{Epoch: 1, Timestamp: 2, RowIndex: 3})
+		c.Check(record.PrimaryKey.PrimaryKeys[0].Value, Equals, int64(i))
+		c.Check(record.Columns, HasLen, 1)
+		c.Check(*record.Columns[0].Name, Equals, "a")
+		c.Check(record.Columns[0].Type, Equals, RCT_Put)
+		c.Check(record.Columns[0].Value, Equals, int64(i))
+		c.Check(*record.Columns[0].Timestamp, Equals, int64(1))
+		leased = append(leased, record)
+		if i == 0 {
+			columns := record.Columns
+			record.Release()
+			record.Release()
+			c.Check(columns[0].Name, IsNil)
+			c.Check(record.Info, IsNil)
+		}
+	}
+	c.Check(leased[1] != leased[2], Equals, true)
+	_, err = records.NextPooled()
+	c.Check(err, Equals, io.EOF)
+
+	// GetStreamRecord decodes the same records, not pooled
+	response, err := client.GetStreamRecord(&GetStreamRecordRequest{ShardIterator: &iterator})
+	c.Assert(err, IsNil)
+	c.Check(response.Records, HasLen, 3)
+	c.Check(response.Records[2].String(), Equals, leased[2].String())
+	c.Check(*response.NextShardIterator, Equals, ShardIterator("next"))
+	response.Records[0].Release()
+	c.Check(response.Records[0].Columns, HasLen, 1)
+
+	resp.StreamRecords[1].Record = resp.StreamRecords[1].Record[:10]
+	data, _ = proto.Marshal(resp)
+	_, err = client.GetStreamRecord(&GetStreamRecordRequest{ShardIterator: &iterator})
+	c.Check(err, NotNil)
+}
+
+func (s *TableStoreSuite) TestChecksumVerification(c *C) {
+	pk := new(PrimaryKey)
+	pk.AddPrimaryKeyColumn("pk", "k")
+	pk.AddPrimaryKeyColumnWithMinValue("min")
+	pk.AddPrimaryKeyColumnWithMaxValue("max")
+	row := &Row{PrimaryKey: pk, Columns: []*AttributeColumn{
+		{ColumnName: "i", Value: int64(-1), Timestamp: 1},
+		{ColumnName: "d", Value: 1.5, Timestamp: 1},
+		{ColumnName: "b", Value: true, Timestamp: 1},
+		{ColumnName: "s", Value: "value", Timestamp: 1},
+		{ColumnName: "bin", Value: []byte{0, 1}, Timestamp: 1},
+	}}
+	data := EncodeRows([]*Row{row})
+	strict := NewClient("http://127.0.0.1:0", "a", "b", "c", SetChecksumVerification(ChecksumStrict))
+	decoded, err := strict.newReader(data, make(interner)).readSingleRow()
+	c.Assert(err, IsNil)
+	c.Check(cellsToPrimaryKey(decoded.primaryKey), DeepEquals, pk)
+
+	update := &UpdateRowChange{TableName: "t", PrimaryKey: pk}
+	update.PutColumn("a", int64(1))
+	update.DeleteColumn("b")
+	update.DeleteColumnWithTimestamp("c", 1)
+	_, err = strict.newReader(update.Serialize(), make(interner)).readSingleRow()
+	c.Check(err, IsNil)
+
+	// corrupts the value of "s"
+	corrupted := append([]byte(nil), data...)
+	corrupted[bytes.Index(corrupted, []byte("value"))]++
+	_, err = strict.newReader(corrupted, make(interner)).readSingleRow()
+	var checksumErr *ChecksumError
+	c.Assert(errors.As(err, &checksumErr), Equals, true)
+	c.Check(checksumErr.Column, Equals, "s")
+	c.Check(err, FitsTypeOf, &PlainBufferError{})
+	// corrupts the checksum of the row
+	corrupted = append([]byte(nil), data...)
+	corrupted[len(corrupted)-1]++
+	_, err = strict.newReader(corrupted, make(interner)).readSingleRow()
+	c.Assert(errors.As(err, &checksumErr), Equals, true)
+	c.Check(checksumErr.Column, Equals, "")
+	c.Check(checksumErr.Actual, Equals, data[len(data)-1]+1)
+	c.Check(checksumErr.Expected, Equals, data[len(data)-1])
+
+	logger := &recordLogger{}
+	lenient := NewClient("http://127.0.0.1:0", "a", "b", "c", SetChecksumVerification(ChecksumLenient), SetLogger(logger))
+	decoded, err = lenient.newReader(corrupted, make(interner)).readSingleRow()
+	c.Assert(err, IsNil)
+	c.Check(decoded.cells, HasLen, 5)
+	c.Check(logger.entries, DeepEquals, []string{"WARN checksum mismatch"})
+
+	none := NewClient("http://127.0.0.1:0", "a", "b", "c")
+	_, err = none.newReader(corrupted, make(interner)).readSingleRow()
+	c.Check(err, IsNil)
+}
+
+func (s *TableStoreSuite) TestBinaryRoundTrip(c *C) {
+	// zero bytes and invalid UTF-8
+	payload := []byte{0, 0xff, 0xfe, 'a', 0, 0xc3, 0x28}
+	c.Assert(utf8.Valid(payload), Equals, false)
+
+	pk := new(PrimaryKey)
+	pk.AddBinaryPrimaryKeyColumn("id", payload)
+	change := &PutRowChange{TableName: "t", PrimaryKey: pk}
+	change.AddBinaryColumn("payload", payload)
+	change.AddBinaryColumn("empty", nil)
+	change.AddColumn("raw", json.RawMessage(`{"a":0}`))
+	change.AddColumn("text", "text")
+	decodedPk, columns, _, err := DecodeRowChange(change.Serialize())
+	c.Assert(err, IsNil)
+	c.Check(decodedPk.PrimaryKeys[0].Value, DeepEquals, payload)
+	c.Check(columns[0].Value, DeepEquals, payload)
+	c.Check(columns[1].Value, DeepEquals, []byte{})
+	c.Check(columns[2].Value, DeepEquals, []byte(`{"a":0}`))
+	c.Check(columns[3].Value, Equals, "text")
+
+	update := &UpdateRowChange{TableName: "t", PrimaryKey: pk}
+	update.PutBinaryColumn("payload", payload)
+	_, columns, _, err = DecodeRowChange(update.Serialize())
+	c.Assert(err, IsNil)
+	c.Check(columns[0].Value, DeepEquals, payload)
+
+	row := &Row{PrimaryKey: pk, Columns: []*AttributeColumn{{ColumnName: "payload", Value: payload, Timestamp: 1}, {ColumnName: "text", Value: "text", Timestamp: 1}}}
+	it := &RangeRows{reader: newPlainBufferReader(EncodeRows([]*Row{row}))}
+	read, err := it.Next()
+	c.Assert(err, IsNil)
+	id, ok := read.PrimaryKey.PrimaryKeys[0].AsBinary()
+	c.Check(ok, Equals, true)
+	c.Check(id, DeepEquals, payload)
+	value, ok := read.Columns[0].AsBinary()
+	c.Check(ok, Equals, true)
+	c.Check(value, DeepEquals, payload)
+	_, ok = read.Columns[0].AsString()
+	c.Check(ok, Equals, false)
+	text, ok := read.Columns[1].AsString()
+	c.Check(text, Equals, "text")
+	_, ok = read.Columns[1].AsBinary()
+	c.Check(ok, Equals, false)
+
+	c.Check(pk.PrimaryKeys[0].String(), Equals, `{"Name": "id", "Value": 0x00fffe6100c328}`)
+	c.Check(func() { NewColumn([]byte("c"), []int64{1}) }, PanicMatches, ".*invalid input")
+}
+
+func (s *TableStoreSuite) TestTimeColumn(c *C) {
+	t := time.Date(2021, 3, 4, 5, 6, 7, 891234567, time.UTC)
+	c.Check(Seconds.Int64(t), Equals, int64(1614834367))
+	c.Check(Milliseconds.Int64(t), Equals, int64(1614834367891))
+	c.Check(Microseconds.Int64(t), Equals, int64(1614834367891234))
+	c.Check(Milliseconds.Time(1614834367891), DeepEquals, t.Truncate(time.Millisecond))
+	c.Check(Microseconds.Time(1614834367891234), DeepEquals, t.Truncate(time.Microsecond))
+	// times before the epoch are floored
+	before := time.Date(1969, 12, 31, 23, 59, 59, 500000000, time.UTC)
+	c.Check(Seconds.Int64(before), Equals, int64(-1))
+	c.Check(Milliseconds.Int64(before), Equals, int64(-500))
+	c.Check(Milliseconds.Time(-500), DeepEquals, before)
+
+	pk := new(PrimaryKey)
+	pk.AddTimePrimaryKeyColumn("day", t, Seconds)
+	change := &PutRowChange{TableName: "t", PrimaryKey: pk}
+	change.AddTimeColumn("created", t.In(time.FixedZone("CST", 8*3600)), Milliseconds)
+	update := &UpdateRowChange{TableName: "t", PrimaryKey: pk}
+	update.PutTimeColumn("updated", t, Microseconds)
+	c.Check(change.Columns[0].Value, Equals, int64(1614834367891))
+	c.Check(update.Columns[0].Value, Equals, int64(1614834367891234))
+
+	day, ok := pk.PrimaryKeys[0].AsTime(Seconds)
+	c.Check(ok, Equals, true)
+	c.Check(day, DeepEquals, t.Truncate(time.Second))
+	created, ok := (&AttributeColumn{Value: int64(1614834367891)}).AsTime(Milliseconds)
+	c.Check(ok, Equals, true)
+	c.Check(created.Equal(t.Truncate(time.Millisecond)), Equals, true)
+	c.Check(created.Location(), Equals, time.UTC)
+	_, ok = (&AttributeColumn{Value: "2021"}).AsTime(Milliseconds)
+	c.Check(ok, Equals, false)
+
+	var decoded time.Time
+	column := &AttributeColumn{Value: int64(1614834367)}
+	c.Assert(GetColumnCodec("unix").Decode(column.Value, &decoded), IsNil)
+	c.Check(decoded, DeepEquals, t.Truncate(time.Second))
+	encoded, err := GetColumnCodec("unixmicro").Encode(t)
+	c.Check(err, IsNil)
+	c.Check(encoded, Equals, int64(1614834367891234))
+}
+
+func (s *TableStoreSuite) TestJSONColumn(c *C) {
+	type attrs struct {
+		Tags  []string `json:"tags"`
+		Score int      `json:"score"`
+	}
+	change := &PutRowChange{TableName: "t", PrimaryKey: new(PrimaryKey)}
+	c.Assert(change.AddJSONColumn("attrs", attrs{Tags: []string{"a"}, Score: 3}), IsNil)
+	c.Check(change.Columns[0].Value, Equals, `{"tags":["a"],"score":3}`)
+	c.Check(change.AddJSONColumn("invalid", func() {}), NotNil)
+	c.Check(change.Columns, HasLen, 1)
+	update := &UpdateRowChange{TableName: "t", PrimaryKey: new(PrimaryKey)}
+	c.Assert(update.PutJSONColumn("attrs", map[string]int{"n": 1}), IsNil)
+	c.Check(update.Columns[0].Value, Equals, `{"n":1}`)
+
+	row := &Row{Columns: []*AttributeColumn{
+		{ColumnName: "attrs", Value: `{"tags":["b"],"score":2}`, Timestamp: 2},
+		{ColumnName: "attrs", Value: `{"tags":["a"],"score":1}`, Timestamp: 1},
+		{ColumnName: "binary", Value: []byte(`{"score":5}`)},
+		{ColumnName: "count", Value: int64(1)},
+	}}
+	var got attrs
+	c.Assert(row.GetJSONColumn("attrs", &got), IsNil)
+	c.Check(got, DeepEquals, attrs{Tags: []string{"b"}, Score: 2})
+	got = attrs{}
+	c.Assert((&GetRowResponse{Columns: row.Columns}).GetJSONColumn("binary", &got), IsNil)
+	c.Check(got.Score, Equals, 5)
+	c.Check((&RowResult{Columns: row.Columns}).GetJSONColumn("missing", &got), Equals, ErrColumnNotFound)
+	c.Check(row.GetJSONColumn("count", &got), ErrorMatches, ".*JSON of type int64.*")
+
+	encoded, err := GetColumnCodec("json").Encode([]int{1})
+	c.Check(err, IsNil)
+	c.Check(encoded, Equals, "[1]")
+	encoded, err = JSONCodec{Binary: true}.Encode([]int{1})
+	c.Check(err, IsNil)
+	c.Check(encoded, DeepEquals, []byte("[1]"))
+}
+
+func (s *TableStoreSuite) TestTypes(c *C) {
+	c.Check(PrimaryKeyType_BINARY.String(), Equals, "BINARY")
+	c.Check(PrimaryKeyType(7).String(), Equals, "PrimaryKeyType(7)")
+	c.Check(PrimaryKeyType_STRING.IsValid(), Equals, true)
+	c.Check(PrimaryKeyType(0).IsValid(), Equals, false)
+	c.Check(DefinedColumn_DOUBLE.String(), Equals, "DOUBLE")
+	c.Check(DefinedColumnType(6).IsValid(), Equals, false)
+	c.Check(ColumnType_BOOLEAN.String(), Equals, "BOOLEAN")
+	for _, keyType := range []PrimaryKeyType{PrimaryKeyType_INTEGER, PrimaryKeyType_STRING, PrimaryKeyType_BINARY} {
+		c.Check(ConvertPbPrimaryKeyType(keyType.ConvertToPbPrimaryKeyType()), Equals, keyType)
+		c.Check(keyType.ConvertToPbPrimaryKeyType().String(), Equals, keyType.String())
+	}
+	for value, columnType := range map[interface{}]ColumnType{"s": ColumnType_STRING, int64(1): ColumnType_INTEGER, true: ColumnType_BOOLEAN, 1.5: ColumnType_DOUBLE} {
+		got, ok := ColumnTypeOf(value)
+		c.Check(ok, Equals, true)
+		c.Check(got, Equals, columnType)
+		c.Check(got.DefinedColumnType().IsValid(), Equals, true)
+	}
+	got, ok := ColumnTypeOf([]byte{})
+	c.Check(got, Equals, ColumnType_BINARY)
+	c.Check(got.DefinedColumnType(), Equals, DefinedColumn_BINARY)
+	_, ok = ColumnTypeOf(1)
+	c.Check(ok, Equals, false)
+
+	calls := 0
+	client := NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		calls++
+		return nil, nil, http.StatusOK, "r"
+	}))
+	meta := &TableMeta{TableName: "t"}
+	meta.AddPrimaryKeyColumn("id", PrimaryKeyType(9))
+	_, err := client.CreateTable(&CreateTableRequest{TableMeta: meta, TableOption: NewTableOption(-1, 1), ReservedThroughput: &ReservedThroughput{}})
+	c.Check(err, ErrorMatches, `\[tablestore\] invalid type PrimaryKeyType\(9\) of primary key column id`)
+	meta = &TableMeta{TableName: "t"}
+	meta.AddPrimaryKeyColumn("id", PrimaryKeyType_STRING)
+	meta.AddDefinedColumn("c", DefinedColumnType(0))
+	_, err = client.CreateTable(&CreateTableRequest{TableMeta: meta, TableOption: NewTableOption(-1, 1), ReservedThroughput: &ReservedThroughput{}})
+	c.Check(err, ErrorMatches, `\[tablestore\] invalid type DefinedColumnType\(0\) of defined column c`)
+	c.Check(calls, Equals, 0)
+}
+
+func (s *TableStoreSuite) TestBuilders(c *C) {
+	schema := NewPrimaryKeySchema("id", PrimaryKeyType_INTEGER).SetOption(AUTO_INCREMENT)
+	c.Check(schema.GetName(), Equals, "id")
+	c.Check(schema.GetType(), Equals, PrimaryKeyType_INTEGER)
+	option, ok := schema.GetOption()
+	c.Check(option, Equals, AUTO_INCREMENT)
+	c.Check(ok, Equals, true)
+	empty := &PrimaryKeySchema{}
+	c.Check(empty.GetName(), Equals, "")
+	c.Check(empty.GetType(), Equals, PrimaryKeyType(0))
+	_, ok = empty.GetOption()
+	c.Check(ok, Equals, false)
+	meta := &TableMeta{}
+	meta.AddPrimaryKeyColumnOption("id", PrimaryKeyType_INTEGER, AUTO_INCREMENT)
+	c.Check(meta.SchemaEntry[0], DeepEquals, schema)
+
+	condition := NewSingleColumnCondition("c", CT_GREATER_THAN, int64(1))
+	c.Check(condition.GetColumnName(), Equals, "c")
+	c.Check(condition.GetComparator(), Equals, CT_GREATER_THAN)
+	c.Check((&SingleColumnCondition{}).GetColumnName(), Equals, "")
+	c.Check(NewColumnPaginationFilter(2, 3).Serialize(), DeepEquals, (&PaginationFilter{Offset: 2, Limit: 3}).Serialize())
+
+	single := &SingleRowQueryCriteria{}
+	single.SetEndColumn("z")
+	c.Check(*single.EndColumn, Equals, "z")
+	multi := &MultiRowQueryCriteria{}
+	multi.SetStartColumn("a")
+	multi.SetEndColumn("z")
+	c.Check(*multi.StartColumn+*multi.EndColumn, Equals, "az")
+	ranged := &RangeRowQueryCriteria{}
+	ranged.SetStartColumn("a")
+	ranged.SetEndColumn("z")
+	c.Check(*ranged.StartColumn+*ranged.EndColumn, Equals, "az")
+
+	c.Check(*NewListStreamRequest("t").TableName, Equals, "t")
+	describe := &DescribeStreamRequest{}
+	describe.SetShardLimit(5)
+	c.Check(*describe.ShardLimit, Equals, int32(5))
+	iterator := &GetShardIteratorRequest{}
+	iterator.SetTimestamp(7)
+	c.Check(*iterator.Timestamp, Equals, int64(7))
+	c.Check((&Stream{}).GetTableName(), Equals, "")
+
+	field := NewFieldSchema("title", FieldType_TEXT).SetIndex(true).SetAnalyzer(Analyzer_MaxWord).SetStore(true).SetIsArray(false).SetEnableSortAndAgg(false).SetIndexOptions(IndexOptions_DOCS)
+	nested := NewFieldSchema("attrs", FieldType_NESTED).AddFieldSchema(NewFieldSchema("k", FieldType_KEYWORD))
+	name, index, store, array, sortAndAgg := "title", true, true, false, false
+	analyzer, options := Analyzer_MaxWord, IndexOptions_DOCS
+	c.Check(field, DeepEquals, &FieldSchema{FieldName: &name, FieldType: FieldType_TEXT, Index: &index, Analyzer: &analyzer, Store: &store, IsArray: &array, EnableSortAndAgg: &sortAndAgg, IndexOptions: &options})
+	c.Check(field.GetFieldName(), Equals, "title")
+	c.Check(nested.FieldSchemas[0].GetFieldName(), Equals, "k")
+}
+
+func (s *TableStoreSuite) TestUnsupportedOperation(c *C) {
+	unsupported, _ := proto.Marshal(&otsprotocol.Error{Code: proto.String(UNSUPPORTED_OPERATION), Message: proto.String("search is not enabled")})
+	tables, _ := proto.Marshal(&otsprotocol.ListTableResponse{TableNames: []string{"t"}})
+	notExist, _ := proto.Marshal(&otsprotocol.Error{Code: proto.String("OTSObjectNotExist"), Message: proto.String("table does not exist")})
+	var lock sync.Mutex
+	requests := make(map[string]int)
+	versions := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests[r.URL.Path]++
+		versions[r.Header.Get(xOtsApiversion)] = true
+		lock.Unlock()
+		switch r.URL.Path {
+		case "/ListTable":
+			w.Write(tables)
+		case "/ListSearchIndex":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(unsupported)
+		case "/DescribeTable":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write(notExist)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "instance", "id", "secret", SetAPIVersion("2020-01-01"))
+	_, err := client.ListTable()
+	c.Assert(err, IsNil)
+	c.Check(versions, DeepEquals, map[string]bool{"2020-01-01": true})
+
+	for i := 0; i < 2; i++ {
+		_, err = client.ListSearchIndex(&ListSearchIndexRequest{TableName: "t"})
+		c.Check(IsUnsupported(err), Equals, true)
+		c.Check(err, ErrorMatches, "OTSUnsupportOperation search is not enabled.*")
+		_, err = client.ListStream(NewListStreamRequest("t"))
+		c.Check(IsUnsupported(err), Equals, true)
+	}
+	var unsupportedErr *UnsupportedError
+	c.Assert(errors.As(err, &unsupportedErr), Equals, true)
+	c.Check(unsupportedErr.Action, Equals, "ListStream")
+	// failed once, then without requests
+	c.Check(requests, DeepEquals, map[string]int{"/ListTable": 1, "/ListSearchIndex": 1, "/ListStream": 1})
+	c.Check(client.Supports("ListSearchIndex"), Equals, false)
+	c.Check(client.Supports("ListTable"), Equals, true)
+
+	// errors of the service about the request, even 404s, are not recorded
+	for i := 0; i < 2; i++ {
+		_, err = client.DescribeTable(&DescribeTableRequest{TableName: "missing"})
+		c.Check(err, ErrorMatches, "OTSObjectNotExist table does not exist.*")
+		c.Check(IsUnsupported(err), Equals, false)
+	}
+	c.Check(requests["/DescribeTable"], Equals, 2)
+	c.Check(client.Supports("DescribeTable"), Equals, true)
+
+	client.ResetCapabilities()
+	c.Check(client.Supports("ListSearchIndex"), Equals, true)
+	_, err = client.ListSearchIndex(&ListSearchIndexRequest{TableName: "t"})
+	c.Check(IsUnsupported(err), Equals, true)
+	c.Check(requests["/ListSearchIndex"], Equals, 2)
+	c.Check(IsUnsupported(errors.New("OTSServerBusy busy")), Equals, false)
+
+	_, err = NewClient(server.URL, "instance", "id", "secret").ListTable()
+	c.Assert(err, IsNil)
+	c.Check(versions[ApiVersion], Equals, true)
+}
+
+func (s *TableStoreSuite) TestCapabilities(c *C) {
+	invalid, _ := proto.Marshal(&otsprotocol.Error{Code: proto.String("OTSParameterInvalid"), Message: proto.String("invalid")})
+	notExist, _ := proto.Marshal(&otsprotocol.Error{Code: proto.String("OTSObjectNotExist"), Message: proto.String("table does not exist")})
+	unsupported, _ := proto.Marshal(&otsprotocol.Error{Code: proto.String(UNSUPPORTED_OPERATION), Message: proto.String("unsupported")})
+	streams, _ := proto.Marshal(&otsprotocol.ListStreamResponse{})
+	var requests []string
+	bodies := make(map[string][]byte)
+	client := NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		requests = append(requests, uri)
+		bodies[uri] = body
+		switch uri {
+		case listSearchIndexUri:
+			return invalid, errors.New("status 400"), http.StatusBadRequest, "r"
+		case "/StartLocalTransaction":
+			return notExist, errors.New("status 404"), http.StatusNotFound, "r"
+		case listStreamUri:
+			return streams, nil, http.StatusOK, "r"
+		case "/SQLQuery":
+			return unsupported, errors.New("status 400"), http.StatusBadRequest, "r"
+		case "/ListTimeseriesTable":
+			return nil, errors.New("status 404"), http.StatusNotFound, "r"
+		}
+		return nil, errors.New("connection refused"), 0, ""
+	}))
+	capabilities := client.Capabilities()
+	c.Check(*capabilities, DeepEquals, Capabilities{SearchIndex: true, Streams: true, Transactions: true, Errors: map[Capability]error{}})
+	c.Check(requests, HasLen, 5)
+	c.Check(bytes.Contains(bodies["/SQLQuery"], []byte("SHOW TABLES")), Equals, true)
+	c.Check(bytes.Contains(bodies["/StartLocalTransaction"], []byte(probeTableName)), Equals, true)
+	// probes do not record unsupported actions, nor skip them
+	c.Check(client.Supports("SQLQuery"), Equals, true)
+	client.Capabilities()
+	c.Check(requests, HasLen, 10)
+
+	// errors which do not tell whether actions exist are not retried
+	busy, _ := proto.Marshal(&otsprotocol.Error{Code: proto.String(SERVER_BUSY), Message: proto.String("busy")})
+	requests = nil
+	failing := NewClient("http://127.0.0.1:0", "a", "b", "c", AddInterceptor(func(uri string, body []byte, next Invoker) ([]byte, error, int, string) {
+		requests = append(requests, uri)
+		if uri == "/SQLQuery" {
+			return nil, errors.New("connection refused"), 0, ""
+		}
+		return busy, errors.New("status 503"), http.StatusServiceUnavailable, "r"
+	}))
+	capabilities = failing.Capabilities()
+	c.Check(capabilities.Streams, Equals, false)
+	c.Check(capabilities.Errors, HasLen, 5)
+	c.Check(requests, HasLen, 5)
+	c.Check(capabilities.Errors[CapabilitySQL], ErrorMatches, "connection refused")
+	c.Check(capabilities.Errors[CapabilityStreams], ErrorMatches, "OTSServerBusy busy r")
+
+	// nor do authentication failures
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failed, _ := proto.Marshal(&otsprotocol.Error{Code: proto.String("OTSAuthFailed"), Message: proto.String("signature mismatch")})
+		w.WriteHeader(http.StatusForbidden)
+		w.Write(failed)
+	}))
+	defer server.Close()
+	capabilities = NewClient(server.URL, "a", "b", "c").Capabilities()
+	c.Check(capabilities.SearchIndex || capabilities.SQL || capabilities.Streams || capabilities.Timeseries || capabilities.Transactions, Equals, false)
+	c.Check(capabilities.Errors, HasLen, 5)
+	c.Check(capabilities.Errors[CapabilityTimeseries], ErrorMatches, "OTSAuthFailed signature mismatch.*")
+}
+
 func (s *TableStoreSuite) TestListStream(c *C) {
 	tableName := defaultTableName + "_ListStream"
 	fmt.Printf("TestListStream starts on table %s\n", tableName)
@@ -0,0 +1,54 @@
+package tablestore
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+)
+
+// isAtomicField is the optional bool is_atomic = 3 of BatchWriteRowRequest,
+// set, which otsprotocol.BatchWriteRowRequest does not know.
+var isAtomicField = []byte{3<<3 | proto.WireVarint, 1}
+
+func rowChangePrimaryKey(change RowChange) *PrimaryKey {
+	switch change := change.(type) {
+	case *PutRowChange:
+		return change.PrimaryKey
+	case *UpdateRowChange:
+		return change.PrimaryKey
+	case *DeleteRowChange:
+		return change.PrimaryKey
+	}
+	return nil
+}
+
+// atomicErr returns an error if the changes of a table of the atomic request
+// do not share their partition key.
+func (request *BatchWriteRowRequest) atomicErr() error {
+	for table, changes := range request.RowChangesGroupByTable {
+		var partition *PrimaryKeyColumn
+		for _, change := range changes {
+			pk := rowChangePrimaryKey(change)
+			if pk == nil || len(pk.PrimaryKeys) == 0 {
+				return fmt.Errorf("[tablestore] atomic batch write of table %s: change of type %T without primary key", table, change)
+			}
+			if partition == nil {
+				partition = pk.PrimaryKeys[0]
+			} else if !samePartition(partition, pk.PrimaryKeys[0]) {
+				return fmt.Errorf("[tablestore] atomic batch write of table %s: partition keys %v and %v differ", table, partition.Value, pk.PrimaryKeys[0].Value)
+			}
+		}
+	}
+	return nil
+}
+
+func samePartition(a, b *PrimaryKeyColumn) bool {
+	if a.ColumnName != b.ColumnName {
+		return false
+	}
+	if av, ok := a.Value.([]byte); ok {
+		bv, ok := b.Value.([]byte)
+		return ok && bytes.Equal(av, bv)
+	}
+	return a.Value == b.Value
+}
@@ -0,0 +1,163 @@
+package tablestore
+
+import (
+	"context"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
+	"github.com/golang/protobuf/proto"
+	"time"
+)
+
+// AuditRecord records the rows of a table read or written by a call, once
+// it is done, retries included.
+type AuditRecord struct {
+	Time time.Time
+	// principal of the context of the call, "" if none
+	Principal     string
+	CorrelationId string
+	// the action, e.g. "GetRow"
+	Action string
+	Table  string
+	Write  bool
+	// primary keys of the rows written, or requested by GetRow and BatchGetRow,
+	// or returned by GetRange and Search
+	PrimaryKeys []*PrimaryKey
+	// the error of a failed call; rows of failed reads are unknown
+	Err error
+}
+
+// AuditSink receives the records of the calls of a client, e.g. to keep who
+// accessed the rows of sensitive tables. It must be safe for concurrent use.
+type AuditSink interface {
+	Audit(record *AuditRecord)
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying the principal, e.g. the user on
+// behalf of whom the calls of a client bound to it by WithContext are made,
+// recorded by audit sinks:
+//
+//	ctx := tablestore.WithPrincipal(ctx, user.Id)
+//	resp, err := client.WithContext(ctx).GetRow(request)
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the principal of ctx, or "".
+func PrincipalFrom(ctx context.Context) string {
+	principal, _ := ctx.Value(principalKey{}).(string)
+	return principal
+}
+
+// SetAuditSink makes the client record the rows read and written by
+// GetRow, BatchGetRow, GetRange, Search, PutRow, UpdateRow, DeleteRow and
+// BatchWriteRow in sink, on the tables audited, all of them if there are
+// none. Writes planned in dry run mode are not recorded.
+func SetAuditSink(sink AuditSink, tables ...string) ClientOption {
+	return func(client *TableStoreClient) {
+		client.audit = sink
+		client.auditTables = nil
+		if len(tables) > 0 {
+			client.auditTables = make(map[string]bool, len(tables))
+			for _, table := range tables {
+				client.auditTables[table] = true
+			}
+		}
+	}
+}
+
+func (tableStoreClient *TableStoreClient) audited(table string) bool {
+	return tableStoreClient.auditTables == nil || tableStoreClient.auditTables[table]
+}
+
+// auditCall records a call of uri done with err in the audit sink.
+func (tableStoreClient *TableStoreClient) auditCall(ctx context.Context, uri string, req, resp proto.Message, err error) {
+	var records []*AuditRecord
+	add := func(table string, write bool, pks ...[]byte) *AuditRecord {
+		if !tableStoreClient.audited(table) {
+			return nil
+		}
+		record := &AuditRecord{Time: time.Now(), Principal: PrincipalFrom(ctx), CorrelationId: CorrelationIdFrom(ctx),
+			Action: actionOf(uri), Table: table, Write: write, Err: err}
+		for _, pk := range pks {
+			if pk, decodeErr := readPrimaryKeyWithHeader(pk); decodeErr == nil {
+				record.PrimaryKeys = append(record.PrimaryKeys, pk)
+			} else {
+				tableStoreClient.logContext(ctx, LogWarn, "audit: invalid primary key", LogField("action", uri), LogField("error", decodeErr))
+			}
+		}
+		records = append(records, record)
+		return record
+	}
+
+	switch req := req.(type) {
+	case *otsprotocol.GetRowRequest:
+		add(req.GetTableName(), false, req.PrimaryKey)
+	case *otsprotocol.BatchGetRowRequest:
+		for _, table := range req.Tables {
+			add(table.GetTableName(), false, table.PrimaryKey...)
+		}
+	case *otsprotocol.GetRangeRequest:
+		record := add(req.GetTableName(), false)
+		if resp := resp.(*otsprotocol.GetRangeResponse); record != nil && err == nil && len(resp.Rows) > 0 {
+			rows, decodeErr := readRowsWithHeader(resp.Rows)
+			if decodeErr != nil {
+				tableStoreClient.logContext(ctx, LogWarn, "audit: invalid rows", LogField("action", uri), LogField("error", decodeErr))
+			}
+			for _, row := range rows {
+				record.PrimaryKeys = append(record.PrimaryKeys, primaryKeyOf(row))
+			}
+		}
+	case *otsprotocol.SearchRequest:
+		record := add(req.GetTableName(), false)
+		if record != nil && err == nil {
+			for _, row := range resp.(*otsprotocol.SearchResponse).Rows {
+				if row, decodeErr := readRowWithHeader(row); decodeErr == nil {
+					record.PrimaryKeys = append(record.PrimaryKeys, primaryKeyOf(row))
+				}
+			}
+		}
+	case *otsprotocol.PutRowRequest:
+		add(req.GetTableName(), true, req.Row)
+	case *otsprotocol.UpdateRowRequest:
+		add(req.GetTableName(), true, req.RowChange)
+	case *otsprotocol.DeleteRowRequest:
+		add(req.GetTableName(), true, req.PrimaryKey)
+	case *otsprotocol.BatchWriteRowRequest:
+		for _, table := range req.Tables {
+			var pks [][]byte
+			for _, row := range table.Rows {
+				pks = append(pks, row.RowChange)
+			}
+			add(table.GetTableName(), true, pks...)
+		}
+	}
+	for _, record := range records {
+		tableStoreClient.audit.Audit(record)
+	}
+}
+
+func primaryKeyOf(row *PlainBufferRow) *PrimaryKey {
+	pk := &PrimaryKey{}
+	for _, cell := range row.primaryKey {
+		pk.PrimaryKeys = append(pk.PrimaryKeys, &PrimaryKeyColumn{ColumnName: cell.columnName(), Value: cell.cellValue.Value})
+	}
+	return pk
+}
+
+// readPrimaryKeyWithHeader reads the primary key of a plainbuffer holding a
+// primary key, a row or a row change.
+func readPrimaryKeyWithHeader(data []byte) (*PrimaryKey, error) {
+	r := newPlainBufferReader(data)
+	if err := r.readHeader(); err != nil {
+		return nil, err
+	}
+	if err := r.expectTag(TAG_ROW_PK, errTag); err != nil {
+		return nil, err
+	}
+	cells, err := r.readCells(true)
+	if err != nil {
+		return nil, err
+	}
+	return primaryKeyOf(&PlainBufferRow{primaryKey: cells}), nil
+}
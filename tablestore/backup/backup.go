@@ -0,0 +1,264 @@
+// Package backup exports the rows of tables into gzip compressed chunks
+// written to object storage, such as OSS or S3 buckets, scanning ranges of
+// the primary key in parallel:
+//
+//	m, err := backup.Backup(ctx, client, "orders", bucket, "backups/orders/2020-01-01", backup.Options{Parallelism: 8})
+//
+// where bucket implements ObjectWriter over the client of the storage, or is
+// a Dir of the local file system. The manifest of a backup, written last
+// under the prefix as manifest.json, declares the table and lists its
+// chunks with their checksums. Chunks hold JSON lines of rows, with the
+// types and the timestamps of their values.
+//
+// Rows written during the backup are exported or not depending on the
+// progress of the scan.
+//
+// Restore reads the chunks back through an ObjectReader, creates the table
+// if needed and writes the rows, resuming after the chunks checkpointed by
+// an interrupted restore:
+//
+//	progress, err := backup.Restore(ctx, client, bucket, "backups/orders/2020-01-01", backup.RestoreOptions{
+//		Table:         "orders_restored",
+//		RowsPerSecond: 5000,
+//		Checkpoint: func(restored []string) error {
+//			return saveRestored(restored)
+//		},
+//	})
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/manifest"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ObjectWriter writes objects of the storage of backups.
+type ObjectWriter interface {
+	PutObject(ctx context.Context, key string, r io.Reader) error
+}
+
+// Dir is a directory of the local file system storing objects as files.
+type Dir string
+
+func (dir Dir) PutObject(ctx context.Context, key string, r io.Reader) error {
+	name := filepath.Join(string(dir), filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ManifestName is the name of the manifest object under the prefix of a
+// backup.
+const ManifestName = "manifest.json"
+
+type Manifest struct {
+	Table *manifest.Table `json:"table"`
+	Start time.Time       `json:"start"`
+	End   time.Time       `json:"end"`
+	Rows  int64           `json:"rows"`
+	// Chunks in primary key order
+	Chunks []*Chunk `json:"chunks"`
+}
+
+type Chunk struct {
+	// Key of the object, relative to the prefix of the backup
+	Key  string `json:"key"`
+	Rows int64  `json:"rows"`
+	Size int64  `json:"size"`
+	// CRC32 (IEEE) of the object
+	Checksum uint32 `json:"checksum"`
+}
+
+type Options struct {
+	// ranges scanned in parallel, 4 by default
+	Parallelism int
+	// ranges of the primary key scanned, the splits of the table computed
+	// by ComputeSplitPointsBySize in SplitSize units of 100MB by default
+	Splits    []*tablestore.Split
+	SplitSize int64
+	// versions of the columns exported, 1 by default
+	MaxVersions int
+	// size of the rows of a chunk before compression, 64MB by default
+	ChunkSize int
+}
+
+func (options *Options) defaults() {
+	if options.Parallelism <= 0 {
+		options.Parallelism = 4
+	}
+	if options.SplitSize <= 0 {
+		options.SplitSize = 1
+	}
+	if options.MaxVersions <= 0 {
+		options.MaxVersions = 1
+	}
+	if options.ChunkSize <= 0 {
+		options.ChunkSize = 64 << 20
+	}
+}
+
+// Backup exports the rows of table into chunks written by writer under
+// prefix, then their manifest.
+func Backup(ctx context.Context, client tablestore.TableStoreApi, table string, writer ObjectWriter, prefix string, options Options) (*Manifest, error) {
+	options.defaults()
+	m := &Manifest{Start: time.Now()}
+	var err error
+	if m.Table, err = manifest.Describe(client, table); err != nil {
+		return nil, err
+	}
+	splits := options.Splits
+	if splits == nil {
+		resp, err := client.ComputeSplitPointsBySize(&tablestore.ComputeSplitPointsBySizeRequest{TableName: table, SplitSize: options.SplitSize})
+		if err != nil {
+			return nil, err
+		}
+		splits = resp.Splits
+	}
+
+	chunks := make([][]*Chunk, len(splits))
+	err = parallel(ctx, len(splits), options.Parallelism, func(ctx context.Context, i int) error {
+		var err error
+		chunks[i], err = backupSplit(ctx, client, table, splits[i], writer, prefix, fmt.Sprintf("chunk-%05d", i), &options)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, split := range chunks {
+		for _, chunk := range split {
+			m.Rows += chunk.Rows
+			m.Chunks = append(m.Chunks, chunk)
+		}
+	}
+	m.End = time.Now()
+
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	if err := writer.PutObject(ctx, path.Join(prefix, ManifestName), bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// backupSplit exports the rows of split into the chunks named after name.
+func backupSplit(ctx context.Context, client tablestore.TableStoreApi, table string, split *tablestore.Split, writer ObjectWriter, prefix, name string, options *Options) ([]*Chunk, error) {
+	var chunks []*Chunk
+	var buf bytes.Buffer
+	var size int
+	var chunk *Chunk
+	zw := gzip.NewWriter(&buf)
+	encoder := json.NewEncoder(zw)
+	flush := func() error {
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		chunk.Key = fmt.Sprintf("%s-%06d.json.gz", name, len(chunks))
+		chunk.Size = int64(buf.Len())
+		chunk.Checksum = crc32.ChecksumIEEE(buf.Bytes())
+		if err := writer.PutObject(ctx, path.Join(prefix, chunk.Key), bytes.NewReader(buf.Bytes())); err != nil {
+			return err
+		}
+		chunks = append(chunks, chunk)
+		chunk = nil
+		buf.Reset()
+		zw.Reset(&buf)
+		size = 0
+		return nil
+	}
+
+	criteria := &tablestore.RangeRowQueryCriteria{TableName: table, StartPrimaryKey: split.LowerBound, EndPrimaryKey: split.UpperBound,
+		MaxVersion: int32(options.MaxVersions), Direction: tablestore.FORWARD}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		resp, err := client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: criteria})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range resp.Rows {
+			if chunk == nil {
+				chunk = new(Chunk)
+			}
+			r := newRecord(row)
+			if err := encoder.Encode(r); err != nil {
+				return nil, err
+			}
+			chunk.Rows++
+			if size += r.size(); size >= options.ChunkSize {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if resp.NextStartPrimaryKey == nil {
+			break
+		}
+		criteria.StartPrimaryKey = resp.NextStartPrimaryKey
+	}
+	if chunk != nil {
+		if err := flush(); err != nil {
+			return nil, err
+		}
+	}
+	return chunks, nil
+}
+
+// parallel runs f for each of n tasks, on at most parallelism goroutines,
+// until one fails.
+func parallel(ctx context.Context, n, parallelism int, f func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tasks := make(chan int)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for w := 0; w < parallelism && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range tasks {
+				if err := f(ctx, i); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case tasks <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(tasks)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,249 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/verify"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// bucket is an in-memory ObjectWriter.
+type bucket struct {
+	lock    sync.Mutex
+	objects map[string][]byte
+}
+
+func (b *bucket) PutObject(ctx context.Context, key string, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.objects[key] = data
+	return nil
+}
+
+func createTable(t *testing.T, client tablestore.TableStoreApi, rows int) {
+	meta := &tablestore.TableMeta{TableName: "orders"}
+	meta.AddPrimaryKeyColumn("id", tablestore.PrimaryKeyType_INTEGER)
+	_, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 2), ReservedThroughput: &tablestore.ReservedThroughput{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < rows; i++ {
+		change := &tablestore.PutRowChange{TableName: "orders", PrimaryKey: new(tablestore.PrimaryKey)}
+		change.PrimaryKey.AddPrimaryKeyColumn("id", int64(i))
+		change.AddColumnWithTimestamp("name", fmt.Sprintf("order %d", i), 1000)
+		change.AddColumnWithTimestamp("name", fmt.Sprintf("order %d v2", i), 2000)
+		change.AddColumn("total", float64(i)/2)
+		change.AddColumn("paid", i%2 == 0)
+		change.AddColumn("data", []byte{byte(i)})
+		if i == 0 {
+			change.AddColumn("ratio", math.Inf(1))
+		}
+		change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: change}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func splits(bounds ...int64) []*tablestore.Split {
+	var splits []*tablestore.Split
+	for i := 0; i <= len(bounds); i++ {
+		split := &tablestore.Split{LowerBound: new(tablestore.PrimaryKey), UpperBound: new(tablestore.PrimaryKey)}
+		if i == 0 {
+			split.LowerBound.AddPrimaryKeyColumnWithMinValue("id")
+		} else {
+			split.LowerBound.AddPrimaryKeyColumn("id", bounds[i-1])
+		}
+		if i == len(bounds) {
+			split.UpperBound.AddPrimaryKeyColumnWithMaxValue("id")
+		} else {
+			split.UpperBound.AddPrimaryKeyColumn("id", bounds[i])
+		}
+		splits = append(splits, split)
+	}
+	return splits
+}
+
+func TestBackup(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	server.Store.RangeLimit = 3
+	client := server.NewTableStoreClient()
+	createTable(t, client, 50)
+
+	b := &bucket{objects: make(map[string][]byte)}
+	m, err := Backup(context.Background(), client, "orders", b, "backups/orders", Options{Splits: splits(10, 30), MaxVersions: 2, ChunkSize: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Rows != 50 || m.Table.Name != "orders" || m.Table.MaxVersions != 2 || len(m.Table.PrimaryKeys) != 1 || len(m.Chunks) < 6 {
+		t.Fatalf("manifest: %+v", m)
+	}
+
+	var stored Manifest
+	if err := json.Unmarshal(b.objects["backups/orders/manifest.json"], &stored); err != nil || stored.Rows != 50 || len(stored.Chunks) != len(m.Chunks) {
+		t.Fatalf("stored manifest: %+v %v", stored, err)
+	}
+	next := int64(0)
+	for _, chunk := range stored.Chunks {
+		data := b.objects["backups/orders/"+chunk.Key]
+		if int64(len(data)) != chunk.Size || crc32.ChecksumIEEE(data) != chunk.Checksum {
+			t.Fatalf("chunk %s: size %d checksum %d", chunk.Key, len(data), crc32.ChecksumIEEE(data))
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoder := json.NewDecoder(zr)
+		rows := int64(0)
+		for {
+			var r record
+			if err := decoder.Decode(&r); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if *r.PrimaryKey[0].Integer != next {
+				t.Fatalf("row %d in chunk %s, expect %d", *r.PrimaryKey[0].Integer, chunk.Key, next)
+			}
+			// two versions of name, ratio in the first row only
+			columns := 5
+			if next == 0 {
+				columns = 6
+			}
+			if len(r.Columns) != columns {
+				t.Errorf("columns of row %d: %d", next, len(r.Columns))
+			}
+			next++
+			rows++
+		}
+		if rows != chunk.Rows {
+			t.Errorf("rows of chunk %s: %d, expect %d", chunk.Key, rows, chunk.Rows)
+		}
+	}
+	if next != 50 {
+		t.Errorf("rows: %d", next)
+	}
+}
+
+func TestBackupToDir(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	client := server.NewTableStoreClient()
+	createTable(t, client, 1)
+
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := Backup(context.Background(), client, "orders", Dir(dir), "orders", Options{Splits: splits()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "orders", m.Chunks[0].Key))
+	if err != nil || crc32.ChecksumIEEE(data) != m.Chunks[0].Checksum {
+		t.Fatalf("chunk file: %v", err)
+	}
+	zr, _ := gzip.NewReader(bytes.NewReader(data))
+	var r record
+	if err := json.NewDecoder(zr).Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	expect := `{"pk":[{"n":"id","i":0}],"columns":[{"n":"data","x":"AA==","t":%d},{"n":"name","s":"order 0 v2","t":2000},{"n":"paid","b":true,"t":%d},{"n":"ratio","d":"+Inf","t":%d},{"n":"total","d":"0","t":%d}]}`
+	ts := r.Columns[0].Timestamp
+	if got, _ := json.Marshal(r); string(got) != fmt.Sprintf(expect, ts, ts, ts, ts) {
+		t.Errorf("record: %s", got)
+	}
+}
+
+func (b *bucket) GetObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	data, ok := b.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("no object %s", key)
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func TestRestore(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	client := server.NewTableStoreClient()
+	createTable(t, client, 50)
+	b := &bucket{objects: make(map[string][]byte)}
+	m, err := Backup(context.Background(), client, "orders", b, "backups/orders", Options{Splits: splits(10, 30), MaxVersions: 2, ChunkSize: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// interrupted after a few chunks
+	var restored []string
+	options := RestoreOptions{Table: "orders_copy", Parallelism: 2, Checkpoint: func(keys []string) error {
+		restored = keys
+		if len(keys) == 3 {
+			return errors.New("interrupted")
+		}
+		return nil
+	}}
+	if _, err := Restore(context.Background(), client, b, "backups/orders", options); err == nil || err.Error() != "interrupted" {
+		t.Fatalf("expect interruption: %v", err)
+	}
+	options.Checkpoint = nil
+	options.Resume = restored
+	options.RowsPerSecond = 1000
+	progress, err := Restore(context.Background(), client, b, "backups/orders", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resumedRows int64
+	for _, chunk := range m.Chunks {
+		for _, key := range restored {
+			if chunk.Key == key {
+				resumedRows += chunk.Rows
+			}
+		}
+	}
+	if progress.Chunks+len(restored) != len(m.Chunks) || progress.Rows+resumedRows != 50 {
+		t.Errorf("progress: %+v, resumed %d chunks of %d rows", progress, len(restored), resumedRows)
+	}
+
+	report, err := verify.Compare(context.Background(), client, "orders", client, "orders_copy", verify.Options{Splits: splits()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Equal() || report.Target.Rows != 50 {
+		t.Errorf("report: %+v", report)
+	}
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn("id", int64(7))
+	resp, err := client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: &tablestore.SingleRowQueryCriteria{
+		TableName: "orders_copy", PrimaryKey: pk, ColumnsToGet: []string{"name"}, MaxVersion: 2}})
+	if err != nil || len(resp.Columns) != 2 || resp.Columns[1].Value != "order 7" || resp.Columns[1].Timestamp != 1000 {
+		t.Errorf("versions of restored row: %+v %v", resp, err)
+	}
+
+	// corrupted chunk
+	key := "backups/orders/" + m.Chunks[0].Key
+	b.objects[key] = append([]byte(nil), b.objects[key]...)
+	b.objects[key][20]++
+	if _, err := Restore(context.Background(), client, b, "backups/orders", RestoreOptions{Table: "orders_corrupted"}); err == nil {
+		t.Error("expect error for corrupted chunk")
+	}
+}
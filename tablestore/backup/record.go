@@ -0,0 +1,109 @@
+package backup
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"strconv"
+)
+
+// record is the JSON line of a row in chunks.
+type record struct {
+	PrimaryKey []*value `json:"pk"`
+	Columns    []*value `json:"columns,omitempty"`
+}
+
+// value is a typed value, doubles being formatted as strings to keep NaN and
+// infinities.
+type value struct {
+	Name      string  `json:"n"`
+	String    *string `json:"s,omitempty"`
+	Integer   *int64  `json:"i,omitempty"`
+	Double    string  `json:"d,omitempty"`
+	Boolean   *bool   `json:"b,omitempty"`
+	Binary    *[]byte `json:"x,omitempty"`
+	Timestamp int64   `json:"t,omitempty"`
+}
+
+func newValue(name string, v interface{}) *value {
+	value := &value{Name: name}
+	switch v := v.(type) {
+	case string:
+		value.String = &v
+	case int64:
+		value.Integer = &v
+	case float64:
+		value.Double = strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		value.Boolean = &v
+	case []byte:
+		value.Binary = &v
+	}
+	return value
+}
+
+func (value *value) value() (interface{}, error) {
+	switch {
+	case value.String != nil:
+		return *value.String, nil
+	case value.Integer != nil:
+		return *value.Integer, nil
+	case value.Double != "":
+		return strconv.ParseFloat(value.Double, 64)
+	case value.Boolean != nil:
+		return *value.Boolean, nil
+	case value.Binary != nil:
+		return *value.Binary, nil
+	}
+	return nil, fmt.Errorf("[tablestore] value of %s missing", value.Name)
+}
+
+func newRecord(row *tablestore.Row) *record {
+	r := &record{}
+	for _, column := range row.PrimaryKey.PrimaryKeys {
+		r.PrimaryKey = append(r.PrimaryKey, newValue(column.ColumnName, column.Value))
+	}
+	for _, column := range row.Columns {
+		v := newValue(column.ColumnName, column.Value)
+		v.Timestamp = column.Timestamp
+		r.Columns = append(r.Columns, v)
+	}
+	return r
+}
+
+// size estimates the size of the row of r.
+func (r *record) size() int {
+	size := 0
+	for _, values := range [][]*value{r.PrimaryKey, r.Columns} {
+		for _, v := range values {
+			size += len(v.Name) + 8
+			switch {
+			case v.String != nil:
+				size += len(*v.String)
+			case v.Binary != nil:
+				size += len(*v.Binary)
+			}
+		}
+	}
+	return size
+}
+
+// putRowChange returns the change putting the row of r to table.
+func (r *record) putRowChange(table string) (*tablestore.PutRowChange, error) {
+	change := &tablestore.PutRowChange{TableName: table, PrimaryKey: new(tablestore.PrimaryKey)}
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	for _, column := range r.PrimaryKey {
+		v, err := column.value()
+		if err != nil {
+			return nil, err
+		}
+		change.PrimaryKey.AddPrimaryKeyColumn(column.Name, v)
+	}
+	for _, column := range r.Columns {
+		v, err := column.value()
+		if err != nil {
+			return nil, err
+		}
+		change.AddColumnWithTimestamp(column.Name, v, column.Timestamp)
+	}
+	return change, nil
+}
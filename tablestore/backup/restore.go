@@ -0,0 +1,215 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/manifest"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/timeline/promise"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/timeline/writer"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ObjectReader reads objects of the storage of backups.
+type ObjectReader interface {
+	GetObject(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+func (dir Dir) GetObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(string(dir), filepath.FromSlash(key)))
+}
+
+type RestoreOptions struct {
+	// table restored, the table backed up by default
+	Table string
+	// chunks restored in parallel, 4 by default
+	Parallelism int
+	// rows written per second, unlimited if 0
+	RowsPerSecond float64
+	// configuration of the writer of rows, its defaults if nil
+	Writer *writer.Config
+	// called with the keys of the chunks restored after each chunk; errors
+	// stop the restore
+	Checkpoint func(restored []string) error
+	// keys of the chunks restored by an interrupted restore, skipped
+	Resume []string
+}
+
+type RestoreProgress struct {
+	Chunks int
+	Rows   int64
+}
+
+// ReadManifest reads the manifest of the backup under prefix.
+func ReadManifest(ctx context.Context, reader ObjectReader, prefix string) (*Manifest, error) {
+	r, err := reader.GetObject(ctx, path.Join(prefix, ManifestName))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	m := new(Manifest)
+	if err := json.NewDecoder(r).Decode(m); err != nil {
+		return nil, fmt.Errorf("[tablestore] invalid backup manifest: %s", err)
+	}
+	return m, nil
+}
+
+// Restore writes the rows of the backup under prefix to its table, or to
+// options.Table, creating the table if it does not exist. Rows are
+// overwritten, so restoring a chunk twice is harmless. The values of auto
+// increment primary keys are restored as they are, in a plain integer
+// column of the table created.
+//
+// Columns older than the time to live of the table expire once restored.
+func Restore(ctx context.Context, client tablestore.TableStoreApi, reader ObjectReader, prefix string, options RestoreOptions) (*RestoreProgress, error) {
+	if options.Parallelism <= 0 {
+		options.Parallelism = 4
+	}
+	m, err := ReadManifest(ctx, reader, prefix)
+	if err != nil {
+		return nil, err
+	}
+	table := *m.Table
+	if options.Table != "" {
+		table.Name = options.Table
+	}
+	table.PrimaryKeys = nil
+	for _, column := range m.Table.PrimaryKeys {
+		c := *column
+		c.AutoIncrement = false
+		table.PrimaryKeys = append(table.PrimaryKeys, &c)
+	}
+	if _, err := manifest.Apply(client, &manifest.Manifest{Tables: []*manifest.Table{&table}}, manifest.Options{}); err != nil {
+		return nil, err
+	}
+
+	restorer := &restorer{client: client, reader: reader, prefix: prefix, table: table.Name, options: &options,
+		restored: make(map[string]bool), start: time.Now()}
+	for _, key := range options.Resume {
+		restorer.restored[key] = true
+	}
+	var chunks []*Chunk
+	for _, chunk := range m.Chunks {
+		if !restorer.restored[chunk.Key] {
+			chunks = append(chunks, chunk)
+		}
+	}
+	restorer.writer = writer.NewBatchWriter(client, options.Writer)
+	defer restorer.writer.Close()
+	err = parallel(ctx, len(chunks), options.Parallelism, func(ctx context.Context, i int) error {
+		return restorer.restore(ctx, chunks[i])
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &restorer.progress, nil
+}
+
+type restorer struct {
+	client  tablestore.TableStoreApi
+	reader  ObjectReader
+	writer  *writer.BatchWriter
+	prefix  string
+	table   string
+	options *RestoreOptions
+	start   time.Time
+
+	lock     sync.Mutex
+	restored map[string]bool
+	progress RestoreProgress
+	written  int64
+}
+
+// restore writes the rows of chunk.
+func (restorer *restorer) restore(ctx context.Context, chunk *Chunk) error {
+	r, err := restorer.reader.GetObject(ctx, path.Join(restorer.prefix, chunk.Key))
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) != chunk.Size || crc32.ChecksumIEEE(data) != chunk.Checksum {
+		return fmt.Errorf("[tablestore] chunk %s of the backup is corrupted", chunk.Key)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(zr)
+	var futures []*promise.Future
+	for {
+		var rec record
+		if err := decoder.Decode(&rec); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("[tablestore] chunk %s of the backup is invalid: %s", chunk.Key, err)
+		}
+		change, err := rec.putRowChange(restorer.table)
+		if err != nil {
+			return err
+		}
+		if err := restorer.pace(ctx); err != nil {
+			return err
+		}
+		future := promise.NewFuture()
+		if err := restorer.writer.BatchAdd(writer.NewBatchAdd(chunk.Key, change, future)); err != nil {
+			return err
+		}
+		futures = append(futures, future)
+	}
+	for _, future := range futures {
+		if _, err := future.Get(); err != nil {
+			return fmt.Errorf("[tablestore] restoring chunk %s failed: %s", chunk.Key, err)
+		}
+	}
+
+	restorer.lock.Lock()
+	defer restorer.lock.Unlock()
+	restorer.restored[chunk.Key] = true
+	restorer.progress.Chunks++
+	restorer.progress.Rows += int64(len(futures))
+	if restorer.options.Checkpoint != nil {
+		keys := make([]string, 0, len(restorer.restored))
+		for key := range restorer.restored {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return restorer.options.Checkpoint(keys)
+	}
+	return nil
+}
+
+// pace waits for the turn of the next row written.
+func (restorer *restorer) pace(ctx context.Context) error {
+	if restorer.options.RowsPerSecond <= 0 {
+		return nil
+	}
+	restorer.lock.Lock()
+	due := restorer.start.Add(time.Duration(float64(restorer.written) / restorer.options.RowsPerSecond * float64(time.Second)))
+	restorer.written++
+	restorer.lock.Unlock()
+	if wait := time.Until(due); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+	return nil
+}
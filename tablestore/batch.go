@@ -0,0 +1,189 @@
+package tablestore
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// SucceededRows returns the results of the rows read, by table name then in
+// request order.
+func (response *BatchGetRowResponse) SucceededRows() []RowResult {
+	return rowResults(response.TableToRowsResult, true)
+}
+
+// FailedRows returns the results of the rows failed, by table name then in
+// request order.
+func (response *BatchGetRowResponse) FailedRows() []RowResult {
+	return rowResults(response.TableToRowsResult, false)
+}
+
+// RetryableFailedRequest returns the request reading again the rows of
+// request whose failure, in response, is worth a retry, such as throttling,
+// or nil if there are none.
+func (response *BatchGetRowResponse) RetryableFailedRequest(request *BatchGetRowRequest) *BatchGetRowRequest {
+	var retry *BatchGetRowRequest
+	offsets := make(map[string]int)
+	for _, criteria := range request.MultiRowQueryCriteria {
+		results := response.TableToRowsResult[criteria.TableName]
+		offset := offsets[criteria.TableName]
+		offsets[criteria.TableName] += len(criteria.PrimaryKey)
+		var pks []*PrimaryKey
+		for i, pk := range criteria.PrimaryKey {
+			if offset+i < len(results) && retryableRow(&results[offset+i], batchGetRowUri) {
+				pks = append(pks, pk)
+			}
+		}
+		if pks == nil {
+			continue
+		}
+		if retry == nil {
+			retry = new(BatchGetRowRequest)
+		}
+		c := *criteria
+		c.PrimaryKey = pks
+		retry.MultiRowQueryCriteria = append(retry.MultiRowQueryCriteria, &c)
+	}
+	return retry
+}
+
+// retryFailedRows reads again the rows of request failed in response with
+// retryable errors, merging the results of the retries into response, until
+// none fails or the retry policy is exhausted. Rows failing again keep their
+// last failure.
+func (tableStoreClient *TableStoreClient) retryFailedRows(request *BatchGetRowRequest, response *BatchGetRowResponse) {
+	var tables []string
+	for _, criteria := range request.MultiRowQueryCriteria {
+		tables = append(tables, criteria.TableName)
+	}
+	retryTimes, maxRetryTime := tableStoreClient.retryPolicy(strings.Join(tables, ","))
+	end := time.Now().Add(maxRetryTime)
+	ctx := tableStoreClient.context()
+	var interval int64
+	for count := uint(0); count < retryTimes && time.Now().Before(end); count++ {
+		retry := response.RetryableFailedRequest(request)
+		if retry == nil {
+			return
+		}
+		// positions of the rows retried in the results of their table
+		positions := make(map[string][]int)
+		for table, results := range response.TableToRowsResult {
+			for i := range results {
+				if retryableRow(&results[i], batchGetRowUri) {
+					positions[table] = append(positions[table], i)
+				}
+			}
+		}
+		interval = interval*2 + tableStoreClient.random.Int63n(DefaultRetryInterval-1) + 1
+		if interval > MaxRetryInterval {
+			interval = MaxRetryInterval
+		}
+		select {
+		case <-time.After(time.Duration(interval) * time.Millisecond):
+		case <-ctx.Done():
+			return
+		}
+		retried, err := tableStoreClient.batchGetRow(retry)
+		if err != nil {
+			return
+		}
+		response.Attempts += retried.Attempts
+		response.ThrottledAttempts += retried.ThrottledAttempts
+		for table, results := range retried.TableToRowsResult {
+			for i, result := range results {
+				if i < len(positions[table]) {
+					result.Index = int32(positions[table][i])
+					response.TableToRowsResult[table][positions[table][i]] = result
+				}
+			}
+		}
+	}
+}
+
+// SucceededRows returns the results of the rows written, by table name then
+// in request order.
+func (response *BatchWriteRowResponse) SucceededRows() []RowResult {
+	return rowResults(response.TableToRowsResult, true)
+}
+
+// FailedRows returns the results of the rows failed, by table name then in
+// request order.
+func (response *BatchWriteRowResponse) FailedRows() []RowResult {
+	return rowResults(response.TableToRowsResult, false)
+}
+
+// RetryableFailedRequest returns the request writing again the changes of
+// request whose failure, in response, is worth a retry, such as throttling or
+// row conflicts, or nil if there are none.
+func (response *BatchWriteRowResponse) RetryableFailedRequest(request *BatchWriteRowRequest) *BatchWriteRowRequest {
+	var retry *BatchWriteRowRequest
+	for table, changes := range request.RowChangesGroupByTable {
+		results := response.TableToRowsResult[table]
+		for i, change := range changes {
+			if i < len(results) && retryableRow(&results[i], batchWriteRowUri) {
+				if retry == nil {
+					retry = &BatchWriteRowRequest{IsAtomic: request.IsAtomic}
+				}
+				retry.AddRowChange(change)
+			}
+		}
+	}
+	return retry
+}
+
+// BatchGetRowWithFallback reads the rows of request as BatchGetRow does, then
+// reads again the rows failed, such as rows over the size limits of the
+// response, with GetRow one by one. The results of the rows read again
+// replace their failures; rows failing again keep their first failure.
+func BatchGetRowWithFallback(client TableStoreApi, request *BatchGetRowRequest) (*BatchGetRowResponse, error) {
+	response, err := client.BatchGetRow(request)
+	if err != nil {
+		return nil, err
+	}
+	offsets := make(map[string]int)
+	for _, criteria := range request.MultiRowQueryCriteria {
+		results := response.TableToRowsResult[criteria.TableName]
+		offset := offsets[criteria.TableName]
+		offsets[criteria.TableName] += len(criteria.PrimaryKey)
+		for i, pk := range criteria.PrimaryKey {
+			if offset+i >= len(results) || results[offset+i].IsSucceed {
+				continue
+			}
+			single := &SingleRowQueryCriteria{TableName: criteria.TableName, PrimaryKey: pk, ColumnsToGet: criteria.ColumnsToGet,
+				MaxVersion: int32(criteria.MaxVersion), TimeRange: criteria.TimeRange, Filter: criteria.Filter,
+				StartColumn: criteria.StartColumn, EndColumn: criteria.EndColumn}
+			resp, err := client.GetRow(&GetRowRequest{SingleRowQueryCriteria: single})
+			if err != nil {
+				continue
+			}
+			result := &results[offset+i]
+			result.IsSucceed = true
+			result.Error = Error{}
+			result.PrimaryKey = resp.PrimaryKey
+			result.Columns = resp.Columns
+			result.ConsumedCapacityUnit = resp.ConsumedCapacityUnit
+		}
+	}
+	return response, nil
+}
+
+func rowResults(tableToRowsResult map[string][]RowResult, succeeded bool) []RowResult {
+	tables := make([]string, 0, len(tableToRowsResult))
+	for table := range tableToRowsResult {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	var rows []RowResult
+	for _, table := range tables {
+		for _, row := range tableToRowsResult[table] {
+			if row.IsSucceed == succeeded {
+				rows = append(rows, row)
+			}
+		}
+	}
+	return rows
+}
+
+func retryableRow(row *RowResult, action string) bool {
+	return !row.IsSucceed && shouldRetry(row.Error.Code, row.Error.Message, action, 0)
+}
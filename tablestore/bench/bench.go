@@ -0,0 +1,452 @@
+// Package bench drives a configurable mix of PutRow, GetRow, GetRange and
+// BatchWriteRow requests against a table at a target rate, and reports
+// latency histograms and consumed capacity units per operation:
+//
+//	config := bench.Config{
+//		TableName: "bench",
+//		Mix:       map[bench.Operation]int{bench.OpPutRow: 1, bench.OpGetRow: 3},
+//		QPS:       500,
+//		Duration:  time.Minute,
+//	}
+//	report, err := bench.Run(client, config)
+//	report.WriteTo(os.Stdout)
+//
+// The table has a single string primary key column, see CreateTable. Rows
+// are spread over KeySpace keys chosen uniformly by random sources seeded
+// with Seed, so that runs are reproducible. The tablestorebench command runs
+// a benchmark from the command line.
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/internal/histogram"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Operation string
+
+const (
+	OpPutRow        Operation = "PutRow"
+	OpGetRow        Operation = "GetRow"
+	OpGetRange      Operation = "GetRange"
+	OpBatchWriteRow Operation = "BatchWriteRow"
+)
+
+var operations = []Operation{OpPutRow, OpGetRow, OpGetRange, OpBatchWriteRow}
+
+const (
+	// name of the primary key column of the table
+	PrimaryKeyName = "pk"
+	// name of the attribute column written
+	ValueColumnName = "value"
+)
+
+type Config struct {
+	TableName string
+	// relative weights of operations, e.g. {OpPutRow: 1, OpGetRow: 3}
+	Mix map[Operation]int
+	// target requests per second of all workers, 0 for as fast as possible
+	QPS float64
+	// number of concurrent workers, 1 by default
+	Concurrency int
+	// the run stops after Duration or Requests requests, whichever comes
+	// first. At least one of them must be set.
+	Duration time.Duration
+	Requests int64
+
+	// number of distinct row keys, 10000 by default
+	KeySpace int64
+	// size of the value column in bytes, 100 by default
+	ValueSize int
+	// rows per BatchWriteRow request, 100 by default
+	BatchSize int
+	// max rows per GetRange request, 100 by default
+	RangeLimit int32
+	Seed       int64
+}
+
+var errNoStop = errors.New("[bench] either Duration or Requests must be set")
+var errNoMix = errors.New("[bench] no operation in mix")
+
+func (config *Config) setDefaults() {
+	if config.Concurrency <= 0 {
+		config.Concurrency = 1
+	}
+	if config.KeySpace <= 0 {
+		config.KeySpace = 10000
+	}
+	if config.ValueSize <= 0 {
+		config.ValueSize = 100
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.RangeLimit <= 0 {
+		config.RangeLimit = 100
+	}
+}
+
+// ParseMix parses a mix such as "PutRow=1,GetRow=3". An operation without
+// weight has weight 1.
+func ParseMix(s string) (map[Operation]int, error) {
+	mix := make(map[Operation]int)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, weight := item, 1
+		if i := strings.Index(item, "="); i >= 0 {
+			var err error
+			name = item[:i]
+			if weight, err = strconv.Atoi(item[i+1:]); err != nil || weight < 0 {
+				return nil, fmt.Errorf("[bench] invalid weight in %q", item)
+			}
+		}
+		op, ok := parseOperation(name)
+		if !ok {
+			return nil, fmt.Errorf("[bench] unknown operation %q", name)
+		}
+		mix[op] = weight
+	}
+	return mix, nil
+}
+
+func parseOperation(name string) (Operation, bool) {
+	for _, op := range operations {
+		if strings.EqualFold(string(op), name) {
+			return op, true
+		}
+	}
+	return "", false
+}
+
+// CreateTable creates the table used by Run with the given reserved
+// throughput.
+func CreateTable(client tablestore.TableStoreApi, tableName string, readCU, writeCU int) error {
+	meta := new(tablestore.TableMeta)
+	meta.TableName = tableName
+	meta.AddPrimaryKeyColumn(PrimaryKeyName, tablestore.PrimaryKeyType_STRING)
+	_, err := client.CreateTable(&tablestore.CreateTableRequest{
+		TableMeta:          meta,
+		TableOption:        &tablestore.TableOption{TimeToAlive: -1, MaxVersion: 1},
+		ReservedThroughput: &tablestore.ReservedThroughput{Readcap: readCU, Writecap: writeCU},
+	})
+	return err
+}
+
+// Key returns the primary key value of row n. Keys start with a hash of n so
+// that consecutive rows fall in different partitions.
+func Key(n int64) string {
+	h := fnv.New32a()
+	h.Write([]byte(strconv.FormatInt(n, 10)))
+	return fmt.Sprintf("%08x-%d", h.Sum32(), n)
+}
+
+// Histogram counts latencies in exponentially growing buckets. Quantiles are
+// accurate to the bucket width, about 9%. It is not safe for concurrent use.
+type Histogram = histogram.Histogram
+
+// Stats are the results of an operation.
+type Stats struct {
+	Requests int64
+	Errors   int64
+	// latencies of successful requests
+	Latency Histogram
+	ReadCU  int64
+	WriteCU int64
+	// first errors met, at most 10
+	SampleErrors []error
+}
+
+func (stats *Stats) merge(other *Stats) {
+	stats.Requests += other.Requests
+	stats.Errors += other.Errors
+	stats.Latency.Merge(&other.Latency)
+	stats.ReadCU += other.ReadCU
+	stats.WriteCU += other.WriteCU
+	for _, err := range other.SampleErrors {
+		if len(stats.SampleErrors) < 10 {
+			stats.SampleErrors = append(stats.SampleErrors, err)
+		}
+	}
+}
+
+type Report struct {
+	Config     Config
+	Elapsed    time.Duration
+	Operations map[Operation]*Stats
+}
+
+// Total returns the stats of all operations together.
+func (report *Report) Total() *Stats {
+	total := new(Stats)
+	for _, op := range operations {
+		if stats, ok := report.Operations[op]; ok {
+			total.merge(stats)
+		}
+	}
+	return total
+}
+
+// WriteTo writes the report as a table with a line per operation.
+func (report *Report) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-14s %9s %7s %9s %9s %9s %9s %9s %9s %9s\n",
+		"operation", "requests", "errors", "qps", "mean", "p50", "p99", "max", "read CU", "write CU")
+	line := func(name string, stats *Stats) {
+		qps := 0.0
+		if report.Elapsed > 0 {
+			qps = float64(stats.Requests) / report.Elapsed.Seconds()
+		}
+		h := &stats.Latency
+		fmt.Fprintf(&b, "%-14s %9d %7d %9.1f %9s %9s %9s %9s %9d %9d\n",
+			name, stats.Requests, stats.Errors, qps, round(h.Mean()), round(h.Quantile(0.5)), round(h.Quantile(0.99)), round(h.Max()), stats.ReadCU, stats.WriteCU)
+	}
+	for _, op := range operations {
+		if stats, ok := report.Operations[op]; ok {
+			line(string(op), stats)
+		}
+	}
+	line("total", report.Total())
+	for _, op := range operations {
+		if stats, ok := report.Operations[op]; ok {
+			for _, err := range stats.SampleErrors {
+				fmt.Fprintf(&b, "%s error: %s\n", op, err)
+			}
+		}
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func round(d time.Duration) time.Duration {
+	if d > time.Millisecond {
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
+
+// chooser picks operations with the weights of a mix.
+type chooser struct {
+	ops     []Operation
+	weights []int
+	total   int
+}
+
+func newChooser(mix map[Operation]int) *chooser {
+	c := new(chooser)
+	for _, op := range operations {
+		if weight := mix[op]; weight > 0 {
+			c.ops = append(c.ops, op)
+			c.weights = append(c.weights, weight)
+			c.total += weight
+		}
+	}
+	return c
+}
+
+func (c *chooser) choose(random *rand.Rand) Operation {
+	n := random.Intn(c.total)
+	for i, weight := range c.weights {
+		if n < weight {
+			return c.ops[i]
+		}
+		n -= weight
+	}
+	return c.ops[len(c.ops)-1]
+}
+
+// Run sends requests to client as configured, and returns the report once
+// the run stops.
+func Run(client tablestore.TableStoreApi, config Config) (*Report, error) {
+	if config.Duration <= 0 && config.Requests <= 0 {
+		return nil, errNoStop
+	}
+	for op := range config.Mix {
+		if _, ok := parseOperation(string(op)); !ok {
+			return nil, fmt.Errorf("[bench] unknown operation %q", op)
+		}
+	}
+	choose := newChooser(config.Mix)
+	if choose.total == 0 {
+		return nil, errNoMix
+	}
+	config.setDefaults()
+
+	// every request takes a ticket, at the target rate if any
+	tickets := make(chan struct{})
+	done := make(chan struct{})
+	start := time.Now()
+	go func() {
+		defer close(tickets)
+		var deadline <-chan time.Time
+		if config.Duration > 0 {
+			timer := time.NewTimer(config.Duration)
+			defer timer.Stop()
+			deadline = timer.C
+		}
+		var interval time.Duration
+		if config.QPS > 0 {
+			interval = time.Duration(float64(time.Second) / config.QPS)
+		}
+		next := start
+		for sent := int64(0); config.Requests <= 0 || sent < config.Requests; sent++ {
+			if interval > 0 {
+				next = next.Add(interval)
+				if wait := time.Until(next); wait > 0 {
+					select {
+					case <-time.After(wait):
+					case <-deadline:
+						return
+					}
+				}
+			}
+			select {
+			case tickets <- struct{}{}:
+			case <-deadline:
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	results := make([]map[Operation]*Stats, config.Concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < config.Concurrency; i++ {
+		w := &worker{
+			client: client,
+			config: &config,
+			random: rand.New(rand.NewSource(config.Seed + int64(i))),
+			stats:  make(map[Operation]*Stats),
+		}
+		results[i] = w.stats
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range tickets {
+				w.do(choose.choose(w.random))
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+
+	report := &Report{Config: config, Elapsed: time.Since(start), Operations: make(map[Operation]*Stats)}
+	for _, stats := range results {
+		for op, s := range stats {
+			if _, ok := report.Operations[op]; !ok {
+				report.Operations[op] = new(Stats)
+			}
+			report.Operations[op].merge(s)
+		}
+	}
+	return report, nil
+}
+
+type worker struct {
+	client tablestore.TableStoreApi
+	config *Config
+	random *rand.Rand
+	stats  map[Operation]*Stats
+	value  []byte
+}
+
+func (w *worker) key() string {
+	return Key(w.random.Int63n(w.config.KeySpace))
+}
+
+func (w *worker) putRowChange() *tablestore.PutRowChange {
+	if w.value == nil {
+		w.value = make([]byte, w.config.ValueSize)
+	}
+	w.random.Read(w.value)
+	change := &tablestore.PutRowChange{TableName: w.config.TableName, PrimaryKey: new(tablestore.PrimaryKey)}
+	change.PrimaryKey.AddPrimaryKeyColumn(PrimaryKeyName, w.key())
+	change.AddColumn(ValueColumnName, append([]byte(nil), w.value...))
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	return change
+}
+
+func (w *worker) do(op Operation) {
+	stats, ok := w.stats[op]
+	if !ok {
+		stats = new(Stats)
+		w.stats[op] = stats
+	}
+
+	var consumed []*tablestore.ConsumedCapacityUnit
+	var err error
+	start := time.Now()
+	switch op {
+	case OpPutRow:
+		var resp *tablestore.PutRowResponse
+		if resp, err = w.client.PutRow(&tablestore.PutRowRequest{PutRowChange: w.putRowChange()}); err == nil {
+			consumed = append(consumed, resp.ConsumedCapacityUnit)
+		}
+	case OpGetRow:
+		criteria := &tablestore.SingleRowQueryCriteria{TableName: w.config.TableName, PrimaryKey: new(tablestore.PrimaryKey), MaxVersion: 1}
+		criteria.PrimaryKey.AddPrimaryKeyColumn(PrimaryKeyName, w.key())
+		var resp *tablestore.GetRowResponse
+		if resp, err = w.client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria}); err == nil {
+			consumed = append(consumed, resp.ConsumedCapacityUnit)
+		}
+	case OpGetRange:
+		criteria := &tablestore.RangeRowQueryCriteria{
+			TableName:       w.config.TableName,
+			StartPrimaryKey: new(tablestore.PrimaryKey),
+			EndPrimaryKey:   new(tablestore.PrimaryKey),
+			Direction:       tablestore.FORWARD,
+			MaxVersion:      1,
+			Limit:           w.config.RangeLimit,
+		}
+		criteria.StartPrimaryKey.AddPrimaryKeyColumn(PrimaryKeyName, w.key())
+		criteria.EndPrimaryKey.AddPrimaryKeyColumnWithMaxValue(PrimaryKeyName)
+		var resp *tablestore.GetRangeResponse
+		if resp, err = w.client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: criteria}); err == nil {
+			consumed = append(consumed, resp.ConsumedCapacityUnit)
+		}
+	case OpBatchWriteRow:
+		request := new(tablestore.BatchWriteRowRequest)
+		for i := 0; i < w.config.BatchSize; i++ {
+			request.AddRowChange(w.putRowChange())
+		}
+		var resp *tablestore.BatchWriteRowResponse
+		if resp, err = w.client.BatchWriteRow(request); err == nil {
+			for _, results := range resp.TableToRowsResult {
+				for _, result := range results {
+					if !result.IsSucceed {
+						err = fmt.Errorf("%s %s", result.Error.Code, result.Error.Message)
+					}
+					consumed = append(consumed, result.ConsumedCapacityUnit)
+				}
+			}
+		}
+	}
+	elapsed := time.Since(start)
+
+	stats.Requests++
+	for _, cu := range consumed {
+		if cu != nil {
+			stats.ReadCU += int64(cu.Read)
+			stats.WriteCU += int64(cu.Write)
+		}
+	}
+	if err != nil {
+		stats.Errors++
+		if len(stats.SampleErrors) < 10 {
+			stats.SampleErrors = append(stats.SampleErrors, err)
+		}
+		return
+	}
+	stats.Latency.Record(elapsed)
+}
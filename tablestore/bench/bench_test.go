@@ -0,0 +1,119 @@
+package bench
+
+import (
+	"bytes"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	client := tablestoretest.NewClient()
+	if err := CreateTable(client, "bench", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	mix, err := ParseMix("PutRow=2, getrow, GetRange=1,BatchWriteRow=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := Run(client, Config{TableName: "bench", Mix: mix, Concurrency: 4, Requests: 200, KeySpace: 50, BatchSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total := report.Total()
+	if total.Requests != 200 || total.Errors != 0 || total.Latency.Count() != 200 {
+		t.Fatalf("unexpected total %+v", total)
+	}
+	for _, op := range operations {
+		if report.Operations[op] == nil || report.Operations[op].Requests == 0 {
+			t.Errorf("no %s sent", op)
+		}
+	}
+	if report.Operations[OpPutRow].WriteCU != report.Operations[OpPutRow].Requests {
+		t.Errorf("unexpected write CU %d", report.Operations[OpPutRow].WriteCU)
+	}
+	if report.Operations[OpBatchWriteRow].WriteCU != 10*report.Operations[OpBatchWriteRow].Requests {
+		t.Errorf("unexpected batch write CU %d", report.Operations[OpBatchWriteRow].WriteCU)
+	}
+
+	var b bytes.Buffer
+	report.WriteTo(&b)
+	if lines := strings.Split(strings.TrimSpace(b.String()), "\n"); len(lines) != 6 || !strings.HasPrefix(lines[5], "total") {
+		t.Errorf("unexpected report\n%s", b.String())
+	}
+}
+
+func TestRunRate(t *testing.T) {
+	client := tablestoretest.NewClient()
+	CreateTable(client, "bench", 0, 0)
+
+	start := time.Now()
+	report, err := Run(client, Config{TableName: "bench", Mix: map[Operation]int{OpGetRow: 1}, QPS: 100, Requests: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+		t.Errorf("20 requests at 100 QPS took %s", elapsed)
+	}
+	if report.Total().Requests != 20 {
+		t.Errorf("sent %d requests", report.Total().Requests)
+	}
+
+	// errors are counted, not timed
+	report, err = Run(client, Config{TableName: "missing", Mix: map[Operation]int{OpGetRow: 1}, Duration: time.Second, Requests: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total := report.Total(); total.Errors != 5 || total.Latency.Count() != 0 || len(total.SampleErrors) != 5 {
+		t.Errorf("unexpected total %+v", total)
+	}
+
+	if _, err := Run(client, Config{TableName: "bench", Mix: map[Operation]int{OpGetRow: 1}}); err != errNoStop {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err := Run(client, Config{TableName: "bench", Requests: 1}); err != errNoMix {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestParseMix(t *testing.T) {
+	mix, err := ParseMix("PutRow=3,GetRange")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(mix, map[Operation]int{OpPutRow: 3, OpGetRange: 1}) {
+		t.Errorf("unexpected mix %v", mix)
+	}
+	for _, s := range []string{"DeleteRow", "PutRow=x", "GetRow=-1"} {
+		if _, err := ParseMix(s); err == nil {
+			t.Errorf("%q accepted", s)
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	var h Histogram
+	for i := 1; i <= 1000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+	for q, want := range map[float64]time.Duration{0.5: 500 * time.Millisecond, 0.99: 990 * time.Millisecond, 1: time.Second} {
+		got := h.Quantile(q)
+		if got < want || float64(got) > float64(want)*1.1 {
+			t.Errorf("quantile %v is %s, want about %s", q, got, want)
+		}
+	}
+	if h.Min() != time.Millisecond || h.Max() != time.Second || h.Mean() != 500500*time.Microsecond {
+		t.Errorf("unexpected min %s, max %s, mean %s", h.Min(), h.Max(), h.Mean())
+	}
+
+	var merged Histogram
+	merged.Merge(&h)
+	merged.Record(2 * time.Second)
+	if merged.Count() != 1001 || merged.Max() != 2*time.Second || merged.Quantile(0.5) != h.Quantile(0.5) {
+		t.Errorf("unexpected merged histogram")
+	}
+}
@@ -0,0 +1,71 @@
+package tablestore
+
+import "reflect"
+
+// AddBinaryColumn adds a BINARY column, written and read back byte for byte,
+// e.g. for payloads which are not valid UTF-8 and must not be written as
+// strings. A nil value is written as an empty one.
+func (rowchange *PutRowChange) AddBinaryColumn(columnName string, value []byte) {
+	rowchange.AddColumn(columnName, binaryValue(value))
+}
+
+func (rowchange *PutRowChange) AddBinaryColumnWithTimestamp(columnName string, value []byte, timestamp int64) {
+	rowchange.AddColumnWithTimestamp(columnName, binaryValue(value), timestamp)
+}
+
+// PutBinaryColumn puts a BINARY column, see AddBinaryColumn.
+func (rowchange *UpdateRowChange) PutBinaryColumn(columnName string, value []byte) {
+	rowchange.PutColumn(columnName, binaryValue(value))
+}
+
+// AddBinaryPrimaryKeyColumn adds a BINARY primary key column, a nil value
+// being an empty one.
+func (pk *PrimaryKey) AddBinaryPrimaryKeyColumn(primaryKeyName string, value []byte) {
+	pk.AddPrimaryKeyColumn(primaryKeyName, binaryValue(value))
+}
+
+// AsBinary returns the value of a BINARY column, false for other types.
+func (column *AttributeColumn) AsBinary() ([]byte, bool) {
+	v, ok := column.Value.([]byte)
+	return v, ok
+}
+
+// AsString returns the value of a STRING column, false for other types,
+// BINARY columns included.
+func (column *AttributeColumn) AsString() (string, bool) {
+	v, ok := column.Value.(string)
+	return v, ok
+}
+
+// AsBinary returns the value of a BINARY primary key column, false for other
+// types and options.
+func (column *PrimaryKeyColumn) AsBinary() ([]byte, bool) {
+	v, ok := column.Value.([]byte)
+	return v, ok
+}
+
+func binaryValue(value []byte) []byte {
+	if value == nil {
+		return []byte{}
+	}
+	return value
+}
+
+// plainValue returns values of named string and []byte types, e.g.
+// json.RawMessage, as string and []byte values, the types written, other
+// values as is. Values are converted when added to rows, not when written, so
+// that writing allocates nothing.
+func plainValue(value interface{}) interface{} {
+	switch value.(type) {
+	case nil, string, []byte, int64, float64, bool:
+		return value
+	}
+	v := reflect.ValueOf(value)
+	switch {
+	case v.Kind() == reflect.String:
+		return v.String()
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		return v.Bytes()
+	}
+	return value
+}
@@ -0,0 +1,371 @@
+// Package blob stores values larger than the 2MB limit of columns, such as
+// files, split into chunks, and reads them back as streams verified by
+// their checksum:
+//
+//	info, err := blob.Write(client, "files", pk, f, blob.Options{})
+//	r, err := blob.Read(client, "files", pk, blob.Options{})
+//	_, err = io.Copy(w, r) // an error if the blob is corrupted
+//
+// With the Columns layout, by default, chunks are the columns blob_000000,
+// blob_000001... of the row of pk, written one by one, and the columns
+// blob_size, blob_chunks and blob_sha256 describe the blob. With the Rows
+// layout, for blobs too large for a row, chunks are the column data of child
+// rows numbered from 1 by the last primary key column of the table, their
+// description the row numbered 0, pk missing that column.
+//
+// The description is written last, so that a blob is read whole or as it
+// was before being overwritten, until its chunks are overwritten. Concurrent
+// writes of a blob are detected by its checksum on read.
+package blob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"hash"
+	"io"
+)
+
+// ErrNotFound is returned by Read and Delete for missing blobs.
+var ErrNotFound = errors.New("[tablestore] blob not found")
+
+// Layout is how the chunks of blobs are stored.
+type Layout int
+
+const (
+	// chunks are numbered columns of the row of the blob
+	Columns Layout = iota
+	// chunks are numbered child rows
+	Rows
+)
+
+type Options struct {
+	Layout Layout
+	// prefix of the names of the columns of blobs, "blob" by default
+	Column string
+	// primary key column numbering the rows of the Rows layout, the last one
+	// of the table
+	ChunkColumn string
+	// size of chunks, 1MB by default, 2MB at most
+	ChunkSize int
+}
+
+func (options *Options) defaults() error {
+	if options.Column == "" {
+		options.Column = "blob"
+	}
+	if options.ChunkSize <= 0 {
+		options.ChunkSize = 1 << 20
+	}
+	if options.ChunkSize > 2<<20 {
+		return fmt.Errorf("[tablestore] chunk size %d over 2MB", options.ChunkSize)
+	}
+	if options.Layout == Rows && options.ChunkColumn == "" {
+		return fmt.Errorf("[tablestore] chunk column of the Rows layout missing")
+	}
+	return nil
+}
+
+// Info describes a blob.
+type Info struct {
+	Size   int64
+	Chunks int
+	// hex encoded SHA-256 of the blob
+	Checksum string
+}
+
+func (options *Options) chunkName(i int) string {
+	return fmt.Sprintf("%s_%06d", options.Column, i)
+}
+
+func (options *Options) sizeName() string {
+	return options.Column + "_size"
+}
+
+func (options *Options) chunksName() string {
+	return options.Column + "_chunks"
+}
+
+func (options *Options) checksumName() string {
+	return options.Column + "_sha256"
+}
+
+// rowKey returns pk followed by the chunk column numbering the i-th row.
+func (options *Options) rowKey(pk *tablestore.PrimaryKey, i int) *tablestore.PrimaryKey {
+	key := new(tablestore.PrimaryKey)
+	key.PrimaryKeys = append(key.PrimaryKeys, pk.PrimaryKeys...)
+	key.AddPrimaryKeyColumn(options.ChunkColumn, int64(i))
+	return key
+}
+
+// Stat returns the description of the blob of pk, ErrNotFound if it is
+// missing.
+func Stat(client tablestore.TableStoreApi, table string, pk *tablestore.PrimaryKey, options Options) (*Info, error) {
+	if err := options.defaults(); err != nil {
+		return nil, err
+	}
+	return stat(client, table, pk, &options)
+}
+
+func stat(client tablestore.TableStoreApi, table string, pk *tablestore.PrimaryKey, options *Options) (*Info, error) {
+	criteria := &tablestore.SingleRowQueryCriteria{TableName: table, PrimaryKey: pk, MaxVersion: 1,
+		ColumnsToGet: []string{options.sizeName(), options.chunksName(), options.checksumName()}}
+	if options.Layout == Rows {
+		criteria.PrimaryKey = options.rowKey(pk, 0)
+	}
+	resp, err := client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil {
+		return nil, err
+	}
+	info := new(Info)
+	found := 0
+	for _, column := range resp.Columns {
+		switch column.ColumnName {
+		case options.sizeName():
+			size, ok := column.Value.(int64)
+			info.Size = size
+			found += boolInt(ok)
+		case options.chunksName():
+			chunks, ok := column.Value.(int64)
+			info.Chunks = int(chunks)
+			found += boolInt(ok)
+		case options.checksumName():
+			checksum, ok := column.Value.(string)
+			info.Checksum = checksum
+			found += boolInt(ok)
+		}
+	}
+	if found != 3 {
+		return nil, ErrNotFound
+	}
+	return info, nil
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Write writes the blob of pk from r, overwriting it and deleting its former
+// chunks if it exists.
+func Write(client tablestore.TableStoreApi, table string, pk *tablestore.PrimaryKey, r io.Reader, options Options) (*Info, error) {
+	if err := options.defaults(); err != nil {
+		return nil, err
+	}
+	former, err := stat(client, table, pk, &options)
+	if err == ErrNotFound {
+		former = new(Info)
+	} else if err != nil {
+		return nil, err
+	}
+
+	info := new(Info)
+	h := sha256.New()
+	chunk := make([]byte, options.ChunkSize)
+	for {
+		n, err := io.ReadFull(r, chunk)
+		if n > 0 {
+			h.Write(chunk[:n])
+			if err := writeChunk(client, table, pk, info.Chunks, chunk[:n], &options); err != nil {
+				return nil, err
+			}
+			info.Size += int64(n)
+			info.Chunks++
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	info.Checksum = hex.EncodeToString(h.Sum(nil))
+
+	change := &tablestore.UpdateRowChange{TableName: table, PrimaryKey: pk}
+	if options.Layout == Rows {
+		change.PrimaryKey = options.rowKey(pk, 0)
+	}
+	change.PutColumn(options.sizeName(), info.Size)
+	change.PutColumn(options.chunksName(), int64(info.Chunks))
+	change.PutColumn(options.checksumName(), info.Checksum)
+	if options.Layout == Columns {
+		for i := info.Chunks; i < former.Chunks; i++ {
+			change.DeleteColumn(options.chunkName(i))
+		}
+	}
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	if _, err := client.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: change}); err != nil {
+		return nil, err
+	}
+	if options.Layout == Rows {
+		if err := deleteRows(client, table, pk, info.Chunks+1, former.Chunks+1, &options); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// writeChunk writes the i-th chunk of a blob.
+func writeChunk(client tablestore.TableStoreApi, table string, pk *tablestore.PrimaryKey, i int, data []byte, options *Options) error {
+	if options.Layout == Rows {
+		change := &tablestore.PutRowChange{TableName: table, PrimaryKey: options.rowKey(pk, i+1)}
+		change.AddColumn("data", data)
+		change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		_, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: change})
+		return err
+	}
+	change := &tablestore.UpdateRowChange{TableName: table, PrimaryKey: pk}
+	change.PutColumn(options.chunkName(i), data)
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	_, err := client.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: change})
+	return err
+}
+
+// deleteRows deletes the rows numbered from start to end excluded.
+func deleteRows(client tablestore.TableStoreApi, table string, pk *tablestore.PrimaryKey, start, end int, options *Options) error {
+	for start < end {
+		request := new(tablestore.BatchWriteRowRequest)
+		for ; start < end && len(request.RowChangesGroupByTable[table]) < 200; start++ {
+			change := &tablestore.DeleteRowChange{TableName: table, PrimaryKey: options.rowKey(pk, start)}
+			change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+			request.AddRowChange(change)
+		}
+		resp, err := client.BatchWriteRow(request)
+		if err != nil {
+			return err
+		}
+		if failed := resp.FailedRows(); len(failed) > 0 {
+			return fmt.Errorf("%s %s %s", failed[0].Error.Code, failed[0].Error.Message, resp.RequestId)
+		}
+	}
+	return nil
+}
+
+// Delete deletes the blob of pk, ErrNotFound if it is missing. With the
+// Columns layout, the other columns of its row are kept.
+func Delete(client tablestore.TableStoreApi, table string, pk *tablestore.PrimaryKey, options Options) error {
+	if err := options.defaults(); err != nil {
+		return err
+	}
+	info, err := stat(client, table, pk, &options)
+	if err != nil {
+		return err
+	}
+	if options.Layout == Rows {
+		// the description is deleted with the first chunks, the blob is
+		// gone even if deleting the others fails
+		return deleteRows(client, table, pk, 0, info.Chunks+1, &options)
+	}
+	change := &tablestore.UpdateRowChange{TableName: table, PrimaryKey: pk}
+	for _, name := range []string{options.sizeName(), options.chunksName(), options.checksumName()} {
+		change.DeleteColumn(name)
+	}
+	for i := 0; i < info.Chunks; i++ {
+		change.DeleteColumn(options.chunkName(i))
+	}
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	_, err = client.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: change})
+	return err
+}
+
+// Read returns a reader of the blob of pk, ErrNotFound if it is missing. The
+// reader reads a chunk at a time, and returns an error instead of io.EOF if
+// the blob read does not match its checksum.
+func Read(client tablestore.TableStoreApi, table string, pk *tablestore.PrimaryKey, options Options) (io.Reader, error) {
+	if err := options.defaults(); err != nil {
+		return nil, err
+	}
+	info, err := stat(client, table, pk, &options)
+	if err != nil {
+		return nil, err
+	}
+	r := &reader{info: info, hash: sha256.New()}
+	if info.Chunks == 0 {
+		r.chunks = &rowChunks{done: true}
+	} else if options.Layout == Rows {
+		r.chunks = &rowChunks{client: client, criteria: &tablestore.RangeRowQueryCriteria{TableName: table,
+			StartPrimaryKey: options.rowKey(pk, 1), EndPrimaryKey: options.rowKey(pk, info.Chunks+1),
+			ColumnsToGet: []string{"data"}, MaxVersion: 1, Limit: 1}}
+	} else {
+		criteria := &tablestore.SingleRowQueryCriteria{TableName: table, PrimaryKey: pk, MaxVersion: 1}
+		criteria.SetStartColumn(options.chunkName(0))
+		criteria.SetEndtColumn(options.chunkName(info.Chunks))
+		r.chunks = tablestore.NewColumnIterator(client, criteria, 1)
+	}
+	return r, nil
+}
+
+// chunks iterates the chunks of a blob.
+type chunks interface {
+	Next() (*tablestore.AttributeColumn, error)
+}
+
+// rowChunks iterates the chunks of the Rows layout, a row at a time.
+type rowChunks struct {
+	client   tablestore.TableStoreApi
+	criteria *tablestore.RangeRowQueryCriteria
+	rows     []*tablestore.Row
+	done     bool
+}
+
+func (chunks *rowChunks) Next() (*tablestore.AttributeColumn, error) {
+	for len(chunks.rows) == 0 {
+		if chunks.done {
+			return nil, io.EOF
+		}
+		resp, err := chunks.client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: chunks.criteria})
+		if err != nil {
+			return nil, err
+		}
+		chunks.rows = resp.Rows
+		if resp.NextStartPrimaryKey == nil {
+			chunks.done = true
+		} else {
+			chunks.criteria.StartPrimaryKey = resp.NextStartPrimaryKey
+		}
+	}
+	row := chunks.rows[0]
+	chunks.rows = chunks.rows[1:]
+	if len(row.Columns) != 1 {
+		return nil, fmt.Errorf("[tablestore] chunk row of blob without data")
+	}
+	return row.Columns[0], nil
+}
+
+type reader struct {
+	info   *Info
+	chunks chunks
+	chunk  []byte
+	hash   hash.Hash
+	size   int64
+	read   int
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		column, err := r.chunks.Next()
+		if err == io.EOF {
+			if r.read != r.info.Chunks || r.size != r.info.Size || hex.EncodeToString(r.hash.Sum(nil)) != r.info.Checksum {
+				return 0, fmt.Errorf("[tablestore] blob corrupted: %d bytes in %d chunks read, %d bytes in %d chunks of checksum %s expected",
+					r.size, r.read, r.info.Size, r.info.Chunks, r.info.Checksum)
+			}
+			return 0, io.EOF
+		} else if err != nil {
+			return 0, err
+		}
+		data, ok := column.Value.([]byte)
+		if !ok {
+			return 0, fmt.Errorf("[tablestore] chunk %s of blob is a %T", column.ColumnName, column.Value)
+		}
+		r.chunk = data
+		r.hash.Write(data)
+		r.size += int64(len(data))
+		r.read++
+	}
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
@@ -0,0 +1,135 @@
+package blob
+
+import (
+	"bytes"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func createTable(t *testing.T, client tablestore.TableStoreApi, name string, chunk bool) {
+	meta := &tablestore.TableMeta{TableName: name}
+	meta.AddPrimaryKeyColumn("name", tablestore.PrimaryKeyType_STRING)
+	if chunk {
+		meta.AddPrimaryKeyColumn("chunk", tablestore.PrimaryKeyType_INTEGER)
+	}
+	_, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func name(v string) *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn("name", v)
+	return pk
+}
+
+func TestBlob(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	server.Store.RangeLimit = 3
+	client := server.NewTableStoreClient()
+	createTable(t, client, "files", false)
+	createTable(t, client, "chunks", true)
+	data := []byte(strings.Repeat("0123456789abcdef", 10) + "xyz")
+
+	for _, test := range []struct {
+		table   string
+		options Options
+	}{
+		{"files", Options{ChunkSize: 16}},
+		{"chunks", Options{Layout: Rows, ChunkColumn: "chunk", ChunkSize: 16}},
+	} {
+		if _, err := Read(client, test.table, name("a"), test.options); err != ErrNotFound {
+			t.Fatalf("%s: expect not found: %v", test.table, err)
+		}
+		info, err := Write(client, test.table, name("a"), bytes.NewReader(data), test.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size != 163 || info.Chunks != 11 || len(info.Checksum) != 64 {
+			t.Errorf("%s: written %+v", test.table, info)
+		}
+		if _, err := Write(client, test.table, name("b"), bytes.NewReader(nil), test.options); err != nil {
+			t.Fatal(err)
+		}
+		for _, blob := range []struct {
+			name string
+			data []byte
+		}{{"a", data}, {"b", nil}} {
+			r, err := Read(client, test.table, name(blob.name), test.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			read, err := ioutil.ReadAll(r)
+			if err != nil || !bytes.Equal(read, blob.data) {
+				t.Errorf("%s: read %q: %q, %v", test.table, blob.name, read, err)
+			}
+		}
+
+		// overwritten by a smaller blob, the former chunks are deleted
+		if info, err = Write(client, test.table, name("a"), bytes.NewReader(data[:40]), test.options); err != nil || info.Chunks != 3 {
+			t.Fatalf("%s: overwritten %+v, %v", test.table, info, err)
+		}
+		r, _ := Read(client, test.table, name("a"), test.options)
+		if read, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(read, data[:40]) {
+			t.Errorf("%s: read overwritten: %q, %v", test.table, read, err)
+		}
+		row := new(tablestore.SingleRowQueryCriteria)
+		row.TableName, row.MaxVersion = test.table, 1
+		if test.options.Layout == Rows {
+			row.PrimaryKey = test.options.rowKey(name("a"), 4)
+		} else {
+			row.PrimaryKey = name("a")
+		}
+		resp, err := client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: row})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.options.Layout == Rows && len(resp.PrimaryKey.PrimaryKeys) != 0 || test.options.Layout == Columns && len(resp.Columns) != 6 {
+			t.Errorf("%s: former chunks left: %v", test.table, resp.Columns)
+		}
+
+		// a chunk corrupted
+		options := test.options
+		options.defaults()
+		if test.options.Layout == Rows {
+			change := &tablestore.PutRowChange{TableName: test.table, PrimaryKey: options.rowKey(name("a"), 2)}
+			change.AddColumn("data", []byte("corrupted"))
+			change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+			_, err = client.PutRow(&tablestore.PutRowRequest{PutRowChange: change})
+		} else {
+			change := &tablestore.UpdateRowChange{TableName: test.table, PrimaryKey: name("a")}
+			change.PutColumn(options.chunkName(1), []byte("corrupted"))
+			change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+			_, err = client.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: change})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, _ = Read(client, test.table, name("a"), test.options)
+		if _, err := ioutil.ReadAll(r); err == nil || !strings.Contains(err.Error(), "blob corrupted") {
+			t.Errorf("%s: expect corruption: %v", test.table, err)
+		}
+
+		if err := Delete(client, test.table, name("a"), test.options); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Stat(client, test.table, name("a"), test.options); err != ErrNotFound {
+			t.Errorf("%s: expect deleted: %v", test.table, err)
+		}
+		if err := Delete(client, test.table, name("a"), test.options); err != ErrNotFound {
+			t.Errorf("%s: expect not found: %v", test.table, err)
+		}
+	}
+
+	if _, err := Write(client, "chunks", name("a"), bytes.NewReader(data), Options{Layout: Rows}); err == nil {
+		t.Error("expect chunk column missing")
+	}
+	if _, err := Write(client, "files", name("a"), bytes.NewReader(data), Options{ChunkSize: 3 << 20}); err == nil {
+		t.Error("expect chunk size too large")
+	}
+}
@@ -0,0 +1,290 @@
+// Package bucket partitions a logical table of timed rows, such as events or
+// logs, over tables of a time period each, e.g. events_202501, events_202502,
+// so that expired rows are dropped a table at a time instead of row by row
+// by the TTL of the table:
+//
+//	router := bucket.New(client, bucket.Config{Prefix: "events", Period: bucket.Month, Retention: 12, TableMeta: meta})
+//	err := router.CreateBuckets(time.Now(), 1) // the tables of this month and the next
+//	change, err := router.Route(change, event.Time)
+//	rows, err := router.GetRange(criteria, from, to)
+//	dropped, err := router.DropExpired(time.Now())
+//
+// CreateBuckets and DropExpired are meant to run periodically, e.g. daily.
+package bucket
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Period is the time period of the rows of a table.
+type Period int
+
+const (
+	Hour Period = iota
+	Day
+	Month
+)
+
+// layout returns the layout of the suffix of the tables of the period.
+func (period Period) layout() string {
+	switch period {
+	case Hour:
+		return "2006010215"
+	case Day:
+		return "20060102"
+	}
+	return "200601"
+}
+
+// start returns the start of the period of t.
+func (period Period) start(t time.Time) time.Time {
+	switch period {
+	case Hour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	case Day:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// add returns the start of the nth period after the one starting at start.
+func (period Period) add(start time.Time, n int) time.Time {
+	switch period {
+	case Hour:
+		return start.Add(time.Duration(n) * time.Hour)
+	case Day:
+		return start.AddDate(0, 0, n)
+	}
+	return start.AddDate(0, n, 0)
+}
+
+type Config struct {
+	// tables are named Prefix_suffix, the suffix being the period of their
+	// rows, e.g. events_20250114 for the rows of a day
+	Prefix string
+	Period Period
+	// time zone of the periods, UTC if nil
+	Location *time.Location
+	// number of periods kept by DropExpired, the current one included; all
+	// of them if 0
+	Retention int
+	// schema of the tables created, their name ignored
+	TableMeta          *tablestore.TableMeta
+	TableOption        *tablestore.TableOption
+	ReservedThroughput *tablestore.ReservedThroughput
+}
+
+// Router routes rows to the tables of their periods. It is safe for
+// concurrent use.
+type Router struct {
+	client tablestore.TableStoreApi
+	config Config
+}
+
+func New(client tablestore.TableStoreApi, config Config) *Router {
+	if config.Location == nil {
+		config.Location = time.UTC
+	}
+	if config.TableOption == nil {
+		config.TableOption = tablestore.NewTableOption(-1, 1)
+	}
+	if config.ReservedThroughput == nil {
+		config.ReservedThroughput = &tablestore.ReservedThroughput{}
+	}
+	return &Router{client: client, config: config}
+}
+
+// Table returns the table of the rows of time t.
+func (router *Router) Table(t time.Time) string {
+	return router.config.Prefix + "_" + t.In(router.config.Location).Format(router.config.Period.layout())
+}
+
+// Start returns the start of the period of the rows of table, and false if it
+// is not a table of the router.
+func (router *Router) Start(table string) (time.Time, bool) {
+	if !strings.HasPrefix(table, router.config.Prefix+"_") {
+		return time.Time{}, false
+	}
+	start, err := time.ParseInLocation(router.config.Period.layout(), table[len(router.config.Prefix)+1:], router.config.Location)
+	return start, err == nil
+}
+
+// Tables returns the tables of the rows between from, included, and to,
+// excluded, in time order.
+func (router *Router) Tables(from, to time.Time) []string {
+	var tables []string
+	period := router.config.Period
+	for start := period.start(from.In(router.config.Location)); start.Before(to); start = period.add(start, 1) {
+		tables = append(tables, router.Table(start))
+	}
+	return tables
+}
+
+// Route returns a copy of change writing to the table of time t.
+func (router *Router) Route(change tablestore.RowChange, t time.Time) (tablestore.RowChange, error) {
+	table := router.Table(t)
+	switch change := change.(type) {
+	case *tablestore.PutRowChange:
+		routed := *change
+		routed.TableName = table
+		return &routed, nil
+	case *tablestore.UpdateRowChange:
+		routed := *change
+		routed.TableName = table
+		return &routed, nil
+	case *tablestore.DeleteRowChange:
+		routed := *change
+		routed.TableName = table
+		return &routed, nil
+	}
+	return nil, fmt.Errorf("[tablestore] unsupported row change %T", change)
+}
+
+// existing returns the tables of the router which exist, sorted by time.
+func (router *Router) existing() ([]string, error) {
+	resp, err := router.client.ListTable()
+	if err != nil {
+		return nil, err
+	}
+	var tables []string
+	for _, table := range resp.TableNames {
+		if _, ok := router.Start(table); ok {
+			tables = append(tables, table)
+		}
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		a, _ := router.Start(tables[i])
+		b, _ := router.Start(tables[j])
+		return a.Before(b)
+	})
+	return tables, nil
+}
+
+// CreateBuckets creates the table of the period of now and those of the
+// ahead periods after it, those which do not exist yet. It returns the tables
+// created.
+func (router *Router) CreateBuckets(now time.Time, ahead int) ([]string, error) {
+	if router.config.TableMeta == nil {
+		return nil, fmt.Errorf("[tablestore] missing table meta of %s", router.config.Prefix)
+	}
+	existing, err := router.existing()
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[string]bool, len(existing))
+	for _, table := range existing {
+		exists[table] = true
+	}
+	var created []string
+	start := router.config.Period.start(now.In(router.config.Location))
+	for i := 0; i <= ahead; i++ {
+		table := router.Table(router.config.Period.add(start, i))
+		if exists[table] {
+			continue
+		}
+		meta := *router.config.TableMeta
+		meta.TableName = table
+		request := &tablestore.CreateTableRequest{TableMeta: &meta, TableOption: router.config.TableOption, ReservedThroughput: router.config.ReservedThroughput}
+		if _, err := router.client.CreateTable(request); err != nil {
+			return created, err
+		}
+		created = append(created, table)
+	}
+	return created, nil
+}
+
+// DropExpired deletes the tables of the periods before the Retention last
+// periods of now. It returns the tables deleted.
+func (router *Router) DropExpired(now time.Time) ([]string, error) {
+	if router.config.Retention <= 0 {
+		return nil, nil
+	}
+	existing, err := router.existing()
+	if err != nil {
+		return nil, err
+	}
+	oldest := router.config.Period.add(router.config.Period.start(now.In(router.config.Location)), 1-router.config.Retention)
+	var dropped []string
+	for _, table := range existing {
+		if start, _ := router.Start(table); !start.Before(oldest) {
+			break
+		}
+		if _, err := router.client.DeleteTable(&tablestore.DeleteTableRequest{TableName: table}); err != nil {
+			return dropped, err
+		}
+		dropped = append(dropped, table)
+	}
+	return dropped, nil
+}
+
+// GetRange reads the rows between the start and end primary keys of criteria
+// in the existing tables of the rows between from and to, its table name
+// ignored, querying them in parallel. Rows are returned table by table, in
+// the time order of criteria.Direction, each table's in the order of their
+// primary keys, at most criteria.Limit of them if it is positive.
+func (router *Router) GetRange(criteria *tablestore.RangeRowQueryCriteria, from, to time.Time) ([]*tablestore.Row, error) {
+	existing, err := router.existing()
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[string]bool, len(existing))
+	for _, table := range existing {
+		exists[table] = true
+	}
+	var tables []string
+	for _, table := range router.Tables(from, to) {
+		if exists[table] {
+			tables = append(tables, table)
+		}
+	}
+	if criteria.Direction == tablestore.BACKWARD {
+		for i, j := 0, len(tables)-1; i < j; i, j = i+1, j-1 {
+			tables[i], tables[j] = tables[j], tables[i]
+		}
+	}
+
+	results := make([][]*tablestore.Row, len(tables))
+	errs := make([]error, len(tables))
+	var wg sync.WaitGroup
+	for i, table := range tables {
+		wg.Add(1)
+		go func(i int, table string) {
+			defer wg.Done()
+			results[i], errs[i] = getRange(router.client, criteria, table)
+		}(i, table)
+	}
+	wg.Wait()
+	var rows []*tablestore.Row
+	for i := range tables {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		rows = append(rows, results[i]...)
+	}
+	if criteria.Limit > 0 && len(rows) > int(criteria.Limit) {
+		rows = rows[:criteria.Limit]
+	}
+	return rows, nil
+}
+
+func getRange(client tablestore.TableStoreApi, criteria *tablestore.RangeRowQueryCriteria, table string) ([]*tablestore.Row, error) {
+	tableCriteria := *criteria
+	tableCriteria.TableName = table
+	var rows []*tablestore.Row
+	for {
+		resp, err := client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: &tableCriteria})
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, resp.Rows...)
+		if resp.NextStartPrimaryKey == nil || (criteria.Limit > 0 && len(rows) >= int(criteria.Limit)) {
+			return rows, nil
+		}
+		tableCriteria.StartPrimaryKey = resp.NextStartPrimaryKey
+	}
+}
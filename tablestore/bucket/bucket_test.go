@@ -0,0 +1,104 @@
+package bucket
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 12, 0, 0, 0, time.UTC)
+}
+
+func tables(t *testing.T, client tablestore.TableStoreApi) []string {
+	resp, err := client.ListTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(resp.TableNames)
+	return resp.TableNames
+}
+
+func TestRouter(t *testing.T) {
+	client := tablestoretest.NewClient()
+	client.RangeLimit = 2
+	meta := &tablestore.TableMeta{}
+	meta.AddPrimaryKeyColumn("id", tablestore.PrimaryKeyType_INTEGER)
+	router := New(client, Config{Prefix: "events", Period: Month, Retention: 2, TableMeta: meta})
+
+	if table := router.Table(date(2025, 1, 31)); table != "events_202501" {
+		t.Errorf("table %s", table)
+	}
+	if start, ok := router.Start("events_202502"); !ok || !start.Equal(time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("start %v, %v", start, ok)
+	}
+	if _, ok := router.Start("events_2025"); ok {
+		t.Errorf("expect invalid table")
+	}
+	if got := router.Tables(date(2024, 12, 31), date(2025, 2, 1)); !reflect.DeepEqual(got, []string{"events_202412", "events_202501", "events_202502"}) {
+		t.Errorf("tables %v", got)
+	}
+	daily := New(client, Config{Prefix: "logs", Period: Day, Location: time.FixedZone("UTC+8", 8*3600)})
+	if table := daily.Table(time.Date(2025, 1, 14, 20, 0, 0, 0, time.UTC)); table != "logs_20250115" {
+		t.Errorf("daily table %s", table)
+	}
+
+	created, err := router.CreateBuckets(date(2025, 1, 10), 1)
+	if err != nil || !reflect.DeepEqual(created, []string{"events_202501", "events_202502"}) {
+		t.Fatalf("created %v, %v", created, err)
+	}
+	if created, err = router.CreateBuckets(date(2025, 2, 10), 1); err != nil || !reflect.DeepEqual(created, []string{"events_202503"}) {
+		t.Fatalf("created %v, %v", created, err)
+	}
+
+	for i, at := range []time.Time{date(2025, 1, 5), date(2025, 1, 20), date(2025, 2, 3), date(2025, 2, 4), date(2025, 2, 5), date(2025, 3, 1)} {
+		pk := new(tablestore.PrimaryKey)
+		pk.AddPrimaryKeyColumn("id", int64(i))
+		change := &tablestore.PutRowChange{TableName: "events", PrimaryKey: pk}
+		change.AddColumn("at", at.Unix())
+		change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		routed, err := router.Route(change, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: routed.(*tablestore.PutRowChange)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if change, _ := router.Route(&tablestore.DeleteRowChange{TableName: "events"}, date(2025, 2, 1)); change.GetTableName() != "events_202502" {
+		t.Errorf("routed to %s", change.GetTableName())
+	}
+
+	criteria := &tablestore.RangeRowQueryCriteria{StartPrimaryKey: new(tablestore.PrimaryKey), EndPrimaryKey: new(tablestore.PrimaryKey), Direction: tablestore.FORWARD, MaxVersion: 1}
+	criteria.StartPrimaryKey.AddPrimaryKeyColumnWithMinValue("id")
+	criteria.EndPrimaryKey.AddPrimaryKeyColumnWithMaxValue("id")
+	ids := func(rows []*tablestore.Row) []int64 {
+		var ids []int64
+		for _, row := range rows {
+			ids = append(ids, row.PrimaryKey.PrimaryKeys[0].Value.(int64))
+		}
+		return ids
+	}
+	// the table of December does not exist
+	rows, err := router.GetRange(criteria, date(2024, 12, 1), date(2025, 2, 10))
+	if err != nil || !reflect.DeepEqual(ids(rows), []int64{0, 1, 2, 3, 4}) {
+		t.Errorf("rows %v, %v", ids(rows), err)
+	}
+	criteria.StartPrimaryKey, criteria.EndPrimaryKey = criteria.EndPrimaryKey, criteria.StartPrimaryKey
+	criteria.Direction, criteria.Limit = tablestore.BACKWARD, 3
+	rows, err = router.GetRange(criteria, date(2025, 1, 1), date(2025, 3, 2))
+	if err != nil || !reflect.DeepEqual(ids(rows), []int64{5, 4, 3}) {
+		t.Errorf("backward rows %v, %v", ids(rows), err)
+	}
+
+	dropped, err := router.DropExpired(date(2025, 3, 15))
+	if err != nil || !reflect.DeepEqual(dropped, []string{"events_202501"}) {
+		t.Errorf("dropped %v, %v", dropped, err)
+	}
+	if got := tables(t, client); !reflect.DeepEqual(got, []string{"events_202502", "events_202503"}) {
+		t.Errorf("tables %v", got)
+	}
+}
@@ -0,0 +1,161 @@
+package tablestore
+
+// The constructors, setters and getters below build and read the public
+// structs holding pointers, so that they can be used without taking the
+// address of values or dereferencing fields which may be nil.
+
+func NewPrimaryKeySchema(name string, keyType PrimaryKeyType) *PrimaryKeySchema {
+	return &PrimaryKeySchema{Name: &name, Type: &keyType}
+}
+
+// SetOption sets the option of the column, e.g. AUTO_INCREMENT.
+func (schema *PrimaryKeySchema) SetOption(option PrimaryKeyOption) *PrimaryKeySchema {
+	schema.Option = &option
+	return schema
+}
+
+func (schema *PrimaryKeySchema) GetName() string {
+	if schema.Name == nil {
+		return ""
+	}
+	return *schema.Name
+}
+
+// GetType returns the type of the column, 0 if it is not set.
+func (schema *PrimaryKeySchema) GetType() PrimaryKeyType {
+	if schema.Type == nil {
+		return 0
+	}
+	return *schema.Type
+}
+
+// GetOption returns the option of the column, false if it has none.
+func (schema *PrimaryKeySchema) GetOption() (PrimaryKeyOption, bool) {
+	if schema.Option == nil {
+		return NONE, false
+	}
+	return *schema.Option, true
+}
+
+func (condition *SingleColumnCondition) GetColumnName() string {
+	if condition.ColumnName == nil {
+		return ""
+	}
+	return *condition.ColumnName
+}
+
+func (condition *SingleColumnCondition) GetComparator() ComparatorType {
+	if condition.Comparator == nil {
+		return 0
+	}
+	return *condition.Comparator
+}
+
+// NewColumnPaginationFilter returns a filter of the columns of rows, reading
+// limit columns from the offset-th.
+func NewColumnPaginationFilter(offset, limit int32) *PaginationFilter {
+	return &PaginationFilter{Offset: offset, Limit: limit}
+}
+
+func (rowQueryCriteria *SingleRowQueryCriteria) SetEndColumn(columnName string) {
+	if !rowQueryCriteria.frozen.check() {
+		return
+	}
+	rowQueryCriteria.EndColumn = &columnName
+}
+
+func (rowQueryCriteria *MultiRowQueryCriteria) SetStartColumn(columnName string) {
+	if !rowQueryCriteria.frozen.check() {
+		return
+	}
+	rowQueryCriteria.StartColumn = &columnName
+}
+
+func (rowQueryCriteria *MultiRowQueryCriteria) SetEndColumn(columnName string) {
+	if !rowQueryCriteria.frozen.check() {
+		return
+	}
+	rowQueryCriteria.EndColumn = &columnName
+}
+
+func (rowQueryCriteria *RangeRowQueryCriteria) SetStartColumn(columnName string) {
+	if !rowQueryCriteria.frozen.check() {
+		return
+	}
+	rowQueryCriteria.StartColumn = &columnName
+}
+
+func (rowQueryCriteria *RangeRowQueryCriteria) SetEndColumn(columnName string) {
+	if !rowQueryCriteria.frozen.check() {
+		return
+	}
+	rowQueryCriteria.EndColumn = &columnName
+}
+
+func NewListStreamRequest(tableName string) *ListStreamRequest {
+	return &ListStreamRequest{TableName: &tableName}
+}
+
+func (request *DescribeStreamRequest) SetShardLimit(limit int32) {
+	request.ShardLimit = &limit
+}
+
+// SetTimestamp sets the time, in milliseconds, from which the records of the
+// shard are read.
+func (request *GetShardIteratorRequest) SetTimestamp(timestamp int64) {
+	request.Timestamp = &timestamp
+}
+
+func (stream *Stream) GetTableName() string {
+	if stream.TableName == nil {
+		return ""
+	}
+	return *stream.TableName
+}
+
+func NewFieldSchema(fieldName string, fieldType FieldType) *FieldSchema {
+	return &FieldSchema{FieldName: &fieldName, FieldType: fieldType}
+}
+
+func (fs *FieldSchema) SetIndex(index bool) *FieldSchema {
+	fs.Index = &index
+	return fs
+}
+
+func (fs *FieldSchema) SetIndexOptions(options IndexOptions) *FieldSchema {
+	fs.IndexOptions = &options
+	return fs
+}
+
+func (fs *FieldSchema) SetAnalyzer(analyzer Analyzer) *FieldSchema {
+	fs.Analyzer = &analyzer
+	return fs
+}
+
+func (fs *FieldSchema) SetEnableSortAndAgg(enable bool) *FieldSchema {
+	fs.EnableSortAndAgg = &enable
+	return fs
+}
+
+func (fs *FieldSchema) SetStore(store bool) *FieldSchema {
+	fs.Store = &store
+	return fs
+}
+
+func (fs *FieldSchema) SetIsArray(isArray bool) *FieldSchema {
+	fs.IsArray = &isArray
+	return fs
+}
+
+// AddFieldSchema adds a sub field of a NESTED field.
+func (fs *FieldSchema) AddFieldSchema(field *FieldSchema) *FieldSchema {
+	fs.FieldSchemas = append(fs.FieldSchemas, field)
+	return fs
+}
+
+func (fs *FieldSchema) GetFieldName() string {
+	if fs.FieldName == nil {
+		return ""
+	}
+	return *fs.FieldName
+}
@@ -0,0 +1,272 @@
+// Package cache provides a read-through row cache in front of a
+// tablestore.TableStoreApi, to relieve hot keys:
+//
+//	client := cache.New(tablestore.NewClient(endpoint, instance, id, secret), cache.Config{
+//		TTL:     time.Minute,
+//		Backend: cache.NewLRU(100000),
+//	})
+//
+// GetRow and BatchGetRow reading the latest version of rows, without filter,
+// time range nor column range, are answered from the cache. Misses read whole
+// rows, which are cached and projected on the requested columns. Rows written
+// by PutRow, UpdateRow, DeleteRow and BatchWriteRow through the client are
+// invalidated, successful or not; rows written by other clients stay stale up
+// to TTL. Other methods are passed through.
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"sync/atomic"
+	"time"
+)
+
+type Config struct {
+	// time to live of cached rows, forever if 0
+	TTL time.Duration
+	// NewLRU(10000) by default
+	Backend Backend
+	// prefix of the keys of the backend, for backends shared by several
+	// caches
+	KeyPrefix string
+	// cached tables, all of them if empty
+	Tables []string
+}
+
+// Client is a tablestore.TableStoreApi caching the rows read through it. It
+// is safe for concurrent use if the wrapped client and the backend are.
+type Client struct {
+	tablestore.TableStoreApi
+	config Config
+	tables map[string]bool
+
+	hits   int64
+	misses int64
+}
+
+var _ tablestore.TableStoreApi = (*Client)(nil)
+
+func New(client tablestore.TableStoreApi, config Config) *Client {
+	if config.Backend == nil {
+		config.Backend = NewLRU(10000)
+	}
+	cache := &Client{TableStoreApi: client, config: config}
+	if len(config.Tables) > 0 {
+		cache.tables = make(map[string]bool)
+		for _, table := range config.Tables {
+			cache.tables[table] = true
+		}
+	}
+	return cache
+}
+
+// Stats returns the number of rows answered from the cache, and read from
+// the wrapped client.
+func (cache *Client) Stats() (hits, misses int64) {
+	return atomic.LoadInt64(&cache.hits), atomic.LoadInt64(&cache.misses)
+}
+
+// entry is a cached row, without columns if the row does not exist.
+type entry struct {
+	PrimaryKey []*tablestore.PrimaryKeyColumn
+	Columns    []*tablestore.AttributeColumn
+}
+
+func (cache *Client) cached(table string) bool {
+	return cache.tables == nil || cache.tables[table]
+}
+
+func (cache *Client) key(table string, pk *tablestore.PrimaryKey) string {
+	return cache.config.KeyPrefix + table + "\x00" + string(pk.Build(false))
+}
+
+func (cache *Client) get(key string) (*entry, bool) {
+	data, ok := cache.config.Backend.Get(key)
+	if !ok {
+		return nil, false
+	}
+	row := new(entry)
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(row); err != nil {
+		return nil, false
+	}
+	return row, true
+}
+
+func (cache *Client) set(key string, row *entry) {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(row); err != nil {
+		return
+	}
+	cache.config.Backend.Set(key, b.Bytes(), cache.config.TTL)
+}
+
+func (cache *Client) invalidate(table string, pk *tablestore.PrimaryKey) {
+	if pk != nil && cache.cached(table) {
+		cache.config.Backend.Delete(cache.key(table, pk))
+	}
+}
+
+// project returns the columns among names, all of them if names is empty.
+func project(columns []*tablestore.AttributeColumn, names []string) []*tablestore.AttributeColumn {
+	if len(names) == 0 {
+		return columns
+	}
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+	var projected []*tablestore.AttributeColumn
+	for _, column := range columns {
+		if wanted[column.ColumnName] {
+			projected = append(projected, column)
+		}
+	}
+	return projected
+}
+
+func cacheable(maxVersion int, timeRange *tablestore.TimeRange, filter tablestore.ColumnFilter, startColumn, endColumn *string) bool {
+	return maxVersion == 1 && timeRange == nil && filter == nil && startColumn == nil && endColumn == nil
+}
+
+func (cache *Client) GetRow(request *tablestore.GetRowRequest) (*tablestore.GetRowResponse, error) {
+	criteria := request.SingleRowQueryCriteria
+	if !cache.cached(criteria.TableName) ||
+		!cacheable(int(criteria.MaxVersion), criteria.TimeRange, criteria.Filter, criteria.StartColumn, criteria.EndColumn) {
+		return cache.TableStoreApi.GetRow(request)
+	}
+	key := cache.key(criteria.TableName, criteria.PrimaryKey)
+	if row, ok := cache.get(key); ok {
+		atomic.AddInt64(&cache.hits, 1)
+		response := &tablestore.GetRowResponse{ConsumedCapacityUnit: &tablestore.ConsumedCapacityUnit{}}
+		response.PrimaryKey.PrimaryKeys = row.PrimaryKey
+		response.Columns = project(row.Columns, criteria.ColumnsToGet)
+		return response, nil
+	}
+
+	atomic.AddInt64(&cache.misses, 1)
+	whole := *criteria
+	whole.ColumnsToGet = nil
+	response, err := cache.TableStoreApi.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: &whole})
+	if err != nil {
+		return nil, err
+	}
+	cache.set(key, &entry{PrimaryKey: response.PrimaryKey.PrimaryKeys, Columns: response.Columns})
+	response.Columns = project(response.Columns, criteria.ColumnsToGet)
+	return response, nil
+}
+
+func (cache *Client) BatchGetRow(request *tablestore.BatchGetRowRequest) (*tablestore.BatchGetRowResponse, error) {
+	type lookup struct {
+		criteria *tablestore.MultiRowQueryCriteria
+		keys     []string
+		// rows found in the cache, nil for misses
+		rows []*entry
+	}
+	lookups := make([]*lookup, len(request.MultiRowQueryCriteria))
+	missed := new(tablestore.BatchGetRowRequest)
+	for i, criteria := range request.MultiRowQueryCriteria {
+		if !cache.cached(criteria.TableName) ||
+			!cacheable(criteria.MaxVersion, criteria.TimeRange, criteria.Filter, criteria.StartColumn, criteria.EndColumn) {
+			missed.MultiRowQueryCriteria = append(missed.MultiRowQueryCriteria, criteria)
+			continue
+		}
+		l := &lookup{criteria: criteria, keys: make([]string, len(criteria.PrimaryKey)), rows: make([]*entry, len(criteria.PrimaryKey))}
+		whole := *criteria
+		whole.ColumnsToGet = nil
+		whole.PrimaryKey = nil
+		for j, pk := range criteria.PrimaryKey {
+			l.keys[j] = cache.key(criteria.TableName, pk)
+			if row, ok := cache.get(l.keys[j]); ok {
+				atomic.AddInt64(&cache.hits, 1)
+				l.rows[j] = row
+			} else {
+				atomic.AddInt64(&cache.misses, 1)
+				whole.PrimaryKey = append(whole.PrimaryKey, pk)
+			}
+		}
+		if len(whole.PrimaryKey) > 0 {
+			missed.MultiRowQueryCriteria = append(missed.MultiRowQueryCriteria, &whole)
+		}
+		lookups[i] = l
+	}
+
+	fetched := &tablestore.BatchGetRowResponse{TableToRowsResult: make(map[string][]tablestore.RowResult)}
+	if len(missed.MultiRowQueryCriteria) > 0 {
+		var err error
+		if fetched, err = cache.TableStoreApi.BatchGetRow(missed); err != nil {
+			return nil, err
+		}
+	}
+
+	// the rows of the response are in the order of the request, table by
+	// table
+	response := &tablestore.BatchGetRowResponse{TableToRowsResult: make(map[string][]tablestore.RowResult), ResponseInfo: fetched.ResponseInfo}
+	next := make(map[string]int)
+	take := func(table string) (tablestore.RowResult, bool) {
+		rows := fetched.TableToRowsResult[table]
+		if next[table] >= len(rows) {
+			return tablestore.RowResult{}, false
+		}
+		next[table]++
+		return rows[next[table]-1], true
+	}
+	for i, criteria := range request.MultiRowQueryCriteria {
+		table := criteria.TableName
+		l := lookups[i]
+		for j := range criteria.PrimaryKey {
+			index := int32(len(response.TableToRowsResult[table]))
+			var result tablestore.RowResult
+			if l != nil && l.rows[j] != nil {
+				result = tablestore.RowResult{TableName: table, IsSucceed: true, ConsumedCapacityUnit: &tablestore.ConsumedCapacityUnit{}}
+				result.PrimaryKey.PrimaryKeys = l.rows[j].PrimaryKey
+				result.Columns = project(l.rows[j].Columns, criteria.ColumnsToGet)
+			} else {
+				var ok bool
+				if result, ok = take(table); !ok {
+					continue
+				}
+				if l != nil && result.IsSucceed {
+					cache.set(l.keys[j], &entry{PrimaryKey: result.PrimaryKey.PrimaryKeys, Columns: result.Columns})
+					result.Columns = project(result.Columns, criteria.ColumnsToGet)
+				}
+			}
+			result.Index = index
+			response.TableToRowsResult[table] = append(response.TableToRowsResult[table], result)
+		}
+	}
+	return response, nil
+}
+
+func (cache *Client) PutRow(request *tablestore.PutRowRequest) (*tablestore.PutRowResponse, error) {
+	defer cache.invalidate(request.PutRowChange.TableName, request.PutRowChange.PrimaryKey)
+	return cache.TableStoreApi.PutRow(request)
+}
+
+func (cache *Client) UpdateRow(request *tablestore.UpdateRowRequest) (*tablestore.UpdateRowResponse, error) {
+	defer cache.invalidate(request.UpdateRowChange.TableName, request.UpdateRowChange.PrimaryKey)
+	return cache.TableStoreApi.UpdateRow(request)
+}
+
+func (cache *Client) DeleteRow(request *tablestore.DeleteRowRequest) (*tablestore.DeleteRowResponse, error) {
+	defer cache.invalidate(request.DeleteRowChange.TableName, request.DeleteRowChange.PrimaryKey)
+	return cache.TableStoreApi.DeleteRow(request)
+}
+
+func (cache *Client) BatchWriteRow(request *tablestore.BatchWriteRowRequest) (*tablestore.BatchWriteRowResponse, error) {
+	defer func() {
+		for table, changes := range request.RowChangesGroupByTable {
+			for _, change := range changes {
+				switch change := change.(type) {
+				case *tablestore.PutRowChange:
+					cache.invalidate(table, change.PrimaryKey)
+				case *tablestore.UpdateRowChange:
+					cache.invalidate(table, change.PrimaryKey)
+				case *tablestore.DeleteRowChange:
+					cache.invalidate(table, change.PrimaryKey)
+				}
+			}
+		}
+	}()
+	return cache.TableStoreApi.BatchWriteRow(request)
+}
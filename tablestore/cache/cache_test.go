@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func primaryKey(key string) *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn("pk", key)
+	return pk
+}
+
+func TestClient(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	reads := 0
+	counter := func(uri string, body []byte, next tablestore.Invoker) ([]byte, error, int, string) {
+		if strings.Contains(uri, "Get") {
+			reads++
+		}
+		return next(uri, body)
+	}
+	client := New(server.NewTableStoreClient(tablestore.AddInterceptor(counter)), Config{TTL: time.Minute})
+
+	meta := &tablestore.TableMeta{TableName: "t"}
+	meta.AddPrimaryKeyColumn("pk", tablestore.PrimaryKeyType_STRING)
+	if _, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+		t.Fatal(err)
+	}
+	put := func(key, value string) {
+		change := &tablestore.PutRowChange{TableName: "t", PrimaryKey: primaryKey(key)}
+		change.AddColumn("a", value)
+		change.AddColumn("b", int64(1))
+		change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: change}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	getRow := func(key string, columns ...string) *tablestore.GetRowResponse {
+		criteria := &tablestore.SingleRowQueryCriteria{TableName: "t", PrimaryKey: primaryKey(key), MaxVersion: 1, ColumnsToGet: columns}
+		response, err := client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	put("x", "v1")
+	getRow("x")
+	if row := getRow("x", "a"); len(row.Columns) != 1 || row.Columns[0].Value != "v1" {
+		t.Errorf("unexpected cached row %v", row.Columns)
+	}
+	if reads != 1 {
+		t.Errorf("%d reads, expect 1", reads)
+	}
+	put("x", "v2")
+	if row := getRow("x", "a"); row.Columns[0].Value != "v2" || reads != 2 {
+		t.Errorf("row not invalidated: %v after %d reads", row.Columns, reads)
+	}
+	if row := getRow("missing"); len(row.Columns) != 0 || len(getRow("missing").Columns) != 0 || reads != 3 {
+		t.Errorf("missing row not cached")
+	}
+
+	// y is read from the server, x and missing from the cache
+	put("y", "v3")
+	criteria := &tablestore.MultiRowQueryCriteria{TableName: "t", MaxVersion: 1, ColumnsToGet: []string{"a"}}
+	criteria.AddRow(primaryKey("x"))
+	criteria.AddRow(primaryKey("y"))
+	criteria.AddRow(primaryKey("missing"))
+	response, err := client.BatchGetRow(&tablestore.BatchGetRowRequest{MultiRowQueryCriteria: []*tablestore.MultiRowQueryCriteria{criteria}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := response.TableToRowsResult["t"]
+	if len(rows) != 3 || rows[0].Columns[0].Value != "v2" || rows[1].Columns[0].Value != "v3" || len(rows[1].Columns) != 1 ||
+		len(rows[2].Columns) != 0 || rows[1].Index != 1 || reads != 4 {
+		t.Errorf("unexpected batch result %+v after %d reads", rows, reads)
+	}
+	if row := getRow("y"); len(row.Columns) != 2 || reads != 4 {
+		t.Errorf("batch rows not cached")
+	}
+	if hits, misses := client.Stats(); hits != 5 || misses != 4 {
+		t.Errorf("%d hits, %d misses", hits, misses)
+	}
+}
+
+func TestLRU(t *testing.T) {
+	lru := NewLRU(2)
+	lru.Set("a", []byte("1"), 0)
+	lru.Set("b", []byte("2"), 0)
+	lru.Get("a")
+	lru.Set("c", []byte("3"), 0)
+	if _, ok := lru.Get("b"); ok || lru.Len() != 2 {
+		t.Errorf("least recently used entry not evicted")
+	}
+	lru.Set("d", []byte("4"), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, ok := lru.Get("d"); ok {
+		t.Errorf("expired entry returned")
+	}
+	lru.Delete("a")
+	if _, ok := lru.Get("a"); ok {
+		t.Errorf("deleted entry returned")
+	}
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Backend stores cached rows. Values are opaque, so a backend may be a
+// remote store shared by several processes, e.g. Redis. A backend failing to
+// read an entry should report a miss.
+type Backend interface {
+	Get(key string) (value []byte, ok bool)
+	// Set stores value for ttl, forever if ttl is 0.
+	Set(key string, value []byte, ttl time.Duration)
+	Delete(key string)
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// LRU is an in-memory Backend holding at most a number of entries, evicting
+// the least recently used ones first. It is safe for concurrent use.
+type LRU struct {
+	capacity int
+
+	lock    sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+var _ Backend = (*LRU)(nil)
+
+func NewLRU(capacity int) *LRU {
+	return &LRU{capacity: capacity, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (lru *LRU) Get(key string) ([]byte, bool) {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+	element, ok := lru.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*lruEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		lru.remove(element)
+		return nil, false
+	}
+	lru.order.MoveToFront(element)
+	return entry.value, true
+}
+
+func (lru *LRU) Set(key string, value []byte, ttl time.Duration) {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+	entry := &lruEntry{key: key, value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	if element, ok := lru.entries[key]; ok {
+		element.Value = entry
+		lru.order.MoveToFront(element)
+		return
+	}
+	lru.entries[key] = lru.order.PushFront(entry)
+	for lru.order.Len() > lru.capacity {
+		lru.remove(lru.order.Back())
+	}
+}
+
+func (lru *LRU) Delete(key string) {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+	if element, ok := lru.entries[key]; ok {
+		lru.remove(element)
+	}
+}
+
+// Len returns the number of entries, expired ones included.
+func (lru *LRU) Len() int {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+	return lru.order.Len()
+}
+
+func (lru *LRU) remove(element *list.Element) {
+	lru.order.Remove(element)
+	delete(lru.entries, element.Value.(*lruEntry).key)
+}
@@ -0,0 +1,132 @@
+package tablestore
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
+	"github.com/golang/protobuf/proto"
+	"net/http"
+)
+
+// Capability is an optional subsystem of an instance.
+type Capability string
+
+const (
+	CapabilitySearchIndex  Capability = "SearchIndex"
+	CapabilitySQL          Capability = "SQL"
+	CapabilityStreams      Capability = "Streams"
+	CapabilityTimeseries   Capability = "Timeseries"
+	CapabilityTransactions Capability = "Transactions"
+)
+
+// Capabilities tells which optional subsystems an instance supports.
+type Capabilities struct {
+	SearchIndex  bool
+	SQL          bool
+	Streams      bool
+	Timeseries   bool
+	Transactions bool
+	// errors of the probes which failed for other reasons than the
+	// subsystem being unsupported, e.g. network errors or OTSAuthFailed,
+	// whose subsystems are reported unsupported
+	Errors map[Capability]error
+}
+
+// the table of the transaction probe, which is not expected to exist
+const probeTableName = "tablestore_capability_probe"
+
+// probes of the capabilities, requests which are cheap, lists, or fail before
+// doing anything if their subsystem is supported. SQL, timeseries and
+// transactions are not known to otsprotocol, their requests are encoded here.
+var capabilityProbes = []struct {
+	capability Capability
+	uri        string
+	body       func() []byte
+}{
+	{CapabilitySearchIndex, listSearchIndexUri, func() []byte {
+		body, _ := proto.Marshal(&otsprotocol.ListSearchIndexRequest{})
+		return body
+	}},
+	// SQLQueryRequest, of query = 1
+	{CapabilitySQL, "/SQLQuery", func() []byte {
+		buf := proto.NewBuffer(nil)
+		buf.EncodeVarint(1<<3 | proto.WireBytes)
+		buf.EncodeStringBytes("SHOW TABLES")
+		return buf.Bytes()
+	}},
+	{CapabilityStreams, listStreamUri, func() []byte {
+		body, _ := proto.Marshal(&otsprotocol.ListStreamRequest{})
+		return body
+	}},
+	// ListTimeseriesTableRequest, without fields
+	{CapabilityTimeseries, "/ListTimeseriesTable", func() []byte {
+		return []byte{}
+	}},
+	// StartLocalTransactionRequest, of table_name = 1 and key = 2, the
+	// primary key in plainbuffer format
+	{CapabilityTransactions, "/StartLocalTransaction", func() []byte {
+		key := new(PrimaryKey)
+		key.AddPrimaryKeyColumn("id", "")
+		buf := proto.NewBuffer(nil)
+		buf.EncodeVarint(1<<3 | proto.WireBytes)
+		buf.EncodeStringBytes(probeTableName)
+		buf.EncodeVarint(2<<3 | proto.WireBytes)
+		buf.EncodeRawBytes(key.Build(false))
+		return buf.Bytes()
+	}},
+}
+
+// Capabilities probes which optional subsystems the instance supports, by a
+// list or an invalid request to each, e.g. for frameworks to enable the
+// features of the instance. Transactions are reported supported if the
+// instance supports them, whether tables enable them or not. Each probe is a
+// single request, without retries, and does not change the actions the
+// client records as unsupported, see IsUnsupported.
+func (tableStoreClient *TableStoreClient) Capabilities() *Capabilities {
+	capabilities := &Capabilities{Errors: make(map[Capability]error)}
+	for _, probe := range capabilityProbes {
+		supported, err := tableStoreClient.probe(probe.uri, probe.body())
+		if err != nil {
+			capabilities.Errors[probe.capability] = err
+		}
+		switch probe.capability {
+		case CapabilitySearchIndex:
+			capabilities.SearchIndex = supported
+		case CapabilitySQL:
+			capabilities.SQL = supported
+		case CapabilityStreams:
+			capabilities.Streams = supported
+		case CapabilityTimeseries:
+			capabilities.Timeseries = supported
+		case CapabilityTransactions:
+			capabilities.Transactions = supported
+		}
+	}
+	return capabilities
+}
+
+// probe reports whether the action of uri is supported: it succeeds, or the
+// service rejects the request itself, as invalid or of a missing object. The
+// error is the one of a probe which failed otherwise, e.g. OTSAuthFailed,
+// which does not tell whether the action exists.
+func (tableStoreClient *TableStoreClient) probe(uri string, body []byte) (bool, error) {
+	respBody, err, statusCode, requestId := tableStoreClient.invoke(tableStoreClient.context(), uri, body, nil)
+	if err == nil {
+		return true, nil
+	}
+	e := new(otsprotocol.Error)
+	if len(respBody) == 0 || proto.Unmarshal(respBody, e) != nil || e.GetCode() == "" {
+		// endpoints which do not exist answer 404 without an error of the
+		// service
+		if statusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	switch e.GetCode() {
+	case UNSUPPORTED_OPERATION:
+		return false, nil
+	case PARAMETER_INVALID, OBJECT_NOT_EXIST:
+		return true, nil
+	}
+	return false, fmt.Errorf("%s %s %s", e.GetCode(), e.GetMessage(), requestId)
+}
@@ -0,0 +1,80 @@
+package tablestore
+
+// dataSize returns the size of a value by the billing rules of TableStore:
+// the length of strings and binaries, 8 bytes for integers and doubles and 1
+// byte for booleans.
+func dataSize(value interface{}) int64 {
+	switch value := value.(type) {
+	case string:
+		return int64(len(value))
+	case []byte:
+		return int64(len(value))
+	case int64, float64:
+		return 8
+	case bool:
+		return 1
+	}
+	return 0
+}
+
+func primaryKeyDataSize(pk *PrimaryKey) int64 {
+	var size int64
+	if pk == nil {
+		return 0
+	}
+	for _, column := range pk.PrimaryKeys {
+		size += int64(len(column.ColumnName))
+		if column.PrimaryKeyOption == AUTO_INCREMENT {
+			size += 8
+		} else {
+			size += dataSize(column.Value)
+		}
+	}
+	return size
+}
+
+// capacityUnits rounds size up to 4KB units, at least 1.
+func capacityUnits(size int64) int64 {
+	units := (size + capacityUnitSize - 1) / capacityUnitSize
+	if units < 1 {
+		return 1
+	}
+	return units
+}
+
+// EstimateWriteCU returns the write capacity units consumed by a row change:
+// the data size of its primary key and of the columns it writes, names
+// included, rounded up to 4KB units. Conditional writes also consume read
+// capacity units, as reading their row would.
+func EstimateWriteCU(change RowChange) int64 {
+	var size int64
+	switch change := change.(type) {
+	case *PutRowChange:
+		size = primaryKeyDataSize(change.PrimaryKey)
+		for _, column := range change.Columns {
+			size += int64(len(column.ColumnName)) + dataSize(column.Value)
+		}
+	case *UpdateRowChange:
+		size = primaryKeyDataSize(change.PrimaryKey)
+		for _, column := range change.Columns {
+			size += int64(len(column.ColumnName)) + dataSize(column.Value)
+		}
+	case *DeleteRowChange:
+		size = primaryKeyDataSize(change.PrimaryKey)
+	}
+	return capacityUnits(size)
+}
+
+// EstimateReadCU returns the read capacity units consumed by reading row: the
+// data size of its primary key and of the columns read, names included,
+// rounded up to 4KB units. Reading a missing row, nil, consumes 1 unit.
+func EstimateReadCU(row *Row) int64 {
+	if row == nil {
+		return 1
+	}
+	size := primaryKeyDataSize(row.PrimaryKey)
+	for _, column := range row.Columns {
+		size += int64(len(column.ColumnName)) + dataSize(column.Value)
+	}
+	return capacityUnits(size)
+}
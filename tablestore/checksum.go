@@ -0,0 +1,70 @@
+package tablestore
+
+import "fmt"
+
+// ChecksumMode is how a client verifies the checksums of the cells and rows it
+// decodes.
+type ChecksumMode int
+
+const (
+	// checksums are read but not verified, the default
+	ChecksumNone ChecksumMode = iota
+	// mismatches are logged as warnings, the rows being decoded anyway
+	ChecksumLenient
+	// mismatches fail the decoding with a *PlainBufferError wrapping a
+	// *ChecksumError
+	ChecksumStrict
+)
+
+// ChecksumError is the error of a cell or row whose checksum does not match
+// its content, i.e. corrupted in transit or in memory.
+type ChecksumError struct {
+	// column of the cell, "" for the checksum of a row
+	Column   string
+	Expected byte
+	Actual   byte
+}
+
+func (e *ChecksumError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("[tablestore] row checksum mismatch: expected %#02x, got %#02x", e.Expected, e.Actual)
+	}
+	return fmt.Sprintf("[tablestore] checksum mismatch of cell %q: expected %#02x, got %#02x", e.Column, e.Expected, e.Actual)
+}
+
+// SetChecksumVerification sets how the client verifies the checksums of the
+// rows it reads, by GetRow, BatchGetRow, GetRange, Search and GetStreamRecord.
+func SetChecksumVerification(mode ChecksumMode) ClientOption {
+	return func(client *TableStoreClient) {
+		client.checksum = mode
+	}
+}
+
+// newReader returns a reader of the rows of data verifying their checksums as
+// set for the client, interning column names in names.
+func (tableStoreClient *TableStoreClient) newReader(data []byte, names interner) *plainBufferReader {
+	r := newPlainBufferReader(data)
+	r.names = names
+	r.checksum = tableStoreClient.checksum
+	if r.checksum == ChecksumLenient {
+		r.onMismatch = func(err error) {
+			tableStoreClient.log(LogWarn, "checksum mismatch", LogField("error", err))
+		}
+	}
+	return r
+}
+
+// verify checks a checksum read at offset against the expected one.
+func (r *plainBufferReader) verify(offset int, column string, expected, actual byte) error {
+	if r.checksum == ChecksumNone || expected == actual {
+		return nil
+	}
+	err := r.error(offset, &ChecksumError{Column: column, Expected: expected, Actual: actual})
+	if r.checksum == ChecksumStrict {
+		return err
+	}
+	if r.onMismatch != nil {
+		r.onMismatch(err)
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+package tablestore
+
+import "sync/atomic"
+
+// frozenFlag marks the row changes, criteria and batch write requests the
+// client holds, from their submission until the call returns, e.g. while it
+// retries the rows which failed. Their builder methods do not change them
+// while they are held; the request fails afterwards with errFrozenRequest,
+// from Err and the next call it is submitted to. Clone returns a copy which is
+// not marked, to build another request.
+type frozenFlag struct {
+	holds   int32
+	written int32
+}
+
+// hold marks the request held, unless it was modified while it was held
+// before.
+func (flag *frozenFlag) hold() error {
+	if err := flag.err(); err != nil {
+		return err
+	}
+	atomic.AddInt32(&flag.holds, 1)
+	return nil
+}
+
+func (flag *frozenFlag) release() {
+	atomic.AddInt32(&flag.holds, -1)
+}
+
+// check reports whether the request may be modified, recording the attempt
+// otherwise.
+func (flag *frozenFlag) check() bool {
+	if atomic.LoadInt32(&flag.holds) > 0 {
+		atomic.StoreInt32(&flag.written, 1)
+		return false
+	}
+	return true
+}
+
+// err returns errFrozenRequest if the request was modified while it was held.
+func (flag *frozenFlag) err() error {
+	if atomic.LoadInt32(&flag.written) != 0 {
+		return errFrozenRequest
+	}
+	return nil
+}
+
+// holdRowChanges holds changes, returning their release, or the error of the
+// first one modified while it was held.
+func holdRowChanges(changes ...RowChange) (func(), error) {
+	flags := make([]*frozenFlag, 0, len(changes))
+	for _, change := range changes {
+		var flag *frozenFlag
+		switch change := change.(type) {
+		case *PutRowChange:
+			flag = &change.frozen
+		case *UpdateRowChange:
+			flag = &change.frozen
+		case *DeleteRowChange:
+			flag = &change.frozen
+		default:
+			continue
+		}
+		if err := flag.err(); err != nil {
+			return nil, err
+		}
+		flags = append(flags, flag)
+	}
+	for _, flag := range flags {
+		atomic.AddInt32(&flag.holds, 1)
+	}
+	return func() {
+		for _, flag := range flags {
+			flag.release()
+		}
+	}, nil
+}
+
+// Clone returns a deep copy of pk, binary values included.
+func (pk *PrimaryKey) Clone() *PrimaryKey {
+	if pk == nil {
+		return nil
+	}
+	clone := &PrimaryKey{PrimaryKeys: make([]*PrimaryKeyColumn, len(pk.PrimaryKeys))}
+	for i, column := range pk.PrimaryKeys {
+		c := *column
+		c.Value = cloneValue(column.Value)
+		clone.PrimaryKeys[i] = &c
+	}
+	return clone
+}
+
+func cloneValue(value interface{}) interface{} {
+	if value, ok := value.([]byte); ok {
+		return append([]byte{}, value...)
+	}
+	return value
+}
+
+func clonePrimaryKeys(pks []*PrimaryKey) []*PrimaryKey {
+	if pks == nil {
+		return nil
+	}
+	clones := make([]*PrimaryKey, len(pks))
+	for i, pk := range pks {
+		clones[i] = pk.Clone()
+	}
+	return clones
+}
+
+func cloneStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string{}, s...)
+}
+
+func cloneString(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	return &c
+}
+
+func cloneTimeRange(timeRange *TimeRange) *TimeRange {
+	if timeRange == nil {
+		return nil
+	}
+	c := *timeRange
+	return &c
+}
+
+// cloneFilter copies the filters of this package; frozen filters, which are
+// immutable, and filters of other types are shared.
+func cloneFilter(filter ColumnFilter) ColumnFilter {
+	switch filter := filter.(type) {
+	case *SingleColumnCondition:
+		c := *filter
+		if filter.Comparator != nil {
+			comparator := *filter.Comparator
+			c.Comparator = &comparator
+		}
+		c.ColumnName = cloneString(filter.ColumnName)
+		c.ColumnValue = cloneValue(filter.ColumnValue)
+		return &c
+	case *CompositeColumnValueFilter:
+		c := &CompositeColumnValueFilter{Operator: filter.Operator, Filters: make([]ColumnFilter, len(filter.Filters))}
+		for i, f := range filter.Filters {
+			c.Filters[i] = cloneFilter(f)
+		}
+		return c
+	case *PaginationFilter:
+		c := *filter
+		return &c
+	}
+	return filter
+}
+
+func cloneCondition(condition *RowCondition) *RowCondition {
+	if condition == nil {
+		return nil
+	}
+	return &RowCondition{RowExistenceExpectation: condition.RowExistenceExpectation, ColumnCondition: cloneFilter(condition.ColumnCondition)}
+}
+
+// Clone returns a deep copy of the change, e.g. to keep writing it while the
+// caller modifies or reuses the original. The copy is not held by the client,
+// and does not fail for the writes to the original while it was.
+func (rowchange *PutRowChange) Clone() *PutRowChange {
+	clone := *rowchange
+	clone.frozen = frozenFlag{}
+	clone.PrimaryKey = rowchange.PrimaryKey.Clone()
+	if rowchange.Columns != nil {
+		clone.Columns = make([]AttributeColumn, len(rowchange.Columns))
+		for i, column := range rowchange.Columns {
+			clone.Columns[i] = column
+			clone.Columns[i].Value = cloneValue(column.Value)
+		}
+	}
+	clone.Condition = cloneCondition(rowchange.Condition)
+	return &clone
+}
+
+// Clone returns a deep copy of the change.
+func (rowchange *UpdateRowChange) Clone() *UpdateRowChange {
+	clone := *rowchange
+	clone.frozen = frozenFlag{}
+	clone.PrimaryKey = rowchange.PrimaryKey.Clone()
+	if rowchange.Columns != nil {
+		clone.Columns = make([]ColumnToUpdate, len(rowchange.Columns))
+		for i, column := range rowchange.Columns {
+			clone.Columns[i] = column
+			clone.Columns[i].Value = cloneValue(column.Value)
+		}
+	}
+	clone.Condition = cloneCondition(rowchange.Condition)
+	return &clone
+}
+
+// Clone returns a deep copy of the change.
+func (rowchange *DeleteRowChange) Clone() *DeleteRowChange {
+	clone := *rowchange
+	clone.frozen = frozenFlag{}
+	clone.PrimaryKey = rowchange.PrimaryKey.Clone()
+	clone.Condition = cloneCondition(rowchange.Condition)
+	return &clone
+}
+
+// CloneRowChange returns a deep copy of change, change itself if it is not a
+// change of this package.
+func CloneRowChange(change RowChange) RowChange {
+	switch change := change.(type) {
+	case *PutRowChange:
+		return change.Clone()
+	case *UpdateRowChange:
+		return change.Clone()
+	case *DeleteRowChange:
+		return change.Clone()
+	}
+	return change
+}
+
+// Clone returns a deep copy of the criteria.
+func (rowQueryCriteria *SingleRowQueryCriteria) Clone() *SingleRowQueryCriteria {
+	clone := *rowQueryCriteria
+	clone.frozen = frozenFlag{}
+	clone.ColumnsToGet = cloneStrings(rowQueryCriteria.ColumnsToGet)
+	clone.PrimaryKey = rowQueryCriteria.PrimaryKey.Clone()
+	clone.TimeRange = cloneTimeRange(rowQueryCriteria.TimeRange)
+	clone.Filter = cloneFilter(rowQueryCriteria.Filter)
+	clone.StartColumn = cloneString(rowQueryCriteria.StartColumn)
+	clone.EndColumn = cloneString(rowQueryCriteria.EndColumn)
+	return &clone
+}
+
+// Clone returns a deep copy of the criteria.
+func (rowQueryCriteria *MultiRowQueryCriteria) Clone() *MultiRowQueryCriteria {
+	clone := *rowQueryCriteria
+	clone.frozen = frozenFlag{}
+	clone.PrimaryKey = clonePrimaryKeys(rowQueryCriteria.PrimaryKey)
+	clone.ColumnsToGet = cloneStrings(rowQueryCriteria.ColumnsToGet)
+	clone.TimeRange = cloneTimeRange(rowQueryCriteria.TimeRange)
+	clone.Filter = cloneFilter(rowQueryCriteria.Filter)
+	clone.StartColumn = cloneString(rowQueryCriteria.StartColumn)
+	clone.EndColumn = cloneString(rowQueryCriteria.EndColumn)
+	return &clone
+}
+
+// Clone returns a deep copy of the criteria.
+func (rowQueryCriteria *RangeRowQueryCriteria) Clone() *RangeRowQueryCriteria {
+	clone := *rowQueryCriteria
+	clone.frozen = frozenFlag{}
+	clone.StartPrimaryKey = rowQueryCriteria.StartPrimaryKey.Clone()
+	clone.EndPrimaryKey = rowQueryCriteria.EndPrimaryKey.Clone()
+	clone.ColumnsToGet = cloneStrings(rowQueryCriteria.ColumnsToGet)
+	clone.TimeRange = cloneTimeRange(rowQueryCriteria.TimeRange)
+	clone.Filter = cloneFilter(rowQueryCriteria.Filter)
+	clone.StartColumn = cloneString(rowQueryCriteria.StartColumn)
+	clone.EndColumn = cloneString(rowQueryCriteria.EndColumn)
+	return &clone
+}
+
+func (request *GetRowRequest) Clone() *GetRowRequest {
+	return &GetRowRequest{SingleRowQueryCriteria: request.SingleRowQueryCriteria.Clone()}
+}
+
+func (request *BatchGetRowRequest) Clone() *BatchGetRowRequest {
+	clone := &BatchGetRowRequest{MultiRowQueryCriteria: make([]*MultiRowQueryCriteria, len(request.MultiRowQueryCriteria))}
+	for i, criteria := range request.MultiRowQueryCriteria {
+		clone.MultiRowQueryCriteria[i] = criteria.Clone()
+	}
+	return clone
+}
+
+func (request *GetRangeRequest) Clone() *GetRangeRequest {
+	return &GetRangeRequest{RangeRowQueryCriteria: request.RangeRowQueryCriteria.Clone()}
+}
+
+func (request *PutRowRequest) Clone() *PutRowRequest {
+	return &PutRowRequest{PutRowChange: request.PutRowChange.Clone()}
+}
+
+func (request *UpdateRowRequest) Clone() *UpdateRowRequest {
+	return &UpdateRowRequest{UpdateRowChange: request.UpdateRowChange.Clone()}
+}
+
+func (request *DeleteRowRequest) Clone() *DeleteRowRequest {
+	return &DeleteRowRequest{DeleteRowChange: request.DeleteRowChange.Clone()}
+}
+
+func (request *BatchWriteRowRequest) Clone() *BatchWriteRowRequest {
+	clone := &BatchWriteRowRequest{RowChangesGroupByTable: make(map[string][]RowChange, len(request.RowChangesGroupByTable)), IsAtomic: request.IsAtomic}
+	for table, changes := range request.RowChangesGroupByTable {
+		clones := make([]RowChange, len(changes))
+		for i, change := range changes {
+			clones[i] = CloneRowChange(change)
+		}
+		clone.RowChangesGroupByTable[table] = clones
+	}
+	return clone
+}
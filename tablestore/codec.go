@@ -0,0 +1,156 @@
+package tablestore
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// ColumnCodec converts values of a custom Go type from and to one of the
+// column value types supported by TableStore: int64, float64, bool, string
+// and []byte.
+type ColumnCodec interface {
+	// Encode converts v into a column value.
+	Encode(v interface{}) (interface{}, error)
+	// Decode converts a column value into the value pointed to by target.
+	Decode(value interface{}, target interface{}) error
+}
+
+var (
+	codecLock   sync.RWMutex
+	namedCodecs = make(map[string]ColumnCodec)
+	typeCodecs  = make(map[reflect.Type]ColumnCodec)
+)
+
+// RegisterColumnCodec registers a codec under name, so that it can be
+// referenced explicitly, e.g. by the orm tag option `codec=name`.
+func RegisterColumnCodec(name string, codec ColumnCodec) {
+	codecLock.Lock()
+	defer codecLock.Unlock()
+	namedCodecs[name] = codec
+}
+
+// GetColumnCodec returns the codec registered under name, or nil.
+func GetColumnCodec(name string) ColumnCodec {
+	codecLock.RLock()
+	defer codecLock.RUnlock()
+	return namedCodecs[name]
+}
+
+// RegisterTypeCodec registers the default codec of the type of sample. Values
+// of that type are encoded by it when written with AddEncodedColumn,
+// PutEncodedColumn or the orm mapper, and decoded by it in DecodeColumnValue.
+func RegisterTypeCodec(sample interface{}, codec ColumnCodec) {
+	codecLock.Lock()
+	defer codecLock.Unlock()
+	typeCodecs[reflect.TypeOf(sample)] = codec
+}
+
+// GetTypeCodec returns the default codec of t, or nil.
+func GetTypeCodec(t reflect.Type) ColumnCodec {
+	codecLock.RLock()
+	defer codecLock.RUnlock()
+	return typeCodecs[t]
+}
+
+func isColumnValue(v interface{}) bool {
+	switch v.(type) {
+	case int64, float64, bool, string, []byte:
+		return true
+	}
+	return false
+}
+
+// EncodeColumnValue converts v into a column value through the codec
+// registered for its type. Column values are returned as is.
+func EncodeColumnValue(v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, errInvalidInput
+	}
+	if codec := GetTypeCodec(reflect.TypeOf(v)); codec != nil {
+		return EncodeWithCodec(codec, v)
+	}
+	if isColumnValue(v) {
+		return v, nil
+	}
+	return nil, fmt.Errorf("[tablestore] no codec registered for type %T", v)
+}
+
+// EncodeWithCodec encodes v with codec and checks the result is a column value.
+func EncodeWithCodec(codec ColumnCodec, v interface{}) (interface{}, error) {
+	encoded, err := codec.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	if !isColumnValue(encoded) {
+		return nil, fmt.Errorf("[tablestore] codec returns unsupported column value %T", encoded)
+	}
+	return encoded, nil
+}
+
+// DecodeColumnValue stores value into target, which must be a non-nil
+// pointer. The codec registered for the type target points to is used if
+// any, otherwise value is assigned directly (integers may be narrowed).
+func DecodeColumnValue(value interface{}, target interface{}) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errInvalidInput
+	}
+	if codec := GetTypeCodec(rv.Type().Elem()); codec != nil {
+		return codec.Decode(value, target)
+	}
+	return assignColumnValue(value, rv.Elem())
+}
+
+func assignColumnValue(value interface{}, v reflect.Value) error {
+	if value == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	vv := reflect.ValueOf(value)
+	switch {
+	case vv.Type().AssignableTo(v.Type()):
+		v.Set(vv)
+		return nil
+	case vv.Kind() == reflect.Int64 && v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		v.SetInt(vv.Int())
+		return nil
+	case vv.Kind() == reflect.Int64 && v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64:
+		v.SetUint(uint64(vv.Int()))
+		return nil
+	case vv.Kind() == reflect.Float64 && v.Kind() == reflect.Float32:
+		v.SetFloat(vv.Float())
+		return nil
+	case vv.Type().ConvertibleTo(v.Type()) && vv.Kind() == v.Kind():
+		v.Set(vv.Convert(v.Type()))
+		return nil
+	}
+	return fmt.Errorf("[tablestore] can not assign %T to %s", value, v.Type())
+}
+
+// Decode stores the value of the column into target, see DecodeColumnValue.
+func (column *AttributeColumn) Decode(target interface{}) error {
+	return DecodeColumnValue(column.Value, target)
+}
+
+// AddEncodedColumn is like AddColumn but accepts any value whose type has a
+// registered codec.
+func (rowchange *PutRowChange) AddEncodedColumn(columnName string, value interface{}) error {
+	encoded, err := EncodeColumnValue(value)
+	if err != nil {
+		return err
+	}
+	rowchange.AddColumn(columnName, encoded)
+	return nil
+}
+
+// PutEncodedColumn is like PutColumn but accepts any value whose type has a
+// registered codec.
+func (rowchange *UpdateRowChange) PutEncodedColumn(columnName string, value interface{}) error {
+	encoded, err := EncodeColumnValue(value)
+	if err != nil {
+		return err
+	}
+	rowchange.PutColumn(columnName, encoded)
+	return nil
+}
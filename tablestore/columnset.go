@@ -0,0 +1,133 @@
+package tablestore
+
+import "fmt"
+
+// maxColumnNameLength is the length of column names at most.
+const maxColumnNameLength = 255
+
+// ColumnSet is a projection of the columns read, validated once and shared by
+// the criteria of the requests reading them:
+//
+//	var orderSummary = tablestore.MustColumnSet("user", "status", "total")
+//
+//	criteria.SetColumnSet(orderSummary)
+//
+// Sets are immutable, Include and Exclude return new sets.
+type ColumnSet struct {
+	names []string
+	index map[string]bool
+}
+
+// NewColumnSet returns the set of names, an error if a name is not a valid
+// column name, is repeated or if there are none.
+func NewColumnSet(names ...string) (*ColumnSet, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("[tablestore] empty column set")
+	}
+	set := &ColumnSet{names: make([]string, 0, len(names)), index: make(map[string]bool, len(names))}
+	for _, name := range names {
+		if err := validateColumnName(name); err != nil {
+			return nil, err
+		}
+		if set.index[name] {
+			return nil, fmt.Errorf("[tablestore] column %s repeated in column set", name)
+		}
+		set.index[name] = true
+		set.names = append(set.names, name)
+	}
+	return set, nil
+}
+
+// MustColumnSet is NewColumnSet panicking on errors, for sets declared as
+// package variables.
+func MustColumnSet(names ...string) *ColumnSet {
+	set, err := NewColumnSet(names...)
+	if err != nil {
+		panic(err)
+	}
+	return set
+}
+
+// validateColumnName checks name is made of 1 to 255 letters, digits and
+// underscores, and does not start with a digit.
+func validateColumnName(name string) error {
+	if len(name) == 0 || len(name) > maxColumnNameLength {
+		return fmt.Errorf("[tablestore] invalid column name: %q", name)
+	}
+	for i, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			return fmt.Errorf("[tablestore] invalid column name: %q", name)
+		}
+	}
+	return nil
+}
+
+// Names returns the names of the columns of set, in order.
+func (set *ColumnSet) Names() []string {
+	return append([]string(nil), set.names...)
+}
+
+func (set *ColumnSet) Contains(name string) bool {
+	return set.index[name]
+}
+
+// Include returns the set of the columns of set followed by those of names not
+// in set.
+func (set *ColumnSet) Include(names ...string) (*ColumnSet, error) {
+	all := set.Names()
+	added := make(map[string]bool, len(names))
+	for _, name := range names {
+		if !set.index[name] && !added[name] {
+			added[name] = true
+			all = append(all, name)
+		}
+	}
+	return NewColumnSet(all...)
+}
+
+// Exclude returns the set of the columns of set not in names, an error if
+// none remains, as reading no column would read them all.
+func (set *ColumnSet) Exclude(names ...string) (*ColumnSet, error) {
+	excluded := make(map[string]bool, len(names))
+	for _, name := range names {
+		excluded[name] = true
+	}
+	var remaining []string
+	for _, name := range set.names {
+		if !excluded[name] {
+			remaining = append(remaining, name)
+		}
+	}
+	return NewColumnSet(remaining...)
+}
+
+// SetColumnSet reads the columns of set, all of them if set is nil.
+func (rowQueryCriteria *SingleRowQueryCriteria) SetColumnSet(set *ColumnSet) {
+	if !rowQueryCriteria.frozen.check() {
+		return
+	}
+	rowQueryCriteria.ColumnsToGet = set.columnsToGet()
+}
+
+// SetColumnSet reads the columns of set, all of them if set is nil.
+func (rowQueryCriteria *MultiRowQueryCriteria) SetColumnSet(set *ColumnSet) {
+	if !rowQueryCriteria.frozen.check() {
+		return
+	}
+	rowQueryCriteria.ColumnsToGet = set.columnsToGet()
+}
+
+// SetColumnSet reads the columns of set, all of them if set is nil.
+func (rowQueryCriteria *RangeRowQueryCriteria) SetColumnSet(set *ColumnSet) {
+	if !rowQueryCriteria.frozen.check() {
+		return
+	}
+	rowQueryCriteria.ColumnsToGet = set.columnsToGet()
+}
+
+func (set *ColumnSet) columnsToGet() []string {
+	if set == nil {
+		return nil
+	}
+	return set.Names()
+}
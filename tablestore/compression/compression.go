@@ -0,0 +1,354 @@
+// Package compression compresses large string and binary columns in front of
+// a tablestore.TableStoreApi, to reduce the capacity units and the storage of
+// tables of blobs:
+//
+//	client := compression.New(tablestore.NewClient(endpoint, instance, id, secret), compression.Config{
+//		Columns: map[string][]string{"documents": {"content"}},
+//	})
+//
+// Values of the columns larger than the threshold are compressed when it
+// makes them smaller, and stored as binary values prefixed by a header
+// recording the algorithm and the type of the value. PutRow, UpdateRow and
+// BatchWriteRow compress the columns written, GetRow, GetRange, BatchGetRow
+// and Search decompress the columns read, whatever the algorithm they were
+// compressed with. Compressed columns can not be compared by filters and
+// conditions. Other methods are passed through.
+//
+// Flate and Gzip are built in; other algorithms, such as Snappy and Zstd, are
+// plugged by Register.
+package compression
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"io/ioutil"
+	"sync"
+)
+
+// Algorithm identifies a compression algorithm in the header of values.
+type Algorithm byte
+
+const (
+	// None marks binary values stored as is, escaped because they start
+	// like a header.
+	None  Algorithm = 0
+	Flate Algorithm = 1
+	Gzip  Algorithm = 2
+	// Snappy and Zstd are reserved for their implementations.
+	Snappy Algorithm = 3
+	Zstd   Algorithm = 4
+)
+
+// Compressor implements an algorithm.
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+var (
+	compressorsLock sync.RWMutex
+	compressors     = map[Algorithm]Compressor{Flate: flateCompressor{}, Gzip: gzipCompressor{}}
+)
+
+// Register registers the compressor of an algorithm, e.g. of Zstd by a
+// third-party library.
+func Register(algorithm Algorithm, compressor Compressor) {
+	compressorsLock.Lock()
+	defer compressorsLock.Unlock()
+	compressors[algorithm] = compressor
+}
+
+func compressorOf(algorithm Algorithm) (Compressor, error) {
+	compressorsLock.RLock()
+	defer compressorsLock.RUnlock()
+	if compressor := compressors[algorithm]; compressor != nil {
+		return compressor, nil
+	}
+	return nil, fmt.Errorf("[tablestore] unregistered compression algorithm %d", algorithm)
+}
+
+type flateCompressor struct{}
+
+func (flateCompressor) Compress(data []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w, _ := flate.NewWriter(&b, flate.DefaultCompression)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (flateCompressor) Decompress(data []byte) ([]byte, error) {
+	return ioutil.ReadAll(flate.NewReader(bytes.NewReader(data)))
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+// Header of stored values: magic, algorithm and type of the value.
+var magic = []byte{0xff, 'Z'}
+
+const (
+	headerSize = 4
+	typeString = 's'
+	typeBinary = 'b'
+)
+
+func header(algorithm Algorithm, valueType byte) []byte {
+	return []byte{magic[0], magic[1], byte(algorithm), valueType}
+}
+
+func hasHeader(b []byte) bool {
+	return len(b) >= headerSize && bytes.HasPrefix(b, magic)
+}
+
+type Config struct {
+	// compressed columns by table
+	Columns map[string][]string
+	// size from which values are compressed, 1KB by default
+	Threshold int
+	// algorithm of the values written, Flate by default
+	Algorithm Algorithm
+}
+
+// Client is a tablestore.TableStoreApi compressing columns. It is safe for
+// concurrent use if the wrapped client and the compressors are.
+type Client struct {
+	tablestore.TableStoreApi
+	config  Config
+	columns map[string]map[string]bool
+}
+
+var _ tablestore.TableStoreApi = (*Client)(nil)
+
+func New(client tablestore.TableStoreApi, config Config) *Client {
+	if config.Threshold <= 0 {
+		config.Threshold = 1024
+	}
+	if config.Algorithm == None {
+		config.Algorithm = Flate
+	}
+	compression := &Client{TableStoreApi: client, config: config, columns: make(map[string]map[string]bool)}
+	for table, columns := range config.Columns {
+		compression.columns[table] = make(map[string]bool)
+		for _, column := range columns {
+			compression.columns[table][column] = true
+		}
+	}
+	return compression
+}
+
+// compress returns the value to store.
+func (compression *Client) compress(value interface{}) (interface{}, error) {
+	var data []byte
+	var valueType byte
+	switch v := value.(type) {
+	case string:
+		data, valueType = []byte(v), typeString
+	case []byte:
+		data, valueType = v, typeBinary
+	default:
+		return value, nil
+	}
+	if len(data) >= compression.config.Threshold {
+		compressor, err := compressorOf(compression.config.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+		compressed, err := compressor.Compress(data)
+		if err != nil {
+			return nil, err
+		}
+		if len(compressed)+headerSize < len(data) {
+			return append(header(compression.config.Algorithm, valueType), compressed...), nil
+		}
+	}
+	if valueType == typeBinary && hasHeader(data) {
+		return append(header(None, valueType), data...), nil
+	}
+	return value, nil
+}
+
+// Decompress returns the value of a column read without the client, e.g.
+// from a stream record. Values without header are returned as is.
+func Decompress(value interface{}) (interface{}, error) {
+	b, ok := value.([]byte)
+	if !ok || !hasHeader(b) {
+		return value, nil
+	}
+	data := b[headerSize:]
+	if algorithm := Algorithm(b[len(magic)]); algorithm != None {
+		compressor, err := compressorOf(algorithm)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = compressor.Decompress(data); err != nil {
+			return nil, fmt.Errorf("[tablestore] decompressing value: %v", err)
+		}
+	}
+	if b[len(magic)+1] == typeString {
+		return string(data), nil
+	}
+	return data, nil
+}
+
+func (compression *Client) compressPut(change *tablestore.PutRowChange) (*tablestore.PutRowChange, error) {
+	columns := compression.columns[change.TableName]
+	if columns == nil {
+		return change, nil
+	}
+	compressed := *change
+	compressed.Columns = append([]tablestore.AttributeColumn(nil), change.Columns...)
+	for i := range compressed.Columns {
+		if column := &compressed.Columns[i]; columns[column.ColumnName] {
+			var err error
+			if column.Value, err = compression.compress(column.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &compressed, nil
+}
+
+func (compression *Client) compressUpdate(change *tablestore.UpdateRowChange) (*tablestore.UpdateRowChange, error) {
+	columns := compression.columns[change.TableName]
+	if columns == nil {
+		return change, nil
+	}
+	compressed := *change
+	compressed.Columns = append([]tablestore.ColumnToUpdate(nil), change.Columns...)
+	for i := range compressed.Columns {
+		if column := &compressed.Columns[i]; columns[column.ColumnName] && !column.HasType {
+			var err error
+			if column.Value, err = compression.compress(column.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &compressed, nil
+}
+
+func (compression *Client) PutRow(request *tablestore.PutRowRequest) (*tablestore.PutRowResponse, error) {
+	change, err := compression.compressPut(request.PutRowChange)
+	if err != nil {
+		return nil, err
+	}
+	return compression.TableStoreApi.PutRow(&tablestore.PutRowRequest{PutRowChange: change})
+}
+
+func (compression *Client) UpdateRow(request *tablestore.UpdateRowRequest) (*tablestore.UpdateRowResponse, error) {
+	change, err := compression.compressUpdate(request.UpdateRowChange)
+	if err != nil {
+		return nil, err
+	}
+	return compression.TableStoreApi.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: change})
+}
+
+func (compression *Client) BatchWriteRow(request *tablestore.BatchWriteRowRequest) (*tablestore.BatchWriteRowResponse, error) {
+	compressed := &tablestore.BatchWriteRowRequest{RowChangesGroupByTable: make(map[string][]tablestore.RowChange)}
+	for table, changes := range request.RowChangesGroupByTable {
+		for _, change := range changes {
+			var err error
+			switch c := change.(type) {
+			case *tablestore.PutRowChange:
+				change, err = compression.compressPut(c)
+			case *tablestore.UpdateRowChange:
+				change, err = compression.compressUpdate(c)
+			}
+			if err != nil {
+				return nil, err
+			}
+			compressed.RowChangesGroupByTable[table] = append(compressed.RowChangesGroupByTable[table], change)
+		}
+	}
+	return compression.TableStoreApi.BatchWriteRow(compressed)
+}
+
+// decompress decompresses the columns read from a row of table.
+func (compression *Client) decompress(table string, columns []*tablestore.AttributeColumn) error {
+	compressed := compression.columns[table]
+	if compressed == nil {
+		return nil
+	}
+	for i, column := range columns {
+		if !compressed[column.ColumnName] {
+			continue
+		}
+		value, err := Decompress(column.Value)
+		if err != nil {
+			return fmt.Errorf("[tablestore] column %s of %s: %v", column.ColumnName, table, err)
+		}
+		columns[i] = &tablestore.AttributeColumn{ColumnName: column.ColumnName, Value: value, Timestamp: column.Timestamp}
+	}
+	return nil
+}
+
+func (compression *Client) GetRow(request *tablestore.GetRowRequest) (*tablestore.GetRowResponse, error) {
+	response, err := compression.TableStoreApi.GetRow(request)
+	if err != nil {
+		return response, err
+	}
+	return response, compression.decompress(request.SingleRowQueryCriteria.TableName, response.Columns)
+}
+
+func (compression *Client) GetRange(request *tablestore.GetRangeRequest) (*tablestore.GetRangeResponse, error) {
+	response, err := compression.TableStoreApi.GetRange(request)
+	if err != nil {
+		return response, err
+	}
+	for _, row := range response.Rows {
+		if err := compression.decompress(request.RangeRowQueryCriteria.TableName, row.Columns); err != nil {
+			return response, err
+		}
+	}
+	return response, nil
+}
+
+func (compression *Client) BatchGetRow(request *tablestore.BatchGetRowRequest) (*tablestore.BatchGetRowResponse, error) {
+	response, err := compression.TableStoreApi.BatchGetRow(request)
+	if err != nil {
+		return response, err
+	}
+	for table, results := range response.TableToRowsResult {
+		for _, result := range results {
+			if err := compression.decompress(table, result.Columns); err != nil {
+				return response, err
+			}
+		}
+	}
+	return response, nil
+}
+
+func (compression *Client) Search(request *tablestore.SearchRequest) (*tablestore.SearchResponse, error) {
+	response, err := compression.TableStoreApi.Search(request)
+	if err != nil {
+		return response, err
+	}
+	for _, row := range response.Rows {
+		if err := compression.decompress(request.TableName, row.Columns); err != nil {
+			return response, err
+		}
+	}
+	return response, nil
+}
@@ -0,0 +1,105 @@
+package compression
+
+import (
+	"bytes"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"strings"
+	"testing"
+)
+
+// repeated is a toy algorithm standing for a registered one, compressing
+// 2000 repetitions of a byte.
+type repeated struct{}
+
+func (repeated) Compress(data []byte) ([]byte, error) {
+	return data[:1], nil
+}
+
+func (repeated) Decompress(data []byte) ([]byte, error) {
+	return bytes.Repeat(data, 2000), nil
+}
+
+func TestClient(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	raw := server.NewTableStoreClient()
+	meta := &tablestore.TableMeta{TableName: "documents"}
+	meta.AddPrimaryKeyColumn("id", tablestore.PrimaryKeyType_STRING)
+	if _, err := raw.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+		t.Fatal(err)
+	}
+	client := New(raw, Config{Columns: map[string][]string{"documents": {"content", "data", "small", "escaped"}}})
+
+	content := strings.Repeat("lorem ipsum ", 1000)
+	escaped := append([]byte{0xff, 'Z', 1, 's'}, "not compressed"...)
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn("id", "d1")
+	change := &tablestore.PutRowChange{TableName: "documents", PrimaryKey: pk}
+	change.AddColumn("content", content)
+	change.AddColumn("small", "tiny")
+	change.AddColumn("escaped", escaped)
+	change.AddColumn("other", content)
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: change}); err != nil {
+		t.Fatal(err)
+	}
+
+	criteria := &tablestore.SingleRowQueryCriteria{TableName: "documents", PrimaryKey: pk, MaxVersion: 1}
+	stored, err := raw.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, column := range stored.Columns {
+		switch column.ColumnName {
+		case "content":
+			if b, ok := column.Value.([]byte); !ok || len(b) > len(content)/10 {
+				t.Errorf("content not compressed: %T", column.Value)
+			}
+		case "small":
+			if column.Value != "tiny" {
+				t.Errorf("small value compressed: %v", column.Value)
+			}
+		case "other":
+			if column.Value != content {
+				t.Errorf("column compressed without configuration")
+			}
+		}
+	}
+
+	update := &tablestore.UpdateRowChange{TableName: "documents", PrimaryKey: pk}
+	update.PutColumn("data", bytes.Repeat([]byte{7}, 5000))
+	update.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	if _, err := client.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: update}); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]interface{})
+	for _, column := range read.Columns {
+		values[column.ColumnName] = column.Value
+	}
+	if values["content"] != content || values["small"] != "tiny" || values["other"] != content {
+		t.Errorf("unexpected strings %v", values)
+	}
+	if !bytes.Equal(values["escaped"].([]byte), escaped) || !bytes.Equal(values["data"].([]byte), bytes.Repeat([]byte{7}, 5000)) {
+		t.Errorf("unexpected binary values %v", values)
+	}
+
+	// rows compressed by registered algorithms are read by all clients
+	Register(Zstd, repeated{})
+	zstd := New(raw, Config{Columns: map[string][]string{"documents": {"data"}}, Algorithm: Zstd})
+	change = &tablestore.PutRowChange{TableName: "documents", PrimaryKey: pk}
+	change.AddColumn("data", bytes.Repeat([]byte{9}, 2000))
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	if _, err := zstd.PutRow(&tablestore.PutRowRequest{PutRowChange: change}); err != nil {
+		t.Fatal(err)
+	}
+	read, err = client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil || len(read.Columns) != 1 || !bytes.Equal(read.Columns[0].Value.([]byte), bytes.Repeat([]byte{9}, 2000)) {
+		t.Errorf("unexpected row %v, %v", read, err)
+	}
+}
@@ -0,0 +1,48 @@
+package tablestore
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrRowAlreadyExists is returned by PutRowIfNotExist when the row exists.
+	ErrRowAlreadyExists = errors.New("[tablestore] row already exists")
+	// ErrRowNotExist is returned by UpdateRowIfExist when the row does not
+	// exist, or does not meet the column condition of the change.
+	ErrRowNotExist = errors.New("[tablestore] row does not exist or condition check failed")
+)
+
+// PutRowIfNotExist puts the row of change if it does not exist, returning
+// ErrRowAlreadyExists otherwise. change is not modified.
+func (tableStoreClient *TableStoreClient) PutRowIfNotExist(change *PutRowChange) (*PutRowResponse, error) {
+	c := *change
+	c.Condition = &RowCondition{RowExistenceExpectation: RowExistenceExpectation_EXPECT_NOT_EXIST}
+	resp, err := tableStoreClient.PutRow(&PutRowRequest{PutRowChange: &c})
+	if IsConditionCheckFail(err) {
+		return nil, ErrRowAlreadyExists
+	}
+	return resp, err
+}
+
+// UpdateRowIfExist updates the row of change if it exists and meets the
+// column condition of change, if any, returning ErrRowNotExist otherwise.
+// change is not modified.
+func (tableStoreClient *TableStoreClient) UpdateRowIfExist(change *UpdateRowChange) (*UpdateRowResponse, error) {
+	c := *change
+	c.Condition = &RowCondition{RowExistenceExpectation: RowExistenceExpectation_EXPECT_EXIST}
+	if change.Condition != nil {
+		c.Condition.ColumnCondition = change.Condition.ColumnCondition
+	}
+	resp, err := tableStoreClient.UpdateRow(&UpdateRowRequest{UpdateRowChange: &c})
+	if IsConditionCheckFail(err) {
+		return nil, ErrRowNotExist
+	}
+	return resp, err
+}
+
+// IsConditionCheckFail reports whether err is the OTSConditionCheckFail error
+// of a write whose row condition or column condition is not met.
+func IsConditionCheckFail(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), CONDITION_CHECK_FAIL)
+}
@@ -0,0 +1,36 @@
+package tablestore
+
+import (
+	"context"
+)
+
+// DefaultCorrelationHeader is the header carrying correlation ids. Headers
+// prefixed by x-ots- are signed, so it is not one of them.
+const DefaultCorrelationHeader = "X-Correlation-Id"
+
+type correlationIdKey struct{}
+
+// WithCorrelationId returns a context carrying a correlation id. The calls
+// of a client bound to it by WithContext send the id in the correlation
+// header, and log it and set it on their spans, so that they can be lined up
+// with the logs of the application and of gateways:
+//
+//	ctx := tablestore.WithCorrelationId(ctx, r.Header.Get("X-Correlation-Id"))
+//	resp, err := client.WithContext(ctx).GetRow(request)
+func WithCorrelationId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIdKey{}, id)
+}
+
+// CorrelationIdFrom returns the correlation id of ctx, or "".
+func CorrelationIdFrom(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIdKey{}).(string)
+	return id
+}
+
+// SetCorrelationHeader sets the header carrying correlation ids,
+// DefaultCorrelationHeader by default.
+func SetCorrelationHeader(name string) ClientOption {
+	return func(client *TableStoreClient) {
+		client.correlationHeader = name
+	}
+}
@@ -0,0 +1,182 @@
+// Package counter provides counters stored in a table:
+//
+//	views := counter.New(client, "counters", "page-views", counter.Options{Shards: 8})
+//	views.Incr(1)
+//	total, err := views.Get()
+//
+// The protocol has no increment operation, so increments read the value of
+// a row and update it on the condition that it did not change meanwhile,
+// retrying on conflicts. Hot counters are split into shards, rows
+// incremented at random and summed by Get, to spread conflicts and load.
+package counter
+
+import (
+	"errors"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// columns of the rows of counters, whose primary key is made of the string
+// column NameColumn and of the integer column ShardColumn
+const (
+	NameColumn  = "name"
+	ShardColumn = "shard"
+	ValueColumn = "value"
+)
+
+// ErrContention is returned when an increment keeps conflicting with others.
+var ErrContention = errors.New("[tablestore] too many conflicting counter updates")
+
+type Options struct {
+	// number of rows of the counter, 1 by default
+	Shards int
+	// attempts of an increment before ErrContention, 10 by default
+	MaxAttempts int
+}
+
+// Counter is a counter named Name in a table. It is safe for concurrent use.
+type Counter struct {
+	client  tablestore.TableStoreApi
+	table   string
+	name    string
+	options Options
+
+	lock   sync.Mutex
+	random *rand.Rand
+}
+
+func New(client tablestore.TableStoreApi, table, name string, options Options) *Counter {
+	if options.Shards < 1 {
+		options.Shards = 1
+	}
+	if options.MaxAttempts < 1 {
+		options.MaxAttempts = 10
+	}
+	return &Counter{client: client, table: table, name: name, options: options, random: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// CreateTable creates a table of counters.
+func CreateTable(client tablestore.TableStoreApi, table string) error {
+	meta := &tablestore.TableMeta{TableName: table}
+	meta.AddPrimaryKeyColumn(NameColumn, tablestore.PrimaryKeyType_STRING)
+	meta.AddPrimaryKeyColumn(ShardColumn, tablestore.PrimaryKeyType_INTEGER)
+	_, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}})
+	return err
+}
+
+func (counter *Counter) primaryKey(shard int) *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn(NameColumn, counter.name)
+	pk.AddPrimaryKeyColumn(ShardColumn, int64(shard))
+	return pk
+}
+
+func (counter *Counter) intn(n int) int {
+	counter.lock.Lock()
+	defer counter.lock.Unlock()
+	return counter.random.Intn(n)
+}
+
+// Incr adds delta to the counter, and returns the new value of the counter,
+// or of the shard incremented if there are several of them.
+func (counter *Counter) Incr(delta int64) (int64, error) {
+	shard := counter.intn(counter.options.Shards)
+	pk := counter.primaryKey(shard)
+	for attempt := 0; attempt < counter.options.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(counter.intn(1<<uint(attempt))) * time.Millisecond)
+		}
+		criteria := &tablestore.SingleRowQueryCriteria{TableName: counter.table, PrimaryKey: pk, MaxVersion: 1, ColumnsToGet: []string{ValueColumn}}
+		resp, err := counter.client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+		if err != nil {
+			return 0, err
+		}
+		if len(resp.Columns) == 0 {
+			change := &tablestore.PutRowChange{TableName: counter.table, PrimaryKey: pk}
+			change.AddColumn(ValueColumn, delta)
+			change.SetCondition(tablestore.RowExistenceExpectation_EXPECT_NOT_EXIST)
+			_, err = counter.client.PutRow(&tablestore.PutRowRequest{PutRowChange: change})
+			if err == nil {
+				return delta, nil
+			}
+		} else {
+			value, _ := resp.Columns[0].Value.(int64)
+			change := &tablestore.UpdateRowChange{TableName: counter.table, PrimaryKey: pk}
+			change.PutColumn(ValueColumn, value+delta)
+			change.SetCondition(tablestore.RowExistenceExpectation_EXPECT_EXIST)
+			change.SetColumnCondition(tablestore.NewSingleColumnCondition(ValueColumn, tablestore.CT_EQUAL, value))
+			_, err = counter.client.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: change})
+			if err == nil {
+				return value + delta, nil
+			}
+		}
+		if !tablestore.IsConditionCheckFail(err) {
+			return 0, err
+		}
+	}
+	return 0, ErrContention
+}
+
+// Decr subtracts delta from the counter, see Incr.
+func (counter *Counter) Decr(delta int64) (int64, error) {
+	return counter.Incr(-delta)
+}
+
+// shards reads the rows of the counter, whatever the number of shards they
+// were written with.
+func (counter *Counter) shards() ([]*tablestore.Row, error) {
+	start, end := new(tablestore.PrimaryKey), new(tablestore.PrimaryKey)
+	start.AddPrimaryKeyColumn(NameColumn, counter.name)
+	start.AddPrimaryKeyColumnWithMinValue(ShardColumn)
+	end.AddPrimaryKeyColumn(NameColumn, counter.name)
+	end.AddPrimaryKeyColumnWithMaxValue(ShardColumn)
+	criteria := &tablestore.RangeRowQueryCriteria{TableName: counter.table, StartPrimaryKey: start, EndPrimaryKey: end, MaxVersion: 1, ColumnsToGet: []string{ValueColumn}}
+	var rows []*tablestore.Row
+	for {
+		resp, err := counter.client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: criteria})
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, resp.Rows...)
+		if resp.NextStartPrimaryKey == nil {
+			return rows, nil
+		}
+		criteria.StartPrimaryKey = resp.NextStartPrimaryKey
+	}
+}
+
+// Get returns the value of the counter, the sum of its shards.
+func (counter *Counter) Get() (int64, error) {
+	rows, err := counter.shards()
+	if err != nil {
+		return 0, err
+	}
+	var sum int64
+	for _, row := range rows {
+		for _, column := range row.Columns {
+			if value, ok := column.Value.(int64); ok && column.ColumnName == ValueColumn {
+				sum += value
+			}
+		}
+	}
+	return sum, nil
+}
+
+// Reset sets the counter to 0 by deleting its shards. Increments running
+// meanwhile may be lost or kept.
+func (counter *Counter) Reset() error {
+	rows, err := counter.shards()
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		change := &tablestore.DeleteRowChange{TableName: counter.table, PrimaryKey: row.PrimaryKey}
+		change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		if _, err := counter.client.DeleteRow(&tablestore.DeleteRowRequest{DeleteRowChange: change}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
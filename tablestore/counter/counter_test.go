@@ -0,0 +1,55 @@
+package counter
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"sync"
+	"testing"
+)
+
+func TestCounter(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	client := server.NewTableStoreClient()
+	if err := CreateTable(client, "counters"); err != nil {
+		t.Fatal(err)
+	}
+
+	single := New(client, "counters", "ids", Options{})
+	if value, err := single.Incr(1); err != nil || value != 1 {
+		t.Errorf("value %d, %v", value, err)
+	}
+	if value, err := single.Incr(5); err != nil || value != 6 {
+		t.Errorf("value %d, %v", value, err)
+	}
+	if value, err := single.Decr(2); err != nil || value != 4 {
+		t.Errorf("value %d, %v", value, err)
+	}
+
+	sharded := New(client, "counters", "views", Options{Shards: 4, MaxAttempts: 100})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if _, err := sharded.Incr(1); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if value, err := sharded.Get(); err != nil || value != 80 {
+		t.Errorf("value %d, %v", value, err)
+	}
+	if value, err := single.Get(); err != nil || value != 4 {
+		t.Errorf("counters mixed up: %d, %v", value, err)
+	}
+
+	if err := sharded.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := sharded.Get(); err != nil || value != 0 {
+		t.Errorf("value %d after reset, %v", value, err)
+	}
+}
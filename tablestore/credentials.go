@@ -0,0 +1,52 @@
+package tablestore
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+// credentials sign the requests; they are replaced as a whole, so that a
+// request never mixes the key of ones with the token of others.
+type credentials struct {
+	accessKeyId     string
+	accessKeySecret string
+	securityToken   string
+}
+
+// SetCredentials replaces the credentials signing the requests of the client
+// and of its copies returned by WithContext, e.g. to renew an STS token. It
+// may be called while requests are sent, which are signed with either the
+// former or the new credentials.
+func (tableStoreClient *TableStoreClient) SetCredentials(accessKeyId, accessKeySecret, securityToken string) {
+	tableStoreClient.credentials.Store(&credentials{accessKeyId: accessKeyId, accessKeySecret: accessKeySecret, securityToken: securityToken})
+}
+
+func (tableStoreClient *TableStoreClient) currentCredentials() *credentials {
+	return tableStoreClient.credentials.Load().(*credentials)
+}
+
+func newCredentials(accessKeyId, accessKeySecret, securityToken string) *atomic.Value {
+	value := new(atomic.Value)
+	value.Store(&credentials{accessKeyId: accessKeyId, accessKeySecret: accessKeySecret, securityToken: securityToken})
+	return value
+}
+
+// lockedSource is a rand.Source safe for concurrent use, for the retry pauses
+// of concurrent requests.
+type lockedSource struct {
+	lock   sync.Mutex
+	source rand.Source
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.source.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.source.Seed(seed)
+}
@@ -0,0 +1,169 @@
+package tablestore
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TableDefaults are the options of the requests to a table, applied to the
+// requests which do not set them, so that the policy of a table is set once
+// instead of at each call:
+//
+//	client := tablestore.NewClient(endPoint, instanceName, accessKeyId, accessKeySecret,
+//		tablestore.SetTableDefaults("orders", tablestore.TableDefaults{MaxVersion: 1, CUBudget: 500}))
+type TableDefaults struct {
+	// versions read by GetRow, BatchGetRow and GetRange without a time range
+	MaxVersion int
+	// filter of the rows read
+	Filter ColumnFilter
+	// columns read; the requests reading all the columns of the table have
+	// to name them
+	Columns *ColumnSet
+	// retries and retry time of the requests to the table alone, those of the
+	// client config if 0
+	RetryTimes   uint
+	MaxRetryTime time.Duration
+	// capacity units, reads and writes, the requests to the table alone may
+	// consume per second; requests wait for the next second once they are
+	// consumed. 0 for no budget.
+	CUBudget int64
+}
+
+type tableDefaults struct {
+	TableDefaults
+	budget cuBudget
+}
+
+// SetTableDefaults sets the defaults of the requests to table, replacing those
+// set before.
+func SetTableDefaults(table string, defaults TableDefaults) ClientOption {
+	return func(client *TableStoreClient) {
+		if client.tableDefaults == nil {
+			client.tableDefaults = make(map[string]*tableDefaults)
+		}
+		client.tableDefaults[table] = &tableDefaults{TableDefaults: defaults}
+	}
+}
+
+func (tableStoreClient *TableStoreClient) defaultsOf(table string) *tableDefaults {
+	return tableStoreClient.tableDefaults[table]
+}
+
+func (defaults *tableDefaults) columns() []string {
+	if defaults.Columns == nil {
+		return nil
+	}
+	return defaults.Columns.Names()
+}
+
+func (tableStoreClient *TableStoreClient) getRowDefaults(request *GetRowRequest) *GetRowRequest {
+	defaults := tableStoreClient.defaultsOf(request.SingleRowQueryCriteria.TableName)
+	if defaults == nil {
+		return request
+	}
+	criteria := *request.SingleRowQueryCriteria
+	if criteria.MaxVersion == 0 && criteria.TimeRange == nil {
+		criteria.MaxVersion = int32(defaults.MaxVersion)
+	}
+	if criteria.Filter == nil {
+		criteria.Filter = defaults.Filter
+	}
+	if len(criteria.ColumnsToGet) == 0 {
+		criteria.ColumnsToGet = defaults.columns()
+	}
+	return &GetRowRequest{SingleRowQueryCriteria: &criteria}
+}
+
+func (tableStoreClient *TableStoreClient) batchGetRowDefaults(request *BatchGetRowRequest) *BatchGetRowRequest {
+	if tableStoreClient.tableDefaults == nil {
+		return request
+	}
+	withDefaults := &BatchGetRowRequest{MultiRowQueryCriteria: make([]*MultiRowQueryCriteria, len(request.MultiRowQueryCriteria))}
+	for i, criteria := range request.MultiRowQueryCriteria {
+		withDefaults.MultiRowQueryCriteria[i] = criteria
+		defaults := tableStoreClient.defaultsOf(criteria.TableName)
+		if defaults == nil {
+			continue
+		}
+		c := *criteria
+		if c.MaxVersion == 0 && c.TimeRange == nil {
+			c.MaxVersion = defaults.MaxVersion
+		}
+		if c.Filter == nil {
+			c.Filter = defaults.Filter
+		}
+		if len(c.ColumnsToGet) == 0 {
+			c.ColumnsToGet = defaults.columns()
+		}
+		withDefaults.MultiRowQueryCriteria[i] = &c
+	}
+	return withDefaults
+}
+
+func (tableStoreClient *TableStoreClient) getRangeDefaults(request *GetRangeRequest) *GetRangeRequest {
+	defaults := tableStoreClient.defaultsOf(request.RangeRowQueryCriteria.TableName)
+	if defaults == nil {
+		return request
+	}
+	criteria := *request.RangeRowQueryCriteria
+	if criteria.MaxVersion == 0 && criteria.TimeRange == nil {
+		criteria.MaxVersion = int32(defaults.MaxVersion)
+	}
+	if criteria.Filter == nil {
+		criteria.Filter = defaults.Filter
+	}
+	if len(criteria.ColumnsToGet) == 0 {
+		criteria.ColumnsToGet = defaults.columns()
+	}
+	return &GetRangeRequest{RangeRowQueryCriteria: &criteria}
+}
+
+// retryPolicy returns the retries and retry time of the requests to table.
+func (tableStoreClient *TableStoreClient) retryPolicy(table string) (uint, time.Duration) {
+	retryTimes, maxRetryTime := tableStoreClient.config.RetryTimes, tableStoreClient.config.MaxRetryTime
+	if defaults := tableStoreClient.defaultsOf(table); defaults != nil {
+		if defaults.RetryTimes > 0 {
+			retryTimes = defaults.RetryTimes
+		}
+		if defaults.MaxRetryTime > 0 {
+			maxRetryTime = defaults.MaxRetryTime
+		}
+	}
+	return retryTimes, maxRetryTime
+}
+
+// cuBudget counts the capacity units consumed in the current second.
+type cuBudget struct {
+	mu     sync.Mutex
+	second time.Time
+	spent  int64
+}
+
+// wait waits until less than limit units are consumed in the current second.
+func (budget *cuBudget) wait(ctx context.Context, limit int64) error {
+	for {
+		budget.mu.Lock()
+		now := time.Now()
+		if now.Sub(budget.second) >= time.Second {
+			budget.second, budget.spent = now, 0
+		}
+		if budget.spent < limit {
+			budget.mu.Unlock()
+			return nil
+		}
+		pause := budget.second.Add(time.Second).Sub(now)
+		budget.mu.Unlock()
+		select {
+		case <-time.After(pause):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (budget *cuBudget) spend(units int64) {
+	budget.mu.Lock()
+	budget.spent += units
+	budget.mu.Unlock()
+}
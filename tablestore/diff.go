@@ -0,0 +1,57 @@
+package tablestore
+
+import "reflect"
+
+// DiffRows builds the change turning the row snapshot oldRow into newRow:
+// columns whose latest value differs are put, and columns missing from newRow
+// are deleted (all versions). Older versions in the snapshots are ignored.
+// The change expects the row to exist and has no table name set. It returns
+// nil if the rows hold the same values.
+func DiffRows(oldRow, newRow Row) *UpdateRowChange {
+	oldValues := latestColumnValues(oldRow.Columns)
+	newValues := latestColumnValues(newRow.Columns)
+
+	change := &UpdateRowChange{PrimaryKey: newRow.PrimaryKey}
+	if change.PrimaryKey == nil {
+		change.PrimaryKey = oldRow.PrimaryKey
+	}
+	change.SetCondition(RowExistenceExpectation_EXPECT_EXIST)
+
+	put := make(map[string]bool, len(newValues))
+	for _, column := range newRow.Columns {
+		if put[column.ColumnName] {
+			continue
+		}
+		put[column.ColumnName] = true
+		oldValue, ok := oldValues[column.ColumnName]
+		if !ok || !reflect.DeepEqual(oldValue, column.Value) {
+			change.PutColumn(column.ColumnName, column.Value)
+		}
+	}
+
+	deleted := make(map[string]bool)
+	for _, column := range oldRow.Columns {
+		if _, ok := newValues[column.ColumnName]; ok || deleted[column.ColumnName] {
+			continue
+		}
+		deleted[column.ColumnName] = true
+		change.DeleteColumn(column.ColumnName)
+	}
+
+	if len(change.Columns) == 0 {
+		return nil
+	}
+	return change
+}
+
+// latestColumnValues maps each column name to its first value, which is the
+// latest version in rows returned by the server.
+func latestColumnValues(columns []*AttributeColumn) map[string]interface{} {
+	values := make(map[string]interface{}, len(columns))
+	for _, column := range columns {
+		if _, ok := values[column.ColumnName]; !ok {
+			values[column.ColumnName] = column.Value
+		}
+	}
+	return values
+}
@@ -0,0 +1,118 @@
+package tablestore
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
+	"github.com/golang/protobuf/proto"
+)
+
+// limits of the service checked in dry run mode
+const (
+	maxBatchWriteRows = 200
+	maxRequestSize    = 4 << 20
+	capacityUnitSize  = 4 << 10
+)
+
+// PlannedWrite is a write operation validated and serialized, but not sent,
+// by a client in dry run mode.
+type PlannedWrite struct {
+	Action string
+	// tables written, comma separated
+	Table string
+	Rows  int
+	// size of the serialized request
+	Size int
+	// estimated write capacity units, 1 per started 4KB of each row
+	WriteCU int64
+}
+
+// SetDryRun makes the client plan the operations writing rows or tables
+// instead of sending them, e.g. to review data fixes before running them
+// against production tables. Planned writes are logged at LogInfo and passed
+// to plan if not nil, and succeed with their estimated capacity units; rows
+// are not returned, so PutRow returning primary keys fails. Reads are sent.
+func SetDryRun(plan func(PlannedWrite)) ClientOption {
+	return func(client *TableStoreClient) {
+		client.dryRun = true
+		client.plan = plan
+	}
+}
+
+var writeUris = map[string]bool{
+	createTableUri:       true,
+	deleteTableUri:       true,
+	updateTableUri:       true,
+	putRowUri:            true,
+	updateRowUri:         true,
+	deleteRowUri:         true,
+	batchWriteRowUri:     true,
+	createSearchIndexUri: true,
+	deleteSearchIndexUri: true,
+	createIndexUri:       true,
+	dropIndexUri:         true,
+}
+
+// rowCU estimates the write capacity units of a serialized row.
+func rowCU(row []byte) int32 {
+	return int32(capacityUnits(int64(len(row))))
+}
+
+func consumed(write int32) *otsprotocol.ConsumedCapacity {
+	return &otsprotocol.ConsumedCapacity{CapacityUnit: &otsprotocol.CapacityUnit{Read: proto.Int32(0), Write: proto.Int32(write)}}
+}
+
+// planWrite validates and logs a write in dry run mode, and fills its
+// response as if it succeeded.
+func (tableStoreClient *TableStoreClient) planWrite(uri string, req, resp proto.Message) error {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+	planned := PlannedWrite{Action: actionOf(uri), Table: tableOf(req), Size: len(body)}
+	if planned.Table == "" {
+		return fmt.Errorf("[tablestore] dry run: %s without table name", planned.Action)
+	}
+	if planned.Size > maxRequestSize {
+		return fmt.Errorf("[tablestore] dry run: %s request of %d bytes exceeds %d", planned.Action, planned.Size, maxRequestSize)
+	}
+
+	switch req := req.(type) {
+	case *otsprotocol.PutRowRequest:
+		planned.Rows = 1
+		c := consumed(rowCU(req.Row))
+		resp.(*otsprotocol.PutRowResponse).Consumed = c
+		planned.WriteCU = int64(c.CapacityUnit.GetWrite())
+	case *otsprotocol.UpdateRowRequest:
+		planned.Rows = 1
+		c := consumed(rowCU(req.RowChange))
+		resp.(*otsprotocol.UpdateRowResponse).Consumed = c
+		planned.WriteCU = int64(c.CapacityUnit.GetWrite())
+	case *otsprotocol.DeleteRowRequest:
+		planned.Rows = 1
+		c := consumed(rowCU(req.PrimaryKey))
+		resp.(*otsprotocol.DeleteRowResponse).Consumed = c
+		planned.WriteCU = int64(c.CapacityUnit.GetWrite())
+	case *otsprotocol.BatchWriteRowRequest:
+		response := resp.(*otsprotocol.BatchWriteRowResponse)
+		for _, table := range req.Tables {
+			tableResponse := &otsprotocol.TableInBatchWriteRowResponse{TableName: table.TableName}
+			for _, row := range table.Rows {
+				c := consumed(rowCU(row.RowChange))
+				tableResponse.Rows = append(tableResponse.Rows, &otsprotocol.RowInBatchWriteRowResponse{IsOk: proto.Bool(true), Consumed: c})
+				planned.Rows++
+				planned.WriteCU += int64(c.CapacityUnit.GetWrite())
+			}
+			response.Tables = append(response.Tables, tableResponse)
+		}
+		if planned.Rows > maxBatchWriteRows {
+			return fmt.Errorf("[tablestore] dry run: BatchWriteRow of %d rows exceeds %d", planned.Rows, maxBatchWriteRows)
+		}
+	}
+
+	tableStoreClient.logContext(tableStoreClient.context(), LogInfo, "dry run", LogField("action", uri), LogField("table", planned.Table),
+		LogField("rows", planned.Rows), LogField("size", planned.Size), LogField("writeCU", planned.WriteCU))
+	if tableStoreClient.plan != nil {
+		tableStoreClient.plan(planned)
+	}
+	return nil
+}
@@ -0,0 +1,412 @@
+package dynamo
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+var comparators = map[string]tablestore.ComparatorType{
+	"=":  tablestore.CT_EQUAL,
+	"<>": tablestore.CT_NOT_EQUAL,
+	"<":  tablestore.CT_LESS_THAN,
+	"<=": tablestore.CT_LESS_EQUAL,
+	">":  tablestore.CT_GREATER_THAN,
+	">=": tablestore.CT_GREATER_EQUAL,
+}
+
+func singleCondition(attribute string, comparator tablestore.ComparatorType, av *AttributeValue) (*tablestore.SingleColumnCondition, error) {
+	value, err := av.value()
+	if err != nil {
+		return nil, err
+	}
+	condition := tablestore.NewSingleColumnCondition(attribute, comparator, value)
+	condition.FilterIfMissing = true
+	condition.LatestVersionOnly = true
+	return condition, nil
+}
+
+// columnFilter compiles an expression comparing attributes to a filter.
+func columnFilter(node interface{}) (tablestore.ColumnFilter, error) {
+	switch node := node.(type) {
+	case *comparison:
+		if node.operator != "BETWEEN" {
+			return singleCondition(node.attribute, comparators[node.operator], node.values[0])
+		}
+		low, err := singleCondition(node.attribute, tablestore.CT_GREATER_EQUAL, node.values[0])
+		if err != nil {
+			return nil, err
+		}
+		high, err := singleCondition(node.attribute, tablestore.CT_LESS_EQUAL, node.values[1])
+		if err != nil {
+			return nil, err
+		}
+		filter := tablestore.NewCompositeColumnCondition(tablestore.LO_AND)
+		filter.AddFilter(low)
+		filter.AddFilter(high)
+		return filter, nil
+	case *logical:
+		filter := tablestore.NewCompositeColumnCondition(tablestore.LO_AND)
+		if node.operator == "OR" {
+			filter = tablestore.NewCompositeColumnCondition(tablestore.LO_OR)
+		}
+		for _, operand := range node.operands {
+			compiled, err := columnFilter(operand)
+			if err != nil {
+				return nil, err
+			}
+			filter.AddFilter(compiled)
+		}
+		return filter, nil
+	case *negation:
+		compiled, err := columnFilter(node.operand)
+		if err != nil {
+			return nil, err
+		}
+		filter := tablestore.NewCompositeColumnCondition(tablestore.LO_NOT)
+		filter.AddFilter(compiled)
+		return filter, nil
+	case *function:
+		return nil, fmt.Errorf("[tablestore] dynamo: %s is only supported on key attributes of conditions", node.name)
+	}
+	return nil, fmt.Errorf("[tablestore] dynamo: unsupported expression")
+}
+
+// checkAttributes checks that an expression compiled to a filter compares no
+// key attribute, filters applying to attribute columns only.
+func checkAttributes(node interface{}, keys []string) error {
+	switch node := node.(type) {
+	case *comparison:
+		if isKey(keys, node.attribute) {
+			return fmt.Errorf("[tablestore] dynamo: key attribute %s compared out of a key condition", node.attribute)
+		}
+	case *logical:
+		for _, operand := range node.operands {
+			if err := checkAttributes(operand, keys); err != nil {
+				return err
+			}
+		}
+	case *negation:
+		return checkAttributes(node.operand, keys)
+	}
+	return nil
+}
+
+// filter compiles the operands of a top level AND to a filter, nil if none.
+func filter(nodes []interface{}) (tablestore.ColumnFilter, error) {
+	switch len(nodes) {
+	case 0:
+		return nil, nil
+	case 1:
+		return columnFilter(nodes[0])
+	}
+	return columnFilter(&logical{operator: "AND", operands: nodes})
+}
+
+func isKey(keys []string, attribute string) bool {
+	for _, key := range keys {
+		if key == attribute {
+			return true
+		}
+	}
+	return false
+}
+
+// rowCondition compiles a condition expression of a write.
+func rowCondition(expression string, keys []string, names map[string]string, values map[string]*AttributeValue) (*tablestore.RowCondition, error) {
+	condition := &tablestore.RowCondition{RowExistenceExpectation: tablestore.RowExistenceExpectation_IGNORE}
+	if strings.TrimSpace(expression) == "" {
+		return condition, nil
+	}
+	node, err := parseExpression(expression, names, values)
+	if err != nil {
+		return nil, err
+	}
+	var others []interface{}
+	for _, node := range conjuncts(node) {
+		if f, ok := node.(*function); ok && f.name != "begins_with" && isKey(keys, f.attribute) {
+			if f.name == "attribute_exists" {
+				condition.RowExistenceExpectation = tablestore.RowExistenceExpectation_EXPECT_EXIST
+			} else {
+				condition.RowExistenceExpectation = tablestore.RowExistenceExpectation_EXPECT_NOT_EXIST
+			}
+			continue
+		}
+		if err := checkAttributes(node, keys); err != nil {
+			return nil, err
+		}
+		others = append(others, node)
+	}
+	if condition.ColumnCondition, err = filter(others); err != nil {
+		return nil, err
+	}
+	return condition, nil
+}
+
+// queryPlan is a query compiled to the range of the partition it scans.
+type queryPlan struct {
+	criteria *tablestore.RangeRowQueryCriteria
+	// the sort key column, and its inclusive lower and exclusive upper
+	// bounds, nil if unbounded
+	sortKey      string
+	lower, upper interface{}
+	backward     bool
+	// no item can match
+	empty bool
+}
+
+func planQuery(input *QueryInput, keys []string) (*queryPlan, error) {
+	node, err := parseExpression(input.KeyConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	// tables without sort key hold one item per partition
+	plan := &queryPlan{backward: len(keys) > 1 && input.ScanIndexForward != nil && !*input.ScanIndexForward}
+	var partition interface{}
+	for _, node := range conjuncts(node) {
+		var attribute string
+		switch node := node.(type) {
+		case *comparison:
+			attribute = node.attribute
+		case *function:
+			attribute = node.attribute
+		}
+		switch {
+		case attribute == keys[0] && partition == nil:
+			c, ok := node.(*comparison)
+			if !ok || c.operator != "=" {
+				return nil, fmt.Errorf("[tablestore] dynamo: the partition key %s must be compared with =", keys[0])
+			}
+			if partition, err = c.values[0].value(); err != nil {
+				return nil, err
+			}
+		case len(keys) > 1 && attribute == keys[1] && plan.sortKey == "":
+			plan.sortKey = attribute
+			if err := plan.bound(node); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("[tablestore] dynamo: unsupported key condition %q", input.KeyConditionExpression)
+		}
+	}
+	if partition == nil {
+		return nil, fmt.Errorf("[tablestore] dynamo: key condition without partition key %s", keys[0])
+	}
+
+	// [start, end) forward; backward, from the upper bound down to the
+	// start of the partition, until rows fall below the lower bound
+	start, end := new(tablestore.PrimaryKey), new(tablestore.PrimaryKey)
+	start.AddPrimaryKeyColumn(keys[0], partition)
+	end.AddPrimaryKeyColumn(keys[0], partition)
+	lower, upper := plan.lower, plan.upper
+	if plan.backward {
+		lower = nil
+	}
+	fill := func(pk *tablestore.PrimaryKey, value interface{}, isEnd bool) {
+		for i, key := range keys[1:] {
+			switch {
+			case i == 0 && value != nil:
+				pk.AddPrimaryKeyColumn(key, value)
+			case isEnd && (i == 0 || value == nil):
+				pk.AddPrimaryKeyColumnWithMaxValue(key)
+			default:
+				pk.AddPrimaryKeyColumnWithMinValue(key)
+			}
+		}
+	}
+	fill(start, lower, false)
+	fill(end, upper, true)
+	if len(keys) == 1 {
+		end = new(tablestore.PrimaryKey)
+		if next, ok := successor(partition); ok {
+			end.AddPrimaryKeyColumn(keys[0], next)
+		} else {
+			end.AddPrimaryKeyColumnWithMaxValue(keys[0])
+		}
+	}
+	plan.criteria = &tablestore.RangeRowQueryCriteria{TableName: input.TableName, StartPrimaryKey: start, EndPrimaryKey: end,
+		MaxVersion: 1, Direction: tablestore.FORWARD}
+	if plan.backward {
+		plan.criteria.StartPrimaryKey, plan.criteria.EndPrimaryKey = end, start
+		plan.criteria.Direction = tablestore.BACKWARD
+	}
+	if plan.criteria.ColumnsToGet, err = projection(input.ProjectionExpression, input.ExpressionAttributeNames); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(input.FilterExpression) != "" {
+		node, err := parseExpression(input.FilterExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkAttributes(node, keys); err != nil {
+			return nil, err
+		}
+		if plan.criteria.Filter, err = columnFilter(node); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// bound sets the bounds of the sort key of a condition on it.
+func (plan *queryPlan) bound(node interface{}) error {
+	values := func(avs ...*AttributeValue) ([]interface{}, error) {
+		var values []interface{}
+		for _, av := range avs {
+			value, err := av.value()
+			if err != nil {
+				return nil, err
+			}
+			switch value.(type) {
+			case int64, string, []byte:
+			default:
+				return nil, fmt.Errorf("[tablestore] dynamo: sort key %s compared to a %T", plan.sortKey, value)
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	}
+	upperAfter := func(value interface{}) {
+		// unbounded past the max integer
+		plan.upper, _ = successor(value)
+	}
+
+	switch node := node.(type) {
+	case *comparison:
+		v, err := values(node.values...)
+		if err != nil {
+			return err
+		}
+		switch node.operator {
+		case "=":
+			plan.lower = v[0]
+			upperAfter(v[0])
+		case "<":
+			plan.upper = v[0]
+		case "<=":
+			upperAfter(v[0])
+		case ">":
+			var ok bool
+			if plan.lower, ok = successor(v[0]); !ok {
+				plan.empty = true
+			}
+		case ">=":
+			plan.lower = v[0]
+		case "BETWEEN":
+			plan.lower = v[0]
+			upperAfter(v[1])
+		default:
+			return fmt.Errorf("[tablestore] dynamo: unsupported operator %s on the sort key %s", node.operator, plan.sortKey)
+		}
+		return nil
+	case *function:
+		if node.name == "begins_with" {
+			v, err := values(node.value)
+			if err != nil {
+				return err
+			}
+			plan.lower = v[0]
+			plan.upper = prefixSuccessor(v[0])
+			return nil
+		}
+	}
+	return fmt.Errorf("[tablestore] dynamo: unsupported condition on the sort key %s", plan.sortKey)
+}
+
+// successor returns the smallest value greater than value, and false if
+// there is none.
+func successor(value interface{}) (interface{}, bool) {
+	switch value := value.(type) {
+	case int64:
+		if value == math.MaxInt64 {
+			return nil, false
+		}
+		return value + 1, true
+	case string:
+		return value + "\x00", true
+	case []byte:
+		return append(append([]byte{}, value...), 0), true
+	}
+	return nil, false
+}
+
+// prefixSuccessor returns the smallest value greater than all the values
+// starting with prefix, nil if there is none.
+func prefixSuccessor(prefix interface{}) interface{} {
+	switch prefix := prefix.(type) {
+	case string:
+		// increment the last rune, strings being valid UTF-8
+		for prefix != "" {
+			r, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+			if r < utf8.MaxRune {
+				if r++; r == 0xd800 {
+					r = 0xe000
+				}
+				return prefix + string(r)
+			}
+		}
+	case []byte:
+		b := append([]byte{}, prefix...)
+		for len(b) > 0 {
+			if b[len(b)-1] < 0xff {
+				b[len(b)-1]++
+				return b
+			}
+			b = b[:len(b)-1]
+		}
+	}
+	return nil
+}
+
+func compareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b)
+		}
+	case int64:
+		if b, ok := b.(int64); ok {
+			switch {
+			case a < b:
+				return -1
+			case a > b:
+				return 1
+			}
+			return 0
+		}
+	case []byte:
+		if b, ok := b.([]byte); ok {
+			return bytes.Compare(a, b)
+		}
+	}
+	return 0
+}
+
+func comparePrimaryKeys(a, b *tablestore.PrimaryKey) int {
+	for i := 0; i < len(a.PrimaryKeys) && i < len(b.PrimaryKeys); i++ {
+		if c := compareValues(a.PrimaryKeys[i].Value, b.PrimaryKeys[i].Value); c != 0 {
+			return c
+		}
+	}
+	return len(a.PrimaryKeys) - len(b.PrimaryKeys)
+}
+
+// match reports whether the sort key of pk is within the bounds, and whether
+// the scan is done, the rows following pk being out of them.
+func (plan *queryPlan) match(pk *tablestore.PrimaryKey) (match, done bool) {
+	if plan.sortKey == "" {
+		return true, false
+	}
+	value := pk.PrimaryKeys[1].Value
+	if plan.lower != nil && compareValues(value, plan.lower) < 0 {
+		return false, plan.backward
+	}
+	if plan.upper != nil && compareValues(value, plan.upper) >= 0 {
+		return false, !plan.backward
+	}
+	return true, false
+}
@@ -0,0 +1,385 @@
+// Package dynamo exposes tables through a subset of the item API of DynamoDB,
+// to ease porting code written against it:
+//
+//	db := dynamo.New(client)
+//	_, err := db.PutItem(&dynamo.PutItemInput{
+//		TableName:           "orders",
+//		Item:                map[string]*dynamo.AttributeValue{"user": dynamo.String("u1"), "id": dynamo.Number("42"), "total": dynamo.Number("9.5")},
+//		ConditionExpression: "attribute_not_exists(id)",
+//	})
+//	out, err := db.Query(&dynamo.QueryInput{
+//		TableName:                 "orders",
+//		KeyConditionExpression:    "#u = :u AND id > :id",
+//		ExpressionAttributeNames:  map[string]string{"#u": "user"},
+//		ExpressionAttributeValues: map[string]*dynamo.AttributeValue{":u": dynamo.String("u1"), ":id": dynamo.Number("40")},
+//	})
+//
+// The first primary key column of a table is its partition key, and the
+// second one, if any, its sort key. Attributes are strings, numbers, binaries
+// and booleans: numbers are stored as integers, or as doubles when they are
+// not integers. Sets, lists, maps and nulls are not supported.
+//
+// Condition expressions may test the existence of the item with
+// attribute_exists and attribute_not_exists on a key attribute, ANDed with
+// comparisons of other attributes. Filter expressions compare attributes
+// other than keys, combined with AND, OR and NOT. Items missing an attribute
+// compared don't match.
+package dynamo
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrConditionalCheckFailed is returned by writes whose condition is not met.
+var ErrConditionalCheckFailed = errors.New("[tablestore] dynamo: the conditional request failed")
+
+// AttributeValue is the value of an attribute, one of its fields being set.
+type AttributeValue struct {
+	S    *string
+	N    *string
+	B    []byte
+	BOOL *bool
+}
+
+func String(s string) *AttributeValue {
+	return &AttributeValue{S: &s}
+}
+
+func Number(n string) *AttributeValue {
+	return &AttributeValue{N: &n}
+}
+
+func Binary(b []byte) *AttributeValue {
+	return &AttributeValue{B: b}
+}
+
+func Bool(b bool) *AttributeValue {
+	return &AttributeValue{BOOL: &b}
+}
+
+// value converts an attribute value to a column value.
+func (av *AttributeValue) value() (interface{}, error) {
+	switch {
+	case av == nil:
+	case av.S != nil:
+		return *av.S, nil
+	case av.N != nil:
+		if n, err := strconv.ParseInt(*av.N, 10, 64); err == nil {
+			return n, nil
+		}
+		n, err := strconv.ParseFloat(*av.N, 64)
+		if err != nil {
+			return nil, fmt.Errorf("[tablestore] dynamo: invalid number %q", *av.N)
+		}
+		return n, nil
+	case av.B != nil:
+		return av.B, nil
+	case av.BOOL != nil:
+		return *av.BOOL, nil
+	}
+	return nil, fmt.Errorf("[tablestore] dynamo: unsupported attribute value")
+}
+
+// attributeValue converts a column value to an attribute value.
+func attributeValue(value interface{}) *AttributeValue {
+	switch value := value.(type) {
+	case string:
+		return String(value)
+	case int64:
+		return Number(strconv.FormatInt(value, 10))
+	case float64:
+		return Number(strconv.FormatFloat(value, 'g', -1, 64))
+	case []byte:
+		return Binary(value)
+	case bool:
+		return Bool(value)
+	}
+	return nil
+}
+
+type GetItemInput struct {
+	TableName string
+	Key       map[string]*AttributeValue
+	// comma separated attributes returned, all by default
+	ProjectionExpression     string
+	ExpressionAttributeNames map[string]string
+}
+
+type GetItemOutput struct {
+	// nil if there is no item of the key
+	Item map[string]*AttributeValue
+}
+
+type PutItemInput struct {
+	TableName                 string
+	Item                      map[string]*AttributeValue
+	ConditionExpression       string
+	ExpressionAttributeNames  map[string]string
+	ExpressionAttributeValues map[string]*AttributeValue
+}
+
+type PutItemOutput struct{}
+
+type DeleteItemInput struct {
+	TableName                 string
+	Key                       map[string]*AttributeValue
+	ConditionExpression       string
+	ExpressionAttributeNames  map[string]string
+	ExpressionAttributeValues map[string]*AttributeValue
+}
+
+type DeleteItemOutput struct{}
+
+type QueryInput struct {
+	TableName string
+	// equality of the partition key, ANDed with a condition on the sort key:
+	// a comparison, BETWEEN or begins_with
+	KeyConditionExpression    string
+	FilterExpression          string
+	ProjectionExpression      string
+	ExpressionAttributeNames  map[string]string
+	ExpressionAttributeValues map[string]*AttributeValue
+	// max items returned, unlimited if 0
+	Limit int32
+	// key of the last item of the previous page
+	ExclusiveStartKey map[string]*AttributeValue
+	// items in descending sort key order if false
+	ScanIndexForward *bool
+}
+
+type QueryOutput struct {
+	Items []map[string]*AttributeValue
+	Count int32
+	// key of the last item returned, to pass as ExclusiveStartKey to read
+	// the next page, nil on the last page
+	LastEvaluatedKey map[string]*AttributeValue
+}
+
+// Client runs DynamoDB operations on tables. It is safe for concurrent use.
+type Client struct {
+	client tablestore.TableStoreApi
+
+	lock sync.Mutex
+	// primary key column names of the tables described
+	keys map[string][]string
+}
+
+func New(client tablestore.TableStoreApi) *Client {
+	return &Client{client: client, keys: make(map[string][]string)}
+}
+
+// keySchema returns the names of the primary key columns of table.
+func (client *Client) keySchema(table string) ([]string, error) {
+	client.lock.Lock()
+	keys, ok := client.keys[table]
+	client.lock.Unlock()
+	if ok {
+		return keys, nil
+	}
+	resp, err := client.client.DescribeTable(&tablestore.DescribeTableRequest{TableName: table})
+	if err != nil {
+		return nil, err
+	}
+	for _, schema := range resp.TableMeta.SchemaEntry {
+		keys = append(keys, *schema.Name)
+	}
+	client.lock.Lock()
+	client.keys[table] = keys
+	client.lock.Unlock()
+	return keys, nil
+}
+
+// primaryKey builds the primary key of table from the key attributes of item.
+func (client *Client) primaryKey(table string, item map[string]*AttributeValue) (*tablestore.PrimaryKey, []string, error) {
+	keys, err := client.keySchema(table)
+	if err != nil {
+		return nil, nil, err
+	}
+	pk := new(tablestore.PrimaryKey)
+	for _, key := range keys {
+		value, err := item[key].value()
+		if err != nil {
+			return nil, nil, fmt.Errorf("[tablestore] dynamo: key attribute %s: %v", key, err)
+		}
+		pk.AddPrimaryKeyColumn(key, value)
+	}
+	return pk, keys, nil
+}
+
+// item converts a row to an item.
+func item(pk *tablestore.PrimaryKey, columns []*tablestore.AttributeColumn) map[string]*AttributeValue {
+	item := make(map[string]*AttributeValue, len(pk.PrimaryKeys)+len(columns))
+	for _, column := range pk.PrimaryKeys {
+		item[column.ColumnName] = attributeValue(column.Value)
+	}
+	for _, column := range columns {
+		if _, ok := item[column.ColumnName]; !ok {
+			item[column.ColumnName] = attributeValue(column.Value)
+		}
+	}
+	return item
+}
+
+// projection returns the attributes of a projection expression.
+func projection(expression string, names map[string]string) ([]string, error) {
+	if strings.TrimSpace(expression) == "" {
+		return nil, nil
+	}
+	var columns []string
+	for _, name := range strings.Split(expression, ",") {
+		name = strings.TrimSpace(name)
+		if strings.HasPrefix(name, "#") {
+			resolved, ok := names[name]
+			if !ok {
+				return nil, fmt.Errorf("[tablestore] dynamo: undefined attribute name %s", name)
+			}
+			name = resolved
+		}
+		columns = append(columns, name)
+	}
+	return columns, nil
+}
+
+func (client *Client) GetItem(input *GetItemInput) (*GetItemOutput, error) {
+	pk, _, err := client.primaryKey(input.TableName, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := projection(input.ProjectionExpression, input.ExpressionAttributeNames)
+	if err != nil {
+		return nil, err
+	}
+	criteria := &tablestore.SingleRowQueryCriteria{TableName: input.TableName, PrimaryKey: pk, ColumnsToGet: columns, MaxVersion: 1}
+	resp, err := client.client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.PrimaryKey.PrimaryKeys) == 0 {
+		return &GetItemOutput{}, nil
+	}
+	return &GetItemOutput{Item: item(&resp.PrimaryKey, resp.Columns)}, nil
+}
+
+func (client *Client) PutItem(input *PutItemInput) (*PutItemOutput, error) {
+	pk, keys, err := client.primaryKey(input.TableName, input.Item)
+	if err != nil {
+		return nil, err
+	}
+	condition, err := rowCondition(input.ConditionExpression, keys, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	change := &tablestore.PutRowChange{TableName: input.TableName, PrimaryKey: pk, Condition: condition}
+	isKey := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		isKey[key] = true
+	}
+	for name, av := range input.Item {
+		if isKey[name] {
+			continue
+		}
+		value, err := av.value()
+		if err != nil {
+			return nil, fmt.Errorf("[tablestore] dynamo: attribute %s: %v", name, err)
+		}
+		change.AddColumn(name, value)
+	}
+	if _, err := client.client.PutRow(&tablestore.PutRowRequest{PutRowChange: change}); err != nil {
+		if tablestore.IsConditionCheckFail(err) {
+			return nil, ErrConditionalCheckFailed
+		}
+		return nil, err
+	}
+	return &PutItemOutput{}, nil
+}
+
+func (client *Client) DeleteItem(input *DeleteItemInput) (*DeleteItemOutput, error) {
+	pk, keys, err := client.primaryKey(input.TableName, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	condition, err := rowCondition(input.ConditionExpression, keys, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+	change := &tablestore.DeleteRowChange{TableName: input.TableName, PrimaryKey: pk, Condition: condition}
+	if _, err := client.client.DeleteRow(&tablestore.DeleteRowRequest{DeleteRowChange: change}); err != nil {
+		if tablestore.IsConditionCheckFail(err) {
+			return nil, ErrConditionalCheckFailed
+		}
+		return nil, err
+	}
+	return &DeleteItemOutput{}, nil
+}
+
+func (client *Client) Query(input *QueryInput) (*QueryOutput, error) {
+	keys, err := client.keySchema(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := planQuery(input, keys)
+	if err != nil {
+		return nil, err
+	}
+	output := &QueryOutput{}
+	if plan.empty {
+		return output, nil
+	}
+	criteria := plan.criteria
+	var skip *tablestore.PrimaryKey
+	if input.ExclusiveStartKey != nil {
+		if skip, _, err = client.primaryKey(input.TableName, input.ExclusiveStartKey); err != nil {
+			return nil, err
+		}
+		criteria.StartPrimaryKey = skip
+	}
+
+	var last *tablestore.PrimaryKey
+	for {
+		if input.Limit > 0 {
+			criteria.Limit = input.Limit - output.Count
+			if skip != nil {
+				criteria.Limit++
+			}
+		}
+		resp, err := client.client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: criteria})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range resp.Rows {
+			if skip != nil {
+				equal := comparePrimaryKeys(row.PrimaryKey, skip) == 0
+				skip = nil
+				if equal {
+					continue
+				}
+			}
+			if match, done := plan.match(row.PrimaryKey); done {
+				return output, nil
+			} else if !match {
+				continue
+			}
+			output.Items = append(output.Items, item(row.PrimaryKey, row.Columns))
+			output.Count++
+			last = row.PrimaryKey
+			if input.Limit > 0 && output.Count == input.Limit {
+				output.LastEvaluatedKey = item(last, nil)
+				return output, nil
+			}
+		}
+		skip = nil
+		if resp.NextStartPrimaryKey == nil {
+			return output, nil
+		}
+		if last != nil {
+			output.LastEvaluatedKey = item(last, nil)
+			return output, nil
+		}
+		criteria.StartPrimaryKey = resp.NextStartPrimaryKey
+	}
+}
@@ -0,0 +1,153 @@
+package dynamo
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"testing"
+)
+
+func ids(items []map[string]*AttributeValue) []string {
+	var ids []string
+	for _, item := range items {
+		ids = append(ids, *item["id"].N)
+	}
+	return ids
+}
+
+// query returns the ids of the pages of items of input.
+func query(db *Client, input *QueryInput) ([][]string, error) {
+	var pages [][]string
+	for {
+		out, err := db.Query(input)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, ids(out.Items))
+		if out.LastEvaluatedKey == nil {
+			return pages, nil
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+func concat(pages [][]string) []string {
+	var all []string
+	for _, page := range pages {
+		all = append(all, page...)
+	}
+	return all
+}
+
+func TestItems(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	server.Store.RangeLimit = 2
+	client := server.NewTableStoreClient()
+	meta := &tablestore.TableMeta{TableName: "orders"}
+	meta.AddPrimaryKeyColumn("user", tablestore.PrimaryKeyType_STRING)
+	meta.AddPrimaryKeyColumn("id", tablestore.PrimaryKeyType_INTEGER)
+	if _, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+		t.Fatal(err)
+	}
+	db := New(client)
+
+	for i := 1; i <= 6; i++ {
+		status := "open"
+		if i%2 == 0 {
+			status = "closed"
+		}
+		_, err := db.PutItem(&PutItemInput{
+			TableName:           "orders",
+			Item:                map[string]*AttributeValue{"user": String("u1"), "id": Number(fmt.Sprint(i)), "status": String(status), "total": Number("9.5")},
+			ConditionExpression: "attribute_not_exists(id)",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.PutItem(&PutItemInput{TableName: "orders", Item: map[string]*AttributeValue{"user": String("u2"), "id": Number("1")}}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := db.PutItem(&PutItemInput{TableName: "orders", Item: map[string]*AttributeValue{"user": String("u1"), "id": Number("1")},
+		ConditionExpression: "attribute_not_exists(id)"})
+	if err != ErrConditionalCheckFailed {
+		t.Errorf("existing item overwritten: %v", err)
+	}
+
+	out, err := db.GetItem(&GetItemInput{TableName: "orders", Key: map[string]*AttributeValue{"user": String("u1"), "id": Number("2")}})
+	if err != nil || out.Item == nil || *out.Item["status"].S != "closed" || *out.Item["total"].N != "9.5" || *out.Item["user"].S != "u1" {
+		t.Fatalf("unexpected item %+v, %v", out, err)
+	}
+	out, err = db.GetItem(&GetItemInput{TableName: "orders", Key: map[string]*AttributeValue{"user": String("u1"), "id": Number("9")}})
+	if err != nil || out.Item != nil {
+		t.Errorf("unexpected item %+v, %v", out, err)
+	}
+
+	values := map[string]*AttributeValue{":u": String("u1"), ":lo": Number("2"), ":hi": Number("5"), ":s": String("open")}
+	names := map[string]string{"#u": "user", "#s": "status"}
+	backward := false
+	for _, test := range []struct {
+		condition, filter string
+		backward          bool
+		expected          string
+	}{
+		{condition: "#u = :u", expected: "[1 2 3 4 5 6]"},
+		{condition: "#u = :u AND id BETWEEN :lo AND :hi", expected: "[2 3 4 5]"},
+		{condition: "#u = :u AND id > :lo", expected: "[3 4 5 6]"},
+		{condition: "#u = :u AND id <= :lo", backward: true, expected: "[2 1]"},
+		{condition: "#u = :u AND id BETWEEN :lo AND :hi", backward: true, expected: "[5 4 3 2]"},
+		{condition: "#u = :u", filter: "#s = :s AND NOT (total > :hi)", expected: "[1 3 5]"},
+		{condition: "#u = :u AND id = :hi", expected: "[5]"},
+	} {
+		input := &QueryInput{TableName: "orders", KeyConditionExpression: test.condition, FilterExpression: test.filter,
+			ExpressionAttributeNames: names, ExpressionAttributeValues: values}
+		if test.backward {
+			input.ScanIndexForward = &backward
+		}
+		pages, err := query(db, input)
+		if err != nil {
+			t.Errorf("%s, %s: %v", test.condition, test.filter, err)
+		} else if items := fmt.Sprint(concat(pages)); items != test.expected {
+			t.Errorf("%s, %s: unexpected items %s", test.condition, test.filter, items)
+		}
+	}
+
+	// pages end at the limit, or at the end of pages of the table
+	server.Store.RangeLimit = 0
+	pages, err := query(db, &QueryInput{TableName: "orders", KeyConditionExpression: "#u = :u", ExpressionAttributeNames: names,
+		ExpressionAttributeValues: values, Limit: 4, ScanIndexForward: &backward})
+	if err != nil || fmt.Sprint(pages) != "[[6 5 4 3] [2 1]]" {
+		t.Errorf("unexpected pages %v, %v", pages, err)
+	}
+
+	_, err = db.DeleteItem(&DeleteItemInput{TableName: "orders", Key: map[string]*AttributeValue{"user": String("u1"), "id": Number("1")},
+		ConditionExpression: "attribute_exists(id) AND #s = :s", ExpressionAttributeNames: names, ExpressionAttributeValues: values})
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = db.DeleteItem(&DeleteItemInput{TableName: "orders", Key: map[string]*AttributeValue{"user": String("u1"), "id": Number("2")},
+		ConditionExpression: "#s = :s", ExpressionAttributeNames: names, ExpressionAttributeValues: values})
+	if err != ErrConditionalCheckFailed {
+		t.Errorf("item deleted despite its condition: %v", err)
+	}
+	if _, err := db.Query(&QueryInput{TableName: "orders", KeyConditionExpression: "#u = :u", FilterExpression: "id > :lo",
+		ExpressionAttributeNames: names, ExpressionAttributeValues: values}); err == nil {
+		t.Error("filter on a key attribute accepted")
+	}
+
+	for _, expression := range []string{"id > :lo", "#u = :u AND begins_with(#s, :s)", "#u = :u AND id < :hi AND id >= :lo", "#u > :u", "#u = :missing", "#u = :u AND"} {
+		if _, err := db.Query(&QueryInput{TableName: "orders", KeyConditionExpression: expression, ExpressionAttributeNames: names,
+			ExpressionAttributeValues: values}); err == nil {
+			t.Errorf("%s: unsupported key condition accepted", expression)
+		}
+	}
+}
+
+func TestPrefixSuccessor(t *testing.T) {
+	for prefix, expected := range map[string]interface{}{"ab": "ac", "a\U0010ffff": "b", "\U0010ffff": nil, "퟿": ""} {
+		if next := prefixSuccessor(prefix); next != expected {
+			t.Errorf("%q: unexpected successor %q", prefix, next)
+		}
+	}
+}
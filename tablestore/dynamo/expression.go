@@ -0,0 +1,256 @@
+package dynamo
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// the nodes of expressions
+type (
+	// comparison of an attribute to values, two for BETWEEN
+	comparison struct {
+		attribute string
+		operator  string
+		values    []*AttributeValue
+	}
+	// call of attribute_exists, attribute_not_exists or begins_with
+	function struct {
+		name      string
+		attribute string
+		value     *AttributeValue
+	}
+	// AND or OR
+	logical struct {
+		operator string
+		operands []interface{}
+	}
+	negation struct {
+		operand interface{}
+	}
+)
+
+// parser parses the subset of DynamoDB expressions supported:
+//
+//	expression := term { OR term }
+//	term       := factor { AND factor }
+//	factor     := NOT factor | ( expression ) | function | comparison
+//	function   := attribute_exists(path) | attribute_not_exists(path) | begins_with(path, :value)
+//	comparison := path (= | <> | < | <= | > | >=) :value | path BETWEEN :value AND :value
+//
+// Paths are attribute names or #names of ExpressionAttributeNames; nested
+// paths are not supported.
+type parser struct {
+	tokens []string
+	names  map[string]string
+	values map[string]*AttributeValue
+}
+
+func parseExpression(expression string, names map[string]string, values map[string]*AttributeValue) (interface{}, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, names: names, values: values}
+	node, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if len(p.tokens) > 0 {
+		return nil, fmt.Errorf("[tablestore] dynamo: unexpected %q in expression %q", p.tokens[0], expression)
+	}
+	return node, nil
+}
+
+func tokenize(expression string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(expression); {
+		c := expression[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case strings.IndexByte("(),=", c) >= 0:
+			tokens = append(tokens, string(c))
+			i++
+		case c == '<' || c == '>':
+			j := i + 1
+			if j < len(expression) && (expression[j] == '=' || c == '<' && expression[j] == '>') {
+				j++
+			}
+			tokens = append(tokens, expression[i:j])
+			i = j
+		case c == '#' || c == ':' || c == '_' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)):
+			j := i + 1
+			for j < len(expression) && (expression[j] == '_' || expression[j] == '-' || unicode.IsLetter(rune(expression[j])) || unicode.IsDigit(rune(expression[j]))) {
+				j++
+			}
+			tokens = append(tokens, expression[i:j])
+			i = j
+		default:
+			return nil, fmt.Errorf("[tablestore] dynamo: unexpected %q in expression %q", c, expression)
+		}
+	}
+	return tokens, nil
+}
+
+func (p *parser) peek() string {
+	if len(p.tokens) == 0 {
+		return ""
+	}
+	return p.tokens[0]
+}
+
+func (p *parser) next() string {
+	token := p.peek()
+	if len(p.tokens) > 0 {
+		p.tokens = p.tokens[1:]
+	}
+	return token
+}
+
+func (p *parser) expect(token string) error {
+	if next := p.next(); !strings.EqualFold(next, token) {
+		return fmt.Errorf("[tablestore] dynamo: expected %q in expression, got %q", token, next)
+	}
+	return nil
+}
+
+func (p *parser) keyword(keyword string) bool {
+	if strings.EqualFold(p.peek(), keyword) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expression() (interface{}, error) {
+	return p.logical("OR", p.term)
+}
+
+func (p *parser) term() (interface{}, error) {
+	return p.logical("AND", p.factor)
+}
+
+func (p *parser) logical(operator string, operand func() (interface{}, error)) (interface{}, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	node := &logical{operator: operator, operands: []interface{}{first}}
+	for p.keyword(operator) {
+		next, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		node.operands = append(node.operands, next)
+	}
+	if len(node.operands) == 1 {
+		return first, nil
+	}
+	return node, nil
+}
+
+func (p *parser) factor() (interface{}, error) {
+	if p.keyword("NOT") {
+		operand, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return &negation{operand: operand}, nil
+	}
+	if p.keyword("(") {
+		node, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		return node, p.expect(")")
+	}
+
+	token := p.next()
+	switch name := strings.ToLower(token); name {
+	case "attribute_exists", "attribute_not_exists", "begins_with":
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		attribute, err := p.path()
+		if err != nil {
+			return nil, err
+		}
+		node := &function{name: name, attribute: attribute}
+		if name == "begins_with" {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+			if node.value, err = p.value(); err != nil {
+				return nil, err
+			}
+		}
+		return node, p.expect(")")
+	}
+
+	p.tokens = append([]string{token}, p.tokens...)
+	attribute, err := p.path()
+	if err != nil {
+		return nil, err
+	}
+	node := &comparison{attribute: attribute, operator: p.next()}
+	switch node.operator = strings.ToUpper(node.operator); node.operator {
+	case "=", "<>", "<", "<=", ">", ">=":
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		node.values = []*AttributeValue{value}
+	case "BETWEEN":
+		low, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		node.values = []*AttributeValue{low, high}
+	default:
+		return nil, fmt.Errorf("[tablestore] dynamo: unsupported operator %q in expression", node.operator)
+	}
+	return node, nil
+}
+
+func (p *parser) path() (string, error) {
+	token := p.next()
+	switch {
+	case strings.HasPrefix(token, "#"):
+		name, ok := p.names[token]
+		if !ok {
+			return "", fmt.Errorf("[tablestore] dynamo: undefined attribute name %s", token)
+		}
+		return name, nil
+	case token == "" || strings.HasPrefix(token, ":") || strings.IndexAny(token, "(),=<>") >= 0:
+		return "", fmt.Errorf("[tablestore] dynamo: expected an attribute in expression, got %q", token)
+	}
+	return token, nil
+}
+
+func (p *parser) value() (*AttributeValue, error) {
+	token := p.next()
+	if !strings.HasPrefix(token, ":") {
+		return nil, fmt.Errorf("[tablestore] dynamo: expected a :value in expression, got %q", token)
+	}
+	value, ok := p.values[token]
+	if !ok {
+		return nil, fmt.Errorf("[tablestore] dynamo: undefined attribute value %s", token)
+	}
+	return value, nil
+}
+
+// conjuncts returns the operands of a top level AND, or node itself.
+func conjuncts(node interface{}) []interface{} {
+	if node, ok := node.(*logical); ok && node.operator == "AND" {
+		return node.operands
+	}
+	return []interface{}{node}
+}
@@ -0,0 +1,455 @@
+// Package encryption encrypts columns holding sensitive data, such as
+// personal data stored in tables shared by several services, in front of a
+// tablestore.TableStoreApi:
+//
+//	provider, err := encryption.NewLocalKeyProvider("k1", map[string][]byte{"k1": masterKey})
+//	client := encryption.New(tablestore.NewClient(endpoint, instance, id, secret), encryption.Config{
+//		Provider: provider,
+//		Columns:  map[string][]string{"users": {"email", "phone"}},
+//	})
+//
+// Values are encrypted by AES-GCM with data keys, themselves encrypted by the
+// master keys of the provider (envelope encryption). The master key id and
+// the encrypted data key of each value are stored in the companion columns
+// named after the column with KeyIdSuffix and DataKeySuffix, which are hidden
+// from the rows read through the client. Values are bound to their table,
+// column and primary key, and can not be decrypted when copied to another
+// cell; the auto increment primary key columns of the rows written with
+// encrypted columns can not be generated by the server.
+//
+// PutRow, UpdateRow and BatchWriteRow encrypt the columns written, GetRow,
+// GetRange and BatchGetRow decrypt the columns read. Encrypted columns can
+// not be compared by filters and conditions. Other methods are passed
+// through.
+package encryption
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// suffixes of the names of the companion columns of encrypted columns
+const (
+	KeyIdSuffix   = "_key_id"
+	DataKeySuffix = "_data_key"
+)
+
+type Config struct {
+	Provider KeyProvider
+	// encrypted columns by table
+	Columns map[string][]string
+	// time a data key encrypts values before a new one is generated, 5
+	// minutes by default
+	DataKeyTTL time.Duration
+}
+
+type dataKey struct {
+	keyId     string
+	encrypted []byte
+	aead      cipher.AEAD
+	expires   time.Time
+}
+
+// Client is a tablestore.TableStoreApi encrypting columns. It is safe for
+// concurrent use if the wrapped client and the provider are.
+type Client struct {
+	tablestore.TableStoreApi
+	config  Config
+	columns map[string]map[string]bool
+
+	lock    sync.Mutex
+	current *dataKey
+	// decrypted data keys, by master key id and encrypted data key
+	keys map[string]cipher.AEAD
+}
+
+var _ tablestore.TableStoreApi = (*Client)(nil)
+
+// maxKeys bounds the decrypted data keys kept.
+const maxKeys = 1000
+
+func New(client tablestore.TableStoreApi, config Config) *Client {
+	if config.DataKeyTTL <= 0 {
+		config.DataKeyTTL = 5 * time.Minute
+	}
+	encryption := &Client{TableStoreApi: client, config: config, columns: make(map[string]map[string]bool), keys: make(map[string]cipher.AEAD)}
+	for table, columns := range config.Columns {
+		encryption.columns[table] = make(map[string]bool)
+		for _, column := range columns {
+			encryption.columns[table][column] = true
+		}
+	}
+	return encryption
+}
+
+func (encryption *Client) encrypted(table, column string) bool {
+	return encryption.columns[table][column]
+}
+
+// dataKey returns the data key encrypting values.
+func (encryption *Client) dataKey() (*dataKey, error) {
+	encryption.lock.Lock()
+	defer encryption.lock.Unlock()
+	if encryption.current != nil && time.Now().Before(encryption.current.expires) {
+		return encryption.current, nil
+	}
+	keyId, plaintext, encrypted, err := encryption.config.Provider.GenerateDataKey()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	encryption.current = &dataKey{keyId: keyId, encrypted: encrypted, aead: aead, expires: time.Now().Add(encryption.config.DataKeyTTL)}
+	return encryption.current, nil
+}
+
+// decryptDataKey returns the data key encrypted by the master key keyId.
+func (encryption *Client) decryptDataKey(keyId string, encrypted []byte) (cipher.AEAD, error) {
+	cacheKey := keyId + "\x00" + string(encrypted)
+	encryption.lock.Lock()
+	aead := encryption.keys[cacheKey]
+	encryption.lock.Unlock()
+	if aead != nil {
+		return aead, nil
+	}
+	plaintext, err := encryption.config.Provider.DecryptDataKey(keyId, encrypted)
+	if err != nil {
+		return nil, err
+	}
+	if aead, err = newAEAD(plaintext); err != nil {
+		return nil, err
+	}
+	encryption.lock.Lock()
+	if len(encryption.keys) >= maxKeys {
+		encryption.keys = make(map[string]cipher.AEAD)
+	}
+	encryption.keys[cacheKey] = aead
+	encryption.lock.Unlock()
+	return aead, nil
+}
+
+// type tags of the plaintexts of values
+const (
+	tagString  = 's'
+	tagInteger = 'i'
+	tagDouble  = 'd'
+	tagBoolean = 'b'
+	tagBinary  = 'x'
+)
+
+func marshal(value interface{}) ([]byte, error) {
+	switch value := value.(type) {
+	case string:
+		return append([]byte{tagString}, value...), nil
+	case int64:
+		b := make([]byte, 9)
+		b[0] = tagInteger
+		binary.BigEndian.PutUint64(b[1:], uint64(value))
+		return b, nil
+	case float64:
+		b := make([]byte, 9)
+		b[0] = tagDouble
+		binary.BigEndian.PutUint64(b[1:], math.Float64bits(value))
+		return b, nil
+	case bool:
+		if value {
+			return []byte{tagBoolean, 1}, nil
+		}
+		return []byte{tagBoolean, 0}, nil
+	case []byte:
+		return append([]byte{tagBinary}, value...), nil
+	}
+	return nil, fmt.Errorf("[tablestore] unsupported value %T", value)
+}
+
+func unmarshal(b []byte) (interface{}, error) {
+	if len(b) == 0 {
+		return nil, fmt.Errorf("[tablestore] empty plaintext")
+	}
+	switch b[0] {
+	case tagString:
+		return string(b[1:]), nil
+	case tagInteger:
+		if len(b) == 9 {
+			return int64(binary.BigEndian.Uint64(b[1:])), nil
+		}
+	case tagDouble:
+		if len(b) == 9 {
+			return math.Float64frombits(binary.BigEndian.Uint64(b[1:])), nil
+		}
+	case tagBoolean:
+		if len(b) == 2 {
+			return b[1] == 1, nil
+		}
+	case tagBinary:
+		return b[1:], nil
+	}
+	return nil, fmt.Errorf("[tablestore] invalid plaintext of type %c", b[0])
+}
+
+// additional binds ciphertexts to their table, column and row, whose
+// primary key is serialized by PrimaryKey.Build.
+func additional(table, column string, pk []byte) []byte {
+	return append([]byte(table+"\x00"+column+"\x00"), pk...)
+}
+
+// rowKey returns the serialized primary key of a row written with encrypted
+// columns, which can not be generated by the server.
+func rowKey(table string, pk *tablestore.PrimaryKey) ([]byte, error) {
+	if err := pk.Err(); err != nil {
+		return nil, err
+	}
+	for _, column := range pk.PrimaryKeys {
+		if column.PrimaryKeyOption != tablestore.NONE {
+			return nil, fmt.Errorf("[tablestore] encrypted columns written to %s with the primary key column %s not set", table, column.ColumnName)
+		}
+	}
+	return pk.Build(false), nil
+}
+
+// encrypt returns the encrypted value, and the values of its companion
+// columns.
+func (encryption *Client) encrypt(table, column string, pk []byte, value interface{}) (ciphertext []byte, keyId string, encrypted []byte, err error) {
+	plaintext, err := marshal(value)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	key, err := encryption.dataKey()
+	if err != nil {
+		return nil, "", nil, err
+	}
+	ciphertext, err = seal(key.aead, plaintext, additional(table, column, pk))
+	return ciphertext, key.keyId, key.encrypted, err
+}
+
+func (encryption *Client) encryptPut(change *tablestore.PutRowChange) (*tablestore.PutRowChange, error) {
+	if encryption.columns[change.TableName] == nil {
+		return change, nil
+	}
+	var pk []byte
+	encrypted := *change
+	encrypted.Columns = make([]tablestore.AttributeColumn, 0, len(change.Columns))
+	for _, column := range change.Columns {
+		if !encryption.encrypted(change.TableName, column.ColumnName) {
+			encrypted.Columns = append(encrypted.Columns, column)
+			continue
+		}
+		if pk == nil {
+			var err error
+			if pk, err = rowKey(change.TableName, change.PrimaryKey); err != nil {
+				return nil, err
+			}
+		}
+		ciphertext, keyId, dataKey, err := encryption.encrypt(change.TableName, column.ColumnName, pk, column.Value)
+		if err != nil {
+			return nil, err
+		}
+		encrypted.Columns = append(encrypted.Columns,
+			tablestore.AttributeColumn{ColumnName: column.ColumnName, Value: ciphertext, Timestamp: column.Timestamp},
+			tablestore.AttributeColumn{ColumnName: column.ColumnName + KeyIdSuffix, Value: keyId, Timestamp: column.Timestamp},
+			tablestore.AttributeColumn{ColumnName: column.ColumnName + DataKeySuffix, Value: dataKey, Timestamp: column.Timestamp})
+	}
+	return &encrypted, nil
+}
+
+func (encryption *Client) encryptUpdate(change *tablestore.UpdateRowChange) (*tablestore.UpdateRowChange, error) {
+	if encryption.columns[change.TableName] == nil {
+		return change, nil
+	}
+	var pk []byte
+	encrypted := *change
+	encrypted.Columns = make([]tablestore.ColumnToUpdate, 0, len(change.Columns))
+	for _, column := range change.Columns {
+		if !encryption.encrypted(change.TableName, column.ColumnName) {
+			encrypted.Columns = append(encrypted.Columns, column)
+			continue
+		}
+		keyId, dataKey := column, column
+		keyId.ColumnName += KeyIdSuffix
+		dataKey.ColumnName += DataKeySuffix
+		if !column.HasType {
+			if pk == nil {
+				var err error
+				if pk, err = rowKey(change.TableName, change.PrimaryKey); err != nil {
+					return nil, err
+				}
+			}
+			ciphertext, id, key, err := encryption.encrypt(change.TableName, column.ColumnName, pk, column.Value)
+			if err != nil {
+				return nil, err
+			}
+			column.Value, keyId.Value, dataKey.Value = ciphertext, id, key
+		}
+		// deletions delete the companion columns alike
+		encrypted.Columns = append(encrypted.Columns, column, keyId, dataKey)
+	}
+	return &encrypted, nil
+}
+
+func (encryption *Client) PutRow(request *tablestore.PutRowRequest) (*tablestore.PutRowResponse, error) {
+	change, err := encryption.encryptPut(request.PutRowChange)
+	if err != nil {
+		return nil, err
+	}
+	return encryption.TableStoreApi.PutRow(&tablestore.PutRowRequest{PutRowChange: change})
+}
+
+func (encryption *Client) UpdateRow(request *tablestore.UpdateRowRequest) (*tablestore.UpdateRowResponse, error) {
+	change, err := encryption.encryptUpdate(request.UpdateRowChange)
+	if err != nil {
+		return nil, err
+	}
+	return encryption.TableStoreApi.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: change})
+}
+
+func (encryption *Client) BatchWriteRow(request *tablestore.BatchWriteRowRequest) (*tablestore.BatchWriteRowResponse, error) {
+	encrypted := &tablestore.BatchWriteRowRequest{RowChangesGroupByTable: make(map[string][]tablestore.RowChange)}
+	for table, changes := range request.RowChangesGroupByTable {
+		for _, change := range changes {
+			var err error
+			switch c := change.(type) {
+			case *tablestore.PutRowChange:
+				change, err = encryption.encryptPut(c)
+			case *tablestore.UpdateRowChange:
+				change, err = encryption.encryptUpdate(c)
+			}
+			if err != nil {
+				return nil, err
+			}
+			encrypted.RowChangesGroupByTable[table] = append(encrypted.RowChangesGroupByTable[table], change)
+		}
+	}
+	return encryption.TableStoreApi.BatchWriteRow(encrypted)
+}
+
+// columnsToGet adds the companion columns of the encrypted columns to get.
+func (encryption *Client) columnsToGet(table string, columns []string) []string {
+	var companions []string
+	for _, column := range columns {
+		if encryption.encrypted(table, column) {
+			companions = append(companions, column+KeyIdSuffix, column+DataKeySuffix)
+		}
+	}
+	if companions == nil {
+		return columns
+	}
+	return append(append([]string(nil), columns...), companions...)
+}
+
+// companion reports whether column is a companion column of an encrypted
+// column.
+func (encryption *Client) companion(table, column string) bool {
+	for _, suffix := range []string{KeyIdSuffix, DataKeySuffix} {
+		if strings.HasSuffix(column, suffix) && encryption.encrypted(table, strings.TrimSuffix(column, suffix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// decrypt decrypts the encrypted columns read from the row of table of
+// primary key pk, and removes their companion columns.
+func (encryption *Client) decrypt(table string, pk *tablestore.PrimaryKey, columns []*tablestore.AttributeColumn) ([]*tablestore.AttributeColumn, error) {
+	if encryption.columns[table] == nil || len(columns) == 0 {
+		return columns, nil
+	}
+	key := pk.Build(false)
+	type version struct {
+		column    string
+		timestamp int64
+	}
+	keyIds := make(map[version]string)
+	dataKeys := make(map[version][]byte)
+	for _, column := range columns {
+		if name := strings.TrimSuffix(column.ColumnName, KeyIdSuffix); name != column.ColumnName && encryption.encrypted(table, name) {
+			keyIds[version{name, column.Timestamp}], _ = column.Value.(string)
+		} else if name := strings.TrimSuffix(column.ColumnName, DataKeySuffix); name != column.ColumnName && encryption.encrypted(table, name) {
+			dataKeys[version{name, column.Timestamp}], _ = column.Value.([]byte)
+		}
+	}
+
+	decrypted := columns[:0]
+	for _, column := range columns {
+		if encryption.companion(table, column.ColumnName) {
+			continue
+		}
+		if encryption.encrypted(table, column.ColumnName) {
+			v := version{column.ColumnName, column.Timestamp}
+			ciphertext, ok := column.Value.([]byte)
+			dataKey, found := dataKeys[v]
+			if !ok || !found {
+				return nil, fmt.Errorf("[tablestore] column %s of %s is not encrypted", column.ColumnName, table)
+			}
+			aead, err := encryption.decryptDataKey(keyIds[v], dataKey)
+			if err != nil {
+				return nil, err
+			}
+			plaintext, err := open(aead, ciphertext, additional(table, column.ColumnName, key))
+			if err != nil {
+				return nil, fmt.Errorf("[tablestore] decrypting column %s of %s: %v", column.ColumnName, table, err)
+			}
+			value, err := unmarshal(plaintext)
+			if err != nil {
+				return nil, err
+			}
+			column = &tablestore.AttributeColumn{ColumnName: column.ColumnName, Value: value, Timestamp: column.Timestamp}
+		}
+		decrypted = append(decrypted, column)
+	}
+	return decrypted, nil
+}
+
+func (encryption *Client) GetRow(request *tablestore.GetRowRequest) (*tablestore.GetRowResponse, error) {
+	criteria := *request.SingleRowQueryCriteria
+	criteria.ColumnsToGet = encryption.columnsToGet(criteria.TableName, criteria.ColumnsToGet)
+	response, err := encryption.TableStoreApi.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: &criteria})
+	if err != nil {
+		return response, err
+	}
+	response.Columns, err = encryption.decrypt(criteria.TableName, &response.PrimaryKey, response.Columns)
+	return response, err
+}
+
+func (encryption *Client) GetRange(request *tablestore.GetRangeRequest) (*tablestore.GetRangeResponse, error) {
+	criteria := *request.RangeRowQueryCriteria
+	criteria.ColumnsToGet = encryption.columnsToGet(criteria.TableName, criteria.ColumnsToGet)
+	response, err := encryption.TableStoreApi.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: &criteria})
+	if err != nil {
+		return response, err
+	}
+	for _, row := range response.Rows {
+		if row.Columns, err = encryption.decrypt(criteria.TableName, row.PrimaryKey, row.Columns); err != nil {
+			return response, err
+		}
+	}
+	return response, nil
+}
+
+func (encryption *Client) BatchGetRow(request *tablestore.BatchGetRowRequest) (*tablestore.BatchGetRowResponse, error) {
+	batch := &tablestore.BatchGetRowRequest{}
+	for _, criteria := range request.MultiRowQueryCriteria {
+		copied := *criteria
+		copied.ColumnsToGet = encryption.columnsToGet(copied.TableName, copied.ColumnsToGet)
+		batch.MultiRowQueryCriteria = append(batch.MultiRowQueryCriteria, &copied)
+	}
+	response, err := encryption.TableStoreApi.BatchGetRow(batch)
+	if err != nil {
+		return response, err
+	}
+	for table, results := range response.TableToRowsResult {
+		for i := range results {
+			if results[i].Columns, err = encryption.decrypt(table, &results[i].PrimaryKey, results[i].Columns); err != nil {
+				return response, err
+			}
+		}
+	}
+	return response, nil
+}
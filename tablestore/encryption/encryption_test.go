@@ -0,0 +1,192 @@
+package encryption
+
+import (
+	"bytes"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"strings"
+	"testing"
+)
+
+func userKey(id string) *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn("id", id)
+	return pk
+}
+
+func columnsOf(columns []*tablestore.AttributeColumn) map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, column := range columns {
+		values[column.ColumnName] = column.Value
+	}
+	return values
+}
+
+func TestClient(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	raw := server.NewTableStoreClient()
+	meta := &tablestore.TableMeta{TableName: "users"}
+	meta.AddPrimaryKeyColumn("id", tablestore.PrimaryKeyType_STRING)
+	if _, err := raw.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+		t.Fatal(err)
+	}
+	k1, k2 := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	provider, err := NewLocalKeyProvider("k1", map[string][]byte{"k1": k1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := New(raw, Config{Provider: provider, Columns: map[string][]string{"users": {"email", "age"}}})
+
+	change := &tablestore.PutRowChange{TableName: "users", PrimaryKey: userKey("u1")}
+	change.AddColumn("email", "a@example.com")
+	change.AddColumn("age", int64(42))
+	change.AddColumn("name", "a")
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: change}); err != nil {
+		t.Fatal(err)
+	}
+	if change.Columns[0].Value != "a@example.com" || len(change.Columns) != 3 {
+		t.Errorf("change modified: %v", change.Columns)
+	}
+
+	criteria := &tablestore.SingleRowQueryCriteria{TableName: "users", PrimaryKey: userKey("u1"), MaxVersion: 1}
+	stored, err := raw.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := columnsOf(stored.Columns)
+	if ciphertext, ok := values["email"].([]byte); !ok || bytes.Contains(ciphertext, []byte("example")) || values["email"+KeyIdSuffix] != "k1" || values["name"] != "a" {
+		t.Errorf("unexpected stored row %v", values)
+	}
+
+	read, err := client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values := columnsOf(read.Columns); len(values) != 3 || values["email"] != "a@example.com" || values["age"] != int64(42) {
+		t.Errorf("unexpected decrypted row %v", values)
+	}
+	projected := &tablestore.SingleRowQueryCriteria{TableName: "users", PrimaryKey: userKey("u1"), MaxVersion: 1, ColumnsToGet: []string{"email"}}
+	read, err = client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: projected})
+	if err != nil || len(read.Columns) != 1 || read.Columns[0].Value != "a@example.com" || len(projected.ColumnsToGet) != 1 {
+		t.Errorf("unexpected projected row %v, %v", read, err)
+	}
+
+	// rotated master keys keep decrypting former rows
+	rotated, err := NewLocalKeyProvider("k2", map[string][]byte{"k1": k1, "k2": k2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = New(raw, Config{Provider: rotated, Columns: map[string][]string{"users": {"email", "age"}}})
+	batch := &tablestore.BatchWriteRowRequest{}
+	put := &tablestore.PutRowChange{TableName: "users", PrimaryKey: userKey("u2")}
+	put.AddColumn("email", "b@example.com")
+	put.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	batch.AddRowChange(put)
+	update := &tablestore.UpdateRowChange{TableName: "users", PrimaryKey: userKey("u1")}
+	update.DeleteColumn("age")
+	update.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	batch.AddRowChange(update)
+	if _, err := client.BatchWriteRow(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	start, end := new(tablestore.PrimaryKey), new(tablestore.PrimaryKey)
+	start.AddPrimaryKeyColumnWithMinValue("id")
+	end.AddPrimaryKeyColumnWithMaxValue("id")
+	ranged, err := client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: &tablestore.RangeRowQueryCriteria{TableName: "users", StartPrimaryKey: start, EndPrimaryKey: end, MaxVersion: 1, Limit: 10}})
+	if err != nil || len(ranged.Rows) != 2 {
+		t.Fatalf("unexpected range %v, %v", ranged, err)
+	}
+	if values := columnsOf(ranged.Rows[0].Columns); len(values) != 2 || values["email"] != "a@example.com" {
+		t.Errorf("unexpected first row %v", values)
+	}
+	if values := columnsOf(ranged.Rows[1].Columns); values["email"] != "b@example.com" {
+		t.Errorf("unexpected second row %v", values)
+	}
+	stored, err = raw.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: &tablestore.SingleRowQueryCriteria{TableName: "users", PrimaryKey: userKey("u2"), MaxVersion: 1, ColumnsToGet: []string{"email" + KeyIdSuffix}}})
+	if err != nil || len(stored.Columns) != 1 || stored.Columns[0].Value != "k2" {
+		t.Errorf("data key not encrypted by the current master key: %v, %v", stored, err)
+	}
+
+	get := &tablestore.BatchGetRowRequest{}
+	multi := &tablestore.MultiRowQueryCriteria{TableName: "users", MaxVersion: 1, ColumnsToGet: []string{"email"}}
+	multi.AddRow(userKey("u1"))
+	multi.AddRow(userKey("u2"))
+	get.MultiRowQueryCriteria = append(get.MultiRowQueryCriteria, multi)
+	results, err := client.BatchGetRow(get)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, email := range []string{"a@example.com", "b@example.com"} {
+		if row := results.TableToRowsResult["users"][i]; len(row.Columns) != 1 || row.Columns[0].Value != email {
+			t.Errorf("unexpected batch row %d: %v", i, row.Columns)
+		}
+	}
+
+	// without the master key, rows can not be decrypted
+	other, _ := NewLocalKeyProvider("k2", map[string][]byte{"k2": k2})
+	client = New(raw, Config{Provider: other, Columns: map[string][]string{"users": {"email"}}})
+	if _, err := client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria}); err == nil {
+		t.Error("row decrypted without its master key")
+	}
+}
+
+func TestRowBinding(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	raw := server.NewTableStoreClient()
+	meta := &tablestore.TableMeta{TableName: "users"}
+	meta.AddPrimaryKeyColumn("id", tablestore.PrimaryKeyType_STRING)
+	if _, err := raw.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+		t.Fatal(err)
+	}
+	provider, err := NewLocalKeyProvider("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := New(raw, Config{Provider: provider, Columns: map[string][]string{"users": {"email"}}})
+
+	change := &tablestore.PutRowChange{TableName: "users", PrimaryKey: userKey("u1")}
+	change.AddColumn("email", "a@example.com")
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: change}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the encrypted columns of u1 copied to u2 are not decrypted as u2's
+	criteria := &tablestore.SingleRowQueryCriteria{TableName: "users", PrimaryKey: userKey("u1"), MaxVersion: 1}
+	stored, err := raw.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied := &tablestore.PutRowChange{TableName: "users", PrimaryKey: userKey("u2")}
+	for _, column := range stored.Columns {
+		copied.AddColumn(column.ColumnName, column.Value)
+	}
+	copied.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	if _, err := raw.PutRow(&tablestore.PutRowRequest{PutRowChange: copied}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: &tablestore.SingleRowQueryCriteria{TableName: "users", PrimaryKey: userKey("u2"), MaxVersion: 1}}); err == nil {
+		t.Error("columns of u1 decrypted in u2")
+	}
+	if read, err := client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria}); err != nil || len(read.Columns) != 1 || read.Columns[0].Value != "a@example.com" {
+		t.Errorf("unexpected row %v, %v", read, err)
+	}
+
+	// primary keys generated by the server are unknown when encrypting
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumnWithAutoIncrement("id")
+	generated := &tablestore.PutRowChange{TableName: "users", PrimaryKey: pk}
+	generated.AddColumn("email", "b@example.com")
+	generated.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: generated}); err == nil {
+		t.Error("encrypted columns written with an auto increment primary key")
+	}
+	generated.Columns[0].ColumnName = "name"
+	if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: generated}); err != nil && strings.Contains(err.Error(), "encrypted") {
+		t.Errorf("columns not encrypted refused: %v", err)
+	}
+}
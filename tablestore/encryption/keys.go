@@ -0,0 +1,87 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+)
+
+// KeyProvider generates and decrypts data keys with master keys, e.g. those
+// of a key management service.
+type KeyProvider interface {
+	// GenerateDataKey returns a random data key of 32 bytes, in plaintext and
+	// encrypted by the master key keyId.
+	GenerateDataKey() (keyId string, plaintext, encrypted []byte, err error)
+	// DecryptDataKey decrypts a data key encrypted by the master key keyId.
+	DecryptDataKey(keyId string, encrypted []byte) ([]byte, error)
+}
+
+// LocalKeyProvider is a KeyProvider whose master keys are AES keys held by the
+// process.
+type LocalKeyProvider struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+var _ KeyProvider = (*LocalKeyProvider)(nil)
+
+// NewLocalKeyProvider returns a provider encrypting data keys with the master
+// key current, and decrypting them with any of keys, by id. Keys are rotated
+// by adding a new current key and keeping the former ones.
+func NewLocalKeyProvider(current string, keys map[string][]byte) (*LocalKeyProvider, error) {
+	provider := &LocalKeyProvider{current: current, keys: make(map[string]cipher.AEAD)}
+	for id, key := range keys {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("[tablestore] master key %s: %v", id, err)
+		}
+		provider.keys[id] = aead
+	}
+	if provider.keys[current] == nil {
+		return nil, fmt.Errorf("[tablestore] unknown master key %s", current)
+	}
+	return provider, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext, prefixed by a random nonce.
+func seal(aead cipher.AEAD, plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(aead cipher.AEAD, ciphertext, additional []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, fmt.Errorf("[tablestore] ciphertext too short")
+	}
+	size := aead.NonceSize()
+	return aead.Open(nil, ciphertext[:size], ciphertext[size:], additional)
+}
+
+func (provider *LocalKeyProvider) GenerateDataKey() (string, []byte, []byte, error) {
+	plaintext := make([]byte, 32)
+	if _, err := rand.Read(plaintext); err != nil {
+		return "", nil, nil, err
+	}
+	encrypted, err := seal(provider.keys[provider.current], plaintext, []byte(provider.current))
+	return provider.current, plaintext, encrypted, err
+}
+
+func (provider *LocalKeyProvider) DecryptDataKey(keyId string, encrypted []byte) ([]byte, error) {
+	aead := provider.keys[keyId]
+	if aead == nil {
+		return nil, fmt.Errorf("[tablestore] unknown master key %s", keyId)
+	}
+	return open(aead, encrypted, []byte(keyId))
+}
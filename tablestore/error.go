@@ -21,7 +21,14 @@ var (
 	errTag                     = errors.New("[tablestore] unexpect tag")
 	errNoChecksum              = errors.New("[tablestore] expect checksum")
 	errChecksum                = errors.New("[tablestore] checksum failed")
+	errInvalidHeader           = errors.New("[tablestore] invalid header")
+	errInvalidLength           = errors.New("[tablestore] invalid length")
+	errInvalidValueType        = errors.New("[tablestore] invalid value type")
+	errTrailingData            = errors.New("[tablestore] unexpect data after row")
+	errNoExtension             = errors.New("[tablestore] expect extension in stream record")
 	errInvalidInput            = errors.New("[tablestore] invalid input")
+	errCorruptedSearchResponse = errors.New("[tablestore] corrupted search response")
+	errFrozenRequest           = errors.New("[tablestore] request modified while the client held it, build another one or Clone it")
 )
 
 const (
@@ -35,4 +42,10 @@ const (
 	STORAGE_TIMEOUT       = "OTSTimeout"
 	SERVER_UNAVAILABLE    = "OTSServerUnavailable"
 	INTERNAL_SERVER_ERROR = "OTSInternalServerError"
+
+	CONDITION_CHECK_FAIL = "OTSConditionCheckFail"
+	PARAMETER_INVALID    = "OTSParameterInvalid"
+	OBJECT_NOT_EXIST     = "OTSObjectNotExist"
+
+	UNSUPPORTED_OPERATION = "OTSUnsupportOperation"
 )
@@ -0,0 +1,56 @@
+package tablestore
+
+import "fmt"
+
+// maxBatchGetRows is the number of rows a BatchGetRow reads at most.
+const maxBatchGetRows = 100
+
+// RowExists reports whether the row of pk exists in table. It reads the
+// primary key of the latest version of the row only, the cheapest read.
+func (tableStoreClient *TableStoreClient) RowExists(table string, pk *PrimaryKey) (bool, error) {
+	if pk == nil || len(pk.PrimaryKeys) == 0 {
+		return false, errInvalidInput
+	}
+	criteria := &SingleRowQueryCriteria{TableName: table, PrimaryKey: pk, MaxVersion: 1}
+	criteria.AddColumnToGet(pk.PrimaryKeys[0].ColumnName)
+	resp, err := tableStoreClient.GetRow(&GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil {
+		return false, err
+	}
+	return len(resp.PrimaryKey.PrimaryKeys) > 0, nil
+}
+
+// BatchRowExists reports whether the rows of pks exist in table, in order,
+// reading them as RowExists does by batches of 100 rows.
+func (tableStoreClient *TableStoreClient) BatchRowExists(table string, pks []*PrimaryKey) ([]bool, error) {
+	exists := make([]bool, 0, len(pks))
+	for start := 0; start < len(pks); start += maxBatchGetRows {
+		end := start + maxBatchGetRows
+		if end > len(pks) {
+			end = len(pks)
+		}
+		criteria := &MultiRowQueryCriteria{TableName: table, MaxVersion: 1}
+		for _, pk := range pks[start:end] {
+			if pk == nil || len(pk.PrimaryKeys) == 0 {
+				return nil, errInvalidInput
+			}
+			criteria.AddRow(pk)
+		}
+		criteria.AddColumnToGet(pks[start].PrimaryKeys[0].ColumnName)
+		resp, err := tableStoreClient.BatchGetRow(&BatchGetRowRequest{MultiRowQueryCriteria: []*MultiRowQueryCriteria{criteria}})
+		if err != nil {
+			return nil, err
+		}
+		results := resp.TableToRowsResult[table]
+		if len(results) != end-start {
+			return nil, fmt.Errorf("[tablestore] %d rows read out of %d", len(results), end-start)
+		}
+		for _, result := range results {
+			if !result.IsSucceed {
+				return nil, fmt.Errorf("%s %s %s", result.Error.Code, result.Error.Message, resp.RequestId)
+			}
+			exists = append(exists, len(result.PrimaryKey.PrimaryKeys) > 0)
+		}
+	}
+	return exists, nil
+}
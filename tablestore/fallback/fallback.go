@@ -0,0 +1,206 @@
+// Package fallback keeps the read paths of a tablestore.TableStoreApi up
+// during incidents, by reading from a fallback source, e.g. a replica
+// instance, a cache or a stale local snapshot, the rows the primary fails to
+// read because it is throttled or unavailable:
+//
+//	client := fallback.New(primary, fallback.Config{
+//		Source: replica,
+//		OnFallback: func(action, table string, err, fallbackErr error) {
+//			fallbacks.WithLabelValues(action, table).Inc()
+//		},
+//	})
+//
+// GetRow, BatchGetRow and GetRange fall back; rows read from the source may
+// be stale. Other methods are passed through.
+package fallback
+
+import (
+	"context"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"strings"
+	"sync/atomic"
+)
+
+// codes of the errors falling back by default
+var fallbackCodes = []string{
+	"OTSNotEnoughCapacityUnit",
+	"OTSServerBusy",
+	"OTSQuotaExhausted",
+	"OTSServerUnavailable",
+	"OTSPartitionUnavailable",
+	"OTSTimeout",
+	"OTSInternalServerError",
+	"OTSTableNotReady",
+}
+
+// IsUnavailable reports whether err is the error of a read throttled, or
+// failed because the service is unavailable or unreachable.
+func IsUnavailable(err error) bool {
+	if err == nil || err == context.Canceled || err == context.DeadlineExceeded {
+		return false
+	}
+	message := err.Error()
+	for _, code := range fallbackCodes {
+		if strings.HasPrefix(message, code) {
+			return true
+		}
+	}
+	// errors of the service start with their code, others are transport
+	// errors
+	return !strings.HasPrefix(message, "OTS") && !strings.HasPrefix(message, "[tablestore]")
+}
+
+type Config struct {
+	// Source serves the reads falling back, its GetRow, BatchGetRow and
+	// GetRange only being called, e.g. a client of a replica instance, a
+	// cache.Client or a tablestoretest.Client loaded with a snapshot.
+	Source tablestore.TableStoreApi
+	// tables of the source by table of the primary, the same tables if nil
+	Tables map[string]string
+	// ShouldFallback reports whether a failed read falls back, IsUnavailable
+	// by default.
+	ShouldFallback func(err error) bool
+	// OnFallback is called with every read falling back, the error of the
+	// primary and the one of the source, nil if it succeeded, e.g. to measure
+	// the use of the source.
+	OnFallback func(action, table string, err, fallbackErr error)
+}
+
+// Stats counts the reads of a client.
+type Stats struct {
+	Reads     int64
+	Fallbacks int64
+	// reads failing on the source too
+	Failures int64
+}
+
+// Client is a tablestore.TableStoreApi falling back to a source. It is safe
+// for concurrent use if the wrapped clients are.
+type Client struct {
+	tablestore.TableStoreApi
+	config Config
+
+	reads, fallbacks, failures int64
+}
+
+var _ tablestore.TableStoreApi = (*Client)(nil)
+
+func New(primary tablestore.TableStoreApi, config Config) *Client {
+	if config.ShouldFallback == nil {
+		config.ShouldFallback = IsUnavailable
+	}
+	return &Client{TableStoreApi: primary, config: config}
+}
+
+func (fallback *Client) Stats() Stats {
+	return Stats{
+		Reads:     atomic.LoadInt64(&fallback.reads),
+		Fallbacks: atomic.LoadInt64(&fallback.fallbacks),
+		Failures:  atomic.LoadInt64(&fallback.failures),
+	}
+}
+
+// sourceTable returns the table of the source of table.
+func (fallback *Client) sourceTable(table string) (string, bool) {
+	if fallback.config.Tables == nil {
+		return table, true
+	}
+	source, ok := fallback.config.Tables[table]
+	return source, ok
+}
+
+// fallBack reports whether a read of tables failing with err falls back.
+func (fallback *Client) fallBack(err error, tables ...string) bool {
+	atomic.AddInt64(&fallback.reads, 1)
+	if err == nil || fallback.config.Source == nil || !fallback.config.ShouldFallback(err) {
+		return false
+	}
+	for _, table := range tables {
+		if _, ok := fallback.sourceTable(table); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// done records a read falling back. It returns the error of the read, the
+// one of the primary if the source failed too.
+func (fallback *Client) done(action, table string, err, fallbackErr error) error {
+	atomic.AddInt64(&fallback.fallbacks, 1)
+	if fallbackErr != nil {
+		atomic.AddInt64(&fallback.failures, 1)
+	}
+	if fallback.config.OnFallback != nil {
+		fallback.config.OnFallback(action, table, err, fallbackErr)
+	}
+	if fallbackErr != nil {
+		return err
+	}
+	return nil
+}
+
+func (fallback *Client) GetRow(request *tablestore.GetRowRequest) (*tablestore.GetRowResponse, error) {
+	response, err := fallback.TableStoreApi.GetRow(request)
+	table := request.SingleRowQueryCriteria.TableName
+	if !fallback.fallBack(err, table) {
+		return response, err
+	}
+	criteria := *request.SingleRowQueryCriteria
+	criteria.TableName, _ = fallback.sourceTable(table)
+	response, fallbackErr := fallback.config.Source.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: &criteria})
+	if err := fallback.done("GetRow", table, err, fallbackErr); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// BatchGetRow falls back for whole requests, not for the rows failing in
+// successful ones.
+func (fallback *Client) BatchGetRow(request *tablestore.BatchGetRowRequest) (*tablestore.BatchGetRowResponse, error) {
+	response, err := fallback.TableStoreApi.BatchGetRow(request)
+	var tables []string
+	for _, criteria := range request.MultiRowQueryCriteria {
+		tables = append(tables, criteria.TableName)
+	}
+	if !fallback.fallBack(err, tables...) {
+		return response, err
+	}
+	batch := &tablestore.BatchGetRowRequest{}
+	sourceTables := make(map[string]string)
+	for _, criteria := range request.MultiRowQueryCriteria {
+		source, _ := fallback.sourceTable(criteria.TableName)
+		copied := *criteria
+		copied.TableName = source
+		sourceTables[source] = criteria.TableName
+		batch.MultiRowQueryCriteria = append(batch.MultiRowQueryCriteria, &copied)
+	}
+	response, fallbackErr := fallback.config.Source.BatchGetRow(batch)
+	if err := fallback.done("BatchGetRow", strings.Join(tables, ","), err, fallbackErr); err != nil {
+		return nil, err
+	}
+	// results by table of the primary
+	results := make(map[string][]tablestore.RowResult, len(response.TableToRowsResult))
+	for source, rows := range response.TableToRowsResult {
+		for i := range rows {
+			rows[i].TableName = sourceTables[source]
+		}
+		results[sourceTables[source]] = rows
+	}
+	response.TableToRowsResult = results
+	return response, nil
+}
+
+func (fallback *Client) GetRange(request *tablestore.GetRangeRequest) (*tablestore.GetRangeResponse, error) {
+	response, err := fallback.TableStoreApi.GetRange(request)
+	table := request.RangeRowQueryCriteria.TableName
+	if !fallback.fallBack(err, table) {
+		return response, err
+	}
+	criteria := *request.RangeRowQueryCriteria
+	criteria.TableName, _ = fallback.sourceTable(table)
+	response, fallbackErr := fallback.config.Source.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: &criteria})
+	if err := fallback.done("GetRange", table, err, fallbackErr); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
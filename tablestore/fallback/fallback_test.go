@@ -0,0 +1,140 @@
+package fallback
+
+import (
+	"context"
+	"errors"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"testing"
+)
+
+// failingClient fails its reads with err.
+type failingClient struct {
+	*tablestoretest.Client
+	err error
+}
+
+func (client *failingClient) GetRow(request *tablestore.GetRowRequest) (*tablestore.GetRowResponse, error) {
+	if client.err != nil {
+		return nil, client.err
+	}
+	return client.Client.GetRow(request)
+}
+
+func (client *failingClient) BatchGetRow(request *tablestore.BatchGetRowRequest) (*tablestore.BatchGetRowResponse, error) {
+	if client.err != nil {
+		return nil, client.err
+	}
+	return client.Client.BatchGetRow(request)
+}
+
+func (client *failingClient) GetRange(request *tablestore.GetRangeRequest) (*tablestore.GetRangeResponse, error) {
+	if client.err != nil {
+		return nil, client.err
+	}
+	return client.Client.GetRange(request)
+}
+
+func primaryKey(id int64) *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn("id", id)
+	return pk
+}
+
+func load(t *testing.T, client tablestore.TableStoreApi, table string, value string) {
+	meta := &tablestore.TableMeta{TableName: table}
+	meta.AddPrimaryKeyColumn("id", tablestore.PrimaryKeyType_INTEGER)
+	if _, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+		t.Fatal(err)
+	}
+	change := &tablestore.PutRowChange{TableName: table, PrimaryKey: primaryKey(1)}
+	change.AddColumn("value", value)
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: change}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIsUnavailable(t *testing.T) {
+	for err, want := range map[error]bool{
+		nil: false,
+		errors.New("OTSServerBusy Server is busy. id"):                                   true,
+		errors.New("OTSNotEnoughCapacityUnit Remaining capacity unit is not enough. id"): true,
+		errors.New("OTSObjectNotExist Requested table does not exist. id"):               false,
+		errors.New("[tablestore] missing primary key"):                                   false,
+		errors.New("dial tcp 10.0.0.1:80: connect: connection refused"):                  true,
+		context.Canceled: false,
+	} {
+		if got := IsUnavailable(err); got != want {
+			t.Errorf("%v: %v", err, got)
+		}
+	}
+}
+
+func TestFallback(t *testing.T) {
+	primary := &failingClient{Client: tablestoretest.NewClient()}
+	load(t, primary, "users", "fresh")
+	source := tablestoretest.NewClient()
+	load(t, source, "users_snapshot", "stale")
+
+	var fallbacks []string
+	client := New(primary, Config{
+		Source: source,
+		Tables: map[string]string{"users": "users_snapshot"},
+		OnFallback: func(action, table string, err, fallbackErr error) {
+			fallbacks = append(fallbacks, action+" "+table)
+		},
+	})
+	value := func(columns []*tablestore.AttributeColumn) interface{} {
+		if len(columns) == 0 {
+			return nil
+		}
+		return columns[0].Value
+	}
+	getRow := func(table string) (interface{}, error) {
+		resp, err := client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: &tablestore.SingleRowQueryCriteria{TableName: table, PrimaryKey: primaryKey(1), MaxVersion: 1}})
+		if err != nil {
+			return nil, err
+		}
+		return value(resp.Columns), nil
+	}
+
+	if got, err := getRow("users"); err != nil || got != "fresh" {
+		t.Errorf("row %v, %v", got, err)
+	}
+	primary.err = errors.New("OTSServerBusy Server is busy. id")
+	if got, err := getRow("users"); err != nil || got != "stale" {
+		t.Errorf("fallback row %v, %v", got, err)
+	}
+	batch := &tablestore.BatchGetRowRequest{}
+	batch.MultiRowQueryCriteria = append(batch.MultiRowQueryCriteria, &tablestore.MultiRowQueryCriteria{TableName: "users", PrimaryKey: []*tablestore.PrimaryKey{primaryKey(1)}, MaxVersion: 1})
+	if resp, err := client.BatchGetRow(batch); err != nil || len(resp.TableToRowsResult["users"]) != 1 || value(resp.TableToRowsResult["users"][0].Columns) != "stale" {
+		t.Errorf("fallback batch %v, %v", resp, err)
+	}
+	criteria := &tablestore.RangeRowQueryCriteria{TableName: "users", StartPrimaryKey: new(tablestore.PrimaryKey), EndPrimaryKey: new(tablestore.PrimaryKey), Direction: tablestore.FORWARD, MaxVersion: 1}
+	criteria.StartPrimaryKey.AddPrimaryKeyColumnWithMinValue("id")
+	criteria.EndPrimaryKey.AddPrimaryKeyColumnWithMaxValue("id")
+	if resp, err := client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: criteria}); err != nil || len(resp.Rows) != 1 || value(resp.Rows[0].Columns) != "stale" {
+		t.Errorf("fallback range %v, %v", resp, err)
+	}
+	// not a table of the source
+	if _, err := getRow("orders"); err != primary.err {
+		t.Errorf("orders: %v", err)
+	}
+	// fails on the source too
+	client.config.Tables["orders"] = "orders"
+	if _, err := getRow("orders"); err != primary.err {
+		t.Errorf("orders: %v", err)
+	}
+	primary.err = errors.New("OTSParameterInvalid invalid. id")
+	if _, err := getRow("users"); err != primary.err {
+		t.Errorf("invalid: %v", err)
+	}
+
+	if stats := client.Stats(); stats != (Stats{Reads: 7, Fallbacks: 4, Failures: 1}) {
+		t.Errorf("stats %+v", stats)
+	}
+	if len(fallbacks) != 4 || fallbacks[1] != "BatchGetRow users" || fallbacks[3] != "GetRow orders" {
+		t.Errorf("fallbacks %v", fallbacks)
+	}
+}
@@ -0,0 +1,335 @@
+// Package fault injects failures into the requests of a
+// tablestore.TableStoreClient through its interceptor chain, to verify how an
+// application copes with throttling, timeouts and partial batch failures:
+//
+//	injector := fault.NewInjector(1)
+//	injector.SetRule("BatchWriteRow", fault.Rule{ThrottleRate: 0.1, PartialFailureRate: 0.2})
+//	client := tablestore.NewClient(endpoint, instance, id, secret, tablestore.AddInterceptor(injector.Interceptor()))
+//
+// Every attempt is subject to the rules, so retries of the client may fail
+// again.
+package fault
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
+	"github.com/golang/protobuf/proto"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AnyAction sets the rule of all actions without a rule of their own.
+const AnyAction = "*"
+
+// Rule configures the faults injected into the requests of an action. Rates
+// are probabilities between 0 and 1.
+type Rule struct {
+	// requests failing with ThrottleCode without reaching the server
+	ThrottleRate float64
+	// error code of throttled requests, tablestore.NOT_ENOUGH_CAPACITY_UNIT
+	// by default
+	ThrottleCode string
+
+	// requests failing with a timeout error without reaching the server,
+	// after waiting Timeout
+	TimeoutRate float64
+	Timeout     time.Duration
+
+	// rows of BatchWriteRow and BatchGetRow requests failing with
+	// PartialFailureCode, tablestore.SERVER_BUSY by default. Failed rows are
+	// not sent to the server.
+	PartialFailureRate float64
+	PartialFailureCode string
+}
+
+// Stats counts the faults injected into an action.
+type Stats struct {
+	Requests   int
+	Throttled  int
+	TimedOut   int
+	FailedRows int
+}
+
+// timeoutError looks like the error of an http.Client timeout.
+type timeoutError struct {
+	uri string
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("[fault] %s: request timeout injected", e.uri)
+}
+
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+// Injector holds the rules per action. It is safe for concurrent use, and its
+// rules may be changed while requests are running.
+type Injector struct {
+	lock   sync.Mutex
+	random *rand.Rand
+	rules  map[string]Rule
+	stats  map[string]*Stats
+}
+
+// NewInjector returns an injector without rules. Faults are chosen by a random
+// source initialized with seed, so a single threaded run is reproducible.
+func NewInjector(seed int64) *Injector {
+	return &Injector{
+		random: rand.New(rand.NewSource(seed)),
+		rules:  make(map[string]Rule),
+		stats:  make(map[string]*Stats),
+	}
+}
+
+// SetRule sets the rule of action, e.g. "GetRow", or of AnyAction.
+func (injector *Injector) SetRule(action string, rule Rule) {
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+	injector.rules[action] = rule
+}
+
+// RemoveRule stops injecting faults into action.
+func (injector *Injector) RemoveRule(action string) {
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+	delete(injector.rules, action)
+}
+
+// Stats returns the faults injected so far per action.
+func (injector *Injector) Stats() map[string]Stats {
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+	stats := make(map[string]Stats, len(injector.stats))
+	for action, s := range injector.stats {
+		stats[action] = *s
+	}
+	return stats
+}
+
+func (injector *Injector) rule(action string) (Rule, bool) {
+	if rule, ok := injector.rules[action]; ok {
+		return rule, true
+	}
+	rule, ok := injector.rules[AnyAction]
+	return rule, ok
+}
+
+func (injector *Injector) statsOf(action string) *Stats {
+	s, ok := injector.stats[action]
+	if !ok {
+		s = new(Stats)
+		injector.stats[action] = s
+	}
+	return s
+}
+
+// decide draws the faults of one attempt of action: whether it is throttled
+// or times out, and which batch rows fail.
+func (injector *Injector) decide(action string) (rule Rule, throttle, timeout bool, failRow func() bool) {
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+	stats := injector.statsOf(action)
+	stats.Requests++
+	rule, ok := injector.rule(action)
+	if !ok {
+		return rule, false, false, nil
+	}
+	switch {
+	case injector.random.Float64() < rule.ThrottleRate:
+		stats.Throttled++
+		return rule, true, false, nil
+	case injector.random.Float64() < rule.TimeoutRate:
+		stats.TimedOut++
+		return rule, false, true, nil
+	}
+	if rule.PartialFailureRate <= 0 {
+		return rule, false, false, nil
+	}
+	return rule, false, false, func() bool {
+		injector.lock.Lock()
+		defer injector.lock.Unlock()
+		if injector.random.Float64() < rule.PartialFailureRate {
+			injector.statsOf(action).FailedRows++
+			return true
+		}
+		return false
+	}
+}
+
+// Interceptor returns the interceptor to add to clients by
+// tablestore.AddInterceptor.
+func (injector *Injector) Interceptor() tablestore.Interceptor {
+	return func(uri string, body []byte, next tablestore.Invoker) ([]byte, error, int, string) {
+		action := strings.TrimPrefix(uri, "/")
+		rule, throttle, timeout, failRow := injector.decide(action)
+		switch {
+		case throttle:
+			code := rule.ThrottleCode
+			if code == "" {
+				code = tablestore.NOT_ENOUGH_CAPACITY_UNIT
+			}
+			return errorResponse(uri, code, "Throttling injected.")
+		case timeout:
+			time.Sleep(rule.Timeout)
+			return nil, &timeoutError{uri: uri}, 0, ""
+		case failRow != nil && action == "BatchWriteRow":
+			return batchWriteRow(uri, body, next, failRow, partialFailureCode(rule))
+		case failRow != nil && action == "BatchGetRow":
+			return batchGetRow(uri, body, next, failRow, partialFailureCode(rule))
+		}
+		return next(uri, body)
+	}
+}
+
+func partialFailureCode(rule Rule) string {
+	if rule.PartialFailureCode == "" {
+		return tablestore.SERVER_BUSY
+	}
+	return rule.PartialFailureCode
+}
+
+func httpStatus(code string) int {
+	switch code {
+	case tablestore.SERVER_BUSY, tablestore.SERVER_UNAVAILABLE, tablestore.PARTITION_UNAVAILABLE, tablestore.TABLE_NOT_READY, tablestore.STORAGE_TIMEOUT:
+		return http.StatusServiceUnavailable
+	case tablestore.INTERNAL_SERVER_ERROR:
+		return http.StatusInternalServerError
+	}
+	return http.StatusForbidden
+}
+
+func errorResponse(uri, code, message string) ([]byte, error, int, string) {
+	status := httpStatus(code)
+	body, _ := proto.Marshal(&otsprotocol.Error{Code: proto.String(code), Message: proto.String(message)})
+	return body, fmt.Errorf("get %s response status is %d", uri, status), status, ""
+}
+
+func rowError(code string) *otsprotocol.Error {
+	return &otsprotocol.Error{Code: proto.String(code), Message: proto.String("Row failure injected.")}
+}
+
+// batchWriteRow sends the rows of the request which do not fail, and merges
+// the injected failures into the response.
+func batchWriteRow(uri string, body []byte, next tablestore.Invoker, failRow func() bool, code string) ([]byte, error, int, string) {
+	req := new(otsprotocol.BatchWriteRowRequest)
+	if err := proto.Unmarshal(body, req); err != nil {
+		return next(uri, body)
+	}
+	failed := make([][]bool, len(req.Tables))
+	// position of each table in the sent request, -1 if all its rows fail
+	positions := make([]int, len(req.Tables))
+	sent := new(otsprotocol.BatchWriteRowRequest)
+	for i, table := range req.Tables {
+		failed[i] = make([]bool, len(table.Rows))
+		subset := &otsprotocol.TableInBatchWriteRowRequest{TableName: table.TableName}
+		for j, row := range table.Rows {
+			if failed[i][j] = failRow(); !failed[i][j] {
+				subset.Rows = append(subset.Rows, row)
+			}
+		}
+		positions[i] = -1
+		if len(subset.Rows) > 0 {
+			positions[i] = len(sent.Tables)
+			sent.Tables = append(sent.Tables, subset)
+		}
+	}
+
+	resp := new(otsprotocol.BatchWriteRowResponse)
+	var requestId string
+	if len(sent.Tables) > 0 {
+		data, _ := proto.Marshal(sent)
+		respBody, err, status, id := next(uri, data)
+		if err != nil {
+			return respBody, err, status, id
+		}
+		if err := proto.Unmarshal(respBody, resp); err != nil {
+			return respBody, err, status, id
+		}
+		requestId = id
+	}
+
+	merged := new(otsprotocol.BatchWriteRowResponse)
+	for i, table := range req.Tables {
+		var rows []*otsprotocol.RowInBatchWriteRowResponse
+		if positions[i] >= 0 && positions[i] < len(resp.Tables) {
+			rows = resp.Tables[positions[i]].Rows
+		}
+		result := &otsprotocol.TableInBatchWriteRowResponse{TableName: table.TableName}
+		for _, fail := range failed[i] {
+			if fail || len(rows) == 0 {
+				result.Rows = append(result.Rows, &otsprotocol.RowInBatchWriteRowResponse{IsOk: proto.Bool(false), Error: rowError(code)})
+				continue
+			}
+			result.Rows = append(result.Rows, rows[0])
+			rows = rows[1:]
+		}
+		merged.Tables = append(merged.Tables, result)
+	}
+	data, _ := proto.Marshal(merged)
+	return data, nil, http.StatusOK, requestId
+}
+
+// batchGetRow is the BatchGetRow counterpart of batchWriteRow.
+func batchGetRow(uri string, body []byte, next tablestore.Invoker, failRow func() bool, code string) ([]byte, error, int, string) {
+	req := new(otsprotocol.BatchGetRowRequest)
+	if err := proto.Unmarshal(body, req); err != nil {
+		return next(uri, body)
+	}
+	failed := make([][]bool, len(req.Tables))
+	// position of each table in the sent request, -1 if all its rows fail
+	positions := make([]int, len(req.Tables))
+	sent := new(otsprotocol.BatchGetRowRequest)
+	for i, table := range req.Tables {
+		failed[i] = make([]bool, len(table.PrimaryKey))
+		subset := *table
+		subset.PrimaryKey = nil
+		for j, pk := range table.PrimaryKey {
+			if failed[i][j] = failRow(); !failed[i][j] {
+				subset.PrimaryKey = append(subset.PrimaryKey, pk)
+			}
+		}
+		positions[i] = -1
+		if len(subset.PrimaryKey) > 0 {
+			positions[i] = len(sent.Tables)
+			sent.Tables = append(sent.Tables, &subset)
+		}
+	}
+
+	resp := new(otsprotocol.BatchGetRowResponse)
+	var requestId string
+	if len(sent.Tables) > 0 {
+		data, _ := proto.Marshal(sent)
+		respBody, err, status, id := next(uri, data)
+		if err != nil {
+			return respBody, err, status, id
+		}
+		if err := proto.Unmarshal(respBody, resp); err != nil {
+			return respBody, err, status, id
+		}
+		requestId = id
+	}
+
+	merged := new(otsprotocol.BatchGetRowResponse)
+	for i, table := range req.Tables {
+		var rows []*otsprotocol.RowInBatchGetRowResponse
+		if positions[i] >= 0 && positions[i] < len(resp.Tables) {
+			rows = resp.Tables[positions[i]].Rows
+		}
+		result := &otsprotocol.TableInBatchGetRowResponse{TableName: table.TableName}
+		for _, fail := range failed[i] {
+			if fail || len(rows) == 0 {
+				result.Rows = append(result.Rows, &otsprotocol.RowInBatchGetRowResponse{IsOk: proto.Bool(false), Error: rowError(code)})
+				continue
+			}
+			result.Rows = append(result.Rows, rows[0])
+			rows = rows[1:]
+		}
+		merged.Tables = append(merged.Tables, result)
+	}
+	data, _ := proto.Marshal(merged)
+	return data, nil, http.StatusOK, requestId
+}
@@ -0,0 +1,104 @@
+package fault
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"net"
+	"strings"
+	"testing"
+)
+
+func newClient(t *testing.T, injector *Injector) (*tablestoretest.Server, *tablestore.TableStoreClient) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	meta := &tablestore.TableMeta{TableName: "t"}
+	meta.AddPrimaryKeyColumn("pk", tablestore.PrimaryKeyType_INTEGER)
+	_, err := server.Store.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := tablestore.NewDefaultTableStoreConfig()
+	config.RetryTimes = 0
+	client := tablestore.NewClientWithConfig(server.URL, "instance", "id", "secret", "", config)
+	tablestore.AddInterceptor(injector.Interceptor())(client)
+	return server, client
+}
+
+func TestThrottleAndTimeout(t *testing.T) {
+	injector := NewInjector(1)
+	server, client := newClient(t, injector)
+	defer server.Close()
+
+	injector.SetRule(AnyAction, Rule{ThrottleRate: 1})
+	if _, err := client.ListTable(); err == nil || !strings.HasPrefix(err.Error(), tablestore.NOT_ENOUGH_CAPACITY_UNIT) {
+		t.Fatalf("expect throttling, got %v", err)
+	}
+	injector.SetRule("ListTable", Rule{TimeoutRate: 1})
+	_, err := client.ListTable()
+	if e, ok := err.(net.Error); !ok || !e.Timeout() {
+		t.Fatalf("expect timeout, got %v", err)
+	}
+	injector.RemoveRule("ListTable")
+	injector.RemoveRule(AnyAction)
+	if _, err := client.ListTable(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := injector.Stats()["ListTable"]; stats.Requests != 3 || stats.Throttled != 1 || stats.TimedOut != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestPartialFailure(t *testing.T) {
+	injector := NewInjector(1)
+	server, client := newClient(t, injector)
+	defer server.Close()
+	injector.SetRule("BatchWriteRow", Rule{PartialFailureRate: 0.5})
+	injector.SetRule("BatchGetRow", Rule{PartialFailureRate: 1})
+
+	batch := &tablestore.BatchWriteRowRequest{}
+	for i := 0; i < 20; i++ {
+		pk := new(tablestore.PrimaryKey)
+		pk.AddPrimaryKeyColumn("pk", int64(i))
+		change := &tablestore.PutRowChange{TableName: "t", PrimaryKey: pk}
+		change.AddColumn("col", int64(i))
+		change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		batch.AddRowChange(change)
+	}
+	resp, err := client.BatchWriteRow(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := 0
+	for i, result := range resp.TableToRowsResult["t"] {
+		pk := new(tablestore.PrimaryKey)
+		pk.AddPrimaryKeyColumn("pk", int64(i))
+		row, err := server.Store.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: &tablestore.SingleRowQueryCriteria{TableName: "t", PrimaryKey: pk, MaxVersion: 1}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// failed rows must not be written
+		if result.IsSucceed != (len(row.Columns) == 1) {
+			t.Fatalf("row %d: succeed %v, stored %v", i, result.IsSucceed, row.Columns)
+		}
+		if !result.IsSucceed {
+			failed++
+			if result.Error.Code != tablestore.SERVER_BUSY {
+				t.Fatalf("unexpected error %v", result.Error)
+			}
+		}
+	}
+	if failed == 0 || failed == 20 || injector.Stats()["BatchWriteRow"].FailedRows != failed {
+		t.Fatalf("unexpected failed rows %d, stats %+v", failed, injector.Stats())
+	}
+
+	criteria := &tablestore.MultiRowQueryCriteria{TableName: "t", MaxVersion: 1}
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn("pk", int64(0))
+	criteria.AddRow(pk)
+	get, err := client.BatchGetRow(&tablestore.BatchGetRowRequest{MultiRowQueryCriteria: []*tablestore.MultiRowQueryCriteria{criteria}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows := get.TableToRowsResult["t"]; len(rows) != 1 || rows[0].IsSucceed {
+		t.Fatalf("unexpected batch get results %v", rows)
+	}
+}
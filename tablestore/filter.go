@@ -0,0 +1,111 @@
+package tablestore
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
+	"github.com/golang/protobuf/proto"
+)
+
+// FrozenFilter is a filter serialized once, for filters reused by many
+// requests, which serialize their filter on each call otherwise:
+//
+//	var openOrders = tablestore.Col("status").Equal("open").Freeze()
+//
+//	criteria.Filter = openOrders
+//
+// The filter frozen must not be modified afterwards, its changes would be
+// ignored.
+type FrozenFilter struct {
+	filter     ColumnFilter
+	pb         *otsprotocol.Filter
+	serialized []byte
+}
+
+// Freeze returns filter serialized once, filter itself if it is frozen.
+func Freeze(filter ColumnFilter) *FrozenFilter {
+	if frozen, ok := filter.(*FrozenFilter); ok {
+		return frozen
+	}
+	pb := filter.ToFilter()
+	serialized, _ := proto.Marshal(pb)
+	return &FrozenFilter{filter: filter, pb: pb, serialized: serialized}
+}
+
+func (condition *SingleColumnCondition) Freeze() *FrozenFilter {
+	return Freeze(condition)
+}
+
+func (ccvfilter *CompositeColumnValueFilter) Freeze() *FrozenFilter {
+	return Freeze(ccvfilter)
+}
+
+func (pageFilter *PaginationFilter) Freeze() *FrozenFilter {
+	return Freeze(pageFilter)
+}
+
+// Filter returns the filter frozen.
+func (frozen *FrozenFilter) Filter() ColumnFilter {
+	return frozen.filter
+}
+
+// Serialize returns the serialized filter, shared by the calls, which must
+// not be modified.
+func (frozen *FrozenFilter) Serialize() []byte {
+	return frozen.serialized
+}
+
+func (frozen *FrozenFilter) ToFilter() *otsprotocol.Filter {
+	return &otsprotocol.Filter{Type: frozen.pb.Type, Filter: frozen.pb.Filter}
+}
+
+// DecodeColumnFilter decodes a filter serialized by ColumnFilter.Serialize,
+// e.g. the column condition of a row change kept to be written again.
+func DecodeColumnFilter(data []byte) (ColumnFilter, error) {
+	pb := new(otsprotocol.Filter)
+	if err := proto.Unmarshal(data, pb); err != nil {
+		return nil, err
+	}
+	return decodeFilter(pb)
+}
+
+func decodeFilter(pb *otsprotocol.Filter) (ColumnFilter, error) {
+	switch pb.GetType() {
+	case otsprotocol.FilterType_FT_SINGLE_COLUMN_VALUE:
+		single := new(otsprotocol.SingleColumnValueFilter)
+		if err := proto.Unmarshal(pb.Filter, single); err != nil {
+			return nil, err
+		}
+		value, err := DecodeFilterValue(single.ColumnValue)
+		if err != nil {
+			return nil, err
+		}
+		filter := NewSingleColumnCondition(single.GetColumnName(), ComparatorType(single.GetComparator()), value)
+		filter.FilterIfMissing = single.GetFilterIfMissing()
+		filter.LatestVersionOnly = single.GetLatestVersionOnly()
+		if rule := single.ValueTransRule; rule != nil {
+			filter.TransferRule = NewValueTransferRule(rule.GetRegex(), VariantType(rule.GetCastType()))
+		}
+		return filter, nil
+	case otsprotocol.FilterType_FT_COMPOSITE_COLUMN_VALUE:
+		composite := new(otsprotocol.CompositeColumnValueFilter)
+		if err := proto.Unmarshal(pb.Filter, composite); err != nil {
+			return nil, err
+		}
+		filter := NewCompositeColumnCondition(LogicalOperator(composite.GetCombinator()))
+		for _, pbSub := range composite.SubFilters {
+			sub, err := decodeFilter(pbSub)
+			if err != nil {
+				return nil, err
+			}
+			filter.AddFilter(sub)
+		}
+		return filter, nil
+	case otsprotocol.FilterType_FT_COLUMN_PAGINATION:
+		pagination := new(otsprotocol.ColumnPaginationFilter)
+		if err := proto.Unmarshal(pb.Filter, pagination); err != nil {
+			return nil, err
+		}
+		return &PaginationFilter{Offset: pagination.GetOffset(), Limit: pagination.GetLimit()}, nil
+	}
+	return nil, fmt.Errorf("[tablestore] unknown filter type %d", pb.GetType())
+}
@@ -0,0 +1,357 @@
+// Package freshness provides read-your-write consistency to the rows read
+// through secondary and search indexes, which are synchronized with their
+// base table asynchronously:
+//
+//	client := freshness.New(tablestore.NewClient(endpoint, instance, id, secret), freshness.Config{
+//		Indexes: map[string]string{"orders_by_user": "orders"},
+//	})
+//	client.UpdateRow(request) // updates a row of orders
+//	resp, err := client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: byUser})
+//
+// The rows of orders_by_user written through the client during the last
+// Config.Window are re-read from orders, so that the update is seen even if
+// the index lags behind. The freshness of reads is chosen per call with
+// WithFreshness, trading the cost of re-reading the base table:
+//
+//	resp, err := client.WithFreshness(freshness.IndexOnly).Search(request)
+//
+// Re-reading fixes the values of the rows found by the index, not which rows
+// the index finds: rows written but not indexed yet are missing, rows no
+// longer matching the query are returned with their current values, and
+// rows deleted are dropped. Search TotalCount is the count of the index.
+package freshness
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"sync"
+	"time"
+)
+
+// Freshness is the freshness of the rows read through indexes.
+type Freshness int
+
+const (
+	// the rows written through the client are re-read from the base table
+	ReadYourWrites Freshness = iota
+	// rows are read from the index only, possibly lagging behind
+	IndexOnly
+	// all rows are re-read from the base table
+	BaseTable
+)
+
+type Config struct {
+	// base tables of the secondary indexes read by GetRange, by index name;
+	// search indexes are read with the name of their base table
+	Indexes map[string]string
+	// time rows written are re-read for, 1 minute by default
+	Window time.Duration
+	// freshness of the calls of the client, ReadYourWrites by default
+	Freshness Freshness
+}
+
+// Client is a tablestore.TableStoreApi re-reading from their base table the
+// rows read through indexes. It is safe for concurrent use if the wrapped
+// client is.
+type Client struct {
+	tablestore.TableStoreApi
+	config    Config
+	freshness Freshness
+	state     *state
+}
+
+var _ tablestore.TableStoreApi = (*Client)(nil)
+
+// state is shared by the clients of WithFreshness.
+type state struct {
+	lock    sync.Mutex
+	written map[string]time.Time
+	pruned  time.Time
+	// primary key column names, by base table
+	primaryKeys map[string][]string
+	// defined columns, by secondary index
+	definedColumns map[string][]string
+}
+
+func New(client tablestore.TableStoreApi, config Config) *Client {
+	if config.Window <= 0 {
+		config.Window = time.Minute
+	}
+	return &Client{TableStoreApi: client, config: config, freshness: config.Freshness,
+		state: &state{written: make(map[string]time.Time), pruned: time.Now(), primaryKeys: make(map[string][]string),
+			definedColumns: make(map[string][]string)}}
+}
+
+// WithFreshness returns a client reading with freshness, sharing the rows
+// written through client.
+func (client *Client) WithFreshness(freshness Freshness) *Client {
+	c := *client
+	c.freshness = freshness
+	return &c
+}
+
+func key(table string, pk *tablestore.PrimaryKey) string {
+	return table + "\x00" + string(pk.Build(false))
+}
+
+func (client *Client) record(table string, pk *tablestore.PrimaryKey) {
+	if pk == nil {
+		return
+	}
+	now := time.Now()
+	state := client.state
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	state.written[key(table, pk)] = now
+	if now.Sub(state.pruned) > client.config.Window {
+		for k, t := range state.written {
+			if now.Sub(t) > client.config.Window {
+				delete(state.written, k)
+			}
+		}
+		state.pruned = now
+	}
+}
+
+func (client *Client) recent(key string) bool {
+	state := client.state
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	t, ok := state.written[key]
+	return ok && time.Since(t) <= client.config.Window
+}
+
+// describe returns the primary key of table, and remembers the defined
+// columns of its secondary indexes.
+func (client *Client) describe(table string) ([]string, error) {
+	state := client.state
+	state.lock.Lock()
+	pk, ok := state.primaryKeys[table]
+	state.lock.Unlock()
+	if ok {
+		return pk, nil
+	}
+	resp, err := client.TableStoreApi.DescribeTable(&tablestore.DescribeTableRequest{TableName: table})
+	if err != nil {
+		return nil, err
+	}
+	for _, column := range resp.TableMeta.SchemaEntry {
+		pk = append(pk, *column.Name)
+	}
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	state.primaryKeys[table] = pk
+	for _, index := range resp.IndexMetas {
+		state.definedColumns[index.IndexName] = index.DefinedColumns
+	}
+	return pk, nil
+}
+
+func (client *Client) PutRow(request *tablestore.PutRowRequest) (*tablestore.PutRowResponse, error) {
+	defer client.record(request.PutRowChange.TableName, request.PutRowChange.PrimaryKey)
+	return client.TableStoreApi.PutRow(request)
+}
+
+func (client *Client) UpdateRow(request *tablestore.UpdateRowRequest) (*tablestore.UpdateRowResponse, error) {
+	defer client.record(request.UpdateRowChange.TableName, request.UpdateRowChange.PrimaryKey)
+	return client.TableStoreApi.UpdateRow(request)
+}
+
+func (client *Client) DeleteRow(request *tablestore.DeleteRowRequest) (*tablestore.DeleteRowResponse, error) {
+	defer client.record(request.DeleteRowChange.TableName, request.DeleteRowChange.PrimaryKey)
+	return client.TableStoreApi.DeleteRow(request)
+}
+
+func (client *Client) BatchWriteRow(request *tablestore.BatchWriteRowRequest) (*tablestore.BatchWriteRowResponse, error) {
+	defer func() {
+		for table, changes := range request.RowChangesGroupByTable {
+			for _, change := range changes {
+				switch change := change.(type) {
+				case *tablestore.PutRowChange:
+					client.record(table, change.PrimaryKey)
+				case *tablestore.UpdateRowChange:
+					client.record(table, change.PrimaryKey)
+				case *tablestore.DeleteRowChange:
+					client.record(table, change.PrimaryKey)
+				}
+			}
+		}
+	}()
+	return client.TableStoreApi.BatchWriteRow(request)
+}
+
+// GetRange re-reads the rows of the secondary indexes of Config.Indexes from
+// their base table, with the columns requested or the defined columns of the
+// index.
+func (client *Client) GetRange(request *tablestore.GetRangeRequest) (*tablestore.GetRangeResponse, error) {
+	resp, err := client.TableStoreApi.GetRange(request)
+	if err != nil {
+		return nil, err
+	}
+	criteria := request.RangeRowQueryCriteria
+	base, ok := client.config.Indexes[criteria.TableName]
+	if !ok || client.freshness == IndexOnly || len(resp.Rows) == 0 {
+		return resp, nil
+	}
+	pk, err := client.describe(base)
+	if err != nil {
+		return nil, err
+	}
+	columns := criteria.ColumnsToGet
+	if len(columns) == 0 {
+		client.state.lock.Lock()
+		defined, ok := client.state.definedColumns[criteria.TableName]
+		client.state.lock.Unlock()
+		if columns = nil; ok {
+			columns = append([]string{}, defined...)
+		}
+	}
+	if columns != nil {
+		// the values of the primary key of the index from the base table
+		columns = append(append([]string(nil), columns...), indexColumns(resp.Rows[0].PrimaryKey, pk)...)
+	}
+	if resp.Rows, err = client.reread(base, pk, resp.Rows, columns); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Search re-reads the rows found from their base table, with the columns
+// requested.
+func (client *Client) Search(request *tablestore.SearchRequest) (*tablestore.SearchResponse, error) {
+	resp, err := client.TableStoreApi.Search(request)
+	if err != nil {
+		return nil, err
+	}
+	if client.freshness == IndexOnly || len(resp.Rows) == 0 {
+		return resp, nil
+	}
+	pk, err := client.describe(request.TableName)
+	if err != nil {
+		return nil, err
+	}
+	// the primary key only
+	columns := []string{}
+	if request.ColumnsToGet != nil {
+		if request.ColumnsToGet.ReturnAll {
+			columns = nil
+		} else if len(request.ColumnsToGet.Columns) > 0 {
+			columns = request.ColumnsToGet.Columns
+		}
+	}
+	if resp.Rows, err = client.reread(request.TableName, pk, resp.Rows, columns); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// indexColumns returns the columns of the primary key of an index row which
+// are not in the primary key of the base table.
+func indexColumns(pk *tablestore.PrimaryKey, base []string) []string {
+	inBase := make(map[string]bool, len(base))
+	for _, name := range base {
+		inBase[name] = true
+	}
+	var columns []string
+	for _, column := range pk.PrimaryKeys {
+		if !inBase[column.ColumnName] {
+			columns = append(columns, column.ColumnName)
+		}
+	}
+	return columns
+}
+
+// reread replaces the columns of the rows to re-read by the columns of their
+// row in table, whole rows if columns is nil, and drops the rows deleted.
+func (client *Client) reread(table string, pk []string, rows []*tablestore.Row, columns []string) ([]*tablestore.Row, error) {
+	var stale []int
+	var pks []*tablestore.PrimaryKey
+	for i, row := range rows {
+		values := make(map[string]interface{}, len(row.PrimaryKey.PrimaryKeys))
+		for _, column := range row.PrimaryKey.PrimaryKeys {
+			values[column.ColumnName] = column.Value
+		}
+		basePk := new(tablestore.PrimaryKey)
+		for _, name := range pk {
+			value, ok := values[name]
+			if !ok {
+				return nil, fmt.Errorf("[tablestore] row of %s without primary key column %s", table, name)
+			}
+			basePk.AddPrimaryKeyColumn(name, value)
+		}
+		if client.freshness == BaseTable || client.recent(key(table, basePk)) {
+			stale = append(stale, i)
+			pks = append(pks, basePk)
+		}
+	}
+	if stale == nil {
+		return rows, nil
+	}
+	if columns != nil {
+		// rows without the columns requested are read empty, as deleted ones
+		columns = append(append([]string(nil), columns...), pk[0])
+	}
+
+	deleted := make(map[int]bool)
+	for start := 0; start < len(pks); start += 100 {
+		end := start + 100
+		if end > len(pks) {
+			end = len(pks)
+		}
+		criteria := &tablestore.MultiRowQueryCriteria{TableName: table, PrimaryKey: pks[start:end], ColumnsToGet: columns, MaxVersion: 1}
+		resp, err := client.TableStoreApi.BatchGetRow(&tablestore.BatchGetRowRequest{MultiRowQueryCriteria: []*tablestore.MultiRowQueryCriteria{criteria}})
+		if err != nil {
+			return nil, err
+		}
+		results := resp.TableToRowsResult[table]
+		if len(results) != end-start {
+			return nil, fmt.Errorf("[tablestore] %d rows of %s re-read out of %d", len(results), table, end-start)
+		}
+		for j, result := range results {
+			if !result.IsSucceed {
+				return nil, fmt.Errorf("%s %s %s", result.Error.Code, result.Error.Message, resp.RequestId)
+			}
+			i := stale[start+j]
+			if len(result.PrimaryKey.PrimaryKeys) == 0 {
+				deleted[i] = true
+				continue
+			}
+			rows[i] = refresh(rows[i], result.Columns)
+		}
+	}
+	if len(deleted) == 0 {
+		return rows, nil
+	}
+	fresh := make([]*tablestore.Row, 0, len(rows)-len(deleted))
+	for i, row := range rows {
+		if !deleted[i] {
+			fresh = append(fresh, row)
+		}
+	}
+	return fresh, nil
+}
+
+// refresh returns row with columns, the columns of the primary key of row
+// taking their value.
+func refresh(row *tablestore.Row, columns []*tablestore.AttributeColumn) *tablestore.Row {
+	values := make(map[string]interface{}, len(columns))
+	for _, column := range columns {
+		values[column.ColumnName] = column.Value
+	}
+	fresh := &tablestore.Row{PrimaryKey: new(tablestore.PrimaryKey)}
+	inPk := make(map[string]bool, len(row.PrimaryKey.PrimaryKeys))
+	for _, column := range row.PrimaryKey.PrimaryKeys {
+		c := *column
+		if value, ok := values[c.ColumnName]; ok {
+			c.Value = value
+		}
+		inPk[c.ColumnName] = true
+		fresh.PrimaryKey.PrimaryKeys = append(fresh.PrimaryKey.PrimaryKeys, &c)
+	}
+	for _, column := range columns {
+		if !inPk[column.ColumnName] {
+			fresh.Columns = append(fresh.Columns, column)
+		}
+	}
+	return fresh
+}
@@ -0,0 +1,175 @@
+package freshness
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"testing"
+	"time"
+)
+
+// searchClient finds the rows of hits, as a lagging search index.
+type searchClient struct {
+	*tablestoretest.Client
+	hits []*tablestore.Row
+}
+
+func (client *searchClient) Search(request *tablestore.SearchRequest) (*tablestore.SearchResponse, error) {
+	return &tablestore.SearchResponse{TotalCount: int64(len(client.hits)), Rows: client.hits, IsAllSuccess: true}, nil
+}
+
+func orderKey(id int64) *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn("id", id)
+	return pk
+}
+
+func indexKey(user string, id int64) *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn("user", user)
+	pk.AddPrimaryKeyColumn("id", id)
+	return pk
+}
+
+func put(t *testing.T, client tablestore.TableStoreApi, table string, pk *tablestore.PrimaryKey, columns map[string]interface{}) {
+	change := &tablestore.PutRowChange{TableName: table, PrimaryKey: pk}
+	for name, value := range columns {
+		change.AddColumn(name, value)
+	}
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: change}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func createTable(t *testing.T, client tablestore.TableStoreApi, name string, pk ...string) {
+	meta := &tablestore.TableMeta{TableName: name}
+	for _, column := range pk {
+		if column == "id" {
+			meta.AddPrimaryKeyColumn(column, tablestore.PrimaryKeyType_INTEGER)
+		} else {
+			meta.AddPrimaryKeyColumn(column, tablestore.PrimaryKeyType_STRING)
+		}
+	}
+	_, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// values returns the id and the values of the columns of rows.
+func values(rows []*tablestore.Row) []map[string]interface{} {
+	var values []map[string]interface{}
+	for _, row := range rows {
+		v := make(map[string]interface{})
+		for _, column := range row.PrimaryKey.PrimaryKeys {
+			v[column.ColumnName] = column.Value
+		}
+		for _, column := range row.Columns {
+			v[column.ColumnName] = column.Value
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+func TestFreshness(t *testing.T) {
+	fake := &searchClient{Client: tablestoretest.NewClient()}
+	createTable(t, fake, "orders", "id")
+	// a secondary index maintained by hand, lagging behind
+	createTable(t, fake, "orders_by_user", "user", "id")
+	for id, user := range []string{"a", "a", "a", "b"} {
+		columns := map[string]interface{}{"user": user, "amount": int64(id)}
+		put(t, fake, "orders", orderKey(int64(id)), columns)
+		put(t, fake, "orders_by_user", indexKey(user, int64(id)), map[string]interface{}{"amount": int64(id)})
+	}
+	client := New(fake, Config{Indexes: map[string]string{"orders_by_user": "orders"}, Window: 200 * time.Millisecond})
+
+	update := &tablestore.UpdateRowChange{TableName: "orders", PrimaryKey: orderKey(0)}
+	update.PutColumn("amount", int64(10))
+	update.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	if _, err := client.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: update}); err != nil {
+		t.Fatal(err)
+	}
+	move := &tablestore.UpdateRowChange{TableName: "orders", PrimaryKey: orderKey(1)}
+	move.PutColumn("user", "c")
+	move.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	batch := new(tablestore.BatchWriteRowRequest)
+	batch.AddRowChange(move)
+	batch.AddRowChange(&tablestore.DeleteRowChange{TableName: "orders", PrimaryKey: orderKey(2), Condition: &tablestore.RowCondition{}})
+	if _, err := client.BatchWriteRow(batch); err != nil {
+		t.Fatal(err)
+	}
+	// written by another client
+	put(t, fake, "orders", orderKey(3), map[string]interface{}{"user": "b", "amount": int64(30)})
+
+	scan := func(client *Client, columns ...string) []map[string]interface{} {
+		criteria := &tablestore.RangeRowQueryCriteria{TableName: "orders_by_user", StartPrimaryKey: new(tablestore.PrimaryKey),
+			EndPrimaryKey: new(tablestore.PrimaryKey), ColumnsToGet: columns, MaxVersion: 1}
+		for _, name := range []string{"user", "id"} {
+			criteria.StartPrimaryKey.AddPrimaryKeyColumnWithMinValue(name)
+			criteria.EndPrimaryKey.AddPrimaryKeyColumnWithMaxValue(name)
+		}
+		resp, err := client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: criteria})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return values(resp.Rows)
+	}
+	check := func(name string, got []map[string]interface{}, expected ...map[string]interface{}) {
+		if len(got) != len(expected) {
+			t.Errorf("%s: %v", name, got)
+			return
+		}
+		for i := range got {
+			if len(got[i]) != len(expected[i]) {
+				t.Errorf("%s: %v", name, got)
+				return
+			}
+			for k, v := range expected[i] {
+				if got[i][k] != v {
+					t.Errorf("%s: %v", name, got)
+					return
+				}
+			}
+		}
+	}
+
+	check("read your writes", scan(client),
+		map[string]interface{}{"user": "a", "id": int64(0), "amount": int64(10)},
+		map[string]interface{}{"user": "c", "id": int64(1), "amount": int64(1)},
+		map[string]interface{}{"user": "b", "id": int64(3), "amount": int64(3)})
+	check("columns", scan(client, "amount"),
+		map[string]interface{}{"user": "a", "id": int64(0), "amount": int64(10)},
+		map[string]interface{}{"user": "c", "id": int64(1), "amount": int64(1)},
+		map[string]interface{}{"user": "b", "id": int64(3), "amount": int64(3)})
+	check("index only", scan(client.WithFreshness(IndexOnly)),
+		map[string]interface{}{"user": "a", "id": int64(0), "amount": int64(0)},
+		map[string]interface{}{"user": "a", "id": int64(1), "amount": int64(1)},
+		map[string]interface{}{"user": "a", "id": int64(2), "amount": int64(2)},
+		map[string]interface{}{"user": "b", "id": int64(3), "amount": int64(3)})
+	check("base table", scan(client.WithFreshness(BaseTable), "amount"),
+		map[string]interface{}{"user": "a", "id": int64(0), "amount": int64(10)},
+		map[string]interface{}{"user": "c", "id": int64(1), "amount": int64(1)},
+		map[string]interface{}{"user": "b", "id": int64(3), "amount": int64(30)})
+
+	// rows without the columns requested are not taken for deleted
+	fake.hits = []*tablestore.Row{{PrimaryKey: orderKey(0)}, {PrimaryKey: orderKey(2)}, {PrimaryKey: orderKey(3)}}
+	resp, err := client.Search(&tablestore.SearchRequest{TableName: "orders", ColumnsToGet: &tablestore.ColumnsToGet{Columns: []string{"missing"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("search", values(resp.Rows), map[string]interface{}{"id": int64(0)}, map[string]interface{}{"id": int64(3)})
+	resp, err = client.Search(&tablestore.SearchRequest{TableName: "orders", ColumnsToGet: &tablestore.ColumnsToGet{ReturnAll: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("search all columns", values(resp.Rows),
+		map[string]interface{}{"id": int64(0), "user": "a", "amount": int64(10)}, map[string]interface{}{"id": int64(3)})
+
+	time.Sleep(250 * time.Millisecond)
+	check("window elapsed", scan(client, "amount"),
+		map[string]interface{}{"user": "a", "id": int64(0), "amount": int64(0)},
+		map[string]interface{}{"user": "a", "id": int64(1), "amount": int64(1)},
+		map[string]interface{}{"user": "a", "id": int64(2), "amount": int64(2)},
+		map[string]interface{}{"user": "b", "id": int64(3), "amount": int64(3)})
+}
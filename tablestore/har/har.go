@@ -0,0 +1,357 @@
+// Package har records the exchanges of a tablestore client in the HTTP
+// Archive format, e.g. to attach them to a support ticket:
+//
+//	recorder := har.NewRecorder()
+//	client := tablestore.NewClient(endpoint, instance, id, secret, tablestore.SetHttpClient(recorder))
+//	...
+//	err := recorder.WriteFile("tablestore.har")
+//
+// Entries are sanitized: credentials, signatures and security tokens are
+// redacted, and bodies are replaced by summaries of the decoded protobuf
+// messages, in which binary fields such as rows, filters and queries are
+// reduced to their size. Table and column names are kept.
+package har
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
+	"github.com/golang/protobuf/proto"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RedactedHeaders are the headers whose values are not recorded.
+var RedactedHeaders = []string{"x-ots-accesskeyid", "x-ots-signature", "x-ots-ststoken", "authorization"}
+
+type Log struct {
+	Version string  `json:"version"`
+	Creator Creator `json:"creator"`
+	Entries []Entry `json:"entries"`
+}
+
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type Entry struct {
+	StartedDateTime string   `json:"startedDateTime"`
+	Time            float64  `json:"time"`
+	Request         Request  `json:"request"`
+	Response        Response `json:"response"`
+	Cache           struct{} `json:"cache"`
+	Timings         Timings  `json:"timings"`
+	// the error of a request without response, e.g. a timeout
+	Error string `json:"_error,omitempty"`
+}
+
+type Header struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type Request struct {
+	Method      string   `json:"method"`
+	URL         string   `json:"url"`
+	HTTPVersion string   `json:"httpVersion"`
+	Headers     []Header `json:"headers"`
+	QueryString []Header `json:"queryString"`
+	PostData    *Content `json:"postData,omitempty"`
+	HeadersSize int      `json:"headersSize"`
+	BodySize    int      `json:"bodySize"`
+}
+
+type Response struct {
+	Status      int      `json:"status"`
+	StatusText  string   `json:"statusText"`
+	HTTPVersion string   `json:"httpVersion"`
+	Headers     []Header `json:"headers"`
+	Content     Content  `json:"content"`
+	RedirectURL string   `json:"redirectURL"`
+	HeadersSize int      `json:"headersSize"`
+	BodySize    int      `json:"bodySize"`
+}
+
+// Content is a body, whose Text is the JSON summary of the decoded message.
+type Content struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+// Timings are in milliseconds.
+type Timings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// Recorder is a tablestore.IHttpClient which keeps the exchanges of a client.
+// It may be shared by several clients.
+type Recorder struct {
+	httpClient tablestore.IHttpClient
+
+	lock    sync.Mutex
+	entries []Entry
+}
+
+var _ tablestore.IHttpClient = (*Recorder)(nil)
+
+func NewRecorder() *Recorder {
+	return &Recorder{httpClient: &tablestore.TableStoreHttpClient{}}
+}
+
+func (recorder *Recorder) New(client *http.Client) {
+	recorder.httpClient.New(client)
+}
+
+func (recorder *Recorder) Do(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	action := strings.TrimPrefix(req.URL.Path, "/")
+	entry := Entry{
+		StartedDateTime: time.Now().Format("2006-01-02T15:04:05.000Z07:00"),
+		Request: Request{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: "HTTP/1.1",
+			Headers:     headers(req.Header),
+			QueryString: []Header{},
+			PostData:    &Content{Size: len(body), MimeType: "application/x-protobuf", Text: summary(requestOf(action), body)},
+			HeadersSize: -1,
+			BodySize:    len(body),
+		},
+	}
+
+	start := time.Now()
+	resp, err := recorder.httpClient.Do(req)
+	wait := time.Since(start)
+	if err != nil {
+		entry.Time = milliseconds(wait)
+		entry.Timings = Timings{Wait: entry.Time}
+		entry.Response = Response{Headers: []Header{}, HeadersSize: -1, BodySize: -1}
+		entry.Error = err.Error()
+		recorder.add(entry)
+		return resp, err
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	receive := time.Since(start) - wait
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	var message proto.Message = new(otsprotocol.Error)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		message = responseOf(action)
+	}
+	entry.Time = milliseconds(wait + receive)
+	entry.Timings = Timings{Wait: milliseconds(wait), Receive: milliseconds(receive)}
+	entry.Response = Response{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: "HTTP/1.1",
+		Headers:     headers(resp.Header),
+		Content:     Content{Size: len(data), MimeType: "application/x-protobuf", Text: summary(message, data)},
+		HeadersSize: -1,
+		BodySize:    len(data),
+	}
+	recorder.add(entry)
+	return resp, nil
+}
+
+func (recorder *Recorder) add(entry Entry) {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	recorder.entries = append(recorder.entries, entry)
+}
+
+// Entries returns the exchanges recorded so far.
+func (recorder *Recorder) Entries() []Entry {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	return append([]Entry(nil), recorder.entries...)
+}
+
+// WriteTo writes the exchanges recorded so far as a HAR document.
+func (recorder *Recorder) WriteTo(w io.Writer) (int64, error) {
+	log := struct {
+		Log Log `json:"log"`
+	}{Log{Version: "1.2", Creator: Creator{Name: "aliyun-tablestore-go-sdk", Version: tablestore.ApiVersion}, Entries: recorder.Entries()}}
+	if log.Log.Entries == nil {
+		log.Log.Entries = []Entry{}
+	}
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(log); err != nil {
+		return 0, err
+	}
+	return b.WriteTo(w)
+}
+
+// WriteFile writes the exchanges recorded so far to a HAR file.
+func (recorder *Recorder) WriteFile(path string) error {
+	var b bytes.Buffer
+	if _, err := recorder.WriteTo(&b); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b.Bytes(), 0644)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func headers(header http.Header) []Header {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := []Header{}
+	for _, name := range names {
+		for _, value := range header[name] {
+			for _, redacted := range RedactedHeaders {
+				if strings.EqualFold(name, redacted) {
+					value = "REDACTED"
+				}
+			}
+			list = append(list, Header{Name: name, Value: value})
+		}
+	}
+	return list
+}
+
+var messages = map[string][2]reflect.Type{}
+
+func register(action string, req, resp proto.Message) {
+	messages[action] = [2]reflect.Type{reflect.TypeOf(req).Elem(), reflect.TypeOf(resp).Elem()}
+}
+
+func init() {
+	register("CreateTable", &otsprotocol.CreateTableRequest{}, &otsprotocol.CreateTableResponse{})
+	register("ListTable", &otsprotocol.ListTableRequest{}, &otsprotocol.ListTableResponse{})
+	register("DeleteTable", &otsprotocol.DeleteTableRequest{}, &otsprotocol.DeleteTableResponse{})
+	register("DescribeTable", &otsprotocol.DescribeTableRequest{}, &otsprotocol.DescribeTableResponse{})
+	register("UpdateTable", &otsprotocol.UpdateTableRequest{}, &otsprotocol.UpdateTableResponse{})
+	register("PutRow", &otsprotocol.PutRowRequest{}, &otsprotocol.PutRowResponse{})
+	register("DeleteRow", &otsprotocol.DeleteRowRequest{}, &otsprotocol.DeleteRowResponse{})
+	register("GetRow", &otsprotocol.GetRowRequest{}, &otsprotocol.GetRowResponse{})
+	register("UpdateRow", &otsprotocol.UpdateRowRequest{}, &otsprotocol.UpdateRowResponse{})
+	register("BatchGetRow", &otsprotocol.BatchGetRowRequest{}, &otsprotocol.BatchGetRowResponse{})
+	register("BatchWriteRow", &otsprotocol.BatchWriteRowRequest{}, &otsprotocol.BatchWriteRowResponse{})
+	register("GetRange", &otsprotocol.GetRangeRequest{}, &otsprotocol.GetRangeResponse{})
+	register("ListStream", &otsprotocol.ListStreamRequest{}, &otsprotocol.ListStreamResponse{})
+	register("DescribeStream", &otsprotocol.DescribeStreamRequest{}, &otsprotocol.DescribeStreamResponse{})
+	register("GetShardIterator", &otsprotocol.GetShardIteratorRequest{}, &otsprotocol.GetShardIteratorResponse{})
+	register("GetStreamRecord", &otsprotocol.GetStreamRecordRequest{}, &otsprotocol.GetStreamRecordResponse{})
+	register("ComputeSplitPointsBySize", &otsprotocol.ComputeSplitPointsBySizeRequest{}, &otsprotocol.ComputeSplitPointsBySizeResponse{})
+	register("Search", &otsprotocol.SearchRequest{}, &otsprotocol.SearchResponse{})
+	register("CreateSearchIndex", &otsprotocol.CreateSearchIndexRequest{}, &otsprotocol.CreateSearchIndexResponse{})
+	register("ListSearchIndex", &otsprotocol.ListSearchIndexRequest{}, &otsprotocol.ListSearchIndexResponse{})
+	register("DeleteSearchIndex", &otsprotocol.DeleteSearchIndexRequest{}, &otsprotocol.DeleteSearchIndexResponse{})
+	register("DescribeSearchIndex", &otsprotocol.DescribeSearchIndexRequest{}, &otsprotocol.DescribeSearchIndexResponse{})
+	register("CreateIndex", &otsprotocol.CreateIndexRequest{}, &otsprotocol.CreateIndexResponse{})
+	register("DropIndex", &otsprotocol.DropIndexRequest{}, &otsprotocol.DropIndexResponse{})
+}
+
+func requestOf(action string) proto.Message {
+	if types, ok := messages[action]; ok {
+		return reflect.New(types[0]).Interface().(proto.Message)
+	}
+	return nil
+}
+
+func responseOf(action string) proto.Message {
+	if types, ok := messages[action]; ok {
+		return reflect.New(types[1]).Interface().(proto.Message)
+	}
+	return nil
+}
+
+// summary returns the JSON summary of a body decoded into message, or ""
+// if it cannot be decoded.
+func summary(message proto.Message, body []byte) string {
+	if message == nil || len(body) == 0 {
+		return ""
+	}
+	if err := proto.Unmarshal(body, message); err != nil {
+		return ""
+	}
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(summarize(reflect.ValueOf(message))); err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// summarize turns a protobuf message into maps and slices whose binary
+// fields are replaced by their size.
+func summarize(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		if stringer, ok := v.Interface().(fmt.Stringer); ok && v.Elem().Kind() == reflect.Int32 {
+			return stringer.String()
+		}
+		return summarize(v.Elem())
+	case reflect.Struct:
+		fields := make(map[string]interface{})
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			tag := field.Tag.Get("protobuf")
+			if tag == "" {
+				continue
+			}
+			value := v.Field(i)
+			if (value.Kind() == reflect.Ptr || value.Kind() == reflect.Slice) && value.IsNil() {
+				continue
+			}
+			name := field.Name
+			for _, part := range strings.Split(tag, ",") {
+				if strings.HasPrefix(part, "name=") {
+					name = strings.TrimPrefix(part, "name=")
+				}
+			}
+			fields[name] = summarize(value)
+		}
+		return fields
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return fmt.Sprintf("<%d bytes>", v.Len())
+		}
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = summarize(v.Index(i))
+		}
+		return list
+	case reflect.Int32:
+		if stringer, ok := v.Interface().(fmt.Stringer); ok {
+			return stringer.String()
+		}
+	}
+	return v.Interface()
+}
@@ -0,0 +1,73 @@
+package har
+
+import (
+	"encoding/json"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	recorder := NewRecorder()
+	client := server.NewTableStoreClient(tablestore.SetHttpClient(recorder))
+
+	meta := &tablestore.TableMeta{TableName: "t"}
+	meta.AddPrimaryKeyColumn("pk", tablestore.PrimaryKeyType_STRING)
+	if _, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+		t.Fatal(err)
+	}
+	server.FailNext("PutRow", 1, "OTSServerBusy", "Server is busy.")
+	change := &tablestore.PutRowChange{TableName: "t", PrimaryKey: new(tablestore.PrimaryKey)}
+	change.PrimaryKey.AddPrimaryKeyColumn("pk", "confidential")
+	change.AddColumn("col", "confidential")
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: change}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := recorder.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("expect 3 entries, got %d", len(entries))
+	}
+	busy := entries[1]
+	if busy.Response.Status != 503 || !strings.Contains(busy.Response.Content.Text, `"code":"OTSServerBusy"`) {
+		t.Errorf("unexpected response %+v", busy.Response)
+	}
+	if text := busy.Request.PostData.Text; !strings.Contains(text, `"table_name":"t"`) || !strings.Contains(text, `"row":"<`) {
+		t.Errorf("unexpected request summary %s", text)
+	}
+	if text := entries[2].Response.Content.Text; !strings.Contains(text, `"write":1`) {
+		t.Errorf("unexpected response summary %s", text)
+	}
+
+	dir, err := ioutil.TempDir("", "har")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "trace.har")
+	if err := recorder.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"confidential", `"value": "id"`} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("trace contains %s", secret)
+		}
+	}
+	var log struct {
+		Log Log `json:"log"`
+	}
+	if err := json.Unmarshal(data, &log); err != nil || log.Log.Version != "1.2" || len(log.Log.Entries) != 3 {
+		t.Errorf("invalid HAR document: %v", err)
+	}
+}
@@ -0,0 +1,469 @@
+// Package hbase is a thin adapter giving tables the Get, Put, Delete and Scan
+// semantics of HBase, to ease porting code written against it:
+//
+//	table := hbase.New(client, "webtable", hbase.Options{})
+//	err := table.Put(hbase.NewPut([]byte("com.example/")).Add("contents", "html", page))
+//	result, err := table.Get(hbase.NewGet([]byte("com.example/")).AddFamily("contents"))
+//	html := result.Value("contents", "html")
+//
+//	scanner := table.Scan(hbase.NewScan([]byte("com."), []byte("com/")).AddFamily("anchor"))
+//	for {
+//		result, err := scanner.Next()
+//		if err == io.EOF {
+//			break
+//		}
+//		...
+//	}
+//
+// Rows are keyed by a binary primary key column, and the cells of a column
+// family are the columns whose name starts with the family and the
+// separator: family names must not contain the separator. Column versions
+// are cell versions, whose timestamps are milliseconds. Values are binaries.
+package hbase
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"io"
+	"strings"
+)
+
+type Options struct {
+	// name of the primary key column, "rowkey" by default
+	RowKey string
+	// separator of the families and qualifiers of column names, "_" by
+	// default
+	Separator string
+}
+
+// Cell is a version of a column of a row.
+type Cell struct {
+	Family    string
+	Qualifier string
+	Timestamp int64
+	Value     []byte
+}
+
+// Result is a row read, nil when missing. Its cells are sorted by column and
+// by descending timestamp.
+type Result struct {
+	Row   []byte
+	Cells []*Cell
+}
+
+// Value returns the latest value of a column, nil if the result has none.
+func (result *Result) Value(family, qualifier string) []byte {
+	if result == nil {
+		return nil
+	}
+	for _, cell := range result.Cells {
+		if cell.Family == family && cell.Qualifier == qualifier {
+			return cell.Value
+		}
+	}
+	return nil
+}
+
+// FamilyMap returns the latest values of the columns of a family by qualifier.
+func (result *Result) FamilyMap(family string) map[string][]byte {
+	values := make(map[string][]byte)
+	if result == nil {
+		return values
+	}
+	for _, cell := range result.Cells {
+		if _, ok := values[cell.Qualifier]; cell.Family == family && !ok {
+			values[cell.Qualifier] = cell.Value
+		}
+	}
+	return values
+}
+
+type column struct {
+	family, qualifier string
+}
+
+// selection is the columns read by a Get or a Scan.
+type selection struct {
+	families    map[string]bool
+	columns     map[column]bool
+	maxVersions int
+	timeRange   *tablestore.TimeRange
+}
+
+func (s *selection) addFamily(family string) {
+	if s.families == nil {
+		s.families = make(map[string]bool)
+	}
+	s.families[family] = true
+}
+
+func (s *selection) addColumn(family, qualifier string) {
+	if s.columns == nil {
+		s.columns = make(map[column]bool)
+	}
+	s.columns[column{family, qualifier}] = true
+}
+
+// columnsToGet returns the columns read: all of them if families are
+// selected, filtered out of the results.
+func (s *selection) columnsToGet(table *Table) ([]string, error) {
+	if len(s.families) > 0 {
+		return nil, nil
+	}
+	var columns []string
+	for c := range s.columns {
+		name, err := table.column(c.family, c.qualifier)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, name)
+	}
+	return columns, nil
+}
+
+// versions returns the max versions read, 1 by default.
+func (s *selection) versions() int32 {
+	if s.maxVersions == 0 && s.timeRange == nil {
+		return 1
+	}
+	return int32(s.maxVersions)
+}
+
+// keep reports whether the cells of a column are selected.
+func (s *selection) keep(family, qualifier string) bool {
+	return len(s.families) == 0 && len(s.columns) == 0 || s.families[family] || s.columns[column{family, qualifier}]
+}
+
+type Get struct {
+	row []byte
+	selection
+}
+
+// NewGet returns a Get of the latest version of all the columns of row.
+func NewGet(row []byte) *Get {
+	return &Get{row: row}
+}
+
+func (get *Get) AddFamily(family string) *Get {
+	get.addFamily(family)
+	return get
+}
+
+func (get *Get) AddColumn(family, qualifier string) *Get {
+	get.addColumn(family, qualifier)
+	return get
+}
+
+// SetMaxVersions sets the versions read of each column, all the versions
+// within the time range if 0 and a time range is set, 1 by default.
+func (get *Get) SetMaxVersions(maxVersions int) *Get {
+	get.maxVersions = maxVersions
+	return get
+}
+
+// SetTimeRange restricts the versions read to timestamps in [min, max).
+func (get *Get) SetTimeRange(min, max int64) *Get {
+	get.timeRange = &tablestore.TimeRange{Start: min, End: max}
+	return get
+}
+
+type Put struct {
+	row   []byte
+	cells []*Cell
+}
+
+// NewPut returns a Put of cells of row, merged with its other cells.
+func NewPut(row []byte) *Put {
+	return &Put{row: row}
+}
+
+// Add adds a cell, timestamped by the server.
+func (put *Put) Add(family, qualifier string, value []byte) *Put {
+	return put.AddWithTimestamp(family, qualifier, 0, value)
+}
+
+// AddWithTimestamp adds a cell of timestamp, in milliseconds.
+func (put *Put) AddWithTimestamp(family, qualifier string, timestamp int64, value []byte) *Put {
+	put.cells = append(put.cells, &Cell{Family: family, Qualifier: qualifier, Timestamp: timestamp, Value: value})
+	return put
+}
+
+type Delete struct {
+	row      []byte
+	families []string
+	// versions deleted, all of them if Timestamp is 0
+	cells []*Cell
+}
+
+// NewDelete returns a Delete of row, entirely unless families or columns are
+// added.
+func NewDelete(row []byte) *Delete {
+	return &Delete{row: row}
+}
+
+// AddFamily deletes all the columns of a family.
+func (del *Delete) AddFamily(family string) *Delete {
+	del.families = append(del.families, family)
+	return del
+}
+
+// AddColumns deletes all the versions of a column.
+func (del *Delete) AddColumns(family, qualifier string) *Delete {
+	return del.AddColumn(family, qualifier, 0)
+}
+
+// AddColumn deletes the version of a column of timestamp, all of them if 0.
+func (del *Delete) AddColumn(family, qualifier string, timestamp int64) *Delete {
+	del.cells = append(del.cells, &Cell{Family: family, Qualifier: qualifier, Timestamp: timestamp})
+	return del
+}
+
+type Scan struct {
+	start, stop []byte
+	limit       int
+	selection
+}
+
+// NewScan returns a Scan of the rows of [start, stop), from the first row
+// if start is nil, to the last one if stop is nil.
+func NewScan(start, stop []byte) *Scan {
+	return &Scan{start: start, stop: stop}
+}
+
+func (scan *Scan) AddFamily(family string) *Scan {
+	scan.addFamily(family)
+	return scan
+}
+
+func (scan *Scan) AddColumn(family, qualifier string) *Scan {
+	scan.addColumn(family, qualifier)
+	return scan
+}
+
+// SetMaxVersions is Get.SetMaxVersions for the rows scanned.
+func (scan *Scan) SetMaxVersions(maxVersions int) *Scan {
+	scan.maxVersions = maxVersions
+	return scan
+}
+
+// SetTimeRange is Get.SetTimeRange for the rows scanned.
+func (scan *Scan) SetTimeRange(min, max int64) *Scan {
+	scan.timeRange = &tablestore.TimeRange{Start: min, End: max}
+	return scan
+}
+
+// SetLimit limits the rows scanned, unlimited if 0.
+func (scan *Scan) SetLimit(limit int) *Scan {
+	scan.limit = limit
+	return scan
+}
+
+// Table is a table accessed the HBase way. It is safe for concurrent use.
+type Table struct {
+	client  tablestore.TableStoreApi
+	name    string
+	options Options
+}
+
+func New(client tablestore.TableStoreApi, name string, options Options) *Table {
+	if options.RowKey == "" {
+		options.RowKey = "rowkey"
+	}
+	if options.Separator == "" {
+		options.Separator = "_"
+	}
+	return &Table{client: client, name: name, options: options}
+}
+
+// CreateTable creates a table keyed by rows, keeping maxVersions versions of
+// its columns.
+func CreateTable(client tablestore.TableStoreApi, name string, options Options, maxVersions int) error {
+	table := New(client, name, options)
+	meta := &tablestore.TableMeta{TableName: name}
+	meta.AddPrimaryKeyColumn(table.options.RowKey, tablestore.PrimaryKeyType_BINARY)
+	_, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, maxVersions),
+		ReservedThroughput: &tablestore.ReservedThroughput{}})
+	return err
+}
+
+func (table *Table) primaryKey(row []byte) *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn(table.options.RowKey, row)
+	return pk
+}
+
+// column returns the name of the column of a family and a qualifier.
+func (table *Table) column(family, qualifier string) (string, error) {
+	if family == "" || strings.Contains(family, table.options.Separator) {
+		return "", fmt.Errorf("[tablestore] hbase: invalid column family %q", family)
+	}
+	return family + table.options.Separator + qualifier, nil
+}
+
+// result converts a row read to a result, keeping the columns selected.
+func (table *Table) result(pk *tablestore.PrimaryKey, columns []*tablestore.AttributeColumn, s *selection) *Result {
+	result := &Result{Row: pk.PrimaryKeys[0].Value.([]byte)}
+	for _, column := range columns {
+		i := strings.Index(column.ColumnName, table.options.Separator)
+		if i < 0 {
+			continue
+		}
+		cell := &Cell{Family: column.ColumnName[:i], Qualifier: column.ColumnName[i+len(table.options.Separator):], Timestamp: column.Timestamp}
+		if !s.keep(cell.Family, cell.Qualifier) {
+			continue
+		}
+		cell.Value, _ = column.Value.([]byte)
+		result.Cells = append(result.Cells, cell)
+	}
+	return result
+}
+
+// Get reads a row, and returns nil if it is missing or has no cell selected.
+func (table *Table) Get(get *Get) (*Result, error) {
+	columns, err := get.columnsToGet(table)
+	if err != nil {
+		return nil, err
+	}
+	criteria := &tablestore.SingleRowQueryCriteria{TableName: table.name, PrimaryKey: table.primaryKey(get.row), ColumnsToGet: columns,
+		MaxVersion: get.versions(), TimeRange: get.timeRange}
+	resp, err := table.client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil || len(resp.PrimaryKey.PrimaryKeys) == 0 {
+		return nil, err
+	}
+	return table.result(&resp.PrimaryKey, resp.Columns, &get.selection), nil
+}
+
+// Put writes the cells of put.
+func (table *Table) Put(put *Put) error {
+	change := &tablestore.UpdateRowChange{TableName: table.name, PrimaryKey: table.primaryKey(put.row)}
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	for _, cell := range put.cells {
+		name, err := table.column(cell.Family, cell.Qualifier)
+		if err != nil {
+			return err
+		}
+		change.Columns = append(change.Columns, tablestore.ColumnToUpdate{ColumnName: name, Value: cell.Value,
+			Timestamp: cell.Timestamp, HasTimestamp: cell.Timestamp != 0})
+	}
+	_, err := table.client.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: change})
+	return err
+}
+
+// Delete deletes the row of del, or its columns. The columns of the families
+// deleted are read first, and columns of them written meanwhile are kept.
+func (table *Table) Delete(del *Delete) error {
+	pk := table.primaryKey(del.row)
+	if len(del.families) == 0 && len(del.cells) == 0 {
+		change := &tablestore.DeleteRowChange{TableName: table.name, PrimaryKey: pk}
+		change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		_, err := table.client.DeleteRow(&tablestore.DeleteRowRequest{DeleteRowChange: change})
+		return err
+	}
+
+	change := &tablestore.UpdateRowChange{TableName: table.name, PrimaryKey: pk}
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	for _, cell := range del.cells {
+		name, err := table.column(cell.Family, cell.Qualifier)
+		if err != nil {
+			return err
+		}
+		if cell.Timestamp == 0 {
+			change.DeleteColumn(name)
+		} else {
+			change.DeleteColumnWithTimestamp(name, cell.Timestamp)
+		}
+	}
+	if len(del.families) > 0 {
+		get := NewGet(del.row)
+		for _, family := range del.families {
+			get.AddFamily(family)
+		}
+		result, err := table.Get(get)
+		if err != nil {
+			return err
+		}
+		deleted := make(map[string]bool)
+		for _, cell := range result.cells() {
+			if name := cell.Family + table.options.Separator + cell.Qualifier; !deleted[name] {
+				deleted[name] = true
+				change.DeleteColumn(name)
+			}
+		}
+	}
+	if len(change.Columns) == 0 {
+		return nil
+	}
+	_, err := table.client.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: change})
+	return err
+}
+
+func (result *Result) cells() []*Cell {
+	if result == nil {
+		return nil
+	}
+	return result.Cells
+}
+
+// Scanner reads the rows of a Scan page by page.
+type Scanner struct {
+	table    *Table
+	scan     *Scan
+	criteria *tablestore.RangeRowQueryCriteria
+	rows     []*tablestore.Row
+	read     int
+	done     bool
+	err      error
+}
+
+// Scan returns a scanner of the rows of scan.
+func (table *Table) Scan(scan *Scan) *Scanner {
+	scanner := &Scanner{table: table, scan: scan}
+	columns, err := scan.columnsToGet(table)
+	if err != nil {
+		scanner.err = err
+		return scanner
+	}
+	start, end := new(tablestore.PrimaryKey), new(tablestore.PrimaryKey)
+	if scan.start != nil {
+		start.AddPrimaryKeyColumn(table.options.RowKey, scan.start)
+	} else {
+		start.AddPrimaryKeyColumnWithMinValue(table.options.RowKey)
+	}
+	if scan.stop != nil {
+		end.AddPrimaryKeyColumn(table.options.RowKey, scan.stop)
+	} else {
+		end.AddPrimaryKeyColumnWithMaxValue(table.options.RowKey)
+	}
+	scanner.criteria = &tablestore.RangeRowQueryCriteria{TableName: table.name, StartPrimaryKey: start, EndPrimaryKey: end,
+		ColumnsToGet: columns, MaxVersion: scan.versions(), TimeRange: scan.timeRange, Direction: tablestore.FORWARD}
+	return scanner
+}
+
+// Next returns the next row, and io.EOF after the last one.
+func (scanner *Scanner) Next() (*Result, error) {
+	if scanner.err != nil {
+		return nil, scanner.err
+	}
+	for len(scanner.rows) == 0 {
+		if scanner.done || scanner.scan.limit > 0 && scanner.read >= scanner.scan.limit {
+			return nil, io.EOF
+		}
+		if scanner.scan.limit > 0 {
+			scanner.criteria.Limit = int32(scanner.scan.limit - scanner.read)
+		}
+		resp, err := scanner.table.client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: scanner.criteria})
+		if err != nil {
+			return nil, err
+		}
+		scanner.rows = resp.Rows
+		if resp.NextStartPrimaryKey == nil {
+			scanner.done = true
+		} else {
+			scanner.criteria.StartPrimaryKey = resp.NextStartPrimaryKey
+		}
+	}
+	row := scanner.rows[0]
+	scanner.rows = scanner.rows[1:]
+	scanner.read++
+	return scanner.table.result(row.PrimaryKey, row.Columns, &scanner.scan.selection), nil
+}
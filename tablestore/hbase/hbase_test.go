@@ -0,0 +1,102 @@
+package hbase
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"io"
+	"testing"
+)
+
+func TestTable(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	server.Store.RangeLimit = 1
+	client := server.NewTableStoreClient()
+	if err := CreateTable(client, "webtable", Options{}, 3); err != nil {
+		t.Fatal(err)
+	}
+	table := New(client, "webtable", Options{})
+
+	row := []byte("com.example/")
+	err := table.Put(NewPut(row).AddWithTimestamp("contents", "html", 1000, []byte("<v1>")).Add("anchor", "home", []byte("Example")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := table.Put(NewPut(row).AddWithTimestamp("contents", "html", 2000, []byte("<v2>"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.Put(NewPut([]byte("org.example/")).Add("anchor", "home", []byte("Org"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.Put(NewPut(row).Add("bad_family", "q", nil)); err == nil {
+		t.Error("family containing the separator accepted")
+	}
+
+	result, err := table.Get(NewGet(row))
+	if err != nil || string(result.Value("contents", "html")) != "<v2>" || string(result.Value("anchor", "home")) != "Example" {
+		t.Fatalf("unexpected result %+v, %v", result, err)
+	}
+	result, err = table.Get(NewGet(row).AddFamily("contents").SetMaxVersions(3))
+	if err != nil || len(result.Cells) != 2 || result.Cells[1].Timestamp != 1000 || result.Value("anchor", "home") != nil {
+		t.Errorf("unexpected result %+v, %v", result, err)
+	}
+	// no cell in the time range
+	result, err = table.Get(NewGet(row).AddColumn("anchor", "home").SetTimeRange(0, 5000))
+	if err != nil || result != nil {
+		t.Errorf("unexpected result %+v, %v", result, err)
+	}
+	result, err = table.Get(NewGet(row).AddColumn("contents", "html").SetTimeRange(0, 1500))
+	if err != nil || len(result.Cells) != 1 || string(result.Cells[0].Value) != "<v1>" {
+		t.Errorf("unexpected result %+v, %v", result, err)
+	}
+	if values := result.FamilyMap("contents"); len(values) != 1 || string(values["html"]) != "<v1>" {
+		t.Errorf("unexpected family %v", values)
+	}
+	if result, err := table.Get(NewGet([]byte("missing"))); err != nil || result != nil {
+		t.Errorf("unexpected result %+v, %v", result, err)
+	}
+
+	var rows []string
+	scanner := table.Scan(NewScan(nil, nil).AddFamily("anchor"))
+	for {
+		result, err := scanner.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, string(result.Row)+"="+string(result.Value("anchor", "home")))
+	}
+	if len(rows) != 2 || rows[0] != "com.example/=Example" || rows[1] != "org.example/=Org" {
+		t.Errorf("unexpected scan %q", rows)
+	}
+	scanner = table.Scan(NewScan([]byte("com."), []byte("com/")))
+	if result, err := scanner.Next(); err != nil || string(result.Row) != "com.example/" {
+		t.Errorf("unexpected row %+v, %v", result, err)
+	}
+	if _, err := scanner.Next(); err != io.EOF {
+		t.Errorf("scan out of its range: %v", err)
+	}
+	if result, err := table.Scan(NewScan(nil, nil).SetLimit(1)).Next(); err != nil || string(result.Row) != "com.example/" {
+		t.Errorf("unexpected row %+v, %v", result, err)
+	}
+
+	if err := table.Delete(NewDelete(row).AddColumn("contents", "html", 2000)); err != nil {
+		t.Fatal(err)
+	}
+	if result, _ := table.Get(NewGet(row)); string(result.Value("contents", "html")) != "<v1>" {
+		t.Errorf("version not deleted: %+v", result)
+	}
+	if err := table.Delete(NewDelete(row).AddFamily("contents")); err != nil {
+		t.Fatal(err)
+	}
+	if result, _ := table.Get(NewGet(row)); len(result.Cells) != 1 || result.Cells[0].Family != "anchor" {
+		t.Errorf("family not deleted: %+v", result)
+	}
+	if err := table.Delete(NewDelete(row)); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := table.Get(NewGet(row)); err != nil || result != nil {
+		t.Errorf("row not deleted: %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,80 @@
+package tablestore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+)
+
+// IdempotencyTokenColumn is the column of the rows written by PutRowIdempotent
+// holding the token of the logical write which created them.
+const IdempotencyTokenColumn = "_idempotency_token"
+
+// ErrAutoIncrementToken is returned by PutRowIdempotent for rows whose
+// primary key is generated by the service, which can not be checked back.
+var ErrAutoIncrementToken = errors.New("[tablestore] idempotent put of an auto increment primary key")
+
+// NewIdempotencyToken returns a random token, to be generated once per logical
+// write and reused by all of its retries.
+func NewIdempotencyToken() string {
+	token := make([]byte, 16)
+	rand.Read(token)
+	return hex.EncodeToString(token)
+}
+
+// PutRowIdempotent puts the row of change, with token in
+// IdempotencyTokenColumn, if it does not exist. It is meant for writes retried
+// after failures whose outcome is unknown, such as timeouts or lost
+// connections, which otherwise may record twice the same logical write:
+//
+//	token := tablestore.NewIdempotencyToken()
+//	resp, err := client.PutRowIdempotent(change, token)
+//	// on an ambiguous error, retrying with the same token is safe
+//
+// Ambiguous failures, i.e. transport errors and OTSTimeout,
+// OTSInternalServerError, OTSServerUnavailable or 5xx responses, are retried
+// by the client as any retryable error, within the retry policy of the table.
+// A put failing because the row exists succeeds if the row holds token, i.e.
+// was written by a former attempt, and fails with ErrRowAlreadyExists
+// otherwise. change is not modified.
+func (tableStoreClient *TableStoreClient) PutRowIdempotent(change *PutRowChange, token string) (*PutRowResponse, error) {
+	for _, pk := range change.PrimaryKey.PrimaryKeys {
+		if pk.PrimaryKeyOption == AUTO_INCREMENT {
+			return nil, ErrAutoIncrementToken
+		}
+	}
+	c := *change
+	c.Columns = append(append([]AttributeColumn(nil), change.Columns...), AttributeColumn{ColumnName: IdempotencyTokenColumn, Value: token})
+	c.Condition = &RowCondition{RowExistenceExpectation: RowExistenceExpectation_EXPECT_NOT_EXIST}
+
+	client := *tableStoreClient
+	client.retryAmbiguous = true
+	resp, err := client.PutRow(&PutRowRequest{PutRowChange: &c})
+	if !IsConditionCheckFail(err) {
+		return resp, err
+	}
+	written, err := tableStoreClient.hasIdempotencyToken(change, token)
+	if err != nil {
+		return nil, err
+	}
+	if !written {
+		return nil, ErrRowAlreadyExists
+	}
+	return &PutRowResponse{ConsumedCapacityUnit: &ConsumedCapacityUnit{}, PrimaryKey: *change.PrimaryKey}, nil
+}
+
+// hasIdempotencyToken reports whether the row of change holds token.
+func (tableStoreClient *TableStoreClient) hasIdempotencyToken(change *PutRowChange, token string) (bool, error) {
+	criteria := &SingleRowQueryCriteria{TableName: change.TableName, PrimaryKey: change.PrimaryKey, MaxVersion: 1}
+	criteria.AddColumnToGet(IdempotencyTokenColumn)
+	resp, err := tableStoreClient.GetRow(&GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil {
+		return false, err
+	}
+	for _, column := range resp.Columns {
+		if column.ColumnName == IdempotencyTokenColumn && column.Value == token {
+			return true, nil
+		}
+	}
+	return false, nil
+}
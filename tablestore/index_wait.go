@@ -0,0 +1,79 @@
+package tablestore
+
+import (
+	"context"
+	"github.com/golang/protobuf/proto"
+	"time"
+)
+
+// interval of WaitIndexReady and WaitSearchIndexReady polls if 0
+const defaultIndexWaitInterval = 5 * time.Second
+
+// parseIndexSyncPhase returns the phase of the optional IndexSyncPhase
+// index_sync_phase = 6 of IndexMeta, ISP_FULL = 2 while the index is built
+// from the data of the table and ISP_INCR = 3 then, which otsprotocol.IndexMeta
+// does not know and keeps in its unrecognized fields; 0 if it is missing.
+func parseIndexSyncPhase(unrecognized []byte) SyncPhase {
+	var phase SyncPhase
+	walkFields(unrecognized, func(number, wire uint64, value []byte) error {
+		if number != 6 || wire != proto.WireVarint {
+			return nil
+		}
+		switch v, _ := proto.DecodeVarint(value); v {
+		case 2:
+			phase = SyncPhase_FULL
+		case 3:
+			phase = SyncPhase_INCR
+		}
+		return nil
+	})
+	return phase
+}
+
+// WaitIndexReady polls the table every interval until its secondary index is
+// listed and, if the service reports the SyncPhase of the index, built from
+// the data of the table, e.g. after a CreateIndex with IncludeBaseData, or
+// until ctx is done.
+func WaitIndexReady(ctx context.Context, client TableStoreApi, table, index string, interval time.Duration) error {
+	return waitIndex(ctx, interval, func() (bool, error) {
+		resp, err := client.DescribeTable(&DescribeTableRequest{TableName: table})
+		if err != nil {
+			return false, err
+		}
+		for _, meta := range resp.IndexMetas {
+			if meta.IndexName == index {
+				return meta.SyncPhase != SyncPhase_FULL, nil
+			}
+		}
+		return false, nil
+	})
+}
+
+// WaitSearchIndexReady polls the search index every interval until it is
+// built from the data of the table, in SyncPhase_INCR, or until ctx is done.
+func WaitSearchIndexReady(ctx context.Context, client TableStoreApi, table, index string, interval time.Duration) error {
+	return waitIndex(ctx, interval, func() (bool, error) {
+		resp, err := client.DescribeSearchIndex(&DescribeSearchIndexRequest{TableName: table, IndexName: index})
+		if err != nil {
+			return false, err
+		}
+		return resp.SyncStat != nil && resp.SyncStat.SyncPhase == SyncPhase_INCR, nil
+	})
+}
+
+func waitIndex(ctx context.Context, interval time.Duration, ready func() (bool, error)) error {
+	if interval <= 0 {
+		interval = defaultIndexWaitInterval
+	}
+	for {
+		ok, err := ready()
+		if ok || err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package tablestore
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+)
+
+// Invoker sends one HTTP request of an action, e.g. "/GetRow", with the
+// protobuf body of the request. It returns the response body, an error for
+// transport failures and non-2xx responses (whose body is an otsprotocol.Error),
+// the HTTP status and the request id.
+type Invoker func(uri string, body []byte) ([]byte, error, int, string)
+
+// Interceptor wraps every attempt of an API call, retries included, e.g. to
+// observe requests or inject faults. It may change the request or the response,
+// or answer without calling next.
+type Interceptor func(uri string, body []byte, next Invoker) ([]byte, error, int, string)
+
+// AddInterceptor appends interceptors to the chain of the client. The first
+// interceptor added is the outermost one.
+func AddInterceptor(interceptors ...Interceptor) ClientOption {
+	return func(client *TableStoreClient) {
+		client.interceptors = append(client.interceptors, interceptors...)
+	}
+}
+
+func (tableStoreClient *TableStoreClient) invoke(ctx context.Context, uri string, body []byte, resp proto.Message) ([]byte, error, int, string) {
+	invoker := func(uri string, body []byte) ([]byte, error, int, string) {
+		url := fmt.Sprintf("%s%s", tableStoreClient.endPoint, uri)
+		return tableStoreClient.doRequest(ctx, url, uri, body, resp)
+	}
+	for i := len(tableStoreClient.interceptors) - 1; i >= 0; i-- {
+		interceptor, next := tableStoreClient.interceptors[i], invoker
+		invoker = func(uri string, body []byte) ([]byte, error, int, string) {
+			return interceptor(uri, body, next)
+		}
+	}
+	return invoker(uri, body)
+}
@@ -6,6 +6,8 @@ type TableStoreApi interface {
 	DeleteTable(request *DeleteTableRequest) (*DeleteTableResponse, error)
 	DescribeTable(request *DescribeTableRequest) (*DescribeTableResponse, error)
 	UpdateTable(request *UpdateTableRequest) (*UpdateTableResponse, error)
+	CreateIndex(request *CreateIndexRequest) (*CreateIndexResponse, error)
+	DeleteIndex(request *DeleteIndexRequest) (*DeleteIndexResponse, error)
 	PutRow(request *PutRowRequest) (*PutRowResponse, error)
 	DeleteRow(request *DeleteRowRequest) (*DeleteRowResponse, error)
 	GetRow(request *GetRowRequest) (*GetRowResponse, error)
@@ -13,10 +15,20 @@ type TableStoreApi interface {
 	BatchGetRow(request *BatchGetRowRequest) (*BatchGetRowResponse, error)
 	BatchWriteRow(request *BatchWriteRowRequest) (*BatchWriteRowResponse, error)
 	GetRange(request *GetRangeRequest) (*GetRangeResponse, error)
+	ComputeSplitPointsBySize(request *ComputeSplitPointsBySizeRequest) (*ComputeSplitPointsBySizeResponse, error)
 
 	// stream related
 	ListStream(request *ListStreamRequest) (*ListStreamResponse, error)
 	DescribeStream(request *DescribeStreamRequest) (*DescribeStreamResponse, error)
 	GetShardIterator(request *GetShardIteratorRequest) (*GetShardIteratorResponse, error)
 	GetStreamRecord(request *GetStreamRecordRequest) (*GetStreamRecordResponse, error)
+
+	// search related
+	CreateSearchIndex(request *CreateSearchIndexRequest) (*CreateSearchIndexResponse, error)
+	DeleteSearchIndex(request *DeleteSearchIndexRequest) (*DeleteSearchIndexResponse, error)
+	ListSearchIndex(request *ListSearchIndexRequest) (*ListSearchIndexResponse, error)
+	DescribeSearchIndex(request *DescribeSearchIndexRequest) (*DescribeSearchIndexResponse, error)
+	Search(request *SearchRequest) (*SearchResponse, error)
 }
+
+var _ TableStoreApi = (*TableStoreClient)(nil)
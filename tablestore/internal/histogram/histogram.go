@@ -0,0 +1,116 @@
+// Package histogram records latencies in exponential buckets.
+package histogram
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// buckets grow by 2^(1/subBuckets), i.e. about 9% with 8 sub buckets
+	subBuckets = 8
+	// the first bucket holds latencies up to 1µs, the last one from about 70s
+	bucketCount = 26*subBuckets + 1
+)
+
+// Histogram counts latencies in exponentially growing buckets. Quantiles are
+// accurate to the bucket width, about 9%. It is not safe for concurrent use.
+type Histogram struct {
+	buckets [bucketCount]int64
+	count   int64
+	sum     time.Duration
+	min     time.Duration
+	max     time.Duration
+}
+
+func bucketOf(d time.Duration) int {
+	if d <= time.Microsecond {
+		return 0
+	}
+	i := int(math.Ceil(math.Log2(float64(d)/float64(time.Microsecond)) * subBuckets))
+	if i >= bucketCount {
+		return bucketCount - 1
+	}
+	return i
+}
+
+// upper bound of bucket i
+func bucketBound(i int) time.Duration {
+	return time.Duration(float64(time.Microsecond) * math.Exp2(float64(i)/subBuckets))
+}
+
+func (h *Histogram) Record(d time.Duration) {
+	h.buckets[bucketOf(d)]++
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.count++
+	h.sum += d
+}
+
+// Merge adds the latencies recorded by other.
+func (h *Histogram) Merge(other *Histogram) {
+	if other.count == 0 {
+		return
+	}
+	for i, n := range other.buckets {
+		h.buckets[i] += n
+	}
+	if h.count == 0 || other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+	h.count += other.count
+	h.sum += other.sum
+}
+
+func (h *Histogram) Count() int64 {
+	return h.count
+}
+
+func (h *Histogram) Min() time.Duration {
+	return h.min
+}
+
+func (h *Histogram) Max() time.Duration {
+	return h.max
+}
+
+func (h *Histogram) Mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.count)
+}
+
+// Quantile returns the latency below which fall a fraction q of the recorded
+// latencies, e.g. 0.99 for the 99th percentile.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(h.count)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, n := range h.buckets {
+		seen += n
+		if seen >= rank {
+			d := bucketBound(i)
+			if d > h.max {
+				d = h.max
+			}
+			if d < h.min {
+				d = h.min
+			}
+			return d
+		}
+	}
+	return h.max
+}
@@ -0,0 +1,94 @@
+package tablestore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrColumnNotFound is returned when reading a column a row does not have.
+var ErrColumnNotFound = errors.New("[tablestore] column not found")
+
+// JSONCodec converts values from and to their JSON encoding, in STRING
+// columns, or in BINARY columns if Binary is set. Both are decoded. It is
+// registered as the codec "json", e.g. for the orm tag option `codec=json`.
+type JSONCodec struct {
+	Binary bool
+}
+
+func (codec JSONCodec) Encode(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("[tablestore] can not encode %T as JSON: %v", v, err)
+	}
+	if codec.Binary {
+		return data, nil
+	}
+	return string(data), nil
+}
+
+func (codec JSONCodec) Decode(value interface{}, target interface{}) error {
+	var data []byte
+	switch value := value.(type) {
+	case string:
+		data = []byte(value)
+	case []byte:
+		data = value
+	default:
+		return fmt.Errorf("[tablestore] JSON of type %T, not a string or binary", value)
+	}
+	if err := json.Unmarshal(data, target); err != nil {
+		return fmt.Errorf("[tablestore] invalid JSON column: %v", err)
+	}
+	return nil
+}
+
+func init() {
+	RegisterColumnCodec("json", JSONCodec{})
+}
+
+// AddJSONColumn adds v encoded as JSON by encoding/json in a STRING column.
+func (rowchange *PutRowChange) AddJSONColumn(columnName string, v interface{}) error {
+	value, err := JSONCodec{}.Encode(v)
+	if err != nil {
+		return err
+	}
+	rowchange.AddColumn(columnName, value)
+	return nil
+}
+
+// PutJSONColumn puts v encoded as JSON by encoding/json in a STRING column.
+func (rowchange *UpdateRowChange) PutJSONColumn(columnName string, v interface{}) error {
+	value, err := JSONCodec{}.Encode(v)
+	if err != nil {
+		return err
+	}
+	rowchange.PutColumn(columnName, value)
+	return nil
+}
+
+// GetJSONColumn decodes the latest version of the JSON column, STRING or
+// BINARY, into v as json.Unmarshal does. It returns ErrColumnNotFound if the
+// row has no such column.
+func (row *Row) GetJSONColumn(columnName string, v interface{}) error {
+	return getJSONColumn(row.Columns, columnName, v)
+}
+
+func (response *GetRowResponse) GetJSONColumn(columnName string, v interface{}) error {
+	return getJSONColumn(response.Columns, columnName, v)
+}
+
+func (result *RowResult) GetJSONColumn(columnName string, v interface{}) error {
+	return getJSONColumn(result.Columns, columnName, v)
+}
+
+// getJSONColumn decodes the first column named columnName, which is the
+// latest version in rows returned by the server.
+func getJSONColumn(columns []*AttributeColumn, columnName string, v interface{}) error {
+	for _, column := range columns {
+		if column.ColumnName == columnName {
+			return JSONCodec{}.Decode(column.Value, v)
+		}
+	}
+	return ErrColumnNotFound
+}
@@ -0,0 +1,147 @@
+package lock
+
+import (
+	"context"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"sync"
+	"time"
+)
+
+// Leader is the holder of the lock of an election, zero if there is none.
+type Leader struct {
+	Owner string
+	Token int64
+}
+
+// Election elects a leader among the processes campaigning on the same lock,
+// e.g. the active instance of an active/passive worker:
+//
+//	election := lock.NewElection(client, "locks", "indexer", lock.Options{Owner: hostname})
+//	election.OnElected = func(token int64) { go startIndexing(token) }
+//	election.OnDeposed = stopIndexing
+//	err := election.Campaign(ctx)
+//
+// A leader is deposed when its lease is lost, e.g. because it could not
+// renew it in time, and campaigns again.
+type Election struct {
+	lock *Lock
+
+	// OnElected is called with the fencing token of the lease when the
+	// process becomes the leader, and OnDeposed when it stops being the
+	// leader. They must not block.
+	OnElected func(token int64)
+	OnDeposed func()
+
+	mutex  sync.Mutex
+	leader bool
+	cancel context.CancelFunc
+}
+
+func NewElection(client tablestore.TableStoreApi, table, name string, options Options) *Election {
+	return &Election{lock: New(client, table, name, options)}
+}
+
+// Campaign campaigns for leadership until ctx is done or Resign is called,
+// and then resigns. Errors reaching the table are retried.
+func (election *Election) Campaign(ctx context.Context) error {
+	campaign, cancel := context.WithCancel(ctx)
+	defer cancel()
+	election.mutex.Lock()
+	election.cancel = cancel
+	election.mutex.Unlock()
+
+	for {
+		token, err := election.lock.Lock(campaign)
+		if campaign.Err() != nil {
+			// the campaign may have ended while the lock was acquired
+			if err == nil {
+				election.lock.Unlock()
+			}
+			return ctx.Err()
+		}
+		if err != nil {
+			select {
+			case <-campaign.Done():
+				return ctx.Err()
+			case <-time.After(election.lock.options.RetryInterval):
+			}
+			continue
+		}
+
+		election.setLeader(true)
+		if election.OnElected != nil {
+			election.OnElected(token)
+		}
+		select {
+		case <-election.lock.Lost():
+			election.setLeader(false)
+			if election.OnDeposed != nil {
+				election.OnDeposed()
+			}
+		case <-campaign.Done():
+			election.lock.Unlock()
+			election.setLeader(false)
+			if election.OnDeposed != nil {
+				election.OnDeposed()
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+// Resign stops the campaign, releasing the leadership if held.
+func (election *Election) Resign() {
+	election.mutex.Lock()
+	defer election.mutex.Unlock()
+	if election.cancel != nil {
+		election.cancel()
+	}
+}
+
+func (election *Election) setLeader(leader bool) {
+	election.mutex.Lock()
+	defer election.mutex.Unlock()
+	election.leader = leader
+}
+
+// IsLeader reports whether the process is the leader.
+func (election *Election) IsLeader() bool {
+	election.mutex.Lock()
+	defer election.mutex.Unlock()
+	return election.leader
+}
+
+// Leader returns the current leader, whoever campaigned for it.
+func (election *Election) Leader() (Leader, error) {
+	owner, token, err := election.lock.Holder()
+	return Leader{Owner: owner, Token: token}, err
+}
+
+// Observe sends the leader on the returned channel each time it changes, as
+// seen every interval, until ctx is done. Errors reaching the table are
+// retried at the next interval.
+func (election *Election) Observe(ctx context.Context, interval time.Duration) <-chan Leader {
+	leaders := make(chan Leader)
+	go func() {
+		defer close(leaders)
+		var last *Leader
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if leader, err := election.Leader(); err == nil && (last == nil || leader != *last) {
+				select {
+				case leaders <- leader:
+					last = &leader
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return leaders
+}
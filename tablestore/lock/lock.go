@@ -0,0 +1,362 @@
+// Package lock provides leases on rows of a table for mutual exclusion
+// between processes, built on conditional writes:
+//
+//	l := lock.New(client, "locks", "billing-job", lock.Options{TTL: 10 * time.Second})
+//	token, err := l.Lock(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	defer l.Unlock()
+//	// pass token along with the writes protected by the lock
+//
+// A lock is held until Unlock, or until its lease expires if it is not
+// renewed, e.g. because its process is paused or partitioned. Leases are
+// renewed in the background while held; Lost is closed once a renewal finds
+// the lease lost, or once renewals failed until a tenth of the TTL before the
+// lease expires, e.g. in a network partition.
+//
+// Since a process may not notice the loss of its lease in time, the resources
+// protected by a lock should reject writes carrying a fencing token lower
+// than the highest one they have seen. Tokens increase each time the lock is
+// acquired.
+//
+// Expirations are compared to the clock of the processes, which must not
+// drift apart by more than a fraction of the TTL.
+//
+// Election elects a leader among processes on top of a lock.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"sync"
+	"time"
+)
+
+// columns of the rows of locks, whose primary key is a string column named
+// NameColumn
+const (
+	NameColumn    = "name"
+	OwnerColumn   = "owner"
+	ExpiresColumn = "expires"
+	TokenColumn   = "token"
+)
+
+var (
+	// ErrLocked is returned by TryLock when the lock is held by another
+	// owner.
+	ErrLocked = errors.New("[tablestore] lock is held by another owner")
+	// ErrNotHeld is returned by Unlock and Renew when the lock is not held,
+	// or its lease was lost.
+	ErrNotHeld = errors.New("[tablestore] lock is not held")
+)
+
+type Options struct {
+	// lease duration, 30s by default
+	TTL time.Duration
+	// interval of the renewals of the lease, TTL/3 by default
+	RenewInterval time.Duration
+	// interval between attempts of Lock, TTL/10 by default
+	RetryInterval time.Duration
+	// owner recorded in the lock row, a random id by default
+	Owner string
+}
+
+// Lock is a lock named Name in a table. It is safe for concurrent use, but
+// is held once at a time: locks must not be shared to exclude goroutines of
+// a process from each other.
+type Lock struct {
+	client  tablestore.TableStoreApi
+	table   string
+	name    string
+	options Options
+
+	lock  sync.Mutex
+	token int64
+	held  bool
+	// the time the lease is held until, less a margin, as of the last
+	// successful renewal
+	deadline time.Time
+	stop     chan struct{}
+	done     chan struct{}
+	lost     chan struct{}
+}
+
+func New(client tablestore.TableStoreApi, table, name string, options Options) *Lock {
+	if options.TTL <= 0 {
+		options.TTL = 30 * time.Second
+	}
+	if options.RenewInterval <= 0 {
+		options.RenewInterval = options.TTL / 3
+	}
+	if options.RetryInterval <= 0 {
+		options.RetryInterval = options.TTL / 10
+	}
+	if options.Owner == "" {
+		id := make([]byte, 8)
+		rand.Read(id)
+		options.Owner = hex.EncodeToString(id)
+	}
+	return &Lock{client: client, table: table, name: name, options: options}
+}
+
+// CreateTable creates a table of locks.
+func CreateTable(client tablestore.TableStoreApi, table string) error {
+	meta := &tablestore.TableMeta{TableName: table}
+	meta.AddPrimaryKeyColumn(NameColumn, tablestore.PrimaryKeyType_STRING)
+	_, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}})
+	return err
+}
+
+func (l *Lock) primaryKey() *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn(NameColumn, l.name)
+	return pk
+}
+
+// leaseDeadline returns the time until which a lease written at start is held
+// for sure, a tenth of the TTL before it expires, against the drift of the
+// clocks and the latency of the renewals.
+func (l *Lock) leaseDeadline(start time.Time) time.Time {
+	return start.Add(l.options.TTL - l.options.TTL/10)
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// state reads the lock row, exists false if the lock was never acquired.
+func (l *Lock) state() (owner string, token, expires int64, exists bool, err error) {
+	criteria := &tablestore.SingleRowQueryCriteria{TableName: l.table, PrimaryKey: l.primaryKey(), MaxVersion: 1}
+	resp, err := l.client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil || len(resp.Columns) == 0 {
+		return "", 0, 0, false, err
+	}
+	for _, column := range resp.Columns {
+		switch column.ColumnName {
+		case OwnerColumn:
+			owner, _ = column.Value.(string)
+		case TokenColumn:
+			token, _ = column.Value.(int64)
+		case ExpiresColumn:
+			expires, _ = column.Value.(int64)
+		}
+	}
+	return owner, token, expires, true, nil
+}
+
+// Holder returns the owner and the token of the lease on the lock, "" and 0
+// if it is free. It may differ from the holder seen by TryLock a moment
+// later.
+func (l *Lock) Holder() (owner string, token int64, err error) {
+	owner, token, expires, _, err := l.state()
+	if err != nil || expires <= millis(time.Now()) {
+		return "", 0, err
+	}
+	return owner, token, nil
+}
+
+// Owner returns the owner recorded by the lock when held.
+func (l *Lock) Owner() string {
+	return l.options.Owner
+}
+
+// TryLock acquires the lock if it is free or its lease expired, and returns
+// the fencing token of the lease. It returns ErrLocked if another owner holds
+// the lock.
+func (l *Lock) TryLock() (int64, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.held {
+		return 0, ErrLocked
+	}
+	_, token, expires, exists, err := l.state()
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	if exists && expires > millis(now) {
+		return 0, ErrLocked
+	}
+
+	token++
+	if !exists {
+		change := &tablestore.PutRowChange{TableName: l.table, PrimaryKey: l.primaryKey()}
+		change.AddColumn(OwnerColumn, l.options.Owner)
+		change.AddColumn(ExpiresColumn, millis(now.Add(l.options.TTL)))
+		change.AddColumn(TokenColumn, token)
+		change.SetCondition(tablestore.RowExistenceExpectation_EXPECT_NOT_EXIST)
+		_, err = l.client.PutRow(&tablestore.PutRowRequest{PutRowChange: change})
+	} else {
+		// the token changes with each owner, so that a single one takes
+		// over an expired lease
+		change := &tablestore.UpdateRowChange{TableName: l.table, PrimaryKey: l.primaryKey()}
+		change.PutColumn(OwnerColumn, l.options.Owner)
+		change.PutColumn(ExpiresColumn, millis(now.Add(l.options.TTL)))
+		change.PutColumn(TokenColumn, token)
+		change.SetCondition(tablestore.RowExistenceExpectation_EXPECT_EXIST)
+		change.SetColumnCondition(tablestore.NewSingleColumnCondition(TokenColumn, tablestore.CT_EQUAL, token-1))
+		_, err = l.client.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: change})
+	}
+	if tablestore.IsConditionCheckFail(err) {
+		return 0, ErrLocked
+	} else if err != nil {
+		return 0, err
+	}
+
+	l.token = token
+	l.held = true
+	l.deadline = l.leaseDeadline(now)
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+	l.lost = make(chan struct{})
+	go l.renew(l.stop, l.done, l.lost)
+	return token, nil
+}
+
+// Lock acquires the lock, waiting for it to be free until ctx is done.
+func (l *Lock) Lock(ctx context.Context) (int64, error) {
+	for {
+		token, err := l.TryLock()
+		if err != ErrLocked {
+			return token, err
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(l.options.RetryInterval):
+		}
+	}
+}
+
+// Token returns the fencing token of the lease held, 0 if none, or if it may
+// have expired since the last renewal.
+func (l *Lock) Token() int64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if !l.held || !time.Now().Before(l.deadline) {
+		return 0
+	}
+	return l.token
+}
+
+// Lost returns a channel closed when the lease held ends, by Unlock or by a
+// renewal finding it lost. It is nil if the lock was never held.
+func (l *Lock) Lost() <-chan struct{} {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.lost
+}
+
+// extend extends the lease held by TTL, or ends it.
+func (l *Lock) extend(end bool) error {
+	now := time.Now()
+	expires := millis(now.Add(l.options.TTL))
+	if end {
+		expires = 0
+	}
+	change := &tablestore.UpdateRowChange{TableName: l.table, PrimaryKey: l.primaryKey()}
+	change.PutColumn(ExpiresColumn, expires)
+	change.SetCondition(tablestore.RowExistenceExpectation_EXPECT_EXIST)
+	change.SetColumnCondition(tablestore.NewSingleColumnCondition(TokenColumn, tablestore.CT_EQUAL, l.token))
+	_, err := l.client.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: change})
+	if tablestore.IsConditionCheckFail(err) {
+		return ErrNotHeld
+	}
+	if err == nil && !end {
+		l.deadline = l.leaseDeadline(now)
+	}
+	return err
+}
+
+// Renew extends the lease held by TTL now, which is otherwise done in the
+// background. It returns ErrNotHeld, and ends the lease, if the lease was
+// lost or may have expired since the last renewal.
+func (l *Lock) Renew() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if !l.held {
+		return ErrNotHeld
+	}
+	err := ErrNotHeld
+	if time.Now().Before(l.deadline) {
+		err = l.extend(false)
+	}
+	if err == ErrNotHeld || err != nil && !time.Now().Before(l.deadline) {
+		l.release()
+		return ErrNotHeld
+	}
+	return err
+}
+
+func (l *Lock) renew(stop, done, lost chan struct{}) {
+	defer close(done)
+	l.lock.Lock()
+	timer := time.NewTimer(l.nextRenewal())
+	l.lock.Unlock()
+	defer timer.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+		}
+		l.lock.Lock()
+		if l.stop != stop {
+			l.lock.Unlock()
+			return
+		}
+		err := ErrNotHeld
+		if time.Now().Before(l.deadline) {
+			err = l.extend(false)
+		}
+		// other errors are retried until the lease may have expired, after
+		// which another owner may take the lock over
+		if err == ErrNotHeld || err != nil && !time.Now().Before(l.deadline) {
+			l.held = false
+			l.stop = nil
+			close(lost)
+			l.lock.Unlock()
+			return
+		}
+		timer.Reset(l.nextRenewal())
+		l.lock.Unlock()
+	}
+}
+
+// nextRenewal returns the time to wait before the next renewal, at the
+// deadline of the lease at the latest.
+func (l *Lock) nextRenewal() time.Duration {
+	wait := l.options.RenewInterval
+	if until := l.deadline.Sub(time.Now()); until < wait {
+		wait = until
+	}
+	return wait
+}
+
+// release stops the renewals of the lease.
+func (l *Lock) release() {
+	l.held = false
+	close(l.stop)
+	l.stop = nil
+	close(l.lost)
+}
+
+// Unlock releases the lock. The token of the lease is kept in the lock row,
+// so that the next owner gets a higher one.
+func (l *Lock) Unlock() error {
+	l.lock.Lock()
+	if !l.held {
+		l.lock.Unlock()
+		return ErrNotHeld
+	}
+	err := l.extend(true)
+	done := l.done
+	l.release()
+	l.lock.Unlock()
+	<-done
+	return err
+}
@@ -0,0 +1,224 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	client := server.NewTableStoreClient()
+	if err := CreateTable(client, "locks"); err != nil {
+		t.Fatal(err)
+	}
+
+	a := New(client, "locks", "job", Options{TTL: time.Minute, RetryInterval: 10 * time.Millisecond})
+	b := New(client, "locks", "job", Options{TTL: 200 * time.Millisecond, RenewInterval: time.Hour, RetryInterval: 10 * time.Millisecond})
+	if token, err := a.TryLock(); err != nil || token != 1 {
+		t.Fatalf("token %d, %v", token, err)
+	}
+	if _, err := b.TryLock(); err != ErrLocked {
+		t.Errorf("lock held twice: %v", err)
+	}
+	lost := a.Lost()
+	if err := a.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-lost:
+	default:
+		t.Errorf("lost not closed by Unlock")
+	}
+	if err := a.Unlock(); err != ErrNotHeld {
+		t.Errorf("unlocked twice: %v", err)
+	}
+
+	// b is not renewed, so its lease expires and a takes the lock over
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if token, err := b.Lock(ctx); err != nil || token != 2 {
+		t.Fatalf("token %d, %v", token, err)
+	}
+	if token, err := a.Lock(ctx); err != nil || token != 3 || a.Token() != 3 {
+		t.Fatalf("token %d, %v", token, err)
+	}
+	if err := b.Renew(); err != ErrNotHeld || b.Token() != 0 {
+		t.Errorf("expired lease renewed: %v", err)
+	}
+	a.Unlock()
+}
+
+func TestRenewal(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	client := server.NewTableStoreClient()
+	if err := CreateTable(client, "locks"); err != nil {
+		t.Fatal(err)
+	}
+
+	a := New(client, "locks", "job", Options{TTL: 150 * time.Millisecond, RenewInterval: 20 * time.Millisecond})
+	b := New(client, "locks", "job", Options{TTL: time.Minute})
+	if _, err := a.TryLock(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if _, err := b.TryLock(); err != ErrLocked {
+		t.Errorf("renewed lease taken over: %v", err)
+	}
+	if err := a.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := b.TryLock(); err != nil || token != 2 {
+		t.Errorf("token %d, %v", token, err)
+	}
+	b.Unlock()
+}
+
+// partitioned fails the updates of the rows while down, as in a network
+// partition.
+type partitioned struct {
+	tablestore.TableStoreApi
+	down int32
+}
+
+func (client *partitioned) UpdateRow(request *tablestore.UpdateRowRequest) (*tablestore.UpdateRowResponse, error) {
+	if atomic.LoadInt32(&client.down) != 0 {
+		return nil, errors.New("dial tcp: connection refused")
+	}
+	return client.TableStoreApi.UpdateRow(request)
+}
+
+func TestPartition(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	client := &partitioned{TableStoreApi: server.NewTableStoreClient()}
+	if err := CreateTable(client, "locks"); err != nil {
+		t.Fatal(err)
+	}
+
+	a := New(client, "locks", "job", Options{TTL: 200 * time.Millisecond, RenewInterval: 20 * time.Millisecond})
+	b := New(client.TableStoreApi, "locks", "job", Options{TTL: time.Minute, RetryInterval: 5 * time.Millisecond})
+	if _, err := a.TryLock(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	atomic.StoreInt32(&client.down, 1)
+	partition := time.Now()
+
+	// a gives the lease up before it expires, and b may take it over
+	select {
+	case <-a.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("lease kept in a partition")
+	}
+	if elapsed := time.Since(partition); elapsed >= 200*time.Millisecond {
+		t.Errorf("lease given up after %v", elapsed)
+	}
+	if a.Token() != 0 {
+		t.Errorf("token of a lost lease %d", a.Token())
+	}
+	if err := a.Renew(); err != ErrNotHeld {
+		t.Errorf("lost lease renewed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if token, err := b.Lock(ctx); err != nil || token != 2 {
+		t.Fatalf("token %d, %v", token, err)
+	}
+	b.Unlock()
+}
+
+func TestElection(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	client := server.NewTableStoreClient()
+	if err := CreateTable(client, "locks"); err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan string, 10)
+	newElection := func(owner string) *Election {
+		election := NewElection(client, "locks", "leader", Options{Owner: owner, TTL: time.Second, RetryInterval: 10 * time.Millisecond})
+		election.OnElected = func(token int64) { events <- owner + " elected" }
+		election.OnDeposed = func() { events <- owner + " deposed" }
+		return election
+	}
+	a, b := newElection("a"), newElection("b")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	observed := a.Observe(ctx, 10*time.Millisecond)
+	if leader := <-observed; leader != (Leader{}) {
+		t.Errorf("unexpected leader %v", leader)
+	}
+
+	campaigns := make(chan error, 2)
+	go func() { campaigns <- a.Campaign(context.Background()) }()
+	if event := <-events; event != "a elected" || !a.IsLeader() {
+		t.Fatalf("unexpected event %s", event)
+	}
+	if leader := <-observed; leader != (Leader{Owner: "a", Token: 1}) {
+		t.Errorf("unexpected leader %v", leader)
+	}
+	go func() { campaigns <- b.Campaign(ctx) }()
+	time.Sleep(50 * time.Millisecond)
+	if b.IsLeader() {
+		t.Fatal("two leaders")
+	}
+
+	a.Resign()
+	for _, want := range []string{"a deposed", "b elected"} {
+		if event := <-events; event != want {
+			t.Errorf("event %s, want %s", event, want)
+		}
+	}
+	if err := <-campaigns; err != nil {
+		t.Errorf("resigned campaign returned %v", err)
+	}
+	if leader, err := b.Leader(); err != nil || leader != (Leader{Owner: "b", Token: 2}) {
+		t.Errorf("unexpected leader %v, %v", leader, err)
+	}
+	cancel()
+	if err := <-campaigns; err != context.Canceled || <-events != "b deposed" {
+		t.Errorf("cancelled campaign returned %v", err)
+	}
+}
+
+// resigning resigns election once a lock row is written.
+type resigning struct {
+	tablestore.TableStoreApi
+	election *Election
+}
+
+func (client *resigning) PutRow(request *tablestore.PutRowRequest) (*tablestore.PutRowResponse, error) {
+	resp, err := client.TableStoreApi.PutRow(request)
+	client.election.Resign()
+	return resp, err
+}
+
+func TestResignDuringAcquisition(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	client := &resigning{TableStoreApi: server.NewTableStoreClient()}
+	if err := CreateTable(client, "locks"); err != nil {
+		t.Fatal(err)
+	}
+
+	election := NewElection(client, "locks", "leader", Options{Owner: "a", TTL: time.Minute})
+	client.election = election
+	election.OnElected = func(token int64) { t.Errorf("elected after resigning") }
+	if err := election.Campaign(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if election.IsLeader() {
+		t.Errorf("leader after resigning")
+	}
+	if leader, err := election.Leader(); err != nil || leader != (Leader{}) {
+		t.Errorf("lock kept by a resigned campaign: %v, %v", leader, err)
+	}
+}
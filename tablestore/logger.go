@@ -0,0 +1,115 @@
+package tablestore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+func (level LogLevel) String() string {
+	switch level {
+	case LogDebug:
+		return "DEBUG"
+	case LogInfo:
+		return "INFO"
+	case LogWarn:
+		return "WARN"
+	case LogError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(level))
+}
+
+// Field is a key value pair attached to a log entry, e.g. the action or the
+// request id of a request.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+func LogField(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Logger receives the events of the SDK: retries, throttling, slow requests
+// and failures of the timeline writer. It is easily adapted to zap, logrus or
+// slog, and must be safe for concurrent use. The SDK logs nothing without a
+// logger.
+type Logger interface {
+	Log(level LogLevel, msg string, fields ...Field)
+}
+
+// SetLogger sets the logger of the client.
+func SetLogger(logger Logger) ClientOption {
+	return func(client *TableStoreClient) {
+		client.logger = logger
+	}
+}
+
+// SetSlowRequestThreshold makes the client log a warning for API calls,
+// retries included, which take longer than threshold.
+func SetSlowRequestThreshold(threshold time.Duration) ClientOption {
+	return func(client *TableStoreClient) {
+		client.slowRequestThreshold = threshold
+	}
+}
+
+func (tableStoreClient *TableStoreClient) log(level LogLevel, msg string, fields ...Field) {
+	if tableStoreClient.logger != nil {
+		tableStoreClient.logger.Log(level, msg, fields...)
+	}
+}
+
+// logContext logs with the correlation id of ctx, if any.
+func (tableStoreClient *TableStoreClient) logContext(ctx context.Context, level LogLevel, msg string, fields ...Field) {
+	if id := CorrelationIdFrom(ctx); id != "" {
+		fields = append(fields, LogField("correlationId", id))
+	}
+	tableStoreClient.log(level, msg, fields...)
+}
+
+// StdLogger writes entries of at least MinLevel to a writer, one line each:
+//
+//	2019-01-02T15:04:05.000Z WARN request throttled action=/PutRow code=OTSServerBusy
+type StdLogger struct {
+	MinLevel LogLevel
+
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func NewStdLogger(w io.Writer, minLevel LogLevel) *StdLogger {
+	return &StdLogger{MinLevel: minLevel, w: w}
+}
+
+func (logger *StdLogger) Log(level LogLevel, msg string, fields ...Field) {
+	if level < logger.MinLevel {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(time.Now().UTC().Format("2006-01-02T15:04:05.000Z"))
+	b.WriteString(" ")
+	b.WriteString(level.String())
+	b.WriteString(" ")
+	b.WriteString(msg)
+	for _, field := range fields {
+		fmt.Fprintf(&b, " %s=%v", field.Key, field.Value)
+	}
+	b.WriteString("\n")
+
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	io.WriteString(logger.w, b.String())
+}
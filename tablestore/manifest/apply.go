@@ -0,0 +1,422 @@
+package manifest
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"sort"
+	"strings"
+)
+
+type Options struct {
+	// Destructive deletes the tables, indexes and search indexes of the
+	// instance missing from the manifest, and replaces those whose schema
+	// cannot be updated, losing their data. Otherwise they are left as they
+	// are, or fail the plan.
+	Destructive bool
+	// IncludeBaseData indexes the existing rows of the tables in the
+	// indexes created on them.
+	IncludeBaseData bool
+}
+
+type Action string
+
+const (
+	CreateTable       Action = "create table"
+	UpdateTable       Action = "update table"
+	DeleteTable       Action = "delete table"
+	CreateIndex       Action = "create index"
+	DeleteIndex       Action = "delete index"
+	CreateSearchIndex Action = "create search index"
+	DeleteSearchIndex Action = "delete search index"
+)
+
+// Change is a step of a Plan.
+type Change struct {
+	Action Action
+	Table  string
+	// Index is the name of the index of index actions.
+	Index string
+	// Detail describes the differences updated or replaced.
+	Detail string
+
+	apply func(client tablestore.TableStoreApi) error
+}
+
+func (change *Change) String() string {
+	s := string(change.Action) + " "
+	if change.Index != "" {
+		s += change.Index + " of "
+	}
+	s += change.Table
+	if change.Detail != "" {
+		s += ": " + change.Detail
+	}
+	return s
+}
+
+// Plan is the changes converging an instance to a manifest.
+type Plan struct {
+	Changes []*Change
+}
+
+// Apply makes the changes of plan in order, stopping at the first failing.
+func (plan *Plan) Apply(client tablestore.TableStoreApi) error {
+	for _, change := range plan.Changes {
+		if err := change.apply(client); err != nil {
+			return fmt.Errorf("[tablestore] %s failed: %s", change, err)
+		}
+	}
+	return nil
+}
+
+// Apply converges the instance of client to manifest, returning the changes
+// made.
+func Apply(client tablestore.TableStoreApi, manifest *Manifest, options Options) (*Plan, error) {
+	plan, err := NewPlan(client, manifest, options)
+	if err != nil {
+		return nil, err
+	}
+	return plan, plan.Apply(client)
+}
+
+// NewPlan returns the changes converging the instance of client to
+// manifest, without making them.
+func NewPlan(client tablestore.TableStoreApi, manifest *Manifest, options Options) (*Plan, error) {
+	if err := manifest.validate(); err != nil {
+		return nil, err
+	}
+	resp, err := client.ListTable()
+	if err != nil {
+		return nil, err
+	}
+	planner := &planner{client: client, options: options, plan: new(Plan)}
+	declared := make(map[string]bool)
+	for _, table := range manifest.Tables {
+		declared[table.Name] = true
+	}
+	existing := make(map[string]bool)
+	for _, name := range resp.TableNames {
+		existing[name] = true
+		if !declared[name] && options.Destructive {
+			if err := planner.deleteTable(name, "missing from the manifest"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, table := range manifest.Tables {
+		if !existing[table.Name] {
+			planner.createTable(table, "")
+		} else if err := planner.updateTable(table); err != nil {
+			return nil, err
+		}
+	}
+	return planner.plan, nil
+}
+
+type planner struct {
+	client  tablestore.TableStoreApi
+	options Options
+	plan    *Plan
+}
+
+func (planner *planner) add(change *Change) {
+	planner.plan.Changes = append(planner.plan.Changes, change)
+}
+
+func (planner *planner) createTable(table *Table, detail string) {
+	request := &tablestore.CreateTableRequest{TableMeta: table.tableMeta(), TableOption: table.tableOption(),
+		ReservedThroughput: &tablestore.ReservedThroughput{Readcap: table.ReservedRead, Writecap: table.ReservedWrite}}
+	if table.StreamExpirationHours > 0 {
+		request.StreamSpec = table.streamSpec()
+	}
+	for _, index := range table.Indexes {
+		request.IndexMetas = append(request.IndexMetas, index.indexMeta())
+	}
+	planner.add(&Change{Action: CreateTable, Table: table.Name, Detail: detail, apply: func(client tablestore.TableStoreApi) error {
+		_, err := client.CreateTable(request)
+		return err
+	}})
+	for _, index := range table.SearchIndexes {
+		planner.createSearchIndex(table.Name, index, "")
+	}
+}
+
+// deleteTable deletes the table of name after its search indexes.
+func (planner *planner) deleteTable(name string, detail string) error {
+	indexes, err := planner.client.ListSearchIndex(&tablestore.ListSearchIndexRequest{TableName: name})
+	if err != nil {
+		return err
+	}
+	for _, index := range indexes.IndexInfo {
+		planner.deleteSearchIndex(name, index.IndexName, "")
+	}
+	planner.add(&Change{Action: DeleteTable, Table: name, Detail: detail, apply: func(client tablestore.TableStoreApi) error {
+		_, err := client.DeleteTable(&tablestore.DeleteTableRequest{TableName: name})
+		return err
+	}})
+	return nil
+}
+
+func (planner *planner) replace(kind, name, detail string) error {
+	if !planner.options.Destructive {
+		return fmt.Errorf("[tablestore] %s %s must be replaced as %s, which needs Destructive", kind, name, detail)
+	}
+	return nil
+}
+
+func (planner *planner) updateTable(table *Table) error {
+	current, err := planner.client.DescribeTable(&tablestore.DescribeTableRequest{TableName: table.Name})
+	if err != nil {
+		return err
+	}
+	if detail := schemaDiff(table, current.TableMeta); detail != "" {
+		if err := planner.replace("table", table.Name, detail); err != nil {
+			return err
+		}
+		if err := planner.deleteTable(table.Name, detail); err != nil {
+			return err
+		}
+		planner.createTable(table, detail)
+		return nil
+	}
+
+	request := &tablestore.UpdateTableRequest{TableName: table.Name}
+	var details []string
+	if option := table.tableOption(); current.TableOption == nil || *option != *current.TableOption {
+		request.TableOption = option
+		if current.TableOption != nil {
+			if option.TimeToAlive != current.TableOption.TimeToAlive {
+				details = append(details, fmt.Sprintf("time to live %d -> %d", current.TableOption.TimeToAlive, option.TimeToAlive))
+			}
+			if option.MaxVersion != current.TableOption.MaxVersion {
+				details = append(details, fmt.Sprintf("max versions %d -> %d", current.TableOption.MaxVersion, option.MaxVersion))
+			}
+		}
+	}
+	throughput := &tablestore.ReservedThroughput{Readcap: table.ReservedRead, Writecap: table.ReservedWrite}
+	if current.ReservedThroughput == nil || *throughput != *current.ReservedThroughput {
+		request.ReservedThroughput = throughput
+		if current.ReservedThroughput != nil {
+			details = append(details, fmt.Sprintf("reserved throughput %d/%d -> %d/%d", current.ReservedThroughput.Readcap,
+				current.ReservedThroughput.Writecap, throughput.Readcap, throughput.Writecap))
+		}
+	}
+	var stream int32
+	if current.StreamDetails != nil && current.StreamDetails.EnableStream {
+		stream = current.StreamDetails.ExpirationTime
+	}
+	if stream != table.StreamExpirationHours && (stream > 0 || table.StreamExpirationHours > 0) {
+		request.StreamSpec = table.streamSpec()
+		details = append(details, fmt.Sprintf("stream expiration hours %d -> %d", stream, table.StreamExpirationHours))
+	}
+	if request.TableOption != nil || request.ReservedThroughput != nil || request.StreamSpec != nil {
+		planner.add(&Change{Action: UpdateTable, Table: table.Name, Detail: strings.Join(details, ", "), apply: func(client tablestore.TableStoreApi) error {
+			_, err := client.UpdateTable(request)
+			return err
+		}})
+	}
+
+	if err := planner.updateIndexes(table, current.IndexMetas); err != nil {
+		return err
+	}
+	return planner.updateSearchIndexes(table)
+}
+
+// schemaDiff describes the differences of the primary key and defined
+// columns of table with meta, which cannot be updated.
+func schemaDiff(table *Table, meta *tablestore.TableMeta) string {
+	var want, have []string
+	for _, column := range table.PrimaryKeys {
+		want = append(want, primaryKeyString(column.Name, primaryKeyTypes[column.Type], column.AutoIncrement))
+	}
+	for _, schema := range meta.SchemaEntry {
+		have = append(have, primaryKeyString(*schema.Name, *schema.Type, schema.Option != nil && *schema.Option == tablestore.AUTO_INCREMENT))
+	}
+	if !equalStrings(want, have) {
+		return fmt.Sprintf("primary key %s -> %s", strings.Join(have, ","), strings.Join(want, ","))
+	}
+
+	want, have = nil, nil
+	for _, column := range table.DefinedColumns {
+		want = append(want, fmt.Sprintf("%s:%d", column.Name, definedColumnTypes[column.Type]))
+	}
+	for _, column := range meta.DefinedColumns {
+		have = append(have, fmt.Sprintf("%s:%d", column.Name, column.ColumnType))
+	}
+	sort.Strings(want)
+	sort.Strings(have)
+	if !equalStrings(want, have) {
+		return "defined columns differ"
+	}
+	return ""
+}
+
+func primaryKeyString(name string, keyType tablestore.PrimaryKeyType, autoIncrement bool) string {
+	s := name + ":" + primaryKeyTypeName(keyType)
+	if autoIncrement {
+		s += ":auto"
+	}
+	return s
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (planner *planner) createIndex(table string, index *Index, detail string) {
+	request := &tablestore.CreateIndexRequest{MainTableName: table, IndexMeta: index.indexMeta(), IncludeBaseData: planner.options.IncludeBaseData}
+	planner.add(&Change{Action: CreateIndex, Table: table, Index: index.Name, Detail: detail, apply: func(client tablestore.TableStoreApi) error {
+		_, err := client.CreateIndex(request)
+		return err
+	}})
+}
+
+func (planner *planner) deleteIndex(table, name, detail string) {
+	planner.add(&Change{Action: DeleteIndex, Table: table, Index: name, Detail: detail, apply: func(client tablestore.TableStoreApi) error {
+		_, err := client.DeleteIndex(&tablestore.DeleteIndexRequest{MainTableName: table, IndexName: name})
+		return err
+	}})
+}
+
+func (planner *planner) updateIndexes(table *Table, current []*tablestore.IndexMeta) error {
+	existing := make(map[string]*tablestore.IndexMeta)
+	for _, meta := range current {
+		existing[meta.IndexName] = meta
+	}
+	declared := make(map[string]bool)
+	for _, index := range table.Indexes {
+		declared[index.Name] = true
+		meta, ok := existing[index.Name]
+		if !ok {
+			planner.createIndex(table.Name, index, "")
+			continue
+		}
+		want := index.indexMeta()
+		if equalStrings(want.Primarykey, meta.Primarykey) && equalStrings(want.DefinedColumns, meta.DefinedColumns) && want.IndexType == meta.IndexType {
+			continue
+		}
+		if err := planner.replace("index", index.Name+" of table "+table.Name, "its columns or type differ"); err != nil {
+			return err
+		}
+		planner.deleteIndex(table.Name, index.Name, "columns or type differ")
+		planner.createIndex(table.Name, index, "columns or type differ")
+	}
+	if planner.options.Destructive {
+		for _, meta := range current {
+			if !declared[meta.IndexName] {
+				planner.deleteIndex(table.Name, meta.IndexName, "missing from the manifest")
+			}
+		}
+	}
+	return nil
+}
+
+func (planner *planner) createSearchIndex(table string, index *SearchIndex, detail string) {
+	request := &tablestore.CreateSearchIndexRequest{TableName: table, IndexName: index.Name, IndexSchema: index.indexSchema()}
+	planner.add(&Change{Action: CreateSearchIndex, Table: table, Index: index.Name, Detail: detail, apply: func(client tablestore.TableStoreApi) error {
+		_, err := client.CreateSearchIndex(request)
+		return err
+	}})
+}
+
+func (planner *planner) deleteSearchIndex(table, name, detail string) {
+	planner.add(&Change{Action: DeleteSearchIndex, Table: table, Index: name, Detail: detail, apply: func(client tablestore.TableStoreApi) error {
+		_, err := client.DeleteSearchIndex(&tablestore.DeleteSearchIndexRequest{TableName: table, IndexName: name})
+		return err
+	}})
+}
+
+func (planner *planner) updateSearchIndexes(table *Table) error {
+	if len(table.SearchIndexes) == 0 && !planner.options.Destructive {
+		return nil
+	}
+	resp, err := planner.client.ListSearchIndex(&tablestore.ListSearchIndexRequest{TableName: table.Name})
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for _, info := range resp.IndexInfo {
+		existing[info.IndexName] = true
+	}
+	declared := make(map[string]bool)
+	for _, index := range table.SearchIndexes {
+		declared[index.Name] = true
+		if !existing[index.Name] {
+			planner.createSearchIndex(table.Name, index, "")
+			continue
+		}
+		current, err := planner.client.DescribeSearchIndex(&tablestore.DescribeSearchIndexRequest{TableName: table.Name, IndexName: index.Name})
+		if err != nil {
+			return err
+		}
+		detail := fieldsDiff(index.Fields, current.Schema.FieldSchemas)
+		if detail == "" && len(index.RoutingFields) > 0 && (current.Schema.IndexSetting == nil || !equalStrings(index.RoutingFields, current.Schema.IndexSetting.RoutingFields)) {
+			detail = "routing fields differ"
+		}
+		if detail == "" {
+			continue
+		}
+		if err := planner.replace("search index", index.Name+" of table "+table.Name, detail); err != nil {
+			return err
+		}
+		planner.deleteSearchIndex(table.Name, index.Name, detail)
+		planner.createSearchIndex(table.Name, index, detail)
+	}
+	if planner.options.Destructive {
+		for _, info := range resp.IndexInfo {
+			if !declared[info.IndexName] {
+				planner.deleteSearchIndex(table.Name, info.IndexName, "missing from the manifest")
+			}
+		}
+	}
+	return nil
+}
+
+// fieldsDiff describes the first difference of fields with schemas.
+func fieldsDiff(fields []*Field, schemas []*tablestore.FieldSchema) string {
+	existing := make(map[string]*tablestore.FieldSchema)
+	for _, schema := range schemas {
+		existing[*schema.FieldName] = schema
+	}
+	for _, field := range fields {
+		schema, ok := existing[field.Name]
+		if !ok {
+			return fmt.Sprintf("field %s added", field.Name)
+		}
+		delete(existing, field.Name)
+		if schema.FieldType != fieldTypes[field.Type] {
+			return fmt.Sprintf("type of field %s differs", field.Name)
+		}
+		for _, flag := range []struct {
+			name       string
+			want, have *bool
+		}{
+			{"index", field.Index, schema.Index},
+			{"sort and aggregation", field.SortAndAgg, schema.EnableSortAndAgg},
+			{"store", field.Store, schema.Store},
+			{"array", field.Array, schema.IsArray},
+		} {
+			if flag.want != nil && flag.have != nil && *flag.want != *flag.have {
+				return fmt.Sprintf("%s of field %s differs", flag.name, field.Name)
+			}
+		}
+		if field.Analyzer != "" && schema.Analyzer != nil && field.Analyzer != string(*schema.Analyzer) {
+			return fmt.Sprintf("analyzer of field %s differs", field.Name)
+		}
+		if detail := fieldsDiff(field.Fields, schema.FieldSchemas); detail != "" {
+			return detail
+		}
+	}
+	for name := range existing {
+		return fmt.Sprintf("field %s removed", name)
+	}
+	return ""
+}
@@ -0,0 +1,328 @@
+// Package manifest converges the tables, indexes and search indexes of an
+// instance to those declared in a JSON manifest:
+//
+//	{
+//		"tables": [{
+//			"name": "orders",
+//			"primaryKeys": [
+//				{"name": "user", "type": "string"},
+//				{"name": "id", "type": "integer", "autoIncrement": true}
+//			],
+//			"definedColumns": [{"name": "status", "type": "string"}],
+//			"timeToLive": -1,
+//			"maxVersions": 1,
+//			"streamExpirationHours": 24,
+//			"indexes": [{"name": "orders_by_status", "primaryKeys": ["status", "user", "id"]}],
+//			"searchIndexes": [{
+//				"name": "orders_search",
+//				"fields": [{"name": "status", "type": "keyword", "sortAndAgg": true}]
+//			}]
+//		}]
+//	}
+//
+// YAML manifests apply once converted to JSON.
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+type Manifest struct {
+	Tables []*Table `json:"tables"`
+}
+
+type Table struct {
+	Name           string    `json:"name"`
+	PrimaryKeys    []*Column `json:"primaryKeys"`
+	DefinedColumns []*Column `json:"definedColumns,omitempty"`
+	// TimeToLive of the data in seconds, -1 for ever which is the default.
+	TimeToLive int `json:"timeToLive,omitempty"`
+	// MaxVersions of the columns, 1 by default.
+	MaxVersions   int `json:"maxVersions,omitempty"`
+	ReservedRead  int `json:"reservedRead,omitempty"`
+	ReservedWrite int `json:"reservedWrite,omitempty"`
+	// StreamExpirationHours enables the stream of the table when positive.
+	StreamExpirationHours int32          `json:"streamExpirationHours,omitempty"`
+	Indexes               []*Index       `json:"indexes,omitempty"`
+	SearchIndexes         []*SearchIndex `json:"searchIndexes,omitempty"`
+}
+
+type Column struct {
+	Name string `json:"name"`
+	// Type is string, integer or binary for primary keys, string, integer,
+	// double, boolean or binary for defined columns.
+	Type          string `json:"type"`
+	AutoIncrement bool   `json:"autoIncrement,omitempty"`
+}
+
+type Index struct {
+	Name           string   `json:"name"`
+	PrimaryKeys    []string `json:"primaryKeys"`
+	DefinedColumns []string `json:"definedColumns,omitempty"`
+	Local          bool     `json:"local,omitempty"`
+}
+
+type SearchIndex struct {
+	Name          string   `json:"name"`
+	Fields        []*Field `json:"fields"`
+	RoutingFields []string `json:"routingFields,omitempty"`
+}
+
+// Field is a field of a search index. The flags left unset take the
+// defaults of the service and are not compared to the existing fields.
+type Field struct {
+	Name string `json:"name"`
+	// Type is long, double, boolean, keyword, text, nested or geo_point.
+	Type       string   `json:"type"`
+	Index      *bool    `json:"index,omitempty"`
+	SortAndAgg *bool    `json:"sortAndAgg,omitempty"`
+	Store      *bool    `json:"store,omitempty"`
+	Array      *bool    `json:"array,omitempty"`
+	Analyzer   string   `json:"analyzer,omitempty"`
+	Fields     []*Field `json:"fields,omitempty"`
+}
+
+// Parse reads and validates a JSON manifest.
+func Parse(r io.Reader) (*Manifest, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	manifest := new(Manifest)
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("[tablestore] invalid manifest: %s", err)
+	}
+	if err := manifest.validate(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Load reads and validates the JSON manifest of path.
+func Load(path string) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+var primaryKeyTypes = map[string]tablestore.PrimaryKeyType{
+	"string":  tablestore.PrimaryKeyType_STRING,
+	"integer": tablestore.PrimaryKeyType_INTEGER,
+	"binary":  tablestore.PrimaryKeyType_BINARY,
+}
+
+var definedColumnTypes = map[string]tablestore.DefinedColumnType{
+	"string":  tablestore.DefinedColumn_STRING,
+	"integer": tablestore.DefinedColumn_INTEGER,
+	"double":  tablestore.DefinedColumn_DOUBLE,
+	"boolean": tablestore.DefinedColumn_BOOLEAN,
+	"binary":  tablestore.DefinedColumn_BINARY,
+}
+
+var fieldTypes = map[string]tablestore.FieldType{
+	"long":      tablestore.FieldType_LONG,
+	"double":    tablestore.FieldType_DOUBLE,
+	"boolean":   tablestore.FieldType_BOOLEAN,
+	"keyword":   tablestore.FieldType_KEYWORD,
+	"text":      tablestore.FieldType_TEXT,
+	"nested":    tablestore.FieldType_NESTED,
+	"geo_point": tablestore.FieldType_GEO_POINT,
+}
+
+// Describe returns the declaration of an existing table and of its indexes,
+// leaving out its search indexes.
+func Describe(client tablestore.TableStoreApi, name string) (*Table, error) {
+	resp, err := client.DescribeTable(&tablestore.DescribeTableRequest{TableName: name})
+	if err != nil {
+		return nil, err
+	}
+	table := &Table{Name: name, TimeToLive: resp.TableOption.TimeToAlive, MaxVersions: resp.TableOption.MaxVersion}
+	if resp.ReservedThroughput != nil {
+		table.ReservedRead, table.ReservedWrite = resp.ReservedThroughput.Readcap, resp.ReservedThroughput.Writecap
+	}
+	if resp.StreamDetails != nil && resp.StreamDetails.EnableStream {
+		table.StreamExpirationHours = resp.StreamDetails.ExpirationTime
+	}
+	for _, schema := range resp.TableMeta.SchemaEntry {
+		table.PrimaryKeys = append(table.PrimaryKeys, &Column{Name: *schema.Name, Type: primaryKeyTypeName(*schema.Type),
+			AutoIncrement: schema.Option != nil && *schema.Option == tablestore.AUTO_INCREMENT})
+	}
+	for _, column := range resp.TableMeta.DefinedColumns {
+		table.DefinedColumns = append(table.DefinedColumns, &Column{Name: column.Name, Type: definedColumnTypeName(column.ColumnType)})
+	}
+	for _, meta := range resp.IndexMetas {
+		table.Indexes = append(table.Indexes, &Index{Name: meta.IndexName, PrimaryKeys: meta.Primarykey, DefinedColumns: meta.DefinedColumns,
+			Local: meta.IndexType == tablestore.IT_LOCAL_INDEX})
+	}
+	return table, nil
+}
+
+func primaryKeyTypeName(keyType tablestore.PrimaryKeyType) string {
+	for name, t := range primaryKeyTypes {
+		if t == keyType {
+			return name
+		}
+	}
+	return ""
+}
+
+func definedColumnTypeName(columnType tablestore.DefinedColumnType) string {
+	for name, t := range definedColumnTypes {
+		if t == columnType {
+			return name
+		}
+	}
+	return ""
+}
+
+func (manifest *Manifest) validate() error {
+	tables := make(map[string]bool)
+	for _, table := range manifest.Tables {
+		if table.Name == "" {
+			return fmt.Errorf("[tablestore] table name is required")
+		}
+		if tables[table.Name] {
+			return fmt.Errorf("[tablestore] table %s declared twice", table.Name)
+		}
+		tables[table.Name] = true
+		if len(table.PrimaryKeys) == 0 {
+			return fmt.Errorf("[tablestore] table %s has no primary key", table.Name)
+		}
+		columns := make(map[string]bool)
+		for _, column := range table.PrimaryKeys {
+			keyType, ok := primaryKeyTypes[column.Type]
+			if !ok {
+				return fmt.Errorf("[tablestore] invalid type %q of primary key %s of table %s", column.Type, column.Name, table.Name)
+			}
+			if column.AutoIncrement && keyType != tablestore.PrimaryKeyType_INTEGER {
+				return fmt.Errorf("[tablestore] auto increment primary key %s of table %s must be an integer", column.Name, table.Name)
+			}
+			columns[column.Name] = true
+		}
+		for _, column := range table.DefinedColumns {
+			if _, ok := definedColumnTypes[column.Type]; !ok || column.AutoIncrement {
+				return fmt.Errorf("[tablestore] invalid type %q of defined column %s of table %s", column.Type, column.Name, table.Name)
+			}
+			if columns[column.Name] {
+				return fmt.Errorf("[tablestore] column %s of table %s declared twice", column.Name, table.Name)
+			}
+			columns[column.Name] = true
+		}
+		indexes := make(map[string]bool)
+		for _, index := range table.Indexes {
+			if index.Name == "" || indexes[index.Name] {
+				return fmt.Errorf("[tablestore] index names of table %s must be unique and not empty", table.Name)
+			}
+			indexes[index.Name] = true
+			if len(index.PrimaryKeys) == 0 {
+				return fmt.Errorf("[tablestore] index %s of table %s has no primary key", index.Name, table.Name)
+			}
+			for _, column := range append(append([]string(nil), index.PrimaryKeys...), index.DefinedColumns...) {
+				if !columns[column] {
+					return fmt.Errorf("[tablestore] index %s of table %s refers to undeclared column %s", index.Name, table.Name, column)
+				}
+			}
+		}
+		for _, index := range table.SearchIndexes {
+			if index.Name == "" || indexes[index.Name] {
+				return fmt.Errorf("[tablestore] index names of table %s must be unique and not empty", table.Name)
+			}
+			indexes[index.Name] = true
+			if len(index.Fields) == 0 {
+				return fmt.Errorf("[tablestore] search index %s of table %s has no field", index.Name, table.Name)
+			}
+			if err := validateFields(index.Fields); err != nil {
+				return fmt.Errorf("[tablestore] search index %s of table %s: %s", index.Name, table.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validateFields(fields []*Field) error {
+	for _, field := range fields {
+		fieldType, ok := fieldTypes[field.Type]
+		if field.Name == "" || !ok {
+			return fmt.Errorf("invalid field %q of type %q", field.Name, field.Type)
+		}
+		if (fieldType == tablestore.FieldType_NESTED) != (len(field.Fields) > 0) {
+			return fmt.Errorf("field %s has fields if and only if it is nested", field.Name)
+		}
+		if err := validateFields(field.Fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (table *Table) tableMeta() *tablestore.TableMeta {
+	meta := &tablestore.TableMeta{TableName: table.Name}
+	for _, column := range table.PrimaryKeys {
+		if column.AutoIncrement {
+			meta.AddPrimaryKeyColumnOption(column.Name, primaryKeyTypes[column.Type], tablestore.AUTO_INCREMENT)
+		} else {
+			meta.AddPrimaryKeyColumn(column.Name, primaryKeyTypes[column.Type])
+		}
+	}
+	for _, column := range table.DefinedColumns {
+		meta.AddDefinedColumn(column.Name, definedColumnTypes[column.Type])
+	}
+	return meta
+}
+
+func (table *Table) tableOption() *tablestore.TableOption {
+	option := &tablestore.TableOption{TimeToAlive: table.TimeToLive, MaxVersion: table.MaxVersions}
+	if option.TimeToAlive == 0 {
+		option.TimeToAlive = -1
+	}
+	if option.MaxVersion == 0 {
+		option.MaxVersion = 1
+	}
+	return option
+}
+
+func (table *Table) streamSpec() *tablestore.StreamSpecification {
+	if table.StreamExpirationHours <= 0 {
+		return &tablestore.StreamSpecification{EnableStream: false}
+	}
+	return &tablestore.StreamSpecification{EnableStream: true, ExpirationTime: table.StreamExpirationHours}
+}
+
+func (index *Index) indexMeta() *tablestore.IndexMeta {
+	meta := &tablestore.IndexMeta{IndexName: index.Name, Primarykey: index.PrimaryKeys, DefinedColumns: index.DefinedColumns, IndexType: tablestore.IT_GLOBAL_INDEX}
+	if index.Local {
+		meta.IndexType = tablestore.IT_LOCAL_INDEX
+	}
+	return meta
+}
+
+func (index *SearchIndex) indexSchema() *tablestore.IndexSchema {
+	schema := &tablestore.IndexSchema{FieldSchemas: fieldSchemas(index.Fields)}
+	if len(index.RoutingFields) > 0 {
+		schema.IndexSetting = &tablestore.IndexSetting{RoutingFields: index.RoutingFields}
+	}
+	return schema
+}
+
+func fieldSchemas(fields []*Field) []*tablestore.FieldSchema {
+	var schemas []*tablestore.FieldSchema
+	for _, field := range fields {
+		name := field.Name
+		schema := &tablestore.FieldSchema{FieldName: &name, FieldType: fieldTypes[field.Type], Index: field.Index,
+			EnableSortAndAgg: field.SortAndAgg, Store: field.Store, IsArray: field.Array, FieldSchemas: fieldSchemas(field.Fields)}
+		if field.Analyzer != "" {
+			analyzer := tablestore.Analyzer(field.Analyzer)
+			schema.Analyzer = &analyzer
+		}
+		schemas = append(schemas, schema)
+	}
+	return schemas
+}
@@ -0,0 +1,212 @@
+package manifest
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"strings"
+	"testing"
+)
+
+// indexClient adds indexes and search indexes to the tables of
+// tablestoretest, not checking them.
+type indexClient struct {
+	*tablestoretest.Client
+	indexes       map[string][]*tablestore.IndexMeta
+	searchIndexes map[string]map[string]*tablestore.IndexSchema
+}
+
+func newIndexClient() *indexClient {
+	return &indexClient{Client: tablestoretest.NewClient(), indexes: make(map[string][]*tablestore.IndexMeta),
+		searchIndexes: make(map[string]map[string]*tablestore.IndexSchema)}
+}
+
+func (client *indexClient) CreateTable(request *tablestore.CreateTableRequest) (*tablestore.CreateTableResponse, error) {
+	indexes := request.IndexMetas
+	withoutIndexes := *request
+	withoutIndexes.IndexMetas = nil
+	resp, err := client.Client.CreateTable(&withoutIndexes)
+	if err == nil {
+		client.indexes[request.TableMeta.TableName] = indexes
+		client.searchIndexes[request.TableMeta.TableName] = make(map[string]*tablestore.IndexSchema)
+	}
+	return resp, err
+}
+
+func (client *indexClient) DescribeTable(request *tablestore.DescribeTableRequest) (*tablestore.DescribeTableResponse, error) {
+	resp, err := client.Client.DescribeTable(request)
+	if err == nil {
+		resp.IndexMetas = client.indexes[request.TableName]
+	}
+	return resp, err
+}
+
+func (client *indexClient) CreateIndex(request *tablestore.CreateIndexRequest) (*tablestore.CreateIndexResponse, error) {
+	client.indexes[request.MainTableName] = append(client.indexes[request.MainTableName], request.IndexMeta)
+	return &tablestore.CreateIndexResponse{}, nil
+}
+
+func (client *indexClient) DeleteIndex(request *tablestore.DeleteIndexRequest) (*tablestore.DeleteIndexResponse, error) {
+	var indexes []*tablestore.IndexMeta
+	for _, meta := range client.indexes[request.MainTableName] {
+		if meta.IndexName != request.IndexName {
+			indexes = append(indexes, meta)
+		}
+	}
+	client.indexes[request.MainTableName] = indexes
+	return &tablestore.DeleteIndexResponse{}, nil
+}
+
+func (client *indexClient) CreateSearchIndex(request *tablestore.CreateSearchIndexRequest) (*tablestore.CreateSearchIndexResponse, error) {
+	client.searchIndexes[request.TableName][request.IndexName] = request.IndexSchema
+	return &tablestore.CreateSearchIndexResponse{}, nil
+}
+
+func (client *indexClient) DeleteSearchIndex(request *tablestore.DeleteSearchIndexRequest) (*tablestore.DeleteSearchIndexResponse, error) {
+	delete(client.searchIndexes[request.TableName], request.IndexName)
+	return &tablestore.DeleteSearchIndexResponse{}, nil
+}
+
+func (client *indexClient) ListSearchIndex(request *tablestore.ListSearchIndexRequest) (*tablestore.ListSearchIndexResponse, error) {
+	resp := &tablestore.ListSearchIndexResponse{}
+	for name := range client.searchIndexes[request.TableName] {
+		resp.IndexInfo = append(resp.IndexInfo, &tablestore.IndexInfo{TableName: request.TableName, IndexName: name})
+	}
+	return resp, nil
+}
+
+func (client *indexClient) DescribeSearchIndex(request *tablestore.DescribeSearchIndexRequest) (*tablestore.DescribeSearchIndexResponse, error) {
+	return &tablestore.DescribeSearchIndexResponse{Schema: client.searchIndexes[request.TableName][request.IndexName]}, nil
+}
+
+func parse(t *testing.T, manifest string) *Manifest {
+	m, err := Parse(strings.NewReader(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func changes(plan *Plan) string {
+	var s []string
+	for _, change := range plan.Changes {
+		s = append(s, change.String())
+	}
+	return strings.Join(s, "\n")
+}
+
+func TestApply(t *testing.T) {
+	client := newIndexClient()
+	v1 := parse(t, `{"tables": [{
+		"name": "orders",
+		"primaryKeys": [{"name": "user", "type": "string"}, {"name": "id", "type": "integer", "autoIncrement": true}],
+		"definedColumns": [{"name": "status", "type": "string"}],
+		"indexes": [{"name": "orders_by_status", "primaryKeys": ["status", "user", "id"]}],
+		"searchIndexes": [{"name": "orders_search", "fields": [{"name": "status", "type": "keyword", "sortAndAgg": true}]}]
+	}, {
+		"name": "events",
+		"primaryKeys": [{"name": "id", "type": "binary"}]
+	}]}`)
+	plan, err := Apply(client, v1, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "create table orders\ncreate search index orders_search of orders\ncreate table events"
+	if got := changes(plan); got != expect {
+		t.Errorf("changes:\n%s\nexpect:\n%s", got, expect)
+	}
+	if plan, err := NewPlan(client, v1, Options{}); err != nil || len(plan.Changes) != 0 {
+		t.Errorf("plan of applied manifest: %v %v", changes(plan), err)
+	}
+
+	// updates in place
+	v2 := parse(t, `{"tables": [{
+		"name": "orders",
+		"primaryKeys": [{"name": "user", "type": "string"}, {"name": "id", "type": "integer", "autoIncrement": true}],
+		"definedColumns": [{"name": "status", "type": "string"}],
+		"timeToLive": 86400,
+		"maxVersions": 2,
+		"reservedRead": 1,
+		"indexes": [{"name": "orders_by_status", "primaryKeys": ["status", "user", "id"]}, {"name": "orders_by_id", "primaryKeys": ["user", "status"], "local": true}],
+		"searchIndexes": [{"name": "orders_search", "fields": [{"name": "status", "type": "keyword", "sortAndAgg": true}]},
+			{"name": "orders_text", "fields": [{"name": "status", "type": "text", "analyzer": "max_word"}]}]
+	}]}`)
+	plan, err = Apply(client, v2, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = "update table orders: time to live -1 -> 86400, max versions 1 -> 2, reserved throughput 0/0 -> 1/0\n" +
+		"create index orders_by_id of orders\n" +
+		"create search index orders_text of orders"
+	if got := changes(plan); got != expect {
+		t.Errorf("changes:\n%s\nexpect:\n%s", got, expect)
+	}
+	if resp, _ := client.DescribeTable(&tablestore.DescribeTableRequest{TableName: "orders"}); resp.TableOption.MaxVersion != 2 || len(resp.IndexMetas) != 2 {
+		t.Errorf("table after update: %+v", resp)
+	}
+
+	// replacements and deletions
+	v3 := parse(t, `{"tables": [{
+		"name": "orders",
+		"primaryKeys": [{"name": "user", "type": "string"}, {"name": "id", "type": "integer", "autoIncrement": true}],
+		"definedColumns": [{"name": "status", "type": "string"}],
+		"timeToLive": 86400,
+		"maxVersions": 2,
+		"reservedRead": 1,
+		"indexes": [{"name": "orders_by_status", "primaryKeys": ["status", "user"]}],
+		"searchIndexes": [{"name": "orders_search", "fields": [{"name": "status", "type": "keyword", "sortAndAgg": false}]}]
+	}, {
+		"name": "events",
+		"primaryKeys": [{"name": "id", "type": "string"}]
+	}]}`)
+	if _, err := NewPlan(client, v3, Options{}); err == nil || !strings.Contains(err.Error(), "needs Destructive") {
+		t.Errorf("expect error without Destructive: %v", err)
+	}
+	plan, err = Apply(client, v3, Options{Destructive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = "delete index orders_by_status of orders: columns or type differ\n" +
+		"create index orders_by_status of orders: columns or type differ\n" +
+		"delete index orders_by_id of orders: missing from the manifest\n" +
+		"delete search index orders_search of orders: sort and aggregation of field status differs\n" +
+		"create search index orders_search of orders: sort and aggregation of field status differs\n" +
+		"delete search index orders_text of orders: missing from the manifest\n" +
+		"delete table events: primary key id:binary -> id:string\n" +
+		"create table events: primary key id:binary -> id:string"
+	if got := changes(plan); got != expect {
+		t.Errorf("changes:\n%s\nexpect:\n%s", got, expect)
+	}
+	if plan, err := NewPlan(client, v3, Options{Destructive: true}); err != nil || len(plan.Changes) != 0 {
+		t.Errorf("plan of applied manifest: %v %v", changes(plan), err)
+	}
+
+	plan, err = Apply(client, parse(t, `{"tables": []}`), Options{Destructive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = "delete table events: missing from the manifest\n" +
+		"delete search index orders_search of orders\n" +
+		"delete table orders: missing from the manifest"
+	if got := changes(plan); got != expect {
+		t.Errorf("changes:\n%s\nexpect:\n%s", got, expect)
+	}
+}
+
+func TestInvalidManifest(t *testing.T) {
+	for _, manifest := range []string{
+		`{"tables": [{"name": "t"}]}`,
+		`{"tables": [{"primaryKeys": [{"name": "id", "type": "string"}]}]}`,
+		`{"tables": [{"name": "t", "primaryKeys": [{"name": "id", "type": "double"}]}]}`,
+		`{"tables": [{"name": "t", "primaryKeys": [{"name": "id", "type": "string", "autoIncrement": true}]}]}`,
+		`{"tables": [{"name": "t", "primaryKeys": [{"name": "id", "type": "string"}]}, {"name": "t", "primaryKeys": [{"name": "id", "type": "string"}]}]}`,
+		`{"tables": [{"name": "t", "primaryKeys": [{"name": "id", "type": "string"}], "definedColumns": [{"name": "id", "type": "string"}]}]}`,
+		`{"tables": [{"name": "t", "primaryKeys": [{"name": "id", "type": "string"}], "indexes": [{"name": "i", "primaryKeys": ["x"]}]}]}`,
+		`{"tables": [{"name": "t", "primaryKeys": [{"name": "id", "type": "string"}], "searchIndexes": [{"name": "i", "fields": [{"name": "x", "type": "date"}]}]}]}`,
+		`{"tables": [{"name": "t", "primaryKeys": [{"name": "id", "type": "string"}], "searchIndexes": [{"name": "i", "fields": [{"name": "x", "type": "nested"}]}]}]}`,
+		`{"tables": [`,
+	} {
+		if _, err := Parse(strings.NewReader(manifest)); err == nil {
+			t.Errorf("expect error for %s", manifest)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Package mask masks columns of the rows read through a
+// tablestore.TableStoreApi, so that code handling rows without needing
+// sensitive data, such as the phone numbers of users, does not see them:
+//
+//	client := mask.New(tablestore.NewClient(endpoint, instance, id, secret), mask.Rules{
+//		"users": {"phone": mask.Phone, "id_number": mask.IDNumber, "password": mask.Redact},
+//	})
+//	// code allowed to see sensitive data reads through client.Unmasked()
+//
+// GetRow, GetRange, BatchGetRow and Search mask the attribute columns of the
+// rows they return. Primary key columns are not masked. Other methods are
+// passed through.
+package mask
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"regexp"
+	"strings"
+)
+
+// Masker returns the masked value of a column, or nil to remove the column.
+type Masker func(value interface{}) interface{}
+
+// Rules are the maskers of the columns of tables, by table and column.
+type Rules map[string]map[string]Masker
+
+// Redact removes the column.
+func Redact(value interface{}) interface{} {
+	return nil
+}
+
+// Keep masks the characters of strings by '*', but the first and the last
+// ones. Other values are removed.
+func Keep(first, last int) Masker {
+	return func(value interface{}) interface{} {
+		s, ok := value.(string)
+		if !ok {
+			return nil
+		}
+		runes := []rune(s)
+		if first+last >= len(runes) {
+			// masking no character would disclose short values
+			return strings.Repeat("*", len(runes))
+		}
+		return string(runes[:first]) + strings.Repeat("*", len(runes)-first-last) + string(runes[len(runes)-last:])
+	}
+}
+
+var (
+	// Phone masks phone numbers but their prefix and 4 last digits, e.g.
+	// 138****5678.
+	Phone = Keep(3, 4)
+	// IDNumber masks identity card numbers but their 4 first and last
+	// characters.
+	IDNumber = Keep(4, 4)
+)
+
+// patterns of sensitive data in texts, of mainland China
+var (
+	PhonePattern    = regexp.MustCompile(`\b1[3-9]\d{9}\b`)
+	IDNumberPattern = regexp.MustCompile(`\b\d{17}[\dXx]\b`)
+)
+
+// Pattern masks the parts of strings matching pattern by masker, e.g.
+// Pattern(PhonePattern, Phone) masks the phone numbers found in free text.
+// Other values are removed.
+func Pattern(pattern *regexp.Regexp, masker Masker) Masker {
+	return func(value interface{}) interface{} {
+		s, ok := value.(string)
+		if !ok {
+			return nil
+		}
+		return pattern.ReplaceAllStringFunc(s, func(match string) string {
+			masked, _ := masker(match).(string)
+			return masked
+		})
+	}
+}
+
+// Client is a tablestore.TableStoreApi masking the rows read through it. It
+// is safe for concurrent use if the wrapped client is.
+type Client struct {
+	tablestore.TableStoreApi
+	rules Rules
+}
+
+var _ tablestore.TableStoreApi = (*Client)(nil)
+
+func New(client tablestore.TableStoreApi, rules Rules) *Client {
+	return &Client{TableStoreApi: client, rules: rules}
+}
+
+// Unmasked returns the wrapped client, reading unmasked rows.
+func (mask *Client) Unmasked() tablestore.TableStoreApi {
+	return mask.TableStoreApi
+}
+
+// mask masks the columns read from a row of table.
+func (mask *Client) mask(table string, columns []*tablestore.AttributeColumn) []*tablestore.AttributeColumn {
+	maskers := mask.rules[table]
+	if maskers == nil {
+		return columns
+	}
+	masked := columns[:0]
+	for _, column := range columns {
+		if masker := maskers[column.ColumnName]; masker != nil {
+			value := masker(column.Value)
+			if value == nil {
+				continue
+			}
+			column = &tablestore.AttributeColumn{ColumnName: column.ColumnName, Value: value, Timestamp: column.Timestamp}
+		}
+		masked = append(masked, column)
+	}
+	return masked
+}
+
+func (mask *Client) GetRow(request *tablestore.GetRowRequest) (*tablestore.GetRowResponse, error) {
+	response, err := mask.TableStoreApi.GetRow(request)
+	if err == nil {
+		response.Columns = mask.mask(request.SingleRowQueryCriteria.TableName, response.Columns)
+	}
+	return response, err
+}
+
+func (mask *Client) GetRange(request *tablestore.GetRangeRequest) (*tablestore.GetRangeResponse, error) {
+	response, err := mask.TableStoreApi.GetRange(request)
+	if err == nil {
+		for _, row := range response.Rows {
+			row.Columns = mask.mask(request.RangeRowQueryCriteria.TableName, row.Columns)
+		}
+	}
+	return response, err
+}
+
+func (mask *Client) BatchGetRow(request *tablestore.BatchGetRowRequest) (*tablestore.BatchGetRowResponse, error) {
+	response, err := mask.TableStoreApi.BatchGetRow(request)
+	if err == nil {
+		for table, results := range response.TableToRowsResult {
+			for i := range results {
+				results[i].Columns = mask.mask(table, results[i].Columns)
+			}
+		}
+	}
+	return response, err
+}
+
+func (mask *Client) Search(request *tablestore.SearchRequest) (*tablestore.SearchResponse, error) {
+	response, err := mask.TableStoreApi.Search(request)
+	if err == nil {
+		for _, row := range response.Rows {
+			row.Columns = mask.mask(request.TableName, row.Columns)
+		}
+	}
+	return response, err
+}
@@ -0,0 +1,72 @@
+package mask
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"testing"
+)
+
+func TestMaskers(t *testing.T) {
+	for _, c := range []struct {
+		masker Masker
+		value  interface{}
+		masked interface{}
+	}{
+		{Phone, "13812345678", "138****5678"},
+		{IDNumber, "11010519491231002X", "1101**********002X"},
+		{Keep(1, 1), "ab", "**"},
+		{Keep(1, 0), "张三丰", "张**"},
+		{Phone, int64(13812345678), nil},
+		{Redact, "secret", nil},
+		{Pattern(PhonePattern, Phone), "call 13812345678 or 13987654321", "call 138****5678 or 139****4321"},
+		{Pattern(IDNumberPattern, IDNumber), "id: 11010519491231002X.", "id: 1101**********002X."},
+	} {
+		if masked := c.masker(c.value); masked != c.masked {
+			t.Errorf("%v masked as %v, expected %v", c.value, masked, c.masked)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	raw := server.NewTableStoreClient()
+	meta := &tablestore.TableMeta{TableName: "users"}
+	meta.AddPrimaryKeyColumn("id", tablestore.PrimaryKeyType_STRING)
+	if _, err := raw.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+		t.Fatal(err)
+	}
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn("id", "u1")
+	change := &tablestore.PutRowChange{TableName: "users", PrimaryKey: pk}
+	change.AddColumn("phone", "13812345678")
+	change.AddColumn("password", "hash")
+	change.AddColumn("name", "a")
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	if _, err := raw.PutRow(&tablestore.PutRowRequest{PutRowChange: change}); err != nil {
+		t.Fatal(err)
+	}
+
+	client := New(raw, Rules{"users": {"phone": Phone, "password": Redact}})
+	criteria := &tablestore.SingleRowQueryCriteria{TableName: "users", PrimaryKey: pk, MaxVersion: 1}
+	read, err := client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Columns) != 2 || read.Columns[0].Value != "a" || read.Columns[1].Value != "138****5678" {
+		t.Errorf("unexpected masked row %v", read.Columns)
+	}
+
+	start, end := new(tablestore.PrimaryKey), new(tablestore.PrimaryKey)
+	start.AddPrimaryKeyColumnWithMinValue("id")
+	end.AddPrimaryKeyColumnWithMaxValue("id")
+	ranged, err := client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: &tablestore.RangeRowQueryCriteria{TableName: "users", StartPrimaryKey: start, EndPrimaryKey: end, MaxVersion: 1, Limit: 10}})
+	if err != nil || len(ranged.Rows) != 1 || len(ranged.Rows[0].Columns) != 2 {
+		t.Errorf("unexpected masked range %v, %v", ranged, err)
+	}
+
+	read, err = client.Unmasked().GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil || len(read.Columns) != 3 || read.Columns[2].Value != "13812345678" {
+		t.Errorf("unexpected unmasked row %v, %v", read, err)
+	}
+}
@@ -0,0 +1,72 @@
+package tablestore
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
+	"github.com/golang/protobuf/proto"
+	"strings"
+	"time"
+)
+
+// MetricsSink receives measurements of the API calls of a client, e.g. to
+// export them to Prometheus, see the tablestore/metrics package. Actions are
+// API names such as "PutRow". Implementations must be safe for concurrent use.
+type MetricsSink interface {
+	// RequestStarted and RequestFinished enclose an API call, retries
+	// included. err is the error returned to the caller.
+	RequestStarted(action string)
+	RequestFinished(action string, latency time.Duration, err error)
+	// RequestRetried is called before each retry with the error code of the
+	// failed attempt. throttled reports a failure for lack of capacity.
+	RequestRetried(action string, code string, throttled bool)
+	// CapacityConsumed reports the capacity units consumed by a successful
+	// call.
+	CapacityConsumed(action string, read, write int64)
+}
+
+// PayloadSizeSink is implemented by sinks measuring the body sizes of the API
+// calls too, e.g. to tell calls getting close to the 4MB limit of batches.
+// table is the table of the call, or the comma separated tables of batch
+// calls. response is the size of the last response, 0 without one.
+type PayloadSizeSink interface {
+	PayloadSize(action, table string, request, response int)
+}
+
+// SetMetricsSink sets the sink of the measurements of the client.
+func SetMetricsSink(sink MetricsSink) ClientOption {
+	return func(client *TableStoreClient) {
+		client.metrics = sink
+	}
+}
+
+type consumedGetter interface {
+	GetConsumed() *otsprotocol.ConsumedCapacity
+}
+
+// consumedOf returns the capacity units consumed according to a response.
+func consumedOf(resp proto.Message) (read, write int64) {
+	add := func(consumed *otsprotocol.ConsumedCapacity) {
+		read += int64(consumed.GetCapacityUnit().GetRead())
+		write += int64(consumed.GetCapacityUnit().GetWrite())
+	}
+	switch resp := resp.(type) {
+	case consumedGetter:
+		add(resp.GetConsumed())
+	case *otsprotocol.BatchGetRowResponse:
+		for _, table := range resp.Tables {
+			for _, row := range table.Rows {
+				add(row.GetConsumed())
+			}
+		}
+	case *otsprotocol.BatchWriteRowResponse:
+		for _, table := range resp.Tables {
+			for _, row := range table.Rows {
+				add(row.GetConsumed())
+			}
+		}
+	}
+	return read, write
+}
+
+func actionOf(uri string) string {
+	return strings.TrimPrefix(uri, "/")
+}
@@ -0,0 +1,303 @@
+// Package metrics collects the measurements of tablestore clients and serves
+// them in the Prometheus text format, without depending on the Prometheus
+// client library:
+//
+//	collector := metrics.NewCollector()
+//	client := tablestore.NewClient(endpoint, instance, id, secret, tablestore.SetMetricsSink(collector))
+//	http.Handle("/metrics", collector)
+//
+// The collected metrics are, labeled by action:
+//
+//	tablestore_requests_total{action,result}         API calls by result, "ok" or "error"
+//	tablestore_request_duration_seconds{action}      histogram of latencies, retries included
+//	tablestore_requests_in_flight{action}            API calls running
+//	tablestore_retries_total{action,code}            retries by error code of the failed attempt
+//	tablestore_throttled_total{action}               attempts failed for lack of capacity
+//	tablestore_capacity_units_total{action,type}     consumed capacity units, "read" or "write"
+//	tablestore_request_size_bytes{action,table}      histogram of request body sizes
+//	tablestore_response_size_bytes{action,table}     histogram of response body sizes
+//
+// A Collector may be shared by several clients.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds in seconds of the latency histogram.
+var DefaultBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// SizeBuckets are the upper bounds in bytes of the body size histograms, up
+// to the 4MB limit of batches.
+var SizeBuckets = []float64{256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 2 << 20, 4 << 20}
+
+// Operation holds the metrics of an action.
+type Operation struct {
+	Succeeded int64
+	Failed    int64
+	InFlight  int64
+	// retries by error code
+	Retries   map[string]int64
+	Throttled int64
+	ReadCU    int64
+	WriteCU   int64
+
+	// BucketCounts[i] counts latencies up to Buckets[i], the last one counts
+	// all latencies
+	BucketCounts []int64
+	LatencySum   time.Duration
+
+	// body sizes by table
+	Payloads map[string]*Payload
+}
+
+// Payload holds the body sizes of the calls of an action on a table.
+type Payload struct {
+	Requests int64
+	// bytes sent and received
+	RequestBytes  int64
+	ResponseBytes int64
+	// RequestBucketCounts[i] counts requests up to SizeBuckets[i], the last
+	// one counts all requests; likewise for responses
+	RequestBucketCounts  []int64
+	ResponseBucketCounts []int64
+	MaxRequest           int64
+	MaxResponse          int64
+}
+
+type Collector struct {
+	buckets []float64
+
+	lock       sync.Mutex
+	operations map[string]*Operation
+}
+
+var _ tablestore.MetricsSink = (*Collector)(nil)
+var _ tablestore.PayloadSizeSink = (*Collector)(nil)
+
+// NewCollector returns a collector with DefaultBuckets, or with the given
+// bucket upper bounds in seconds.
+func NewCollector(buckets ...float64) *Collector {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Collector{buckets: buckets, operations: make(map[string]*Operation)}
+}
+
+func (collector *Collector) operation(action string) *Operation {
+	op, ok := collector.operations[action]
+	if !ok {
+		op = &Operation{Retries: make(map[string]int64), BucketCounts: make([]int64, len(collector.buckets)+1),
+			Payloads: make(map[string]*Payload)}
+		collector.operations[action] = op
+	}
+	return op
+}
+
+func (collector *Collector) RequestStarted(action string) {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+	collector.operation(action).InFlight++
+}
+
+func (collector *Collector) RequestFinished(action string, latency time.Duration, err error) {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+	op := collector.operation(action)
+	op.InFlight--
+	if err == nil {
+		op.Succeeded++
+	} else {
+		op.Failed++
+	}
+	seconds := latency.Seconds()
+	for i, bound := range collector.buckets {
+		if seconds <= bound {
+			op.BucketCounts[i]++
+		}
+	}
+	op.BucketCounts[len(collector.buckets)]++
+	op.LatencySum += latency
+}
+
+func (collector *Collector) RequestRetried(action string, code string, throttled bool) {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+	op := collector.operation(action)
+	op.Retries[code]++
+	if throttled {
+		op.Throttled++
+	}
+}
+
+func (collector *Collector) CapacityConsumed(action string, read, write int64) {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+	op := collector.operation(action)
+	op.ReadCU += read
+	op.WriteCU += write
+}
+
+func (collector *Collector) PayloadSize(action, table string, request, response int) {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+	op := collector.operation(action)
+	payload, ok := op.Payloads[table]
+	if !ok {
+		payload = &Payload{RequestBucketCounts: make([]int64, len(SizeBuckets)+1), ResponseBucketCounts: make([]int64, len(SizeBuckets)+1)}
+		op.Payloads[table] = payload
+	}
+	payload.Requests++
+	payload.RequestBytes += int64(request)
+	payload.ResponseBytes += int64(response)
+	countSize(payload.RequestBucketCounts, request)
+	countSize(payload.ResponseBucketCounts, response)
+	if int64(request) > payload.MaxRequest {
+		payload.MaxRequest = int64(request)
+	}
+	if int64(response) > payload.MaxResponse {
+		payload.MaxResponse = int64(response)
+	}
+}
+
+func countSize(counts []int64, size int) {
+	for i, bound := range SizeBuckets {
+		if float64(size) <= bound {
+			counts[i]++
+		}
+	}
+	counts[len(SizeBuckets)]++
+}
+
+// Snapshot returns a copy of the metrics per action.
+func (collector *Collector) Snapshot() map[string]Operation {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+	snapshot := make(map[string]Operation, len(collector.operations))
+	for action, op := range collector.operations {
+		copied := *op
+		copied.Retries = make(map[string]int64, len(op.Retries))
+		for code, n := range op.Retries {
+			copied.Retries[code] = n
+		}
+		copied.BucketCounts = append([]int64(nil), op.BucketCounts...)
+		snapshot[action] = copied
+	}
+	return snapshot
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (collector *Collector) WriteTo(w io.Writer) (int64, error) {
+	snapshot := collector.Snapshot()
+	actions := make([]string, 0, len(snapshot))
+	for action := range snapshot {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+
+	var b bytes.Buffer
+	header := func(name, kind, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	header("tablestore_requests_total", "counter", "API calls of tablestore clients by result.")
+	for _, action := range actions {
+		op := snapshot[action]
+		fmt.Fprintf(&b, "tablestore_requests_total{action=%q,result=\"ok\"} %d\n", action, op.Succeeded)
+		fmt.Fprintf(&b, "tablestore_requests_total{action=%q,result=\"error\"} %d\n", action, op.Failed)
+	}
+
+	header("tablestore_request_duration_seconds", "histogram", "Latency of API calls, retries included.")
+	for _, action := range actions {
+		op := snapshot[action]
+		for i, bound := range collector.buckets {
+			fmt.Fprintf(&b, "tablestore_request_duration_seconds_bucket{action=%q,le=%q} %d\n", action, formatFloat(bound), op.BucketCounts[i])
+		}
+		count := op.BucketCounts[len(collector.buckets)]
+		fmt.Fprintf(&b, "tablestore_request_duration_seconds_bucket{action=%q,le=\"+Inf\"} %d\n", action, count)
+		fmt.Fprintf(&b, "tablestore_request_duration_seconds_sum{action=%q} %s\n", action, formatFloat(op.LatencySum.Seconds()))
+		fmt.Fprintf(&b, "tablestore_request_duration_seconds_count{action=%q} %d\n", action, count)
+	}
+
+	header("tablestore_requests_in_flight", "gauge", "API calls running.")
+	for _, action := range actions {
+		fmt.Fprintf(&b, "tablestore_requests_in_flight{action=%q} %d\n", action, snapshot[action].InFlight)
+	}
+
+	header("tablestore_retries_total", "counter", "Retries by error code of the failed attempt.")
+	for _, action := range actions {
+		op := snapshot[action]
+		codes := make([]string, 0, len(op.Retries))
+		for code := range op.Retries {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			fmt.Fprintf(&b, "tablestore_retries_total{action=%q,code=%q} %d\n", action, code, op.Retries[code])
+		}
+	}
+
+	header("tablestore_throttled_total", "counter", "Attempts failed for lack of capacity.")
+	for _, action := range actions {
+		fmt.Fprintf(&b, "tablestore_throttled_total{action=%q} %d\n", action, snapshot[action].Throttled)
+	}
+
+	header("tablestore_capacity_units_total", "counter", "Consumed capacity units.")
+	for _, action := range actions {
+		op := snapshot[action]
+		fmt.Fprintf(&b, "tablestore_capacity_units_total{action=%q,type=\"read\"} %d\n", action, op.ReadCU)
+		fmt.Fprintf(&b, "tablestore_capacity_units_total{action=%q,type=\"write\"} %d\n", action, op.WriteCU)
+	}
+
+	sizes := func(name, help string, counts func(*Payload) []int64, sum func(*Payload) int64) {
+		header(name, "histogram", help)
+		for _, action := range actions {
+			op := snapshot[action]
+			tables := make([]string, 0, len(op.Payloads))
+			for table := range op.Payloads {
+				tables = append(tables, table)
+			}
+			sort.Strings(tables)
+			for _, table := range tables {
+				payload := op.Payloads[table]
+				for i, bound := range SizeBuckets {
+					fmt.Fprintf(&b, "%s_bucket{action=%q,table=%q,le=%q} %d\n", name, action, table, formatFloat(bound), counts(payload)[i])
+				}
+				fmt.Fprintf(&b, "%s_bucket{action=%q,table=%q,le=\"+Inf\"} %d\n", name, action, table, payload.Requests)
+				fmt.Fprintf(&b, "%s_sum{action=%q,table=%q} %d\n", name, action, table, sum(payload))
+				fmt.Fprintf(&b, "%s_count{action=%q,table=%q} %d\n", name, action, table, payload.Requests)
+			}
+		}
+	}
+	sizes("tablestore_request_size_bytes", "Size of request bodies.",
+		func(p *Payload) []int64 { return p.RequestBucketCounts }, func(p *Payload) int64 { return p.RequestBytes })
+	sizes("tablestore_response_size_bytes", "Size of response bodies.",
+		func(p *Payload) []int64 { return p.ResponseBucketCounts }, func(p *Payload) int64 { return p.ResponseBytes })
+
+	return b.WriteTo(w)
+}
+
+// ServeHTTP serves the metrics to Prometheus.
+func (collector *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	collector.WriteTo(w)
+}
+
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if strings.ContainsAny(s, "e") {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return s
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCollector(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	collector := NewCollector()
+	client := server.NewTableStoreClient(tablestore.SetMetricsSink(collector))
+
+	meta := new(tablestore.TableMeta)
+	meta.TableName = "t"
+	meta.AddPrimaryKeyColumn("pk", tablestore.PrimaryKeyType_STRING)
+	if _, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: &tablestore.TableOption{TimeToAlive: -1, MaxVersion: 1}, ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	server.FailNext("PutRow", 1, tablestore.NOT_ENOUGH_CAPACITY_UNIT, "throttled")
+	change := &tablestore.PutRowChange{TableName: "t", PrimaryKey: new(tablestore.PrimaryKey)}
+	change.PrimaryKey.AddPrimaryKeyColumn("pk", "a")
+	change.AddColumn("col", int64(1))
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: change}); err != nil {
+		t.Fatal(err)
+	}
+	change.SetCondition(tablestore.RowExistenceExpectation_EXPECT_NOT_EXIST)
+	if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: change}); err == nil {
+		t.Fatal("expect condition check failure")
+	}
+
+	snapshot := collector.Snapshot()
+	putRow := snapshot["PutRow"]
+	if putRow.Succeeded != 1 || putRow.Failed != 1 || putRow.InFlight != 0 || putRow.Throttled != 1 ||
+		putRow.Retries[tablestore.NOT_ENOUGH_CAPACITY_UNIT] != 1 || putRow.WriteCU != 1 {
+		t.Errorf("unexpected PutRow metrics %+v", putRow)
+	}
+	if n := putRow.BucketCounts[len(putRow.BucketCounts)-1]; n != 2 {
+		t.Errorf("%d latencies recorded", n)
+	}
+	if payload := putRow.Payloads["t"]; payload == nil || payload.Requests != 2 || payload.RequestBytes == 0 ||
+		payload.MaxRequest*2 != payload.RequestBytes || payload.RequestBucketCounts[0] != 2 {
+		t.Errorf("unexpected PutRow payloads %+v", payload)
+	}
+	if createTable := snapshot["CreateTable"]; createTable.Succeeded != 1 {
+		t.Errorf("unexpected CreateTable metrics %+v", createTable)
+	}
+
+	recorder := httptest.NewRecorder()
+	collector.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	text := recorder.Body.String()
+	for _, line := range []string{
+		`tablestore_requests_total{action="PutRow",result="error"} 1`,
+		`tablestore_request_duration_seconds_count{action="PutRow"} 2`,
+		`tablestore_request_duration_seconds_bucket{action="PutRow",le="+Inf"} 2`,
+		`tablestore_retries_total{action="PutRow",code="OTSNotEnoughCapacityUnit"} 1`,
+		`tablestore_throttled_total{action="PutRow"} 1`,
+		`tablestore_capacity_units_total{action="PutRow",type="write"} 1`,
+		`# TYPE tablestore_request_duration_seconds histogram`,
+		`tablestore_request_size_bytes_count{action="PutRow",table="t"} 2`,
+		`tablestore_response_size_bytes_bucket{action="PutRow",table="t",le="+Inf"} 2`,
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("missing %s in\n%s", line, text)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+// Package mirror mirrors the writes of a tablestore.TableStoreApi to a
+// secondary client, e.g. of another instance or of tables of a new schema,
+// for the gradual migrations between them:
+//
+//	client := mirror.New(primary, mirror.Config{
+//		Secondary: secondary,
+//		Tables:    map[string]string{"orders": "orders_v2"},
+//		Logger:    tablestore.NewStdLogger(os.Stderr, tablestore.LogWarn),
+//	})
+//	defer client.Close()
+//
+// The writes of PutRow, UpdateRow, DeleteRow and BatchWriteRow which succeed
+// on the primary are queued, and written to the secondary in order, without
+// their conditions, by a goroutine of the client; writes failing on the
+// secondary, or dropped when the queue is full, are logged and counted, the
+// rows being repaired by a later copy. Reads are served by the primary, and
+// GetRow, BatchGetRow and GetRange may be shadowed on the secondary to compare
+// their rows before cutting over, mismatches being counted and sampled in
+// the Report of the client. Other methods are passed through.
+package mirror
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"sync"
+	"sync/atomic"
+)
+
+type Config struct {
+	Secondary tablestore.TableStoreApi
+	// tables of the secondary by mirrored table of the primary, all the
+	// tables to the tables of the same name if nil
+	Tables map[string]string
+	// Transform maps the changes of the primary, whose table is the one of the
+	// secondary, to the schema of the secondary, or to nil to skip them;
+	// changes are mirrored as they are if nil.
+	Transform func(change tablestore.RowChange) (tablestore.RowChange, error)
+	// size of the queue of the writes to mirror, 1024 by default
+	QueueSize int
+	// ShadowReads makes GetRow, BatchGetRow and GetRange read the rows on
+	// the secondary too, once the writes queued before are mirrored, and
+	// compare them. Reads with filters are not shadowed if Transform is set.
+	ShadowReads bool
+	// fraction of the reads shadowed, all of them if 0
+	ShadowRate float64
+	// number of mismatches sampled in reports, 100 by default
+	Samples int
+	// OnMismatch is called with every mismatch, if not nil.
+	OnMismatch func(Mismatch)
+	Logger     tablestore.Logger
+}
+
+// Stats counts the writes to mirror.
+type Stats struct {
+	Mirrored int64
+	Failed   int64
+	Dropped  int64
+	Skipped  int64
+}
+
+// Client is a tablestore.TableStoreApi mirroring its writes. It is safe for
+// concurrent use if the wrapped clients are.
+type Client struct {
+	tablestore.TableStoreApi
+	config Config
+	queue  chan func()
+	done   chan struct{}
+
+	lock   sync.RWMutex
+	closed bool
+
+	mirrored, failed, dropped, skipped int64
+
+	reportLock sync.Mutex
+	report     Report
+}
+
+var _ tablestore.TableStoreApi = (*Client)(nil)
+
+// New returns a client writing to primary, and mirroring its writes until
+// Close.
+func New(primary tablestore.TableStoreApi, config Config) *Client {
+	if config.QueueSize <= 0 {
+		config.QueueSize = 1024
+	}
+	if config.Samples <= 0 {
+		config.Samples = 100
+	}
+	mirror := &Client{TableStoreApi: primary, config: config, queue: make(chan func(), config.QueueSize), done: make(chan struct{})}
+	mirror.report.Tables = make(map[string]int64)
+	go mirror.run()
+	return mirror
+}
+
+func (mirror *Client) run() {
+	defer close(mirror.done)
+	for task := range mirror.queue {
+		task()
+	}
+}
+
+// Close waits for the writes queued to be mirrored and stops mirroring; the
+// writes of the client are not mirrored anymore.
+func (mirror *Client) Close() {
+	mirror.lock.Lock()
+	if !mirror.closed {
+		mirror.closed = true
+		close(mirror.queue)
+	}
+	mirror.lock.Unlock()
+	<-mirror.done
+}
+
+func (mirror *Client) Stats() Stats {
+	return Stats{
+		Mirrored: atomic.LoadInt64(&mirror.mirrored),
+		Failed:   atomic.LoadInt64(&mirror.failed),
+		Dropped:  atomic.LoadInt64(&mirror.dropped),
+		Skipped:  atomic.LoadInt64(&mirror.skipped),
+	}
+}
+
+func (mirror *Client) log(level tablestore.LogLevel, msg string, fields ...tablestore.Field) {
+	if mirror.config.Logger != nil {
+		mirror.config.Logger.Log(level, msg, fields...)
+	}
+}
+
+// enqueue queues a task, and reports whether it was.
+func (mirror *Client) enqueue(task func()) bool {
+	mirror.lock.RLock()
+	defer mirror.lock.RUnlock()
+	if mirror.closed {
+		return false
+	}
+	select {
+	case mirror.queue <- task:
+		return true
+	default:
+		return false
+	}
+}
+
+// secondaryTable returns the table of the secondary mirroring table.
+func (mirror *Client) secondaryTable(table string) (string, bool) {
+	if mirror.config.Tables == nil {
+		return table, true
+	}
+	secondary, ok := mirror.config.Tables[table]
+	return secondary, ok
+}
+
+// secondaryChange returns the change of the secondary mirroring change,
+// without condition, or nil.
+func (mirror *Client) secondaryChange(change tablestore.RowChange) (tablestore.RowChange, error) {
+	table, ok := mirror.secondaryTable(change.GetTableName())
+	if !ok {
+		return nil, nil
+	}
+	switch change := tablestore.CloneRowChange(change).(type) {
+	case *tablestore.PutRowChange:
+		change.TableName, change.Condition, change.ReturnType = table, nil, tablestore.ReturnType_RT_NONE
+		change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		return mirror.transform(change)
+	case *tablestore.UpdateRowChange:
+		change.TableName, change.Condition = table, nil
+		change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		return mirror.transform(change)
+	case *tablestore.DeleteRowChange:
+		change.TableName, change.Condition = table, nil
+		change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		return mirror.transform(change)
+	default:
+		return nil, fmt.Errorf("[tablestore] unsupported row change %T", change)
+	}
+}
+
+func (mirror *Client) transform(change tablestore.RowChange) (tablestore.RowChange, error) {
+	if mirror.config.Transform == nil {
+		return change, nil
+	}
+	return mirror.config.Transform(change)
+}
+
+// mirrorChanges queues the changes written on the primary.
+func (mirror *Client) mirrorChanges(changes ...tablestore.RowChange) {
+	var secondary []tablestore.RowChange
+	for _, change := range changes {
+		mirrored, err := mirror.secondaryChange(change)
+		if err != nil {
+			atomic.AddInt64(&mirror.failed, 1)
+			mirror.log(tablestore.LogError, "mirror: invalid change", tablestore.LogField("table", change.GetTableName()), tablestore.LogField("error", err))
+			continue
+		}
+		if mirrored == nil {
+			atomic.AddInt64(&mirror.skipped, 1)
+			continue
+		}
+		secondary = append(secondary, mirrored)
+	}
+	if len(secondary) == 0 {
+		return
+	}
+	if !mirror.enqueue(func() { mirror.write(secondary) }) {
+		atomic.AddInt64(&mirror.dropped, int64(len(secondary)))
+		mirror.log(tablestore.LogError, "mirror: writes dropped", tablestore.LogField("rows", len(secondary)))
+	}
+}
+
+func (mirror *Client) write(changes []tablestore.RowChange) {
+	for _, change := range changes {
+		var err error
+		switch change := change.(type) {
+		case *tablestore.PutRowChange:
+			_, err = mirror.config.Secondary.PutRow(&tablestore.PutRowRequest{PutRowChange: change})
+		case *tablestore.UpdateRowChange:
+			_, err = mirror.config.Secondary.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: change})
+		case *tablestore.DeleteRowChange:
+			_, err = mirror.config.Secondary.DeleteRow(&tablestore.DeleteRowRequest{DeleteRowChange: change})
+		default:
+			err = fmt.Errorf("[tablestore] unsupported row change %T", change)
+		}
+		if err != nil {
+			atomic.AddInt64(&mirror.failed, 1)
+			mirror.log(tablestore.LogError, "mirror: write failed", tablestore.LogField("table", change.GetTableName()), tablestore.LogField("error", err))
+		} else {
+			atomic.AddInt64(&mirror.mirrored, 1)
+		}
+	}
+}
+
+func (mirror *Client) PutRow(request *tablestore.PutRowRequest) (*tablestore.PutRowResponse, error) {
+	response, err := mirror.TableStoreApi.PutRow(request)
+	if err == nil {
+		mirror.mirrorChanges(request.PutRowChange)
+	}
+	return response, err
+}
+
+func (mirror *Client) UpdateRow(request *tablestore.UpdateRowRequest) (*tablestore.UpdateRowResponse, error) {
+	response, err := mirror.TableStoreApi.UpdateRow(request)
+	if err == nil {
+		mirror.mirrorChanges(request.UpdateRowChange)
+	}
+	return response, err
+}
+
+func (mirror *Client) DeleteRow(request *tablestore.DeleteRowRequest) (*tablestore.DeleteRowResponse, error) {
+	response, err := mirror.TableStoreApi.DeleteRow(request)
+	if err == nil {
+		mirror.mirrorChanges(request.DeleteRowChange)
+	}
+	return response, err
+}
+
+// BatchWriteRow mirrors the rows succeeding on the primary.
+func (mirror *Client) BatchWriteRow(request *tablestore.BatchWriteRowRequest) (*tablestore.BatchWriteRowResponse, error) {
+	response, err := mirror.TableStoreApi.BatchWriteRow(request)
+	if err != nil {
+		return response, err
+	}
+	var changes []tablestore.RowChange
+	for table, results := range response.TableToRowsResult {
+		tableChanges := request.RowChangesGroupByTable[table]
+		for _, result := range results {
+			if result.IsSucceed && int(result.Index) < len(tableChanges) {
+				changes = append(changes, tableChanges[result.Index])
+			}
+		}
+	}
+	mirror.mirrorChanges(changes...)
+	return response, nil
+}
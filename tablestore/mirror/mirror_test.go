@@ -0,0 +1,201 @@
+package mirror
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"reflect"
+	"testing"
+)
+
+func createTable(t *testing.T, client tablestore.TableStoreApi, name string) {
+	meta := &tablestore.TableMeta{TableName: name}
+	meta.AddPrimaryKeyColumn("id", tablestore.PrimaryKeyType_INTEGER)
+	if _, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func primaryKey(id int64) *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn("id", id)
+	return pk
+}
+
+func get(t *testing.T, client tablestore.TableStoreApi, table string, id int64) map[string]interface{} {
+	criteria := &tablestore.SingleRowQueryCriteria{TableName: table, PrimaryKey: primaryKey(id), MaxVersion: 1}
+	resp, err := client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := make(map[string]interface{})
+	for _, column := range resp.Columns {
+		columns[column.ColumnName] = column.Value
+	}
+	return columns
+}
+
+func TestMirror(t *testing.T) {
+	primary := tablestoretest.NewServer("primary", "id", "secret")
+	defer primary.Close()
+	secondary := tablestoretest.NewServer("secondary", "id", "secret")
+	defer secondary.Close()
+	createTable(t, primary.NewTableStoreClient(), "orders")
+	createTable(t, primary.NewTableStoreClient(), "logs")
+	createTable(t, secondary.NewTableStoreClient(), "orders_v2")
+
+	var mismatches []Mismatch
+	client := New(primary.NewTableStoreClient(), Config{
+		Secondary: secondary.NewTableStoreClient(),
+		Tables:    map[string]string{"orders": "orders_v2"},
+		// renames the column "amount" to "total"
+		Transform: func(change tablestore.RowChange) (tablestore.RowChange, error) {
+			if put, ok := change.(*tablestore.PutRowChange); ok {
+				for i := range put.Columns {
+					if put.Columns[i].ColumnName == "amount" {
+						put.Columns[i].ColumnName = "total"
+					}
+				}
+			}
+			return change, nil
+		},
+		ShadowReads: true,
+		OnMismatch: func(mismatch Mismatch) {
+			mismatches = append(mismatches, mismatch)
+		},
+	})
+
+	put := &tablestore.PutRowChange{TableName: "orders", PrimaryKey: primaryKey(1)}
+	put.AddColumn("amount", int64(10))
+	put.SetCondition(tablestore.RowExistenceExpectation_EXPECT_NOT_EXIST)
+	if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: put}); err != nil {
+		t.Fatal(err)
+	}
+	batch := &tablestore.BatchWriteRowRequest{}
+	for _, id := range []int64{2, 3} {
+		put := &tablestore.PutRowChange{TableName: "orders", PrimaryKey: primaryKey(id)}
+		put.AddColumn("amount", id*10)
+		put.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		batch.AddRowChange(put)
+	}
+	// fails on the primary, so is not mirrored
+	failed := &tablestore.PutRowChange{TableName: "orders", PrimaryKey: primaryKey(1)}
+	failed.AddColumn("amount", int64(0))
+	failed.SetCondition(tablestore.RowExistenceExpectation_EXPECT_NOT_EXIST)
+	batch.AddRowChange(failed)
+	log := &tablestore.PutRowChange{TableName: "logs", PrimaryKey: primaryKey(1)}
+	log.AddColumn("message", "not mirrored")
+	log.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	batch.AddRowChange(log)
+	if _, err := client.BatchWriteRow(batch); err != nil {
+		t.Fatal(err)
+	}
+	remove := &tablestore.DeleteRowChange{TableName: "orders", PrimaryKey: primaryKey(3)}
+	remove.SetCondition(tablestore.RowExistenceExpectation_EXPECT_EXIST)
+	if _, err := client.DeleteRow(&tablestore.DeleteRowRequest{DeleteRowChange: remove}); err != nil {
+		t.Fatal(err)
+	}
+
+	// row 2 diverges on the secondary
+	update := &tablestore.UpdateRowChange{TableName: "orders_v2", PrimaryKey: primaryKey(2)}
+	update.PutColumn("total", int64(21))
+	update.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	client.enqueue(func() {
+		secondary.NewTableStoreClient().UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: update})
+	})
+	for _, id := range []int64{1, 2, 3} {
+		get(t, client, "orders", id)
+	}
+	client.Close()
+
+	if stats := client.Stats(); stats != (Stats{Mirrored: 4, Skipped: 1}) {
+		t.Errorf("stats %+v", stats)
+	}
+	secondaryClient := secondary.NewTableStoreClient()
+	for id, want := range map[int64]map[string]interface{}{1: {"total": int64(10)}, 2: {"total": int64(21)}, 3: {}} {
+		if got := get(t, secondaryClient, "orders_v2", id); !reflect.DeepEqual(got, want) {
+			t.Errorf("row %d: %v, expect %v", id, got, want)
+		}
+	}
+	if len(mismatches) != 1 || mismatches[0].Table != "orders" || mismatches[0].PrimaryKey.PrimaryKeys[0].Value != int64(2) {
+		t.Errorf("mismatches %+v", mismatches)
+	}
+
+	// not mirrored once closed
+	if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: put}); err == nil {
+		t.Errorf("expect condition failure")
+	}
+	put.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: put}); err != nil {
+		t.Fatal(err)
+	}
+	if stats := client.Stats(); stats.Dropped != 1 {
+		t.Errorf("stats %+v", stats)
+	}
+}
+
+func TestShadowReads(t *testing.T) {
+	primary := tablestoretest.NewServer("primary", "id", "secret")
+	defer primary.Close()
+	secondary := tablestoretest.NewServer("secondary", "id", "secret")
+	defer secondary.Close()
+	createTable(t, primary.NewTableStoreClient(), "orders")
+	createTable(t, secondary.NewTableStoreClient(), "orders")
+	client := New(primary.NewTableStoreClient(), Config{Secondary: secondary.NewTableStoreClient(), ShadowReads: true, Samples: 2})
+	secondaryClient := secondary.NewTableStoreClient()
+
+	for id := int64(1); id <= 5; id++ {
+		put := &tablestore.PutRowChange{TableName: "orders", PrimaryKey: primaryKey(id)}
+		put.AddColumn("amount", id*10)
+		put.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: put}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client.enqueue(func() {
+		// row 2 differs, row 4 is missing and row 6 is extra on the secondary
+		update := &tablestore.UpdateRowChange{TableName: "orders", PrimaryKey: primaryKey(2)}
+		update.PutColumn("amount", int64(21))
+		update.PutColumn("status", "paid")
+		update.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		secondaryClient.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: update})
+		remove := &tablestore.DeleteRowChange{TableName: "orders", PrimaryKey: primaryKey(4)}
+		remove.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		secondaryClient.DeleteRow(&tablestore.DeleteRowRequest{DeleteRowChange: remove})
+		put := &tablestore.PutRowChange{TableName: "orders", PrimaryKey: primaryKey(6)}
+		put.AddColumn("amount", int64(60))
+		put.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		secondaryClient.PutRow(&tablestore.PutRowRequest{PutRowChange: put})
+	})
+
+	criteria := &tablestore.RangeRowQueryCriteria{TableName: "orders", StartPrimaryKey: new(tablestore.PrimaryKey), EndPrimaryKey: new(tablestore.PrimaryKey), Direction: tablestore.FORWARD, MaxVersion: 1}
+	criteria.StartPrimaryKey.AddPrimaryKeyColumnWithMinValue("id")
+	criteria.EndPrimaryKey.AddPrimaryKeyColumnWithMaxValue("id")
+	if resp, err := client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: criteria}); err != nil || len(resp.Rows) != 5 {
+		t.Fatalf("rows %v, %v", resp, err)
+	}
+	batch := &tablestore.BatchGetRowRequest{}
+	batch.MultiRowQueryCriteria = append(batch.MultiRowQueryCriteria, &tablestore.MultiRowQueryCriteria{TableName: "orders", PrimaryKey: []*tablestore.PrimaryKey{primaryKey(1), primaryKey(2)}, MaxVersion: 1})
+	if _, err := client.BatchGetRow(batch); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+
+	report := client.Report()
+	if report.Compared != 8 || report.Mismatched != 4 || report.Errors != 0 || report.Tables["orders"] != 4 || len(report.Samples) != 2 {
+		t.Errorf("report %+v", report)
+	}
+	for _, sample := range report.Samples {
+		switch id := sample.PrimaryKey.PrimaryKeys[0].Value; id {
+		case int64(2):
+			if !reflect.DeepEqual(sample.Columns, []string{"amount", "status"}) {
+				t.Errorf("columns of row 2 %v", sample.Columns)
+			}
+		case int64(4), int64(6):
+			if !reflect.DeepEqual(sample.Columns, []string{"amount"}) {
+				t.Errorf("columns of row %d %v", id, sample.Columns)
+			}
+		default:
+			t.Errorf("sample of row %d", id)
+		}
+	}
+}
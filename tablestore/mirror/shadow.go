@@ -0,0 +1,291 @@
+package mirror
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"math/rand"
+	"strings"
+)
+
+// Mismatch is a row read by a shadowed read which differs on the secondary.
+type Mismatch struct {
+	// table and primary key of the row on the primary
+	Table      string
+	PrimaryKey *tablestore.PrimaryKey
+	// rows read, whose columns are nil if they are missing
+	Primary, Secondary tablestore.Row
+	// columns differing, named as on the secondary
+	Columns []string
+	// error reading the secondary, if any
+	Err error
+}
+
+// Report counts the rows compared by the shadowed reads, and samples their
+// mismatches.
+type Report struct {
+	Compared   int64
+	Mismatched int64
+	// errors reading the secondary
+	Errors int64
+	// mismatches and errors by table of the primary
+	Tables map[string]int64
+	// up to Config.Samples mismatches, sampled uniformly
+	Samples []Mismatch
+}
+
+// Report returns the report of the reads shadowed so far.
+func (mirror *Client) Report() Report {
+	mirror.reportLock.Lock()
+	defer mirror.reportLock.Unlock()
+	report := mirror.report
+	report.Tables = make(map[string]int64, len(mirror.report.Tables))
+	for table, n := range mirror.report.Tables {
+		report.Tables[table] = n
+	}
+	report.Samples = append([]Mismatch(nil), mirror.report.Samples...)
+	return report
+}
+
+// record records a comparison, mismatch being nil if the rows are equal.
+func (mirror *Client) record(mismatch *Mismatch) {
+	mirror.reportLock.Lock()
+	report := &mirror.report
+	report.Compared++
+	if mismatch == nil {
+		mirror.reportLock.Unlock()
+		return
+	}
+	if mismatch.Err != nil {
+		report.Errors++
+	} else {
+		report.Mismatched++
+	}
+	report.Tables[mismatch.Table]++
+	// reservoir sampling
+	if n := report.Mismatched + report.Errors; len(report.Samples) < mirror.config.Samples {
+		report.Samples = append(report.Samples, *mismatch)
+	} else if i := rand.Int63n(n); i < int64(len(report.Samples)) {
+		report.Samples[i] = *mismatch
+	}
+	mirror.reportLock.Unlock()
+
+	if mirror.config.OnMismatch != nil {
+		mirror.config.OnMismatch(*mismatch)
+	}
+}
+
+// shadowed reports whether to shadow a read with filter.
+func (mirror *Client) shadowed(filter tablestore.ColumnFilter) bool {
+	if !mirror.config.ShadowReads || filter != nil && mirror.config.Transform != nil {
+		return false
+	}
+	return mirror.config.ShadowRate <= 0 || rand.Float64() < mirror.config.ShadowRate
+}
+
+// expected returns the row expected on the secondary for a row read on
+// table, and false if it is not mirrored.
+func (mirror *Client) expected(table string, primary tablestore.Row) (string, tablestore.Row, bool) {
+	secondaryTable, ok := mirror.secondaryTable(table)
+	if !ok {
+		return "", tablestore.Row{}, false
+	}
+	put := &tablestore.PutRowChange{TableName: secondaryTable, PrimaryKey: primary.PrimaryKey.Clone()}
+	for _, column := range primary.Columns {
+		put.Columns = append(put.Columns, *column)
+	}
+	change, err := mirror.transform(put)
+	expected, ok := change.(*tablestore.PutRowChange)
+	if err != nil || !ok {
+		return "", tablestore.Row{}, false
+	}
+	row := tablestore.Row{PrimaryKey: expected.PrimaryKey}
+	if len(primary.Columns) > 0 {
+		for i := range expected.Columns {
+			row.Columns = append(row.Columns, &expected.Columns[i])
+		}
+	}
+	return expected.TableName, row, true
+}
+
+// compare compares the row read on the secondary to the one expected. The
+// columns of rows read with a projection renamed by Transform are compared
+// to those expected only.
+func (mirror *Client) compare(table string, primary, want, got tablestore.Row, projected bool) {
+	if projected && len(want.Columns) > 0 {
+		names := make(map[string]bool, len(want.Columns))
+		for _, column := range want.Columns {
+			names[column.ColumnName] = true
+		}
+		var columns []*tablestore.AttributeColumn
+		for _, column := range got.Columns {
+			if names[column.ColumnName] {
+				columns = append(columns, column)
+			}
+		}
+		got.Columns = columns
+	}
+	diff := tablestore.DiffRows(want, got)
+	if diff == nil {
+		mirror.record(nil)
+		return
+	}
+	mismatch := &Mismatch{Table: table, PrimaryKey: primary.PrimaryKey, Primary: primary, Secondary: got}
+	for _, column := range diff.Columns {
+		mismatch.Columns = append(mismatch.Columns, column.ColumnName)
+	}
+	mirror.record(mismatch)
+}
+
+// projection returns the projection of the reads of the secondary, and
+// whether it differs from the one of the primary.
+func (mirror *Client) projection(columnsToGet []string) ([]string, bool) {
+	if mirror.config.Transform != nil && len(columnsToGet) > 0 {
+		// columns may be renamed
+		return nil, true
+	}
+	return columnsToGet, false
+}
+
+func rowOf(pk *tablestore.PrimaryKey, columns []*tablestore.AttributeColumn) tablestore.Row {
+	row := tablestore.Row{PrimaryKey: pk.Clone()}
+	if len(columns) > 0 {
+		row.Columns = append(row.Columns, columns...)
+	}
+	return row
+}
+
+// GetRow reads the row on the primary, and on the secondary too if reads
+// are shadowed.
+func (mirror *Client) GetRow(request *tablestore.GetRowRequest) (*tablestore.GetRowResponse, error) {
+	response, err := mirror.TableStoreApi.GetRow(request)
+	if err != nil || !mirror.shadowed(request.SingleRowQueryCriteria.Filter) {
+		return response, err
+	}
+	criteria := *request.SingleRowQueryCriteria
+	primary := rowOf(criteria.PrimaryKey, response.Columns)
+	mirror.enqueue(func() { mirror.shadowRow(criteria, primary) })
+	return response, nil
+}
+
+// BatchGetRow reads the rows on the primary, and those read successfully on
+// the secondary too if reads are shadowed.
+func (mirror *Client) BatchGetRow(request *tablestore.BatchGetRowRequest) (*tablestore.BatchGetRowResponse, error) {
+	response, err := mirror.TableStoreApi.BatchGetRow(request)
+	if err != nil || !mirror.config.ShadowReads {
+		return response, err
+	}
+	for _, multi := range request.MultiRowQueryCriteria {
+		if !mirror.shadowed(multi.Filter) {
+			continue
+		}
+		for _, result := range response.TableToRowsResult[multi.TableName] {
+			if !result.IsSucceed || int(result.Index) >= len(multi.PrimaryKey) {
+				continue
+			}
+			criteria := tablestore.SingleRowQueryCriteria{TableName: multi.TableName, PrimaryKey: multi.PrimaryKey[result.Index], ColumnsToGet: multi.ColumnsToGet,
+				MaxVersion: int32(multi.MaxVersion), TimeRange: multi.TimeRange, Filter: multi.Filter, StartColumn: multi.StartColumn, EndColumn: multi.EndColumn}
+			primary := rowOf(criteria.PrimaryKey, result.Columns)
+			mirror.enqueue(func() { mirror.shadowRow(criteria, primary) })
+		}
+	}
+	return response, nil
+}
+
+// shadowRow reads on the secondary the row read on the primary.
+func (mirror *Client) shadowRow(criteria tablestore.SingleRowQueryCriteria, primary tablestore.Row) {
+	table, want, ok := mirror.expected(criteria.TableName, primary)
+	if !ok {
+		return
+	}
+	primaryTable := criteria.TableName
+	var projected bool
+	criteria.TableName, criteria.PrimaryKey = table, want.PrimaryKey
+	criteria.ColumnsToGet, projected = mirror.projection(criteria.ColumnsToGet)
+	response, err := mirror.config.Secondary.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: &criteria})
+	if err != nil {
+		mirror.record(&Mismatch{Table: primaryTable, PrimaryKey: primary.PrimaryKey, Primary: primary, Err: err})
+		return
+	}
+	mirror.compare(primaryTable, primary, want, tablestore.Row{PrimaryKey: want.PrimaryKey, Columns: response.Columns}, projected)
+}
+
+// GetRange reads the range on the primary, and the rows of the range read
+// on the secondary too if reads are shadowed.
+func (mirror *Client) GetRange(request *tablestore.GetRangeRequest) (*tablestore.GetRangeResponse, error) {
+	response, err := mirror.TableStoreApi.GetRange(request)
+	if err != nil || !mirror.shadowed(request.RangeRowQueryCriteria.Filter) {
+		return response, err
+	}
+	criteria := *request.RangeRowQueryCriteria
+	if response.NextStartPrimaryKey != nil {
+		criteria.EndPrimaryKey = response.NextStartPrimaryKey
+	}
+	var rows []tablestore.Row
+	for _, row := range response.Rows {
+		rows = append(rows, rowOf(row.PrimaryKey, row.Columns))
+	}
+	mirror.enqueue(func() { mirror.shadowRange(criteria, rows) })
+	return response, nil
+}
+
+// shadowRange reads on the secondary the range of criteria, whose rows read
+// on the primary are rows.
+func (mirror *Client) shadowRange(criteria tablestore.RangeRowQueryCriteria, rows []tablestore.Row) {
+	primaryTable := criteria.TableName
+	table, start, ok := mirror.expected(primaryTable, tablestore.Row{PrimaryKey: criteria.StartPrimaryKey})
+	if !ok {
+		return
+	}
+	_, end, ok := mirror.expected(primaryTable, tablestore.Row{PrimaryKey: criteria.EndPrimaryKey})
+	if !ok {
+		return
+	}
+	var projected bool
+	criteria.TableName, criteria.StartPrimaryKey, criteria.EndPrimaryKey = table, start.PrimaryKey, end.PrimaryKey
+	criteria.ColumnsToGet, projected = mirror.projection(criteria.ColumnsToGet)
+
+	secondary := make(map[string]*tablestore.Row)
+	var keys []string
+	for criteria.StartPrimaryKey != nil {
+		response, err := mirror.config.Secondary.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: &criteria})
+		if err != nil {
+			mirror.record(&Mismatch{Table: primaryTable, PrimaryKey: start.PrimaryKey, Err: err})
+			return
+		}
+		for _, row := range response.Rows {
+			key := keyOf(row.PrimaryKey)
+			secondary[key] = row
+			keys = append(keys, key)
+		}
+		criteria.StartPrimaryKey = response.NextStartPrimaryKey
+	}
+
+	for _, primary := range rows {
+		_, want, ok := mirror.expected(primaryTable, primary)
+		if !ok {
+			continue
+		}
+		key := keyOf(want.PrimaryKey)
+		got := tablestore.Row{PrimaryKey: want.PrimaryKey}
+		if row, ok := secondary[key]; ok {
+			got.Columns = row.Columns
+			delete(secondary, key)
+		}
+		mirror.compare(primaryTable, primary, want, got, projected)
+	}
+	// rows missing on the primary
+	for _, key := range keys {
+		if row, ok := secondary[key]; ok {
+			mirror.compare(primaryTable, tablestore.Row{PrimaryKey: row.PrimaryKey}, tablestore.Row{PrimaryKey: row.PrimaryKey}, *row, false)
+		}
+	}
+}
+
+// keyOf returns a key identifying a primary key.
+func keyOf(pk *tablestore.PrimaryKey) string {
+	var key strings.Builder
+	for _, column := range pk.PrimaryKeys {
+		fmt.Fprintf(&key, "%s=%#v;", column.ColumnName, column.Value)
+	}
+	return key.String()
+}
@@ -0,0 +1,281 @@
+package mock
+
+import (
+	"errors"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"sync"
+)
+
+var ErrNotStubbed = errors.New("[mock] method is not stubbed")
+
+// Call is one recorded invocation of a Client method. Request is nil for
+// ListTable.
+type Call struct {
+	Method  string
+	Request interface{}
+}
+
+// Client is a tablestore.TableStoreApi for unit tests. Each method records
+// the call and delegates to the function field of the same name with suffix
+// Func; methods whose function is not set return ErrNotStubbed.
+//
+//	client := &mock.Client{
+//		GetRowFunc: func(req *tablestore.GetRowRequest) (*tablestore.GetRowResponse, error) {
+//			return &tablestore.GetRowResponse{}, nil
+//		},
+//	}
+//	service := NewService(client)
+type Client struct {
+	CreateTableFunc              func(*tablestore.CreateTableRequest) (*tablestore.CreateTableResponse, error)
+	ListTableFunc                func() (*tablestore.ListTableResponse, error)
+	DeleteTableFunc              func(*tablestore.DeleteTableRequest) (*tablestore.DeleteTableResponse, error)
+	DescribeTableFunc            func(*tablestore.DescribeTableRequest) (*tablestore.DescribeTableResponse, error)
+	UpdateTableFunc              func(*tablestore.UpdateTableRequest) (*tablestore.UpdateTableResponse, error)
+	CreateIndexFunc              func(*tablestore.CreateIndexRequest) (*tablestore.CreateIndexResponse, error)
+	DeleteIndexFunc              func(*tablestore.DeleteIndexRequest) (*tablestore.DeleteIndexResponse, error)
+	PutRowFunc                   func(*tablestore.PutRowRequest) (*tablestore.PutRowResponse, error)
+	DeleteRowFunc                func(*tablestore.DeleteRowRequest) (*tablestore.DeleteRowResponse, error)
+	GetRowFunc                   func(*tablestore.GetRowRequest) (*tablestore.GetRowResponse, error)
+	UpdateRowFunc                func(*tablestore.UpdateRowRequest) (*tablestore.UpdateRowResponse, error)
+	BatchGetRowFunc              func(*tablestore.BatchGetRowRequest) (*tablestore.BatchGetRowResponse, error)
+	BatchWriteRowFunc            func(*tablestore.BatchWriteRowRequest) (*tablestore.BatchWriteRowResponse, error)
+	GetRangeFunc                 func(*tablestore.GetRangeRequest) (*tablestore.GetRangeResponse, error)
+	ComputeSplitPointsBySizeFunc func(*tablestore.ComputeSplitPointsBySizeRequest) (*tablestore.ComputeSplitPointsBySizeResponse, error)
+	ListStreamFunc               func(*tablestore.ListStreamRequest) (*tablestore.ListStreamResponse, error)
+	DescribeStreamFunc           func(*tablestore.DescribeStreamRequest) (*tablestore.DescribeStreamResponse, error)
+	GetShardIteratorFunc         func(*tablestore.GetShardIteratorRequest) (*tablestore.GetShardIteratorResponse, error)
+	GetStreamRecordFunc          func(*tablestore.GetStreamRecordRequest) (*tablestore.GetStreamRecordResponse, error)
+	CreateSearchIndexFunc        func(*tablestore.CreateSearchIndexRequest) (*tablestore.CreateSearchIndexResponse, error)
+	DeleteSearchIndexFunc        func(*tablestore.DeleteSearchIndexRequest) (*tablestore.DeleteSearchIndexResponse, error)
+	ListSearchIndexFunc          func(*tablestore.ListSearchIndexRequest) (*tablestore.ListSearchIndexResponse, error)
+	DescribeSearchIndexFunc      func(*tablestore.DescribeSearchIndexRequest) (*tablestore.DescribeSearchIndexResponse, error)
+	SearchFunc                   func(*tablestore.SearchRequest) (*tablestore.SearchResponse, error)
+
+	lock  sync.Mutex
+	calls []Call
+}
+
+var _ tablestore.TableStoreApi = (*Client)(nil)
+
+func (client *Client) record(method string, request interface{}) {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.calls = append(client.calls, Call{Method: method, Request: request})
+}
+
+// Calls returns the recorded calls in invocation order.
+func (client *Client) Calls() []Call {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	return append([]Call(nil), client.calls...)
+}
+
+// CallsOf returns the recorded calls of method.
+func (client *Client) CallsOf(method string) []Call {
+	var calls []Call
+	for _, call := range client.Calls() {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Reset clears the recorded calls, stubs are kept.
+func (client *Client) Reset() {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.calls = nil
+}
+
+func (client *Client) CreateTable(request *tablestore.CreateTableRequest) (*tablestore.CreateTableResponse, error) {
+	client.record("CreateTable", request)
+	if client.CreateTableFunc == nil {
+		return nil, ErrNotStubbed
+	}
+	return client.CreateTableFunc(request)
+}
+
+func (client *Client) ListTable() (*tablestore.ListTableResponse, error) {
+	client.record("ListTable", nil)
+	if client.ListTableFunc == nil {
+		return nil, ErrNotStubbed
+	}
+	return client.ListTableFunc()
+}
+
+func (client *Client) DeleteTable(request *tablestore.DeleteTableRequest) (*tablestore.DeleteTableResponse, error) {
+	client.record("DeleteTable", request)
+	if client.DeleteTableFunc == nil {
+		return nil, ErrNotStubbed
+	}
+	return client.DeleteTableFunc(request)
+}
+
+func (client *Client) DescribeTable(request *tablestore.DescribeTableRequest) (*tablestore.DescribeTableResponse, error) {
+	client.record("DescribeTable", request)
+	if client.DescribeTableFunc == nil {
+		return nil, ErrNotStubbed
+	}
+	return client.DescribeTableFunc(request)
+}
+
+func (client *Client) UpdateTable(request *tablestore.UpdateTableRequest) (*tablestore.UpdateTableResponse, error) {
+	client.record("UpdateTable", request)
+	if client.UpdateTableFunc == nil {
+		return nil, ErrNotStubbed
+	}
+	return client.UpdateTableFunc(request)
+}
+
+func (client *Client) CreateIndex(request *tablestore.CreateIndexRequest) (*tablestore.CreateIndexResponse, error) {
+	client.record("CreateIndex", request)
+	if client.CreateIndexFunc == nil {
+		return nil, ErrNotStubbed
+	}
+	return client.CreateIndexFunc(request)
+}
+
+func (client *Client) DeleteIndex(request *tablestore.DeleteIndexRequest) (*tablestore.DeleteIndexResponse, error) {
+	client.record("DeleteIndex", request)
+	if client.DeleteIndexFunc == nil {
+		return nil, ErrNotStubbed
+	}
+	return client.DeleteIndexFunc(request)
+}
+
+func (client *Client) PutRow(request *tablestore.PutRowRequest) (*tablestore.PutRowResponse, error) {
+	client.record("PutRow", request)
+	if client.PutRowFunc == nil {
+		return nil, ErrNotStubbed
+	}
+	return client.PutRowFunc(request)
+}
+
+func (client *Client) DeleteRow(request *tablestore.DeleteRowRequest) (*tablestore.DeleteRowResponse, error) {
+	client.record("DeleteRow", request)
+	if client.DeleteRowFunc == nil {
+		return nil, ErrNotStubbed
+	}
+	return client.DeleteRowFunc(request)
+}
+
+func (client *Client) GetRow(request *tablestore.GetRowRequest) (*tablestore.GetRowResponse, error) {
+	client.record("GetRow", request)
+	if client.GetRowFunc == nil {
+		return nil, ErrNotStubbed
+	}
+	return client.GetRowFunc(request)
+}
+
+func (client *Client) UpdateRow(request *tablestore.UpdateRowRequest) (*tablestore.UpdateRowResponse, error) {
+	client.record("UpdateRow", request)
+	if client.UpdateRowFunc == nil {
+		return nil, ErrNotStubbed
+	}
+	return client.UpdateRowFunc(request)
+}
+
+func (client *Client) BatchGetRow(request *tablestore.BatchGetRowRequest) (*tablestore.BatchGetRowResponse, error) {
+	client.record("BatchGetRow", request)
+	if client.BatchGetRowFunc == nil {
+		return nil, ErrNotStubbed
+	}
+	return client.BatchGetRowFunc(request)
+}
+
+func (client *Client) BatchWriteRow(request *tablestore.BatchWriteRowRequest) (*tablestore.BatchWriteRowResponse, error) {
+	client.record("BatchWriteRow", request)
+	if client.BatchWriteRowFunc == nil {
+		return nil, ErrNotStubbed
+	}
+	return client.BatchWriteRowFunc(request)
+}
+
+func (client *Client) GetRange(request *tablestore.GetRangeRequest) (*tablestore.GetRangeResponse, error) {
+	client.record("GetRange", request)
+	if client.GetRangeFunc == nil {
+		return nil, ErrNotStubbed
+	}
+	return client.GetRangeFunc(request)
+}
+
+func (client *Client) ComputeSplitPointsBySize(request *tablestore.ComputeSplitPointsBySizeRequest) (*tablestore.ComputeSplitPointsBySizeResponse, error) {
+	client.record("ComputeSplitPointsBySize", request)
+	if client.ComputeSplitPointsBySizeFunc == nil {
+		return nil, ErrNotStubbed
+	}
+	return client.ComputeSplitPointsBySizeFunc(request)
+}
+
+func (client *Client) ListStream(request *tablestore.ListStreamRequest) (*tablestore.ListStreamResponse, error) {
+	client.record("ListStream", request)
+	if client.ListStreamFunc == nil {
+		return nil, ErrNotStubbed
+	}
+	return client.ListStreamFunc(request)
+}
+
+func (client *Client) DescribeStream(request *tablestore.DescribeStreamRequest) (*tablestore.DescribeStreamResponse, error) {
+	client.record("DescribeStream", request)
+	if client.DescribeStreamFunc == nil {
+		return nil, ErrNotStubbed
+	}
+	return client.DescribeStreamFunc(request)
+}
+
+func (client *Client) GetShardIterator(request *tablestore.GetShardIteratorRequest) (*tablestore.GetShardIteratorResponse, error) {
+	client.record("GetShardIterator", request)
+	if client.GetShardIteratorFunc == nil {
+		return nil, ErrNotStubbed
+	}
+	return client.GetShardIteratorFunc(request)
+}
+
+func (client *Client) GetStreamRecord(request *tablestore.GetStreamRecordRequest) (*tablestore.GetStreamRecordResponse, error) {
+	client.record("GetStreamRecord", request)
+	if client.GetStreamRecordFunc == nil {
+		return nil, ErrNotStubbed
+	}
+	return client.GetStreamRecordFunc(request)
+}
+
+func (client *Client) CreateSearchIndex(request *tablestore.CreateSearchIndexRequest) (*tablestore.CreateSearchIndexResponse, error) {
+	client.record("CreateSearchIndex", request)
+	if client.CreateSearchIndexFunc == nil {
+		return nil, ErrNotStubbed
+	}
+	return client.CreateSearchIndexFunc(request)
+}
+
+func (client *Client) DeleteSearchIndex(request *tablestore.DeleteSearchIndexRequest) (*tablestore.DeleteSearchIndexResponse, error) {
+	client.record("DeleteSearchIndex", request)
+	if client.DeleteSearchIndexFunc == nil {
+		return nil, ErrNotStubbed
+	}
+	return client.DeleteSearchIndexFunc(request)
+}
+
+func (client *Client) ListSearchIndex(request *tablestore.ListSearchIndexRequest) (*tablestore.ListSearchIndexResponse, error) {
+	client.record("ListSearchIndex", request)
+	if client.ListSearchIndexFunc == nil {
+		return nil, ErrNotStubbed
+	}
+	return client.ListSearchIndexFunc(request)
+}
+
+func (client *Client) DescribeSearchIndex(request *tablestore.DescribeSearchIndexRequest) (*tablestore.DescribeSearchIndexResponse, error) {
+	client.record("DescribeSearchIndex", request)
+	if client.DescribeSearchIndexFunc == nil {
+		return nil, ErrNotStubbed
+	}
+	return client.DescribeSearchIndexFunc(request)
+}
+
+func (client *Client) Search(request *tablestore.SearchRequest) (*tablestore.SearchResponse, error) {
+	client.record("Search", request)
+	if client.SearchFunc == nil {
+		return nil, ErrNotStubbed
+	}
+	return client.SearchFunc(request)
+}
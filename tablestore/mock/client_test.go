@@ -0,0 +1,35 @@
+package mock
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	client := &Client{
+		GetRowFunc: func(req *tablestore.GetRowRequest) (*tablestore.GetRowResponse, error) {
+			resp := &tablestore.GetRowResponse{}
+			resp.Columns = append(resp.Columns, &tablestore.AttributeColumn{ColumnName: "col", Value: "v"})
+			return resp, nil
+		},
+	}
+
+	var api tablestore.TableStoreApi = client
+	req := &tablestore.GetRowRequest{}
+	resp, err := api.GetRow(req)
+	if err != nil || resp.Columns[0].Value != "v" {
+		t.Fatalf("unexpected response %v %v", resp, err)
+	}
+	if _, err := api.ListTable(); err != ErrNotStubbed {
+		t.Fatalf("expect ErrNotStubbed, got %v", err)
+	}
+
+	calls := client.CallsOf("GetRow")
+	if len(calls) != 1 || calls[0].Request != req || len(client.Calls()) != 2 {
+		t.Fatalf("unexpected calls %v", client.Calls())
+	}
+	client.Reset()
+	if len(client.Calls()) != 0 {
+		t.Fatal("calls are not reset")
+	}
+}
@@ -1,6 +1,8 @@
 package tablestore
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
 	"github.com/golang/protobuf/proto"
@@ -8,6 +10,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 	//"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
 )
@@ -15,19 +18,38 @@ import (
 // @class TableStoreClient
 // The TableStoreClient, which will connect OTS service for authorization, create/list/
 // delete tables/table groups, to get/put/delete a row.
-// Note: TableStoreClient is thread-safe.
+// Note: TableStoreClient is thread-safe: its methods may be called by many
+// goroutines at once. The options and the config are read when it is created,
+// the config being copied; later changes to the config have no effect. Only
+// the credentials may change afterwards, by SetCredentials.
 // TableStoreClient的功能包括连接OTS服务进行验证、创建/列出/删除表或表组、插入/获取/
 // 删除/更新行数据
 type TableStoreClient struct {
 	endPoint        string
 	instanceName    string
-	accessKeyId     string
-	accessKeySecret string
-	securityToken   string
+	credentials     *atomic.Value
 
 	httpClient      IHttpClient
 	config          *TableStoreConfig
 	random          *rand.Rand
+	interceptors    []Interceptor
+
+	logger               Logger
+	slowRequestThreshold time.Duration
+	metrics              MetricsSink
+	tracer               Tracer
+	ctx                  context.Context
+	correlationHeader    string
+	stats                *StatsReporter
+	dryRun               bool
+	plan                 func(PlannedWrite)
+	tableDefaults        map[string]*tableDefaults
+	audit                AuditSink
+	auditTables          map[string]bool
+	checksum             ChecksumMode
+	apiVersion           string
+	capabilities         *capabilities
+	retryAmbiguous       bool
 }
 
 type ClientOption func(*TableStoreClient)
@@ -95,6 +117,12 @@ type DeleteIndexRequest struct {
 
 type ResponseInfo struct {
 	RequestId string
+	// requests sent for the call, retries included
+	Attempts int
+	// attempts failed for lack of capacity
+	ThrottledAttempts int
+	// time spent in the call, pauses between retries included
+	TotalLatency time.Duration
 }
 
 type CreateTableResponse struct {
@@ -227,7 +255,12 @@ func (this *PrimaryKeyColumn) String() string {
 	xs = append(xs, fmt.Sprintf("\"Name\": \"%s\"", this.ColumnName))
 	switch this.PrimaryKeyOption {
 	case NONE:
-		xs = append(xs, fmt.Sprintf("\"Value\": \"%s\"", this.Value))
+		if value, ok := this.Value.([]byte); ok {
+			// binary values may not be printable
+			xs = append(xs, fmt.Sprintf("\"Value\": 0x%x", value))
+		} else {
+			xs = append(xs, fmt.Sprintf("\"Value\": \"%s\"", this.Value))
+		}
 	case MIN:
 		xs = append(xs, "\"Value\": -inf")
 	case MAX:
@@ -411,6 +444,7 @@ type PutRowChange struct {
 	Columns    []AttributeColumn
 	Condition  *RowCondition
 	ReturnType ReturnType
+	frozen     frozenFlag
 }
 
 type PutRowRequest struct {
@@ -421,6 +455,7 @@ type DeleteRowChange struct {
 	TableName  string
 	PrimaryKey *PrimaryKey
 	Condition  *RowCondition
+	frozen     frozenFlag
 }
 
 type DeleteRowRequest struct {
@@ -436,6 +471,7 @@ type SingleRowQueryCriteria struct {
 	Filter       ColumnFilter
 	StartColumn  *string
 	EndColumn    *string
+	frozen       frozenFlag
 }
 
 type UpdateRowChange struct {
@@ -443,6 +479,7 @@ type UpdateRowChange struct {
 	PrimaryKey *PrimaryKey
 	Columns    []ColumnToUpdate
 	Condition  *RowCondition
+	frozen     frozenFlag
 }
 
 type UpdateRowRequest struct {
@@ -450,14 +487,23 @@ type UpdateRowRequest struct {
 }
 
 func (rowQueryCriteria *SingleRowQueryCriteria) AddColumnToGet(columnName string) {
+	if !rowQueryCriteria.frozen.check() {
+		return
+	}
 	rowQueryCriteria.ColumnsToGet = append(rowQueryCriteria.ColumnsToGet, columnName)
 }
 
 func (rowQueryCriteria *SingleRowQueryCriteria) SetStartColumn(columnName string) {
+	if !rowQueryCriteria.frozen.check() {
+		return
+	}
 	rowQueryCriteria.StartColumn = &columnName
 }
 
 func (rowQueryCriteria *SingleRowQueryCriteria) SetEndtColumn(columnName string) {
+	if !rowQueryCriteria.frozen.check() {
+		return
+	}
 	rowQueryCriteria.EndColumn = &columnName
 }
 
@@ -466,14 +512,23 @@ func (rowQueryCriteria *SingleRowQueryCriteria) getColumnsToGet() []string {
 }
 
 func (rowQueryCriteria *MultiRowQueryCriteria) AddColumnToGet(columnName string) {
+	if !rowQueryCriteria.frozen.check() {
+		return
+	}
 	rowQueryCriteria.ColumnsToGet = append(rowQueryCriteria.ColumnsToGet, columnName)
 }
 
 func (rowQueryCriteria *RangeRowQueryCriteria) AddColumnToGet(columnName string) {
+	if !rowQueryCriteria.frozen.check() {
+		return
+	}
 	rowQueryCriteria.ColumnsToGet = append(rowQueryCriteria.ColumnsToGet, columnName)
 }
 
 func (rowQueryCriteria *MultiRowQueryCriteria) AddRow(pk *PrimaryKey) {
+	if !rowQueryCriteria.frozen.check() {
+		return
+	}
 	rowQueryCriteria.PrimaryKey = append(rowQueryCriteria.PrimaryKey, pk)
 }
 
@@ -490,6 +545,7 @@ type MultiRowQueryCriteria struct {
 	Filter       ColumnFilter
 	StartColumn  *string
 	EndColumn    *string
+	frozen       frozenFlag
 }
 
 type BatchGetRowRequest struct {
@@ -526,9 +582,14 @@ type RowResult struct {
 
 type RowChange interface {
 	Serialize() []byte
+	// serializedSize returns the size of the serialized row, which
+	// serializeTo appends to w.
+	serializedSize() int
+	serializeTo(w *bytes.Buffer)
 	getOperationType() otsprotocol.OperationType
 	getCondition() *otsprotocol.Condition
 	GetTableName() string
+	Err() error
 }
 
 type BatchGetRowResponse struct {
@@ -538,6 +599,10 @@ type BatchGetRowResponse struct {
 
 type BatchWriteRowRequest struct {
 	RowChangesGroupByTable map[string][]RowChange
+	// the changes of each table, which must share their partition key, are
+	// all written or none of them is
+	IsAtomic bool
+	frozen   frozenFlag
 }
 
 type BatchWriteRowResponse struct {
@@ -564,6 +629,7 @@ type RangeRowQueryCriteria struct {
 	Limit           int32
 	StartColumn     *string
 	EndColumn       *string
+	frozen          frozenFlag
 }
 
 type GetRangeRequest struct {
@@ -573,6 +639,9 @@ type GetRangeRequest struct {
 type Row struct {
 	PrimaryKey *PrimaryKey
 	Columns    []*AttributeColumn
+
+	// leased by RangeRows.NextPooled
+	pooled bool
 }
 
 type GetRangeResponse struct {
@@ -691,6 +760,10 @@ type StreamRecord struct {
 	Info       *RecordSequenceInfo // required
 	PrimaryKey *PrimaryKey         // required
 	Columns    []*RecordColumn
+
+	// the Info of records leased by StreamRecords.NextPooled
+	info   RecordSequenceInfo
+	pooled bool
 }
 
 func (this *StreamRecord) String() string {
@@ -742,6 +815,10 @@ type RecordColumn struct {
 	Name      *string     // required
 	Value     interface{} // optional. present when Type is RCT_Put
 	Timestamp *int64      // optional, in msec. present when Type is RCT_Put or RCT_DeleteOneVersion
+
+	// what Name and Timestamp point to in decoded records
+	name      string
+	timestamp int64
 }
 
 func (this *RecordColumn) String() string {
@@ -774,6 +851,9 @@ type IndexMeta struct {
 	Primarykey     []string
 	DefinedColumns []string
 	IndexType      IndexType
+	// SyncPhase_FULL while the index is built from the data of the table,
+	// SyncPhase_INCR then, 0 if the service does not report it
+	SyncPhase SyncPhase
 }
 
 type DefinedColumnSchema struct {
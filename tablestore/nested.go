@@ -0,0 +1,39 @@
+package tablestore
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// EncodeNested returns the value of a column of a nested field of search
+// indexes, objects being e.g. a slice of structs or of maps: the JSON array
+// of the objects, written as a string column.
+func EncodeNested(objects interface{}) (string, error) {
+	data, err := json.Marshal(objects)
+	if err != nil {
+		return "", fmt.Errorf("[tablestore] invalid nested value: %v", err)
+	}
+	if len(data) == 0 || data[0] != '[' {
+		return "", fmt.Errorf("[tablestore] nested value of type %T, not an array", objects)
+	}
+	return string(data), nil
+}
+
+// DecodeNested decodes value, the string or []byte value of a column of a
+// nested field read from the table or returned by a search, into objects,
+// e.g. a pointer to a slice of structs or of map[string]interface{}.
+func DecodeNested(value interface{}, objects interface{}) error {
+	var data []byte
+	switch value := value.(type) {
+	case string:
+		data = []byte(value)
+	case []byte:
+		data = value
+	default:
+		return fmt.Errorf("[tablestore] nested value of type %T, not a string", value)
+	}
+	if err := json.Unmarshal(data, objects); err != nil {
+		return fmt.Errorf("[tablestore] invalid nested value: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package tablestore
+
+// The service stores no null values: a column is null in a row when the row
+// has no such column, which is distinct from a column of an empty string or
+// binary value.
+
+// LookupColumn returns the newest value of the column name among columns,
+// and false if there is none, the column being null.
+func LookupColumn(columns []*AttributeColumn, name string) (interface{}, bool) {
+	var latest *AttributeColumn
+	for _, column := range columns {
+		if column.ColumnName == name && (latest == nil || column.Timestamp > latest.Timestamp) {
+			latest = column
+		}
+	}
+	if latest == nil {
+		return nil, false
+	}
+	return latest.Value, true
+}
+
+// IsEmptyValue returns whether value is an empty string or binary value, the
+// value of a column present with no content.
+func IsEmptyValue(value interface{}) bool {
+	switch value := value.(type) {
+	case string:
+		return value == ""
+	case []byte:
+		return len(value) == 0
+	}
+	return false
+}
+
+// LookupColumn returns the newest value of the column name of the row, and
+// false if the row has none.
+func (row *Row) LookupColumn(name string) (interface{}, bool) {
+	return LookupColumn(row.Columns, name)
+}
+
+// HasColumn returns whether the row has a value of the column name, possibly
+// empty.
+func (row *Row) HasColumn(name string) bool {
+	_, ok := row.LookupColumn(name)
+	return ok
+}
+
+// LookupColumn returns the newest value of the column name of the row read,
+// and false if the row has none.
+func (response *GetRowResponse) LookupColumn(name string) (interface{}, bool) {
+	return LookupColumn(response.Columns, name)
+}
+
+// HasColumn returns whether the row read has a value of the column name,
+// possibly empty.
+func (response *GetRowResponse) HasColumn(name string) bool {
+	_, ok := response.LookupColumn(name)
+	return ok
+}
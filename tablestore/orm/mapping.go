@@ -0,0 +1,358 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const tagName = "tablestore"
+
+var (
+	ErrNotStructPointer = errors.New("[orm] entity must be a non-nil pointer to struct")
+	ErrNoPrimaryKey     = errors.New("[orm] struct has no primary key field")
+	ErrNotSlice         = errors.New("[orm] out must be a pointer to slice of struct pointers")
+)
+
+// field describes one mapped struct field.
+//
+// Struct fields are mapped through the "tablestore" tag:
+//
+//	type User struct {
+//		Id    string `tablestore:"id,pk"`
+//		Seq   int64  `tablestore:"seq,pk,autoincr"`
+//		Name  string `tablestore:"name"`
+//		Age   int64  `tablestore:"age,omitempty"`
+//		Cache string `tablestore:"-"`
+//		Attrs Attrs  `tablestore:"attrs,codec=json"`
+//	}
+//
+// Primary key columns follow the declaration order of the pk fields. Untagged
+// exported fields are mapped with the field name as column name. Attribute
+// fields of other types are converted by the codec named by the codec option,
+// or by the codec registered for their type with tablestore.RegisterTypeCodec.
+type field struct {
+	name      string
+	index     []int
+	pk        bool
+	autoIncr  bool
+	omitEmpty bool
+	codec     tablestore.ColumnCodec
+}
+
+type model struct {
+	typ     reflect.Type
+	pks     []*field
+	columns []*field
+	byName  map[string]*field
+}
+
+var (
+	modelsLock sync.RWMutex
+	models     = make(map[reflect.Type]*model)
+)
+
+func getModel(t reflect.Type) (*model, error) {
+	modelsLock.RLock()
+	m, ok := models[t]
+	modelsLock.RUnlock()
+	if ok {
+		return m, nil
+	}
+
+	m, err := parseModel(t)
+	if err != nil {
+		return nil, err
+	}
+
+	modelsLock.Lock()
+	models[t] = m
+	modelsLock.Unlock()
+	return m, nil
+}
+
+func parseModel(t reflect.Type) (*model, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, ErrNotStructPointer
+	}
+
+	m := &model{typ: t, byName: make(map[string]*field)}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		tag := sf.Tag.Get(tagName)
+		if tag == "-" {
+			continue
+		}
+
+		f := &field{name: sf.Name, index: sf.Index}
+		parts := strings.Split(tag, ",")
+		if parts[0] != "" {
+			f.name = parts[0]
+		}
+		for _, opt := range parts[1:] {
+			if strings.HasPrefix(opt, "codec=") {
+				name := strings.TrimPrefix(opt, "codec=")
+				if f.codec = tablestore.GetColumnCodec(name); f.codec == nil {
+					return nil, fmt.Errorf("[orm] codec %q of field %s is not registered", name, sf.Name)
+				}
+				continue
+			}
+			switch opt {
+			case "pk":
+				f.pk = true
+			case "autoincr":
+				f.autoIncr = true
+			case "omitempty":
+				f.omitEmpty = true
+			default:
+				return nil, fmt.Errorf("[orm] unknown tag option %q on field %s", opt, sf.Name)
+			}
+		}
+
+		if f.autoIncr && !f.pk {
+			return nil, fmt.Errorf("[orm] autoincr requires pk on field %s", sf.Name)
+		}
+		if _, ok := m.byName[f.name]; ok {
+			return nil, fmt.Errorf("[orm] duplicated column name %q", f.name)
+		}
+		if f.codec == nil && !f.pk {
+			f.codec = tablestore.GetTypeCodec(sf.Type)
+		}
+		if f.codec != nil && f.pk {
+			return nil, fmt.Errorf("[orm] codec is not supported on primary key field %s", sf.Name)
+		}
+		if f.codec == nil && !isSupportedKind(sf.Type, f.pk) {
+			return nil, fmt.Errorf("[orm] unsupported type %s of field %s", sf.Type, sf.Name)
+		}
+
+		m.byName[f.name] = f
+		if f.pk {
+			m.pks = append(m.pks, f)
+		} else {
+			m.columns = append(m.columns, f)
+		}
+	}
+
+	if len(m.pks) == 0 {
+		return nil, ErrNoPrimaryKey
+	}
+	return m, nil
+}
+
+func isSupportedKind(t reflect.Type, pk bool) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return true
+	case reflect.Bool, reflect.Float32, reflect.Float64:
+		return !pk
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8
+	}
+	return false
+}
+
+func structValue(entity interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(entity)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, ErrNotStructPointer
+	}
+	return v.Elem(), nil
+}
+
+// toColumnValue converts a field to one of the value types accepted by the
+// tablestore package: int64, string, []byte, bool or float64.
+func toColumnValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return int64(v.Uint())
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.Slice:
+		return v.Bytes()
+	}
+	return nil
+}
+
+func setColumnValue(v reflect.Value, value interface{}) error {
+	switch val := value.(type) {
+	case string:
+		if v.Kind() == reflect.String {
+			v.SetString(val)
+			return nil
+		}
+	case int64:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			v.SetInt(val)
+			return nil
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+			v.SetUint(uint64(val))
+			return nil
+		}
+	case []byte:
+		if v.Kind() == reflect.Slice {
+			v.SetBytes(val)
+			return nil
+		}
+	case bool:
+		if v.Kind() == reflect.Bool {
+			v.SetBool(val)
+			return nil
+		}
+	case float64:
+		if v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64 {
+			v.SetFloat(val)
+			return nil
+		}
+	}
+	return fmt.Errorf("[orm] can not assign %T to %s", value, v.Type())
+}
+
+func (m *model) primaryKey(v reflect.Value, forPut bool) *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+	for _, f := range m.pks {
+		fv := v.FieldByIndex(f.index)
+		if f.autoIncr && forPut && isZero(fv) {
+			pk.AddPrimaryKeyColumnWithAutoIncrement(f.name)
+		} else {
+			pk.AddPrimaryKeyColumn(f.name, toColumnValue(fv))
+		}
+	}
+	return pk
+}
+
+func (m *model) attributeColumns(v reflect.Value) ([]tablestore.AttributeColumn, error) {
+	columns := make([]tablestore.AttributeColumn, 0, len(m.columns))
+	for _, f := range m.columns {
+		fv := v.FieldByIndex(f.index)
+		if f.omitEmpty && isZero(fv) {
+			continue
+		}
+		if (fv.Kind() == reflect.Slice || fv.Kind() == reflect.Map || fv.Kind() == reflect.Ptr) && fv.IsNil() {
+			continue
+		}
+		if f.codec != nil {
+			value, err := tablestore.EncodeWithCodec(f.codec, fv.Interface())
+			if err != nil {
+				return nil, fmt.Errorf("[orm] encode column %s: %s", f.name, err)
+			}
+			columns = append(columns, tablestore.AttributeColumn{ColumnName: f.name, Value: value})
+			continue
+		}
+		columns = append(columns, tablestore.AttributeColumn{ColumnName: f.name, Value: toColumnValue(fv)})
+	}
+	return columns, nil
+}
+
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.Struct, reflect.Array:
+		return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+	default:
+		return v.Interface() == reflect.Zero(v.Type()).Interface()
+	}
+}
+
+// PrimaryKeyOf builds the primary key of entity, which must be a pointer to a
+// mapped struct.
+func PrimaryKeyOf(entity interface{}) (*tablestore.PrimaryKey, error) {
+	v, err := structValue(entity)
+	if err != nil {
+		return nil, err
+	}
+	m, err := getModel(v.Type())
+	if err != nil {
+		return nil, err
+	}
+	return m.primaryKey(v, false), nil
+}
+
+// Marshal converts entity into a primary key and its attribute columns. Zero
+// auto increment primary key fields are marshaled as AUTO_INCREMENT columns.
+func Marshal(entity interface{}) (*tablestore.PrimaryKey, []tablestore.AttributeColumn, error) {
+	v, err := structValue(entity)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, err := getModel(v.Type())
+	if err != nil {
+		return nil, nil, err
+	}
+	columns, err := m.attributeColumns(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m.primaryKey(v, true), columns, nil
+}
+
+// Unmarshal fills entity with the primary key and attribute columns of a row.
+// Columns without a matching field are ignored. If a column has several
+// versions, the first one returned by the server (the latest) wins.
+func Unmarshal(pk *tablestore.PrimaryKey, columns []*tablestore.AttributeColumn, entity interface{}) error {
+	v, err := structValue(entity)
+	if err != nil {
+		return err
+	}
+	m, err := getModel(v.Type())
+	if err != nil {
+		return err
+	}
+	return m.unmarshal(pk, columns, v)
+}
+
+// UnmarshalRow is a shortcut of Unmarshal for rows returned by GetRange.
+func UnmarshalRow(row *tablestore.Row, entity interface{}) error {
+	return Unmarshal(row.PrimaryKey, row.Columns, entity)
+}
+
+func (m *model) unmarshal(pk *tablestore.PrimaryKey, columns []*tablestore.AttributeColumn, v reflect.Value) error {
+	if pk != nil {
+		for _, pkc := range pk.PrimaryKeys {
+			f, ok := m.byName[pkc.ColumnName]
+			if !ok || pkc.Value == nil {
+				continue
+			}
+			if err := setColumnValue(v.FieldByIndex(f.index), pkc.Value); err != nil {
+				return err
+			}
+		}
+	}
+
+	seen := make(map[string]bool, len(columns))
+	for _, col := range columns {
+		f, ok := m.byName[col.ColumnName]
+		if !ok || f.pk || seen[col.ColumnName] {
+			continue
+		}
+		seen[col.ColumnName] = true
+		fv := v.FieldByIndex(f.index)
+		if f.codec != nil {
+			if err := f.codec.Decode(col.Value, fv.Addr().Interface()); err != nil {
+				return fmt.Errorf("[orm] decode column %s: %s", f.name, err)
+			}
+			continue
+		}
+		if err := setColumnValue(fv, col.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+package orm
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type user struct {
+	Id      string `tablestore:"id,pk"`
+	Seq     int64  `tablestore:"seq,pk,autoincr"`
+	Name    string `tablestore:"name"`
+	Age     int32  `tablestore:"age,omitempty"`
+	Score   float64
+	Avatar  []byte `tablestore:"avatar"`
+	Ignored string `tablestore:"-"`
+	private string
+}
+
+func TestMarshal(t *testing.T) {
+	u := &user{Id: "u1", Name: "foo", Score: 1.5, Avatar: []byte{0, 1}}
+	pk, cols, err := Marshal(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pk.PrimaryKeys) != 2 || pk.PrimaryKeys[0].Value != "u1" ||
+		pk.PrimaryKeys[1].PrimaryKeyOption != tablestore.AUTO_INCREMENT {
+		t.Fatalf("unexpected primary key %v", pk.PrimaryKeys)
+	}
+	names := make(map[string]interface{})
+	for _, col := range cols {
+		names[col.ColumnName] = col.Value
+	}
+	if len(names) != 3 || names["name"] != "foo" || names["Score"] != 1.5 {
+		t.Fatalf("unexpected columns %v", names)
+	}
+	if _, ok := names["age"]; ok {
+		t.Fatal("omitempty column should be skipped")
+	}
+
+	u.Seq = 7
+	pk, err = PrimaryKeyOf(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pk.PrimaryKeys[1].Value != int64(7) {
+		t.Fatalf("unexpected primary key %v", pk.PrimaryKeys)
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn("id", "u2")
+	pk.AddPrimaryKeyColumn("seq", int64(3))
+	cols := []*tablestore.AttributeColumn{
+		{ColumnName: "name", Value: "new"},
+		{ColumnName: "name", Value: "old"},
+		{ColumnName: "age", Value: int64(18)},
+		{ColumnName: "avatar", Value: []byte("a")},
+		{ColumnName: "unknown", Value: "x"},
+	}
+	u := new(user)
+	if err := Unmarshal(pk, cols, u); err != nil {
+		t.Fatal(err)
+	}
+	if u.Id != "u2" || u.Seq != 3 || u.Name != "new" || u.Age != 18 || !bytes.Equal(u.Avatar, []byte("a")) {
+		t.Fatalf("unexpected entity %+v", u)
+	}
+
+	cols = []*tablestore.AttributeColumn{{ColumnName: "age", Value: "x"}}
+	if err := Unmarshal(nil, cols, u); err == nil {
+		t.Fatal("expect type mismatch error")
+	}
+}
+
+func TestInvalidModel(t *testing.T) {
+	type noPk struct {
+		Name string
+	}
+	type badOption struct {
+		Id string `tablestore:"id,pk,unknown"`
+	}
+	type floatPk struct {
+		Id float64 `tablestore:"id,pk"`
+	}
+	for _, entity := range []interface{}{&noPk{}, &badOption{}, &floatPk{}, user{}, nil} {
+		if _, _, err := Marshal(entity); err == nil {
+			t.Errorf("expect error for %T", entity)
+		}
+	}
+}
+
+type stubApi struct {
+	tablestore.TableStoreApi
+	put  *tablestore.PutRowChange
+	rows []*tablestore.Row
+}
+
+func (s *stubApi) PutRow(req *tablestore.PutRowRequest) (*tablestore.PutRowResponse, error) {
+	s.put = req.PutRowChange
+	resp := &tablestore.PutRowResponse{}
+	resp.PrimaryKey.AddPrimaryKeyColumn("id", "u1")
+	resp.PrimaryKey.AddPrimaryKeyColumn("seq", int64(42))
+	return resp, nil
+}
+
+func (s *stubApi) GetRange(req *tablestore.GetRangeRequest) (*tablestore.GetRangeResponse, error) {
+	resp := &tablestore.GetRangeResponse{}
+	if req.RangeRowQueryCriteria.StartPrimaryKey.PrimaryKeys[0].PrimaryKeyOption == tablestore.MIN {
+		resp.Rows = s.rows[:1]
+		resp.NextStartPrimaryKey = s.rows[1].PrimaryKey
+	} else {
+		resp.Rows = s.rows[1:]
+	}
+	return resp, nil
+}
+
+func TestRepository(t *testing.T) {
+	api := &stubApi{}
+	repo, err := NewRepository(api, "users", &user{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := &user{Id: "u1", Name: "foo"}
+	if err := repo.Put(u); err != nil {
+		t.Fatal(err)
+	}
+	if api.put.ReturnType != tablestore.ReturnType_RT_PK || u.Seq != 42 {
+		t.Fatalf("auto increment key not returned: %+v", u)
+	}
+
+	for _, id := range []string{"a", "b"} {
+		pk := new(tablestore.PrimaryKey)
+		pk.AddPrimaryKeyColumn("id", id)
+		pk.AddPrimaryKeyColumn("seq", int64(1))
+		api.rows = append(api.rows, &tablestore.Row{PrimaryKey: pk})
+	}
+	var users []*user
+	next, err := repo.QueryRange(&RangeQuery{}, &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != nil || len(users) != 2 || users[0].Id != "a" || users[1].Id != "b" {
+		t.Fatalf("unexpected range result %v %v", next, users)
+	}
+}
+
+type order struct {
+	User string `tablestore:"user,pk"`
+	Id   int64  `tablestore:"id,pk"`
+	Item string `tablestore:"item"`
+}
+
+func TestReadPage(t *testing.T) {
+	client := tablestoretest.NewClient()
+	client.RangeLimit = 2
+	meta := &tablestore.TableMeta{TableName: "orders"}
+	meta.AddPrimaryKeyColumn("user", tablestore.PrimaryKeyType_STRING)
+	meta.AddPrimaryKeyColumn("id", tablestore.PrimaryKeyType_INTEGER)
+	if _, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := NewRepository(client, "orders", &order{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 7; i++ {
+		if err := repo.Put(&order{User: "u1", Id: i, Item: fmt.Sprint("item", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	key := []byte("secret")
+	query := &RangeQuery{Limit: 3}
+	var ids []int64
+	token, pages := "", 0
+	for {
+		var orders []*order
+		page, err := repo.ReadPage(query, token, key, &orders)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		for _, o := range page.Items.([]*order) {
+			ids = append(ids, o.Id)
+		}
+		if page.NextToken == "" {
+			break
+		}
+		token = page.NextToken
+	}
+	if pages != 3 || fmt.Sprint(ids) != "[0 1 2 3 4 5 6]" {
+		t.Errorf("%d pages of %v", pages, ids)
+	}
+
+	var orders []*order
+	page, err := repo.ReadPage(query, "", key, &orders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items, ok := page.Items.([]*order); !ok || len(items) != 3 || &items[0] != &orders[0] {
+		t.Errorf("items %v not the orders read %v", page.Items, orders)
+	}
+	forged := page.NextToken[:len(page.NextToken)-1] + "A"
+	if forged == page.NextToken {
+		forged = page.NextToken[:len(page.NextToken)-1] + "B"
+	}
+	if _, err := repo.ReadPage(query, forged, key, &orders); err != tablestore.ErrInvalidRangeToken {
+		t.Errorf("forged token: %v", err)
+	}
+	if _, err := repo.ReadPage(&RangeQuery{Limit: 3, Direction: tablestore.BACKWARD}, page.NextToken, key, &orders); err != tablestore.ErrInvalidRangeToken {
+		t.Errorf("token of another query: %v", err)
+	}
+	orders = nil
+	unsigned, err := repo.ReadPage(query, "", nil, &orders)
+	if err != nil || strings.Contains(unsigned.NextToken, ".") {
+		t.Errorf("unsigned token %q, %v", unsigned.NextToken, err)
+	}
+	if _, err := repo.ReadPage(query, "", nil, &[]*user{}); err != ErrNotSlice {
+		t.Errorf("page of another type: %v", err)
+	}
+}
+
+type cents int64
+
+type centsCodec struct{}
+
+func (centsCodec) Encode(v interface{}) (interface{}, error) {
+	return fmt.Sprintf("%d.%02d", v.(cents)/100, v.(cents)%100), nil
+}
+
+func (centsCodec) Decode(value interface{}, target interface{}) error {
+	var yuan, fen int64
+	if _, err := fmt.Sscanf(value.(string), "%d.%d", &yuan, &fen); err != nil {
+		return err
+	}
+	*target.(*cents) = cents(yuan*100 + fen)
+	return nil
+}
+
+type upperCodec struct{}
+
+func (upperCodec) Encode(v interface{}) (interface{}, error) {
+	return strings.ToUpper(v.(string)), nil
+}
+
+func (upperCodec) Decode(value interface{}, target interface{}) error {
+	*target.(*string) = strings.ToLower(value.(string))
+	return nil
+}
+
+func TestCodec(t *testing.T) {
+	tablestore.RegisterTypeCodec(cents(0), centsCodec{})
+	tablestore.RegisterColumnCodec("upper", upperCodec{})
+
+	type order struct {
+		Id    string `tablestore:"id,pk"`
+		Price cents  `tablestore:"price"`
+		Note  string `tablestore:"note,codec=upper"`
+	}
+	_, cols, err := Marshal(&order{Id: "o1", Price: 1205, Note: "fast"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cols[0].Value != "12.05" || cols[1].Value != "FAST" {
+		t.Fatalf("unexpected columns %v", cols)
+	}
+
+	o := new(order)
+	if err := Unmarshal(nil, []*tablestore.AttributeColumn{{ColumnName: "price", Value: "3.10"}, {ColumnName: "note", Value: "SLOW"}}, o); err != nil {
+		t.Fatal(err)
+	}
+	if o.Price != 310 || o.Note != "slow" {
+		t.Fatalf("unexpected entity %+v", o)
+	}
+
+	type event struct {
+		Id   string    `tablestore:"id,pk"`
+		Time time.Time `tablestore:"time,codec=unixmilli"`
+	}
+	at := time.Date(2021, 3, 4, 5, 6, 7, 891000000, time.UTC)
+	_, cols, err = Marshal(&event{Id: "e1", Time: at})
+	if err != nil || cols[0].Value != int64(1614834367891) {
+		t.Fatalf("unexpected time column %v %v", cols, err)
+	}
+	e := new(event)
+	if err := Unmarshal(nil, []*tablestore.AttributeColumn{&cols[0]}, e); err != nil || !e.Time.Equal(at) {
+		t.Fatalf("unexpected event %+v %v", e, err)
+	}
+
+	var price cents
+	column := &tablestore.AttributeColumn{ColumnName: "price", Value: "0.99"}
+	if err := column.Decode(&price); err != nil || price != 99 {
+		t.Fatalf("decode column: %v %v", price, err)
+	}
+}
@@ -0,0 +1,101 @@
+package orm
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"reflect"
+	"strings"
+)
+
+// length of the signatures of tokens
+const signatureSize = 16
+
+// Page is a page of the entities of a range, and the token of the next page,
+// "" at the end of the range, ready to be returned by a paginated web API:
+//
+//	func listOrders(w http.ResponseWriter, r *http.Request) {
+//		var orders []*Order
+//		page, err := repo.ReadPage(&orm.RangeQuery{Limit: 20}, r.URL.Query().Get("next_token"), key, &orders)
+//		if err == tablestore.ErrInvalidRangeToken {
+//			http.Error(w, err.Error(), http.StatusBadRequest)
+//			return
+//		}
+//		...
+//		json.NewEncoder(w).Encode(page)
+//	}
+//
+// TypedRepository.ReadPage returns a TypedPage, whose items have their static
+// type.
+type Page struct {
+	// the entities of the page, a []*T never nil
+	Items     interface{} `json:"items"`
+	NextToken string      `json:"next_token,omitempty"`
+}
+
+// ReadPage reads into out, a pointer to []*T, the page of query, of at most
+// query.Limit entities, at token, the NextToken of the previous page or ""
+// for the first one.
+//
+// Tokens are signed by HMAC-SHA256 with key if it is not nil, so that their
+// holders can not forge the primary keys they resume at; tokens whose
+// signature is invalid are rejected with tablestore.ErrInvalidRangeToken, as
+// those of another query.
+func (r *Repository) ReadPage(query *RangeQuery, token string, key []byte, out interface{}) (*Page, error) {
+	outValue := reflect.ValueOf(out)
+	if outValue.Kind() != reflect.Ptr || outValue.Elem().Kind() != reflect.Slice ||
+		outValue.Elem().Type().Elem() != reflect.PtrTo(r.model.typ) {
+		return nil, ErrNotSlice
+	}
+	criteria := r.criteria(query)
+	if key != nil && token != "" {
+		var err error
+		if token, err = verifyToken(token, key); err != nil {
+			return nil, err
+		}
+	}
+	if err := tablestore.DecodeRangeToken(token, criteria); err != nil {
+		return nil, err
+	}
+	resumed := *query
+	resumed.Start = criteria.StartPrimaryKey
+
+	if outValue.Elem().IsNil() {
+		outValue.Elem().Set(reflect.MakeSlice(outValue.Elem().Type(), 0, query.Limit))
+	}
+	next, err := r.QueryRange(&resumed, out)
+	if err != nil {
+		return nil, err
+	}
+	page := &Page{Items: outValue.Elem().Interface()}
+	page.NextToken = tablestore.EncodeRangeToken(r.criteria(query), next)
+	if key != nil && page.NextToken != "" {
+		page.NextToken = signToken(page.NextToken, key)
+	}
+	return page, nil
+}
+
+func tokenSignature(token string, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(token))
+	return mac.Sum(nil)[:signatureSize]
+}
+
+// signToken appends the signature of token to it.
+func signToken(token string, key []byte) string {
+	return token + "." + base64.RawURLEncoding.EncodeToString(tokenSignature(token, key))
+}
+
+// verifyToken returns the token signed by signToken.
+func verifyToken(signed string, key []byte) (string, error) {
+	i := strings.LastIndexByte(signed, '.')
+	if i < 0 {
+		return "", tablestore.ErrInvalidRangeToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(signed[i+1:])
+	if err != nil || !hmac.Equal(signature, tokenSignature(signed[:i], key)) {
+		return "", tablestore.ErrInvalidRangeToken
+	}
+	return signed[:i], nil
+}
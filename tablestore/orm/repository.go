@@ -0,0 +1,299 @@
+package orm
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"reflect"
+)
+
+// max rows allowed in one BatchGetRow request
+const batchGetLimit = 100
+
+// Repository offers typed row operations of a table whose rows are mapped to
+// one struct type. Entities passed to its methods are pointers to that struct.
+//
+//	repo, err := orm.NewRepository(client, "user", &User{})
+//	err = repo.Put(&User{Id: "u1", Name: "foo"})
+//	user := &User{Id: "u1"}
+//	found, err := repo.Get(user)
+//
+// TypedRepository, with Go 1.18 and later, gives the methods of Repository
+// the static types of the entities.
+type Repository struct {
+	api       tablestore.TableStoreApi
+	tableName string
+	model     *model
+}
+
+func NewRepository(api tablestore.TableStoreApi, tableName string, prototype interface{}) (*Repository, error) {
+	v, err := structValue(prototype)
+	if err != nil {
+		return nil, err
+	}
+	m, err := getModel(v.Type())
+	if err != nil {
+		return nil, err
+	}
+	return &Repository{api: api, tableName: tableName, model: m}, nil
+}
+
+func (r *Repository) TableName() string {
+	return r.tableName
+}
+
+func (r *Repository) value(entity interface{}) (reflect.Value, error) {
+	v, err := structValue(entity)
+	if err != nil {
+		return v, err
+	}
+	if v.Type() != r.model.typ {
+		return v, fmt.Errorf("[orm] expect entity of type *%s, got %T", r.model.typ, entity)
+	}
+	return v, nil
+}
+
+// Get loads the row whose primary key is taken from entity and fills the rest
+// of entity. It returns false if the row does not exist.
+func (r *Repository) Get(entity interface{}) (bool, error) {
+	v, err := r.value(entity)
+	if err != nil {
+		return false, err
+	}
+	criteria := &tablestore.SingleRowQueryCriteria{
+		TableName:  r.tableName,
+		PrimaryKey: r.model.primaryKey(v, false),
+		MaxVersion: 1,
+	}
+	resp, err := r.api.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil {
+		return false, err
+	}
+	if len(resp.PrimaryKey.PrimaryKeys) == 0 {
+		return false, nil
+	}
+	return true, r.model.unmarshal(&resp.PrimaryKey, resp.Columns, v)
+}
+
+// Put writes entity regardless of whether the row exists. Auto increment
+// primary keys generated by the server are written back into entity.
+func (r *Repository) Put(entity interface{}) error {
+	return r.PutWithCondition(entity, &tablestore.RowCondition{RowExistenceExpectation: tablestore.RowExistenceExpectation_IGNORE})
+}
+
+// Insert writes entity only if the row does not exist yet.
+func (r *Repository) Insert(entity interface{}) error {
+	return r.PutWithCondition(entity, &tablestore.RowCondition{RowExistenceExpectation: tablestore.RowExistenceExpectation_EXPECT_NOT_EXIST})
+}
+
+func (r *Repository) PutWithCondition(entity interface{}, condition *tablestore.RowCondition) error {
+	v, err := r.value(entity)
+	if err != nil {
+		return err
+	}
+	columns, err := r.model.attributeColumns(v)
+	if err != nil {
+		return err
+	}
+	change := &tablestore.PutRowChange{
+		TableName:  r.tableName,
+		PrimaryKey: r.model.primaryKey(v, true),
+		Columns:    columns,
+		Condition:  condition,
+	}
+	autoIncr := r.hasAutoIncrement(change.PrimaryKey)
+	if autoIncr {
+		change.SetReturnPk()
+	}
+	resp, err := r.api.PutRow(&tablestore.PutRowRequest{PutRowChange: change})
+	if err != nil {
+		return err
+	}
+	if autoIncr && resp != nil {
+		return r.model.unmarshal(&resp.PrimaryKey, nil, v)
+	}
+	return nil
+}
+
+func (r *Repository) hasAutoIncrement(pk *tablestore.PrimaryKey) bool {
+	for _, pkc := range pk.PrimaryKeys {
+		if pkc.PrimaryKeyOption == tablestore.AUTO_INCREMENT {
+			return true
+		}
+	}
+	return false
+}
+
+// Update overwrites the mapped attribute columns of an existing row, leaving
+// other columns untouched. Empty omitempty fields are skipped.
+func (r *Repository) Update(entity interface{}) error {
+	return r.UpdateWithCondition(entity, &tablestore.RowCondition{RowExistenceExpectation: tablestore.RowExistenceExpectation_EXPECT_EXIST})
+}
+
+func (r *Repository) UpdateWithCondition(entity interface{}, condition *tablestore.RowCondition) error {
+	v, err := r.value(entity)
+	if err != nil {
+		return err
+	}
+	change := &tablestore.UpdateRowChange{
+		TableName:  r.tableName,
+		PrimaryKey: r.model.primaryKey(v, false),
+		Condition:  condition,
+	}
+	columns, err := r.model.attributeColumns(v)
+	if err != nil {
+		return err
+	}
+	for _, col := range columns {
+		change.PutColumn(col.ColumnName, col.Value)
+	}
+	if len(change.Columns) == 0 {
+		return nil
+	}
+	_, err = r.api.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: change})
+	return err
+}
+
+// Delete removes the row whose primary key is taken from entity.
+func (r *Repository) Delete(entity interface{}) error {
+	v, err := r.value(entity)
+	if err != nil {
+		return err
+	}
+	change := &tablestore.DeleteRowChange{
+		TableName:  r.tableName,
+		PrimaryKey: r.model.primaryKey(v, false),
+		Condition:  &tablestore.RowCondition{RowExistenceExpectation: tablestore.RowExistenceExpectation_IGNORE},
+	}
+	_, err = r.api.DeleteRow(&tablestore.DeleteRowRequest{DeleteRowChange: change})
+	return err
+}
+
+// BatchGet loads a slice of entities ([]*T) whose primary keys are set, in
+// chunks of at most 100 rows. found[i] reports whether entities[i] exists.
+func (r *Repository) BatchGet(entities interface{}) (found []bool, err error) {
+	slice := reflect.ValueOf(entities)
+	if slice.Kind() != reflect.Slice {
+		return nil, ErrNotSlice
+	}
+
+	found = make([]bool, slice.Len())
+	for begin := 0; begin < slice.Len(); begin += batchGetLimit {
+		end := begin + batchGetLimit
+		if end > slice.Len() {
+			end = slice.Len()
+		}
+
+		criteria := &tablestore.MultiRowQueryCriteria{TableName: r.tableName, MaxVersion: 1}
+		values := make([]reflect.Value, 0, end-begin)
+		for i := begin; i < end; i++ {
+			v, err := r.value(slice.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+			criteria.AddRow(r.model.primaryKey(v, false))
+		}
+
+		req := &tablestore.BatchGetRowRequest{MultiRowQueryCriteria: []*tablestore.MultiRowQueryCriteria{criteria}}
+		resp, err := r.api.BatchGetRow(req)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, result := range resp.TableToRowsResult[r.tableName] {
+			if !result.IsSucceed {
+				return nil, fmt.Errorf("%s %s", result.Error.Code, result.Error.Message)
+			}
+			if len(result.PrimaryKey.PrimaryKeys) == 0 {
+				continue
+			}
+			idx := int(result.Index)
+			if idx >= len(values) {
+				return nil, fmt.Errorf("[orm] unexpected row index %d in BatchGetRow response", idx)
+			}
+			if err := r.model.unmarshal(&result.PrimaryKey, result.Columns, values[idx]); err != nil {
+				return nil, err
+			}
+			found[begin+idx] = true
+		}
+	}
+	return found, nil
+}
+
+// RangeQuery describes a GetRange scan issued by Repository.QueryRange.
+// Nil Start and End default to the whole table in the scan direction.
+type RangeQuery struct {
+	Start     *tablestore.PrimaryKey
+	End       *tablestore.PrimaryKey
+	Direction tablestore.Direction
+	Filter    tablestore.ColumnFilter
+	// max entities to return; 0 means no limit
+	Limit int
+}
+
+// QueryRange scans rows of the range into out, a pointer to []*T, following
+// NextStartPrimaryKey until Limit entities are collected or the range is
+// exhausted. The returned key is where the next page starts, nil if none.
+func (r *Repository) QueryRange(query *RangeQuery, out interface{}) (*tablestore.PrimaryKey, error) {
+	outValue := reflect.ValueOf(out)
+	if outValue.Kind() != reflect.Ptr || outValue.Elem().Kind() != reflect.Slice ||
+		outValue.Elem().Type().Elem() != reflect.PtrTo(r.model.typ) {
+		return nil, ErrNotSlice
+	}
+	slice := outValue.Elem()
+
+	criteria := r.criteria(query)
+	count := 0
+	for {
+		if query.Limit > 0 {
+			criteria.Limit = int32(query.Limit - count)
+		}
+		resp, err := r.api.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: criteria})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range resp.Rows {
+			entity := reflect.New(r.model.typ)
+			if err := r.model.unmarshal(row.PrimaryKey, row.Columns, entity.Elem()); err != nil {
+				return nil, err
+			}
+			slice.Set(reflect.Append(slice, entity))
+			count++
+		}
+		if resp.NextStartPrimaryKey == nil || (query.Limit > 0 && count >= query.Limit) {
+			return resp.NextStartPrimaryKey, nil
+		}
+		criteria.StartPrimaryKey = resp.NextStartPrimaryKey
+	}
+}
+
+// criteria returns the criteria of the first GetRange of query.
+func (r *Repository) criteria(query *RangeQuery) *tablestore.RangeRowQueryCriteria {
+	criteria := &tablestore.RangeRowQueryCriteria{
+		TableName:       r.tableName,
+		StartPrimaryKey: query.Start,
+		EndPrimaryKey:   query.End,
+		Direction:       query.Direction,
+		Filter:          query.Filter,
+		MaxVersion:      1,
+	}
+	if criteria.StartPrimaryKey == nil {
+		criteria.StartPrimaryKey = r.boundary(query.Direction == tablestore.FORWARD)
+	}
+	if criteria.EndPrimaryKey == nil {
+		criteria.EndPrimaryKey = r.boundary(query.Direction != tablestore.FORWARD)
+	}
+	return criteria
+}
+
+func (r *Repository) boundary(min bool) *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+	for _, f := range r.model.pks {
+		if min {
+			pk.AddPrimaryKeyColumnWithMinValue(f.name)
+		} else {
+			pk.AddPrimaryKeyColumnWithMaxValue(f.name)
+		}
+	}
+	return pk
+}
@@ -0,0 +1,103 @@
+//go:build go1.18
+// +build go1.18
+
+package orm
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+)
+
+// TypedRepository is the Repository of the rows of a table mapped to T, whose
+// methods take and return entities of type *T.
+//
+//	repo, err := orm.NewTypedRepository[User](client, "user")
+//	err = repo.Put(&User{Id: "u1", Name: "foo"})
+//	user := &User{Id: "u1"}
+//	found, err := repo.Get(user)
+type TypedRepository[T any] struct {
+	repo *Repository
+}
+
+func NewTypedRepository[T any](api tablestore.TableStoreApi, tableName string) (*TypedRepository[T], error) {
+	repo, err := NewRepository(api, tableName, new(T))
+	if err != nil {
+		return nil, err
+	}
+	return &TypedRepository[T]{repo: repo}, nil
+}
+
+// Repository returns the untyped Repository of r.
+func (r *TypedRepository[T]) Repository() *Repository {
+	return r.repo
+}
+
+func (r *TypedRepository[T]) TableName() string {
+	return r.repo.tableName
+}
+
+// Get is Repository.Get.
+func (r *TypedRepository[T]) Get(entity *T) (bool, error) {
+	return r.repo.Get(entity)
+}
+
+// Put is Repository.Put.
+func (r *TypedRepository[T]) Put(entity *T) error {
+	return r.repo.Put(entity)
+}
+
+// Insert is Repository.Insert.
+func (r *TypedRepository[T]) Insert(entity *T) error {
+	return r.repo.Insert(entity)
+}
+
+func (r *TypedRepository[T]) PutWithCondition(entity *T, condition *tablestore.RowCondition) error {
+	return r.repo.PutWithCondition(entity, condition)
+}
+
+// Update is Repository.Update.
+func (r *TypedRepository[T]) Update(entity *T) error {
+	return r.repo.Update(entity)
+}
+
+func (r *TypedRepository[T]) UpdateWithCondition(entity *T, condition *tablestore.RowCondition) error {
+	return r.repo.UpdateWithCondition(entity, condition)
+}
+
+// Delete is Repository.Delete.
+func (r *TypedRepository[T]) Delete(entity *T) error {
+	return r.repo.Delete(entity)
+}
+
+// BatchGet is Repository.BatchGet.
+func (r *TypedRepository[T]) BatchGet(entities []*T) (found []bool, err error) {
+	return r.repo.BatchGet(entities)
+}
+
+// QueryRange returns the entities of the range, as Repository.QueryRange reads
+// them, and the primary key where the next page starts, nil if none.
+func (r *TypedRepository[T]) QueryRange(query *RangeQuery) ([]*T, *tablestore.PrimaryKey, error) {
+	var entities []*T
+	next, err := r.repo.QueryRange(query, &entities)
+	if err != nil {
+		return nil, nil, err
+	}
+	return entities, next, nil
+}
+
+// TypedPage is the Page of entities of type *T.
+type TypedPage[T any] struct {
+	// the entities of the page, never nil
+	Items     []*T   `json:"items"`
+	NextToken string `json:"next_token,omitempty"`
+}
+
+// ReadPage returns the page of query at token, as Repository.ReadPage reads
+// it.
+func (r *TypedRepository[T]) ReadPage(query *RangeQuery, token string, key []byte) (*TypedPage[T], error) {
+	var entities []*T
+	page, err := r.repo.ReadPage(query, token, key, &entities)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedPage[T]{Items: entities, NextToken: page.NextToken}, nil
+}
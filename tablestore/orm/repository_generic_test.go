@@ -0,0 +1,109 @@
+//go:build go1.18
+// +build go1.18
+
+package orm
+
+import (
+	"encoding/json"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"testing"
+)
+
+func TestTypedRepository(t *testing.T) {
+	client := tablestoretest.NewClient()
+	meta := &tablestore.TableMeta{TableName: "users"}
+	meta.AddPrimaryKeyColumn("id", tablestore.PrimaryKeyType_STRING)
+	meta.AddPrimaryKeyColumnOption("seq", tablestore.PrimaryKeyType_INTEGER, tablestore.AUTO_INCREMENT)
+	if _, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+		t.Fatal(err)
+	}
+	users, err := NewTypedRepository[user](client, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users.TableName() != "users" || users.Repository().TableName() != "users" {
+		t.Fatalf("unexpected table %s", users.TableName())
+	}
+
+	u := &user{Id: "u1", Name: "foo"}
+	if err := users.Put(u); err != nil {
+		t.Fatal(err)
+	}
+	u.Name = "bar"
+	if err := users.Update(u); err != nil {
+		t.Fatal(err)
+	}
+	found := &user{Id: "u1", Seq: u.Seq}
+	if ok, err := users.Get(found); err != nil || !ok || found.Name != "bar" {
+		t.Fatalf("unexpected user %+v, %v, %v", found, ok, err)
+	}
+	if ok, err := users.Get(&user{Id: "u2", Seq: 1}); err != nil || ok {
+		t.Fatalf("unexpected missing user %v, %v", ok, err)
+	}
+
+	batch := []*user{{Id: "u2", Seq: 1}, {Id: "u1", Seq: u.Seq}}
+	if ok, err := users.BatchGet(batch); err != nil || ok[0] || !ok[1] || batch[1].Name != "bar" {
+		t.Fatalf("unexpected batch %v, %v, %v", batch[1], ok, err)
+	}
+
+	all, next, err := users.QueryRange(&RangeQuery{})
+	if err != nil || next != nil || len(all) != 1 || all[0].Id != "u1" {
+		t.Fatalf("unexpected range result %v, %v, %v", all, next, err)
+	}
+
+	if err := users.Delete(u); err != nil {
+		t.Fatal(err)
+	}
+	if all, _, err := users.QueryRange(&RangeQuery{}); err != nil || len(all) != 0 {
+		t.Fatalf("unexpected range result after delete %v, %v", all, err)
+	}
+
+	if _, err := NewTypedRepository[int](client, "users"); err == nil {
+		t.Fatal("repository of ints")
+	}
+}
+
+func TestTypedReadPage(t *testing.T) {
+	client := tablestoretest.NewClient()
+	client.RangeLimit = 2
+	meta := &tablestore.TableMeta{TableName: "orders"}
+	meta.AddPrimaryKeyColumn("user", tablestore.PrimaryKeyType_STRING)
+	meta.AddPrimaryKeyColumn("id", tablestore.PrimaryKeyType_INTEGER)
+	if _, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+		t.Fatal(err)
+	}
+	orders, err := NewTypedRepository[order](client, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 5; i++ {
+		if err := orders.Put(&order{User: "u1", Id: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	key := []byte("secret")
+	query := &RangeQuery{Limit: 3}
+	page, err := orders.ReadPage(query, "", key)
+	if err != nil || len(page.Items) != 3 || page.Items[2].Id != 2 || page.NextToken == "" {
+		t.Fatalf("unexpected first page %+v, %v", page, err)
+	}
+	page, err = orders.ReadPage(query, page.NextToken, key)
+	if err != nil || len(page.Items) != 2 || page.Items[0].Id != 3 || page.NextToken != "" {
+		t.Fatalf("unexpected last page %+v, %v", page, err)
+	}
+	if _, err := orders.ReadPage(query, "forged", key); err != tablestore.ErrInvalidRangeToken {
+		t.Errorf("forged token: %v", err)
+	}
+
+	start, _ := PrimaryKeyOf(&order{User: "u0", Id: 0})
+	end, _ := PrimaryKeyOf(&order{User: "u0", Id: 1})
+	empty, err := orders.ReadPage(&RangeQuery{Start: start, End: end}, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := json.Marshal(empty); string(b) != `{"items":[]}` {
+		t.Errorf("empty page %s", b)
+	}
+}
@@ -0,0 +1,220 @@
+// Package parquet exports the rows of tables to Parquet files, through a
+// Writer implemented over a Parquet library:
+//
+//	schema, err := parquet.NewSchema(client, "orders",
+//		parquet.Column{Name: "status", Type: parquet.String},
+//		parquet.Column{Name: "total", Type: parquet.Double})
+//	if err != nil {
+//		return err
+//	}
+//	w := newParquetWriter(f, schema.String()) // e.g. over parquet-go
+//	rows, err := parquet.Export(ctx, client, schema, w)
+//
+// The primary key columns of the table are required fields of the schema,
+// the columns selected are optional fields, null in rows missing them.
+package parquet
+
+import (
+	"context"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"strings"
+)
+
+// Type is the type of a field, with its Parquet physical and logical types.
+type Type int
+
+const (
+	// binary (UTF8)
+	String Type = iota
+	// int64
+	Integer
+	// double
+	Double
+	// boolean
+	Boolean
+	// binary
+	Binary
+)
+
+func (t Type) String() string {
+	switch t {
+	case String:
+		return "binary"
+	case Integer:
+		return "int64"
+	case Double:
+		return "double"
+	case Boolean:
+		return "boolean"
+	case Binary:
+		return "binary"
+	}
+	return fmt.Sprintf("Type(%d)", int(t))
+}
+
+// Column is a column of the table exported.
+type Column struct {
+	Name string
+	Type Type
+}
+
+type Field struct {
+	Name     string
+	Type     Type
+	Required bool
+}
+
+// Schema maps the rows of a table to Parquet records.
+type Schema struct {
+	Table  string
+	Fields []Field
+}
+
+// NewSchema returns the schema of the primary key of table followed by
+// columns.
+func NewSchema(client tablestore.TableStoreApi, table string, columns ...Column) (*Schema, error) {
+	resp, err := client.DescribeTable(&tablestore.DescribeTableRequest{TableName: table})
+	if err != nil {
+		return nil, err
+	}
+	schema := &Schema{Table: table}
+	names := make(map[string]bool)
+	for _, pk := range resp.TableMeta.SchemaEntry {
+		field := Field{Name: *pk.Name, Required: true}
+		switch *pk.Type {
+		case tablestore.PrimaryKeyType_INTEGER:
+			field.Type = Integer
+		case tablestore.PrimaryKeyType_STRING:
+			field.Type = String
+		case tablestore.PrimaryKeyType_BINARY:
+			field.Type = Binary
+		}
+		schema.Fields = append(schema.Fields, field)
+		names[field.Name] = true
+	}
+	for _, column := range columns {
+		if names[column.Name] {
+			return nil, fmt.Errorf("[tablestore] column %s selected twice or a primary key column", column.Name)
+		}
+		if column.Type < String || column.Type > Binary {
+			return nil, fmt.Errorf("[tablestore] invalid type of column %s", column.Name)
+		}
+		names[column.Name] = true
+		schema.Fields = append(schema.Fields, Field{Name: column.Name, Type: column.Type})
+	}
+	return schema, nil
+}
+
+// String returns the Parquet message type of schema, e.g.
+//
+//	message orders {
+//	  required binary user (UTF8);
+//	  required int64 id;
+//	  optional double total;
+//	}
+func (schema *Schema) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "message %s {\n", schema.Table)
+	for _, field := range schema.Fields {
+		repetition := "optional"
+		if field.Required {
+			repetition = "required"
+		}
+		fmt.Fprintf(&b, "  %s %s %s", repetition, field.Type, field.Name)
+		if field.Type == String {
+			b.WriteString(" (UTF8)")
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Writer writes the records of a Parquet file.
+type Writer interface {
+	// Write writes a record, the values of the fields of the schema in
+	// order: string, int64, float64, bool or []byte, nil for nulls.
+	Write(record []interface{}) error
+}
+
+// Export writes the rows of the table of schema to w in primary key order,
+// returning the number of rows written. w is not closed.
+func Export(ctx context.Context, client tablestore.TableStoreApi, schema *Schema, w Writer) (int64, error) {
+	criteria := &tablestore.RangeRowQueryCriteria{TableName: schema.Table, StartPrimaryKey: new(tablestore.PrimaryKey),
+		EndPrimaryKey: new(tablestore.PrimaryKey), MaxVersion: 1, Direction: tablestore.FORWARD}
+	index := make(map[string]int, len(schema.Fields))
+	for i, field := range schema.Fields {
+		index[field.Name] = i
+		if field.Required {
+			criteria.StartPrimaryKey.AddPrimaryKeyColumnWithMinValue(field.Name)
+			criteria.EndPrimaryKey.AddPrimaryKeyColumnWithMaxValue(field.Name)
+		} else {
+			criteria.ColumnsToGet = append(criteria.ColumnsToGet, field.Name)
+		}
+	}
+
+	if criteria.ColumnsToGet == nil {
+		// the primary key only
+		criteria.ColumnsToGet = []string{schema.Fields[0].Name}
+	}
+
+	var rows int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return rows, err
+		}
+		resp, err := client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: criteria})
+		if err != nil {
+			return rows, err
+		}
+		for _, row := range resp.Rows {
+			record := make([]interface{}, len(schema.Fields))
+			for _, column := range row.PrimaryKey.PrimaryKeys {
+				record[index[column.ColumnName]] = column.Value
+			}
+			for _, column := range row.Columns {
+				i, ok := index[column.ColumnName]
+				if !ok || schema.Fields[i].Required {
+					continue
+				}
+				if !schema.Fields[i].Type.accepts(column.Value) {
+					return rows, fmt.Errorf("[tablestore] column %s of row %v is a %T, not a %s", column.ColumnName, primaryKeyValues(row.PrimaryKey), column.Value, schema.Fields[i].Type)
+				}
+				record[i] = column.Value
+			}
+			if err := w.Write(record); err != nil {
+				return rows, err
+			}
+			rows++
+		}
+		if resp.NextStartPrimaryKey == nil {
+			return rows, nil
+		}
+		criteria.StartPrimaryKey = resp.NextStartPrimaryKey
+	}
+}
+
+func (t Type) accepts(value interface{}) bool {
+	switch value.(type) {
+	case string:
+		return t == String
+	case int64:
+		return t == Integer
+	case float64:
+		return t == Double
+	case bool:
+		return t == Boolean
+	case []byte:
+		return t == Binary
+	}
+	return false
+}
+
+func primaryKeyValues(pk *tablestore.PrimaryKey) []interface{} {
+	values := make([]interface{}, len(pk.PrimaryKeys))
+	for i, column := range pk.PrimaryKeys {
+		values[i] = column.Value
+	}
+	return values
+}
@@ -0,0 +1,91 @@
+package parquet
+
+import (
+	"context"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type records [][]interface{}
+
+func (r *records) Write(record []interface{}) error {
+	*r = append(*r, record)
+	return nil
+}
+
+func TestExport(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	server.Store.RangeLimit = 2
+	client := server.NewTableStoreClient()
+	meta := &tablestore.TableMeta{TableName: "orders"}
+	meta.AddPrimaryKeyColumn("user", tablestore.PrimaryKeyType_STRING)
+	meta.AddPrimaryKeyColumn("id", tablestore.PrimaryKeyType_INTEGER)
+	_, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		change := &tablestore.PutRowChange{TableName: "orders", PrimaryKey: new(tablestore.PrimaryKey)}
+		change.PrimaryKey.AddPrimaryKeyColumn("user", fmt.Sprintf("u%d", i%2))
+		change.PrimaryKey.AddPrimaryKeyColumn("id", int64(i))
+		change.AddColumn("total", float64(i))
+		change.AddColumn("ignored", "x")
+		if i != 3 {
+			change.AddColumn("paid", i%2 == 0)
+		}
+		change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: change}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	schema, err := NewSchema(client, "orders", Column{Name: "paid", Type: Boolean}, Column{Name: "total", Type: Double})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "message orders {\n  required binary user (UTF8);\n  required int64 id;\n  optional boolean paid;\n  optional double total;\n}\n"
+	if got := schema.String(); got != expect {
+		t.Errorf("schema:\n%s", got)
+	}
+	var r records
+	rows, err := Export(context.Background(), client, schema, &r)
+	if err != nil || rows != 5 {
+		t.Fatalf("export: %d %v", rows, err)
+	}
+	want := records{
+		{"u0", int64(0), true, 0.0},
+		{"u0", int64(2), true, 2.0},
+		{"u0", int64(4), true, 4.0},
+		{"u1", int64(1), false, 1.0},
+		{"u1", int64(3), nil, 3.0},
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("records: %v", r)
+	}
+
+	schema, err = NewSchema(client, "orders", Column{Name: "total", Type: Integer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Export(context.Background(), client, schema, new(records)); err == nil || !strings.Contains(err.Error(), "column total of row [u0 0] is a float64, not a int64") {
+		t.Errorf("expect type error: %v", err)
+	}
+	schema, err = NewSchema(client, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = nil
+	if rows, err := Export(context.Background(), client, schema, &r); err != nil || rows != 5 || !reflect.DeepEqual(r[4], []interface{}{"u1", int64(3)}) {
+		t.Errorf("export of the primary key: %v %v", r, err)
+	}
+	for _, columns := range [][]Column{{{Name: "id", Type: Integer}}, {{Name: "a"}, {Name: "a"}}, {{Name: "a", Type: Type(9)}}} {
+		if _, err := NewSchema(client, "orders", columns...); err == nil {
+			t.Errorf("expect error for %v", columns)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package tablestore
+
+import "fmt"
+
+// PrimaryKeyValue is the value of a primary key column, built by PKInt64,
+// PKString, PKBinary, PKAutoIncr, PKInfMin or PKInfMax, so that primary keys
+// of values the service does not support, which fail when the request is
+// serialized, do not compile:
+//
+//	pk := new(tablestore.PrimaryKey)
+//	pk.AddPrimaryKeyValue("user", tablestore.PKString("u1"))
+//	pk.AddPrimaryKeyValue("seq", tablestore.PKInt64(42))
+//
+// The zero value is invalid.
+type PrimaryKeyValue struct {
+	value  interface{}
+	option PrimaryKeyOption
+	valid  bool
+}
+
+func PKInt64(value int64) PrimaryKeyValue {
+	return PrimaryKeyValue{value: value, option: NONE, valid: true}
+}
+
+func PKString(value string) PrimaryKeyValue {
+	return PrimaryKeyValue{value: value, option: NONE, valid: true}
+}
+
+// PKBinary returns the binary value, value itself, which must not be
+// modified afterwards.
+func PKBinary(value []byte) PrimaryKeyValue {
+	if value == nil {
+		value = []byte{}
+	}
+	return PrimaryKeyValue{value: value, option: NONE, valid: true}
+}
+
+// PKAutoIncr returns the value of a column set by the service when the row is
+// written.
+func PKAutoIncr() PrimaryKeyValue {
+	return PrimaryKeyValue{option: AUTO_INCREMENT, valid: true}
+}
+
+// PKInfMin returns the value less than all the values, for the bounds of
+// range reads.
+func PKInfMin() PrimaryKeyValue {
+	return PrimaryKeyValue{option: MIN, valid: true}
+}
+
+// PKInfMax returns the value greater than all the values, for the bounds of
+// range reads.
+func PKInfMax() PrimaryKeyValue {
+	return PrimaryKeyValue{option: MAX, valid: true}
+}
+
+// NewPrimaryKeyValue returns the value of a PrimaryKeyColumn, an error if it
+// is not an int64, a string or a []byte.
+func NewPrimaryKeyValue(value interface{}) (PrimaryKeyValue, error) {
+	switch value := value.(type) {
+	case int64:
+		return PKInt64(value), nil
+	case string:
+		return PKString(value), nil
+	case []byte:
+		return PKBinary(value), nil
+	case PrimaryKeyValue:
+		if value.valid {
+			return value, nil
+		}
+	}
+	return PrimaryKeyValue{}, fmt.Errorf("[tablestore] invalid primary key value type %T", value)
+}
+
+// Option returns the option of the column of value, NONE for int64, string
+// and binary values.
+func (value PrimaryKeyValue) Option() PrimaryKeyOption {
+	return value.option
+}
+
+// Type returns the type of an int64, string or binary value, false for the
+// other values.
+func (value PrimaryKeyValue) Type() (PrimaryKeyType, bool) {
+	switch value.value.(type) {
+	case int64:
+		return PrimaryKeyType_INTEGER, true
+	case string:
+		return PrimaryKeyType_STRING, true
+	case []byte:
+		return PrimaryKeyType_BINARY, true
+	}
+	return 0, false
+}
+
+func (value PrimaryKeyValue) AsInt64() (int64, bool) {
+	v, ok := value.value.(int64)
+	return v, ok
+}
+
+func (value PrimaryKeyValue) AsString() (string, bool) {
+	v, ok := value.value.(string)
+	return v, ok
+}
+
+func (value PrimaryKeyValue) AsBinary() ([]byte, bool) {
+	v, ok := value.value.([]byte)
+	return v, ok
+}
+
+// Interface returns the value as the Value of a PrimaryKeyColumn, nil for
+// AUTO_INCREMENT, INF_MIN and INF_MAX.
+func (value PrimaryKeyValue) Interface() interface{} {
+	return value.value
+}
+
+func (value PrimaryKeyValue) String() string {
+	switch {
+	case !value.valid:
+		return "invalid"
+	case value.option == AUTO_INCREMENT:
+		return "auto-incr"
+	case value.option == MIN:
+		return "-inf"
+	case value.option == MAX:
+		return "+inf"
+	}
+	return fmt.Sprintf("%v", value.value)
+}
+
+// AddPrimaryKeyValue adds the column name of value. The invalid zero value is
+// added as is, reported by pk.Err and the requests sending pk.
+func (pk *PrimaryKey) AddPrimaryKeyValue(name string, value PrimaryKeyValue) {
+	if !value.valid {
+		pk.PrimaryKeys = append(pk.PrimaryKeys, &PrimaryKeyColumn{ColumnName: name, Value: value})
+		return
+	}
+	pk.PrimaryKeys = append(pk.PrimaryKeys, &PrimaryKeyColumn{ColumnName: name, Value: value.value, PrimaryKeyOption: value.option})
+}
+
+// PrimaryKeyValue returns the value of column, an error if its Value is not
+// an int64, a string or a []byte.
+func (column *PrimaryKeyColumn) PrimaryKeyValue() (PrimaryKeyValue, error) {
+	switch column.PrimaryKeyOption {
+	case AUTO_INCREMENT:
+		return PKAutoIncr(), nil
+	case MIN:
+		return PKInfMin(), nil
+	case MAX:
+		return PKInfMax(), nil
+	}
+	value, err := NewPrimaryKeyValue(column.Value)
+	if err != nil {
+		return value, fmt.Errorf("[tablestore] primary key column %s: invalid value type %T", column.ColumnName, column.Value)
+	}
+	return value, nil
+}
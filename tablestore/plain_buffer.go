@@ -4,8 +4,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"io"
 	"math"
+	"strings"
 )
 
 const (
@@ -96,57 +96,59 @@ func crc8Bytes(crc byte, in []byte) byte {
 	return crc
 }
 
-func writeRawByte(w io.Writer, value byte) {
-	w.Write([]byte{value})
+func crc8String(crc byte, in string) byte {
+	for i := 0; i < len(in); i++ {
+		crc = crc8Byte(crc, in[i])
+	}
+
+	return crc
 }
 
-/*func writeRawByteInt8(w io.Writer, value int) {
-	w.Write([]byte{byte(value)})
-}*/
+func writeRawByte(w *bytes.Buffer, value byte) {
+	w.WriteByte(value)
+}
 
-func writeRawLittleEndian32(w io.Writer, value int32) {
-	w.Write([]byte{byte((value) & 0xFF)})
-	w.Write([]byte{byte((value >> 8) & 0xFF)})
-	w.Write([]byte{byte((value >> 16) & 0xFF)})
-	w.Write([]byte{byte((value >> 24) & 0xFF)})
+func writeRawLittleEndian32(w *bytes.Buffer, value int32) {
+	var b [LITTLE_ENDIAN_32_SIZE]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(value))
+	w.Write(b[:])
 }
 
-func writeRawLittleEndian64(w io.Writer, value int64) {
-	w.Write([]byte{byte((value) & 0xFF)})
-	w.Write([]byte{byte((value >> 8) & 0xFF)})
-	w.Write([]byte{byte((value >> 16) & 0xFF)})
-	w.Write([]byte{byte((value >> 24) & 0xFF)})
-	w.Write([]byte{byte((value >> 32) & 0xFF)})
-	w.Write([]byte{byte((value >> 40) & 0xFF)})
-	w.Write([]byte{byte((value >> 48) & 0xFF)})
-	w.Write([]byte{byte((value >> 56) & 0xFF)})
+func writeRawLittleEndian64(w *bytes.Buffer, value int64) {
+	var b [LITTLE_ENDIAN_64_SIZE]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(value))
+	w.Write(b[:])
 }
 
-func writeDouble(w io.Writer, value float64) {
+func writeDouble(w *bytes.Buffer, value float64) {
 	writeRawLittleEndian64(w, int64(math.Float64bits(value)))
 }
 
-func writeBoolean(w io.Writer, value bool) {
+func writeBoolean(w *bytes.Buffer, value bool) {
 	if value {
-		w.Write([]byte{byte(1)})
+		w.WriteByte(1)
 	} else {
-		w.Write([]byte{byte(0)})
+		w.WriteByte(0)
 	}
 }
 
-func writeBytes(w io.Writer, value []byte) {
+func writeBytes(w *bytes.Buffer, value []byte) {
 	w.Write(value)
 }
 
-func writeHeader(w io.Writer) {
+func writeString(w *bytes.Buffer, value string) {
+	w.WriteString(value)
+}
+
+func writeHeader(w *bytes.Buffer) {
 	writeRawLittleEndian32(w, HEADER)
 }
 
-func writeTag(w io.Writer, tag byte) {
+func writeTag(w *bytes.Buffer, tag byte) {
 	writeRawByte(w, tag)
 }
 
-func writeCellName(w io.Writer, name []byte) {
+func writeCellName(w *bytes.Buffer, name []byte) {
 	writeTag(w, TAG_CELL_NAME)
 	writeRawLittleEndian32(w, int32(len(name)))
 	writeBytes(w, name)
@@ -160,12 +162,43 @@ type PlainBufferCell struct {
 	ignoreValue      bool
 	hasCellTimestamp bool
 	hasCellType      bool
+	// set by readCell for INF_MIN, INF_MAX and AUTO_INCREMENT values
+	pkOption PrimaryKeyOption
+	// interned cellName, set by readCell
+	name string
+	// checksum read by readCell
+	checksum byte
+}
+
+// infType returns the value type of the cells of INF_MIN, INF_MAX and
+// AUTO_INCREMENT primary key values, which have no value of their own.
+func (cell *PlainBufferCell) infType() (byte, bool) {
+	switch cell.pkOption {
+	case MIN:
+		return VT_INF_MIN, true
+	case MAX:
+		return VT_INF_MAX, true
+	case AUTO_INCREMENT:
+		return VT_AUTO_INCREMENT, true
+	}
+	return 0, false
 }
 
-func (cell *PlainBufferCell) writeCell(w io.Writer) {
+func (cell *PlainBufferCell) columnName() string {
+	if cell.name != "" {
+		return cell.name
+	}
+	return string(cell.cellName)
+}
+
+func (cell *PlainBufferCell) writeCell(w *bytes.Buffer) {
 	writeTag(w, TAG_CELL)
 	writeCellName(w, cell.cellName)
-	if cell.ignoreValue == false {
+	if vt, ok := cell.infType(); ok && cell.ignoreValue == false {
+		writeTag(w, TAG_CELL_VALUE)
+		writeRawLittleEndian32(w, 1)
+		writeRawByte(w, vt)
+	} else if cell.ignoreValue == false {
 		cell.cellValue.writeCellValue(w)
 	}
 
@@ -185,7 +218,9 @@ func (cell *PlainBufferCell) writeCell(w io.Writer) {
 
 func (cell *PlainBufferCell) getCheckSum(crc byte) byte {
 	crc = crc8Bytes(crc, cell.cellName)
-	if cell.ignoreValue == false {
+	if vt, ok := cell.infType(); ok && cell.ignoreValue == false {
+		crc = crc8Byte(crc, vt)
+	} else if cell.ignoreValue == false {
 		crc = cell.cellValue.getCheckSum(crc)
 	}
 
@@ -205,7 +240,7 @@ type PlainBufferRow struct {
 	extension       *RecordSequenceInfo // optional
 }
 
-func (row *PlainBufferRow) writeRow(w io.Writer) {
+func (row *PlainBufferRow) writeRow(w *bytes.Buffer) {
 	/* pk */
 	writeTag(w, TAG_ROW_PK)
 	for _, pk := range row.primaryKey {
@@ -223,7 +258,7 @@ func (row *PlainBufferRow) writeRow(w io.Writer) {
 	writeRawByte(w, row.getCheckSum(byte(0x0)))
 }
 
-func (row *PlainBufferRow) writeRowWithHeader(w io.Writer) {
+func (row *PlainBufferRow) writeRowWithHeader(w *bytes.Buffer) {
 	writeHeader(w)
 	row.writeRow(w)
 }
@@ -249,224 +284,614 @@ func (row *PlainBufferRow) getCheckSum(crc byte) byte {
 	return crc
 }
 
-func readRawByte(r *bytes.Reader) byte {
-	if r.Len() == 0 {
-		panic(errUnexpectIoEnd)
+// size returns the encoded size of the cell.
+func (cell *PlainBufferCell) size() int {
+	size := 1 + cellNameSize(len(cell.cellName)) + 2 // tag, name, checksum
+	if cell.ignoreValue == false {
+		size += 1 + cell.cellValue.size()
+	}
+	if cell.hasCellType {
+		size += 2
+	}
+	if cell.hasCellTimestamp {
+		size += 1 + LITTLE_ENDIAN_64_SIZE
+	}
+	return size
+}
+
+// size returns the encoded size of the row, without header.
+func (row *PlainBufferRow) size() int {
+	size := 1 + 2 // pk tag, checksum
+	for _, cell := range row.primaryKey {
+		size += cell.size()
+	}
+	if len(row.cells) > 0 {
+		size++
+		for _, cell := range row.cells {
+			size += cell.size()
+		}
+	}
+	return size
+}
+
+func cellNameSize(n int) int {
+	return 1 + LITTLE_ENDIAN_32_SIZE + n
+}
+
+// The functions below write rows straight from the public row types, without
+// building intermediate cells, into a buffer grown once to the row size.
+
+// newColumnValue is the allocation free counterpart of NewColumn. Values of
+// named string and []byte types are written as their underlying types, as
+// PutRowChange.Err accepts them.
+func newColumnValue(value interface{}) ColumnValue {
+	switch value.(type) {
+	case nil:
+		return ColumnValue{}
+	case string:
+		return ColumnValue{ColumnType_STRING, value}
+	case int64:
+		return ColumnValue{ColumnType_INTEGER, value}
+	case bool:
+		return ColumnValue{ColumnType_BOOLEAN, value}
+	case float64:
+		return ColumnValue{ColumnType_DOUBLE, value}
+	case []byte:
+		return ColumnValue{ColumnType_BINARY, value}
+	}
+	return plainColumnValue(value)
+}
+
+// plainColumnValue returns the value of the string or []byte underlying
+// value, panicking for the values of other types.
+func plainColumnValue(value interface{}) ColumnValue {
+	switch value := plainValue(value).(type) {
+	case string:
+		return ColumnValue{ColumnType_STRING, value}
+	case []byte:
+		return ColumnValue{ColumnType_BINARY, value}
+	}
+	panic(errInvalidInput)
+}
+
+// primaryKeyValue returns the value of a primary key column, false for
+// INF_MIN, INF_MAX and AUTO_INCREMENT.
+func primaryKeyValue(pkc *PrimaryKeyColumn) (ColumnValue, bool) {
+	if pkc.PrimaryKeyOption != NONE {
+		return ColumnValue{}, false
+	}
+	switch pkc.Value.(type) {
+	case string:
+		return ColumnValue{ColumnType_STRING, pkc.Value}, true
+	case int64:
+		return ColumnValue{ColumnType_INTEGER, pkc.Value}, true
+	case []byte:
+		return ColumnValue{ColumnType_BINARY, pkc.Value}, true
+	}
+	return plainColumnValue(pkc.Value), true
+}
+
+func primaryKeyCellSize(pkc *PrimaryKeyColumn) int {
+	size := LITTLE_ENDIAN_32_SIZE + 1
+	if value, ok := primaryKeyValue(pkc); ok {
+		size = value.size()
+	}
+	return 1 + cellNameSize(len(pkc.ColumnName)) + 1 + size + 2
+}
+
+// writePrimaryKeyCell writes a primary key column and returns its checksum.
+// Unless withInf is set, INF_MIN and INF_MAX are written as AUTO_INCREMENT
+// like in row changes.
+func writePrimaryKeyCell(w *bytes.Buffer, pkc *PrimaryKeyColumn, withInf bool) byte {
+	writeTag(w, TAG_CELL)
+	writeTag(w, TAG_CELL_NAME)
+	writeRawLittleEndian32(w, int32(len(pkc.ColumnName)))
+	writeString(w, pkc.ColumnName)
+	crc := crc8String(0, pkc.ColumnName)
+
+	if value, ok := primaryKeyValue(pkc); ok {
+		value.writeCellValue(w)
+		crc = value.getCheckSum(crc)
+	} else {
+		vt := byte(VT_AUTO_INCREMENT)
+		if withInf && pkc.PrimaryKeyOption == MIN {
+			vt = VT_INF_MIN
+		} else if withInf && pkc.PrimaryKeyOption == MAX {
+			vt = VT_INF_MAX
+		}
+		writeTag(w, TAG_CELL_VALUE)
+		writeRawLittleEndian32(w, 1)
+		writeRawByte(w, vt)
+		crc = crc8Byte(crc, vt)
+	}
+
+	writeTag(w, TAG_CELL_CHECKSUM)
+	writeRawByte(w, crc)
+	return crc
+}
+
+func columnToUpdateSize(column *ColumnToUpdate) int {
+	size := 1 + cellNameSize(len(column.ColumnName)) + 2
+	if column.IgnoreValue == false {
+		value := newColumnValue(column.Value)
+		size += 1 + value.size()
+	}
+	if column.HasType {
+		size += 2
+	}
+	if column.HasTimestamp {
+		size += 1 + LITTLE_ENDIAN_64_SIZE
+	}
+	return size
+}
+
+// writeColumnToUpdate writes a column of a row change and returns its
+// checksum.
+func writeColumnToUpdate(w *bytes.Buffer, column *ColumnToUpdate) byte {
+	writeTag(w, TAG_CELL)
+	writeTag(w, TAG_CELL_NAME)
+	writeRawLittleEndian32(w, int32(len(column.ColumnName)))
+	writeString(w, column.ColumnName)
+	crc := crc8String(0, column.ColumnName)
+
+	if column.IgnoreValue == false {
+		value := newColumnValue(column.Value)
+		value.writeCellValue(w)
+		crc = value.getCheckSum(crc)
+	}
+	if column.HasType {
+		writeTag(w, TAG_CELL_TYPE)
+		writeRawByte(w, column.Type)
+	}
+	if column.HasTimestamp {
+		writeTag(w, TAG_CELL_TIMESTAMP)
+		writeRawLittleEndian64(w, column.Timestamp)
+		crc = crc8Int64(crc, column.Timestamp)
+	}
+	if column.HasType {
+		crc = crc8Byte(crc, column.Type)
+	}
+
+	writeTag(w, TAG_CELL_CHECKSUM)
+	writeRawByte(w, crc)
+	return crc
+}
+
+// putColumn returns the column of a PutRowChange as a column to update.
+func putColumn(column *AttributeColumn) ColumnToUpdate {
+	return ColumnToUpdate{ColumnName: column.ColumnName, Value: column.Value, Timestamp: column.Timestamp, HasTimestamp: column.Timestamp != 0}
+}
+
+func primaryKeySize(pk *PrimaryKey) int {
+	size := LITTLE_ENDIAN_32_SIZE + 1 + 2 // header, pk tag, row checksum
+	for _, pkc := range pk.PrimaryKeys {
+		size += primaryKeyCellSize(pkc)
+	}
+	return size
+}
+
+// writePrimaryKey writes the header and the primary key of a row, and returns
+// the row checksum so far.
+func writePrimaryKey(w *bytes.Buffer, pk *PrimaryKey, withInf bool) byte {
+	writeHeader(w)
+	writeTag(w, TAG_ROW_PK)
+	crc := byte(0)
+	for _, pkc := range pk.PrimaryKeys {
+		crc = crc8Byte(crc, writePrimaryKeyCell(w, pkc, withInf))
+	}
+	return crc
+}
+
+func writeRowChecksum(w *bytes.Buffer, crc byte, isDelete bool) {
+	if isDelete {
+		writeTag(w, TAG_DELETE_ROW_MARKER)
+		crc = crc8Byte(crc, 1)
+	} else {
+		crc = crc8Byte(crc, 0)
 	}
+	writeTag(w, TAG_ROW_CHECKSUM)
+	writeRawByte(w, crc)
+}
 
-	b, _ := r.ReadByte()
+// PlainBufferError is returned for a malformed plainbuffer, e.g. a truncated
+// or corrupted response. Offset is the position of the faulty field.
+type PlainBufferError struct {
+	Offset int
+	Err    error
+}
 
-	return b
+func (e *PlainBufferError) Error() string {
+	return fmt.Sprintf("[tablestore] malformed plainbuffer at offset %d: %s", e.Offset, strings.TrimPrefix(e.Err.Error(), "[tablestore] "))
 }
 
-func readTag(r *bytes.Reader) int {
-	return int(readRawByte(r))
+func (e *PlainBufferError) Unwrap() error {
+	return e.Err
 }
 
-func readRawLittleEndian64(r *bytes.Reader) int64 {
-	if r.Len() < 8 {
-		panic(errUnexpectIoEnd)
+// plainBufferReader decodes rows one at a time. Every read is bounds checked,
+// so malformed input returns a *PlainBufferError instead of panicking.
+type plainBufferReader struct {
+	data       []byte
+	offset     int
+	names      interner
+	checksum   ChecksumMode
+	onMismatch func(err error)
+}
+
+// maximum number of column names interned by an interner
+const maxInternedNames = 1024
+
+// interner shares the strings of the column names read, the rows of a
+// response mostly having the same few columns.
+type interner map[string]string
+
+func (names interner) intern(name []byte) string {
+	if s, ok := names[string(name)]; ok {
+		return s
 	}
+	s := string(name)
+	if len(names) < maxInternedNames {
+		names[s] = s
+	}
+	return s
+}
 
-	var v int64
-	binary.Read(r, binary.LittleEndian, &v)
+func newPlainBufferReader(data []byte) *plainBufferReader {
+	return &plainBufferReader{data: data, names: make(interner)}
+}
+
+func (r *plainBufferReader) error(offset int, err error) error {
+	return &PlainBufferError{Offset: offset, Err: err}
+}
 
-	return v
+func (r *plainBufferReader) remaining() int {
+	return len(r.data) - r.offset
 }
 
-func readRawLittleEndian32(r *bytes.Reader) int32 {
-	if r.Len() < 4 {
-		panic(errUnexpectIoEnd)
+func (r *plainBufferReader) readRawByte() (byte, error) {
+	if r.remaining() < 1 {
+		return 0, r.error(r.offset, errUnexpectIoEnd)
 	}
+	b := r.data[r.offset]
+	r.offset++
+	return b, nil
+}
 
-	var v int32
-	binary.Read(r, binary.LittleEndian, &v)
+// peekTag returns the next tag without consuming it, -1 at the end.
+func (r *plainBufferReader) peekTag() int {
+	if r.remaining() < 1 {
+		return -1
+	}
+	return int(r.data[r.offset])
+}
 
-	return v
+func (r *plainBufferReader) expectTag(tag int, err error) error {
+	if r.peekTag() != tag {
+		return r.error(r.offset, err)
+	}
+	r.offset++
+	return nil
 }
 
-func readBoolean(r *bytes.Reader) bool {
-	return readRawByte(r) != 0
+func (r *plainBufferReader) readRawLittleEndian32() (int32, error) {
+	if r.remaining() < LITTLE_ENDIAN_32_SIZE {
+		return 0, r.error(r.offset, errUnexpectIoEnd)
+	}
+	v := int32(binary.LittleEndian.Uint32(r.data[r.offset:]))
+	r.offset += LITTLE_ENDIAN_32_SIZE
+	return v, nil
+}
+
+func (r *plainBufferReader) readRawLittleEndian64() (int64, error) {
+	if r.remaining() < LITTLE_ENDIAN_64_SIZE {
+		return 0, r.error(r.offset, errUnexpectIoEnd)
+	}
+	v := int64(binary.LittleEndian.Uint64(r.data[r.offset:]))
+	r.offset += LITTLE_ENDIAN_64_SIZE
+	return v, nil
 }
 
-func readBytes(r *bytes.Reader, size int32) []byte {
-	if int32(r.Len()) < size {
-		panic(errUnexpectIoEnd)
+// readBytes reads a length prefixed byte string.
+func (r *plainBufferReader) readBytes() ([]byte, error) {
+	offset := r.offset
+	size, err := r.readRawLittleEndian32()
+	if err != nil {
+		return nil, err
+	}
+	if size < 0 {
+		return nil, r.error(offset, errInvalidLength)
+	}
+	if int(size) > r.remaining() {
+		return nil, r.error(offset, errUnexpectIoEnd)
 	}
 	v := make([]byte, size)
-	r.Read(v)
-	return v
+	copy(v, r.data[r.offset:])
+	r.offset += int(size)
+	return v, nil
+}
+
+func (r *plainBufferReader) readHeader() error {
+	header, err := r.readRawLittleEndian32()
+	if err != nil {
+		return err
+	}
+	if header != HEADER {
+		return r.error(0, errInvalidHeader)
+	}
+	return nil
 }
 
-func readCellValue(r *bytes.Reader) *ColumnValue {
+func (r *plainBufferReader) more() bool {
+	return r.remaining() > 0
+}
+
+// readCellValue reads a value with its length prefix.
+func (r *plainBufferReader) readCellValue() (*ColumnValue, byte, error) {
+	offset := r.offset
+	size, err := r.readRawLittleEndian32()
+	if err != nil {
+		return nil, 0, err
+	}
+	if size < 1 {
+		return nil, 0, r.error(offset, errInvalidLength)
+	}
+	if int(size) > r.remaining() {
+		return nil, 0, r.error(offset, errUnexpectIoEnd)
+	}
+
 	value := new(ColumnValue)
-	readRawLittleEndian32(r)
-	tp := readRawByte(r)
+	typeOffset := r.offset
+	tp, err := r.readRawByte()
+	if err != nil {
+		return nil, 0, err
+	}
 	switch tp {
 	case VT_INTEGER:
 		value.Type = ColumnType_INTEGER
-		value.Value = readRawLittleEndian64(r)
+		var v int64
+		v, err = r.readRawLittleEndian64()
+		value.Value = v
 	case VT_DOUBLE:
 		value.Type = ColumnType_DOUBLE
-		value.Value = math.Float64frombits(uint64(readRawLittleEndian64(r)))
+		var v int64
+		v, err = r.readRawLittleEndian64()
+		value.Value = math.Float64frombits(uint64(v))
 	case VT_BOOLEAN:
 		value.Type = ColumnType_BOOLEAN
-		value.Value = readBoolean(r)
+		var b byte
+		b, err = r.readRawByte()
+		value.Value = b != 0
 	case VT_STRING:
 		value.Type = ColumnType_STRING
-		value.Value = string(readBytes(r, readRawLittleEndian32(r)))
+		var v []byte
+		v, err = r.readBytes()
+		value.Value = string(v)
 	case VT_BLOB:
 		value.Type = ColumnType_BINARY
-		value.Value = []byte(readBytes(r, readRawLittleEndian32(r)))
+		var v []byte
+		v, err = r.readBytes()
+		value.Value = v
+	case VT_INF_MIN, VT_INF_MAX, VT_AUTO_INCREMENT:
+	default:
+		return nil, 0, r.error(typeOffset, errInvalidValueType)
+	}
+	if err != nil {
+		return nil, 0, err
 	}
-	return value
+	return value, tp, nil
 }
 
-func readCell(r *bytes.Reader) *PlainBufferCell {
+// readCell reads a cell after its TAG_CELL. Primary key cells must have a
+// value.
+func (r *plainBufferReader) readCell(isPk bool) (*PlainBufferCell, error) {
 	cell := new(PlainBufferCell)
-	tag := readTag(r)
-	if tag != TAG_CELL_NAME {
-		panic(errTag)
-	}
-
-	cell.cellName = readBytes(r, readRawLittleEndian32(r))
-	tag = readTag(r)
-
-	if tag == TAG_CELL_VALUE {
-		cell.cellValue = readCellValue(r)
-		tag = readTag(r)
+	if err := r.expectTag(TAG_CELL_NAME, errTag); err != nil {
+		return nil, err
 	}
-	if tag == TAG_CELL_TYPE {
-		readRawByte(r)
-		tag = readTag(r)
+	var err error
+	if cell.cellName, err = r.readBytes(); err != nil {
+		return nil, err
 	}
+	cell.name = r.names.intern(cell.cellName)
 
-	if tag == TAG_CELL_TIMESTAMP {
-		cell.cellTimestamp = readRawLittleEndian64(r)
-		tag = readTag(r)
-	}
-
-	if tag == TAG_CELL_CHECKSUM {
-		readRawByte(r)
+	if r.peekTag() == TAG_CELL_VALUE {
+		r.offset++
+		var tp byte
+		if cell.cellValue, tp, err = r.readCellValue(); err != nil {
+			return nil, err
+		}
+		switch tp {
+		case VT_INF_MIN:
+			cell.pkOption = MIN
+		case VT_INF_MAX:
+			cell.pkOption = MAX
+		case VT_AUTO_INCREMENT:
+			cell.pkOption = AUTO_INCREMENT
+		}
+	} else if isPk {
+		return nil, r.error(r.offset, errTag)
 	} else {
-		panic(errNoChecksum)
+		cell.ignoreValue = true
 	}
 
-	return cell
-}
-
-func readRowPk(r *bytes.Reader) []*PlainBufferCell {
-	primaryKeyColumns := make([]*PlainBufferCell, 0, 4)
-	if readTag(r) != TAG_ROW_PK {
-		panic(errTag)
+	if r.peekTag() == TAG_CELL_TYPE {
+		r.offset++
+		if cell.cellType, err = r.readRawByte(); err != nil {
+			return nil, err
+		}
+		cell.hasCellType = true
 	}
 
-	tag := readTag(r)
-	for tag == TAG_CELL {
-		primaryKeyColumns = append(primaryKeyColumns, readCell(r))
-		tag = readTag(r)
+	if r.peekTag() == TAG_CELL_TIMESTAMP {
+		r.offset++
+		if cell.cellTimestamp, err = r.readRawLittleEndian64(); err != nil {
+			return nil, err
+		}
+		cell.hasCellTimestamp = true
 	}
 
-	r.Seek(-1, 1)
-
-	return primaryKeyColumns
+	if err := r.expectTag(TAG_CELL_CHECKSUM, errNoChecksum); err != nil {
+		return nil, err
+	}
+	offset := r.offset
+	if cell.checksum, err = r.readRawByte(); err != nil {
+		return nil, err
+	}
+	if r.checksum != ChecksumNone {
+		if err := r.verify(offset, cell.name, cell.getCheckSum(0), cell.checksum); err != nil {
+			return nil, err
+		}
+	}
+	return cell, nil
 }
 
-func readRowData(r *bytes.Reader) []*PlainBufferCell {
-	columns := make([]*PlainBufferCell, 0, 10)
-
-	tag := readTag(r)
-	for tag == TAG_CELL {
-		columns = append(columns, readCell(r))
-		tag = readTag(r)
+func (r *plainBufferReader) readCells(isPk bool) ([]*PlainBufferCell, error) {
+	var cells []*PlainBufferCell
+	for r.peekTag() == TAG_CELL {
+		r.offset++
+		cell, err := r.readCell(isPk)
+		if err != nil {
+			return nil, err
+		}
+		cells = append(cells, cell)
 	}
-
-	r.Seek(-1, 1)
-
-	return columns
+	return cells, nil
 }
 
-func readRow(r *bytes.Reader) *PlainBufferRow {
+// readRow reads the next row.
+func (r *plainBufferReader) readRow() (*PlainBufferRow, error) {
 	row := new(PlainBufferRow)
-	row.primaryKey = readRowPk(r)
-	tag := readTag(r)
+	if err := r.expectTag(TAG_ROW_PK, errTag); err != nil {
+		return nil, err
+	}
+	var err error
+	if row.primaryKey, err = r.readCells(true); err != nil {
+		return nil, err
+	}
 
-	if tag == TAG_ROW_DATA {
-		row.cells = readRowData(r)
-		tag = readTag(r)
+	if r.peekTag() == TAG_ROW_DATA {
+		r.offset++
+		if row.cells, err = r.readCells(false); err != nil {
+			return nil, err
+		}
 	}
 
-	if tag == TAG_DELETE_ROW_MARKER {
+	if r.peekTag() == TAG_DELETE_ROW_MARKER {
+		r.offset++
 		row.hasDeleteMarker = true
-		tag = readTag(r)
 	}
 
-	if tag == TAG_EXTENSION {
-		row.extension = readRowExtension(r)
-		tag = readTag(r)
+	if r.peekTag() == TAG_EXTENSION {
+		r.offset++
+		if row.extension, err = r.readRowExtension(); err != nil {
+			return nil, err
+		}
 	}
 
-	if tag == TAG_ROW_CHECKSUM {
-		readRawByte(r)
-	} else {
-		panic(errNoChecksum)
+	if err := r.expectTag(TAG_ROW_CHECKSUM, errNoChecksum); err != nil {
+		return nil, err
 	}
-	return row
-}
-
-func readRowsWithHeader(r *bytes.Reader) (rows []*PlainBufferRow, err error) {
-	defer func() {
-		if err2 := recover(); err2 != nil {
-			if _, ok := err2.(error); ok {
-				err = err2.(error)
-			}
-			return
+	offset := r.offset
+	checksum, err := r.readRawByte()
+	if err != nil {
+		return nil, err
+	}
+	if r.checksum != ChecksumNone {
+		// the checksum of a row is computed from those of its cells
+		crc := byte(0)
+		for _, cell := range row.primaryKey {
+			crc = crc8Byte(crc, cell.checksum)
+		}
+		for _, cell := range row.cells {
+			crc = crc8Byte(crc, cell.checksum)
+		}
+		if row.hasDeleteMarker {
+			crc = crc8Byte(crc, 1)
+		} else {
+			crc = crc8Byte(crc, 0)
+		}
+		if err := r.verify(offset, "", crc, checksum); err != nil {
+			return nil, err
 		}
-	}()
+	}
+	return row, nil
+}
 
-	// TODO: panic
-	if readRawLittleEndian32(r) != HEADER {
-		return nil, fmt.Errorf("Invalid header from plain buffer")
+func (r *plainBufferReader) readRowExtension() (*RecordSequenceInfo, error) {
+	if _, err := r.readRawLittleEndian32(); err != nil { // useless
+		return nil, err
+	}
+	if err := r.expectTag(TAG_SEQ_INFO, errTag); err != nil {
+		return nil, err
+	}
+	if _, err := r.readRawLittleEndian32(); err != nil { // useless
+		return nil, err
 	}
 
-	rows = make([]*PlainBufferRow, 0, 10)
+	ext := new(RecordSequenceInfo)
+	var err error
+	if err = r.expectTag(TAG_SEQ_INFO_EPOCH, errTag); err != nil {
+		return nil, err
+	}
+	if ext.Epoch, err = r.readRawLittleEndian32(); err != nil {
+		return nil, err
+	}
+	if err = r.expectTag(TAG_SEQ_INFO_TS, errTag); err != nil {
+		return nil, err
+	}
+	if ext.Timestamp, err = r.readRawLittleEndian64(); err != nil {
+		return nil, err
+	}
+	if err = r.expectTag(TAG_SEQ_INFO_ROW_INDEX, errTag); err != nil {
+		return nil, err
+	}
+	if ext.RowIndex, err = r.readRawLittleEndian32(); err != nil {
+		return nil, err
+	}
+	return ext, nil
+}
 
-	for r.Len() > 0 {
-		rows = append(rows, readRow(r))
+func readRowsWithHeader(data []byte) ([]*PlainBufferRow, error) {
+	r := newPlainBufferReader(data)
+	if err := r.readHeader(); err != nil {
+		return nil, err
 	}
 
+	rows := make([]*PlainBufferRow, 0, 10)
+	for r.more() {
+		row, err := r.readRow()
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
 	return rows, nil
 }
 
-func readRowExtension(r *bytes.Reader) *RecordSequenceInfo {
-	readRawLittleEndian32(r) // useless
-	tag := readTag(r)
-	if tag != TAG_SEQ_INFO {
-		panic(errTag)
-	}
+// readRowWithHeader reads a plainbuffer holding exactly one row.
+func readRowWithHeader(data []byte) (*PlainBufferRow, error) {
+	return newPlainBufferReader(data).readSingleRow()
+}
 
-	readRawLittleEndian32(r) // useless
-	tag = readTag(r)
-	if tag != TAG_SEQ_INFO_EPOCH {
-		panic(errTag)
+// readSingleRow reads the header and the only row of the data of r.
+func (r *plainBufferReader) readSingleRow() (*PlainBufferRow, error) {
+	if err := r.readHeader(); err != nil {
+		return nil, err
 	}
-	epoch := readRawLittleEndian32(r)
-
-	tag = readTag(r)
-	if tag != TAG_SEQ_INFO_TS {
-		panic(errTag)
+	row, err := r.readRow()
+	if err != nil {
+		return nil, err
 	}
-	ts := readRawLittleEndian64(r)
-
-	tag = readTag(r)
-	if tag != TAG_SEQ_INFO_ROW_INDEX {
-		panic(errTag)
+	if r.more() {
+		return nil, r.error(r.offset, errTrailingData)
 	}
-	rowIndex := readRawLittleEndian32(r)
+	return row, nil
+}
 
-	ext := RecordSequenceInfo{}
-	ext.Epoch = epoch
-	ext.Timestamp = ts
-	ext.RowIndex = rowIndex
-	return &ext
+// value returns the value of a cell, nil if it has none.
+func (cell *PlainBufferCell) value() interface{} {
+	if cell.cellValue == nil {
+		return nil
+	}
+	return cell.cellValue.Value
 }
@@ -0,0 +1,99 @@
+package tablestore
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// The functions below expose the plainbuffer row format for server side
+// implementations of the protocol, such as the emulator in tablestoretest.
+
+func cellsToPrimaryKey(cells []*PlainBufferCell) *PrimaryKey {
+	pk := new(PrimaryKey)
+	for _, cell := range cells {
+		pkc := &PrimaryKeyColumn{ColumnName: cell.columnName(), PrimaryKeyOption: cell.pkOption}
+		if cell.pkOption == NONE {
+			pkc.Value = cell.value()
+		}
+		pk.PrimaryKeys = append(pk.PrimaryKeys, pkc)
+	}
+	return pk
+}
+
+// DecodePrimaryKey decodes a primary key in plainbuffer format, e.g. the start
+// and end keys of a GetRange request. INF_MIN, INF_MAX and AUTO_INCREMENT
+// values are returned as the MIN, MAX and AUTO_INCREMENT options.
+func DecodePrimaryKey(data []byte) (*PrimaryKey, error) {
+	row, err := readRowWithHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	return cellsToPrimaryKey(row.primaryKey), nil
+}
+
+// DecodeRowChange decodes a row in plainbuffer format as sent by PutRow,
+// UpdateRow, DeleteRow and BatchWriteRow. isDelete reports whether the row
+// carries a delete marker.
+func DecodeRowChange(data []byte) (pk *PrimaryKey, columns []ColumnToUpdate, isDelete bool, err error) {
+	row, err := readRowWithHeader(data)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	for _, cell := range row.cells {
+		column := ColumnToUpdate{
+			ColumnName:   cell.columnName(),
+			Type:         cell.cellType,
+			HasType:      cell.hasCellType,
+			Timestamp:    cell.cellTimestamp,
+			HasTimestamp: cell.hasCellTimestamp,
+			IgnoreValue:  cell.ignoreValue,
+		}
+		column.Value = cell.value()
+		columns = append(columns, column)
+	}
+	return cellsToPrimaryKey(row.primaryKey), columns, row.hasDeleteMarker, nil
+}
+
+// EncodeRows encodes rows in plainbuffer format as returned by GetRow,
+// BatchGetRow and GetRange. Columns with a zero timestamp are written without
+// timestamp. It returns nil if there is no row.
+func EncodeRows(rows []*Row) []byte {
+	if len(rows) == 0 {
+		return nil
+	}
+	var b bytes.Buffer
+	writeHeader(&b)
+	for _, row := range rows {
+		pbRow := new(PlainBufferRow)
+		for _, pkc := range row.PrimaryKey.PrimaryKeys {
+			pbRow.primaryKey = append(pbRow.primaryKey, NewPrimaryKeyColumn([]byte(pkc.ColumnName), pkc.Value, pkc.PrimaryKeyOption).toPlainBufferCell())
+		}
+		for _, column := range row.Columns {
+			c := NewColumn([]byte(column.ColumnName), column.Value)
+			if column.Timestamp != 0 {
+				c.HasTimestamp = true
+				c.Timestamp = column.Timestamp
+			}
+			pbRow.cells = append(pbRow.cells, c.toPlainBufferCell(false))
+		}
+		pbRow.writeRow(&b)
+	}
+	return b.Bytes()
+}
+
+// DecodeFilterValue decodes a column value without length prefix, i.e. the
+// column value of a SingleColumnValueFilter.
+func DecodeFilterValue(data []byte) (interface{}, error) {
+	prefixed := make([]byte, LITTLE_ENDIAN_32_SIZE, LITTLE_ENDIAN_32_SIZE+len(data))
+	binary.LittleEndian.PutUint32(prefixed, uint32(len(data)))
+	r := newPlainBufferReader(append(prefixed, data...))
+	cv, _, err := r.readCellValue()
+	if err != nil {
+		return nil, err
+	}
+	if cv.Value == nil || r.more() {
+		return nil, errInvalidInput
+	}
+	return cv.Value, nil
+}
@@ -0,0 +1,102 @@
+//go:build go1.18
+// +build go1.18
+
+package tablestore
+
+import (
+	"testing"
+)
+
+func plainBufferSeeds() [][]byte {
+	putRowChange := new(PutRowChange)
+	putRowChange.TableName = "fuzz"
+	putPk := new(PrimaryKey)
+	putPk.AddPrimaryKeyColumn("pk1", "key")
+	putPk.AddPrimaryKeyColumn("pk2", int64(42))
+	putRowChange.PrimaryKey = putPk
+	putRowChange.AddColumn("string", "value")
+	putRowChange.AddColumn("double", 3.14)
+	putRowChange.AddColumn("bool", true)
+	putRowChange.AddColumnWithTimestamp("blob", []byte{0, 1, 2}, 1500000000000)
+
+	updateRowChange := new(UpdateRowChange)
+	updateRowChange.TableName = "fuzz"
+	updateRowChange.PrimaryKey = putPk
+	updateRowChange.PutColumn("col", int64(1))
+	updateRowChange.DeleteColumn("deleted")
+	updateRowChange.DeleteColumnWithTimestamp("version", 1500000000000)
+
+	deleteRowChange := new(DeleteRowChange)
+	deleteRowChange.TableName = "fuzz"
+	deleteRowChange.PrimaryKey = putPk
+
+	rangePk := new(PrimaryKey)
+	rangePk.AddPrimaryKeyColumnWithMinValue("pk1")
+	rangePk.AddPrimaryKeyColumnWithMaxValue("pk2")
+
+	rows := EncodeRows([]*Row{
+		{PrimaryKey: putPk, Columns: []*AttributeColumn{{ColumnName: "col", Value: "a", Timestamp: 1500000000000}}},
+		{PrimaryKey: putPk},
+	})
+
+	return [][]byte{
+		putRowChange.Serialize(),
+		updateRowChange.Serialize(),
+		deleteRowChange.Serialize(),
+		rangePk.Build(false),
+		rows,
+	}
+}
+
+func FuzzReadRowsWithHeader(f *testing.F) {
+	for _, seed := range plainBufferSeeds() {
+		// truncated and corrupted copies of each seed
+		for i := 0; i <= len(seed); i++ {
+			f.Add(seed[:i])
+		}
+		for i := range seed {
+			corrupted := append([]byte(nil), seed...)
+			corrupted[i] ^= 0xff
+			f.Add(corrupted)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		rows, err := readRowsWithHeader(data)
+		if err != nil {
+			if _, ok := err.(*PlainBufferError); !ok {
+				t.Fatalf("unexpected error type %T: %s", err, err)
+			}
+			return
+		}
+		for _, row := range rows {
+			for _, pk := range row.primaryKey {
+				if pk.cellValue == nil {
+					t.Fatalf("primary key %q without value", pk.cellName)
+				}
+			}
+		}
+		if _, err := readRowWithHeader(data); err == nil && len(rows) != 1 {
+			t.Fatalf("readRowWithHeader accepted %d rows", len(rows))
+		}
+	})
+}
+
+func FuzzDecodeFilterValue(f *testing.F) {
+	for _, value := range []interface{}{"value", int64(-1), 2.5, false, []byte{0xff}} {
+		data := NewColumn([]byte("col"), value).toPlainBufferCell(false).cellValue.writeCellValueWithoutLengthPrefix()
+		f.Add(data)
+		f.Add(data[:len(data)-1])
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		value, err := DecodeFilterValue(data)
+		if err != nil {
+			return
+		}
+		encoded := NewColumn([]byte("col"), value).toPlainBufferCell(false).cellValue.writeCellValueWithoutLengthPrefix()
+		if _, err := DecodeFilterValue(encoded); err != nil {
+			t.Fatalf("decoded %v from %x, encoded back to invalid %x: %s", value, data, encoded, err)
+		}
+	})
+}
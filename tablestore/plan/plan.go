@@ -0,0 +1,483 @@
+// Package plan reads the rows of a table matching a filter by the cheapest
+// access path: a range of the table or of one of its secondary indexes of
+// which the filter fixes leading primary key columns, a search index holding
+// all the columns of the filter, or a scan of the table.
+//
+//	planner, err := plan.New(client, "orders")
+//	filter := plan.Filter{plan.Equal("user", "u1"), plan.GreaterEqual("created", int64(1500000000000))}
+//	rows, err := planner.Query(filter, 100)
+package plan
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/search"
+	"strings"
+)
+
+type Op int
+
+const (
+	OpEqual Op = iota
+	OpLess
+	OpLessEqual
+	OpGreater
+	OpGreaterEqual
+)
+
+func (op Op) String() string {
+	return [...]string{"=", "<", "<=", ">", ">="}[op]
+}
+
+// Condition compares a column, of the primary key or not, with a value.
+type Condition struct {
+	Column string
+	Op     Op
+	Value  interface{}
+}
+
+func Equal(column string, value interface{}) Condition {
+	return Condition{Column: column, Op: OpEqual, Value: value}
+}
+
+func Less(column string, value interface{}) Condition {
+	return Condition{Column: column, Op: OpLess, Value: value}
+}
+
+func LessEqual(column string, value interface{}) Condition {
+	return Condition{Column: column, Op: OpLessEqual, Value: value}
+}
+
+func Greater(column string, value interface{}) Condition {
+	return Condition{Column: column, Op: OpGreater, Value: value}
+}
+
+func GreaterEqual(column string, value interface{}) Condition {
+	return Condition{Column: column, Op: OpGreaterEqual, Value: value}
+}
+
+// Filter matches the rows matching all its conditions.
+type Filter []Condition
+
+type Kind int
+
+const (
+	// a range of the table
+	TableRange Kind = iota
+	// a range of a secondary index holding all the columns of the filter,
+	// whose rows only have the columns of the index
+	IndexRange
+	// a search of a search index
+	SearchIndex
+	// all the rows of the table
+	TableScan
+)
+
+func (kind Kind) String() string {
+	return [...]string{"table range", "index range", "search index", "table scan"}[kind]
+}
+
+// Plan is the access path chosen for a filter.
+type Plan struct {
+	Kind Kind
+	// table read, of the index for IndexRange
+	TableName string
+	// search index, for SearchIndex
+	IndexName string
+	// primary key columns fixed by the filter, for TableRange and IndexRange
+	Prefix int
+	filter Filter
+	// primary key columns of the table read
+	primaryKey []string
+}
+
+func (plan *Plan) String() string {
+	switch plan.Kind {
+	case TableRange, IndexRange:
+		return fmt.Sprintf("%s %s on %s", plan.Kind, plan.TableName, strings.Join(plan.primaryKey[:plan.Prefix], ", "))
+	case SearchIndex:
+		return fmt.Sprintf("%s %s", plan.Kind, plan.IndexName)
+	}
+	return fmt.Sprintf("%s %s", plan.Kind, plan.TableName)
+}
+
+// Planner chooses the plans of the filters of a table, knowing its indexes.
+type Planner struct {
+	client        tablestore.TableStoreApi
+	table         string
+	paths         []path
+	searchIndexes []searchIndex
+}
+
+type path struct {
+	kind       Kind
+	table      string
+	primaryKey []string
+	// columns of the rows of an index, nil for the table
+	columns map[string]bool
+}
+
+type searchIndex struct {
+	name   string
+	fields map[string]bool
+}
+
+// New describes the table, its secondary indexes and its search indexes.
+func New(client tablestore.TableStoreApi, table string) (*Planner, error) {
+	described, err := client.DescribeTable(&tablestore.DescribeTableRequest{TableName: table})
+	if err != nil {
+		return nil, err
+	}
+	planner := &Planner{client: client, table: table}
+	base := path{kind: TableRange, table: table}
+	for _, column := range described.TableMeta.SchemaEntry {
+		base.primaryKey = append(base.primaryKey, *column.Name)
+	}
+	planner.paths = append(planner.paths, base)
+	for _, index := range described.IndexMetas {
+		p := path{kind: IndexRange, table: index.IndexName, primaryKey: index.Primarykey, columns: make(map[string]bool)}
+		for _, column := range append(append([]string{}, index.Primarykey...), index.DefinedColumns...) {
+			p.columns[column] = true
+		}
+		planner.paths = append(planner.paths, p)
+	}
+
+	indexes, err := client.ListSearchIndex(&tablestore.ListSearchIndexRequest{TableName: table})
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range indexes.IndexInfo {
+		resp, err := client.DescribeSearchIndex(&tablestore.DescribeSearchIndexRequest{TableName: table, IndexName: info.IndexName})
+		if err != nil {
+			return nil, err
+		}
+		index := searchIndex{name: info.IndexName, fields: make(map[string]bool)}
+		if resp.Schema != nil {
+			for _, field := range resp.Schema.FieldSchemas {
+				if field.FieldName != nil && (field.Index == nil || *field.Index) {
+					index.fields[*field.FieldName] = true
+				}
+			}
+		}
+		planner.searchIndexes = append(planner.searchIndexes, index)
+	}
+	return planner, nil
+}
+
+// Plan returns the cheapest plan of filter: the range of the table or of an
+// index holding all the columns of filter of which the filter fixes the most
+// leading primary key columns, the table first, or a search index holding all
+// the columns of filter, or a scan of the table.
+func (planner *Planner) Plan(filter Filter) (*Plan, error) {
+	for _, condition := range filter {
+		if condition.Op < OpEqual || condition.Op > OpGreaterEqual {
+			return nil, fmt.Errorf("[tablestore] unknown operator %d of column %s", condition.Op, condition.Column)
+		}
+	}
+	best := &Plan{Kind: TableScan, TableName: planner.table, filter: filter, primaryKey: planner.paths[0].primaryKey}
+	for _, p := range planner.paths {
+		if p.columns != nil && !covers(p.columns, filter) {
+			continue
+		}
+		if prefix := fixedPrefix(p.primaryKey, filter); prefix > best.Prefix {
+			best = &Plan{Kind: p.kind, TableName: p.table, Prefix: prefix, filter: filter, primaryKey: p.primaryKey}
+		}
+	}
+	if best.Kind != TableScan {
+		return best, nil
+	}
+	for _, index := range planner.searchIndexes {
+		if len(filter) > 0 && covers(index.fields, filter) {
+			return &Plan{Kind: SearchIndex, TableName: planner.table, IndexName: index.name, filter: filter}, nil
+		}
+	}
+	return best, nil
+}
+
+// fixedPrefix returns the leading columns of primaryKey read as a range by
+// filter, the columns it is equal to, and then a column it bounds.
+func fixedPrefix(primaryKey []string, filter Filter) int {
+	prefix := 0
+	for _, column := range primaryKey {
+		equal, bounded := false, false
+		for _, condition := range filter {
+			if condition.Column == column {
+				equal = equal || condition.Op == OpEqual
+				bounded = true
+			}
+		}
+		if equal {
+			prefix++
+			continue
+		}
+		if bounded {
+			prefix++
+		}
+		break
+	}
+	return prefix
+}
+
+func covers(columns map[string]bool, filter Filter) bool {
+	for _, condition := range filter {
+		if !columns[condition.Column] {
+			return false
+		}
+	}
+	return true
+}
+
+// Query returns up to limit rows matching filter, all of them if limit is 0,
+// read by the plan of filter. The rows are checked against the whole filter.
+func (planner *Planner) Query(filter Filter, limit int) ([]*tablestore.Row, error) {
+	plan, err := planner.Plan(filter)
+	if err != nil {
+		return nil, err
+	}
+	return planner.Execute(plan, limit)
+}
+
+// Execute returns up to limit rows matching the filter of plan, all of them
+// if limit is 0.
+func (planner *Planner) Execute(plan *Plan, limit int) ([]*tablestore.Row, error) {
+	if plan.Kind == SearchIndex {
+		return planner.search(plan, limit)
+	}
+	criteria := &tablestore.RangeRowQueryCriteria{TableName: plan.TableName, Direction: tablestore.FORWARD, MaxVersion: 1}
+	criteria.StartPrimaryKey, criteria.EndPrimaryKey = bounds(plan.primaryKey, plan.Prefix, plan.filter)
+	var rows []*tablestore.Row
+	for {
+		resp, err := planner.client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: criteria})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range resp.Rows {
+			if plan.filter.Match(row) {
+				rows = append(rows, row)
+				if len(rows) == limit {
+					return rows, nil
+				}
+			}
+		}
+		if resp.NextStartPrimaryKey == nil {
+			return rows, nil
+		}
+		criteria.StartPrimaryKey = resp.NextStartPrimaryKey
+	}
+}
+
+// bounds returns the range of the prefix of primaryKey read by filter.
+func bounds(primaryKey []string, prefix int, filter Filter) (start, end *tablestore.PrimaryKey) {
+	start, end = new(tablestore.PrimaryKey), new(tablestore.PrimaryKey)
+	// options of the columns after the last column bound
+	startRest, endRest := tablestore.MIN, tablestore.MAX
+	for i, column := range primaryKey {
+		if i >= prefix {
+			addBound(start, column, startRest, nil)
+			addBound(end, column, endRest, nil)
+			continue
+		}
+		var lower, upper *Condition
+		for j := range filter {
+			condition := &filter[j]
+			if condition.Column != column {
+				continue
+			}
+			switch condition.Op {
+			case OpEqual:
+				lower, upper = condition, condition
+			case OpGreater, OpGreaterEqual:
+				if lower == nil || lower.Op != OpEqual {
+					lower = condition
+				}
+			case OpLess, OpLessEqual:
+				if upper == nil || upper.Op != OpEqual {
+					upper = condition
+				}
+			}
+		}
+		if lower != nil {
+			addBound(start, column, tablestore.NONE, lower.Value)
+			if lower.Op == OpGreater {
+				startRest = tablestore.MAX
+			}
+		} else {
+			addBound(start, column, tablestore.MIN, nil)
+		}
+		if upper != nil {
+			value := upper.Value
+			if upper.Op == OpLess {
+				endRest = tablestore.MIN
+			} else if i == len(primaryKey)-1 {
+				// the end is excluded, and no column follows to include it
+				value = successor(value)
+			}
+			addBound(end, column, tablestore.NONE, value)
+		} else {
+			addBound(end, column, tablestore.MAX, nil)
+		}
+	}
+	return start, end
+}
+
+// successor returns the value following value, of the primary key values.
+func successor(value interface{}) interface{} {
+	switch value := value.(type) {
+	case int64:
+		return value + 1
+	case string:
+		return value + "\x00"
+	case []byte:
+		return append(append([]byte{}, value...), 0)
+	}
+	return value
+}
+
+func addBound(pk *tablestore.PrimaryKey, column string, option tablestore.PrimaryKeyOption, value interface{}) {
+	switch option {
+	case tablestore.MIN:
+		pk.AddPrimaryKeyColumnWithMinValue(column)
+	case tablestore.MAX:
+		pk.AddPrimaryKeyColumnWithMaxValue(column)
+	default:
+		pk.AddPrimaryKeyColumn(column, value)
+	}
+}
+
+// maximum rows of a search
+const searchLimit = 100
+
+func (planner *Planner) search(plan *Plan, limit int) ([]*tablestore.Row, error) {
+	query := &search.BoolQuery{}
+	for _, condition := range plan.filter {
+		switch condition.Op {
+		case OpEqual:
+			query.MustQueries = append(query.MustQueries, &search.TermQuery{FieldName: condition.Column, Term: condition.Value})
+		default:
+			r := &search.RangeQuery{FieldName: condition.Column}
+			switch condition.Op {
+			case OpLess:
+				r.LT(condition.Value)
+			case OpLessEqual:
+				r.LTE(condition.Value)
+			case OpGreater:
+				r.GT(condition.Value)
+			case OpGreaterEqual:
+				r.GTE(condition.Value)
+			}
+			query.MustQueries = append(query.MustQueries, r)
+		}
+	}
+	var rows []*tablestore.Row
+	for offset := int32(0); ; offset += searchLimit {
+		searchQuery := search.NewSearchQuery().SetQuery(query).SetOffset(offset).SetLimit(searchLimit)
+		resp, err := planner.client.Search(&tablestore.SearchRequest{TableName: plan.TableName, IndexName: plan.IndexName,
+			SearchQuery: searchQuery, ColumnsToGet: &tablestore.ColumnsToGet{ReturnAll: true}})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range resp.Rows {
+			if plan.filter.Match(row) {
+				rows = append(rows, row)
+				if len(rows) == limit {
+					return rows, nil
+				}
+			}
+		}
+		if len(resp.Rows) < searchLimit {
+			return rows, nil
+		}
+	}
+}
+
+// Match returns whether row matches the conditions of filter, the rows
+// without a column of a condition not matching.
+func (filter Filter) Match(row *tablestore.Row) bool {
+	for _, condition := range filter {
+		value, ok := columnValue(row, condition.Column)
+		if !ok {
+			return false
+		}
+		c, ok := compare(value, condition.Value)
+		if !ok {
+			return false
+		}
+		switch condition.Op {
+		case OpEqual:
+			ok = c == 0
+		case OpLess:
+			ok = c < 0
+		case OpLessEqual:
+			ok = c <= 0
+		case OpGreater:
+			ok = c > 0
+		case OpGreaterEqual:
+			ok = c >= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func columnValue(row *tablestore.Row, name string) (interface{}, bool) {
+	if row.PrimaryKey != nil {
+		for _, column := range row.PrimaryKey.PrimaryKeys {
+			if column.ColumnName == name {
+				return column.Value, true
+			}
+		}
+	}
+	return row.LookupColumn(name)
+}
+
+// compare orders values of the same type, false if they are not comparable.
+func compare(a, b interface{}) (int, bool) {
+	switch av := a.(type) {
+	case int64:
+		if bv, ok := b.(int64); ok {
+			switch {
+			case av < bv:
+				return -1, true
+			case av > bv:
+				return 1, true
+			}
+			return 0, true
+		}
+	case float64:
+		if bv, ok := b.(float64); ok {
+			return compareFloats(av, bv), true
+		}
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv), true
+		}
+	case []byte:
+		if bv, ok := b.([]byte); ok {
+			return bytes.Compare(av, bv), true
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			if av == bv {
+				return 0, true
+			}
+			if bv {
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	return 0, false
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
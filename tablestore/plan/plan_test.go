@@ -0,0 +1,158 @@
+package plan
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"github.com/golang/protobuf/proto"
+	"testing"
+)
+
+// indexedClient has a secondary index "orders_by_shop" of table "orders",
+// kept as a table, and a search index "orders_search", searched by reading
+// the whole table.
+type indexedClient struct {
+	*tablestoretest.Client
+	searches int
+}
+
+func (client *indexedClient) DescribeTable(request *tablestore.DescribeTableRequest) (*tablestore.DescribeTableResponse, error) {
+	resp, err := client.Client.DescribeTable(request)
+	if err == nil && request.TableName == "orders" {
+		resp.IndexMetas = []*tablestore.IndexMeta{{IndexName: "orders_by_shop", Primarykey: []string{"shop", "user", "id"}}}
+	}
+	return resp, err
+}
+
+func (client *indexedClient) ListSearchIndex(request *tablestore.ListSearchIndexRequest) (*tablestore.ListSearchIndexResponse, error) {
+	return &tablestore.ListSearchIndexResponse{IndexInfo: []*tablestore.IndexInfo{{TableName: "orders", IndexName: "orders_search"}}}, nil
+}
+
+func (client *indexedClient) DescribeSearchIndex(request *tablestore.DescribeSearchIndexRequest) (*tablestore.DescribeSearchIndexResponse, error) {
+	schema := &tablestore.IndexSchema{}
+	for _, name := range []string{"user", "status", "amount"} {
+		schema.FieldSchemas = append(schema.FieldSchemas, &tablestore.FieldSchema{FieldName: proto.String(name), Index: proto.Bool(true)})
+	}
+	return &tablestore.DescribeSearchIndexResponse{Schema: schema}, nil
+}
+
+func (client *indexedClient) Search(request *tablestore.SearchRequest) (*tablestore.SearchResponse, error) {
+	client.searches++
+	criteria := &tablestore.RangeRowQueryCriteria{TableName: request.TableName, StartPrimaryKey: new(tablestore.PrimaryKey), EndPrimaryKey: new(tablestore.PrimaryKey), MaxVersion: 1}
+	for _, name := range []string{"user", "id"} {
+		criteria.StartPrimaryKey.AddPrimaryKeyColumnWithMinValue(name)
+		criteria.EndPrimaryKey.AddPrimaryKeyColumnWithMaxValue(name)
+	}
+	resp := &tablestore.SearchResponse{IsAllSuccess: true}
+	for criteria.StartPrimaryKey != nil {
+		page, err := client.Client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: criteria})
+		if err != nil {
+			return nil, err
+		}
+		resp.Rows = append(resp.Rows, page.Rows...)
+		criteria.StartPrimaryKey = page.NextStartPrimaryKey
+	}
+	resp.TotalCount = int64(len(resp.Rows))
+	return resp, nil
+}
+
+func createTable(t *testing.T, client tablestore.TableStoreApi, name string, columns ...string) {
+	meta := &tablestore.TableMeta{TableName: name}
+	for _, column := range columns {
+		if column == "id" {
+			meta.AddPrimaryKeyColumn(column, tablestore.PrimaryKeyType_INTEGER)
+		} else {
+			meta.AddPrimaryKeyColumn(column, tablestore.PrimaryKeyType_STRING)
+		}
+	}
+	if _, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func put(t *testing.T, client tablestore.TableStoreApi, table string, pk *tablestore.PrimaryKey, columns map[string]interface{}) {
+	change := &tablestore.PutRowChange{TableName: table, PrimaryKey: pk}
+	for name, value := range columns {
+		change.AddColumn(name, value)
+	}
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: change}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func ids(rows []*tablestore.Row) []int64 {
+	var ids []int64
+	for _, row := range rows {
+		for _, column := range row.PrimaryKey.PrimaryKeys {
+			if column.ColumnName == "id" {
+				ids = append(ids, column.Value.(int64))
+			}
+		}
+	}
+	return ids
+}
+
+func TestPlanner(t *testing.T) {
+	client := &indexedClient{Client: tablestoretest.NewClient()}
+	client.RangeLimit = 2
+	createTable(t, client, "orders", "user", "id")
+	createTable(t, client, "orders_by_shop", "shop", "user", "id")
+	for i := int64(0); i < 12; i++ {
+		user, shop := fmt.Sprintf("u%d", i%3), fmt.Sprintf("s%d", i%2)
+		pk := new(tablestore.PrimaryKey)
+		pk.AddPrimaryKeyColumn("user", user)
+		pk.AddPrimaryKeyColumn("id", i)
+		put(t, client, "orders", pk, map[string]interface{}{"shop": shop, "amount": i * 10, "status": "paid"})
+		index := new(tablestore.PrimaryKey)
+		index.AddPrimaryKeyColumn("shop", shop)
+		index.AddPrimaryKeyColumn("user", user)
+		index.AddPrimaryKeyColumn("id", i)
+		put(t, client, "orders_by_shop", index, nil)
+	}
+
+	planner, err := New(client, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		filter Filter
+		plan   string
+		ids    string
+	}{
+		{Filter{Equal("user", "u1"), Greater("id", int64(4))}, "table range orders on user, id", "[7 10]"},
+		{Filter{Equal("user", "u1"), GreaterEqual("amount", int64(40))}, "table range orders on user", "[4 7 10]"},
+		{Filter{Equal("shop", "s0"), Equal("user", "u0"), LessEqual("id", int64(6))}, "index range orders_by_shop on shop, user, id", "[0 6]"},
+		{Filter{Equal("status", "paid"), Less("amount", int64(30))}, "search index orders_search", "[0 1 2]"},
+		{Filter{Equal("shop", "s1"), Greater("amount", int64(80))}, "table scan orders", "[9 11]"},
+		{Filter{Equal("shop", "s1"), Greater("id", int64(6)), Less("id", int64(9))}, "index range orders_by_shop on shop", "[7]"},
+		{Filter{Equal("missing", "x")}, "table scan orders", "[]"},
+	}
+	for _, c := range cases {
+		plan, err := planner.Plan(c.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plan.String() != c.plan {
+			t.Errorf("%v: plan %s, expect %s", c.filter, plan, c.plan)
+		}
+		rows, err := planner.Execute(plan, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(ids(rows)); got != c.ids {
+			t.Errorf("%v: rows %s, expect %s", c.filter, got, c.ids)
+		}
+	}
+	if client.searches != 1 {
+		t.Errorf("%d searches", client.searches)
+	}
+
+	rows, err := planner.Query(Filter{GreaterEqual("id", int64(0))}, 5)
+	if err != nil || len(rows) != 5 {
+		t.Errorf("%d rows, %v", len(rows), err)
+	}
+	if _, err := planner.Plan(Filter{{Column: "id", Op: Op(9)}}); err == nil {
+		t.Errorf("expect invalid operator")
+	}
+}
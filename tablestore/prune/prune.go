@@ -0,0 +1,174 @@
+// Package prune deletes the rows of a key range matching a predicate, e.g. to
+// clean data older than a retention from tables where the time to live can't
+// be set, since it would expire data the retention keeps:
+//
+//	job := prune.New(client, criteria, prune.OlderThan(90*24*time.Hour), prune.Options{
+//		RowsPerSecond: 500,
+//		Checkpoint: func(token string, progress prune.Progress) error {
+//			return saveToken(token)
+//		},
+//	})
+//	progress, err := job.Run(ctx)
+//
+// A job interrupted resumes after the rows deleted before its last checkpoint
+// when run again with Options.Resume set to the last token checkpointed.
+//
+// Rows are deleted unconditionally: a row written between its read and its
+// deletion is deleted anyway, so predicates should only match rows no longer
+// written.
+package prune
+
+import (
+	"context"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"time"
+)
+
+// Predicate reports whether a row read must be deleted.
+type Predicate func(row *tablestore.Row) bool
+
+// OlderThan matches the rows whose columns were all written more than age
+// ago, by their timestamps. Rows read without attribute columns don't match.
+func OlderThan(age time.Duration) Predicate {
+	return func(row *tablestore.Row) bool {
+		var latest int64
+		for _, column := range row.Columns {
+			if column.Timestamp > latest {
+				latest = column.Timestamp
+			}
+		}
+		return latest > 0 && latest < millis(time.Now().Add(-age))
+	}
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// Progress counts the rows of a job.
+type Progress struct {
+	Scanned int64
+	Deleted int64
+}
+
+type Options struct {
+	// rows deleted per BatchWriteRow request, 200 by default, the limit of
+	// the service
+	BatchSize int
+	// deletion rate limit, unlimited if 0
+	RowsPerSecond float64
+	// called with a token resuming the job and its progress after each page
+	// of rows read is pruned, and with "" once the range is pruned; errors
+	// stop the job
+	Checkpoint func(token string, progress Progress) error
+	// token of a Checkpoint the job resumes at
+	Resume string
+}
+
+// Job prunes a range of rows.
+type Job struct {
+	client    tablestore.TableStoreApi
+	criteria  tablestore.RangeRowQueryCriteria
+	predicate Predicate
+	options   Options
+}
+
+// New returns a job deleting the rows of the range of criteria matching
+// predicate. The filter of criteria, if any, selects the rows read, and its
+// columns to get the columns passed to predicate.
+func New(client tablestore.TableStoreApi, criteria *tablestore.RangeRowQueryCriteria, predicate Predicate, options Options) *Job {
+	if options.BatchSize <= 0 || options.BatchSize > 200 {
+		options.BatchSize = 200
+	}
+	return &Job{client: client, criteria: *criteria, predicate: predicate, options: options}
+}
+
+// Run prunes the range until its end, ctx is done or an error occurs, and
+// returns the progress of this run.
+func (job *Job) Run(ctx context.Context) (Progress, error) {
+	var progress Progress
+	criteria := job.criteria
+	if err := tablestore.DecodeRangeToken(job.options.Resume, &criteria); err != nil {
+		return progress, err
+	}
+	if criteria.MaxVersion == 0 && criteria.TimeRange == nil {
+		criteria.MaxVersion = 1
+	}
+	start := time.Now()
+	for {
+		if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+		resp, err := job.client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: &criteria})
+		if err != nil {
+			return progress, err
+		}
+		progress.Scanned += int64(len(resp.Rows))
+
+		var batch []*tablestore.Row
+		for _, row := range resp.Rows {
+			if !job.predicate(row) {
+				continue
+			}
+			batch = append(batch, row)
+			if len(batch) == job.options.BatchSize {
+				if err := job.delete(ctx, batch, &progress, start); err != nil {
+					return progress, err
+				}
+				batch = nil
+			}
+		}
+		if len(batch) > 0 {
+			if err := job.delete(ctx, batch, &progress, start); err != nil {
+				return progress, err
+			}
+		}
+
+		if job.options.Checkpoint != nil {
+			token := tablestore.EncodeRangeToken(&job.criteria, resp.NextStartPrimaryKey)
+			if err := job.options.Checkpoint(token, progress); err != nil {
+				return progress, err
+			}
+		}
+		if resp.NextStartPrimaryKey == nil {
+			return progress, nil
+		}
+		criteria.StartPrimaryKey = resp.NextStartPrimaryKey
+	}
+}
+
+// delete deletes rows, after waiting for the rate limit.
+func (job *Job) delete(ctx context.Context, rows []*tablestore.Row, progress *Progress, start time.Time) error {
+	if job.options.RowsPerSecond > 0 {
+		due := start.Add(time.Duration(float64(progress.Deleted) / job.options.RowsPerSecond * float64(time.Second)))
+		if wait := time.Until(due); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+		}
+	}
+
+	req := &tablestore.BatchWriteRowRequest{}
+	for _, row := range rows {
+		change := &tablestore.DeleteRowChange{TableName: job.criteria.TableName, PrimaryKey: row.PrimaryKey}
+		change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		req.AddRowChange(change)
+	}
+	resp, err := job.client.BatchWriteRow(req)
+	if err != nil {
+		return err
+	}
+	for _, result := range resp.TableToRowsResult[job.criteria.TableName] {
+		if result.IsSucceed {
+			progress.Deleted++
+		} else if err == nil {
+			err = fmt.Errorf("[tablestore] prune: %s %s", result.Error.Code, result.Error.Message)
+		}
+	}
+	return err
+}
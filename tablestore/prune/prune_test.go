@@ -0,0 +1,87 @@
+package prune
+
+import (
+	"context"
+	"errors"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"testing"
+	"time"
+)
+
+func TestPrune(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	server.Store.RangeLimit = 3
+	client := server.NewTableStoreClient()
+	meta := &tablestore.TableMeta{TableName: "events"}
+	meta.AddPrimaryKeyColumn("id", tablestore.PrimaryKeyType_INTEGER)
+	if _, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+		t.Fatal(err)
+	}
+	old := millis(time.Now().Add(-48 * time.Hour))
+	for i := int64(0); i < 10; i++ {
+		change := &tablestore.PutRowChange{TableName: "events", PrimaryKey: new(tablestore.PrimaryKey)}
+		change.PrimaryKey.AddPrimaryKeyColumn("id", i)
+		change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		// even rows are old
+		if i%2 == 0 {
+			change.AddColumnWithTimestamp("v", i, old)
+		} else {
+			change.AddColumn("v", i)
+		}
+		if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: change}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	criteria := &tablestore.RangeRowQueryCriteria{TableName: "events", StartPrimaryKey: new(tablestore.PrimaryKey), EndPrimaryKey: new(tablestore.PrimaryKey)}
+	criteria.StartPrimaryKey.AddPrimaryKeyColumnWithMinValue("id")
+	criteria.EndPrimaryKey.AddPrimaryKeyColumnWithMaxValue("id")
+
+	// interrupted after the first page
+	stop := errors.New("stop")
+	var token string
+	job := New(client, criteria, OlderThan(24*time.Hour), Options{BatchSize: 1, Checkpoint: func(next string, progress Progress) error {
+		token = next
+		return stop
+	}})
+	progress, err := job.Run(context.Background())
+	if err != stop || progress != (Progress{Scanned: 3, Deleted: 2}) || token == "" {
+		t.Fatalf("unexpected run %+v, %v, %q", progress, err, token)
+	}
+
+	var tokens []string
+	job = New(client, criteria, OlderThan(24*time.Hour), Options{RowsPerSecond: 1000, Resume: token, Checkpoint: func(next string, progress Progress) error {
+		tokens = append(tokens, next)
+		return nil
+	}})
+	progress, err = job.Run(context.Background())
+	if err != nil || progress != (Progress{Scanned: 7, Deleted: 3}) {
+		t.Fatalf("unexpected run %+v, %v", progress, err)
+	}
+	if len(tokens) != 3 || tokens[2] != "" {
+		t.Errorf("unexpected checkpoints %q", tokens)
+	}
+
+	server.Store.RangeLimit = 0
+	resp, err := client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: &tablestore.RangeRowQueryCriteria{TableName: "events",
+		StartPrimaryKey: criteria.StartPrimaryKey, EndPrimaryKey: criteria.EndPrimaryKey, MaxVersion: 1, Limit: 100}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, row := range resp.Rows {
+		ids = append(ids, row.PrimaryKey.PrimaryKeys[0].Value.(int64))
+	}
+	if len(ids) != 5 || ids[0] != 1 || ids[4] != 9 {
+		t.Errorf("unexpected rows left %v", ids)
+	}
+
+	// a token of another range is rejected
+	other := *criteria
+	other.TableName = "other"
+	if _, err := New(client, &other, OlderThan(time.Hour), Options{Resume: token}).Run(context.Background()); err != tablestore.ErrInvalidRangeToken {
+		t.Errorf("token of another range accepted: %v", err)
+	}
+}
@@ -0,0 +1,299 @@
+package tablestore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+)
+
+// QueryColumn is a column compared by the conditions of a Query.
+type QueryColumn struct {
+	name string
+}
+
+// Col returns the column name, e.g. Col("status").Equal("open").
+func Col(name string) QueryColumn {
+	return QueryColumn{name: name}
+}
+
+// condition returns a condition on the latest version of the column, which
+// rows without the column do not meet.
+func (column QueryColumn) condition(comparator ComparatorType, value interface{}) *SingleColumnCondition {
+	condition := NewSingleColumnCondition(column.name, comparator, value)
+	condition.FilterIfMissing = true
+	condition.LatestVersionOnly = true
+	return condition
+}
+
+func (column QueryColumn) Equal(value interface{}) *SingleColumnCondition {
+	return column.condition(CT_EQUAL, value)
+}
+
+func (column QueryColumn) NotEqual(value interface{}) *SingleColumnCondition {
+	return column.condition(CT_NOT_EQUAL, value)
+}
+
+func (column QueryColumn) GreaterThan(value interface{}) *SingleColumnCondition {
+	return column.condition(CT_GREATER_THAN, value)
+}
+
+func (column QueryColumn) GreaterEqual(value interface{}) *SingleColumnCondition {
+	return column.condition(CT_GREATER_EQUAL, value)
+}
+
+func (column QueryColumn) LessThan(value interface{}) *SingleColumnCondition {
+	return column.condition(CT_LESS_THAN, value)
+}
+
+func (column QueryColumn) LessEqual(value interface{}) *SingleColumnCondition {
+	return column.condition(CT_LESS_EQUAL, value)
+}
+
+func composite(operator LogicalOperator, filters []ColumnFilter) *CompositeColumnValueFilter {
+	condition := NewCompositeColumnCondition(operator)
+	for _, filter := range filters {
+		condition.AddFilter(filter)
+	}
+	return condition
+}
+
+// AllOf returns a condition met by rows meeting all of filters.
+func AllOf(filters ...ColumnFilter) *CompositeColumnValueFilter {
+	return composite(LO_AND, filters)
+}
+
+// AnyOf returns a condition met by rows meeting any of filters.
+func AnyOf(filters ...ColumnFilter) *CompositeColumnValueFilter {
+	return composite(LO_OR, filters)
+}
+
+// NoneOf returns a condition met by rows meeting none of filters.
+func NoneOf(filters ...ColumnFilter) *CompositeColumnValueFilter {
+	if len(filters) == 1 {
+		return composite(LO_NOT, filters)
+	}
+	return composite(LO_NOT, []ColumnFilter{AnyOf(filters...)})
+}
+
+// Query is a scan of a table built fluently, compiled to GetRange requests:
+//
+//	rows, err := client.Query("orders").
+//		Where(Col("user").Equal("u1"), Col("status").Equal("open")).
+//		Limit(100).
+//		Run(ctx)
+//
+// Equal conditions on the leading primary key columns, then a GreaterEqual
+// and a LessThan condition on the next one, bound the range scanned; the
+// other primary key columns range from their minimum to their maximum. The
+// conditions on other columns filter the rows read.
+type Query struct {
+	client    *TableStoreClient
+	table     string
+	where     []ColumnFilter
+	columns   []string
+	limit     int
+	direction Direction
+}
+
+// Query returns a query scanning all the rows of table.
+func (tableStoreClient *TableStoreClient) Query(table string) *Query {
+	return &Query{client: tableStoreClient, table: table, direction: FORWARD}
+}
+
+// Where adds conditions met by the rows returned.
+func (query *Query) Where(conditions ...ColumnFilter) *Query {
+	query.where = append(query.where, conditions...)
+	return query
+}
+
+// Select restricts the columns returned, all of them by default.
+func (query *Query) Select(columns ...string) *Query {
+	query.columns = append(query.columns, columns...)
+	return query
+}
+
+// Limit limits the number of rows returned, unlimited if 0.
+func (query *Query) Limit(limit int) *Query {
+	query.limit = limit
+	return query
+}
+
+// Reverse returns rows in descending primary key order.
+func (query *Query) Reverse() *Query {
+	query.direction = BACKWARD
+	return query
+}
+
+// queryPlan is a query compiled for the primary key of its table.
+type queryPlan struct {
+	criteria *RangeRowQueryCriteria
+	// the whole primary key is fixed, the start primary key of criteria
+	exact bool
+	// row in the range but not meeting the conditions, and row meeting the
+	// conditions out of the range, when scanning a range bounded on the last
+	// primary key column backward: the range starts at its inclusive start
+	// and ends at its exclusive end
+	exclude, include *PrimaryKey
+}
+
+// plan compiles the query for the primary key of meta.
+func (query *Query) plan(meta *TableMeta) (*queryPlan, error) {
+	pkConditions := make(map[string][]*SingleColumnCondition)
+	isPk := make(map[string]bool)
+	for _, schema := range meta.SchemaEntry {
+		isPk[*schema.Name] = true
+	}
+	var filters []ColumnFilter
+	for _, filter := range query.where {
+		if condition, ok := filter.(*SingleColumnCondition); ok && isPk[*condition.ColumnName] {
+			pkConditions[*condition.ColumnName] = append(pkConditions[*condition.ColumnName], condition)
+		} else {
+			filters = append(filters, filter)
+		}
+	}
+
+	// the leading columns met by Equal conditions are fixed, the next one is
+	// bounded, and the following ones range entirely
+	plan := new(queryPlan)
+	start, end := new(PrimaryKey), new(PrimaryKey)
+	fixed := true
+	var upper interface{}
+	for i, schema := range meta.SchemaEntry {
+		name := *schema.Name
+		last := i == len(meta.SchemaEntry)-1
+		conditions := pkConditions[name]
+		if fixed && len(conditions) == 1 && *conditions[0].Comparator == CT_EQUAL {
+			start.AddPrimaryKeyColumn(name, conditions[0].ColumnValue)
+			end.AddPrimaryKeyColumn(name, conditions[0].ColumnValue)
+			continue
+		}
+		if fixed {
+			fixed = false
+			var lower interface{}
+			for _, condition := range conditions {
+				switch *condition.Comparator {
+				case CT_GREATER_EQUAL:
+					lower = condition.ColumnValue
+				case CT_LESS_THAN:
+					upper = condition.ColumnValue
+				default:
+					return nil, fmt.Errorf("[tablestore] unsupported condition on primary key column %s", name)
+				}
+			}
+			if lower != nil {
+				start.AddPrimaryKeyColumn(name, lower)
+				if last && query.direction == BACKWARD {
+					plan.include = start
+				}
+			} else {
+				start.AddPrimaryKeyColumnWithMinValue(name)
+			}
+			if upper != nil {
+				end.AddPrimaryKeyColumn(name, upper)
+				if last && query.direction == BACKWARD {
+					plan.exclude = end
+				}
+			} else {
+				end.AddPrimaryKeyColumnWithMaxValue(name)
+			}
+			continue
+		}
+		if len(conditions) > 0 {
+			return nil, fmt.Errorf("[tablestore] condition on primary key column %s not following conditions on the former ones", name)
+		}
+		start.AddPrimaryKeyColumnWithMinValue(name)
+		if upper != nil {
+			// the end is exclusive: rows before upper
+			end.AddPrimaryKeyColumnWithMinValue(name)
+		} else {
+			end.AddPrimaryKeyColumnWithMaxValue(name)
+		}
+	}
+
+	plan.exact = fixed
+	plan.criteria = &RangeRowQueryCriteria{TableName: query.table, StartPrimaryKey: start, EndPrimaryKey: end, ColumnsToGet: query.columns,
+		MaxVersion: 1, Direction: query.direction}
+	if query.direction == BACKWARD {
+		plan.criteria.StartPrimaryKey, plan.criteria.EndPrimaryKey = end, start
+	}
+	switch len(filters) {
+	case 0:
+	case 1:
+		plan.criteria.Filter = filters[0]
+	default:
+		plan.criteria.Filter = AllOf(filters...)
+	}
+	return plan, nil
+}
+
+func samePrimaryKey(a, b *PrimaryKey) bool {
+	return bytes.Equal(a.Build(false), b.Build(false))
+}
+
+// getRow reads the row of pk meeting the conditions of criteria, nil if none.
+func getRow(client *TableStoreClient, criteria *RangeRowQueryCriteria, pk *PrimaryKey) (*Row, error) {
+	single := &SingleRowQueryCriteria{TableName: criteria.TableName, PrimaryKey: pk, ColumnsToGet: criteria.ColumnsToGet,
+		MaxVersion: criteria.MaxVersion, Filter: criteria.Filter}
+	resp, err := client.GetRow(&GetRowRequest{SingleRowQueryCriteria: single})
+	if err != nil || len(resp.PrimaryKey.PrimaryKeys) == 0 {
+		return nil, err
+	}
+	return &Row{PrimaryKey: &resp.PrimaryKey, Columns: resp.Columns}, nil
+}
+
+// Run runs the query, reading pages of rows until the limit or the end of the
+// range, or until ctx is done. It describes the table to learn its primary
+// key first.
+func (query *Query) Run(ctx context.Context) ([]*Row, error) {
+	client := query.client.WithContext(ctx)
+	described, err := client.DescribeTable(&DescribeTableRequest{TableName: query.table})
+	if err != nil {
+		return nil, err
+	}
+	plan, err := query.plan(described.TableMeta)
+	if err != nil {
+		return nil, err
+	}
+	criteria := plan.criteria
+
+	var rows []*Row
+	if plan.exact {
+		row, err := getRow(client, criteria, criteria.StartPrimaryKey)
+		if row != nil {
+			rows = append(rows, row)
+		}
+		return rows, err
+	}
+	for {
+		if query.limit > 0 {
+			criteria.Limit = int32(query.limit - len(rows))
+		}
+		resp, err := client.GetRange(&GetRangeRequest{RangeRowQueryCriteria: criteria})
+		if err != nil {
+			return rows, err
+		}
+		for _, row := range resp.Rows {
+			if plan.exclude == nil || !samePrimaryKey(row.PrimaryKey, plan.exclude) {
+				rows = append(rows, row)
+			}
+		}
+		if query.limit > 0 && len(rows) >= query.limit {
+			return rows, nil
+		}
+		if resp.NextStartPrimaryKey == nil {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return rows, err
+		}
+		criteria.StartPrimaryKey = resp.NextStartPrimaryKey
+	}
+	if plan.include != nil {
+		row, err := getRow(client, criteria, plan.include)
+		if row != nil {
+			rows = append(rows, row)
+		}
+		return rows, err
+	}
+	return rows, nil
+}
@@ -0,0 +1,228 @@
+// Package queue stores queues of messages in a table, e.g. the outbox of a
+// service whose messages are published along with its business rows:
+//
+//	q := queue.New(client, "queues", "emails", queue.Options{VisibilityTimeout: time.Minute})
+//	seq, err := q.Publish(body)
+//	...
+//	messages, err := q.Poll(10)
+//	for _, message := range messages {
+//		if send(message.Body) == nil {
+//			q.Ack(message)
+//		}
+//	}
+//
+// Messages are rows ordered by an auto increment sequence number. Poll claims
+// messages with conditional updates, hiding them from other consumers for
+// the visibility timeout; messages not acknowledged by then are delivered
+// again. Delivery is at least once.
+package queue
+
+import (
+	"errors"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"time"
+)
+
+// columns of the rows of messages, whose primary key is made of the string
+// column QueueColumn and of the auto increment column SeqColumn
+const (
+	QueueColumn       = "queue"
+	SeqColumn         = "seq"
+	BodyColumn        = "body"
+	PublishedAtColumn = "published_at"
+	VisibleAtColumn   = "visible_at"
+	DeliveriesColumn  = "deliveries"
+)
+
+// ErrClaimLost is returned by Ack when the message was claimed again after
+// its visibility timeout, or deleted.
+var ErrClaimLost = errors.New("[tablestore] message claim lost")
+
+type Options struct {
+	// time a polled message is hidden from other consumers, 30s by default
+	VisibilityTimeout time.Duration
+	// rows read by Poll to find visible messages, 1000 by default
+	ScanLimit int
+}
+
+type Message struct {
+	Seq         int64
+	Body        []byte
+	PublishedAt time.Time
+	// number of times the message was claimed, this claim included
+	Deliveries int64
+}
+
+// Queue is a queue named Name in a table. It is safe for concurrent use.
+type Queue struct {
+	client  tablestore.TableStoreApi
+	table   string
+	name    string
+	options Options
+}
+
+func New(client tablestore.TableStoreApi, table, name string, options Options) *Queue {
+	if options.VisibilityTimeout <= 0 {
+		options.VisibilityTimeout = 30 * time.Second
+	}
+	if options.ScanLimit <= 0 {
+		options.ScanLimit = 1000
+	}
+	return &Queue{client: client, table: table, name: name, options: options}
+}
+
+// CreateTable creates a table of queues.
+func CreateTable(client tablestore.TableStoreApi, table string) error {
+	meta := &tablestore.TableMeta{TableName: table}
+	meta.AddPrimaryKeyColumn(QueueColumn, tablestore.PrimaryKeyType_STRING)
+	meta.AddPrimaryKeyColumnOption(SeqColumn, tablestore.PrimaryKeyType_INTEGER, tablestore.AUTO_INCREMENT)
+	_, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}})
+	return err
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func (q *Queue) primaryKey(seq int64) *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn(QueueColumn, q.name)
+	pk.AddPrimaryKeyColumn(SeqColumn, seq)
+	return pk
+}
+
+// PublishChange returns the row change publishing body, e.g. to write it
+// along with other rows by BatchWriteRow.
+func (q *Queue) PublishChange(body []byte) *tablestore.PutRowChange {
+	change := &tablestore.PutRowChange{TableName: q.table, PrimaryKey: new(tablestore.PrimaryKey)}
+	change.PrimaryKey.AddPrimaryKeyColumn(QueueColumn, q.name)
+	change.PrimaryKey.AddPrimaryKeyColumnWithAutoIncrement(SeqColumn)
+	change.AddColumn(BodyColumn, body)
+	change.AddColumn(PublishedAtColumn, millis(time.Now()))
+	change.AddColumn(VisibleAtColumn, int64(0))
+	change.AddColumn(DeliveriesColumn, int64(0))
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	return change
+}
+
+// Publish appends a message to the queue and returns its sequence number.
+func (q *Queue) Publish(body []byte) (int64, error) {
+	change := q.PublishChange(body)
+	change.SetReturnPk()
+	resp, err := q.client.PutRow(&tablestore.PutRowRequest{PutRowChange: change})
+	if err != nil {
+		return 0, err
+	}
+	for _, column := range resp.PrimaryKey.PrimaryKeys {
+		if column.ColumnName == SeqColumn {
+			seq, _ := column.Value.(int64)
+			return seq, nil
+		}
+	}
+	return 0, nil
+}
+
+func messageOf(row *tablestore.Row) (message *Message, visibleAt int64) {
+	message = new(Message)
+	for _, column := range row.PrimaryKey.PrimaryKeys {
+		if column.ColumnName == SeqColumn {
+			message.Seq, _ = column.Value.(int64)
+		}
+	}
+	for _, column := range row.Columns {
+		switch column.ColumnName {
+		case BodyColumn:
+			message.Body, _ = column.Value.([]byte)
+		case PublishedAtColumn:
+			published, _ := column.Value.(int64)
+			message.PublishedAt = time.Unix(0, published*int64(time.Millisecond))
+		case VisibleAtColumn:
+			visibleAt, _ = column.Value.(int64)
+		case DeliveriesColumn:
+			message.Deliveries, _ = column.Value.(int64)
+		}
+	}
+	return message, visibleAt
+}
+
+// claim hides message for the visibility timeout, unless another consumer
+// claimed it meanwhile.
+func (q *Queue) claim(message *Message, now time.Time) (bool, error) {
+	change := &tablestore.UpdateRowChange{TableName: q.table, PrimaryKey: q.primaryKey(message.Seq)}
+	change.PutColumn(VisibleAtColumn, millis(now.Add(q.options.VisibilityTimeout)))
+	change.PutColumn(DeliveriesColumn, message.Deliveries+1)
+	change.SetCondition(tablestore.RowExistenceExpectation_EXPECT_EXIST)
+	change.SetColumnCondition(tablestore.NewSingleColumnCondition(DeliveriesColumn, tablestore.CT_EQUAL, message.Deliveries))
+	_, err := q.client.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: change})
+	if tablestore.IsConditionCheckFail(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	message.Deliveries++
+	return true, nil
+}
+
+// Poll claims up to max visible messages, oldest first. It returns fewer
+// messages if no more are visible among the first ScanLimit ones.
+func (q *Queue) Poll(max int) ([]*Message, error) {
+	start, end := new(tablestore.PrimaryKey), new(tablestore.PrimaryKey)
+	start.AddPrimaryKeyColumn(QueueColumn, q.name)
+	start.AddPrimaryKeyColumnWithMinValue(SeqColumn)
+	end.AddPrimaryKeyColumn(QueueColumn, q.name)
+	end.AddPrimaryKeyColumnWithMaxValue(SeqColumn)
+	criteria := &tablestore.RangeRowQueryCriteria{TableName: q.table, StartPrimaryKey: start, EndPrimaryKey: end, MaxVersion: 1}
+
+	var messages []*Message
+	scanned := 0
+	for len(messages) < max && scanned < q.options.ScanLimit {
+		criteria.Limit = int32(q.options.ScanLimit - scanned)
+		resp, err := q.client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: criteria})
+		if err != nil {
+			return messages, err
+		}
+		now := time.Now()
+		for _, row := range resp.Rows {
+			scanned++
+			message, visibleAt := messageOf(row)
+			if visibleAt > millis(now) {
+				continue
+			}
+			claimed, err := q.claim(message, now)
+			if err != nil {
+				return messages, err
+			}
+			if claimed {
+				messages = append(messages, message)
+				if len(messages) == max {
+					return messages, nil
+				}
+			}
+		}
+		if resp.NextStartPrimaryKey == nil {
+			break
+		}
+		criteria.StartPrimaryKey = resp.NextStartPrimaryKey
+	}
+	return messages, nil
+}
+
+// Ack deletes a polled message, unless its claim was lost.
+func (q *Queue) Ack(message *Message) error {
+	change := &tablestore.DeleteRowChange{TableName: q.table, PrimaryKey: q.primaryKey(message.Seq)}
+	change.SetCondition(tablestore.RowExistenceExpectation_EXPECT_EXIST)
+	change.SetColumnCondition(tablestore.NewSingleColumnCondition(DeliveriesColumn, tablestore.CT_EQUAL, message.Deliveries))
+	_, err := q.client.DeleteRow(&tablestore.DeleteRowRequest{DeleteRowChange: change})
+	if tablestore.IsConditionCheckFail(err) {
+		return ErrClaimLost
+	}
+	return err
+}
+
+// Delete deletes a message, claimed or not.
+func (q *Queue) Delete(seq int64) error {
+	change := &tablestore.DeleteRowChange{TableName: q.table, PrimaryKey: q.primaryKey(seq)}
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	_, err := q.client.DeleteRow(&tablestore.DeleteRowRequest{DeleteRowChange: change})
+	return err
+}
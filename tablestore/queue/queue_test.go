@@ -0,0 +1,72 @@
+package queue
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	client := server.NewTableStoreClient()
+	if err := CreateTable(client, "queues"); err != nil {
+		t.Fatal(err)
+	}
+
+	q := New(client, "queues", "emails", Options{VisibilityTimeout: 100 * time.Millisecond})
+	other := New(client, "queues", "sms", Options{})
+	var seqs []int64
+	for i := 0; i < 3; i++ {
+		seq, err := q.Publish([]byte(fmt.Sprint("m", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		seqs = append(seqs, seq)
+	}
+	if seqs[0] >= seqs[1] || seqs[1] >= seqs[2] {
+		t.Errorf("sequence numbers not increasing: %v", seqs)
+	}
+	// the outbox way
+	batch := &tablestore.BatchWriteRowRequest{}
+	batch.AddRowChange(other.PublishChange([]byte("s0")))
+	if _, err := client.BatchWriteRow(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := q.Poll(2)
+	if err != nil || len(first) != 2 || string(first[0].Body) != "m0" || string(first[1].Body) != "m1" || first[0].Deliveries != 1 {
+		t.Fatalf("unexpected poll %v, %v", first, err)
+	}
+	second, err := q.Poll(2)
+	if err != nil || len(second) != 1 || string(second[0].Body) != "m2" {
+		t.Fatalf("claimed messages polled again: %v, %v", second, err)
+	}
+	if err := q.Ack(first[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// m1 is not acknowledged in time, and delivered again
+	time.Sleep(150 * time.Millisecond)
+	third, err := q.Poll(10)
+	if err != nil || len(third) != 2 || string(third[0].Body) != "m1" || third[0].Deliveries != 2 {
+		t.Fatalf("unexpected poll %v, %v", third, err)
+	}
+	if err := q.Ack(first[1]); err != ErrClaimLost {
+		t.Errorf("stale claim acknowledged: %v", err)
+	}
+	if err := q.Ack(third[0]); err != nil {
+		t.Error(err)
+	}
+	if err := q.Delete(third[1].Seq); err != nil {
+		t.Error(err)
+	}
+	if messages, err := q.Poll(10); err != nil || len(messages) != 0 {
+		t.Errorf("unexpected messages %v, %v", messages, err)
+	}
+	if messages, err := other.Poll(10); err != nil || len(messages) != 1 || string(messages[0].Body) != "s0" {
+		t.Errorf("unexpected messages %v, %v", messages, err)
+	}
+}
@@ -0,0 +1,178 @@
+package tablestore
+
+import (
+	"io"
+	"sync"
+)
+
+type ReadRangeOptions struct {
+	// data size of the rows read at most, names included as by
+	// EstimateReadCU, unlimited if 0; the page reaching it is the last one
+	// read, returned whole
+	MaxBytes int64
+}
+
+// ReadRange reads the range of request as GetRange does, but goes on reading
+// the next pages while the server returns fewer rows than the Limit of the
+// criteria, for the size limits of its responses, until Limit rows are read,
+// the end of the range or options.MaxBytes. A Limit of 0 reads the whole
+// range.
+//
+// The response holds the rows of the pages read, the NextStartPrimaryKey of
+// the last one, and the capacity units, attempts and latency of all of them.
+// request is not modified.
+func ReadRange(client TableStoreApi, request *GetRangeRequest, options ReadRangeOptions) (*GetRangeResponse, error) {
+	criteria := *request.RangeRowQueryCriteria
+	limit := int(criteria.Limit)
+	response := &GetRangeResponse{ConsumedCapacityUnit: &ConsumedCapacityUnit{}}
+	var size int64
+	for {
+		if limit > 0 {
+			criteria.Limit = int32(limit - len(response.Rows))
+		}
+		resp, err := client.GetRange(&GetRangeRequest{RangeRowQueryCriteria: &criteria})
+		if err != nil {
+			return nil, err
+		}
+		response.Rows = append(response.Rows, resp.Rows...)
+		response.NextStartPrimaryKey = resp.NextStartPrimaryKey
+		if resp.ConsumedCapacityUnit != nil {
+			response.ConsumedCapacityUnit.Read += resp.ConsumedCapacityUnit.Read
+			response.ConsumedCapacityUnit.Write += resp.ConsumedCapacityUnit.Write
+		}
+		response.RequestId = resp.RequestId
+		response.Attempts += resp.Attempts
+		response.ThrottledAttempts += resp.ThrottledAttempts
+		response.TotalLatency += resp.TotalLatency
+
+		if options.MaxBytes > 0 {
+			for _, row := range resp.Rows {
+				size += primaryKeyDataSize(row.PrimaryKey)
+				for _, column := range row.Columns {
+					size += int64(len(column.ColumnName)) + dataSize(column.Value)
+				}
+			}
+		}
+		if resp.NextStartPrimaryKey == nil || (limit > 0 && len(response.Rows) >= limit) ||
+			(options.MaxBytes > 0 && size >= options.MaxBytes) {
+			return response, nil
+		}
+		criteria.StartPrimaryKey = resp.NextStartPrimaryKey
+	}
+}
+
+// RangeRows are the rows of a page of GetRangeRows, decoded by Next.
+type RangeRows struct {
+	ConsumedCapacityUnit *ConsumedCapacityUnit
+	NextStartPrimaryKey  *PrimaryKey
+	ResponseInfo
+
+	reader  *plainBufferReader
+	started bool
+	err     error
+}
+
+// Next decodes the next row of the page, io.EOF after the last one. Once it
+// fails, Next keeps returning the error.
+func (rows *RangeRows) Next() (*Row, error) {
+	return rows.next(false)
+}
+
+// NextPooled decodes the next row as Next does, into a row leased from a pool
+// instead of a new one, e.g. for consumers decoding many rows they do not
+// keep. The caller releases the row by its Release once done with it.
+func (rows *RangeRows) NextPooled() (*Row, error) {
+	return rows.next(true)
+}
+
+func (rows *RangeRows) next(pooled bool) (*Row, error) {
+	if rows.err != nil {
+		return nil, rows.err
+	}
+	if rows.reader == nil {
+		return nil, io.EOF
+	}
+	if !rows.started {
+		rows.started = true
+		if err := rows.reader.readHeader(); err != nil {
+			rows.err = err
+			return nil, err
+		}
+	}
+	if !rows.reader.more() {
+		// release the serialized rows
+		rows.reader = nil
+		return nil, io.EOF
+	}
+	row, err := rows.reader.readRow()
+	if err != nil {
+		rows.err = err
+		return nil, err
+	}
+
+	var currentRow *Row
+	if pooled {
+		currentRow = rowPool.Get().(*Row)
+		currentRow.pooled = true
+	} else {
+		currentRow = &Row{PrimaryKey: new(PrimaryKey)}
+	}
+	setRow(currentRow, row)
+	return currentRow, nil
+}
+
+var rowPool = sync.Pool{New: func() interface{} {
+	return &Row{PrimaryKey: new(PrimaryKey)}
+}}
+
+// Release returns a row leased by NextPooled to the pool. Neither the row nor
+// its primary key and columns may be used afterwards. It does nothing for
+// other rows, and rows already released, which would otherwise be leased
+// twice.
+func (row *Row) Release() {
+	if !row.pooled {
+		return
+	}
+	row.pooled = false
+	for _, pk := range row.PrimaryKey.PrimaryKeys {
+		*pk = PrimaryKeyColumn{}
+	}
+	for _, column := range row.Columns {
+		*column = AttributeColumn{}
+	}
+	row.PrimaryKey.PrimaryKeys = row.PrimaryKey.PrimaryKeys[:0]
+	row.Columns = row.Columns[:0]
+	rowPool.Put(row)
+}
+
+// setRow sets the primary key and columns of row to those of plainRow,
+// reusing the column objects row holds beyond its length, if any.
+func setRow(row *Row, plainRow *PlainBufferRow) {
+	pks := row.PrimaryKey.PrimaryKeys[:0]
+	for i, cell := range plainRow.primaryKey {
+		var pk *PrimaryKeyColumn
+		if i < cap(pks) {
+			pk = pks[:i+1][i]
+		}
+		if pk == nil {
+			pk = new(PrimaryKeyColumn)
+		}
+		*pk = PrimaryKeyColumn{ColumnName: cell.columnName(), Value: cell.cellValue.Value}
+		pks = append(pks, pk)
+	}
+	row.PrimaryKey.PrimaryKeys = pks
+
+	columns := row.Columns[:0]
+	for i, cell := range plainRow.cells {
+		var column *AttributeColumn
+		if i < cap(columns) {
+			column = columns[:i+1][i]
+		}
+		if column == nil {
+			column = new(AttributeColumn)
+		}
+		*column = AttributeColumn{ColumnName: cell.columnName(), Value: cell.value(), Timestamp: cell.cellTimestamp}
+		columns = append(columns, column)
+	}
+	row.Columns = columns
+}
@@ -0,0 +1,230 @@
+// Package salt spreads sequential partition keys, such as timestamps or
+// increasing ids, over several partitions by prefixing them with a hash
+// bucket, so that writes do not all hit the last partition:
+//
+//	salter := salt.New(16)
+//	pk := new(tablestore.PrimaryKey)
+//	pk.AddPrimaryKeyColumn("id", salter.Salt("20190102T150405-0001")) // "07:20190102T150405-0001"
+//
+// The bucket of a key only depends on the key and on the number of buckets,
+// which must not change once rows are written. Ranges of unsalted keys are
+// read by GetRange, which queries the buckets in parallel.
+package salt
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Separator ends the bucket prefix of salted keys.
+const Separator = ':'
+
+type Salter struct {
+	buckets int
+	width   int
+}
+
+// New returns a salter of keys over buckets buckets, at least 1.
+func New(buckets int) *Salter {
+	if buckets < 1 {
+		buckets = 1
+	}
+	return &Salter{buckets: buckets, width: len(strconv.Itoa(buckets - 1))}
+}
+
+func (salter *Salter) Buckets() int {
+	return salter.buckets
+}
+
+// Bucket returns the bucket of an unsalted key.
+func (salter *Salter) Bucket(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(salter.buckets))
+}
+
+// Prefix returns the prefix of the keys of a bucket, e.g. "07:".
+func (salter *Salter) Prefix(bucket int) string {
+	return fmt.Sprintf("%0*d%c", salter.width, bucket, Separator)
+}
+
+// Salt prefixes key with its bucket.
+func (salter *Salter) Salt(key string) string {
+	return salter.Prefix(salter.Bucket(key)) + key
+}
+
+// Unsalt strips the bucket prefix of a salted key.
+func (salter *Salter) Unsalt(salted string) (string, error) {
+	if len(salted) <= salter.width || salted[salter.width] != Separator {
+		return "", fmt.Errorf("[tablestore] %q is not a salted key", salted)
+	}
+	bucket, err := strconv.Atoi(salted[:salter.width])
+	if err != nil || bucket >= salter.buckets {
+		return "", fmt.Errorf("[tablestore] %q is not a salted key", salted)
+	}
+	return salted[salter.width+1:], nil
+}
+
+// SaltPrimaryKey returns a copy of pk whose first column, the partition key,
+// is salted. It must be a string.
+func (salter *Salter) SaltPrimaryKey(pk *tablestore.PrimaryKey) (*tablestore.PrimaryKey, error) {
+	return salter.mapPartitionKey(pk, func(key string) (string, error) {
+		return salter.Salt(key), nil
+	})
+}
+
+// UnsaltPrimaryKey returns a copy of pk whose partition key is unsalted.
+func (salter *Salter) UnsaltPrimaryKey(pk *tablestore.PrimaryKey) (*tablestore.PrimaryKey, error) {
+	return salter.mapPartitionKey(pk, salter.Unsalt)
+}
+
+func (salter *Salter) mapPartitionKey(pk *tablestore.PrimaryKey, f func(string) (string, error)) (*tablestore.PrimaryKey, error) {
+	if pk == nil || len(pk.PrimaryKeys) == 0 {
+		return nil, fmt.Errorf("[tablestore] empty primary key")
+	}
+	key, ok := pk.PrimaryKeys[0].Value.(string)
+	if !ok {
+		return nil, fmt.Errorf("[tablestore] partition key %s is not a string", pk.PrimaryKeys[0].ColumnName)
+	}
+	mapped, err := f(key)
+	if err != nil {
+		return nil, err
+	}
+	copied := &tablestore.PrimaryKey{PrimaryKeys: append([]*tablestore.PrimaryKeyColumn(nil), pk.PrimaryKeys...)}
+	copied.PrimaryKeys[0] = &tablestore.PrimaryKeyColumn{ColumnName: pk.PrimaryKeys[0].ColumnName, Value: mapped}
+	return copied, nil
+}
+
+// bucketBound returns the bound of a range of unsalted keys in a bucket.
+func (salter *Salter) bucketBound(pk *tablestore.PrimaryKey, bucket int) (*tablestore.PrimaryKey, error) {
+	if pk == nil || len(pk.PrimaryKeys) == 0 {
+		return nil, fmt.Errorf("[tablestore] empty primary key")
+	}
+	first := pk.PrimaryKeys[0]
+	prefix := salter.Prefix(bucket)
+	var value string
+	switch first.PrimaryKeyOption {
+	case tablestore.MIN:
+		value = prefix
+	case tablestore.MAX:
+		// above any key of the bucket
+		value = prefix[:len(prefix)-1] + string(Separator+1)
+	default:
+		key, ok := first.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("[tablestore] partition key %s is not a string", first.ColumnName)
+		}
+		value = prefix + key
+	}
+	bound := &tablestore.PrimaryKey{PrimaryKeys: append([]*tablestore.PrimaryKeyColumn(nil), pk.PrimaryKeys...)}
+	bound.PrimaryKeys[0] = &tablestore.PrimaryKeyColumn{ColumnName: first.ColumnName, Value: value}
+	return bound, nil
+}
+
+// GetRange reads the rows of all buckets between the unsalted start and end
+// primary keys of criteria, querying the buckets in parallel. Rows are
+// returned with unsalted keys, in the order of criteria.Direction, at most
+// criteria.Limit of them if it is positive.
+func (salter *Salter) GetRange(client tablestore.TableStoreApi, criteria *tablestore.RangeRowQueryCriteria) ([]*tablestore.Row, error) {
+	results := make([][]*tablestore.Row, salter.buckets)
+	errs := make([]error, salter.buckets)
+	var wg sync.WaitGroup
+	for bucket := 0; bucket < salter.buckets; bucket++ {
+		wg.Add(1)
+		go func(bucket int) {
+			defer wg.Done()
+			results[bucket], errs[bucket] = salter.getBucketRange(client, criteria, bucket)
+		}(bucket)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var rows []*tablestore.Row
+	for _, bucketRows := range results {
+		rows = append(rows, bucketRows...)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		c := comparePrimaryKeys(rows[i].PrimaryKey, rows[j].PrimaryKey)
+		if criteria.Direction == tablestore.BACKWARD {
+			return c > 0
+		}
+		return c < 0
+	})
+	if criteria.Limit > 0 && len(rows) > int(criteria.Limit) {
+		rows = rows[:criteria.Limit]
+	}
+	return rows, nil
+}
+
+func (salter *Salter) getBucketRange(client tablestore.TableStoreApi, criteria *tablestore.RangeRowQueryCriteria, bucket int) ([]*tablestore.Row, error) {
+	bucketCriteria := *criteria
+	var err error
+	if bucketCriteria.StartPrimaryKey, err = salter.bucketBound(criteria.StartPrimaryKey, bucket); err != nil {
+		return nil, err
+	}
+	if bucketCriteria.EndPrimaryKey, err = salter.bucketBound(criteria.EndPrimaryKey, bucket); err != nil {
+		return nil, err
+	}
+
+	var rows []*tablestore.Row
+	for {
+		resp, err := client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: &bucketCriteria})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range resp.Rows {
+			pk, err := salter.UnsaltPrimaryKey(row.PrimaryKey)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, &tablestore.Row{PrimaryKey: pk, Columns: row.Columns})
+		}
+		if resp.NextStartPrimaryKey == nil || (criteria.Limit > 0 && len(rows) >= int(criteria.Limit)) {
+			return rows, nil
+		}
+		bucketCriteria.StartPrimaryKey = resp.NextStartPrimaryKey
+	}
+}
+
+func comparePrimaryKeys(a, b *tablestore.PrimaryKey) int {
+	for i := 0; i < len(a.PrimaryKeys) && i < len(b.PrimaryKeys); i++ {
+		if c := compareValues(a.PrimaryKeys[i].Value, b.PrimaryKeys[i].Value); c != 0 {
+			return c
+		}
+	}
+	return len(a.PrimaryKeys) - len(b.PrimaryKeys)
+}
+
+func compareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b)
+		}
+	case int64:
+		if b, ok := b.(int64); ok {
+			switch {
+			case a < b:
+				return -1
+			case a > b:
+				return 1
+			}
+			return 0
+		}
+	case []byte:
+		if b, ok := b.([]byte); ok {
+			return bytes.Compare(a, b)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,85 @@
+package salt
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"strings"
+	"testing"
+)
+
+func TestSalter(t *testing.T) {
+	salter := New(16)
+	salted := salter.Salt("20190102-0001")
+	if !strings.HasPrefix(salted, salter.Prefix(salter.Bucket("20190102-0001"))) || len(salted) != len("20190102-0001")+3 {
+		t.Errorf("unexpected salted key %q", salted)
+	}
+	if key, err := salter.Unsalt(salted); err != nil || key != "20190102-0001" {
+		t.Errorf("unsalted %q, %v", key, err)
+	}
+	for _, invalid := range []string{"", "7:x", "99:x", "ab:x"} {
+		if _, err := salter.Unsalt(invalid); err == nil {
+			t.Errorf("%q unsalted", invalid)
+		}
+	}
+
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn("id", "k")
+	pk.AddPrimaryKeyColumn("seq", int64(1))
+	saltedPk, err := salter.SaltPrimaryKey(pk)
+	if err != nil || saltedPk.PrimaryKeys[0].Value != salter.Salt("k") || pk.PrimaryKeys[0].Value != "k" {
+		t.Errorf("unexpected salted primary key %v, %v", saltedPk, err)
+	}
+	if unsalted, err := salter.UnsaltPrimaryKey(saltedPk); err != nil || unsalted.PrimaryKeys[0].Value != "k" {
+		t.Errorf("unexpected unsalted primary key %v, %v", unsalted, err)
+	}
+}
+
+func TestGetRange(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	client := server.NewTableStoreClient()
+	meta := &tablestore.TableMeta{TableName: "t"}
+	meta.AddPrimaryKeyColumn("id", tablestore.PrimaryKeyType_STRING)
+	if _, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	salter := New(4)
+	for i := 0; i < 20; i++ {
+		change := &tablestore.PutRowChange{TableName: "t", PrimaryKey: new(tablestore.PrimaryKey)}
+		change.PrimaryKey.AddPrimaryKeyColumn("id", salter.Salt(fmt.Sprintf("k%02d", i)))
+		change.AddColumn("i", int64(i))
+		change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: change}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start, end := new(tablestore.PrimaryKey), new(tablestore.PrimaryKey)
+	start.AddPrimaryKeyColumn("id", "k05")
+	end.AddPrimaryKeyColumnWithMaxValue("id")
+	criteria := &tablestore.RangeRowQueryCriteria{TableName: "t", StartPrimaryKey: start, EndPrimaryKey: end, MaxVersion: 1, Limit: 3}
+	rows, err := salter.GetRange(client, criteria)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, row := range rows {
+		keys = append(keys, row.PrimaryKey.PrimaryKeys[0].Value.(string))
+	}
+	if strings.Join(keys, ",") != "k05,k06,k07" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+
+	start, end = new(tablestore.PrimaryKey), new(tablestore.PrimaryKey)
+	start.AddPrimaryKeyColumnWithMaxValue("id")
+	end.AddPrimaryKeyColumnWithMinValue("id")
+	criteria = &tablestore.RangeRowQueryCriteria{TableName: "t", StartPrimaryKey: start, EndPrimaryKey: end, MaxVersion: 1, Direction: tablestore.BACKWARD}
+	if rows, err = salter.GetRange(client, criteria); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 20 || rows[0].PrimaryKey.PrimaryKeys[0].Value != "k19" || rows[19].PrimaryKey.PrimaryKeys[0].Value != "k00" {
+		t.Errorf("unexpected backward range of %d rows", len(rows))
+	}
+}
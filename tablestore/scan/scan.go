@@ -0,0 +1,282 @@
+// Package scan reads a range of a table in parallel, splitting it by the
+// partitions of the table, as computed by ComputeSplitPointsBySize, read by a
+// pool of workers:
+//
+//	scanner, err := scan.New(ctx, client, criteria, scan.Options{Workers: 8, Ordered: true})
+//	if err != nil {
+//		return err
+//	}
+//	defer scanner.Close()
+//	for {
+//		row, err := scanner.Next()
+//		if err == io.EOF {
+//			break
+//		}
+//		...
+//	}
+package scan
+
+import (
+	"bytes"
+	"context"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type Options struct {
+	// splits read at once, 4 if 0
+	Workers int
+	// size of the splits in 100MB units, for ComputeSplitPointsBySize, 1 if 0
+	SplitSize int64
+	// split points of the table, e.g. computed once for many scans, instead
+	// of computing them
+	SplitPoints []*tablestore.PrimaryKey
+	// rows returned in the order of the range, as GetRange does, split after
+	// split; otherwise they are returned as they are read
+	Ordered bool
+}
+
+// page is a response of GetRange, or the error of a split.
+type page struct {
+	rows []*tablestore.Row
+	err  error
+}
+
+// Scanner returns the rows of the splits of a range read by its workers.
+type Scanner struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	client tablestore.TableStoreApi
+	ranges []*tablestore.RangeRowQueryCriteria
+	next   int64
+	wg     sync.WaitGroup
+
+	// ordered scanners read the pages of each split in turn
+	splits  []chan page
+	current int
+	shared  chan page
+
+	rows []*tablestore.Row
+	err  error
+}
+
+// New splits the range of criteria and starts reading it. The Limit of
+// criteria is the rows read per GetRange, the whole range being read. The
+// scanner must be closed.
+func New(ctx context.Context, client tablestore.TableStoreApi, criteria *tablestore.RangeRowQueryCriteria, options Options) (*Scanner, error) {
+	if options.Workers <= 0 {
+		options.Workers = 4
+	}
+	if options.SplitSize <= 0 {
+		options.SplitSize = 1
+	}
+	points := options.SplitPoints
+	if points == nil {
+		resp, err := client.ComputeSplitPointsBySize(&tablestore.ComputeSplitPointsBySizeRequest{TableName: criteria.TableName, SplitSize: options.SplitSize})
+		if err != nil {
+			return nil, err
+		}
+		for _, split := range resp.Splits {
+			points = append(points, split.LowerBound)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	scanner := &Scanner{ctx: ctx, cancel: cancel, client: client, ranges: splitRange(criteria, points)}
+	if options.Ordered {
+		scanner.splits = make([]chan page, len(scanner.ranges))
+		for i := range scanner.splits {
+			scanner.splits[i] = make(chan page, 1)
+		}
+	} else {
+		scanner.shared = make(chan page, options.Workers)
+	}
+	for w := 0; w < options.Workers && w < len(scanner.ranges); w++ {
+		scanner.wg.Add(1)
+		go scanner.work()
+	}
+	if !options.Ordered {
+		go func() {
+			scanner.wg.Wait()
+			close(scanner.shared)
+		}()
+	}
+	return scanner, nil
+}
+
+// splitRange splits the range of criteria at the points strictly within it.
+func splitRange(criteria *tablestore.RangeRowQueryCriteria, points []*tablestore.PrimaryKey) []*tablestore.RangeRowQueryCriteria {
+	// order of the range
+	compare := comparePrimaryKeys
+	if criteria.Direction == tablestore.BACKWARD {
+		compare = func(a, b *tablestore.PrimaryKey) int { return comparePrimaryKeys(b, a) }
+	}
+	var within []*tablestore.PrimaryKey
+	for _, point := range points {
+		if compare(criteria.StartPrimaryKey, point) < 0 && compare(point, criteria.EndPrimaryKey) < 0 {
+			within = append(within, point)
+		}
+	}
+	sort.Slice(within, func(i, j int) bool { return compare(within[i], within[j]) < 0 })
+
+	var ranges []*tablestore.RangeRowQueryCriteria
+	start := criteria.StartPrimaryKey
+	for _, point := range within {
+		if compare(start, point) == 0 {
+			continue
+		}
+		r := *criteria
+		r.StartPrimaryKey, r.EndPrimaryKey = start, point
+		ranges = append(ranges, &r)
+		start = point
+	}
+	last := *criteria
+	last.StartPrimaryKey = start
+	return append(ranges, &last)
+}
+
+// work reads the splits not taken yet, in order.
+func (scanner *Scanner) work() {
+	defer scanner.wg.Done()
+	for {
+		i := int(atomic.AddInt64(&scanner.next, 1) - 1)
+		if i >= len(scanner.ranges) || scanner.ctx.Err() != nil {
+			return
+		}
+		out := scanner.shared
+		if scanner.splits != nil {
+			out = scanner.splits[i]
+		}
+		ok := scanner.read(scanner.ranges[i], out)
+		if scanner.splits != nil {
+			close(out)
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// read sends the pages of the split of criteria to out, false if it failed
+// or the scanner is closed.
+func (scanner *Scanner) read(criteria *tablestore.RangeRowQueryCriteria, out chan page) bool {
+	c := *criteria
+	for {
+		resp, err := scanner.client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: &c})
+		p := page{err: err}
+		if err == nil {
+			p.rows = resp.Rows
+		}
+		if err != nil || len(p.rows) > 0 {
+			select {
+			case out <- p:
+			case <-scanner.ctx.Done():
+				return false
+			}
+		}
+		if err != nil {
+			return false
+		}
+		if resp.NextStartPrimaryKey == nil {
+			return true
+		}
+		c.StartPrimaryKey = resp.NextStartPrimaryKey
+	}
+}
+
+// Next returns the next row, io.EOF after the last one. Once it fails, the
+// scan stops and Next keeps returning the error.
+func (scanner *Scanner) Next() (*tablestore.Row, error) {
+	for len(scanner.rows) == 0 {
+		if scanner.err != nil {
+			return nil, scanner.err
+		}
+		var p page
+		var ok bool
+		in := scanner.shared
+		if scanner.splits != nil {
+			if scanner.current == len(scanner.splits) {
+				scanner.err = io.EOF
+				continue
+			}
+			in = scanner.splits[scanner.current]
+		}
+		select {
+		case p, ok = <-in:
+		case <-scanner.ctx.Done():
+			scanner.err = scanner.ctx.Err()
+			continue
+		}
+		switch {
+		case !ok && scanner.splits != nil:
+			scanner.current++
+		case !ok:
+			scanner.err = io.EOF
+		case p.err != nil:
+			scanner.err = p.err
+			scanner.cancel()
+		default:
+			scanner.rows = p.rows
+		}
+	}
+	row := scanner.rows[0]
+	scanner.rows = scanner.rows[1:]
+	return row, nil
+}
+
+// Close stops the workers and waits for them.
+func (scanner *Scanner) Close() {
+	scanner.cancel()
+	scanner.wg.Wait()
+}
+
+// comparePrimaryKeys orders primary keys of the same columns, infinite
+// values included.
+func comparePrimaryKeys(a, b *tablestore.PrimaryKey) int {
+	for i := 0; i < len(a.PrimaryKeys) && i < len(b.PrimaryKeys); i++ {
+		if c := compareColumns(a.PrimaryKeys[i], b.PrimaryKeys[i]); c != 0 {
+			return c
+		}
+	}
+	return len(a.PrimaryKeys) - len(b.PrimaryKeys)
+}
+
+func compareColumns(a, b *tablestore.PrimaryKeyColumn) int {
+	rank := func(column *tablestore.PrimaryKeyColumn) int {
+		switch column.PrimaryKeyOption {
+		case tablestore.MIN:
+			return -1
+		case tablestore.MAX:
+			return 1
+		}
+		return 0
+	}
+	if ra, rb := rank(a), rank(b); ra != rb || ra != 0 {
+		return ra - rb
+	}
+	switch av := a.Value.(type) {
+	case string:
+		if bv, ok := b.Value.(string); ok {
+			return strings.Compare(av, bv)
+		}
+	case int64:
+		if bv, ok := b.Value.(int64); ok {
+			switch {
+			case av < bv:
+				return -1
+			case av > bv:
+				return 1
+			}
+			return 0
+		}
+	case []byte:
+		if bv, ok := b.Value.([]byte); ok {
+			return bytes.Compare(av, bv)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,122 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"io"
+	"sort"
+	"testing"
+)
+
+func key(id string) *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn("id", id)
+	return pk
+}
+
+func bound(option tablestore.PrimaryKeyOption) *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+	if option == tablestore.MIN {
+		pk.AddPrimaryKeyColumnWithMinValue("id")
+	} else {
+		pk.AddPrimaryKeyColumnWithMaxValue("id")
+	}
+	return pk
+}
+
+// splitClient splits the table every 10 rows, and fails reading failing.
+type splitClient struct {
+	*tablestoretest.Client
+	failing string
+}
+
+func (client splitClient) ComputeSplitPointsBySize(request *tablestore.ComputeSplitPointsBySizeRequest) (*tablestore.ComputeSplitPointsBySizeResponse, error) {
+	resp := &tablestore.ComputeSplitPointsBySizeResponse{}
+	lower := bound(tablestore.MIN)
+	for _, id := range []string{"k10", "k20", "k30"} {
+		resp.Splits = append(resp.Splits, &tablestore.Split{LowerBound: lower, UpperBound: key(id)})
+		lower = key(id)
+	}
+	resp.Splits = append(resp.Splits, &tablestore.Split{LowerBound: lower, UpperBound: bound(tablestore.MAX)})
+	return resp, nil
+}
+
+func (client splitClient) GetRange(request *tablestore.GetRangeRequest) (*tablestore.GetRangeResponse, error) {
+	if client.failing != "" && request.RangeRowQueryCriteria.StartPrimaryKey.PrimaryKeys[0].Value == client.failing {
+		return nil, fmt.Errorf("failed")
+	}
+	return client.Client.GetRange(request)
+}
+
+func scanAll(t *testing.T, client tablestore.TableStoreApi, criteria *tablestore.RangeRowQueryCriteria, options Options) ([]string, error) {
+	scanner, err := New(context.Background(), client, criteria, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer scanner.Close()
+	var ids []string
+	for {
+		row, err := scanner.Next()
+		if err == io.EOF {
+			return ids, nil
+		}
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, row.PrimaryKey.PrimaryKeys[0].Value.(string))
+	}
+}
+
+func TestScan(t *testing.T) {
+	client := splitClient{Client: tablestoretest.NewClient()}
+	client.RangeLimit = 3
+	meta := &tablestore.TableMeta{TableName: "t"}
+	meta.AddPrimaryKeyColumn("id", tablestore.PrimaryKeyType_STRING)
+	if _, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 40; i++ {
+		change := &tablestore.PutRowChange{TableName: "t", PrimaryKey: key(fmt.Sprintf("k%02d", i))}
+		change.AddColumn("i", int64(i))
+		change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: change}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var expected []string
+	for i := 5; i < 35; i++ {
+		expected = append(expected, fmt.Sprintf("k%02d", i))
+	}
+	criteria := &tablestore.RangeRowQueryCriteria{TableName: "t", StartPrimaryKey: key("k05"), EndPrimaryKey: key("k35"), Direction: tablestore.FORWARD, MaxVersion: 1}
+	if ranges := splitRange(criteria, []*tablestore.PrimaryKey{key("k30"), bound(tablestore.MIN), key("k10"), key("k20"), key("k20")}); len(ranges) != 4 {
+		t.Errorf("%d ranges", len(ranges))
+	}
+
+	ids, err := scanAll(t, client, criteria, Options{Workers: 3, Ordered: true})
+	if err != nil || fmt.Sprint(ids) != fmt.Sprint(expected) {
+		t.Errorf("unexpected rows %v, %v", ids, err)
+	}
+
+	ids, err = scanAll(t, client, criteria, Options{Workers: 2})
+	sort.Strings(ids)
+	if err != nil || fmt.Sprint(ids) != fmt.Sprint(expected) {
+		t.Errorf("unexpected rows %v, %v", ids, err)
+	}
+
+	backward := *criteria
+	backward.StartPrimaryKey, backward.EndPrimaryKey, backward.Direction = key("k34"), key("k04"), tablestore.BACKWARD
+	ids, err = scanAll(t, client, &backward, Options{Ordered: true, SplitPoints: []*tablestore.PrimaryKey{key("k15"), key("k25")}})
+	if err != nil || len(ids) != 30 || ids[0] != "k34" || ids[29] != "k05" || !sort.IsSorted(sort.Reverse(sort.StringSlice(ids))) {
+		t.Errorf("unexpected rows %v, %v", ids, err)
+	}
+
+	client.failing = "k20"
+	for _, ordered := range []bool{true, false} {
+		if _, err := scanAll(t, client, criteria, Options{Workers: 2, Ordered: ordered}); err == nil || err.Error() != "failed" {
+			t.Errorf("expect failure: %v", err)
+		}
+	}
+}
@@ -1,12 +1,21 @@
 package search
 
-import "github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
+import (
+	"errors"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
+)
 
+// Collapse deduplicates the rows of a search by the value of a field, e.g.
+// one row per merchant: only the first row of each value, in the order of the
+// sort, is returned.
 type Collapse struct {
 	FieldName string
 }
 
 func (c *Collapse) ProtoBuffer() (*otsprotocol.Collapse, error) {
+	if c.FieldName == "" {
+		return nil, errors.New("Collapse: fieldName not set.")
+	}
 	pb := &otsprotocol.Collapse{
 		FieldName: &c.FieldName,
 	}
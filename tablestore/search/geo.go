@@ -0,0 +1,156 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// mean radius of the earth, in meters
+const earthRadius = 6371008.8
+
+// GeoPoint is a point of a GEO_POINT field, in degrees. Its String, "lat,lon",
+// is the value of the columns of the field and of the points of geo queries.
+type GeoPoint struct {
+	Lat float64
+	Lon float64
+}
+
+// NewGeoPoint returns the point, an error if lat is not within [-90, 90] or
+// lon within [-180, 180].
+func NewGeoPoint(lat, lon float64) (GeoPoint, error) {
+	point := GeoPoint{Lat: lat, Lon: lon}
+	return point, point.Err()
+}
+
+// ParseGeoPoint parses the "lat,lon" value of a GEO_POINT column.
+func ParseGeoPoint(s string) (GeoPoint, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return GeoPoint{}, fmt.Errorf("GeoPoint: invalid point %q.", s)
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return GeoPoint{}, fmt.Errorf("GeoPoint: invalid point %q.", s)
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return GeoPoint{}, fmt.Errorf("GeoPoint: invalid point %q.", s)
+	}
+	return NewGeoPoint(lat, lon)
+}
+
+func (p GeoPoint) Err() error {
+	if math.IsNaN(p.Lat) || p.Lat < -90 || p.Lat > 90 {
+		return fmt.Errorf("GeoPoint: latitude %v out of [-90, 90].", p.Lat)
+	}
+	if math.IsNaN(p.Lon) || p.Lon < -180 || p.Lon > 180 {
+		return fmt.Errorf("GeoPoint: longitude %v out of [-180, 180].", p.Lon)
+	}
+	return nil
+}
+
+func (p GeoPoint) String() string {
+	return strconv.FormatFloat(p.Lat, 'f', -1, 64) + "," + strconv.FormatFloat(p.Lon, 'f', -1, 64)
+}
+
+// BoundingBox returns the corners of the smallest box, of the parallels and
+// meridians, holding the circle of radius meters around center. Boxes
+// crossing the antimeridian have a top left longitude above the bottom right
+// one; boxes reaching a pole hold all the longitudes.
+func BoundingBox(center GeoPoint, radius float64) (topLeft, bottomRight GeoPoint) {
+	delta := radius / earthRadius * 180 / math.Pi
+	top, bottom := center.Lat+delta, center.Lat-delta
+	if top >= 90 || bottom <= -90 {
+		return GeoPoint{Lat: math.Min(top, 90), Lon: -180}, GeoPoint{Lat: math.Max(bottom, -90), Lon: 180}
+	}
+	// the longitudes of the tangent meridians of the circle
+	ratio := math.Sin(radius/earthRadius) / math.Cos(center.Lat*math.Pi/180)
+	if ratio >= 1 {
+		return GeoPoint{Lat: top, Lon: -180}, GeoPoint{Lat: bottom, Lon: 180}
+	}
+	lonDelta := math.Asin(ratio) * 180 / math.Pi
+	return GeoPoint{Lat: top, Lon: wrapLongitude(center.Lon - lonDelta)}, GeoPoint{Lat: bottom, Lon: wrapLongitude(center.Lon + lonDelta)}
+}
+
+func wrapLongitude(lon float64) float64 {
+	switch {
+	case lon < -180:
+		return lon + 360
+	case lon > 180:
+		return lon - 360
+	}
+	return lon
+}
+
+// NewGeoBoundingBoxQuery returns the query of the points of the field within
+// the BoundingBox of the circle of radius meters around center.
+func NewGeoBoundingBoxQuery(fieldName string, center GeoPoint, radius float64) (*GeoBoundingBoxQuery, error) {
+	if err := center.Err(); err != nil {
+		return nil, err
+	}
+	if radius <= 0 {
+		return nil, errors.New("GeoBoundingBoxQuery: radius not positive.")
+	}
+	topLeft, bottomRight := BoundingBox(center, radius)
+	return &GeoBoundingBoxQuery{FieldName: fieldName, TopLeft: topLeft.String(), BottomRight: bottomRight.String()}, nil
+}
+
+// NewGeoDistanceQuery returns the query of the points of the field within
+// distance meters of center.
+func NewGeoDistanceQuery(fieldName string, center GeoPoint, distance float64) (*GeoDistanceQuery, error) {
+	if err := center.Err(); err != nil {
+		return nil, err
+	}
+	if distance <= 0 {
+		return nil, errors.New("GeoDistanceQuery: distance not positive.")
+	}
+	return &GeoDistanceQuery{FieldName: fieldName, CenterPoint: center.String(), DistanceInMeter: distance}, nil
+}
+
+// NewGeoPolygonQuery returns the query of the points of the field within the
+// polygon of vertices points.
+func NewGeoPolygonQuery(fieldName string, points []GeoPoint) (*GeoPolygonQuery, error) {
+	if err := validatePolygon(points); err != nil {
+		return nil, err
+	}
+	query := &GeoPolygonQuery{FieldName: fieldName}
+	for _, point := range points {
+		query.Points = append(query.Points, point.String())
+	}
+	return query, nil
+}
+
+// PolygonWKT returns the polygon of vertices points as well-known text,
+// "POLYGON((lon lat, ...))", its ring closed.
+func PolygonWKT(points []GeoPoint) (string, error) {
+	if err := validatePolygon(points); err != nil {
+		return "", err
+	}
+	if points[0] != points[len(points)-1] {
+		points = append(points[:len(points):len(points)], points[0])
+	}
+	coordinates := make([]string, len(points))
+	for i, point := range points {
+		coordinates[i] = strconv.FormatFloat(point.Lon, 'f', -1, 64) + " " + strconv.FormatFloat(point.Lat, 'f', -1, 64)
+	}
+	return "POLYGON((" + strings.Join(coordinates, ", ") + "))", nil
+}
+
+// validatePolygon checks the vertices of a polygon, at least 3 distinct
+// ones, its ring possibly closed.
+func validatePolygon(points []GeoPoint) error {
+	distinct := make(map[GeoPoint]bool, len(points))
+	for _, point := range points {
+		if err := point.Err(); err != nil {
+			return err
+		}
+		distinct[point] = true
+	}
+	if len(distinct) < 3 {
+		return errors.New("GeoPolygon: less than 3 distinct points.")
+	}
+	return nil
+}
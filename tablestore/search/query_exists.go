@@ -0,0 +1,42 @@
+package search
+
+import (
+	"errors"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
+	"github.com/golang/protobuf/proto"
+)
+
+// ExistsQuery matches the rows with a value of the field, the rows without
+// the column being null for the index. The rows where it is null are matched
+// by NewIsNullQuery.
+type ExistsQuery struct {
+	FieldName string
+}
+
+func (q *ExistsQuery) Type() QueryType {
+	return QueryType_ExistsQuery
+}
+
+// Serialize encodes the ExistsQuery message of the protocol, of a single
+// field_name = 1, not known to otsprotocol.
+func (q *ExistsQuery) Serialize() ([]byte, error) {
+	if q.FieldName == "" {
+		return nil, errors.New("ExistsQuery: fieldName not set.")
+	}
+	buf := proto.NewBuffer(nil)
+	buf.EncodeVarint(1<<3 | proto.WireBytes)
+	buf.EncodeStringBytes(q.FieldName)
+	return buf.Bytes(), nil
+}
+
+func (q *ExistsQuery) ProtoBuffer() (*otsprotocol.Query, error) {
+	return BuildPBForQuery(q)
+}
+
+// NewIsNullQuery returns the query matching the rows without a value of the
+// field.
+func NewIsNullQuery(fieldName string) *BoolQuery {
+	return &BoolQuery{
+		MustNotQueries: []Query{&ExistsQuery{FieldName: fieldName}},
+	}
+}
@@ -1,6 +1,7 @@
 package search
 
 import (
+	"errors"
 	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
 	"github.com/golang/protobuf/proto"
 )
@@ -15,6 +16,10 @@ const (
 	ScoreMode_Min   ScoreModeType = 5
 )
 
+// NestedQuery matches the rows of which an object of the nested field Path
+// matches Query, on the fields of the objects, e.g. "items.price". ScoreMode
+// sets how the scores of the objects matched make the score of the row, the
+// default of the service if 0.
 type NestedQuery struct {
 	Path      string
 	Query     Query
@@ -26,6 +31,12 @@ func (q *NestedQuery) Type() QueryType {
 }
 
 func (q *NestedQuery) Serialize() ([]byte, error) {
+	if q.Path == "" {
+		return nil, errors.New("NestedQuery: path not set.")
+	}
+	if q.Query == nil {
+		return nil, errors.New("NestedQuery: query not set.")
+	}
 	query := &otsprotocol.NestedQuery{}
 	pbQ, err := q.Query.ProtoBuffer()
 	if err != nil {
@@ -44,6 +55,9 @@ func (q *NestedQuery) Serialize() ([]byte, error) {
 		query.ScoreMode = otsprotocol.ScoreMode_SCORE_MODE_MIN.Enum()
 	case ScoreMode_Total:
 		query.ScoreMode = otsprotocol.ScoreMode_SCORE_MODE_TOTAL.Enum()
+	case 0:
+	default:
+		return nil, errors.New("NestedQuery: unknown score mode.")
 	}
 	data, err := proto.Marshal(query)
 	return data, err
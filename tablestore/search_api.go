@@ -1,7 +1,6 @@
 package tablestore
 
 import (
-	"bytes"
 	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
 	"github.com/golang/protobuf/proto"
 	"errors"
@@ -9,6 +8,11 @@ import (
 )
 
 func (tableStoreClient *TableStoreClient) CreateSearchIndex(request *CreateSearchIndexRequest) (*CreateSearchIndexResponse, error) {
+	if request.IndexSchema.IndexSetting != nil {
+		if err := request.IndexSchema.IndexSetting.Err(); err != nil {
+			return nil, err
+		}
+	}
 	req := new(otsprotocol.CreateSearchIndexRequest)
 	req.TableName = proto.String(request.TableName)
 	req.IndexName = proto.String(request.IndexName)
@@ -94,32 +98,45 @@ func (tableStoreClient *TableStoreClient) Search(request *SearchRequest) (*Searc
 	if err := tableStoreClient.doRequestWithRetry(searchUri, req, resp, &response.ResponseInfo); err != nil {
 		return nil, err
 	}
-	response.TotalCount = *resp.TotalHits
+	response.TotalCount = -1
+	if resp.TotalHits != nil {
+		response.TotalCount = *resp.TotalHits
+	}
 
 	rows := make([]*PlainBufferRow, 0)
+	names := make(interner)
 	for _, buf := range resp.Rows {
-		row, err := readRowsWithHeader(bytes.NewReader(buf))
+		row, err := tableStoreClient.newReader(buf, names).readSingleRow()
 		if err != nil {
 			return nil, err
 		}
-		rows = append(rows, row[0])
+		rows = append(rows, row)
 	}
 
 	for _, row := range rows {
 		currentRow := &Row{}
 		currentPk := new(PrimaryKey)
 		for _, pk := range row.primaryKey {
-			pkColumn := &PrimaryKeyColumn{ColumnName: string(pk.cellName), Value: pk.cellValue.Value}
+			pkColumn := &PrimaryKeyColumn{ColumnName: pk.columnName(), Value: pk.cellValue.Value}
 			currentPk.PrimaryKeys = append(currentPk.PrimaryKeys, pkColumn)
 		}
 		currentRow.PrimaryKey = currentPk
 		for _, cell := range row.cells {
-			dataColumn := &AttributeColumn{ColumnName: string(cell.cellName), Value: cell.cellValue.Value, Timestamp: cell.cellTimestamp}
+			dataColumn := &AttributeColumn{ColumnName: cell.columnName(), Value: cell.value(), Timestamp: cell.cellTimestamp}
 			currentRow.Columns = append(currentRow.Columns, dataColumn)
 		}
 		response.Rows = append(response.Rows, currentRow)
 	}
 
-	response.IsAllSuccess = *resp.IsAllSucceeded
+	response.IsAllSuccess = resp.GetIsAllSucceeded()
+	if len(resp.XXX_unrecognized) > 0 {
+		scores, err := parseSearchHitScores(resp.XXX_unrecognized)
+		if err != nil {
+			return nil, err
+		}
+		if len(scores) == len(response.Rows) {
+			response.Scores = scores
+		}
+	}
 	return response, nil
 }
@@ -0,0 +1,107 @@
+package tablestore
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/search"
+	"time"
+)
+
+// DateFormat tells how the dates of a field are stored, search indexes having
+// no date type: epoch milliseconds of a LONG field if Layout is "", otherwise
+// strings of Layout, in Location, of a KEYWORD field, e.g. time.RFC3339.
+// Location, UTC if nil, is also the location of the times parsed.
+type DateFormat struct {
+	Layout   string
+	Location *time.Location
+}
+
+func (format DateFormat) location() *time.Location {
+	if format.Location == nil {
+		return time.UTC
+	}
+	return format.Location
+}
+
+// Parse returns the time of value, the value of a column of a date field.
+func (format DateFormat) Parse(value interface{}) (time.Time, error) {
+	if format.Layout == "" {
+		millis, ok := value.(int64)
+		if !ok {
+			return time.Time{}, fmt.Errorf("[tablestore] date of type %T, not epoch milliseconds", value)
+		}
+		return time.Unix(millis/1000, millis%1000*int64(time.Millisecond)).In(format.location()), nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return time.Time{}, fmt.Errorf("[tablestore] date of type %T, not a string", value)
+	}
+	t, err := time.ParseInLocation(format.Layout, s, format.location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("[tablestore] invalid date %q: %v", s, err)
+	}
+	return t.In(format.location()), nil
+}
+
+// Format returns the value of t in a column of a date field, or in a query.
+func (format DateFormat) Format(t time.Time) interface{} {
+	if format.Layout == "" {
+		return t.UnixNano() / int64(time.Millisecond)
+	}
+	return t.In(format.location()).Format(format.Layout)
+}
+
+// DateAggregation computes the latest or earliest date of a field among the
+// rows matching Query, all the rows if nil, by sorting them by the field: its
+// values must be sortable, and the strings of a Layout must sort as their
+// dates do, e.g. "2006-01-02 15:04:05" in a single Location.
+type DateAggregation struct {
+	TableName     string
+	IndexName     string
+	Query         search.Query
+	FieldName     string
+	Format        DateFormat
+	RoutingValues []*PrimaryKey
+}
+
+// Max returns the latest date of the field, false if no row has one.
+func (aggregation *DateAggregation) Max(client TableStoreApi) (time.Time, bool, error) {
+	return aggregation.first(client, search.SortOrder_DESC)
+}
+
+// Min returns the earliest date of the field, false if no row has one.
+func (aggregation *DateAggregation) Min(client TableStoreApi) (time.Time, bool, error) {
+	return aggregation.first(client, search.SortOrder_ASC)
+}
+
+// first returns the date of the first row of the rows with the field, in the
+// order of the field.
+func (aggregation *DateAggregation) first(client TableStoreApi, order search.SortOrder) (time.Time, bool, error) {
+	query := &search.BoolQuery{MustQueries: []search.Query{&search.ExistsQuery{FieldName: aggregation.FieldName}}}
+	if aggregation.Query != nil {
+		query.MustQueries = append(query.MustQueries, aggregation.Query)
+	}
+	searchQuery := search.NewSearchQuery().SetQuery(query).SetLimit(1)
+	searchQuery.SetSort(&search.Sort{Sorters: []search.Sorter{&search.FieldSort{FieldName: aggregation.FieldName, Order: order.Enum()}}})
+	resp, err := client.Search(&SearchRequest{
+		TableName:     aggregation.TableName,
+		IndexName:     aggregation.IndexName,
+		SearchQuery:   searchQuery,
+		ColumnsToGet:  &ColumnsToGet{Columns: []string{aggregation.FieldName}},
+		RoutingValues: aggregation.RoutingValues,
+	})
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if len(resp.Rows) == 0 {
+		return time.Time{}, false, nil
+	}
+	value, ok := resp.Rows[0].LookupColumn(aggregation.FieldName)
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	t, err := aggregation.Format.Parse(value)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return t, true, nil
+}
@@ -4,7 +4,11 @@ import (
 	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
 	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/search"
 	"github.com/golang/protobuf/proto"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 )
 
 type ColumnsToGet struct {
@@ -17,6 +21,8 @@ type SearchRequest struct {
 	IndexName     string
 	SearchQuery   search.SearchQuery
 	ColumnsToGet  *ColumnsToGet
+	// values of the routing fields of the index, see IndexSetting.RoutingValue,
+	// to only read the shards of the rows of these values
 	RoutingValues []*PrimaryKey
 }
 
@@ -72,6 +78,9 @@ func (r *SearchRequest) ProtoBuffer() (*otsprotocol.SearchRequest, error) {
 	req.ColumnsToGet = pbColumns
 	if r.RoutingValues != nil {
 		for _, routingValue := range r.RoutingValues {
+			if routingValue == nil || len(routingValue.PrimaryKeys) == 0 {
+				return nil, errors.New("[tablestore] empty routing value")
+			}
 			req.RoutingValues = append(req.RoutingValues, routingValue.Build(false))
 		}
 	}
@@ -79,12 +88,98 @@ func (r *SearchRequest) ProtoBuffer() (*otsprotocol.SearchRequest, error) {
 }
 
 type SearchResponse struct {
+	// rows matching the query, -1 if the service did not count them
 	TotalCount   int64
 	Rows         []*Row
 	IsAllSuccess bool
+	// relevance scores of Rows, in the same order, nil if the service did not
+	// return them
+	Scores []float64
 	ResponseInfo
 }
 
+func (r *SearchResponse) GetTotalCount() int64 {
+	if r == nil {
+		return -1
+	}
+	return r.TotalCount
+}
+
+func (r *SearchResponse) GetIsAllSucceeded() bool {
+	return r != nil && r.IsAllSuccess
+}
+
+// GetScore returns the relevance score of the row i, false if there is none.
+func (r *SearchResponse) GetScore(i int) (float64, bool) {
+	if r == nil || i < 0 || i >= len(r.Scores) {
+		return 0, false
+	}
+	return r.Scores[i], true
+}
+
+// parseSearchHitScores returns the scores of the hits of a search response,
+// the repeated SearchHit search_hits = 5 of the protocol with their optional
+// double score = 3, which otsprotocol.SearchResponse does not know and keeps
+// in its unrecognized fields.
+func parseSearchHitScores(unrecognized []byte) ([]float64, error) {
+	var scores []float64
+	err := walkFields(unrecognized, func(number, wire uint64, hit []byte) error {
+		if number != 5 || wire != proto.WireBytes {
+			return nil
+		}
+		scores = append(scores, 0)
+		return walkFields(hit, func(number, wire uint64, value []byte) error {
+			if number == 3 && wire == proto.WireFixed64 {
+				scores[len(scores)-1] = math.Float64frombits(binary.LittleEndian.Uint64(value))
+			}
+			return nil
+		})
+	})
+	return scores, err
+}
+
+// walkFields calls field with the number, the wire type and the encoded
+// value of each field of the message data, the content of length-delimited
+// ones.
+func walkFields(data []byte, field func(number, wire uint64, value []byte) error) error {
+	for len(data) > 0 {
+		key, n := proto.DecodeVarint(data)
+		if n == 0 {
+			return errCorruptedSearchResponse
+		}
+		data = data[n:]
+		var value []byte
+		switch wire := key & 7; wire {
+		case proto.WireVarint:
+			if _, n = proto.DecodeVarint(data); n == 0 {
+				return errCorruptedSearchResponse
+			}
+			value, data = data[:n], data[n:]
+		case proto.WireFixed64, proto.WireFixed32:
+			size := 8
+			if wire == proto.WireFixed32 {
+				size = 4
+			}
+			if len(data) < size {
+				return errCorruptedSearchResponse
+			}
+			value, data = data[:size], data[size:]
+		case proto.WireBytes:
+			size, n := proto.DecodeVarint(data)
+			if n == 0 || size > uint64(len(data)-n) {
+				return errCorruptedSearchResponse
+			}
+			value, data = data[n:n+int(size)], data[n+int(size):]
+		default:
+			return errCorruptedSearchResponse
+		}
+		if err := field(key>>3, key&7, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func convertFieldSchemaToPBFieldSchema(fieldSchemas []*FieldSchema) []*otsprotocol.FieldSchema {
 	var schemas []*otsprotocol.FieldSchema
 	for _, value := range fieldSchemas {
@@ -167,7 +262,7 @@ func parseFieldSchemaFromPbFieldSchema(pbFieldSchemas []*otsprotocol.FieldSchema
 func parseFromPbSchema(pbSchema *otsprotocol.IndexSchema) *IndexSchema {
 	schema := &IndexSchema{
 		IndexSetting: &IndexSetting{
-			RoutingFields: pbSchema.IndexSetting.RoutingFields,
+			RoutingFields: pbSchema.GetIndexSetting().GetRoutingFields(),
 		},
 	}
 	schema.FieldSchemas = parseFieldSchemaFromPbFieldSchema(pbSchema.GetFieldSchemas())
@@ -227,10 +322,58 @@ func (fs *FieldSchema) String() string {
 	return string(out)
 }
 
+// IndexSetting sets the routing fields of an index, primary key columns of
+// the table: the rows of the same values of these columns are written to the
+// same shard of the index, and searches given these values, see
+// SearchRequest.AddRoutingValue, only read the shards of the values.
 type IndexSetting struct {
 	RoutingFields []string
 }
 
+// Err returns the problems of the routing fields, nil if there are none:
+// invalid or repeated names, more fields than primary key columns.
+func (setting *IndexSetting) Err() error {
+	v := new(validation)
+	if len(setting.RoutingFields) > maxPrimaryKeyColumns {
+		v.addf("%d routing fields, %d at most", len(setting.RoutingFields), maxPrimaryKeyColumns)
+	}
+	names := make(map[string]bool, len(setting.RoutingFields))
+	for _, name := range setting.RoutingFields {
+		v.add(validateColumnName(name))
+		if names[name] {
+			v.addf("routing field %s repeated", name)
+		}
+		names[name] = true
+	}
+	return v.err()
+}
+
+// RoutingValue returns the routing value of the row of pk, its columns of the
+// routing fields in their order, for SearchRequest.AddRoutingValue; an error
+// if one is missing.
+func (setting *IndexSetting) RoutingValue(pk *PrimaryKey) (*PrimaryKey, error) {
+	if len(setting.RoutingFields) == 0 {
+		return nil, errors.New("[tablestore] no routing fields")
+	}
+	value := new(PrimaryKey)
+	for _, name := range setting.RoutingFields {
+		var found *PrimaryKeyColumn
+		if pk != nil {
+			for _, column := range pk.PrimaryKeys {
+				if column.ColumnName == name {
+					found = column
+					break
+				}
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("[tablestore] missing routing field %s", name)
+		}
+		value.PrimaryKeys = append(value.PrimaryKeys, &PrimaryKeyColumn{ColumnName: name, Value: cloneValue(found.Value)})
+	}
+	return value, nil
+}
+
 type CreateSearchIndexRequest struct {
 	TableName   string
 	IndexName   string
@@ -0,0 +1,276 @@
+// Package shard spreads a logical table over several tables, e.g. to go past
+// the throughput of a single table, placing rows by consistent hashing of
+// their partition key:
+//
+//	ring := shard.New([]string{"events_0", "events_1", "events_2"}, 0)
+//	table, err := ring.Table(pk) // the table of the row of pk
+//	results, err := ring.BatchWriteRow(client, changes)
+//	rows, err := ring.GetRange(client, criteria)
+//
+// All the rows of a partition key are in the same table. Adding a table to
+// the ring moves about 1/n of the partition keys, to the table added only;
+// the rows of the keys moved have to be copied by the caller.
+package shard
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Ring places partition keys on tables.
+type Ring struct {
+	tables []string
+	points []point
+}
+
+// point is a virtual node of a table on the ring.
+type point struct {
+	hash  uint64
+	table int
+}
+
+// New returns the ring of tables, each placed at replicas points of the ring,
+// 128 if 0. The placement of keys only depends on the names of the tables and
+// on replicas.
+func New(tables []string, replicas int) *Ring {
+	if replicas <= 0 {
+		replicas = 128
+	}
+	ring := &Ring{tables: append([]string(nil), tables...)}
+	for i, table := range tables {
+		for r := 0; r < replicas; r++ {
+			ring.points = append(ring.points, point{hash: hash([]byte(table + "#" + strconv.Itoa(r))), table: i})
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool {
+		if ring.points[i].hash != ring.points[j].hash {
+			return ring.points[i].hash < ring.points[j].hash
+		}
+		return ring.tables[ring.points[i].table] < ring.tables[ring.points[j].table]
+	})
+	return ring
+}
+
+func hash(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	// mix the bits, FNV hashes of similar names being close
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+func (ring *Ring) Tables() []string {
+	return append([]string(nil), ring.tables...)
+}
+
+// Table returns the table of the rows of the partition key of pk, its first
+// column.
+func (ring *Ring) Table(pk *tablestore.PrimaryKey) (string, error) {
+	if len(ring.tables) == 0 {
+		return "", fmt.Errorf("[tablestore] empty ring of tables")
+	}
+	if pk == nil || len(pk.PrimaryKeys) == 0 {
+		return "", fmt.Errorf("[tablestore] empty primary key")
+	}
+	var key []byte
+	switch value := pk.PrimaryKeys[0].Value.(type) {
+	case string:
+		key = []byte(value)
+	case []byte:
+		key = value
+	case int64:
+		key = make([]byte, 8)
+		binary.BigEndian.PutUint64(key, uint64(value))
+	default:
+		return "", fmt.Errorf("[tablestore] invalid partition key %s", pk.PrimaryKeys[0].ColumnName)
+	}
+	h := hash(key)
+	i := sort.Search(len(ring.points), func(i int) bool { return ring.points[i].hash >= h })
+	if i == len(ring.points) {
+		i = 0
+	}
+	return ring.tables[ring.points[i].table], nil
+}
+
+// Route returns a copy of change writing to the table of its row.
+func (ring *Ring) Route(change tablestore.RowChange) (tablestore.RowChange, error) {
+	switch change := change.(type) {
+	case *tablestore.PutRowChange:
+		routed := *change
+		var err error
+		routed.TableName, err = ring.Table(change.PrimaryKey)
+		return &routed, err
+	case *tablestore.UpdateRowChange:
+		routed := *change
+		var err error
+		routed.TableName, err = ring.Table(change.PrimaryKey)
+		return &routed, err
+	case *tablestore.DeleteRowChange:
+		routed := *change
+		var err error
+		routed.TableName, err = ring.Table(change.PrimaryKey)
+		return &routed, err
+	}
+	return nil, fmt.Errorf("[tablestore] unsupported row change %T", change)
+}
+
+// BatchWriteRow writes changes to the tables of their rows, their table names
+// ignored, by BatchWriteRow requests of 200 changes at most to each table
+// sent in parallel. It returns the results of changes, in order, their
+// Index the index of the change.
+func (ring *Ring) BatchWriteRow(client tablestore.TableStoreApi, changes []tablestore.RowChange) ([]tablestore.RowResult, error) {
+	type batch struct {
+		table   string
+		indexes []int
+		request *tablestore.BatchWriteRowRequest
+	}
+	var batches []*batch
+	open := make(map[string]*batch)
+	for i, change := range changes {
+		routed, err := ring.Route(change)
+		if err != nil {
+			return nil, err
+		}
+		table := routed.GetTableName()
+		b := open[table]
+		if b == nil || len(b.indexes) == 200 {
+			b = &batch{table: table, request: new(tablestore.BatchWriteRowRequest)}
+			open[table] = b
+			batches = append(batches, b)
+		}
+		b.indexes = append(b.indexes, i)
+		b.request.AddRowChange(routed)
+	}
+
+	results := make([]tablestore.RowResult, len(changes))
+	errs := make([]error, len(batches))
+	var wg sync.WaitGroup
+	for i, b := range batches {
+		wg.Add(1)
+		go func(i int, b *batch) {
+			defer wg.Done()
+			resp, err := client.BatchWriteRow(b.request)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			rows := resp.TableToRowsResult[b.table]
+			if len(rows) != len(b.indexes) {
+				errs[i] = fmt.Errorf("[tablestore] %d results of %d changes to %s", len(rows), len(b.indexes), b.table)
+				return
+			}
+			for j, index := range b.indexes {
+				results[index] = rows[j]
+				results[index].Index = int32(index)
+			}
+		}(i, b)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// GetRange reads the rows between the start and end primary keys of criteria
+// in all the tables, its table name ignored, querying them in parallel. Rows
+// are returned in the order of criteria.Direction, at most criteria.Limit of
+// them if it is positive.
+func (ring *Ring) GetRange(client tablestore.TableStoreApi, criteria *tablestore.RangeRowQueryCriteria) ([]*tablestore.Row, error) {
+	results := make([][]*tablestore.Row, len(ring.tables))
+	errs := make([]error, len(ring.tables))
+	var wg sync.WaitGroup
+	for i, table := range ring.tables {
+		wg.Add(1)
+		go func(i int, table string) {
+			defer wg.Done()
+			results[i], errs[i] = getRange(client, criteria, table)
+		}(i, table)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var rows []*tablestore.Row
+	for _, tableRows := range results {
+		rows = append(rows, tableRows...)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		c := comparePrimaryKeys(rows[i].PrimaryKey, rows[j].PrimaryKey)
+		if criteria.Direction == tablestore.BACKWARD {
+			return c > 0
+		}
+		return c < 0
+	})
+	if criteria.Limit > 0 && len(rows) > int(criteria.Limit) {
+		rows = rows[:criteria.Limit]
+	}
+	return rows, nil
+}
+
+func getRange(client tablestore.TableStoreApi, criteria *tablestore.RangeRowQueryCriteria, table string) ([]*tablestore.Row, error) {
+	tableCriteria := *criteria
+	tableCriteria.TableName = table
+	var rows []*tablestore.Row
+	for {
+		resp, err := client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: &tableCriteria})
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, resp.Rows...)
+		if resp.NextStartPrimaryKey == nil || (criteria.Limit > 0 && len(rows) >= int(criteria.Limit)) {
+			return rows, nil
+		}
+		tableCriteria.StartPrimaryKey = resp.NextStartPrimaryKey
+	}
+}
+
+func comparePrimaryKeys(a, b *tablestore.PrimaryKey) int {
+	for i := 0; i < len(a.PrimaryKeys) && i < len(b.PrimaryKeys); i++ {
+		if c := compareValues(a.PrimaryKeys[i].Value, b.PrimaryKeys[i].Value); c != 0 {
+			return c
+		}
+	}
+	return len(a.PrimaryKeys) - len(b.PrimaryKeys)
+}
+
+func compareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b)
+		}
+	case int64:
+		if b, ok := b.(int64); ok {
+			switch {
+			case a < b:
+				return -1
+			case a > b:
+				return 1
+			}
+			return 0
+		}
+	case []byte:
+		if b, ok := b.([]byte); ok {
+			return bytes.Compare(a, b)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,123 @@
+package shard
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"testing"
+)
+
+func key(id string) *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn("id", id)
+	return pk
+}
+
+func TestRing(t *testing.T) {
+	ring := New([]string{"t0", "t1", "t2"}, 0)
+	counts := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		table, err := ring.Table(key(fmt.Sprintf("k%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[table]++
+	}
+	for _, table := range ring.Tables() {
+		if counts[table] < 600 {
+			t.Errorf("%d keys in %s", counts[table], table)
+		}
+	}
+
+	grown := New([]string{"t0", "t1", "t2", "t3"}, 0)
+	moved := 0
+	for i := 0; i < 3000; i++ {
+		pk := key(fmt.Sprintf("k%d", i))
+		before, _ := ring.Table(pk)
+		after, _ := grown.Table(pk)
+		if before != after {
+			moved++
+			if after != "t3" {
+				t.Errorf("%v moved from %s to %s", pk, before, after)
+			}
+		}
+	}
+	if moved == 0 || moved > 1200 {
+		t.Errorf("%d keys moved", moved)
+	}
+
+	if _, err := New(nil, 0).Table(key("k")); err == nil {
+		t.Error("table of an empty ring")
+	}
+	invalid := new(tablestore.PrimaryKey)
+	invalid.AddPrimaryKeyColumnWithMinValue("id")
+	if _, err := ring.Table(invalid); err == nil {
+		t.Error("table of an invalid primary key")
+	}
+}
+
+func TestBatchWriteRowGetRange(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	server.Store.RangeLimit = 3
+	client := server.NewTableStoreClient()
+	tables := []string{"t0", "t1", "t2"}
+	for _, table := range tables {
+		meta := &tablestore.TableMeta{TableName: table}
+		meta.AddPrimaryKeyColumn("id", tablestore.PrimaryKeyType_STRING)
+		if _, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ring := New(tables, 0)
+	var changes []tablestore.RowChange
+	for i := 0; i < 250; i++ {
+		change := &tablestore.PutRowChange{TableName: "logical", PrimaryKey: key(fmt.Sprintf("k%03d", i))}
+		change.AddColumn("i", int64(i))
+		change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		changes = append(changes, change)
+	}
+	results, err := ring.BatchWriteRow(client, changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, result := range results {
+		if !result.IsSucceed || result.Index != int32(i) {
+			t.Errorf("unexpected result %d: %+v", i, result)
+		}
+	}
+	if changes[0].GetTableName() != "logical" {
+		t.Error("change modified")
+	}
+	for _, i := range []int{0, 99, 249} {
+		pk := key(fmt.Sprintf("k%03d", i))
+		table, _ := ring.Table(pk)
+		resp, err := client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: &tablestore.SingleRowQueryCriteria{TableName: table, PrimaryKey: pk, MaxVersion: 1}})
+		if err != nil || len(resp.Columns) != 1 || resp.Columns[0].Value != int64(i) {
+			t.Errorf("unexpected row %d in %s: %v, %v", i, table, resp, err)
+		}
+	}
+
+	start, end := key("k010"), key("k050")
+	rows, err := ring.GetRange(client, &tablestore.RangeRowQueryCriteria{StartPrimaryKey: start, EndPrimaryKey: end, Direction: tablestore.FORWARD, MaxVersion: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 40 {
+		t.Fatalf("%d rows", len(rows))
+	}
+	for i, row := range rows {
+		if row.PrimaryKey.PrimaryKeys[0].Value != fmt.Sprintf("k%03d", 10+i) {
+			t.Errorf("unexpected row %d: %v", i, row.PrimaryKey)
+		}
+	}
+
+	rows, err = ring.GetRange(client, &tablestore.RangeRowQueryCriteria{StartPrimaryKey: end, EndPrimaryKey: start, Direction: tablestore.BACKWARD, MaxVersion: 1, Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 5 || rows[0].PrimaryKey.PrimaryKeys[0].Value != "k050" || rows[4].PrimaryKey.PrimaryKeys[0].Value != "k046" {
+		t.Errorf("unexpected rows %v", rows)
+	}
+}
@@ -0,0 +1,198 @@
+package tablestore
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/internal/histogram"
+	"sort"
+	"sync"
+	"time"
+)
+
+// OperationStats are the stats of an action on a table over an interval.
+type OperationStats struct {
+	Action string
+	// the table, or the comma separated tables of batch calls
+	Table string
+
+	// API calls finished, retries included
+	Requests int64
+	// failed calls by error code, "" for errors without one such as network
+	// errors
+	Errors map[string]int64
+	// retries of the calls
+	Retries int64
+	// capacity units consumed by the calls
+	ReadCU  int64
+	WriteCU int64
+
+	// latency quantiles of the calls, accurate to about 9%
+	P50 time.Duration
+	P95 time.Duration
+	P99 time.Duration
+}
+
+// ErrorRate returns the fraction of failed calls.
+func (stats *OperationStats) ErrorRate() float64 {
+	if stats.Requests == 0 {
+		return 0
+	}
+	var failed int64
+	for _, n := range stats.Errors {
+		failed += n
+	}
+	return float64(failed) / float64(stats.Requests)
+}
+
+// RetryRatio returns the number of retries per call.
+func (stats *OperationStats) RetryRatio() float64 {
+	if stats.Requests == 0 {
+		return 0
+	}
+	return float64(stats.Retries) / float64(stats.Requests)
+}
+
+// StatsSnapshot holds the stats of the calls finished in [Start, End),
+// sorted by action and table.
+type StatsSnapshot struct {
+	Start      time.Time
+	End        time.Time
+	Operations []OperationStats
+}
+
+type statsKey struct {
+	action string
+	table  string
+}
+
+type operationRecord struct {
+	requests int64
+	errors   map[string]int64
+	retries  int64
+	read     int64
+	write    int64
+	latency  histogram.Histogram
+}
+
+// StatsReporter pushes a StatsSnapshot of the calls of its clients to a
+// callback every interval, for health signals without a metrics system:
+//
+//	reporter := tablestore.NewStatsReporter(time.Minute, func(snapshot *tablestore.StatsSnapshot) {
+//		for _, op := range snapshot.Operations {
+//			if op.ErrorRate() > 0.01 || op.P99 > 100*time.Millisecond {
+//				alert(op)
+//			}
+//		}
+//	})
+//	defer reporter.Stop()
+//	client := tablestore.NewClient(endpoint, instance, id, secret, tablestore.SetStatsReporter(reporter))
+//
+// Intervals without calls are not reported.
+type StatsReporter struct {
+	report func(*StatsSnapshot)
+
+	lock    sync.Mutex
+	start   time.Time
+	records map[statsKey]*operationRecord
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewStatsReporter returns a reporter calling report every interval, from a
+// goroutine of its own, until Stop.
+func NewStatsReporter(interval time.Duration, report func(*StatsSnapshot)) *StatsReporter {
+	reporter := &StatsReporter{
+		report:  report,
+		start:   time.Now(),
+		records: make(map[statsKey]*operationRecord),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go reporter.run(interval)
+	return reporter
+}
+
+// SetStatsReporter sets the reporter of the stats of the client. A reporter
+// may be shared by several clients.
+func SetStatsReporter(reporter *StatsReporter) ClientOption {
+	return func(client *TableStoreClient) {
+		client.stats = reporter
+	}
+}
+
+func (reporter *StatsReporter) run(interval time.Duration) {
+	defer close(reporter.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			reporter.Flush()
+		case <-reporter.stop:
+			reporter.Flush()
+			return
+		}
+	}
+}
+
+// Stop reports the stats of the current interval and stops the reporter.
+func (reporter *StatsReporter) Stop() {
+	reporter.stopOnce.Do(func() {
+		close(reporter.stop)
+	})
+	<-reporter.done
+}
+
+// Flush reports the stats of the current interval now, and starts another
+// interval.
+func (reporter *StatsReporter) Flush() {
+	reporter.lock.Lock()
+	records, start, end := reporter.records, reporter.start, time.Now()
+	reporter.records = make(map[statsKey]*operationRecord)
+	reporter.start = end
+	reporter.lock.Unlock()
+
+	if len(records) == 0 {
+		return
+	}
+	snapshot := &StatsSnapshot{Start: start, End: end}
+	for key, record := range records {
+		snapshot.Operations = append(snapshot.Operations, OperationStats{
+			Action:   key.action,
+			Table:    key.table,
+			Requests: record.requests,
+			Errors:   record.errors,
+			Retries:  record.retries,
+			ReadCU:   record.read,
+			WriteCU:  record.write,
+			P50:      record.latency.Quantile(0.5),
+			P95:      record.latency.Quantile(0.95),
+			P99:      record.latency.Quantile(0.99),
+		})
+	}
+	sort.Slice(snapshot.Operations, func(i, j int) bool {
+		a, b := snapshot.Operations[i], snapshot.Operations[j]
+		return a.Action < b.Action || a.Action == b.Action && a.Table < b.Table
+	})
+	reporter.report(snapshot)
+}
+
+// record records a call, code being the error code of a failed one.
+func (reporter *StatsReporter) record(action, table string, latency time.Duration, retries uint, read, write int64, err error, code string) {
+	reporter.lock.Lock()
+	defer reporter.lock.Unlock()
+	key := statsKey{action: action, table: table}
+	record, ok := reporter.records[key]
+	if !ok {
+		record = &operationRecord{errors: make(map[string]int64)}
+		reporter.records[key] = record
+	}
+	record.requests++
+	record.retries += int64(retries)
+	record.read += read
+	record.write += write
+	if err != nil {
+		record.errors[code]++
+	}
+	record.latency.Record(latency)
+}
@@ -0,0 +1,165 @@
+package tablestore
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
+	"io"
+	"sync"
+)
+
+// StreamRecords are the records of a response of GetStreamRecords, decoded by
+// Next.
+type StreamRecords struct {
+	NextShardIterator *ShardIterator
+	ResponseInfo
+
+	client  *TableStoreClient
+	records []*otsprotocol.GetStreamRecordResponse_StreamRecord
+	names   interner
+	err     error
+}
+
+// GetStreamRecords reads the records of a shard as GetStreamRecord does, but
+// decodes them one by one, by Next, or by NextPooled into records leased from
+// a pool, e.g. for consumers of many records which do not keep them.
+func (tableStoreClient *TableStoreClient) GetStreamRecords(req *GetStreamRecordRequest) (*StreamRecords, error) {
+	pbReq := &otsprotocol.GetStreamRecordRequest{
+		ShardIterator: (*string)(req.ShardIterator)}
+	if req.Limit != nil {
+		pbReq.Limit = req.Limit
+	}
+
+	pbResp := otsprotocol.GetStreamRecordResponse{}
+	records := &StreamRecords{client: tableStoreClient, names: make(interner)}
+	if err := tableStoreClient.doRequestWithRetry(getStreamRecordUri, pbReq, &pbResp, &records.ResponseInfo); err != nil {
+		return nil, err
+	}
+	if pbResp.NextShardIterator != nil {
+		records.NextShardIterator = (*ShardIterator)(pbResp.NextShardIterator)
+	}
+	records.records = pbResp.StreamRecords
+	return records, nil
+}
+
+// Next decodes the next record, io.EOF after the last one. Once it fails,
+// Next keeps returning the error.
+func (records *StreamRecords) Next() (*StreamRecord, error) {
+	return records.next(false)
+}
+
+// NextPooled decodes the next record as Next does, into a record leased from
+// a pool instead of a new one. The caller releases the record by its Release
+// once done with it.
+func (records *StreamRecords) NextPooled() (*StreamRecord, error) {
+	return records.next(true)
+}
+
+func (records *StreamRecords) next(pooled bool) (*StreamRecord, error) {
+	if records.err != nil {
+		return nil, records.err
+	}
+	if len(records.records) == 0 {
+		return nil, io.EOF
+	}
+	pbRecord := records.records[0]
+	records.records[0] = nil
+	records.records = records.records[1:]
+
+	plainRow, err := records.client.newReader(pbRecord.Record, records.names).readSingleRow()
+	if err == nil && plainRow.extension == nil {
+		err = errNoExtension
+	}
+	if err != nil {
+		records.err = err
+		return nil, err
+	}
+
+	var record *StreamRecord
+	if pooled {
+		record = streamRecordPool.Get().(*StreamRecord)
+		record.pooled = true
+		record.info = *plainRow.extension
+		record.Info = &record.info
+	} else {
+		record = &StreamRecord{PrimaryKey: new(PrimaryKey), Info: plainRow.extension}
+	}
+	switch pbRecord.GetActionType() {
+	case otsprotocol.ActionType_PUT_ROW:
+		record.Type = AT_Put
+	case otsprotocol.ActionType_UPDATE_ROW:
+		record.Type = AT_Update
+	case otsprotocol.ActionType_DELETE_ROW:
+		record.Type = AT_Delete
+	}
+	setStreamRecord(record, plainRow)
+	return record, nil
+}
+
+var streamRecordPool = sync.Pool{New: func() interface{} {
+	return &StreamRecord{PrimaryKey: new(PrimaryKey)}
+}}
+
+// Release returns a record leased by NextPooled to the pool. Neither the
+// record nor its primary key, columns and info may be used afterwards. It
+// does nothing for other records, and records already released.
+func (record *StreamRecord) Release() {
+	if !record.pooled {
+		return
+	}
+	record.pooled = false
+	for _, pk := range record.PrimaryKey.PrimaryKeys {
+		*pk = PrimaryKeyColumn{}
+	}
+	for _, column := range record.Columns {
+		*column = RecordColumn{}
+	}
+	record.PrimaryKey.PrimaryKeys = record.PrimaryKey.PrimaryKeys[:0]
+	record.Columns = record.Columns[:0]
+	record.Info = nil
+	streamRecordPool.Put(record)
+}
+
+// setStreamRecord sets the primary key and columns of record to those of
+// plainRow, reusing the objects record holds beyond their length, if any.
+func setStreamRecord(record *StreamRecord, plainRow *PlainBufferRow) {
+	pks := record.PrimaryKey.PrimaryKeys[:0]
+	for i, cell := range plainRow.primaryKey {
+		var pk *PrimaryKeyColumn
+		if i < cap(pks) {
+			pk = pks[:i+1][i]
+		}
+		if pk == nil {
+			pk = new(PrimaryKeyColumn)
+		}
+		*pk = PrimaryKeyColumn{ColumnName: cell.columnName(), Value: cell.cellValue.Value}
+		pks = append(pks, pk)
+	}
+	record.PrimaryKey.PrimaryKeys = pks
+
+	columns := record.Columns[:0]
+	for i, cell := range plainRow.cells {
+		var column *RecordColumn
+		if i < cap(columns) {
+			column = columns[:i+1][i]
+		}
+		if column == nil {
+			column = new(RecordColumn)
+		}
+		*column = RecordColumn{name: cell.columnName()}
+		column.Name = &column.name
+		switch {
+		case cell.cellValue != nil:
+			column.Type = RCT_Put
+			column.Value = cell.cellValue.Value
+		case cell.cellTimestamp > 0:
+			column.Type = RCT_DeleteOneVersion
+		default:
+			column.Type = RCT_DeleteAllVersions
+		}
+		if column.Type != RCT_DeleteAllVersions {
+			column.timestamp = cell.cellTimestamp
+			column.Timestamp = &column.timestamp
+		}
+		columns = append(columns, column)
+	}
+	record.Columns = columns
+}
@@ -0,0 +1,393 @@
+// Package tablecopy copies a range of rows of a table to another table,
+// transforming them on the way, e.g. to re-partition a hot table under a new
+// primary key:
+//
+//	criteria := &tablestore.RangeRowQueryCriteria{TableName: "orders", StartPrimaryKey: start, EndPrimaryKey: end, MaxVersion: 1}
+//	progress, err := tablecopy.Copy(ctx, client, criteria, client, "orders_v2", tablecopy.Options{
+//		Parallelism: 8,
+//		Transform: tablecopy.Chain(tablecopy.RenameColumns(map[string]string{"amt": "amount"}), rekey),
+//		Checkpoint: func(token string, progress tablecopy.Progress) error {
+//			return saveToken(token)
+//		},
+//	})
+//
+// The range is split into ranges copied in parallel. A copy interrupted
+// resumes after the rows copied before its last checkpoint when run again
+// with Options.Resume set to the last token checkpointed. Rows are put with
+// the timestamps of their columns, overwriting the rows of the target.
+package tablecopy
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transform returns the row written for a row read, nil to skip it. The row
+// read may be modified and returned.
+type Transform func(row *tablestore.Row) (*tablestore.Row, error)
+
+// RenameColumns renames the columns of rows from the keys to the values of
+// names.
+func RenameColumns(names map[string]string) Transform {
+	return func(row *tablestore.Row) (*tablestore.Row, error) {
+		for _, column := range row.Columns {
+			if name, ok := names[column.ColumnName]; ok {
+				column.ColumnName = name
+			}
+		}
+		return row, nil
+	}
+}
+
+// Chain applies transforms in order, until one skips the row.
+func Chain(transforms ...Transform) Transform {
+	return func(row *tablestore.Row) (*tablestore.Row, error) {
+		var err error
+		for _, transform := range transforms {
+			if row, err = transform(row); row == nil || err != nil {
+				return nil, err
+			}
+		}
+		return row, nil
+	}
+}
+
+type Progress struct {
+	Read    int64
+	Written int64
+}
+
+type Options struct {
+	// ranges copied in parallel, 4 by default
+	Parallelism int
+	// points splitting the range, primary keys of the source table; the
+	// split points of the source table computed by ComputeSplitPointsBySize
+	// in SplitSize units of 100MB within the range by default
+	SplitPoints []*tablestore.PrimaryKey
+	SplitSize   int64
+	Transform   Transform
+	// rows per BatchWriteRow, 200 at most and by default
+	BatchSize     int
+	RowsPerSecond float64
+	// called with a token resuming the copy and its progress after each
+	// page of rows read is copied, and with "" once the range is copied;
+	// errors stop the copy
+	Checkpoint func(token string, progress Progress) error
+	// token of a Checkpoint the copy resumes at
+	Resume string
+}
+
+// state is the progress of the ranges of a copy, encoded in tokens.
+type state struct {
+	// points splitting the range, as range tokens of the criteria copied
+	Points []string `json:"points"`
+	// range tokens resuming the ranges, "" for ranges not started and done
+	// for ranges copied
+	Next []string `json:"next"`
+}
+
+const done = "done"
+
+// Copy copies the rows of the range of criteria to targetTable, until the end
+// of the range, ctx is done or an error occurs, and returns the progress of
+// this run. The filter of criteria, if any, selects the rows copied.
+func Copy(ctx context.Context, source tablestore.TableStoreApi, criteria *tablestore.RangeRowQueryCriteria, target tablestore.TableStoreApi, targetTable string, options Options) (Progress, error) {
+	if options.Parallelism <= 0 {
+		options.Parallelism = 4
+	}
+	if options.BatchSize <= 0 || options.BatchSize > 200 {
+		options.BatchSize = 200
+	}
+	if options.SplitSize <= 0 {
+		options.SplitSize = 1
+	}
+	base := *criteria
+	base.Direction = tablestore.FORWARD
+	if base.MaxVersion == 0 && base.TimeRange == nil {
+		base.MaxVersion = 1
+	}
+
+	c := &copier{source: source, target: target, targetTable: targetTable, base: &base, options: &options, start: time.Now()}
+	if err := c.init(); err != nil {
+		return Progress{}, err
+	}
+	err := parallel(ctx, len(c.ranges), options.Parallelism, c.copyRange)
+	if err == nil && options.Checkpoint != nil {
+		err = options.Checkpoint("", c.progress)
+	}
+	return c.progress, err
+}
+
+type copier struct {
+	source      tablestore.TableStoreApi
+	target      tablestore.TableStoreApi
+	targetTable string
+	base        *tablestore.RangeRowQueryCriteria
+	options     *Options
+	start       time.Time
+	ranges      []*tablestore.RangeRowQueryCriteria
+
+	lock     sync.Mutex
+	state    state
+	progress Progress
+}
+
+// init splits the range, as resumed or by the split points.
+func (c *copier) init() error {
+	var points []*tablestore.PrimaryKey
+	if c.options.Resume != "" {
+		data, err := base64.RawURLEncoding.DecodeString(c.options.Resume)
+		if err != nil || json.Unmarshal(data, &c.state) != nil || len(c.state.Next) != len(c.state.Points)+1 {
+			return tablestore.ErrInvalidRangeToken
+		}
+		for _, token := range c.state.Points {
+			criteria := *c.base
+			if err := tablestore.DecodeRangeToken(token, &criteria); err != nil {
+				return err
+			}
+			points = append(points, criteria.StartPrimaryKey)
+		}
+	} else {
+		var err error
+		if points, err = c.splitPoints(); err != nil {
+			return err
+		}
+		for _, point := range points {
+			c.state.Points = append(c.state.Points, tablestore.EncodeRangeToken(c.base, point))
+		}
+		c.state.Next = make([]string, len(points)+1)
+	}
+
+	for i := 0; i <= len(points); i++ {
+		criteria := *c.base
+		if i > 0 {
+			criteria.StartPrimaryKey = points[i-1]
+		}
+		if i < len(points) {
+			criteria.EndPrimaryKey = points[i]
+		}
+		c.ranges = append(c.ranges, &criteria)
+	}
+	return nil
+}
+
+// splitPoints returns the split points strictly within the range.
+func (c *copier) splitPoints() ([]*tablestore.PrimaryKey, error) {
+	candidates := c.options.SplitPoints
+	if candidates == nil {
+		resp, err := c.source.ComputeSplitPointsBySize(&tablestore.ComputeSplitPointsBySizeRequest{TableName: c.base.TableName, SplitSize: c.options.SplitSize})
+		if err != nil {
+			return nil, err
+		}
+		for _, split := range resp.Splits[1:] {
+			candidates = append(candidates, split.LowerBound)
+		}
+	}
+	var points []*tablestore.PrimaryKey
+	for _, point := range candidates {
+		if comparePrimaryKeys(c.base.StartPrimaryKey, point) < 0 && comparePrimaryKeys(point, c.base.EndPrimaryKey) < 0 &&
+			(len(points) == 0 || comparePrimaryKeys(points[len(points)-1], point) < 0) {
+			points = append(points, point)
+		}
+	}
+	return points, nil
+}
+
+// copyRange copies the i-th range from where it was left.
+func (c *copier) copyRange(ctx context.Context, i int) error {
+	c.lock.Lock()
+	next := c.state.Next[i]
+	c.lock.Unlock()
+	if next == done {
+		return nil
+	}
+	criteria := *c.ranges[i]
+	if err := tablestore.DecodeRangeToken(next, &criteria); err != nil {
+		return err
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		resp, err := c.source.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: &criteria})
+		if err != nil {
+			return err
+		}
+		var rows []*tablestore.Row
+		for _, row := range resp.Rows {
+			if c.options.Transform != nil {
+				if row, err = c.options.Transform(row); err != nil {
+					return err
+				}
+			}
+			if row != nil {
+				rows = append(rows, row)
+			}
+		}
+		for len(rows) > 0 {
+			n := len(rows)
+			if n > c.options.BatchSize {
+				n = c.options.BatchSize
+			}
+			if err := c.write(ctx, rows[:n]); err != nil {
+				return err
+			}
+			rows = rows[n:]
+		}
+
+		c.lock.Lock()
+		c.progress.Read += int64(len(resp.Rows))
+		if resp.NextStartPrimaryKey == nil {
+			c.state.Next[i] = done
+		} else {
+			c.state.Next[i] = tablestore.EncodeRangeToken(c.ranges[i], resp.NextStartPrimaryKey)
+		}
+		var checkpointErr error
+		if c.options.Checkpoint != nil {
+			data, _ := json.Marshal(&c.state)
+			checkpointErr = c.options.Checkpoint(base64.RawURLEncoding.EncodeToString(data), c.progress)
+		}
+		c.lock.Unlock()
+		if checkpointErr != nil || resp.NextStartPrimaryKey == nil {
+			return checkpointErr
+		}
+		criteria.StartPrimaryKey = resp.NextStartPrimaryKey
+	}
+}
+
+// write puts rows to the target table, after waiting for the rate limit.
+func (c *copier) write(ctx context.Context, rows []*tablestore.Row) error {
+	if c.options.RowsPerSecond > 0 {
+		c.lock.Lock()
+		due := c.start.Add(time.Duration(float64(c.progress.Written) / c.options.RowsPerSecond * float64(time.Second)))
+		c.lock.Unlock()
+		if wait := time.Until(due); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+		}
+	}
+
+	req := &tablestore.BatchWriteRowRequest{}
+	for _, row := range rows {
+		change := &tablestore.PutRowChange{TableName: c.targetTable, PrimaryKey: row.PrimaryKey}
+		for _, column := range row.Columns {
+			if column.Timestamp != 0 {
+				change.AddColumnWithTimestamp(column.ColumnName, column.Value, column.Timestamp)
+			} else {
+				change.AddColumn(column.ColumnName, column.Value)
+			}
+		}
+		change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		req.AddRowChange(change)
+	}
+	resp, err := c.target.BatchWriteRow(req)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, result := range resp.TableToRowsResult[c.targetTable] {
+		if result.IsSucceed {
+			c.progress.Written++
+		} else if err == nil {
+			err = fmt.Errorf("[tablestore] copy: %s %s", result.Error.Code, result.Error.Message)
+		}
+	}
+	return err
+}
+
+// parallel runs f for each of n tasks, on at most parallelism goroutines,
+// until one fails.
+func parallel(ctx context.Context, n, parallelism int, f func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tasks := make(chan int)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for w := 0; w < parallelism && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range tasks {
+				if err := f(ctx, i); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case tasks <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(tasks)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// comparePrimaryKeys orders primary keys of the same columns, infinite
+// values included.
+func comparePrimaryKeys(a, b *tablestore.PrimaryKey) int {
+	for i := 0; i < len(a.PrimaryKeys) && i < len(b.PrimaryKeys); i++ {
+		if c := compareColumns(a.PrimaryKeys[i], b.PrimaryKeys[i]); c != 0 {
+			return c
+		}
+	}
+	return len(a.PrimaryKeys) - len(b.PrimaryKeys)
+}
+
+func compareColumns(a, b *tablestore.PrimaryKeyColumn) int {
+	rank := func(column *tablestore.PrimaryKeyColumn) int {
+		switch column.PrimaryKeyOption {
+		case tablestore.MIN:
+			return -1
+		case tablestore.MAX:
+			return 1
+		}
+		return 0
+	}
+	if ra, rb := rank(a), rank(b); ra != rb || ra != 0 {
+		return ra - rb
+	}
+	switch av := a.Value.(type) {
+	case string:
+		if bv, ok := b.Value.(string); ok {
+			return strings.Compare(av, bv)
+		}
+	case int64:
+		if bv, ok := b.Value.(int64); ok {
+			switch {
+			case av < bv:
+				return -1
+			case av > bv:
+				return 1
+			}
+			return 0
+		}
+	case []byte:
+		if bv, ok := b.Value.([]byte); ok {
+			return bytes.Compare(av, bv)
+		}
+	}
+	return 0
+}
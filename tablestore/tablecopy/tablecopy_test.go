@@ -0,0 +1,195 @@
+package tablecopy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"testing"
+)
+
+func createTable(t *testing.T, client tablestore.TableStoreApi, name string, pk ...string) {
+	meta := &tablestore.TableMeta{TableName: name}
+	for _, column := range pk {
+		if column == "id" {
+			meta.AddPrimaryKeyColumn(column, tablestore.PrimaryKeyType_INTEGER)
+		} else {
+			meta.AddPrimaryKeyColumn(column, tablestore.PrimaryKeyType_STRING)
+		}
+	}
+	_, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func primaryKey(user string, id int64) *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn("user", user)
+	pk.AddPrimaryKeyColumn("id", id)
+	return pk
+}
+
+// rekey swaps the primary key columns, skipping the ids multiple of 5.
+func rekey(row *tablestore.Row) (*tablestore.Row, error) {
+	id := row.PrimaryKey.PrimaryKeys[1].Value.(int64)
+	if id%5 == 0 {
+		return nil, nil
+	}
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn("id", id)
+	pk.AddPrimaryKeyColumn("user", row.PrimaryKey.PrimaryKeys[0].Value)
+	return &tablestore.Row{PrimaryKey: pk, Columns: row.Columns}, nil
+}
+
+func scan(t *testing.T, client tablestore.TableStoreApi, table string) []*tablestore.Row {
+	criteria := &tablestore.RangeRowQueryCriteria{TableName: table, StartPrimaryKey: new(tablestore.PrimaryKey), EndPrimaryKey: new(tablestore.PrimaryKey), MaxVersion: 1}
+	for _, column := range []string{"id", "user"} {
+		criteria.StartPrimaryKey.AddPrimaryKeyColumnWithMinValue(column)
+		criteria.EndPrimaryKey.AddPrimaryKeyColumnWithMaxValue(column)
+	}
+	var rows []*tablestore.Row
+	for {
+		resp, err := client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: criteria})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, resp.Rows...)
+		if resp.NextStartPrimaryKey == nil {
+			return rows
+		}
+		criteria.StartPrimaryKey = resp.NextStartPrimaryKey
+	}
+}
+
+func TestCopy(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	server.Store.RangeLimit = 3
+	client := server.NewTableStoreClient()
+	createTable(t, client, "orders", "user", "id")
+	createTable(t, client, "orders_v2", "id", "user")
+	for u := 0; u < 4; u++ {
+		for id := int64(0); id < 10; id++ {
+			change := &tablestore.PutRowChange{TableName: "orders", PrimaryKey: primaryKey(fmt.Sprintf("u%d", u), id)}
+			change.AddColumnWithTimestamp("amt", id*10, 1000+id)
+			change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+			if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: change}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// u1 and u2, split in three ranges
+	start := new(tablestore.PrimaryKey)
+	start.AddPrimaryKeyColumn("user", "u1")
+	start.AddPrimaryKeyColumnWithMinValue("id")
+	end := new(tablestore.PrimaryKey)
+	end.AddPrimaryKeyColumn("user", "u3")
+	end.AddPrimaryKeyColumnWithMinValue("id")
+	criteria := &tablestore.RangeRowQueryCriteria{TableName: "orders", StartPrimaryKey: start, EndPrimaryKey: end}
+	options := Options{
+		Parallelism: 2,
+		SplitPoints: []*tablestore.PrimaryKey{primaryKey("u0", 5), primaryKey("u1", 5), primaryKey("u2", 0), primaryKey("u2", 0), primaryKey("u3", 5)},
+		Transform:   Chain(RenameColumns(map[string]string{"amt": "amount"}), rekey),
+		BatchSize:   2,
+	}
+	var token string
+	checkpoints := 0
+	options.Checkpoint = func(t string, progress Progress) error {
+		token = t
+		if checkpoints++; checkpoints == 3 {
+			return errors.New("interrupted")
+		}
+		return nil
+	}
+	if _, err := Copy(context.Background(), client, criteria, client, "orders_v2", options); err == nil || err.Error() != "interrupted" {
+		t.Fatalf("expect interruption: %v", err)
+	}
+	if token == "" {
+		t.Fatal("no token checkpointed")
+	}
+	options.Resume = token
+	options.RowsPerSecond = 1000
+	options.Checkpoint = func(t string, progress Progress) error {
+		token = t
+		return nil
+	}
+	if _, err := Copy(context.Background(), client, criteria, client, "orders_v2", options); err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		t.Errorf("last token: %q", token)
+	}
+
+	rows := scan(t, client, "orders_v2")
+	if len(rows) != 16 {
+		t.Fatalf("rows copied: %d", len(rows))
+	}
+	for _, row := range rows {
+		id := row.PrimaryKey.PrimaryKeys[0].Value.(int64)
+		user := row.PrimaryKey.PrimaryKeys[1].Value.(string)
+		if id%5 == 0 || (user != "u1" && user != "u2") || len(row.Columns) != 1 || row.Columns[0].ColumnName != "amount" ||
+			row.Columns[0].Value != id*10 || row.Columns[0].Timestamp != 1000+id {
+			t.Errorf("row copied: %v %v", row.PrimaryKey.PrimaryKeys, row.Columns)
+		}
+	}
+
+	options.Resume = "invalid"
+	if _, err := Copy(context.Background(), client, criteria, client, "orders_v2", options); err != tablestore.ErrInvalidRangeToken {
+		t.Errorf("expect invalid token: %v", err)
+	}
+}
+
+// splitClient computes split points of the table at every user.
+type splitClient struct {
+	*tablestoretest.Client
+}
+
+func (client splitClient) ComputeSplitPointsBySize(request *tablestore.ComputeSplitPointsBySizeRequest) (*tablestore.ComputeSplitPointsBySizeResponse, error) {
+	resp := &tablestore.ComputeSplitPointsBySizeResponse{}
+	lower := new(tablestore.PrimaryKey)
+	lower.AddPrimaryKeyColumnWithMinValue("user")
+	lower.AddPrimaryKeyColumnWithMinValue("id")
+	for _, user := range []string{"u1", "u2", "u3"} {
+		upper := new(tablestore.PrimaryKey)
+		upper.AddPrimaryKeyColumn("user", user)
+		upper.AddPrimaryKeyColumnWithMinValue("id")
+		resp.Splits = append(resp.Splits, &tablestore.Split{LowerBound: lower, UpperBound: upper})
+		lower = upper
+	}
+	upper := new(tablestore.PrimaryKey)
+	upper.AddPrimaryKeyColumnWithMaxValue("user")
+	upper.AddPrimaryKeyColumnWithMaxValue("id")
+	resp.Splits = append(resp.Splits, &tablestore.Split{LowerBound: lower, UpperBound: upper})
+	return resp, nil
+}
+
+func TestCopySplitBySize(t *testing.T) {
+	client := splitClient{tablestoretest.NewClient()}
+	client.RangeLimit = 4
+	createTable(t, client, "orders", "user", "id")
+	createTable(t, client, "copy", "user", "id")
+	for u := 0; u < 4; u++ {
+		for id := int64(0); id < 5; id++ {
+			change := &tablestore.PutRowChange{TableName: "orders", PrimaryKey: primaryKey(fmt.Sprintf("u%d", u), id)}
+			change.AddColumn("n", id)
+			change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+			if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: change}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	start := primaryKey("u0", 3)
+	end := primaryKey("u3", 1)
+	criteria := &tablestore.RangeRowQueryCriteria{TableName: "orders", StartPrimaryKey: start, EndPrimaryKey: end}
+	progress, err := Copy(context.Background(), client, criteria, client, "copy", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// u0 3-4, u1 and u2, u3 0
+	if progress.Read != 13 || progress.Written != 13 {
+		t.Errorf("progress: %+v", progress)
+	}
+}
@@ -0,0 +1,276 @@
+// Package tablestoretest provides an in-memory fake of TableStore for tests.
+//
+// Client implements tablestore.TableStoreApi without network access. It keeps
+// rows ordered by primary key and honors row existence and column conditions,
+// column versions, time to live, auto increment primary keys and GetRange
+// pagination:
+//
+//	var api tablestore.TableStoreApi = tablestoretest.NewClient()
+//
+// Errors returned by the server start with the same error code as those of
+// tablestore.TableStoreClient, e.g. "OTSConditionCheckFail". Streams, search
+// indexes and secondary indexes are not supported.
+//
+// Server serves a Client over HTTP with the wire protocol of TableStore, so
+// that tablestore.TableStoreClient itself can be tested end to end.
+package tablestoretest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// rows returned in one GetRange response by default
+	DefaultRangeLimit = 5000
+
+	maxPrimaryKeyNum   = 4
+	batchGetRowLimit   = 100
+	batchWriteRowLimit = 200
+)
+
+// same as the error returned by tablestore.TableStoreClient for requests it
+// rejects before sending
+var errInvalidInput = errors.New("[tablestore] invalid input")
+
+// serverError is an error the real server would return. Its message has the
+// same "code message" prefix as errors of tablestore.TableStoreClient.
+type serverError struct {
+	code    string
+	message string
+}
+
+func (e *serverError) Error() string {
+	return e.code + " " + e.message
+}
+
+func otsError(code, message string) error {
+	return &serverError{code: code, message: message}
+}
+
+func parameterInvalid(message string) error {
+	return otsError("OTSParameterInvalid", message)
+}
+
+var (
+	errTableNotExist      = otsError("OTSObjectNotExist", "Requested table does not exist.")
+	errTableAlreadyExist  = otsError("OTSObjectAlreadyExist", "Requested table already exists.")
+	errConditionCheckFail = otsError("OTSConditionCheckFail", "Condition check failed.")
+	errUnsupported        = otsError("OTSUnsupportOperation", "Operation is not supported by tablestoretest.")
+)
+
+// Client is an in-memory TableStore instance. It is safe for concurrent use.
+type Client struct {
+	// Now returns the current time, used for default timestamps of columns
+	// and time to live. It defaults to time.Now.
+	Now func() time.Time
+	// RangeLimit is the max rows returned in one GetRange response, 0 means
+	// DefaultRangeLimit. Set it small to exercise pagination.
+	RangeLimit int
+
+	lock      sync.Mutex
+	tables    map[string]*table
+	requestId int64
+}
+
+var _ tablestore.TableStoreApi = (*Client)(nil)
+
+func NewClient() *Client {
+	return &Client{tables: make(map[string]*table)}
+}
+
+func (client *Client) now() int64 {
+	now := time.Now
+	if client.Now != nil {
+		now = client.Now
+	}
+	return now().UnixNano() / int64(time.Millisecond)
+}
+
+func (client *Client) nextRequestId() string {
+	client.requestId++
+	return fmt.Sprintf("tablestoretest-%d", client.requestId)
+}
+
+func (client *Client) table(name string) (*table, error) {
+	t, ok := client.tables[name]
+	if !ok {
+		return nil, errTableNotExist
+	}
+	return t, nil
+}
+
+func (client *Client) CreateTable(request *tablestore.CreateTableRequest) (*tablestore.CreateTableResponse, error) {
+	meta := request.TableMeta
+	if meta == nil || meta.TableName == "" {
+		return nil, parameterInvalid("Table name is required.")
+	}
+	if len(meta.SchemaEntry) == 0 || len(meta.SchemaEntry) > maxPrimaryKeyNum {
+		return nil, parameterInvalid("The number of primary key columns must be in range: [1, 4].")
+	}
+	if request.TableOption == nil || request.TableOption.MaxVersion <= 0 {
+		return nil, parameterInvalid("MaxVersions must be positive.")
+	}
+	if request.TableOption.TimeToAlive == 0 || request.TableOption.TimeToAlive < -1 {
+		return nil, parameterInvalid("TimeToLive must be positive or -1.")
+	}
+	if len(request.IndexMetas) > 0 || (request.StreamSpec != nil && request.StreamSpec.EnableStream) {
+		return nil, errUnsupported
+	}
+	for _, schema := range meta.SchemaEntry {
+		if schema.Name == nil || schema.Type == nil {
+			return nil, parameterInvalid("Name and type of primary key are required.")
+		}
+	}
+
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	if client.tables == nil {
+		client.tables = make(map[string]*table)
+	}
+	if _, ok := client.tables[meta.TableName]; ok {
+		return nil, errTableAlreadyExist
+	}
+	t := &table{meta: *meta, option: *request.TableOption}
+	t.meta.SchemaEntry = append([]*tablestore.PrimaryKeySchema(nil), meta.SchemaEntry...)
+	t.meta.DefinedColumns = append([]*tablestore.DefinedColumnSchema(nil), meta.DefinedColumns...)
+	if request.ReservedThroughput != nil {
+		t.throughput = *request.ReservedThroughput
+	}
+	client.tables[meta.TableName] = t
+
+	response := &tablestore.CreateTableResponse{}
+	response.RequestId = client.nextRequestId()
+	return response, nil
+}
+
+func (client *Client) ListTable() (*tablestore.ListTableResponse, error) {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	response := &tablestore.ListTableResponse{}
+	for name := range client.tables {
+		response.TableNames = append(response.TableNames, name)
+	}
+	sort.Strings(response.TableNames)
+	response.RequestId = client.nextRequestId()
+	return response, nil
+}
+
+func (client *Client) DeleteTable(request *tablestore.DeleteTableRequest) (*tablestore.DeleteTableResponse, error) {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	if _, err := client.table(request.TableName); err != nil {
+		return nil, err
+	}
+	delete(client.tables, request.TableName)
+	response := &tablestore.DeleteTableResponse{}
+	response.RequestId = client.nextRequestId()
+	return response, nil
+}
+
+func (client *Client) DescribeTable(request *tablestore.DescribeTableRequest) (*tablestore.DescribeTableResponse, error) {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	t, err := client.table(request.TableName)
+	if err != nil {
+		return nil, err
+	}
+	meta := t.meta
+	option := t.option
+	throughput := t.throughput
+	response := &tablestore.DescribeTableResponse{
+		TableMeta:          &meta,
+		TableOption:        &option,
+		ReservedThroughput: &throughput,
+		StreamDetails:      &tablestore.StreamDetails{EnableStream: false},
+	}
+	response.RequestId = client.nextRequestId()
+	return response, nil
+}
+
+func (client *Client) UpdateTable(request *tablestore.UpdateTableRequest) (*tablestore.UpdateTableResponse, error) {
+	if request.StreamSpec != nil && request.StreamSpec.EnableStream {
+		return nil, errUnsupported
+	}
+
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	t, err := client.table(request.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if request.TableOption != nil {
+		if request.TableOption.MaxVersion <= 0 {
+			return nil, parameterInvalid("MaxVersions must be positive.")
+		}
+		if request.TableOption.TimeToAlive == 0 || request.TableOption.TimeToAlive < -1 {
+			return nil, parameterInvalid("TimeToLive must be positive or -1.")
+		}
+		t.option = *request.TableOption
+	}
+	if request.ReservedThroughput != nil {
+		t.throughput = *request.ReservedThroughput
+	}
+
+	option := t.option
+	throughput := t.throughput
+	response := &tablestore.UpdateTableResponse{
+		TableOption:        &option,
+		ReservedThroughput: &throughput,
+		StreamDetails:      &tablestore.StreamDetails{EnableStream: false},
+	}
+	response.RequestId = client.nextRequestId()
+	return response, nil
+}
+
+func (client *Client) CreateIndex(request *tablestore.CreateIndexRequest) (*tablestore.CreateIndexResponse, error) {
+	return nil, errUnsupported
+}
+
+func (client *Client) DeleteIndex(request *tablestore.DeleteIndexRequest) (*tablestore.DeleteIndexResponse, error) {
+	return nil, errUnsupported
+}
+
+func (client *Client) ComputeSplitPointsBySize(request *tablestore.ComputeSplitPointsBySizeRequest) (*tablestore.ComputeSplitPointsBySizeResponse, error) {
+	return nil, errUnsupported
+}
+
+func (client *Client) ListStream(request *tablestore.ListStreamRequest) (*tablestore.ListStreamResponse, error) {
+	return nil, errUnsupported
+}
+
+func (client *Client) DescribeStream(request *tablestore.DescribeStreamRequest) (*tablestore.DescribeStreamResponse, error) {
+	return nil, errUnsupported
+}
+
+func (client *Client) GetShardIterator(request *tablestore.GetShardIteratorRequest) (*tablestore.GetShardIteratorResponse, error) {
+	return nil, errUnsupported
+}
+
+func (client *Client) GetStreamRecord(request *tablestore.GetStreamRecordRequest) (*tablestore.GetStreamRecordResponse, error) {
+	return nil, errUnsupported
+}
+
+func (client *Client) CreateSearchIndex(request *tablestore.CreateSearchIndexRequest) (*tablestore.CreateSearchIndexResponse, error) {
+	return nil, errUnsupported
+}
+
+func (client *Client) DeleteSearchIndex(request *tablestore.DeleteSearchIndexRequest) (*tablestore.DeleteSearchIndexResponse, error) {
+	return nil, errUnsupported
+}
+
+func (client *Client) ListSearchIndex(request *tablestore.ListSearchIndexRequest) (*tablestore.ListSearchIndexResponse, error) {
+	return nil, errUnsupported
+}
+
+func (client *Client) DescribeSearchIndex(request *tablestore.DescribeSearchIndexRequest) (*tablestore.DescribeSearchIndexResponse, error) {
+	return nil, errUnsupported
+}
+
+func (client *Client) Search(request *tablestore.SearchRequest) (*tablestore.SearchResponse, error) {
+	return nil, errUnsupported
+}
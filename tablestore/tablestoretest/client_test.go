@@ -0,0 +1,205 @@
+package tablestoretest
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, option *tablestore.TableOption) *Client {
+	client := NewClient()
+	meta := &tablestore.TableMeta{TableName: "t"}
+	meta.AddPrimaryKeyColumn("pk1", tablestore.PrimaryKeyType_STRING)
+	meta.AddPrimaryKeyColumnOption("pk2", tablestore.PrimaryKeyType_INTEGER, tablestore.AUTO_INCREMENT)
+	_, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: option, ReservedThroughput: &tablestore.ReservedThroughput{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func primaryKey(pk1 string, pk2 int64) *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn("pk1", pk1)
+	pk.AddPrimaryKeyColumn("pk2", pk2)
+	return pk
+}
+
+func putRow(api tablestore.TableStoreApi, pk *tablestore.PrimaryKey, expect tablestore.RowExistenceExpectation, columns ...tablestore.AttributeColumn) error {
+	change := &tablestore.PutRowChange{TableName: "t", PrimaryKey: pk, Columns: columns}
+	change.SetCondition(expect)
+	_, err := api.PutRow(&tablestore.PutRowRequest{PutRowChange: change})
+	return err
+}
+
+func getRow(t *testing.T, api tablestore.TableStoreApi, pk *tablestore.PrimaryKey, maxVersion int32) *tablestore.GetRowResponse {
+	criteria := &tablestore.SingleRowQueryCriteria{TableName: "t", PrimaryKey: pk, MaxVersion: maxVersion}
+	resp, err := api.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestRowOperations(t *testing.T) {
+	var api tablestore.TableStoreApi = newTestClient(t, tablestore.NewTableOption(-1, 2))
+	pk := primaryKey("a", 1)
+
+	if err := putRow(api, pk, tablestore.RowExistenceExpectation_EXPECT_EXIST); err == nil || !strings.HasPrefix(err.Error(), "OTSConditionCheckFail") {
+		t.Fatalf("expect condition check failure, got %v", err)
+	}
+	for ts := int64(1); ts <= 3; ts++ {
+		if err := putRow(api, pk, tablestore.RowExistenceExpectation_IGNORE, tablestore.AttributeColumn{ColumnName: "col", Value: ts, Timestamp: ts}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// put replaces the whole row
+	resp := getRow(t, api, pk, 10)
+	if len(resp.Columns) != 1 || resp.Columns[0].Value != int64(3) || resp.PrimaryKey.PrimaryKeys[0].Value != "a" {
+		t.Fatalf("unexpected row %v", resp.Columns)
+	}
+
+	update := &tablestore.UpdateRowChange{TableName: "t", PrimaryKey: pk}
+	update.SetCondition(tablestore.RowExistenceExpectation_EXPECT_EXIST)
+	update.PutColumn("col", int64(4))
+	update.PutColumn("name", "foo")
+	update.PutColumn("name", "bar")
+	condition := tablestore.NewSingleColumnCondition("col", tablestore.CT_GREATER_EQUAL, int64(3))
+	update.SetColumnCondition(condition)
+	if _, err := api.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: update}); err != nil {
+		t.Fatal(err)
+	}
+	resp = getRow(t, api, pk, 10)
+	if len(resp.Columns) != 3 || resp.Columns[0].Value != int64(4) || resp.Columns[1].Value != int64(3) || resp.Columns[2].Value != "bar" {
+		t.Fatalf("unexpected row after update %v", resp.Columns)
+	}
+	if _, err := api.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: update}); err != nil {
+		t.Fatal(err)
+	}
+	// max versions of the table is 2
+	if resp = getRow(t, api, pk, 10); len(resp.Columns) != 3 {
+		t.Fatalf("unexpected versions %v", resp.Columns)
+	}
+
+	remove := &tablestore.DeleteRowChange{TableName: "t", PrimaryKey: pk}
+	remove.SetCondition(tablestore.RowExistenceExpectation_EXPECT_EXIST)
+	remove.SetColumnCondition(tablestore.NewSingleColumnCondition("name", tablestore.CT_EQUAL, "foo"))
+	if _, err := api.DeleteRow(&tablestore.DeleteRowRequest{DeleteRowChange: remove}); err == nil {
+		t.Fatal("expect condition check failure")
+	}
+	remove.Condition.ColumnCondition = nil
+	if _, err := api.DeleteRow(&tablestore.DeleteRowRequest{DeleteRowChange: remove}); err != nil {
+		t.Fatal(err)
+	}
+	if resp = getRow(t, api, pk, 1); len(resp.PrimaryKey.PrimaryKeys) != 0 {
+		t.Fatalf("row is not deleted %v", resp)
+	}
+
+	if _, err := api.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: &tablestore.SingleRowQueryCriteria{TableName: "t", PrimaryKey: pk}}); err == nil {
+		t.Fatal("expect invalid input without max version")
+	}
+	bad := new(tablestore.PrimaryKey)
+	bad.AddPrimaryKeyColumn("pk1", int64(1))
+	bad.AddPrimaryKeyColumn("pk2", int64(1))
+	if err := putRow(api, bad, tablestore.RowExistenceExpectation_IGNORE); err == nil || !strings.HasPrefix(err.Error(), "OTSParameterInvalid") {
+		t.Fatalf("expect invalid primary key type, got %v", err)
+	}
+}
+
+func TestAutoIncrementAndTTL(t *testing.T) {
+	client := newTestClient(t, tablestore.NewTableOption(100, 1))
+	now := time.Unix(10000, 0)
+	client.Now = func() time.Time { return now }
+
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn("pk1", "a")
+	pk.AddPrimaryKeyColumnWithAutoIncrement("pk2")
+	change := &tablestore.PutRowChange{TableName: "t", PrimaryKey: pk}
+	change.AddColumn("col", "v")
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	change.SetReturnPk()
+	resp, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: change})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.PrimaryKey.PrimaryKeys) != 2 || resp.PrimaryKey.PrimaryKeys[1].Value != int64(1) {
+		t.Fatalf("unexpected returned primary key %v", resp.PrimaryKey.PrimaryKeys)
+	}
+
+	if row := getRow(t, client, primaryKey("a", 1), 1); len(row.Columns) != 1 || row.Columns[0].Timestamp != 10000000 {
+		t.Fatalf("unexpected row %v", row.Columns)
+	}
+	now = now.Add(101 * time.Second)
+	if row := getRow(t, client, primaryKey("a", 1), 1); len(row.PrimaryKey.PrimaryKeys) != 0 {
+		t.Fatalf("row should expire %v", row.Columns)
+	}
+}
+
+func TestGetRangeAndBatch(t *testing.T) {
+	client := newTestClient(t, tablestore.NewTableOption(-1, 1))
+	client.RangeLimit = 2
+
+	batch := &tablestore.BatchWriteRowRequest{}
+	for _, key := range []string{"c", "a", "d", "b"} {
+		change := &tablestore.PutRowChange{TableName: "t", PrimaryKey: primaryKey(key, 1)}
+		change.AddColumn("key", key)
+		change.SetCondition(tablestore.RowExistenceExpectation_EXPECT_NOT_EXIST)
+		batch.AddRowChange(change)
+	}
+	failed := &tablestore.PutRowChange{TableName: "t", PrimaryKey: primaryKey("a", 1)}
+	failed.SetCondition(tablestore.RowExistenceExpectation_EXPECT_NOT_EXIST)
+	batch.AddRowChange(failed)
+	writeResp, err := client.BatchWriteRow(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := writeResp.TableToRowsResult["t"]
+	if len(results) != 5 || !results[0].IsSucceed || results[4].IsSucceed || results[4].Error.Code != "OTSConditionCheckFail" || results[4].Index != 4 {
+		t.Fatalf("unexpected batch write results %v", results)
+	}
+
+	criteria := &tablestore.RangeRowQueryCriteria{TableName: "t", MaxVersion: 1, Direction: tablestore.BACKWARD}
+	criteria.StartPrimaryKey = new(tablestore.PrimaryKey)
+	criteria.StartPrimaryKey.AddPrimaryKeyColumnWithMaxValue("pk1")
+	criteria.StartPrimaryKey.AddPrimaryKeyColumnWithMaxValue("pk2")
+	criteria.EndPrimaryKey = primaryKey("a", 1)
+	var keys []string
+	for {
+		resp, err := client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: criteria})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range resp.Rows {
+			keys = append(keys, row.Columns[0].Value.(string))
+		}
+		if resp.NextStartPrimaryKey == nil {
+			break
+		}
+		criteria.StartPrimaryKey = resp.NextStartPrimaryKey
+	}
+	if strings.Join(keys, "") != "dcb" {
+		t.Fatalf("unexpected range result %v", keys)
+	}
+
+	multi := &tablestore.MultiRowQueryCriteria{TableName: "t", MaxVersion: 1}
+	multi.AddRow(primaryKey("b", 1))
+	multi.AddRow(primaryKey("x", 1))
+	multi.Filter = tablestore.NewSingleColumnCondition("key", tablestore.CT_EQUAL, "b")
+	getResp, err := client.BatchGetRow(&tablestore.BatchGetRowRequest{MultiRowQueryCriteria: []*tablestore.MultiRowQueryCriteria{multi}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := getResp.TableToRowsResult["t"]
+	if len(rows) != 2 || len(rows[0].Columns) != 1 || len(rows[1].PrimaryKey.PrimaryKeys) != 0 {
+		t.Fatalf("unexpected batch get results %v", rows)
+	}
+
+	multi.Filter = tablestore.NewSingleColumnCondition("key", tablestore.CT_NOT_EQUAL, "b").Freeze()
+	if getResp, err = client.BatchGetRow(&tablestore.BatchGetRowRequest{MultiRowQueryCriteria: []*tablestore.MultiRowQueryCriteria{multi}}); err != nil {
+		t.Fatal(err)
+	}
+	if rows := getResp.TableToRowsResult["t"]; len(rows) != 2 || len(rows[0].PrimaryKey.PrimaryKeys) != 0 {
+		t.Fatalf("unexpected batch get results with frozen filter %v", rows)
+	}
+}
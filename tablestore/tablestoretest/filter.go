@@ -0,0 +1,101 @@
+package tablestoretest
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+)
+
+// match evaluates a column value filter against r, which may be nil for a
+// missing row. Pagination filters do not filter rows and always match.
+func (t *table) match(filter tablestore.ColumnFilter, r *row, now int64) (bool, error) {
+	switch f := filter.(type) {
+	case nil, *tablestore.PaginationFilter:
+		return true, nil
+	case *tablestore.FrozenFilter:
+		return t.match(f.Filter(), r, now)
+	case *tablestore.SingleColumnCondition:
+		return t.matchSingle(f, r, now)
+	case *tablestore.CompositeColumnValueFilter:
+		switch f.Operator {
+		case tablestore.LO_NOT:
+			if len(f.Filters) != 1 {
+				return false, parameterInvalid("NOT operator requires exactly one sub filter")
+			}
+			matched, err := t.match(f.Filters[0], r, now)
+			return !matched, err
+		case tablestore.LO_AND, tablestore.LO_OR:
+			if len(f.Filters) < 2 {
+				return false, parameterInvalid("AND and OR operators require at least two sub filters")
+			}
+			for _, sub := range f.Filters {
+				matched, err := t.match(sub, r, now)
+				if err != nil {
+					return false, err
+				}
+				if matched == (f.Operator == tablestore.LO_OR) {
+					return matched, nil
+				}
+			}
+			return f.Operator == tablestore.LO_AND, nil
+		}
+		return false, parameterInvalid("unknown logical operator")
+	}
+	return false, parameterInvalid("unsupported filter type")
+}
+
+func (t *table) matchSingle(f *tablestore.SingleColumnCondition, r *row, now int64) (bool, error) {
+	if f.Comparator == nil || f.ColumnName == nil {
+		return false, parameterInvalid("comparator and column name of filter are required")
+	}
+	expected, ok := normalizeValue(f.ColumnValue)
+	if !ok {
+		return false, parameterInvalid("invalid column value of filter")
+	}
+
+	var versions []version
+	if r != nil {
+		versions = t.visibleVersions(r, *f.ColumnName, now)
+	}
+	if len(versions) == 0 {
+		return !f.FilterIfMissing, nil
+	}
+	if f.LatestVersionOnly {
+		versions = versions[:1]
+	}
+
+	for _, v := range versions {
+		result, ok := compareValues(v.value, expected)
+		if !ok {
+			continue
+		}
+		var matched bool
+		switch *f.Comparator {
+		case tablestore.CT_EQUAL:
+			matched = result == 0
+		case tablestore.CT_NOT_EQUAL:
+			matched = result != 0
+		case tablestore.CT_GREATER_THAN:
+			matched = result > 0
+		case tablestore.CT_GREATER_EQUAL:
+			matched = result >= 0
+		case tablestore.CT_LESS_THAN:
+			matched = result < 0
+		case tablestore.CT_LESS_EQUAL:
+			matched = result <= 0
+		default:
+			return false, parameterInvalid("unknown comparator")
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// paginationOf returns the column pagination filter of a read, if any.
+func paginationOf(filter tablestore.ColumnFilter) *tablestore.PaginationFilter {
+	if frozen, ok := filter.(*tablestore.FrozenFilter); ok {
+		filter = frozen.Filter()
+	}
+	pagination, _ := filter.(*tablestore.PaginationFilter)
+	return pagination
+}
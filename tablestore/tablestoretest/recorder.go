@@ -0,0 +1,152 @@
+package tablestoretest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+type RecorderMode int
+
+const (
+	// send requests to the server and keep the exchanges
+	ModeRecord RecorderMode = iota
+	// answer requests with the recorded exchanges, without network access
+	ModeReplay
+)
+
+// Interaction is an exchange kept in a fixture file. The date, signature and
+// credentials of a request are not kept, so fixtures hold no secret and are
+// replayed whatever the time and the credentials of the client.
+type Interaction struct {
+	Action     string `json:"action"`
+	Request    []byte `json:"request"`
+	StatusCode int    `json:"status_code"`
+	RequestId  string `json:"request_id"`
+	Response   []byte `json:"response"`
+
+	replayed bool
+}
+
+// Recorder is a tablestore.IHttpClient which records exchanges with a real
+// server to a fixture file, or replays them later:
+//
+//	recorder, err := tablestoretest.NewRecorder("testdata/get_row.json", tablestoretest.ModeReplay)
+//	client := tablestore.NewClient(endpoint, instance, id, secret, tablestore.SetHttpClient(recorder))
+//
+// In ModeRecord, Save must be called to write the fixture file. In ModeReplay,
+// a request is answered by the first exchange not replayed yet with the same
+// action and body, so retries are replayed in order.
+type Recorder struct {
+	mode       RecorderMode
+	path       string
+	httpClient tablestore.IHttpClient
+
+	lock         sync.Mutex
+	interactions []*Interaction
+}
+
+var _ tablestore.IHttpClient = (*Recorder)(nil)
+
+// NewRecorder returns a recorder of the fixture file at path, which is loaded
+// in ModeReplay.
+func NewRecorder(path string, mode RecorderMode) (*Recorder, error) {
+	recorder := &Recorder{mode: mode, path: path, httpClient: &tablestore.TableStoreHttpClient{}}
+	if mode == ModeReplay {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &recorder.interactions); err != nil {
+			return nil, fmt.Errorf("[tablestore] invalid fixture %s: %s", path, err)
+		}
+	}
+	return recorder, nil
+}
+
+func (recorder *Recorder) New(client *http.Client) {
+	recorder.httpClient.New(client)
+}
+
+func (recorder *Recorder) Do(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	if recorder.mode == ModeReplay {
+		return recorder.replay(req, body)
+	}
+
+	resp, err := recorder.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	recorder.interactions = append(recorder.interactions, &Interaction{
+		Action:     req.URL.Path,
+		Request:    body,
+		StatusCode: resp.StatusCode,
+		RequestId:  resp.Header.Get("x-ots-requestid"),
+		Response:   data,
+	})
+	return resp, nil
+}
+
+func (recorder *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	for _, interaction := range recorder.interactions {
+		if interaction.replayed || interaction.Action != req.URL.Path || !bytes.Equal(interaction.Request, body) {
+			continue
+		}
+		interaction.replayed = true
+		header := make(http.Header)
+		header.Set("x-ots-requestid", interaction.RequestId)
+		return &http.Response{
+			Status:     fmt.Sprintf("%d %s", interaction.StatusCode, http.StatusText(interaction.StatusCode)),
+			StatusCode: interaction.StatusCode,
+			Header:     header,
+			Body:       ioutil.NopCloser(bytes.NewReader(interaction.Response)),
+			Request:    req,
+		}, nil
+	}
+	return nil, fmt.Errorf("[tablestore] no recorded response for %s in %s", req.URL.Path, recorder.path)
+}
+
+// Interactions returns the exchanges recorded or loaded so far.
+func (recorder *Recorder) Interactions() []*Interaction {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	return append([]*Interaction(nil), recorder.interactions...)
+}
+
+// Save writes the recorded exchanges to the fixture file.
+func (recorder *Recorder) Save() error {
+	if recorder.mode != ModeRecord {
+		return nil
+	}
+	recorder.lock.Lock()
+	data, err := json.MarshalIndent(recorder.interactions, "", "  ")
+	recorder.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(recorder.path, data, 0644)
+}
@@ -0,0 +1,67 @@
+package tablestoretest
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func recordedSession(t *testing.T, client *tablestore.TableStoreClient) {
+	meta := &tablestore.TableMeta{TableName: "t"}
+	meta.AddPrimaryKeyColumn("pk1", tablestore.PrimaryKeyType_STRING)
+	meta.AddPrimaryKeyColumn("pk2", tablestore.PrimaryKeyType_INTEGER)
+	_, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := putRow(client, primaryKey("a", 1), tablestore.RowExistenceExpectation_IGNORE, tablestore.AttributeColumn{ColumnName: "col", Value: "v", Timestamp: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	if row := getRow(t, client, primaryKey("a", 1), 1); len(row.Columns) != 1 || row.Columns[0].Value != "v" {
+		t.Fatalf("unexpected row %v", row.Columns)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tablestoretest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "fixture.json")
+
+	server := NewServer("instance", "id", "secret")
+	recorder, err := NewRecorder(path, ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.FailNext("GetRow", 1, "OTSServerBusy", "Server is busy.")
+	recordedSession(t, server.NewTableStoreClient(tablestore.SetHttpClient(recorder)))
+	server.Close()
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(recorder.Interactions()); n != 4 {
+		t.Fatalf("expect 4 interactions, got %d", n)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Fatal("fixture should not contain credentials")
+	}
+
+	// the server is gone, and credentials differ
+	replayer, err := NewRecorder(path, ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordedSession(t, tablestore.NewClient(server.URL, "instance", "other", "other", tablestore.SetHttpClient(replayer)))
+	if _, err := server.NewTableStoreClient(tablestore.SetHttpClient(replayer)).ListTable(); err == nil || !strings.Contains(err.Error(), "no recorded response") {
+		t.Fatalf("expect missing fixture error, got %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package tablestoretest
+
+import (
+	"bytes"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"reflect"
+	"sort"
+)
+
+// version is one timestamped value of an attribute column.
+type version struct {
+	value     interface{}
+	timestamp int64
+}
+
+// row is a stored row. Versions of each column are sorted by timestamp,
+// newest first.
+type row struct {
+	pk      []*tablestore.PrimaryKeyColumn
+	columns map[string][]version
+}
+
+func newRow(pk []*tablestore.PrimaryKeyColumn) *row {
+	return &row{pk: pk, columns: make(map[string][]version)}
+}
+
+func (r *row) primaryKey() *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+	for _, pkc := range r.pk {
+		pk.AddPrimaryKeyColumn(pkc.ColumnName, copyValue(pkc.Value))
+	}
+	return pk
+}
+
+func (r *row) put(name string, value interface{}, timestamp int64) {
+	versions := r.columns[name]
+	i := sort.Search(len(versions), func(i int) bool { return versions[i].timestamp <= timestamp })
+	if i < len(versions) && versions[i].timestamp == timestamp {
+		versions[i].value = value
+		return
+	}
+	versions = append(versions, version{})
+	copy(versions[i+1:], versions[i:])
+	versions[i] = version{value: value, timestamp: timestamp}
+	r.columns[name] = versions
+}
+
+func (r *row) deleteVersion(name string, timestamp int64) {
+	versions := r.columns[name]
+	for i, v := range versions {
+		if v.timestamp == timestamp {
+			versions = append(versions[:i], versions[i+1:]...)
+			break
+		}
+	}
+	if len(versions) == 0 {
+		delete(r.columns, name)
+	} else {
+		r.columns[name] = versions
+	}
+}
+
+// normalizeValue converts values of named types to the base type used by
+// the wire format, and reports whether the value is a valid column value.
+func normalizeValue(value interface{}) (interface{}, bool) {
+	if value == nil {
+		return nil, false
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), true
+	case reflect.Int64:
+		return v.Int(), true
+	case reflect.Float64:
+		return v.Float(), true
+	case reflect.Bool:
+		return v.Bool(), true
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return copyValue(v.Bytes()), true
+		}
+	}
+	return nil, false
+}
+
+func copyValue(value interface{}) interface{} {
+	if b, ok := value.([]byte); ok {
+		return append([]byte{}, b...)
+	}
+	return value
+}
+
+// compareValues compares two normalized values of the same type. ok is false
+// if their types differ.
+func compareValues(a, b interface{}) (result int, ok bool) {
+	switch av := a.(type) {
+	case int64:
+		if bv, ok := b.(int64); ok {
+			return compareInt(av, bv), true
+		}
+	case string:
+		if bv, ok := b.(string); ok {
+			return compareString(av, bv), true
+		}
+	case []byte:
+		if bv, ok := b.([]byte); ok {
+			return bytes.Compare(av, bv), true
+		}
+	case float64:
+		if bv, ok := b.(float64); ok {
+			switch {
+			case av < bv:
+				return -1, true
+			case av > bv:
+				return 1, true
+			}
+			return 0, true
+		}
+	case bool:
+		if bv, ok := b.(bool); ok {
+			if av == bv {
+				return 0, true
+			}
+			if !av {
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	return 0, false
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareString(a, b string) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// comparePrimaryKey compares primary keys of the same schema, honoring the
+// MIN and MAX options used by range boundaries.
+func comparePrimaryKey(a, b []*tablestore.PrimaryKeyColumn) int {
+	for i := range a {
+		if result := comparePrimaryKeyColumn(a[i], b[i]); result != 0 {
+			return result
+		}
+	}
+	return 0
+}
+
+func comparePrimaryKeyColumn(a, b *tablestore.PrimaryKeyColumn) int {
+	rank := func(pkc *tablestore.PrimaryKeyColumn) int {
+		switch pkc.PrimaryKeyOption {
+		case tablestore.MIN:
+			return -1
+		case tablestore.MAX:
+			return 1
+		}
+		return 0
+	}
+	ra, rb := rank(a), rank(b)
+	if ra != 0 || rb != 0 {
+		return compareInt(int64(ra), int64(rb))
+	}
+	result, _ := compareValues(a.Value, b.Value)
+	return result
+}
@@ -0,0 +1,422 @@
+package tablestoretest
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"sort"
+)
+
+func checkColumnName(name string) error {
+	if name == "" {
+		return parameterInvalid("Column name is required.")
+	}
+	return nil
+}
+
+func (client *Client) putRow(change *tablestore.PutRowChange, now int64) (*tablestore.PrimaryKey, error) {
+	t, err := client.table(change.TableName)
+	if err != nil {
+		return nil, err
+	}
+	pk, err := t.checkPrimaryKey(change.PrimaryKey, keyPut)
+	if err != nil {
+		return nil, err
+	}
+	if change.Condition == nil {
+		return nil, parameterInvalid("Row condition is required.")
+	}
+
+	r := newRow(pk)
+	for _, column := range change.Columns {
+		if err := checkColumnName(column.ColumnName); err != nil {
+			return nil, err
+		}
+		value, ok := normalizeValue(column.Value)
+		if !ok {
+			return nil, parameterInvalid(fmt.Sprintf("Invalid value type %T of column %s.", column.Value, column.ColumnName))
+		}
+		timestamp := column.Timestamp
+		if timestamp == 0 {
+			timestamp = now
+		}
+		r.put(column.ColumnName, value, timestamp)
+	}
+
+	autoIncrement := false
+	for _, pkc := range pk {
+		if pkc.PrimaryKeyOption == tablestore.AUTO_INCREMENT {
+			autoIncrement = true
+		}
+	}
+	if autoIncrement {
+		if change.Condition.RowExistenceExpectation != tablestore.RowExistenceExpectation_IGNORE {
+			return nil, parameterInvalid("The row existence expectation of a row with auto increment primary key must be IGNORE.")
+		}
+		t.sequence++
+		for _, pkc := range pk {
+			if pkc.PrimaryKeyOption == tablestore.AUTO_INCREMENT {
+				pkc.PrimaryKeyOption = tablestore.NONE
+				pkc.Value = t.sequence
+			}
+		}
+	}
+
+	if err := t.checkCondition(change.Condition, t.lookup(pk, now), now); err != nil {
+		return nil, err
+	}
+	t.store(r, true)
+
+	if change.ReturnType == tablestore.ReturnType_RT_PK {
+		return r.primaryKey(), nil
+	}
+	return nil, nil
+}
+
+func (client *Client) updateRow(change *tablestore.UpdateRowChange, now int64) error {
+	t, err := client.table(change.TableName)
+	if err != nil {
+		return err
+	}
+	pk, err := t.checkPrimaryKey(change.PrimaryKey, keyExact)
+	if err != nil {
+		return err
+	}
+	if len(change.Columns) == 0 {
+		return parameterInvalid("No column specified while updating row.")
+	}
+	values := make([]interface{}, len(change.Columns))
+	for i, column := range change.Columns {
+		if err := checkColumnName(column.ColumnName); err != nil {
+			return err
+		}
+		switch {
+		case !column.HasType:
+			value, ok := normalizeValue(column.Value)
+			if !ok {
+				return parameterInvalid(fmt.Sprintf("Invalid value type %T of column %s.", column.Value, column.ColumnName))
+			}
+			values[i] = value
+		case column.Type == tablestore.DELETE_ONE_VERSION && !column.HasTimestamp:
+			return parameterInvalid("Timestamp is required to delete one version.")
+		case column.Type != tablestore.DELETE_ALL_VERSION && column.Type != tablestore.DELETE_ONE_VERSION:
+			return parameterInvalid(fmt.Sprintf("Unsupported update type %d of column %s.", column.Type, column.ColumnName))
+		}
+	}
+
+	existing := t.lookup(pk, now)
+	if err := t.checkCondition(change.Condition, existing, now); err != nil {
+		return err
+	}
+
+	r := existing
+	if r == nil {
+		r = newRow(pk)
+	}
+	for i, column := range change.Columns {
+		switch {
+		case !column.HasType:
+			timestamp := now
+			if column.HasTimestamp {
+				timestamp = column.Timestamp
+			}
+			r.put(column.ColumnName, values[i], timestamp)
+		case column.Type == tablestore.DELETE_ALL_VERSION:
+			delete(r.columns, column.ColumnName)
+		default:
+			r.deleteVersion(column.ColumnName, column.Timestamp)
+		}
+	}
+	// updating a missing row only with deletions does not create it
+	t.store(r, existing != nil || len(r.columns) > 0)
+	return nil
+}
+
+func (client *Client) deleteRow(change *tablestore.DeleteRowChange, now int64) error {
+	t, err := client.table(change.TableName)
+	if err != nil {
+		return err
+	}
+	pk, err := t.checkPrimaryKey(change.PrimaryKey, keyExact)
+	if err != nil {
+		return err
+	}
+	existing := t.lookup(pk, now)
+	if err := t.checkCondition(change.Condition, existing, now); err != nil {
+		return err
+	}
+	t.store(newRow(pk), false)
+	return nil
+}
+
+// getRow returns the primary key and columns of the row, both nil if the row
+// does not exist or is filtered out.
+func (client *Client) getRow(tableName string, primaryKey *tablestore.PrimaryKey, options *readOptions, now int64) (*tablestore.PrimaryKey, []*tablestore.AttributeColumn, error) {
+	if err := options.check(); err != nil {
+		return nil, nil, err
+	}
+	t, err := client.table(tableName)
+	if err != nil {
+		return nil, nil, err
+	}
+	pk, err := t.checkPrimaryKey(primaryKey, keyExact)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := t.lookup(pk, now)
+	if r == nil {
+		return nil, nil, nil
+	}
+	matched, err := t.match(options.filter, r, now)
+	if err != nil || !matched {
+		return nil, nil, err
+	}
+	columns := t.read(r, options, now)
+	if len(columns) == 0 && !t.selectsPrimaryKey(options.columnsToGet) {
+		return nil, nil, nil
+	}
+	return r.primaryKey(), columns, nil
+}
+
+func (client *Client) PutRow(request *tablestore.PutRowRequest) (*tablestore.PutRowResponse, error) {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	pk, err := client.putRow(request.PutRowChange, client.now())
+	if err != nil {
+		return nil, err
+	}
+	response := &tablestore.PutRowResponse{ConsumedCapacityUnit: &tablestore.ConsumedCapacityUnit{Write: 1}}
+	if pk != nil {
+		response.PrimaryKey = *pk
+	}
+	response.RequestId = client.nextRequestId()
+	return response, nil
+}
+
+func (client *Client) UpdateRow(request *tablestore.UpdateRowRequest) (*tablestore.UpdateRowResponse, error) {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	if err := client.updateRow(request.UpdateRowChange, client.now()); err != nil {
+		return nil, err
+	}
+	response := &tablestore.UpdateRowResponse{ConsumedCapacityUnit: &tablestore.ConsumedCapacityUnit{Write: 1}}
+	response.RequestId = client.nextRequestId()
+	return response, nil
+}
+
+func (client *Client) DeleteRow(request *tablestore.DeleteRowRequest) (*tablestore.DeleteRowResponse, error) {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	if err := client.deleteRow(request.DeleteRowChange, client.now()); err != nil {
+		return nil, err
+	}
+	response := &tablestore.DeleteRowResponse{ConsumedCapacityUnit: &tablestore.ConsumedCapacityUnit{Write: 1}}
+	response.RequestId = client.nextRequestId()
+	return response, nil
+}
+
+func (client *Client) GetRow(request *tablestore.GetRowRequest) (*tablestore.GetRowResponse, error) {
+	criteria := request.SingleRowQueryCriteria
+	options := &readOptions{
+		columnsToGet: criteria.ColumnsToGet,
+		maxVersion:   int(criteria.MaxVersion),
+		timeRange:    criteria.TimeRange,
+		filter:       criteria.Filter,
+		startColumn:  criteria.StartColumn,
+		endColumn:    criteria.EndColumn,
+	}
+
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	pk, columns, err := client.getRow(criteria.TableName, criteria.PrimaryKey, options, client.now())
+	if err != nil {
+		return nil, err
+	}
+	response := &tablestore.GetRowResponse{Columns: columns, ConsumedCapacityUnit: &tablestore.ConsumedCapacityUnit{Read: 1}}
+	if pk != nil {
+		response.PrimaryKey = *pk
+	}
+	response.RequestId = client.nextRequestId()
+	return response, nil
+}
+
+func rowError(err error) tablestore.Error {
+	if e, ok := err.(*serverError); ok {
+		return tablestore.Error{Code: e.code, Message: e.message}
+	}
+	return tablestore.Error{Code: "OTSParameterInvalid", Message: err.Error()}
+}
+
+func (client *Client) BatchGetRow(request *tablestore.BatchGetRowRequest) (*tablestore.BatchGetRowResponse, error) {
+	count := 0
+	for _, criteria := range request.MultiRowQueryCriteria {
+		if criteria.MaxVersion == 0 && criteria.TimeRange == nil {
+			return nil, errInvalidInput
+		}
+		count += len(criteria.PrimaryKey)
+	}
+	if count > batchGetRowLimit {
+		return nil, parameterInvalid(fmt.Sprintf("Rows count exceeds the upper limit: %d.", batchGetRowLimit))
+	}
+
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	now := client.now()
+	response := &tablestore.BatchGetRowResponse{TableToRowsResult: make(map[string][]tablestore.RowResult)}
+	for _, criteria := range request.MultiRowQueryCriteria {
+		options := &readOptions{
+			columnsToGet: criteria.ColumnsToGet,
+			maxVersion:   criteria.MaxVersion,
+			timeRange:    criteria.TimeRange,
+			filter:       criteria.Filter,
+			startColumn:  criteria.StartColumn,
+			endColumn:    criteria.EndColumn,
+		}
+		for i, primaryKey := range criteria.PrimaryKey {
+			result := tablestore.RowResult{TableName: criteria.TableName, Index: int32(i)}
+			pk, columns, err := client.getRow(criteria.TableName, primaryKey, options, now)
+			if err != nil {
+				result.Error = rowError(err)
+			} else {
+				result.IsSucceed = true
+				result.Columns = columns
+				result.ConsumedCapacityUnit = &tablestore.ConsumedCapacityUnit{Read: 1}
+				if pk != nil {
+					result.PrimaryKey = *pk
+				}
+			}
+			response.TableToRowsResult[criteria.TableName] = append(response.TableToRowsResult[criteria.TableName], result)
+		}
+	}
+	response.RequestId = client.nextRequestId()
+	return response, nil
+}
+
+func (client *Client) BatchWriteRow(request *tablestore.BatchWriteRowRequest) (*tablestore.BatchWriteRowResponse, error) {
+	count := 0
+	tableNames := make([]string, 0, len(request.RowChangesGroupByTable))
+	for tableName, changes := range request.RowChangesGroupByTable {
+		count += len(changes)
+		tableNames = append(tableNames, tableName)
+	}
+	if count > batchWriteRowLimit {
+		return nil, parameterInvalid(fmt.Sprintf("Rows count exceeds the upper limit: %d.", batchWriteRowLimit))
+	}
+	sort.Strings(tableNames)
+
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	now := client.now()
+	response := &tablestore.BatchWriteRowResponse{TableToRowsResult: make(map[string][]tablestore.RowResult)}
+	for _, tableName := range tableNames {
+		for i, change := range request.RowChangesGroupByTable[tableName] {
+			result := tablestore.RowResult{TableName: tableName, Index: int32(i)}
+			var pk *tablestore.PrimaryKey
+			var err error
+			switch c := change.(type) {
+			case *tablestore.PutRowChange:
+				pk, err = client.putRow(c, now)
+			case *tablestore.UpdateRowChange:
+				err = client.updateRow(c, now)
+			case *tablestore.DeleteRowChange:
+				err = client.deleteRow(c, now)
+			default:
+				err = parameterInvalid(fmt.Sprintf("Unsupported row change %T.", change))
+			}
+			if err == nil && change.GetTableName() != tableName {
+				err = parameterInvalid("Table name of row change does not match the group.")
+			}
+			if err != nil {
+				result.Error = rowError(err)
+			} else {
+				result.IsSucceed = true
+				result.ConsumedCapacityUnit = &tablestore.ConsumedCapacityUnit{Write: 1}
+				if pk != nil {
+					result.PrimaryKey = *pk
+				}
+			}
+			response.TableToRowsResult[tableName] = append(response.TableToRowsResult[tableName], result)
+		}
+	}
+	response.RequestId = client.nextRequestId()
+	return response, nil
+}
+
+func (client *Client) GetRange(request *tablestore.GetRangeRequest) (*tablestore.GetRangeResponse, error) {
+	criteria := request.RangeRowQueryCriteria
+	options := &readOptions{
+		columnsToGet: criteria.ColumnsToGet,
+		maxVersion:   int(criteria.MaxVersion),
+		timeRange:    criteria.TimeRange,
+		filter:       criteria.Filter,
+		startColumn:  criteria.StartColumn,
+		endColumn:    criteria.EndColumn,
+	}
+	if err := options.check(); err != nil {
+		return nil, err
+	}
+
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	now := client.now()
+	t, err := client.table(criteria.TableName)
+	if err != nil {
+		return nil, err
+	}
+	start, err := t.checkPrimaryKey(criteria.StartPrimaryKey, keyRange)
+	if err != nil {
+		return nil, err
+	}
+	end, err := t.checkPrimaryKey(criteria.EndPrimaryKey, keyRange)
+	if err != nil {
+		return nil, err
+	}
+	forward := criteria.Direction == tablestore.FORWARD
+	if cmp := comparePrimaryKey(start, end); (forward && cmp > 0) || (!forward && cmp < 0) {
+		return nil, parameterInvalid("The start primary key is out of order against the end primary key in the scan direction.")
+	}
+
+	limit := client.RangeLimit
+	if limit <= 0 {
+		limit = DefaultRangeLimit
+	}
+	if criteria.Limit > 0 && int(criteria.Limit) < limit {
+		limit = int(criteria.Limit)
+	}
+
+	i, found := t.find(start)
+	step := 1
+	if !forward {
+		step = -1
+		if !found {
+			i--
+		}
+	}
+	response := &tablestore.GetRangeResponse{ConsumedCapacityUnit: &tablestore.ConsumedCapacityUnit{Read: 1}}
+	for ; i >= 0 && i < len(t.rows); i += step {
+		r := t.rows[i]
+		if cmp := comparePrimaryKey(r.pk, end); (forward && cmp >= 0) || (!forward && cmp <= 0) {
+			break
+		}
+		if len(response.Rows) >= limit {
+			response.NextStartPrimaryKey = r.primaryKey()
+			break
+		}
+		if !t.exists(r, now) {
+			continue
+		}
+		matched, err := t.match(options.filter, r, now)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			continue
+		}
+		columns := t.read(r, options, now)
+		if len(columns) == 0 && !t.selectsPrimaryKey(options.columnsToGet) {
+			continue
+		}
+		response.Rows = append(response.Rows, &tablestore.Row{PrimaryKey: r.primaryKey(), Columns: columns})
+	}
+	response.RequestId = client.nextRequestId()
+	return response, nil
+}
@@ -0,0 +1,239 @@
+package tablestoretest
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
+	"github.com/golang/protobuf/proto"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// headers every request must carry
+var requiredHeaders = []string{
+	"x-ots-date",
+	"x-ots-apiversion",
+	"x-ots-accesskeyid",
+	"x-ots-contentmd5",
+	"x-ots-instancename",
+	"x-ots-signature",
+}
+
+// Server is a TableStore endpoint backed by a Client. Unlike the Client, it
+// speaks the wire protocol: requests must be signed with the access key of the
+// server, and carry protobuf messages with rows in plainbuffer format. It lets
+// tests exercise the whole code path of tablestore.TableStoreClient, including
+// signing and retries:
+//
+//	server := tablestoretest.NewServer("instance", "id", "secret")
+//	defer server.Close()
+//	client := server.NewTableStoreClient()
+type Server struct {
+	// Store holds the data of the server. It may be used to prepare or check
+	// data without going through the wire.
+	Store *Client
+	// URL of the server, e.g. http://127.0.0.1:1234.
+	URL string
+
+	instanceName    string
+	accessKeyId     string
+	accessKeySecret string
+	server          *httptest.Server
+
+	lock      sync.Mutex
+	failures  map[string][]error
+	requestId int64
+}
+
+// NewServer starts a server listening on a local port. It must be closed by
+// Close.
+func NewServer(instanceName, accessKeyId, accessKeySecret string) *Server {
+	server := &Server{
+		Store:           NewClient(),
+		instanceName:    instanceName,
+		accessKeyId:     accessKeyId,
+		accessKeySecret: accessKeySecret,
+		failures:        make(map[string][]error),
+	}
+	server.server = httptest.NewServer(server)
+	server.URL = server.server.URL
+	return server
+}
+
+func (server *Server) Close() {
+	server.server.Close()
+}
+
+// NewTableStoreClient returns a client of the server using its credentials.
+func (server *Server) NewTableStoreClient(options ...tablestore.ClientOption) *tablestore.TableStoreClient {
+	return tablestore.NewClient(server.URL, server.instanceName, server.accessKeyId, server.accessKeySecret, options...)
+}
+
+// FailNext makes the next n requests of action, e.g. "GetRow", fail with the
+// given error code before reaching the store. The HTTP status of the response
+// depends on the code, e.g. 503 for "OTSServerBusy".
+func (server *Server) FailNext(action string, n int, code, message string) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	for i := 0; i < n; i++ {
+		server.failures[action] = append(server.failures[action], otsError(code, message))
+	}
+}
+
+func (server *Server) nextFailure(action string) error {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	failures := server.failures[action]
+	if len(failures) == 0 {
+		return nil
+	}
+	server.failures[action] = failures[1:]
+	return failures[0]
+}
+
+func (server *Server) nextRequestId() string {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.requestId++
+	return fmt.Sprintf("tablestoretest-server-%d", server.requestId)
+}
+
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("x-ots-requestid", server.nextRequestId())
+	action := strings.TrimPrefix(r.URL.Path, "/")
+
+	var body []byte
+	var err error
+	if r.Method != "POST" {
+		err = otsError("OTSMethodNotAllowed", "Only POST method is allowed.")
+	} else {
+		body, err = ioutil.ReadAll(r.Body)
+	}
+	if err == nil {
+		err = server.authenticate(r, body)
+	}
+	if err == nil {
+		err = server.nextFailure(action)
+	}
+	var resp proto.Message
+	if err == nil {
+		resp, err = server.handle(action, body)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var data []byte
+	if resp != nil {
+		if data, err = proto.Marshal(resp); err != nil {
+			writeError(w, otsError("OTSInternalServerError", err.Error()))
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// authenticate checks the credentials, content md5 and signature of r the way
+// the service does.
+func (server *Server) authenticate(r *http.Request, body []byte) error {
+	for _, name := range requiredHeaders {
+		if r.Header.Get(name) == "" {
+			return otsError("OTSAuthFailed", fmt.Sprintf("Missing header: %s.", name))
+		}
+	}
+	if r.Header.Get("x-ots-accesskeyid") != server.accessKeyId {
+		return otsError("OTSAuthFailed", "The AccessKeyID is disabled or does not exist.")
+	}
+	if r.Header.Get("x-ots-instancename") != server.instanceName {
+		return otsError("OTSAuthFailed", "The instance is not found.")
+	}
+	sum := md5.Sum(body)
+	if r.Header.Get("x-ots-contentmd5") != base64.StdEncoding.EncodeToString(sum[:]) {
+		return otsError("OTSAuthFailed", "Mismatch between MD5 value of request body and x-ots-contentmd5 in header.")
+	}
+
+	// StringToSign = CanonicalURI + '\n' + HTTPRequestMethod + '\n' + CanonicalQueryString + '\n' + CanonicalHeaders
+	var names []string
+	for name := range r.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-ots-") && name != "x-ots-signature" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	stringToSign := r.URL.Path + "\n" + r.Method + "\n" + "\n"
+	for _, name := range names {
+		stringToSign += name + ":" + strings.TrimSpace(r.Header.Get(name)) + "\n"
+	}
+	mac := hmac.New(sha1.New, []byte(server.accessKeySecret))
+	mac.Write([]byte(stringToSign))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get("x-ots-signature"))) {
+		return otsError("OTSAuthFailed", "Signature mismatch.")
+	}
+	return nil
+}
+
+func httpStatus(code string) int {
+	switch code {
+	case "OTSAuthFailed", "OTSConditionCheckFail":
+		return http.StatusForbidden
+	case "OTSObjectNotExist":
+		return http.StatusNotFound
+	case "OTSMethodNotAllowed":
+		return http.StatusMethodNotAllowed
+	case "OTSObjectAlreadyExist":
+		return http.StatusConflict
+	case "OTSInternalServerError":
+		return http.StatusInternalServerError
+	case "OTSServerBusy", "OTSServerUnavailable", "OTSPartitionUnavailable", "OTSTableNotReady", "OTSTimeout":
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	e := rowError(err)
+	data, _ := proto.Marshal(&otsprotocol.Error{Code: proto.String(e.Code), Message: proto.String(e.Message)})
+	w.WriteHeader(httpStatus(e.Code))
+	w.Write(data)
+}
+
+func (server *Server) handle(action string, body []byte) (proto.Message, error) {
+	handlers := map[string]func([]byte) (proto.Message, error){
+		"CreateTable":   server.createTable,
+		"ListTable":     server.listTable,
+		"DeleteTable":   server.deleteTable,
+		"DescribeTable": server.describeTable,
+		"UpdateTable":   server.updateTable,
+		"PutRow":        server.putRow,
+		"UpdateRow":     server.updateRow,
+		"DeleteRow":     server.deleteRow,
+		"GetRow":        server.getRow,
+		"BatchGetRow":   server.batchGetRow,
+		"BatchWriteRow": server.batchWriteRow,
+		"GetRange":      server.getRange,
+	}
+	handler, ok := handlers[action]
+	if !ok {
+		return nil, errUnsupported
+	}
+	return handler(body)
+}
+
+func unmarshal(body []byte, req proto.Message) error {
+	if err := proto.Unmarshal(body, req); err != nil {
+		return parameterInvalid(fmt.Sprintf("Failed to parse request: %s.", err))
+	}
+	return nil
+}
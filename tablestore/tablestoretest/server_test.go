@@ -0,0 +1,228 @@
+package tablestoretest
+
+import (
+	"context"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"strings"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	server := NewServer("instance", "id", "secret")
+	defer server.Close()
+	client := server.NewTableStoreClient()
+
+	meta := &tablestore.TableMeta{TableName: "t"}
+	meta.AddPrimaryKeyColumn("pk1", tablestore.PrimaryKeyType_STRING)
+	meta.AddPrimaryKeyColumnOption("pk2", tablestore.PrimaryKeyType_INTEGER, tablestore.AUTO_INCREMENT)
+	meta.AddDefinedColumn("col", tablestore.DefinedColumn_INTEGER)
+	_, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 2), ReservedThroughput: &tablestore.ReservedThroughput{Readcap: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	describe, err := client.DescribeTable(&tablestore.DescribeTableRequest{TableName: "t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(describe.TableMeta.SchemaEntry) != 2 || *describe.TableMeta.SchemaEntry[1].Option != tablestore.AUTO_INCREMENT || len(describe.TableMeta.DefinedColumns) != 1 || describe.ReservedThroughput.Readcap != 1 || describe.TableOption.MaxVersion != 2 {
+		t.Fatalf("unexpected table %v", describe)
+	}
+
+	pk := primaryKey("a", 1)
+	if err := putRow(client, pk, tablestore.RowExistenceExpectation_EXPECT_EXIST); err == nil || !strings.HasPrefix(err.Error(), "OTSConditionCheckFail") {
+		t.Fatalf("expect condition check failure, got %v", err)
+	}
+	if err := putRow(client, pk, tablestore.RowExistenceExpectation_IGNORE, tablestore.AttributeColumn{ColumnName: "col", Value: int64(1), Timestamp: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	update := &tablestore.UpdateRowChange{TableName: "t", PrimaryKey: pk}
+	update.SetCondition(tablestore.RowExistenceExpectation_EXPECT_EXIST)
+	update.PutColumn("name", []byte("foo"))
+	update.PutColumn("score", 1.5)
+	update.PutColumn("ok", true)
+	update.DeleteColumnWithTimestamp("col", 1000)
+	condition := tablestore.NewCompositeColumnCondition(tablestore.LO_AND)
+	condition.AddFilter(tablestore.NewSingleColumnCondition("col", tablestore.CT_EQUAL, int64(1)))
+	condition.AddFilter(tablestore.NewSingleColumnCondition("missing", tablestore.CT_NOT_EQUAL, "x"))
+	update.SetColumnCondition(condition)
+	if _, err := client.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: update}); err != nil {
+		t.Fatal(err)
+	}
+	row := getRow(t, client, pk, 1)
+	if len(row.Columns) != 3 || string(row.Columns[0].Value.([]byte)) != "foo" || row.Columns[1].Value != true || row.Columns[2].Value != 1.5 {
+		t.Fatalf("unexpected row %v", row.Columns)
+	}
+
+	auto := new(tablestore.PrimaryKey)
+	auto.AddPrimaryKeyColumn("pk1", "b")
+	auto.AddPrimaryKeyColumnWithAutoIncrement("pk2")
+	change := &tablestore.PutRowChange{TableName: "t", PrimaryKey: auto}
+	change.AddColumn("col", int64(2))
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	change.SetReturnPk()
+	put, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: change})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(put.PrimaryKey.PrimaryKeys) != 2 || put.PrimaryKey.PrimaryKeys[1].Value != int64(1) {
+		t.Fatalf("unexpected returned primary key %v", put.PrimaryKey.PrimaryKeys)
+	}
+
+	batch := &tablestore.BatchWriteRowRequest{}
+	remove := &tablestore.DeleteRowChange{TableName: "t", PrimaryKey: pk}
+	remove.SetCondition(tablestore.RowExistenceExpectation_EXPECT_EXIST)
+	batch.AddRowChange(remove)
+	failed := &tablestore.DeleteRowChange{TableName: "t", PrimaryKey: primaryKey("x", 1)}
+	failed.SetCondition(tablestore.RowExistenceExpectation_EXPECT_EXIST)
+	batch.AddRowChange(failed)
+	write, err := client.BatchWriteRow(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results := write.TableToRowsResult["t"]; len(results) != 2 || !results[0].IsSucceed || results[1].Error.Code != "OTSConditionCheckFail" {
+		t.Fatalf("unexpected batch write results %v", results)
+	}
+
+	// idempotent reads are retried on server errors, writes only on some codes
+	server.FailNext("GetRange", 2, "OTSInternalServerError", "Internal error.")
+	criteria := &tablestore.RangeRowQueryCriteria{TableName: "t", MaxVersion: 1}
+	criteria.StartPrimaryKey = new(tablestore.PrimaryKey)
+	criteria.StartPrimaryKey.AddPrimaryKeyColumnWithMinValue("pk1")
+	criteria.StartPrimaryKey.AddPrimaryKeyColumnWithMinValue("pk2")
+	criteria.EndPrimaryKey = new(tablestore.PrimaryKey)
+	criteria.EndPrimaryKey.AddPrimaryKeyColumnWithMaxValue("pk1")
+	criteria.EndPrimaryKey.AddPrimaryKeyColumnWithMaxValue("pk2")
+	criteria.Filter = tablestore.NewSingleColumnCondition("col", tablestore.CT_GREATER_THAN, int64(1))
+	rangeResp, err := client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: criteria})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rangeResp.Rows) != 1 || rangeResp.Rows[0].PrimaryKey.PrimaryKeys[0].Value != "b" || rangeResp.NextStartPrimaryKey != nil {
+		t.Fatalf("unexpected range result %v", rangeResp.Rows)
+	}
+	server.FailNext("PutRow", 1, "OTSInternalServerError", "Internal error.")
+	if err := putRow(client, pk, tablestore.RowExistenceExpectation_IGNORE); err == nil || !strings.HasPrefix(err.Error(), "OTSInternalServerError") {
+		t.Fatalf("expect internal server error, got %v", err)
+	}
+
+	multi := &tablestore.MultiRowQueryCriteria{TableName: "t", MaxVersion: 1}
+	multi.AddRow(primaryKey("b", 1))
+	multi.AddRow(primaryKey("a", 1))
+	get, err := client.BatchGetRow(&tablestore.BatchGetRowRequest{MultiRowQueryCriteria: []*tablestore.MultiRowQueryCriteria{multi}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows := get.TableToRowsResult["t"]; len(rows) != 2 || rows[0].Columns[0].Value != int64(2) || len(rows[1].PrimaryKey.PrimaryKeys) != 0 {
+		t.Fatalf("unexpected batch get results %v", rows)
+	}
+
+	bad := tablestore.NewClient(server.URL, "instance", "id", "wrong")
+	if _, err := bad.ListTable(); err == nil || !strings.HasPrefix(err.Error(), "OTSAuthFailed") {
+		t.Fatalf("expect signature mismatch, got %v", err)
+	}
+	if _, err := client.DeleteTable(&tablestore.DeleteTableRequest{TableName: "t"}); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := client.ListTable(); err != nil || len(list.TableNames) != 0 {
+		t.Fatalf("unexpected tables %v %v", list, err)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	server := NewServer("instance", "id", "secret")
+	defer server.Close()
+	server.Store.RangeLimit = 2
+	client := server.NewTableStoreClient()
+
+	meta := &tablestore.TableMeta{TableName: "orders"}
+	meta.AddPrimaryKeyColumn("user", tablestore.PrimaryKeyType_STRING)
+	meta.AddPrimaryKeyColumn("ts", tablestore.PrimaryKeyType_INTEGER)
+	if _, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []string{"u1", "u2"} {
+		for ts := int64(1); ts <= 5; ts++ {
+			pk := new(tablestore.PrimaryKey)
+			pk.AddPrimaryKeyColumn("user", user)
+			pk.AddPrimaryKeyColumn("ts", ts)
+			change := &tablestore.PutRowChange{TableName: "orders", PrimaryKey: pk}
+			if ts%2 == 1 {
+				change.AddColumn("status", "open")
+			} else {
+				change.AddColumn("status", "closed")
+			}
+			change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+			if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: change}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	ctx := context.Background()
+	timestamps := func(query *tablestore.Query) []int64 {
+		rows, err := query.Run(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ts []int64
+		for _, row := range rows {
+			ts = append(ts, row.PrimaryKey.PrimaryKeys[1].Value.(int64))
+		}
+		return ts
+	}
+	open := []tablestore.ColumnFilter{tablestore.Col("user").Equal("u1"), tablestore.Col("status").Equal("open")}
+	for _, c := range []struct {
+		query    *tablestore.Query
+		expected string
+	}{
+		{client.Query("orders").Where(open...), "[1 3 5]"},
+		{client.Query("orders").Where(open...).Limit(2), "[1 3]"},
+		{client.Query("orders").Where(open...).Reverse(), "[5 3 1]"},
+		{client.Query("orders").Where(tablestore.Col("user").Equal("u2"), tablestore.Col("ts").GreaterEqual(int64(2)), tablestore.Col("ts").LessThan(int64(4))), "[2 3]"},
+		{client.Query("orders").Where(tablestore.Col("user").Equal("u2"), tablestore.Col("ts").LessThan(int64(3))).Reverse(), "[2 1]"},
+		{client.Query("orders").Where(tablestore.Col("user").Equal("u2"), tablestore.Col("ts").Equal(int64(4))), "[4]"},
+		{client.Query("orders").Where(tablestore.Col("user").Equal("u2"), tablestore.Col("ts").Equal(int64(4)), tablestore.Col("status").Equal("open")), "[]"},
+		{client.Query("orders").Where(tablestore.AnyOf(tablestore.Col("status").Equal("closed"), tablestore.Col("missing").Equal(int64(1)))), "[2 4 2 4]"},
+		{client.Query("orders").Where(tablestore.Col("user").Equal("u1"), tablestore.NoneOf(tablestore.Col("status").Equal("closed"))), "[1 3 5]"},
+	} {
+		if ts := fmt.Sprint(timestamps(c.query)); ts != c.expected {
+			t.Errorf("unexpected rows %s, expected %s", ts, c.expected)
+		}
+	}
+	if rows, err := client.Query("orders").Select("user").Run(ctx); err != nil || len(rows) != 10 || len(rows[0].Columns) != 0 {
+		t.Errorf("unexpected selection %v, %v", rows, err)
+	}
+	if _, err := client.Query("orders").Where(tablestore.Col("ts").Equal(int64(1))).Run(ctx); err == nil {
+		t.Error("condition on a primary key column without the former ones compiled")
+	}
+}
+
+func TestMissingTableIsNotUnsupported(t *testing.T) {
+	server := NewServer("instance", "id", "secret")
+	defer server.Close()
+	client := server.NewTableStoreClient()
+
+	meta := &tablestore.TableMeta{TableName: "t"}
+	meta.AddPrimaryKeyColumn("pk1", tablestore.PrimaryKeyType_STRING)
+	meta.AddPrimaryKeyColumn("pk2", tablestore.PrimaryKeyType_INTEGER)
+	if _, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+		t.Fatal(err)
+	}
+	// the server answers OTSObjectNotExist with 404
+	criteria := &tablestore.SingleRowQueryCriteria{TableName: "missing", PrimaryKey: primaryKey("a", 1), MaxVersion: 1}
+	_, err := client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err == nil || !strings.HasPrefix(err.Error(), "OTSObjectNotExist") || tablestore.IsUnsupported(err) {
+		t.Fatalf("expect missing table, got %v", err)
+	}
+	if _, err := client.DescribeTable(&tablestore.DescribeTableRequest{TableName: "missing"}); err == nil || tablestore.IsUnsupported(err) {
+		t.Fatalf("expect missing table, got %v", err)
+	}
+	getRow(t, client, primaryKey("a", 1), 1)
+	if _, err := client.DescribeTable(&tablestore.DescribeTableRequest{TableName: "t"}); err != nil {
+		t.Fatal(err)
+	}
+	if !client.Supports("GetRow") || !client.Supports("DescribeTable") {
+		t.Fatal("missing table recorded as unsupported action")
+	}
+}
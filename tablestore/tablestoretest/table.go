@@ -0,0 +1,270 @@
+package tablestoretest
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"sort"
+)
+
+type table struct {
+	meta       tablestore.TableMeta
+	option     tablestore.TableOption
+	throughput tablestore.ReservedThroughput
+	// sorted by primary key
+	rows []*row
+	// last generated auto increment value
+	sequence int64
+}
+
+// primary key validation modes
+const (
+	keyExact = iota
+	keyPut
+	keyRange
+)
+
+// checkPrimaryKey validates pk against the table schema and returns a
+// normalized copy of it. AUTO_INCREMENT columns are only allowed by keyPut,
+// MIN and MAX columns only by keyRange.
+func (t *table) checkPrimaryKey(pk *tablestore.PrimaryKey, mode int) ([]*tablestore.PrimaryKeyColumn, error) {
+	if pk == nil || len(pk.PrimaryKeys) != len(t.meta.SchemaEntry) {
+		return nil, parameterInvalid("The number of primary key columns does not match the table meta.")
+	}
+	columns := make([]*tablestore.PrimaryKeyColumn, len(pk.PrimaryKeys))
+	for i, schema := range t.meta.SchemaEntry {
+		pkc := pk.PrimaryKeys[i]
+		if pkc.ColumnName != *schema.Name {
+			return nil, parameterInvalid(fmt.Sprintf("Validate PK name fail. Input: %s, Meta: %s.", pkc.ColumnName, *schema.Name))
+		}
+
+		column := &tablestore.PrimaryKeyColumn{ColumnName: pkc.ColumnName, PrimaryKeyOption: pkc.PrimaryKeyOption}
+		switch pkc.PrimaryKeyOption {
+		case tablestore.MIN, tablestore.MAX:
+			if mode != keyRange {
+				return nil, parameterInvalid("INF_MIN and INF_MAX are only allowed in range boundaries.")
+			}
+		case tablestore.AUTO_INCREMENT:
+			if mode != keyPut || schema.Option == nil || *schema.Option != tablestore.AUTO_INCREMENT {
+				return nil, parameterInvalid(fmt.Sprintf("Primary key %s is not an auto increment column.", pkc.ColumnName))
+			}
+		default:
+			value, ok := normalizeValue(pkc.Value)
+			switch value.(type) {
+			case int64:
+				ok = ok && *schema.Type == tablestore.PrimaryKeyType_INTEGER
+			case string:
+				ok = ok && *schema.Type == tablestore.PrimaryKeyType_STRING
+			case []byte:
+				ok = ok && *schema.Type == tablestore.PrimaryKeyType_BINARY
+			default:
+				ok = false
+			}
+			if !ok {
+				return nil, parameterInvalid(fmt.Sprintf("Validate PK type fail. Input: %T, column: %s.", pkc.Value, pkc.ColumnName))
+			}
+			column.Value = value
+		}
+		columns[i] = column
+	}
+	return columns, nil
+}
+
+// find returns the position of pk in the sorted rows, and whether a row with
+// that key is stored there.
+func (t *table) find(pk []*tablestore.PrimaryKeyColumn) (int, bool) {
+	i := sort.Search(len(t.rows), func(i int) bool {
+		return comparePrimaryKey(t.rows[i].pk, pk) >= 0
+	})
+	return i, i < len(t.rows) && comparePrimaryKey(t.rows[i].pk, pk) == 0
+}
+
+func (t *table) insert(i int, r *row) {
+	t.rows = append(t.rows, nil)
+	copy(t.rows[i+1:], t.rows[i:])
+	t.rows[i] = r
+}
+
+func (t *table) remove(i int) {
+	t.rows = append(t.rows[:i], t.rows[i+1:]...)
+}
+
+// lookup returns the live row with key pk, or nil.
+func (t *table) lookup(pk []*tablestore.PrimaryKeyColumn, now int64) *row {
+	i, found := t.find(pk)
+	if !found || !t.exists(t.rows[i], now) {
+		return nil
+	}
+	return t.rows[i]
+}
+
+// store replaces or inserts r if keep is set, otherwise removes the row with
+// the same key.
+func (t *table) store(r *row, keep bool) {
+	i, found := t.find(r.pk)
+	switch {
+	case found && keep:
+		t.rows[i] = r
+	case found:
+		t.remove(i)
+	case keep:
+		t.insert(i, r)
+	}
+}
+
+// visibleVersions returns the versions of a column within the max versions
+// and time to live of the table, newest first.
+func (t *table) visibleVersions(r *row, name string, now int64) []version {
+	versions := r.columns[name]
+	if t.option.MaxVersion > 0 && len(versions) > t.option.MaxVersion {
+		versions = versions[:t.option.MaxVersion]
+	}
+	if t.option.TimeToAlive > 0 {
+		expire := now - int64(t.option.TimeToAlive)*1000
+		versions = versions[:sort.Search(len(versions), func(i int) bool { return versions[i].timestamp <= expire })]
+	}
+	return versions
+}
+
+// exists reports whether r is visible. A row whose columns all expired does
+// not exist any more, while a row written without columns does.
+func (t *table) exists(r *row, now int64) bool {
+	if len(r.columns) == 0 {
+		return true
+	}
+	for name := range r.columns {
+		if len(t.visibleVersions(r, name, now)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *table) checkCondition(condition *tablestore.RowCondition, existing *row, now int64) error {
+	if condition == nil {
+		return parameterInvalid("Row condition is required.")
+	}
+	switch condition.RowExistenceExpectation {
+	case tablestore.RowExistenceExpectation_EXPECT_EXIST:
+		if existing == nil {
+			return errConditionCheckFail
+		}
+	case tablestore.RowExistenceExpectation_EXPECT_NOT_EXIST:
+		if existing != nil {
+			return errConditionCheckFail
+		}
+	}
+	if condition.ColumnCondition != nil {
+		if paginationOf(condition.ColumnCondition) != nil {
+			return parameterInvalid("Column pagination filter is not allowed in row condition.")
+		}
+		matched, err := t.match(condition.ColumnCondition, existing, now)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			return errConditionCheckFail
+		}
+	}
+	return nil
+}
+
+type readOptions struct {
+	columnsToGet []string
+	maxVersion   int
+	timeRange    *tablestore.TimeRange
+	filter       tablestore.ColumnFilter
+	startColumn  *string
+	endColumn    *string
+}
+
+func (options *readOptions) check() error {
+	if options.maxVersion == 0 && options.timeRange == nil {
+		return errInvalidInput
+	}
+	if options.maxVersion < 0 {
+		return parameterInvalid("MaxVersions must be positive.")
+	}
+	return nil
+}
+
+func (options *readOptions) inTimeRange(timestamp int64) bool {
+	timeRange := options.timeRange
+	if timeRange == nil {
+		return true
+	}
+	if timeRange.Specific != 0 {
+		return timestamp == timeRange.Specific
+	}
+	return timestamp >= timeRange.Start && timestamp < timeRange.End
+}
+
+// read returns the columns of r selected by options, sorted by column name,
+// newest version first.
+func (t *table) read(r *row, options *readOptions, now int64) []*tablestore.AttributeColumn {
+	wanted := make(map[string]bool, len(options.columnsToGet))
+	for _, name := range options.columnsToGet {
+		wanted[name] = true
+	}
+	names := make([]string, 0, len(r.columns))
+	for name := range r.columns {
+		if len(wanted) > 0 && !wanted[name] {
+			continue
+		}
+		if options.startColumn != nil && name < *options.startColumn {
+			continue
+		}
+		if options.endColumn != nil && name >= *options.endColumn {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pagination := paginationOf(options.filter)
+	skipped, returned := 0, 0
+	var columns []*tablestore.AttributeColumn
+	for _, name := range names {
+		var selected []version
+		for _, v := range t.visibleVersions(r, name, now) {
+			if options.maxVersion > 0 && len(selected) >= options.maxVersion {
+				break
+			}
+			if options.inTimeRange(v.timestamp) {
+				selected = append(selected, v)
+			}
+		}
+		if len(selected) == 0 {
+			continue
+		}
+		if pagination != nil {
+			if skipped < int(pagination.Offset) {
+				skipped++
+				continue
+			}
+			if returned >= int(pagination.Limit) {
+				break
+			}
+			returned++
+		}
+		for _, v := range selected {
+			columns = append(columns, &tablestore.AttributeColumn{ColumnName: name, Value: copyValue(v.value), Timestamp: v.timestamp})
+		}
+	}
+	return columns
+}
+
+// selectsPrimaryKey reports whether a row is returned even without attribute
+// columns, i.e. no columns are specified or some primary key is requested.
+func (t *table) selectsPrimaryKey(columnsToGet []string) bool {
+	if len(columnsToGet) == 0 {
+		return true
+	}
+	for _, name := range columnsToGet {
+		for _, schema := range t.meta.SchemaEntry {
+			if *schema.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
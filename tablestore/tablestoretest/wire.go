@@ -0,0 +1,499 @@
+package tablestoretest
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
+	"github.com/golang/protobuf/proto"
+)
+
+// conversions between the protobuf messages of the wire and the requests and
+// responses of the store
+
+func tableMetaFromPb(pbMeta *otsprotocol.TableMeta) *tablestore.TableMeta {
+	meta := &tablestore.TableMeta{TableName: pbMeta.GetTableName()}
+	for _, key := range pbMeta.PrimaryKey {
+		keyType := tablestore.ConvertPbPrimaryKeyType(key.GetType())
+		schema := &tablestore.PrimaryKeySchema{Name: proto.String(key.GetName()), Type: &keyType}
+		if key.Option != nil {
+			keyOption := tablestore.PrimaryKeyOption(key.GetOption())
+			schema.Option = &keyOption
+		}
+		meta.SchemaEntry = append(meta.SchemaEntry, schema)
+	}
+	for _, column := range pbMeta.DefinedColumn {
+		meta.AddDefinedColumn(column.GetName(), tablestore.ConvertPbDefinedColumnType(column.GetType()))
+	}
+	return meta
+}
+
+func tableMetaToPb(meta *tablestore.TableMeta) *otsprotocol.TableMeta {
+	pbMeta := &otsprotocol.TableMeta{TableName: proto.String(meta.TableName)}
+	for _, key := range meta.SchemaEntry {
+		schema := &otsprotocol.PrimaryKeySchema{Name: key.Name, Type: key.Type.ConvertToPbPrimaryKeyType().Enum()}
+		if key.Option != nil {
+			schema.Option = otsprotocol.PrimaryKeyOption(*key.Option).Enum()
+		}
+		pbMeta.PrimaryKey = append(pbMeta.PrimaryKey, schema)
+	}
+	for _, column := range meta.DefinedColumns {
+		pbMeta.DefinedColumn = append(pbMeta.DefinedColumn, &otsprotocol.DefinedColumnSchema{Name: proto.String(column.Name), Type: column.ColumnType.ConvertToPbDefinedColumnType().Enum()})
+	}
+	return pbMeta
+}
+
+func tableOptionToPb(option *tablestore.TableOption) *otsprotocol.TableOptions {
+	return &otsprotocol.TableOptions{TimeToLive: proto.Int32(int32(option.TimeToAlive)), MaxVersions: proto.Int32(int32(option.MaxVersion))}
+}
+
+func throughputFromPb(throughput *otsprotocol.ReservedThroughput) *tablestore.ReservedThroughput {
+	if throughput == nil {
+		return nil
+	}
+	capacity := throughput.GetCapacityUnit()
+	return &tablestore.ReservedThroughput{Readcap: int(capacity.GetRead()), Writecap: int(capacity.GetWrite())}
+}
+
+func throughputToPb(throughput *tablestore.ReservedThroughput) *otsprotocol.ReservedThroughputDetails {
+	return &otsprotocol.ReservedThroughputDetails{
+		CapacityUnit:     &otsprotocol.CapacityUnit{Read: proto.Int32(int32(throughput.Readcap)), Write: proto.Int32(int32(throughput.Writecap))},
+		LastIncreaseTime: proto.Int64(0),
+	}
+}
+
+func consumedToPb(consumed *tablestore.ConsumedCapacityUnit) *otsprotocol.ConsumedCapacity {
+	capacity := &otsprotocol.CapacityUnit{Read: proto.Int32(0), Write: proto.Int32(0)}
+	if consumed != nil {
+		capacity.Read = proto.Int32(consumed.Read)
+		capacity.Write = proto.Int32(consumed.Write)
+	}
+	return &otsprotocol.ConsumedCapacity{CapacityUnit: capacity}
+}
+
+func streamDetailsToPb() *otsprotocol.StreamDetails {
+	return &otsprotocol.StreamDetails{EnableStream: proto.Bool(false)}
+}
+
+func timeRangeFromPb(timeRange *otsprotocol.TimeRange) *tablestore.TimeRange {
+	if timeRange == nil {
+		return nil
+	}
+	return &tablestore.TimeRange{Start: timeRange.GetStartTime(), End: timeRange.GetEndTime(), Specific: timeRange.GetSpecificTime()}
+}
+
+// filterFromPb decodes a serialized otsprotocol.Filter, as carried by row
+// conditions and read requests.
+func filterFromPb(data []byte) (tablestore.ColumnFilter, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	filter, err := tablestore.DecodeColumnFilter(data)
+	if err != nil {
+		return nil, parameterInvalid("Invalid filter.")
+	}
+	if hasTransferRule(filter) {
+		return nil, errUnsupported
+	}
+	return filter, nil
+}
+
+func hasTransferRule(filter tablestore.ColumnFilter) bool {
+	switch f := filter.(type) {
+	case *tablestore.SingleColumnCondition:
+		return f.TransferRule != nil
+	case *tablestore.CompositeColumnValueFilter:
+		for _, sub := range f.Filters {
+			if hasTransferRule(sub) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func conditionFromPb(pbCondition *otsprotocol.Condition) (*tablestore.RowCondition, error) {
+	if pbCondition == nil {
+		return nil, nil
+	}
+	filter, err := filterFromPb(pbCondition.ColumnCondition)
+	if err != nil {
+		return nil, err
+	}
+	return &tablestore.RowCondition{RowExistenceExpectation: tablestore.RowExistenceExpectation(pbCondition.GetRowExistence()), ColumnCondition: filter}, nil
+}
+
+func decodePrimaryKey(data []byte) (*tablestore.PrimaryKey, error) {
+	pk, err := tablestore.DecodePrimaryKey(data)
+	if err != nil {
+		return nil, parameterInvalid("Invalid primary key.")
+	}
+	return pk, nil
+}
+
+// rowChangeFromPb builds the row change of a write request. operation decides
+// how the plainbuffer row is interpreted.
+func rowChangeFromPb(tableName string, operation otsprotocol.OperationType, data []byte, pbCondition *otsprotocol.Condition, returnContent *otsprotocol.ReturnContent) (tablestore.RowChange, error) {
+	pk, columns, isDelete, err := tablestore.DecodeRowChange(data)
+	if err != nil {
+		return nil, parameterInvalid("Invalid row change.")
+	}
+	condition, err := conditionFromPb(pbCondition)
+	if err != nil {
+		return nil, err
+	}
+
+	switch operation {
+	case otsprotocol.OperationType_PUT:
+		change := &tablestore.PutRowChange{TableName: tableName, PrimaryKey: pk, Condition: condition}
+		for _, column := range columns {
+			if column.HasType || column.IgnoreValue {
+				return nil, parameterInvalid("Only columns with value are allowed in PutRow.")
+			}
+			change.Columns = append(change.Columns, tablestore.AttributeColumn{ColumnName: column.ColumnName, Value: column.Value, Timestamp: column.Timestamp})
+		}
+		if returnContent.GetReturnType() == otsprotocol.ReturnType_RT_PK {
+			change.ReturnType = tablestore.ReturnType_RT_PK
+		}
+		return change, nil
+	case otsprotocol.OperationType_UPDATE:
+		return &tablestore.UpdateRowChange{TableName: tableName, PrimaryKey: pk, Columns: columns, Condition: condition}, nil
+	case otsprotocol.OperationType_DELETE:
+		if !isDelete {
+			return nil, parameterInvalid("Delete marker is required in DeleteRow.")
+		}
+		return &tablestore.DeleteRowChange{TableName: tableName, PrimaryKey: pk, Condition: condition}, nil
+	}
+	return nil, parameterInvalid(fmt.Sprintf("Unknown operation type: %d.", operation))
+}
+
+// encodeRow returns pk and columns in plainbuffer format, or an empty row if
+// pk is empty, i.e. the row does not exist.
+func encodeRow(pk *tablestore.PrimaryKey, columns []*tablestore.AttributeColumn) []byte {
+	if len(pk.PrimaryKeys) == 0 {
+		return []byte{}
+	}
+	return tablestore.EncodeRows([]*tablestore.Row{{PrimaryKey: pk, Columns: columns}})
+}
+
+func (server *Server) createTable(body []byte) (proto.Message, error) {
+	req := new(otsprotocol.CreateTableRequest)
+	if err := unmarshal(body, req); err != nil {
+		return nil, err
+	}
+	if req.TableMeta == nil {
+		return nil, parameterInvalid("Table meta is required.")
+	}
+	request := &tablestore.CreateTableRequest{
+		TableMeta:          tableMetaFromPb(req.TableMeta),
+		ReservedThroughput: throughputFromPb(req.ReservedThroughput),
+	}
+	if req.TableOptions != nil {
+		request.TableOption = &tablestore.TableOption{TimeToAlive: int(req.TableOptions.GetTimeToLive()), MaxVersion: int(req.TableOptions.GetMaxVersions())}
+	}
+	if req.StreamSpec != nil {
+		request.StreamSpec = &tablestore.StreamSpecification{EnableStream: req.StreamSpec.GetEnableStream(), ExpirationTime: req.StreamSpec.GetExpirationTime()}
+	}
+	if len(req.IndexMetas) > 0 {
+		return nil, errUnsupported
+	}
+	if _, err := server.Store.CreateTable(request); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (server *Server) listTable(body []byte) (proto.Message, error) {
+	response, err := server.Store.ListTable()
+	if err != nil {
+		return nil, err
+	}
+	return &otsprotocol.ListTableResponse{TableNames: response.TableNames}, nil
+}
+
+func (server *Server) deleteTable(body []byte) (proto.Message, error) {
+	req := new(otsprotocol.DeleteTableRequest)
+	if err := unmarshal(body, req); err != nil {
+		return nil, err
+	}
+	if _, err := server.Store.DeleteTable(&tablestore.DeleteTableRequest{TableName: req.GetTableName()}); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (server *Server) describeTable(body []byte) (proto.Message, error) {
+	req := new(otsprotocol.DescribeTableRequest)
+	if err := unmarshal(body, req); err != nil {
+		return nil, err
+	}
+	response, err := server.Store.DescribeTable(&tablestore.DescribeTableRequest{TableName: req.GetTableName()})
+	if err != nil {
+		return nil, err
+	}
+	return &otsprotocol.DescribeTableResponse{
+		TableMeta:                 tableMetaToPb(response.TableMeta),
+		ReservedThroughputDetails: throughputToPb(response.ReservedThroughput),
+		TableOptions:              tableOptionToPb(response.TableOption),
+		TableStatus:               otsprotocol.TableStatus_ACTIVE.Enum(),
+		StreamDetails:             streamDetailsToPb(),
+	}, nil
+}
+
+func (server *Server) updateTable(body []byte) (proto.Message, error) {
+	req := new(otsprotocol.UpdateTableRequest)
+	if err := unmarshal(body, req); err != nil {
+		return nil, err
+	}
+	request := &tablestore.UpdateTableRequest{TableName: req.GetTableName(), ReservedThroughput: throughputFromPb(req.ReservedThroughput)}
+	if req.TableOptions != nil {
+		request.TableOption = &tablestore.TableOption{TimeToAlive: int(req.TableOptions.GetTimeToLive()), MaxVersion: int(req.TableOptions.GetMaxVersions())}
+	}
+	if req.StreamSpec != nil {
+		request.StreamSpec = &tablestore.StreamSpecification{EnableStream: req.StreamSpec.GetEnableStream(), ExpirationTime: req.StreamSpec.GetExpirationTime()}
+	}
+	response, err := server.Store.UpdateTable(request)
+	if err != nil {
+		return nil, err
+	}
+	return &otsprotocol.UpdateTableResponse{
+		ReservedThroughputDetails: throughputToPb(response.ReservedThroughput),
+		TableOptions:              tableOptionToPb(response.TableOption),
+		StreamDetails:             streamDetailsToPb(),
+	}, nil
+}
+
+func (server *Server) putRow(body []byte) (proto.Message, error) {
+	req := new(otsprotocol.PutRowRequest)
+	if err := unmarshal(body, req); err != nil {
+		return nil, err
+	}
+	change, err := rowChangeFromPb(req.GetTableName(), otsprotocol.OperationType_PUT, req.Row, req.Condition, req.ReturnContent)
+	if err != nil {
+		return nil, err
+	}
+	response, err := server.Store.PutRow(&tablestore.PutRowRequest{PutRowChange: change.(*tablestore.PutRowChange)})
+	if err != nil {
+		return nil, err
+	}
+	resp := &otsprotocol.PutRowResponse{Consumed: consumedToPb(response.ConsumedCapacityUnit)}
+	if len(response.PrimaryKey.PrimaryKeys) > 0 {
+		resp.Row = encodeRow(&response.PrimaryKey, nil)
+	}
+	return resp, nil
+}
+
+func (server *Server) updateRow(body []byte) (proto.Message, error) {
+	req := new(otsprotocol.UpdateRowRequest)
+	if err := unmarshal(body, req); err != nil {
+		return nil, err
+	}
+	change, err := rowChangeFromPb(req.GetTableName(), otsprotocol.OperationType_UPDATE, req.RowChange, req.Condition, req.ReturnContent)
+	if err != nil {
+		return nil, err
+	}
+	response, err := server.Store.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: change.(*tablestore.UpdateRowChange)})
+	if err != nil {
+		return nil, err
+	}
+	return &otsprotocol.UpdateRowResponse{Consumed: consumedToPb(response.ConsumedCapacityUnit)}, nil
+}
+
+func (server *Server) deleteRow(body []byte) (proto.Message, error) {
+	req := new(otsprotocol.DeleteRowRequest)
+	if err := unmarshal(body, req); err != nil {
+		return nil, err
+	}
+	change, err := rowChangeFromPb(req.GetTableName(), otsprotocol.OperationType_DELETE, req.PrimaryKey, req.Condition, req.ReturnContent)
+	if err != nil {
+		return nil, err
+	}
+	response, err := server.Store.DeleteRow(&tablestore.DeleteRowRequest{DeleteRowChange: change.(*tablestore.DeleteRowChange)})
+	if err != nil {
+		return nil, err
+	}
+	return &otsprotocol.DeleteRowResponse{Consumed: consumedToPb(response.ConsumedCapacityUnit)}, nil
+}
+
+func (server *Server) getRow(body []byte) (proto.Message, error) {
+	req := new(otsprotocol.GetRowRequest)
+	if err := unmarshal(body, req); err != nil {
+		return nil, err
+	}
+	pk, err := decodePrimaryKey(req.PrimaryKey)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := filterFromPb(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	criteria := &tablestore.SingleRowQueryCriteria{
+		TableName:    req.GetTableName(),
+		PrimaryKey:   pk,
+		ColumnsToGet: req.ColumnsToGet,
+		MaxVersion:   req.GetMaxVersions(),
+		TimeRange:    timeRangeFromPb(req.TimeRange),
+		Filter:       filter,
+		StartColumn:  req.StartColumn,
+		EndColumn:    req.EndColumn,
+	}
+	response, err := server.Store.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil {
+		return nil, err
+	}
+	return &otsprotocol.GetRowResponse{Consumed: consumedToPb(response.ConsumedCapacityUnit), Row: encodeRow(&response.PrimaryKey, response.Columns)}, nil
+}
+
+func rowErrorToPb(e tablestore.Error) *otsprotocol.Error {
+	return &otsprotocol.Error{Code: proto.String(e.Code), Message: proto.String(e.Message)}
+}
+
+func (server *Server) batchGetRow(body []byte) (proto.Message, error) {
+	req := new(otsprotocol.BatchGetRowRequest)
+	if err := unmarshal(body, req); err != nil {
+		return nil, err
+	}
+	request := &tablestore.BatchGetRowRequest{}
+	for _, table := range req.Tables {
+		filter, err := filterFromPb(table.Filter)
+		if err != nil {
+			return nil, err
+		}
+		criteria := &tablestore.MultiRowQueryCriteria{
+			TableName:    table.GetTableName(),
+			ColumnsToGet: table.ColumnsToGet,
+			MaxVersion:   int(table.GetMaxVersions()),
+			TimeRange:    timeRangeFromPb(table.TimeRange),
+			Filter:       filter,
+			StartColumn:  table.StartColumn,
+			EndColumn:    table.EndColumn,
+		}
+		for _, data := range table.PrimaryKey {
+			pk, err := decodePrimaryKey(data)
+			if err != nil {
+				return nil, err
+			}
+			criteria.AddRow(pk)
+		}
+		request.MultiRowQueryCriteria = append(request.MultiRowQueryCriteria, criteria)
+	}
+	response, err := server.Store.BatchGetRow(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// results of a table are returned in the order of the request, even if
+	// the table appears more than once
+	resp := new(otsprotocol.BatchGetRowResponse)
+	offsets := make(map[string]int)
+	for _, table := range req.Tables {
+		name := table.GetTableName()
+		results := response.TableToRowsResult[name][offsets[name]:][:len(table.PrimaryKey)]
+		offsets[name] += len(table.PrimaryKey)
+
+		pbTable := &otsprotocol.TableInBatchGetRowResponse{TableName: proto.String(name)}
+		for i := range results {
+			result := &results[i]
+			row := &otsprotocol.RowInBatchGetRowResponse{IsOk: proto.Bool(result.IsSucceed)}
+			if result.IsSucceed {
+				row.Consumed = consumedToPb(result.ConsumedCapacityUnit)
+				row.Row = encodeRow(&result.PrimaryKey, result.Columns)
+			} else {
+				row.Error = rowErrorToPb(result.Error)
+			}
+			pbTable.Rows = append(pbTable.Rows, row)
+		}
+		resp.Tables = append(resp.Tables, pbTable)
+	}
+	return resp, nil
+}
+
+func (server *Server) batchWriteRow(body []byte) (proto.Message, error) {
+	req := new(otsprotocol.BatchWriteRowRequest)
+	if err := unmarshal(body, req); err != nil {
+		return nil, err
+	}
+	request := &tablestore.BatchWriteRowRequest{}
+	for _, table := range req.Tables {
+		for _, row := range table.Rows {
+			change, err := rowChangeFromPb(table.GetTableName(), row.GetType(), row.RowChange, row.Condition, row.ReturnContent)
+			if err != nil {
+				return nil, err
+			}
+			request.AddRowChange(change)
+		}
+	}
+	response, err := server.Store.BatchWriteRow(request)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := new(otsprotocol.BatchWriteRowResponse)
+	offsets := make(map[string]int)
+	for _, table := range req.Tables {
+		name := table.GetTableName()
+		results := response.TableToRowsResult[name][offsets[name]:][:len(table.Rows)]
+		offsets[name] += len(table.Rows)
+
+		pbTable := &otsprotocol.TableInBatchWriteRowResponse{TableName: proto.String(name)}
+		for i := range results {
+			result := &results[i]
+			row := &otsprotocol.RowInBatchWriteRowResponse{IsOk: proto.Bool(result.IsSucceed)}
+			if result.IsSucceed {
+				row.Consumed = consumedToPb(result.ConsumedCapacityUnit)
+				if len(result.PrimaryKey.PrimaryKeys) > 0 {
+					row.Row = encodeRow(&result.PrimaryKey, nil)
+				}
+			} else {
+				row.Error = rowErrorToPb(result.Error)
+			}
+			pbTable.Rows = append(pbTable.Rows, row)
+		}
+		resp.Tables = append(resp.Tables, pbTable)
+	}
+	return resp, nil
+}
+
+func (server *Server) getRange(body []byte) (proto.Message, error) {
+	req := new(otsprotocol.GetRangeRequest)
+	if err := unmarshal(body, req); err != nil {
+		return nil, err
+	}
+	start, err := decodePrimaryKey(req.InclusiveStartPrimaryKey)
+	if err != nil {
+		return nil, err
+	}
+	end, err := decodePrimaryKey(req.ExclusiveEndPrimaryKey)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := filterFromPb(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	criteria := &tablestore.RangeRowQueryCriteria{
+		TableName:       req.GetTableName(),
+		StartPrimaryKey: start,
+		EndPrimaryKey:   end,
+		ColumnsToGet:    req.ColumnsToGet,
+		MaxVersion:      req.GetMaxVersions(),
+		TimeRange:       timeRangeFromPb(req.TimeRange),
+		Filter:          filter,
+		Direction:       tablestore.Direction(req.GetDirection()),
+		Limit:           req.GetLimit(),
+		StartColumn:     req.StartColumn,
+		EndColumn:       req.EndColumn,
+	}
+	response, err := server.Store.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: criteria})
+	if err != nil {
+		return nil, err
+	}
+	resp := &otsprotocol.GetRangeResponse{Consumed: consumedToPb(response.ConsumedCapacityUnit), Rows: tablestore.EncodeRows(response.Rows)}
+	if resp.Rows == nil {
+		resp.Rows = []byte{}
+	}
+	if response.NextStartPrimaryKey != nil {
+		resp.NextStartPrimaryKey = encodeRow(response.NextStartPrimaryKey, nil)
+	}
+	return resp, nil
+}
@@ -0,0 +1,130 @@
+// Package tags attaches metadata to tables, which DescribeTable has none of,
+// such as their owner, retention policy or schema version, as string tags
+// kept in a table of tags, one row per table:
+//
+//	store := tags.New(client, "table_tags")
+//	err := store.Set("orders", map[string]string{tags.Owner: "payments", tags.SchemaVersion: "3"})
+//	orders, err := store.Get("orders")
+package tags
+
+import (
+	"errors"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+)
+
+// TableColumn is the string primary key column of the rows of the table of
+// tags, the names of the tables tagged; the other columns are the tags.
+const TableColumn = "table"
+
+// tags of the convention shared by the tools of the tables
+const (
+	Owner         = "owner"
+	Retention     = "retention"
+	SchemaVersion = "schema_version"
+	Description   = "description"
+)
+
+// Store reads and writes the tags of the tables in a table of tags.
+type Store struct {
+	client tablestore.TableStoreApi
+	table  string
+}
+
+func New(client tablestore.TableStoreApi, table string) *Store {
+	return &Store{client: client, table: table}
+}
+
+// CreateTable creates a table of tags.
+func CreateTable(client tablestore.TableStoreApi, table string) error {
+	meta := &tablestore.TableMeta{TableName: table}
+	meta.AddPrimaryKeyColumn(TableColumn, tablestore.PrimaryKeyType_STRING)
+	_, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}})
+	return err
+}
+
+func (store *Store) primaryKey(table string) *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn(TableColumn, table)
+	return pk
+}
+
+// Set sets the tags of table, keeping its other tags.
+func (store *Store) Set(table string, tags map[string]string) error {
+	if table == "" {
+		return errors.New("[tablestore] missing table name")
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	change := &tablestore.UpdateRowChange{TableName: store.table, PrimaryKey: store.primaryKey(table)}
+	for name, value := range tags {
+		change.PutColumn(name, value)
+	}
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	if err := change.Err(); err != nil {
+		return err
+	}
+	_, err := store.client.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: change})
+	return err
+}
+
+// Delete removes the tags names of table, all of them if there are none.
+func (store *Store) Delete(table string, names ...string) error {
+	if len(names) == 0 {
+		change := &tablestore.DeleteRowChange{TableName: store.table, PrimaryKey: store.primaryKey(table)}
+		change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		_, err := store.client.DeleteRow(&tablestore.DeleteRowRequest{DeleteRowChange: change})
+		return err
+	}
+	change := &tablestore.UpdateRowChange{TableName: store.table, PrimaryKey: store.primaryKey(table)}
+	for _, name := range names {
+		change.DeleteColumn(name)
+	}
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	_, err := store.client.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: change})
+	return err
+}
+
+// Get returns the tags of table, empty if it has none.
+func (store *Store) Get(table string) (map[string]string, error) {
+	criteria := &tablestore.SingleRowQueryCriteria{TableName: store.table, PrimaryKey: store.primaryKey(table), MaxVersion: 1}
+	resp, err := store.client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil {
+		return nil, err
+	}
+	return tagsOf(resp.Columns), nil
+}
+
+// List returns the tags of all the tables tagged.
+func (store *Store) List() (map[string]map[string]string, error) {
+	criteria := &tablestore.RangeRowQueryCriteria{TableName: store.table, StartPrimaryKey: new(tablestore.PrimaryKey), EndPrimaryKey: new(tablestore.PrimaryKey), Direction: tablestore.FORWARD, MaxVersion: 1}
+	criteria.StartPrimaryKey.AddPrimaryKeyColumnWithMinValue(TableColumn)
+	criteria.EndPrimaryKey.AddPrimaryKeyColumnWithMaxValue(TableColumn)
+	tables := make(map[string]map[string]string)
+	for {
+		resp, err := store.client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: criteria})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range resp.Rows {
+			if table, ok := row.PrimaryKey.PrimaryKeys[0].Value.(string); ok {
+				tables[table] = tagsOf(row.Columns)
+			}
+		}
+		if resp.NextStartPrimaryKey == nil {
+			return tables, nil
+		}
+		criteria.StartPrimaryKey = resp.NextStartPrimaryKey
+	}
+}
+
+// tagsOf returns the string columns of a row.
+func tagsOf(columns []*tablestore.AttributeColumn) map[string]string {
+	tags := make(map[string]string, len(columns))
+	for _, column := range columns {
+		if value, ok := column.Value.(string); ok {
+			tags[column.ColumnName] = value
+		}
+	}
+	return tags
+}
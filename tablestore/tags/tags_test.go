@@ -0,0 +1,52 @@
+package tags
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"reflect"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	client := server.NewTableStoreClient()
+	if err := CreateTable(client, "table_tags"); err != nil {
+		t.Fatal(err)
+	}
+	store := New(client, "table_tags")
+
+	if tags, err := store.Get("orders"); err != nil || len(tags) != 0 {
+		t.Errorf("tags %v, %v", tags, err)
+	}
+	if err := store.Set("orders", map[string]string{Owner: "payments", SchemaVersion: "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("orders", map[string]string{SchemaVersion: "3", Retention: "90d"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("users", map[string]string{Owner: "accounts"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("", map[string]string{Owner: "accounts"}); err == nil {
+		t.Errorf("expect missing table name")
+	}
+	if err := store.Set("users", map[string]string{"invalid name": "x"}); err == nil {
+		t.Errorf("expect invalid tag name")
+	}
+
+	orders := map[string]string{Owner: "payments", SchemaVersion: "3", Retention: "90d"}
+	if tags, err := store.Get("orders"); err != nil || !reflect.DeepEqual(tags, orders) {
+		t.Errorf("tags %v, %v", tags, err)
+	}
+
+	if err := store.Delete("orders", Retention); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("users"); err != nil {
+		t.Fatal(err)
+	}
+	delete(orders, Retention)
+	if tables, err := store.List(); err != nil || !reflect.DeepEqual(tables, map[string]map[string]string{"orders": orders}) {
+		t.Errorf("tables %v, %v", tables, err)
+	}
+}
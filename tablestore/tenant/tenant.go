@@ -0,0 +1,385 @@
+// Package tenant isolates the rows of the tenants of shared tables, in front
+// of a tablestore.TableStoreApi, by prefixing the partition keys, strings, of
+// the rows written and read with the id of the tenant:
+//
+//	acme, err := tenant.New(client, "acme", "orders", "users")
+//	// writes the row "acme:u1" of users
+//	acme.PutRow(&tablestore.PutRowRequest{PutRowChange: change})
+//
+// Rows are read with the partition keys written, the prefix stripped, and
+// ranges read by GetRange are bounded to the rows of the tenant, INF_MIN and
+// INF_MAX partition keys included. GetStreamRecord returns the records of the
+// rows of the tenant only, from the shard iterators returned by the client of
+// the tenant. Search and ComputeSplitPointsBySize, which would see the rows of
+// all tenants, and the methods creating, changing or deleting shared tables
+// and their indexes fail on shared tables. Other methods are passed through.
+package tenant
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/golang/protobuf/proto"
+	"strings"
+)
+
+// Separator ends the tenant prefix of partition keys.
+const Separator = ':'
+
+var (
+	// ErrCrossTenant is returned by the methods reading the rows of all
+	// tenants, or changing shared tables.
+	ErrCrossTenant = errors.New("[tablestore] operation across tenants")
+	// ErrForeignIterator is returned by GetStreamRecord for the shard
+	// iterators which were not returned by the client of the tenant.
+	ErrForeignIterator = errors.New("[tablestore] shard iterator of another client")
+)
+
+// Client is a tablestore.TableStoreApi of a tenant. It is safe for concurrent
+// use if the wrapped client is.
+type Client struct {
+	tablestore.TableStoreApi
+	tenant string
+	prefix string
+	// shared tables, all of them if nil
+	tables map[string]bool
+}
+
+var _ tablestore.TableStoreApi = (*Client)(nil)
+
+// New returns the client of the tenant of the shared tables, all the tables
+// if there are none. Tenant ids must not contain Separator.
+func New(client tablestore.TableStoreApi, tenant string, tables ...string) (*Client, error) {
+	if tenant == "" || strings.IndexByte(tenant, Separator) >= 0 {
+		return nil, fmt.Errorf("[tablestore] invalid tenant %q", tenant)
+	}
+	c := &Client{TableStoreApi: client, tenant: tenant, prefix: tenant + string(Separator)}
+	if len(tables) > 0 {
+		c.tables = make(map[string]bool, len(tables))
+		for _, table := range tables {
+			c.tables[table] = true
+		}
+	}
+	return c, nil
+}
+
+// Tenant returns the id of the tenant.
+func (c *Client) Tenant() string {
+	return c.tenant
+}
+
+func (c *Client) shared(table string) bool {
+	return c.tables == nil || c.tables[table]
+}
+
+// prefixKey returns a copy of pk whose partition key is prefixed; INF_MIN and
+// INF_MAX are the bounds of the keys of the tenant.
+func (c *Client) prefixKey(table string, pk *tablestore.PrimaryKey) (*tablestore.PrimaryKey, error) {
+	if !c.shared(table) || pk == nil {
+		return pk, nil
+	}
+	if len(pk.PrimaryKeys) == 0 {
+		return nil, fmt.Errorf("[tablestore] empty primary key")
+	}
+	first := pk.PrimaryKeys[0]
+	var value string
+	switch first.PrimaryKeyOption {
+	case tablestore.MIN:
+		value = c.prefix
+	case tablestore.MAX:
+		// above any key of the tenant
+		value = c.tenant + string(Separator+1)
+	default:
+		key, ok := first.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("[tablestore] partition key %s is not a string", first.ColumnName)
+		}
+		value = c.prefix + key
+	}
+	prefixed := &tablestore.PrimaryKey{PrimaryKeys: append([]*tablestore.PrimaryKeyColumn(nil), pk.PrimaryKeys...)}
+	prefixed.PrimaryKeys[0] = &tablestore.PrimaryKeyColumn{ColumnName: first.ColumnName, Value: value}
+	return prefixed, nil
+}
+
+// stripKey strips the prefix of the partition key of pk, read from table, in
+// place.
+func (c *Client) stripKey(table string, pk *tablestore.PrimaryKey) error {
+	if !c.shared(table) || pk == nil || len(pk.PrimaryKeys) == 0 {
+		return nil
+	}
+	first := pk.PrimaryKeys[0]
+	key, ok := first.Value.(string)
+	if !ok || !strings.HasPrefix(key, c.prefix) {
+		return fmt.Errorf("[tablestore] row %v of %s is not a row of tenant %s", first.Value, table, c.tenant)
+	}
+	pk.PrimaryKeys[0] = &tablestore.PrimaryKeyColumn{ColumnName: first.ColumnName, Value: key[len(c.prefix):], PrimaryKeyOption: first.PrimaryKeyOption}
+	return nil
+}
+
+func (c *Client) prefixChange(change tablestore.RowChange) (tablestore.RowChange, error) {
+	table := change.GetTableName()
+	var err error
+	switch change := change.(type) {
+	case *tablestore.PutRowChange:
+		copied := *change
+		copied.PrimaryKey, err = c.prefixKey(table, change.PrimaryKey)
+		return &copied, err
+	case *tablestore.UpdateRowChange:
+		copied := *change
+		copied.PrimaryKey, err = c.prefixKey(table, change.PrimaryKey)
+		return &copied, err
+	case *tablestore.DeleteRowChange:
+		copied := *change
+		copied.PrimaryKey, err = c.prefixKey(table, change.PrimaryKey)
+		return &copied, err
+	}
+	if c.shared(table) {
+		return nil, fmt.Errorf("[tablestore] unsupported row change %T", change)
+	}
+	return change, nil
+}
+
+func (c *Client) PutRow(request *tablestore.PutRowRequest) (*tablestore.PutRowResponse, error) {
+	change, err := c.prefixChange(request.PutRowChange)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.TableStoreApi.PutRow(&tablestore.PutRowRequest{PutRowChange: change.(*tablestore.PutRowChange)})
+	if err != nil {
+		return response, err
+	}
+	return response, c.stripKey(change.GetTableName(), &response.PrimaryKey)
+}
+
+func (c *Client) UpdateRow(request *tablestore.UpdateRowRequest) (*tablestore.UpdateRowResponse, error) {
+	change, err := c.prefixChange(request.UpdateRowChange)
+	if err != nil {
+		return nil, err
+	}
+	return c.TableStoreApi.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: change.(*tablestore.UpdateRowChange)})
+}
+
+func (c *Client) DeleteRow(request *tablestore.DeleteRowRequest) (*tablestore.DeleteRowResponse, error) {
+	change, err := c.prefixChange(request.DeleteRowChange)
+	if err != nil {
+		return nil, err
+	}
+	return c.TableStoreApi.DeleteRow(&tablestore.DeleteRowRequest{DeleteRowChange: change.(*tablestore.DeleteRowChange)})
+}
+
+func (c *Client) BatchWriteRow(request *tablestore.BatchWriteRowRequest) (*tablestore.BatchWriteRowResponse, error) {
+	prefixed := &tablestore.BatchWriteRowRequest{RowChangesGroupByTable: make(map[string][]tablestore.RowChange), IsAtomic: request.IsAtomic}
+	for table, changes := range request.RowChangesGroupByTable {
+		for _, change := range changes {
+			change, err := c.prefixChange(change)
+			if err != nil {
+				return nil, err
+			}
+			prefixed.RowChangesGroupByTable[table] = append(prefixed.RowChangesGroupByTable[table], change)
+		}
+	}
+	response, err := c.TableStoreApi.BatchWriteRow(prefixed)
+	if err != nil {
+		return response, err
+	}
+	for table, results := range response.TableToRowsResult {
+		for i := range results {
+			if err := c.stripKey(table, &results[i].PrimaryKey); err != nil {
+				return response, err
+			}
+		}
+	}
+	return response, nil
+}
+
+func (c *Client) GetRow(request *tablestore.GetRowRequest) (*tablestore.GetRowResponse, error) {
+	criteria := *request.SingleRowQueryCriteria
+	var err error
+	if criteria.PrimaryKey, err = c.prefixKey(criteria.TableName, criteria.PrimaryKey); err != nil {
+		return nil, err
+	}
+	response, err := c.TableStoreApi.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: &criteria})
+	if err != nil {
+		return response, err
+	}
+	return response, c.stripKey(criteria.TableName, &response.PrimaryKey)
+}
+
+func (c *Client) BatchGetRow(request *tablestore.BatchGetRowRequest) (*tablestore.BatchGetRowResponse, error) {
+	batch := &tablestore.BatchGetRowRequest{}
+	for _, criteria := range request.MultiRowQueryCriteria {
+		copied := *criteria
+		copied.PrimaryKey = make([]*tablestore.PrimaryKey, len(criteria.PrimaryKey))
+		for i, pk := range criteria.PrimaryKey {
+			var err error
+			if copied.PrimaryKey[i], err = c.prefixKey(criteria.TableName, pk); err != nil {
+				return nil, err
+			}
+		}
+		batch.MultiRowQueryCriteria = append(batch.MultiRowQueryCriteria, &copied)
+	}
+	response, err := c.TableStoreApi.BatchGetRow(batch)
+	if err != nil {
+		return response, err
+	}
+	for table, results := range response.TableToRowsResult {
+		for i := range results {
+			if err := c.stripKey(table, &results[i].PrimaryKey); err != nil {
+				return response, err
+			}
+		}
+	}
+	return response, nil
+}
+
+func (c *Client) GetRange(request *tablestore.GetRangeRequest) (*tablestore.GetRangeResponse, error) {
+	criteria := *request.RangeRowQueryCriteria
+	var err error
+	if criteria.StartPrimaryKey, err = c.prefixKey(criteria.TableName, criteria.StartPrimaryKey); err != nil {
+		return nil, err
+	}
+	if criteria.EndPrimaryKey, err = c.prefixKey(criteria.TableName, criteria.EndPrimaryKey); err != nil {
+		return nil, err
+	}
+	response, err := c.TableStoreApi.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: &criteria})
+	if err != nil {
+		return response, err
+	}
+	for _, row := range response.Rows {
+		if err := c.stripKey(criteria.TableName, row.PrimaryKey); err != nil {
+			return response, err
+		}
+	}
+	return response, c.stripKey(criteria.TableName, response.NextStartPrimaryKey)
+}
+
+func (c *Client) ComputeSplitPointsBySize(request *tablestore.ComputeSplitPointsBySizeRequest) (*tablestore.ComputeSplitPointsBySizeResponse, error) {
+	if c.shared(request.TableName) {
+		return nil, ErrCrossTenant
+	}
+	return c.TableStoreApi.ComputeSplitPointsBySize(request)
+}
+
+func (c *Client) Search(request *tablestore.SearchRequest) (*tablestore.SearchResponse, error) {
+	if c.shared(request.TableName) {
+		return nil, ErrCrossTenant
+	}
+	return c.TableStoreApi.Search(request)
+}
+
+func (c *Client) CreateTable(request *tablestore.CreateTableRequest) (*tablestore.CreateTableResponse, error) {
+	if request.TableMeta != nil && c.shared(request.TableMeta.TableName) {
+		return nil, ErrCrossTenant
+	}
+	return c.TableStoreApi.CreateTable(request)
+}
+
+func (c *Client) DeleteTable(request *tablestore.DeleteTableRequest) (*tablestore.DeleteTableResponse, error) {
+	if c.shared(request.TableName) {
+		return nil, ErrCrossTenant
+	}
+	return c.TableStoreApi.DeleteTable(request)
+}
+
+func (c *Client) UpdateTable(request *tablestore.UpdateTableRequest) (*tablestore.UpdateTableResponse, error) {
+	if c.shared(request.TableName) {
+		return nil, ErrCrossTenant
+	}
+	return c.TableStoreApi.UpdateTable(request)
+}
+
+func (c *Client) CreateIndex(request *tablestore.CreateIndexRequest) (*tablestore.CreateIndexResponse, error) {
+	if c.shared(request.MainTableName) {
+		return nil, ErrCrossTenant
+	}
+	return c.TableStoreApi.CreateIndex(request)
+}
+
+func (c *Client) DeleteIndex(request *tablestore.DeleteIndexRequest) (*tablestore.DeleteIndexResponse, error) {
+	if c.shared(request.MainTableName) {
+		return nil, ErrCrossTenant
+	}
+	return c.TableStoreApi.DeleteIndex(request)
+}
+
+func (c *Client) CreateSearchIndex(request *tablestore.CreateSearchIndexRequest) (*tablestore.CreateSearchIndexResponse, error) {
+	if c.shared(request.TableName) {
+		return nil, ErrCrossTenant
+	}
+	return c.TableStoreApi.CreateSearchIndex(request)
+}
+
+func (c *Client) DeleteSearchIndex(request *tablestore.DeleteSearchIndexRequest) (*tablestore.DeleteSearchIndexResponse, error) {
+	if c.shared(request.TableName) {
+		return nil, ErrCrossTenant
+	}
+	return c.TableStoreApi.DeleteSearchIndex(request)
+}
+
+// wrapIterator returns the shard iterator of the stream of table, as
+// returned to the tenant: the table, the separator of the tenants and the
+// iterator.
+func wrapIterator(table string, iterator *tablestore.ShardIterator) *tablestore.ShardIterator {
+	if iterator == nil {
+		return nil
+	}
+	wrapped := tablestore.ShardIterator(table + string(Separator) + string(*iterator))
+	return &wrapped
+}
+
+// unwrapIterator returns the table and the shard iterator of an iterator
+// returned by wrapIterator.
+func unwrapIterator(iterator *tablestore.ShardIterator) (string, *tablestore.ShardIterator, error) {
+	if iterator == nil {
+		return "", nil, ErrForeignIterator
+	}
+	i := strings.IndexByte(string(*iterator), Separator)
+	if i < 0 {
+		return "", nil, ErrForeignIterator
+	}
+	unwrapped := tablestore.ShardIterator(string(*iterator)[i+1:])
+	return string(*iterator)[:i], &unwrapped, nil
+}
+
+// GetShardIterator returns the shard iterator of a shard, along with the
+// table of its stream, for GetStreamRecord.
+func (c *Client) GetShardIterator(request *tablestore.GetShardIteratorRequest) (*tablestore.GetShardIteratorResponse, error) {
+	stream, err := c.TableStoreApi.DescribeStream(&tablestore.DescribeStreamRequest{StreamId: request.StreamId, ShardLimit: proto.Int32(1)})
+	if err != nil {
+		return nil, err
+	}
+	if stream.TableName == nil {
+		return nil, fmt.Errorf("[tablestore] stream %s without table", *request.StreamId)
+	}
+	response, err := c.TableStoreApi.GetShardIterator(request)
+	if err != nil {
+		return response, err
+	}
+	response.ShardIterator = wrapIterator(*stream.TableName, response.ShardIterator)
+	return response, nil
+}
+
+// GetStreamRecord returns the records of the rows of the tenant, their
+// partition keys stripped of the prefix, and skips the others.
+func (c *Client) GetStreamRecord(request *tablestore.GetStreamRecordRequest) (*tablestore.GetStreamRecordResponse, error) {
+	table, iterator, err := unwrapIterator(request.ShardIterator)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.TableStoreApi.GetStreamRecord(&tablestore.GetStreamRecordRequest{ShardIterator: iterator, Limit: request.Limit})
+	if err != nil {
+		return response, err
+	}
+	response.NextShardIterator = wrapIterator(table, response.NextShardIterator)
+	records := response.Records[:0]
+	for _, record := range response.Records {
+		if record.PrimaryKey == nil && c.shared(table) {
+			continue
+		}
+		if c.stripKey(table, record.PrimaryKey) == nil {
+			records = append(records, record)
+		}
+	}
+	response.Records = records
+	return response, nil
+}
@@ -0,0 +1,252 @@
+package tenant
+
+import (
+	"errors"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func createTable(t *testing.T, client tablestore.TableStoreApi, name string) {
+	meta := &tablestore.TableMeta{TableName: name}
+	meta.AddPrimaryKeyColumn("user", tablestore.PrimaryKeyType_STRING)
+	meta.AddPrimaryKeyColumn("id", tablestore.PrimaryKeyType_INTEGER)
+	if _, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func primaryKey(user string, id int64) *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn("user", user)
+	pk.AddPrimaryKeyColumn("id", id)
+	return pk
+}
+
+func put(t *testing.T, client tablestore.TableStoreApi, table, user string, id int64) {
+	change := &tablestore.PutRowChange{TableName: table, PrimaryKey: primaryKey(user, id)}
+	change.AddColumn("value", id)
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: change}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func scan(t *testing.T, client tablestore.TableStoreApi, table string) []string {
+	criteria := &tablestore.RangeRowQueryCriteria{TableName: table, StartPrimaryKey: new(tablestore.PrimaryKey), EndPrimaryKey: new(tablestore.PrimaryKey), Direction: tablestore.FORWARD, MaxVersion: 1}
+	criteria.StartPrimaryKey.AddPrimaryKeyColumnWithMinValue("user")
+	criteria.StartPrimaryKey.AddPrimaryKeyColumnWithMinValue("id")
+	criteria.EndPrimaryKey.AddPrimaryKeyColumnWithMaxValue("user")
+	criteria.EndPrimaryKey.AddPrimaryKeyColumnWithMaxValue("id")
+	var users []string
+	for {
+		resp, err := client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: criteria})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range resp.Rows {
+			users = append(users, row.PrimaryKey.PrimaryKeys[0].Value.(string))
+		}
+		if resp.NextStartPrimaryKey == nil {
+			return users
+		}
+		criteria.StartPrimaryKey = resp.NextStartPrimaryKey
+	}
+}
+
+func TestTenant(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	client := server.NewTableStoreClient()
+	createTable(t, client, "orders")
+	createTable(t, client, "global")
+
+	if _, err := New(client, "a:b"); err == nil {
+		t.Errorf("expect invalid tenant")
+	}
+	acme, err := New(client, "acme", "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// "acme" sorts between "ac" and "acme2", whose rows must not be read
+	ac, _ := New(client, "ac", "orders")
+	acme2, _ := New(client, "acme2", "orders")
+	put(t, ac, "orders", "u0", 0)
+	put(t, acme, "orders", "u1", 1)
+	put(t, acme, "orders", "u2", 2)
+	put(t, acme2, "orders", "u3", 3)
+	put(t, acme, "global", "u4", 4)
+
+	if users := scan(t, acme, "orders"); !reflect.DeepEqual(users, []string{"u1", "u2"}) {
+		t.Errorf("acme rows %v", users)
+	}
+	if users := scan(t, client, "orders"); !reflect.DeepEqual(users, []string{"ac:u0", "acme2:u3", "acme:u1", "acme:u2"}) {
+		t.Errorf("rows %v", users)
+	}
+	if users := scan(t, acme2, "global"); !reflect.DeepEqual(users, []string{"u4"}) {
+		t.Errorf("global rows %v", users)
+	}
+
+	criteria := &tablestore.SingleRowQueryCriteria{TableName: "orders", PrimaryKey: primaryKey("u1", 1), MaxVersion: 1}
+	resp, err := acme.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil || len(resp.Columns) != 1 || resp.PrimaryKey.PrimaryKeys[0].Value != "u1" {
+		t.Errorf("acme row %v, %v", resp, err)
+	}
+	if criteria.PrimaryKey.PrimaryKeys[0].Value != "u1" {
+		t.Errorf("request changed")
+	}
+	resp, err = acme2.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil || len(resp.Columns) != 0 {
+		t.Errorf("acme2 row %v, %v", resp, err)
+	}
+
+	batch := &tablestore.BatchGetRowRequest{}
+	batch.MultiRowQueryCriteria = append(batch.MultiRowQueryCriteria, &tablestore.MultiRowQueryCriteria{TableName: "orders", PrimaryKey: []*tablestore.PrimaryKey{primaryKey("u1", 1), primaryKey("u3", 3)}, MaxVersion: 1})
+	batchResp, err := acme2.BatchGetRow(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := batchResp.TableToRowsResult["orders"]
+	if len(results) != 2 || results[0].PrimaryKey.PrimaryKeys != nil || results[1].PrimaryKey.PrimaryKeys[0].Value != "u3" {
+		t.Errorf("acme2 batch %v", results)
+	}
+
+	deleteChange := &tablestore.DeleteRowChange{TableName: "orders", PrimaryKey: primaryKey("u2", 2)}
+	deleteChange.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	write := &tablestore.BatchWriteRowRequest{}
+	write.AddRowChange(deleteChange)
+	if _, err := acme.BatchWriteRow(write); err != nil {
+		t.Fatal(err)
+	}
+	if users := scan(t, acme, "orders"); !reflect.DeepEqual(users, []string{"u1"}) {
+		t.Errorf("acme rows %v", users)
+	}
+
+	invalid := &tablestore.PutRowChange{TableName: "orders", PrimaryKey: new(tablestore.PrimaryKey)}
+	invalid.PrimaryKey.AddPrimaryKeyColumn("user", int64(1))
+	if _, err := acme.PutRow(&tablestore.PutRowRequest{PutRowChange: invalid}); err == nil {
+		t.Errorf("expect string partition key")
+	}
+	if _, err := acme.Search(&tablestore.SearchRequest{TableName: "orders"}); err != ErrCrossTenant {
+		t.Errorf("search %v", err)
+	}
+}
+
+// streams serves a stream of the records of the rows of users of table, by
+// iterators "0", "1"... of the index of the next record.
+type streams struct {
+	tablestore.TableStoreApi
+	table string
+	users []string
+}
+
+func (s *streams) DescribeStream(request *tablestore.DescribeStreamRequest) (*tablestore.DescribeStreamResponse, error) {
+	return &tablestore.DescribeStreamResponse{StreamId: request.StreamId, TableName: &s.table}, nil
+}
+
+func (s *streams) GetShardIterator(request *tablestore.GetShardIteratorRequest) (*tablestore.GetShardIteratorResponse, error) {
+	iterator := tablestore.ShardIterator("0")
+	return &tablestore.GetShardIteratorResponse{ShardIterator: &iterator}, nil
+}
+
+func (s *streams) GetStreamRecord(request *tablestore.GetStreamRecordRequest) (*tablestore.GetStreamRecordResponse, error) {
+	i, err := strconv.Atoi(string(*request.ShardIterator))
+	if err != nil {
+		return nil, errors.New("OTSParameterInvalid invalid iterator")
+	}
+	response := new(tablestore.GetStreamRecordResponse)
+	if i < len(s.users) {
+		response.Records = []*tablestore.StreamRecord{{Type: tablestore.AT_Put, PrimaryKey: primaryKey(s.users[i], int64(i))}}
+		next := tablestore.ShardIterator(strconv.Itoa(i + 1))
+		response.NextShardIterator = &next
+	}
+	return response, nil
+}
+
+func streamUsers(t *testing.T, client tablestore.TableStoreApi) []string {
+	streamId := tablestore.StreamId("stream")
+	shardId := tablestore.ShardId("shard")
+	resp, err := client.GetShardIterator(&tablestore.GetShardIteratorRequest{StreamId: &streamId, ShardId: &shardId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var users []string
+	for iterator := resp.ShardIterator; iterator != nil; {
+		records, err := client.GetStreamRecord(&tablestore.GetStreamRecordRequest{ShardIterator: iterator})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, record := range records.Records {
+			users = append(users, record.PrimaryKey.PrimaryKeys[0].Value.(string))
+		}
+		iterator = records.NextShardIterator
+	}
+	return users
+}
+
+func TestStreams(t *testing.T) {
+	api := &streams{table: "orders", users: []string{"ac:u0", "acme:u1", "acme2:u2", "acme:u3"}}
+	acme, _ := New(api, "acme", "orders")
+	if users := streamUsers(t, acme); !reflect.DeepEqual(users, []string{"u1", "u3"}) {
+		t.Errorf("acme records %v", users)
+	}
+	other, _ := New(api, "acme", "global")
+	if users := streamUsers(t, other); !reflect.DeepEqual(users, api.users) {
+		t.Errorf("records of a table not shared %v", users)
+	}
+	if users := streamUsers(t, api); !reflect.DeepEqual(users, api.users) {
+		t.Errorf("records %v", users)
+	}
+
+	// iterators of the stream of all tenants are not accepted
+	iterator := tablestore.ShardIterator("0")
+	if _, err := acme.GetStreamRecord(&tablestore.GetStreamRecordRequest{ShardIterator: &iterator}); err != ErrForeignIterator {
+		t.Errorf("foreign iterator %v", err)
+	}
+}
+
+func TestTableOperations(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	client := server.NewTableStoreClient()
+	createTable(t, client, "orders")
+	acme, _ := New(client, "acme", "orders")
+
+	meta := &tablestore.TableMeta{TableName: "orders"}
+	meta.AddPrimaryKeyColumn("user", tablestore.PrimaryKeyType_STRING)
+	if _, err := acme.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta}); err != ErrCrossTenant {
+		t.Errorf("create table %v", err)
+	}
+	if _, err := acme.UpdateTable(&tablestore.UpdateTableRequest{TableName: "orders", TableOption: tablestore.NewTableOption(-1, 2)}); err != ErrCrossTenant {
+		t.Errorf("update table %v", err)
+	}
+	if _, err := acme.DeleteTable(&tablestore.DeleteTableRequest{TableName: "orders"}); err != ErrCrossTenant {
+		t.Errorf("delete table %v", err)
+	}
+	if _, err := acme.CreateIndex(&tablestore.CreateIndexRequest{MainTableName: "orders", IndexMeta: &tablestore.IndexMeta{IndexName: "index"}}); err != ErrCrossTenant {
+		t.Errorf("create index %v", err)
+	}
+	if _, err := acme.DeleteIndex(&tablestore.DeleteIndexRequest{MainTableName: "orders", IndexName: "index"}); err != ErrCrossTenant {
+		t.Errorf("delete index %v", err)
+	}
+	if _, err := acme.CreateSearchIndex(&tablestore.CreateSearchIndexRequest{TableName: "orders", IndexName: "index"}); err != ErrCrossTenant {
+		t.Errorf("create search index %v", err)
+	}
+	if _, err := acme.DeleteSearchIndex(&tablestore.DeleteSearchIndexRequest{TableName: "orders", IndexName: "index"}); err != ErrCrossTenant {
+		t.Errorf("delete search index %v", err)
+	}
+	if _, err := client.DescribeTable(&tablestore.DescribeTableRequest{TableName: "orders"}); err != nil {
+		t.Errorf("shared table changed: %v", err)
+	}
+
+	// tables which are not shared are the tenant's
+	meta.TableName = "private"
+	if _, err := acme.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := acme.DeleteTable(&tablestore.DeleteTableRequest{TableName: "private"}); err != nil {
+		t.Fatal(err)
+	}
+}
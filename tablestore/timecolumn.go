@@ -0,0 +1,135 @@
+package tablestore
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimePrecision is the unit of the INTEGER columns times are stored in, as
+// the number of units elapsed since the Unix epoch. Times are truncated to the
+// precision when written.
+type TimePrecision int
+
+const (
+	Milliseconds TimePrecision = iota
+	Seconds
+	Microseconds
+)
+
+func (precision TimePrecision) unit() time.Duration {
+	switch precision {
+	case Seconds:
+		return time.Second
+	case Microseconds:
+		return time.Microsecond
+	}
+	return time.Millisecond
+}
+
+func (precision TimePrecision) String() string {
+	switch precision {
+	case Milliseconds:
+		return "milliseconds"
+	case Seconds:
+		return "seconds"
+	case Microseconds:
+		return "microseconds"
+	}
+	return fmt.Sprintf("TimePrecision(%d)", int(precision))
+}
+
+// Int64 returns the value of t in a column.
+func (precision TimePrecision) Int64(t time.Time) int64 {
+	if precision == Seconds {
+		return t.Unix()
+	}
+	unit := int64(precision.unit())
+	// floor of the nanoseconds since the epoch, without overflowing for times
+	// out of the range of UnixNano
+	return t.Unix()*(int64(time.Second)/unit) + int64(t.Nanosecond())/unit
+}
+
+// Time returns the time of the value of a column, in UTC.
+func (precision TimePrecision) Time(v int64) time.Time {
+	unit := int64(precision.unit())
+	perSecond := int64(time.Second) / unit
+	sec, rem := v/perSecond, v%perSecond
+	if rem < 0 {
+		sec, rem = sec-1, rem+perSecond
+	}
+	return time.Unix(sec, rem*unit).UTC()
+}
+
+// AddTimeColumn adds t as an INTEGER column of the given precision.
+func (rowchange *PutRowChange) AddTimeColumn(columnName string, t time.Time, precision TimePrecision) {
+	rowchange.AddColumn(columnName, precision.Int64(t))
+}
+
+// PutTimeColumn puts t as an INTEGER column of the given precision.
+func (rowchange *UpdateRowChange) PutTimeColumn(columnName string, t time.Time, precision TimePrecision) {
+	rowchange.PutColumn(columnName, precision.Int64(t))
+}
+
+// AddTimePrimaryKeyColumn adds t as an INTEGER primary key column of the given
+// precision.
+func (pk *PrimaryKey) AddTimePrimaryKeyColumn(primaryKeyName string, t time.Time, precision TimePrecision) {
+	pk.AddPrimaryKeyColumn(primaryKeyName, precision.Int64(t))
+}
+
+// AsTime returns the time of an INTEGER column of the given precision, false
+// for other types.
+func (column *AttributeColumn) AsTime(precision TimePrecision) (time.Time, bool) {
+	v, ok := column.Value.(int64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return precision.Time(v), true
+}
+
+// AsTime returns the time of an INTEGER primary key column of the given
+// precision, false for other types and options.
+func (column *PrimaryKeyColumn) AsTime(precision TimePrecision) (time.Time, bool) {
+	v, ok := column.Value.(int64)
+	if !ok || column.PrimaryKeyOption != NONE {
+		return time.Time{}, false
+	}
+	return precision.Time(v), true
+}
+
+// TimeCodec converts time.Time values from and to INTEGER columns of
+// Precision. It is registered as the codecs "unix", "unixmilli" and
+// "unixmicro", e.g. for the orm tag option `codec=unixmilli`.
+type TimeCodec struct {
+	Precision TimePrecision
+}
+
+func (codec TimeCodec) Encode(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return codec.Precision.Int64(t), nil
+	case *time.Time:
+		if t != nil {
+			return codec.Precision.Int64(*t), nil
+		}
+	}
+	return nil, fmt.Errorf("[tablestore] can not encode %T as a time", v)
+}
+
+func (codec TimeCodec) Decode(value interface{}, target interface{}) error {
+	v, ok := value.(int64)
+	if !ok {
+		return fmt.Errorf("[tablestore] time of type %T, not an integer", value)
+	}
+	t, ok := target.(*time.Time)
+	if !ok {
+		return fmt.Errorf("[tablestore] can not decode a time into %T", target)
+	}
+	*t = codec.Precision.Time(v)
+	return nil
+}
+
+func init() {
+	RegisterColumnCodec("unix", TimeCodec{Precision: Seconds})
+	RegisterColumnCodec("unixmilli", TimeCodec{Precision: Milliseconds})
+	RegisterColumnCodec("unixmicro", TimeCodec{Precision: Microseconds})
+}
@@ -0,0 +1,96 @@
+package tablestore
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+)
+
+// ErrInvalidRangeToken is returned by DecodeRangeToken for malformed tokens,
+// and tokens of another query.
+var ErrInvalidRangeToken = errors.New("[tablestore] invalid range token")
+
+const rangeTokenVersion = 1
+
+// queryHash identifies the query of criteria, its start primary key
+// included, whatever the primary key it is resumed at.
+func queryHash(criteria *RangeRowQueryCriteria) uint64 {
+	h := fnv.New64a()
+	write := func(b []byte) {
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(b)))
+		h.Write(size[:])
+		h.Write(b)
+	}
+	write([]byte(criteria.TableName))
+	for _, pk := range []*PrimaryKey{criteria.StartPrimaryKey, criteria.EndPrimaryKey} {
+		if pk != nil {
+			write(pk.Build(false))
+		} else {
+			write(nil)
+		}
+	}
+	for _, column := range criteria.ColumnsToGet {
+		write([]byte(column))
+	}
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(criteria.MaxVersion))
+	write(b[:])
+	if criteria.TimeRange != nil {
+		for _, t := range []int64{criteria.TimeRange.Start, criteria.TimeRange.End, criteria.TimeRange.Specific} {
+			binary.BigEndian.PutUint64(b[:], uint64(t))
+			write(b[:])
+		}
+	}
+	if criteria.Filter != nil {
+		write(criteria.Filter.Serialize())
+	}
+	for _, column := range []*string{criteria.StartColumn, criteria.EndColumn} {
+		if column != nil {
+			write([]byte(*column))
+		}
+	}
+	return h.Sum64()
+}
+
+// EncodeRangeToken returns an opaque token resuming the scan of criteria at
+// next, the NextStartPrimaryKey of a GetRange response, e.g. to hand it as a
+// continuation token to the clients of a paginated API. It returns "" when
+// next is nil, at the end of the scan.
+//
+// Tokens are neither encrypted nor signed: the primary keys they carry can be
+// read and forged by their holders.
+func EncodeRangeToken(criteria *RangeRowQueryCriteria, next *PrimaryKey) string {
+	if next == nil {
+		return ""
+	}
+	pk := next.Build(false)
+	b := make([]byte, 10, 10+len(pk))
+	b[0] = rangeTokenVersion
+	b[1] = byte(criteria.Direction)
+	binary.BigEndian.PutUint64(b[2:], queryHash(criteria))
+	return base64.RawURLEncoding.EncodeToString(append(b, pk...))
+}
+
+// DecodeRangeToken sets the start primary key of criteria to the one of a
+// token encoded by EncodeRangeToken for the same query, built again with its
+// original start primary key. An empty token leaves criteria unchanged.
+func DecodeRangeToken(token string, criteria *RangeRowQueryCriteria) error {
+	if token == "" {
+		return nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) < 10 || b[0] != rangeTokenVersion {
+		return ErrInvalidRangeToken
+	}
+	if Direction(b[1]) != criteria.Direction || binary.BigEndian.Uint64(b[2:]) != queryHash(criteria) {
+		return ErrInvalidRangeToken
+	}
+	pk, err := DecodePrimaryKey(b[10:])
+	if err != nil {
+		return ErrInvalidRangeToken
+	}
+	criteria.StartPrimaryKey = pk
+	return nil
+}
@@ -0,0 +1,89 @@
+package tablestore
+
+import (
+	"context"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
+	"github.com/golang/protobuf/proto"
+	"strings"
+)
+
+// Tracer starts a span around each API call, retries included, e.g. an
+// adapter of an OpenTelemetry trace.Tracer:
+//
+//	func (t otelTracer) StartSpan(ctx context.Context, name string) (context.Context, tablestore.Span) {
+//		ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+//		return ctx, otelSpan{span}
+//	}
+//
+// The context returned is the one of the HTTP requests of the call, so a
+// tracing http.RoundTripper set by SetHttpClient propagates the span.
+type Tracer interface {
+	StartSpan(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is the span of an API call. Its attributes are:
+//
+//	db.system              "tablestore"
+//	db.operation           the action, e.g. "PutRow"
+//	tablestore.table       the table, or the comma separated tables of batch calls
+//	tablestore.attempts    the number of requests sent
+//	tablestore.request_id  the request id of the last request
+//	tablestore.read_cu     consumed read capacity units
+//	tablestore.write_cu    consumed write capacity units
+//	tablestore.error_code  the error code of a failed call
+//	tablestore.correlation_id  the correlation id of the context, if any
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
+
+// SetTracer sets the tracer of the client.
+func SetTracer(tracer Tracer) ClientOption {
+	return func(client *TableStoreClient) {
+		client.tracer = tracer
+	}
+}
+
+// WithContext returns a copy of the client whose calls are bound to ctx:
+// they are traced as children of the span of ctx, and they stop, retries
+// included, once ctx is done.
+//
+//	resp, err := client.WithContext(ctx).GetRow(request)
+func (tableStoreClient *TableStoreClient) WithContext(ctx context.Context) *TableStoreClient {
+	client := *tableStoreClient
+	client.ctx = ctx
+	return &client
+}
+
+func (tableStoreClient *TableStoreClient) context() context.Context {
+	if tableStoreClient.ctx == nil {
+		return context.Background()
+	}
+	return tableStoreClient.ctx
+}
+
+type tableNameGetter interface {
+	GetTableName() string
+}
+
+// tableOf returns the table of a request, or the comma separated tables of
+// batch requests.
+func tableOf(req proto.Message) string {
+	var tables []string
+	switch req := req.(type) {
+	case tableNameGetter:
+		return req.GetTableName()
+	case interface{ GetTableMeta() *otsprotocol.TableMeta }:
+		return req.GetTableMeta().GetTableName()
+	case *otsprotocol.BatchGetRowRequest:
+		for _, table := range req.Tables {
+			tables = append(tables, table.GetTableName())
+		}
+	case *otsprotocol.BatchWriteRowRequest:
+		for _, table := range req.Tables {
+			tables = append(tables, table.GetTableName())
+		}
+	}
+	return strings.Join(tables, ",")
+}
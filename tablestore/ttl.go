@@ -0,0 +1,83 @@
+package tablestore
+
+import (
+	"fmt"
+	"time"
+)
+
+// ExpiresAt returns when a column version of timestamp, in milliseconds,
+// expires in a table whose time to live is ttl seconds, and false if it never
+// does, ttl being -1.
+func ExpiresAt(timestamp int64, ttl int) (time.Time, bool) {
+	if ttl <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, timestamp*int64(time.Millisecond)).Add(time.Duration(ttl) * time.Second), true
+}
+
+// RowExpiresAt returns when row, read from a table whose time to live is ttl
+// seconds, expires: when the newest version of its columns does. It returns
+// false if the row never expires, or was read without attribute columns.
+func RowExpiresAt(row *Row, ttl int) (time.Time, bool) {
+	var latest int64
+	for _, column := range row.Columns {
+		if column.Timestamp > latest {
+			latest = column.Timestamp
+		}
+	}
+	if latest == 0 {
+		return time.Time{}, false
+	}
+	return ExpiresAt(latest, ttl)
+}
+
+// TimestampForLifetime returns the timestamp, in milliseconds, of versions
+// written at now expiring after lifetime in a table whose time to live is ttl
+// seconds, backdated by the difference. The time to live of the table bounds
+// lifetimes: it should be the longest retention of the rows.
+func TimestampForLifetime(now time.Time, ttl int, lifetime time.Duration) (int64, error) {
+	if ttl <= 0 {
+		return 0, fmt.Errorf("[tablestore] lifetime set in a table without time to live")
+	}
+	if lifetime <= 0 || lifetime > time.Duration(ttl)*time.Second {
+		return 0, fmt.Errorf("[tablestore] lifetime %s out of the time to live of the table, %ds", lifetime, ttl)
+	}
+	written := now.Add(lifetime - time.Duration(ttl)*time.Second)
+	return written.UnixNano() / int64(time.Millisecond), nil
+}
+
+// SetLifetime sets the timestamp of the columns put so far, for the row to
+// expire after lifetime in a table whose time to live is ttl seconds.
+func (rowchange *PutRowChange) SetLifetime(ttl int, lifetime time.Duration) error {
+	if !rowchange.frozen.check() {
+		return errFrozenRequest
+	}
+	timestamp, err := TimestampForLifetime(time.Now(), ttl, lifetime)
+	if err != nil {
+		return err
+	}
+	for i := range rowchange.Columns {
+		rowchange.Columns[i].Timestamp = timestamp
+	}
+	return nil
+}
+
+// SetLifetime sets the timestamp of the columns put so far, for them to
+// expire after lifetime in a table whose time to live is ttl seconds. The
+// other columns of the row keep their own expiry.
+func (rowchange *UpdateRowChange) SetLifetime(ttl int, lifetime time.Duration) error {
+	if !rowchange.frozen.check() {
+		return errFrozenRequest
+	}
+	timestamp, err := TimestampForLifetime(time.Now(), ttl, lifetime)
+	if err != nil {
+		return err
+	}
+	for i := range rowchange.Columns {
+		if column := &rowchange.Columns[i]; !column.HasType {
+			column.Timestamp = timestamp
+			column.HasTimestamp = true
+		}
+	}
+	return nil
+}
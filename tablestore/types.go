@@ -0,0 +1,138 @@
+package tablestore
+
+import (
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
+)
+
+// IsValid reports whether keyType is one of the PrimaryKeyType constants.
+func (keyType PrimaryKeyType) IsValid() bool {
+	switch keyType {
+	case PrimaryKeyType_INTEGER, PrimaryKeyType_STRING, PrimaryKeyType_BINARY:
+		return true
+	}
+	return false
+}
+
+func (keyType PrimaryKeyType) String() string {
+	switch keyType {
+	case PrimaryKeyType_INTEGER:
+		return "INTEGER"
+	case PrimaryKeyType_STRING:
+		return "STRING"
+	case PrimaryKeyType_BINARY:
+		return "BINARY"
+	}
+	return fmt.Sprintf("PrimaryKeyType(%d)", int32(keyType))
+}
+
+func (keyType PrimaryKeyType) ConvertToPbPrimaryKeyType() otsprotocol.PrimaryKeyType {
+	return otsprotocol.PrimaryKeyType(keyType)
+}
+
+func ConvertPbPrimaryKeyType(keyType otsprotocol.PrimaryKeyType) PrimaryKeyType {
+	return PrimaryKeyType(keyType)
+}
+
+// IsValid reports whether columnType is one of the DefinedColumnType
+// constants.
+func (columnType DefinedColumnType) IsValid() bool {
+	switch columnType {
+	case DefinedColumn_INTEGER, DefinedColumn_DOUBLE, DefinedColumn_BOOLEAN, DefinedColumn_STRING, DefinedColumn_BINARY:
+		return true
+	}
+	return false
+}
+
+func (columnType DefinedColumnType) String() string {
+	switch columnType {
+	case DefinedColumn_INTEGER:
+		return "INTEGER"
+	case DefinedColumn_DOUBLE:
+		return "DOUBLE"
+	case DefinedColumn_BOOLEAN:
+		return "BOOLEAN"
+	case DefinedColumn_STRING:
+		return "STRING"
+	case DefinedColumn_BINARY:
+		return "BINARY"
+	}
+	return fmt.Sprintf("DefinedColumnType(%d)", int32(columnType))
+}
+
+// IsValid reports whether columnType is one of the ColumnType constants.
+func (columnType ColumnType) IsValid() bool {
+	switch columnType {
+	case ColumnType_STRING, ColumnType_INTEGER, ColumnType_BOOLEAN, ColumnType_DOUBLE, ColumnType_BINARY:
+		return true
+	}
+	return false
+}
+
+func (columnType ColumnType) String() string {
+	switch columnType {
+	case ColumnType_STRING:
+		return "STRING"
+	case ColumnType_INTEGER:
+		return "INTEGER"
+	case ColumnType_BOOLEAN:
+		return "BOOLEAN"
+	case ColumnType_DOUBLE:
+		return "DOUBLE"
+	case ColumnType_BINARY:
+		return "BINARY"
+	}
+	return fmt.Sprintf("ColumnType(%d)", int32(columnType))
+}
+
+// ColumnTypeOf returns the type of the column of a value, false if value is
+// not an int64, a float64, a bool, a string or a []byte.
+func ColumnTypeOf(value interface{}) (ColumnType, bool) {
+	switch value.(type) {
+	case string:
+		return ColumnType_STRING, true
+	case int64:
+		return ColumnType_INTEGER, true
+	case bool:
+		return ColumnType_BOOLEAN, true
+	case float64:
+		return ColumnType_DOUBLE, true
+	case []byte:
+		return ColumnType_BINARY, true
+	}
+	return 0, false
+}
+
+// DefinedColumnType returns the type of the defined columns of values of
+// columnType.
+func (columnType ColumnType) DefinedColumnType() DefinedColumnType {
+	switch columnType {
+	case ColumnType_STRING:
+		return DefinedColumn_STRING
+	case ColumnType_INTEGER:
+		return DefinedColumn_INTEGER
+	case ColumnType_BOOLEAN:
+		return DefinedColumn_BOOLEAN
+	case ColumnType_DOUBLE:
+		return DefinedColumn_DOUBLE
+	case ColumnType_BINARY:
+		return DefinedColumn_BINARY
+	}
+	return 0
+}
+
+// validateTableMeta checks the types of the columns of meta, which the
+// service otherwise rejects with obscure errors, or reads as other types.
+func validateTableMeta(meta *TableMeta) error {
+	for _, key := range meta.SchemaEntry {
+		if !key.GetType().IsValid() {
+			return fmt.Errorf("[tablestore] invalid type %v of primary key column %s", key.GetType(), key.GetName())
+		}
+	}
+	for _, column := range meta.DefinedColumns {
+		if !column.ColumnType.IsValid() {
+			return fmt.Errorf("[tablestore] invalid type %v of defined column %s", column.ColumnType, column.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+// Package unique enforces the uniqueness of a column which is not part of
+// the primary key, such as the email of users, by marker rows in a companion
+// table whose primary key is the value:
+//
+//	emails := unique.New(client, "users", "email", "unique_markers", unique.Options{})
+//	err := emails.Put(change)
+//	if err == unique.ErrDuplicate {
+//		// another user has this email
+//	}
+//
+// The protocol has no transaction across rows, so rows are written in steps:
+// the marker of the new value is written if it does not exist, then the row,
+// then the marker of the former value is deleted. The marker is deleted again
+// if writing the row fails. A process dying between the steps leaves an
+// orphan marker, recording the primary key of its row: it is taken over by a
+// later write once older than Options.GracePeriod, if its row does not hold
+// the value.
+//
+// Rows must be written through the constraint only, and their primary key
+// must not be auto increment.
+package unique
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"strconv"
+	"time"
+)
+
+// columns of the marker rows, whose primary key is made of the string
+// columns ConstraintColumn, "table.column", and ValueColumn
+const (
+	ConstraintColumn = "constraint"
+	ValueColumn      = "value"
+	OwnerColumn      = "owner"
+	ClaimedAtColumn  = "claimed_at"
+)
+
+// ErrDuplicate is returned when another row holds the value.
+var ErrDuplicate = errors.New("[tablestore] unique value already exists")
+
+type Options struct {
+	// age from which markers whose row does not hold the value are taken
+	// over, 1 minute by default. It must exceed the time between the steps
+	// of a write.
+	GracePeriod time.Duration
+}
+
+// Constraint is the uniqueness of Column in Table.
+type Constraint struct {
+	client      tablestore.TableStoreApi
+	table       string
+	column      string
+	markerTable string
+	options     Options
+}
+
+func New(client tablestore.TableStoreApi, table, column, markerTable string, options Options) *Constraint {
+	if options.GracePeriod <= 0 {
+		options.GracePeriod = time.Minute
+	}
+	return &Constraint{client: client, table: table, column: column, markerTable: markerTable, options: options}
+}
+
+// CreateMarkerTable creates a table of markers, which may be shared by
+// several constraints.
+func CreateMarkerTable(client tablestore.TableStoreApi, table string) error {
+	meta := &tablestore.TableMeta{TableName: table}
+	meta.AddPrimaryKeyColumn(ConstraintColumn, tablestore.PrimaryKeyType_STRING)
+	meta.AddPrimaryKeyColumn(ValueColumn, tablestore.PrimaryKeyType_STRING)
+	_, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}})
+	return err
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// encode returns the marker value of a column value, prefixed by its type.
+func encode(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case string:
+		return "s" + value, nil
+	case int64:
+		return "i" + strconv.FormatInt(value, 10), nil
+	case float64:
+		return "d" + strconv.FormatFloat(value, 'g', -1, 64), nil
+	case bool:
+		return "b" + strconv.FormatBool(value), nil
+	case []byte:
+		return "x" + hex.EncodeToString(value), nil
+	}
+	return "", fmt.Errorf("[tablestore] unsupported unique value %T", value)
+}
+
+func (c *Constraint) markerKey(value string) *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn(ConstraintColumn, c.table+"."+c.column)
+	pk.AddPrimaryKeyColumn(ValueColumn, value)
+	return pk
+}
+
+func ownerOf(pk *tablestore.PrimaryKey) ([]byte, error) {
+	for _, column := range pk.PrimaryKeys {
+		if column.PrimaryKeyOption != tablestore.NONE {
+			return nil, fmt.Errorf("[tablestore] unique constraints need complete primary keys")
+		}
+	}
+	return pk.Build(false), nil
+}
+
+// current returns the marker value held by the row, "" if none.
+func (c *Constraint) current(pk *tablestore.PrimaryKey) (string, error) {
+	criteria := &tablestore.SingleRowQueryCriteria{TableName: c.table, PrimaryKey: pk, MaxVersion: 1, ColumnsToGet: []string{c.column}}
+	resp, err := c.client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil {
+		return "", err
+	}
+	for _, column := range resp.Columns {
+		if column.ColumnName == c.column {
+			return encode(column.Value)
+		}
+	}
+	return "", nil
+}
+
+// claim writes the marker of value for the row owner.
+func (c *Constraint) claim(value string, owner []byte) error {
+	change := &tablestore.PutRowChange{TableName: c.markerTable, PrimaryKey: c.markerKey(value)}
+	change.AddColumn(OwnerColumn, owner)
+	change.AddColumn(ClaimedAtColumn, millis(time.Now()))
+	change.SetCondition(tablestore.RowExistenceExpectation_EXPECT_NOT_EXIST)
+	_, err := c.client.PutRow(&tablestore.PutRowRequest{PutRowChange: change})
+	if !tablestore.IsConditionCheckFail(err) {
+		return err
+	}
+
+	criteria := &tablestore.SingleRowQueryCriteria{TableName: c.markerTable, PrimaryKey: c.markerKey(value), MaxVersion: 1}
+	resp, err := c.client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil {
+		return err
+	}
+	var holder []byte
+	var claimedAt int64
+	for _, column := range resp.Columns {
+		switch column.ColumnName {
+		case OwnerColumn:
+			holder, _ = column.Value.([]byte)
+		case ClaimedAtColumn:
+			claimedAt, _ = column.Value.(int64)
+		}
+	}
+	if bytes.Equal(holder, owner) {
+		return nil
+	}
+	if time.Since(time.Unix(0, claimedAt*int64(time.Millisecond))) < c.options.GracePeriod {
+		return ErrDuplicate
+	}
+	holderPk, err := tablestore.DecodePrimaryKey(holder)
+	if err != nil {
+		return err
+	}
+	held, err := c.current(holderPk)
+	if err != nil {
+		return err
+	}
+	if held == value {
+		return ErrDuplicate
+	}
+
+	// an orphan marker, taken over unless another row did it meanwhile
+	update := &tablestore.UpdateRowChange{TableName: c.markerTable, PrimaryKey: c.markerKey(value)}
+	update.PutColumn(OwnerColumn, owner)
+	update.PutColumn(ClaimedAtColumn, millis(time.Now()))
+	update.SetCondition(tablestore.RowExistenceExpectation_EXPECT_EXIST)
+	update.SetColumnCondition(tablestore.NewSingleColumnCondition(OwnerColumn, tablestore.CT_EQUAL, holder))
+	_, err = c.client.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: update})
+	if tablestore.IsConditionCheckFail(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// release deletes the marker of value if owner holds it.
+func (c *Constraint) release(value string, owner []byte) error {
+	change := &tablestore.DeleteRowChange{TableName: c.markerTable, PrimaryKey: c.markerKey(value)}
+	change.SetCondition(tablestore.RowExistenceExpectation_EXPECT_EXIST)
+	change.SetColumnCondition(tablestore.NewSingleColumnCondition(OwnerColumn, tablestore.CT_EQUAL, owner))
+	_, err := c.client.DeleteRow(&tablestore.DeleteRowRequest{DeleteRowChange: change})
+	if tablestore.IsConditionCheckFail(err) {
+		return nil
+	}
+	return err
+}
+
+// write claims value for the row pk, runs write and releases the former
+// value of the row, or value if write fails. An empty value claims nothing.
+func (c *Constraint) write(pk *tablestore.PrimaryKey, value string, write func() error) error {
+	owner, err := ownerOf(pk)
+	if err != nil {
+		return err
+	}
+	former, err := c.current(pk)
+	if err != nil {
+		return err
+	}
+	if value != "" && value != former {
+		if err := c.claim(value, owner); err != nil {
+			return err
+		}
+	}
+	if err := write(); err != nil {
+		if value != "" && value != former {
+			c.release(value, owner)
+		}
+		return err
+	}
+	if former != "" && former != value {
+		return c.release(former, owner)
+	}
+	return nil
+}
+
+// Put writes a row whose value of the column must be unique, if set.
+func (c *Constraint) Put(change *tablestore.PutRowChange) error {
+	var value string
+	for _, column := range change.Columns {
+		if column.ColumnName == c.column {
+			var err error
+			if value, err = encode(column.Value); err != nil {
+				return err
+			}
+		}
+	}
+	return c.write(change.PrimaryKey, value, func() error {
+		_, err := c.client.PutRow(&tablestore.PutRowRequest{PutRowChange: change})
+		return err
+	})
+}
+
+// Update updates a row whose value of the column must be unique, if put.
+// Rows whose column is deleted release their value.
+func (c *Constraint) Update(change *tablestore.UpdateRowChange) error {
+	var value string
+	updated := false
+	for _, column := range change.Columns {
+		if column.ColumnName == c.column {
+			updated = true
+			if column.Value != nil {
+				var err error
+				if value, err = encode(column.Value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	update := func() error {
+		_, err := c.client.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: change})
+		return err
+	}
+	if !updated {
+		return update()
+	}
+	return c.write(change.PrimaryKey, value, update)
+}
+
+// Delete deletes a row and releases its value.
+func (c *Constraint) Delete(change *tablestore.DeleteRowChange) error {
+	return c.write(change.PrimaryKey, "", func() error {
+		_, err := c.client.DeleteRow(&tablestore.DeleteRowRequest{DeleteRowChange: change})
+		return err
+	})
+}
+
+// Lookup returns the primary key of the row holding value, nil if none.
+func (c *Constraint) Lookup(value interface{}) (*tablestore.PrimaryKey, error) {
+	encoded, err := encode(value)
+	if err != nil {
+		return nil, err
+	}
+	criteria := &tablestore.SingleRowQueryCriteria{TableName: c.markerTable, PrimaryKey: c.markerKey(encoded), MaxVersion: 1, ColumnsToGet: []string{OwnerColumn}}
+	resp, err := c.client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil || len(resp.Columns) == 0 {
+		return nil, err
+	}
+	owner, _ := resp.Columns[0].Value.([]byte)
+	pk, err := tablestore.DecodePrimaryKey(owner)
+	if err != nil {
+		return nil, err
+	}
+	if held, err := c.current(pk); err != nil || held != encoded {
+		return nil, err
+	}
+	return pk, nil
+}
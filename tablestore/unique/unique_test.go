@@ -0,0 +1,102 @@
+package unique
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"testing"
+	"time"
+)
+
+func userKey(id string) *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn("id", id)
+	return pk
+}
+
+func putUser(id, email string) *tablestore.PutRowChange {
+	change := &tablestore.PutRowChange{TableName: "users", PrimaryKey: userKey(id)}
+	change.AddColumn("email", email)
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	return change
+}
+
+func TestConstraint(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	client := server.NewTableStoreClient()
+	meta := &tablestore.TableMeta{TableName: "users"}
+	meta.AddPrimaryKeyColumn("id", tablestore.PrimaryKeyType_STRING)
+	if _, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateMarkerTable(client, "markers"); err != nil {
+		t.Fatal(err)
+	}
+	emails := New(client, "users", "email", "markers", Options{GracePeriod: 100 * time.Millisecond})
+
+	if err := emails.Put(putUser("u1", "a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := emails.Put(putUser("u2", "a")); err != ErrDuplicate {
+		t.Fatalf("duplicate written: %v", err)
+	}
+	// rewriting a row with its own value is fine
+	if err := emails.Put(putUser("u1", "a")); err != nil {
+		t.Fatal(err)
+	}
+
+	update := &tablestore.UpdateRowChange{TableName: "users", PrimaryKey: userKey("u1")}
+	update.PutColumn("email", "b")
+	update.SetCondition(tablestore.RowExistenceExpectation_EXPECT_EXIST)
+	if err := emails.Update(update); err != nil {
+		t.Fatal(err)
+	}
+	if err := emails.Put(putUser("u2", "a")); err != nil {
+		t.Fatalf("released value not reused: %v", err)
+	}
+	if pk, err := emails.Lookup("b"); err != nil || pk == nil || pk.PrimaryKeys[0].Value != "u1" {
+		t.Errorf("unexpected lookup %v, %v", pk, err)
+	}
+
+	// the marker is deleted when the row is not written
+	failing := putUser("u1", "c")
+	failing.SetCondition(tablestore.RowExistenceExpectation_EXPECT_NOT_EXIST)
+	if err := emails.Put(failing); err == nil {
+		t.Fatal("existing row overwritten")
+	}
+	if err := emails.Put(putUser("u3", "c")); err != nil {
+		t.Fatalf("marker of failed write kept: %v", err)
+	}
+
+	// orphan markers are taken over after the grace period
+	orphan := &tablestore.PutRowChange{TableName: "markers", PrimaryKey: emails.markerKey("sd")}
+	orphan.AddColumn(OwnerColumn, userKey("u9").Build(false))
+	orphan.AddColumn(ClaimedAtColumn, millis(time.Now()))
+	orphan.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: orphan}); err != nil {
+		t.Fatal(err)
+	}
+	if err := emails.Put(putUser("u4", "d")); err != ErrDuplicate {
+		t.Fatalf("recent marker taken over: %v", err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if err := emails.Put(putUser("u4", "d")); err != nil {
+		t.Fatalf("orphan marker not taken over: %v", err)
+	}
+	// markers of live rows are not
+	if err := emails.Put(putUser("u5", "b")); err != ErrDuplicate {
+		t.Fatalf("live marker taken over: %v", err)
+	}
+
+	del := &tablestore.DeleteRowChange{TableName: "users", PrimaryKey: userKey("u1")}
+	del.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	if err := emails.Delete(del); err != nil {
+		t.Fatal(err)
+	}
+	if pk, err := emails.Lookup("b"); err != nil || pk != nil {
+		t.Errorf("deleted row still holds its value: %v, %v", pk, err)
+	}
+	if err := emails.Put(putUser("u5", "b")); err != nil {
+		t.Fatal(err)
+	}
+}
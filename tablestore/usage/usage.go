@@ -0,0 +1,207 @@
+// Package usage reports the usage of tables: their reserved throughput, the
+// capacity units consumed by the clients of the process and their size, with
+// alerts on tables growing or consuming beyond limits:
+//
+//	monitor := usage.New(client, []string{"orders", "events"}, usage.Options{MaxWriteCUPerSecond: 1000})
+//	reporter := tablestore.NewStatsReporter(time.Minute, monitor.Record)
+//	client := tablestore.NewClient(endpoint, instance, id, secret, tablestore.SetStatsReporter(reporter))
+//	go monitor.Run(ctx, time.Hour, func(report *usage.Report) {
+//		for _, table := range report.Tables {
+//			for _, alert := range table.Alerts {
+//				notify(table.Table, alert)
+//			}
+//		}
+//	})
+//
+// Consumed capacity units are those of the calls recorded, by the clients
+// sharing the StatsReporter: other processes are not accounted for. Batch
+// calls on several tables are not attributed to any. Reports include the
+// snapshots recorded by then, so the interval of the StatsReporter should be
+// a fraction of the interval of the reports.
+package usage
+
+import (
+	"context"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"sync"
+	"time"
+)
+
+// splitSize is the size of the splits counted to estimate the size of tables,
+// in the 100MB unit of ComputeSplitPointsBySize.
+const splitSize = 1
+
+const splitBytes = 100 << 20
+
+type Options struct {
+	// estimate the size of the tables, to the next 100MB, by computing their
+	// split points
+	EstimateSize bool
+	// limits of consumption, in capacity units per second, and of size growth
+	// between reports, in bytes, alerted on if not 0
+	MaxReadCUPerSecond  float64
+	MaxWriteCUPerSecond float64
+	MaxSizeGrowth       int64
+}
+
+// TableUsage is the usage of a table over the interval of a report.
+type TableUsage struct {
+	Table string
+	// error describing the table, the other fields being unset
+	Err error
+
+	TimeToAlive   int
+	MaxVersion    int
+	ReservedRead  int
+	ReservedWrite int
+
+	// capacity units consumed over the interval
+	ConsumedRead     int64
+	ConsumedWrite    int64
+	ReadCUPerSecond  float64
+	WriteCUPerSecond float64
+
+	// estimated size and its growth since the previous report, when sizes
+	// are estimated
+	Size       int64
+	SizeGrowth int64
+
+	Alerts []string
+}
+
+// Report is the usage of the tables over [Start, End).
+type Report struct {
+	Start  time.Time
+	End    time.Time
+	Tables []TableUsage
+}
+
+type consumption struct {
+	read, write int64
+}
+
+// Monitor reports the usage of tables. It is safe for concurrent use.
+type Monitor struct {
+	client  tablestore.TableStoreApi
+	tables  []string
+	options Options
+
+	lock     sync.Mutex
+	start    time.Time
+	consumed map[string]*consumption
+	sizes    map[string]int64
+}
+
+// New returns a monitor of tables.
+func New(client tablestore.TableStoreApi, tables []string, options Options) *Monitor {
+	return &Monitor{
+		client:   client,
+		tables:   tables,
+		options:  options,
+		start:    time.Now(),
+		consumed: make(map[string]*consumption),
+		sizes:    make(map[string]int64),
+	}
+}
+
+// Record adds the capacity units consumed in snapshot to the next report; it
+// is the report callback of a StatsReporter, or is called by it.
+func (monitor *Monitor) Record(snapshot *tablestore.StatsSnapshot) {
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+	for _, op := range snapshot.Operations {
+		consumed, ok := monitor.consumed[op.Table]
+		if !ok {
+			consumed = new(consumption)
+			monitor.consumed[op.Table] = consumed
+		}
+		consumed.read += op.ReadCU
+		consumed.write += op.WriteCU
+	}
+}
+
+// Report describes the tables and returns their usage since the previous
+// report, or since the monitor was created.
+func (monitor *Monitor) Report() *Report {
+	monitor.lock.Lock()
+	report := &Report{Start: monitor.start, End: time.Now()}
+	consumed := monitor.consumed
+	monitor.start = report.End
+	monitor.consumed = make(map[string]*consumption)
+	monitor.lock.Unlock()
+
+	seconds := report.End.Sub(report.Start).Seconds()
+	for _, table := range monitor.tables {
+		usage := TableUsage{Table: table}
+		if c, ok := consumed[table]; ok {
+			usage.ConsumedRead, usage.ConsumedWrite = c.read, c.write
+			if seconds > 0 {
+				usage.ReadCUPerSecond = float64(c.read) / seconds
+				usage.WriteCUPerSecond = float64(c.write) / seconds
+			}
+		}
+		usage.Err = monitor.describe(&usage)
+		monitor.alert(&usage)
+		report.Tables = append(report.Tables, usage)
+	}
+	return report
+}
+
+func (monitor *Monitor) describe(usage *TableUsage) error {
+	resp, err := monitor.client.DescribeTable(&tablestore.DescribeTableRequest{TableName: usage.Table})
+	if err != nil {
+		return err
+	}
+	usage.TimeToAlive, usage.MaxVersion = resp.TableOption.TimeToAlive, resp.TableOption.MaxVersion
+	usage.ReservedRead, usage.ReservedWrite = resp.ReservedThroughput.Readcap, resp.ReservedThroughput.Writecap
+	if !monitor.options.EstimateSize {
+		return nil
+	}
+
+	splits, err := monitor.client.ComputeSplitPointsBySize(&tablestore.ComputeSplitPointsBySizeRequest{TableName: usage.Table, SplitSize: splitSize})
+	if err != nil {
+		return err
+	}
+	usage.Size = int64(len(splits.Splits)) * splitBytes
+	monitor.lock.Lock()
+	if previous, ok := monitor.sizes[usage.Table]; ok {
+		usage.SizeGrowth = usage.Size - previous
+	}
+	monitor.sizes[usage.Table] = usage.Size
+	monitor.lock.Unlock()
+	return nil
+}
+
+func (monitor *Monitor) alert(usage *TableUsage) {
+	options := monitor.options
+	if options.MaxReadCUPerSecond > 0 && usage.ReadCUPerSecond > options.MaxReadCUPerSecond {
+		usage.Alerts = append(usage.Alerts, fmt.Sprintf("consuming %.1f read CU/s, over %.1f", usage.ReadCUPerSecond, options.MaxReadCUPerSecond))
+	}
+	if options.MaxWriteCUPerSecond > 0 && usage.WriteCUPerSecond > options.MaxWriteCUPerSecond {
+		usage.Alerts = append(usage.Alerts, fmt.Sprintf("consuming %.1f write CU/s, over %.1f", usage.WriteCUPerSecond, options.MaxWriteCUPerSecond))
+	}
+	if usage.ReservedRead > 0 && usage.ReadCUPerSecond > float64(usage.ReservedRead) {
+		usage.Alerts = append(usage.Alerts, fmt.Sprintf("consuming %.1f read CU/s, over the %d reserved", usage.ReadCUPerSecond, usage.ReservedRead))
+	}
+	if usage.ReservedWrite > 0 && usage.WriteCUPerSecond > float64(usage.ReservedWrite) {
+		usage.Alerts = append(usage.Alerts, fmt.Sprintf("consuming %.1f write CU/s, over the %d reserved", usage.WriteCUPerSecond, usage.ReservedWrite))
+	}
+	if options.MaxSizeGrowth > 0 && usage.SizeGrowth > options.MaxSizeGrowth {
+		usage.Alerts = append(usage.Alerts, fmt.Sprintf("grown by %d bytes, over %d", usage.SizeGrowth, options.MaxSizeGrowth))
+	}
+}
+
+// Run calls report with a report every interval, until ctx is done.
+func (monitor *Monitor) Run(ctx context.Context, interval time.Duration, report func(*Report)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			report(monitor.Report())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
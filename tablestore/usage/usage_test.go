@@ -0,0 +1,55 @@
+package usage
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	monitor := New(server.NewTableStoreClient(), []string{"orders", "missing"}, Options{MaxWriteCUPerSecond: 0.001})
+	reporter := tablestore.NewStatsReporter(time.Hour, monitor.Record)
+	defer reporter.Stop()
+	client := server.NewTableStoreClient(tablestore.SetStatsReporter(reporter))
+
+	meta := &tablestore.TableMeta{TableName: "orders"}
+	meta.AddPrimaryKeyColumn("id", tablestore.PrimaryKeyType_STRING)
+	if _, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(86400, 2),
+		ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		change := &tablestore.PutRowChange{TableName: "orders", PrimaryKey: new(tablestore.PrimaryKey)}
+		change.PrimaryKey.AddPrimaryKeyColumn("id", id)
+		change.AddColumn("v", int64(1))
+		change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: change}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reporter.Flush()
+
+	report := monitor.Report()
+	if len(report.Tables) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	orders := report.Tables[0]
+	if orders.Err != nil || orders.TimeToAlive != 86400 || orders.MaxVersion != 2 || orders.ConsumedWrite != 3 || orders.WriteCUPerSecond <= 0 {
+		t.Errorf("unexpected usage %+v", orders)
+	}
+	if len(orders.Alerts) != 1 {
+		t.Errorf("unexpected alerts %q", orders.Alerts)
+	}
+	if report.Tables[1].Err == nil {
+		t.Error("missing table described")
+	}
+
+	// consumption is reset by reports
+	report = monitor.Report()
+	if orders := report.Tables[0]; orders.ConsumedWrite != 0 || len(orders.Alerts) != 0 {
+		t.Errorf("unexpected usage %+v", orders)
+	}
+}
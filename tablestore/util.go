@@ -6,11 +6,11 @@ import (
 	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/otsprotocol"
 	"github.com/golang/protobuf/proto"
 	"io"
-	"io/ioutil"
 	"math"
 	"net/http"
 	"reflect"
 	"sort"
+	"sync"
 )
 
 const (
@@ -43,7 +43,7 @@ type ColumnValue struct {
 	Value interface{}
 }
 
-func (cv *ColumnValue) writeCellValue(w io.Writer) {
+func (cv *ColumnValue) writeCellValue(w *bytes.Buffer) {
 	writeTag(w, TAG_CELL_VALUE)
 	if cv == nil {
 		writeRawLittleEndian32(w, 1)
@@ -58,7 +58,7 @@ func (cv *ColumnValue) writeCellValue(w io.Writer) {
 		writeRawLittleEndian32(w, int32(LITTLE_ENDIAN_32_SIZE+1+len(v))) // length + type + value
 		writeRawByte(w, VT_STRING)
 		writeRawLittleEndian32(w, int32(len(v)))
-		writeBytes(w, []byte(v))
+		writeString(w, v)
 
 	case ColumnType_INTEGER:
 		v := cv.Value.(int64)
@@ -88,6 +88,25 @@ func (cv *ColumnValue) writeCellValue(w io.Writer) {
 	}
 }
 
+// size returns the encoded size of the value after its tag.
+func (cv *ColumnValue) size() int {
+	if cv == nil {
+		return LITTLE_ENDIAN_32_SIZE + 1
+	}
+
+	switch cv.Type {
+	case ColumnType_STRING:
+		return LITTLE_ENDIAN_32_SIZE + 1 + LITTLE_ENDIAN_32_SIZE + len(cv.Value.(string))
+	case ColumnType_INTEGER, ColumnType_DOUBLE:
+		return LITTLE_ENDIAN_32_SIZE + 1 + LITTLE_ENDIAN_64_SIZE
+	case ColumnType_BOOLEAN:
+		return LITTLE_ENDIAN_32_SIZE + 2
+	case ColumnType_BINARY:
+		return LITTLE_ENDIAN_32_SIZE + 1 + LITTLE_ENDIAN_32_SIZE + len(cv.Value.([]byte))
+	}
+	return 0
+}
+
 func (cv *ColumnValue) writeCellValueWithoutLengthPrefix() []byte {
 	var b bytes.Buffer
 	w := &b
@@ -97,7 +116,7 @@ func (cv *ColumnValue) writeCellValueWithoutLengthPrefix() []byte {
 
 		writeRawByte(w, VT_STRING)
 		writeRawLittleEndian32(w, int32(len(v)))
-		writeBytes(w, []byte(v))
+		writeString(w, v)
 
 	case ColumnType_INTEGER:
 		v := cv.Value.(int64)
@@ -135,7 +154,7 @@ func (cv *ColumnValue) getCheckSum(crc byte) byte {
 		v := cv.Value.(string)
 		crc = crc8Byte(crc, VT_STRING)
 		crc = crc8Int32(crc, int32(len(v)))
-		crc = crc8Bytes(crc, []byte(v))
+		crc = crc8String(crc, v)
 	case ColumnType_INTEGER:
 		v := cv.Value.(int64)
 		crc = crc8Byte(crc, VT_INTEGER)
@@ -178,6 +197,7 @@ func NewColumn(name []byte, value interface{}) *Column {
 	v := &Column{}
 	v.Name = name
 
+	value = plainValue(value)
 	if value != nil {
 		t := reflect.TypeOf(value)
 		switch t.Kind() {
@@ -194,6 +214,9 @@ func NewColumn(name []byte, value interface{}) *Column {
 			v.Value.Type = ColumnType_DOUBLE
 
 		case reflect.Slice:
+			if _, ok := value.([]byte); !ok {
+				panic(errInvalidInput)
+			}
 			v.Value.Type = ColumnType_BINARY
 		default:
 			panic(errInvalidInput)
@@ -228,7 +251,7 @@ func (c *Column) toPlainBufferCell(ignoreValue bool) *PlainBufferCell {
 
 type PrimaryKeyColumnInner struct {
 	Name  []byte
-	Type  otsprotocol.PrimaryKeyType
+	Type  PrimaryKeyType
 	Value interface{}
 }
 
@@ -264,16 +287,20 @@ func NewPrimaryKeyColumn(name []byte, value interface{}, option PrimaryKeyOption
 		v := &PrimaryKeyColumnInner{}
 		v.Name = name
 
+		value = plainValue(value)
 		t := reflect.TypeOf(value)
 		switch t.Kind() {
 		case reflect.String:
-			v.Type = otsprotocol.PrimaryKeyType_STRING
+			v.Type = PrimaryKeyType_STRING
 
 		case reflect.Int64:
-			v.Type = otsprotocol.PrimaryKeyType_INTEGER
+			v.Type = PrimaryKeyType_INTEGER
 
 		case reflect.Slice:
-			v.Type = otsprotocol.PrimaryKeyType_BINARY
+			if _, ok := value.([]byte); !ok {
+				panic(errInvalidInput)
+			}
+			v.Type = PrimaryKeyType_BINARY
 
 		default:
 			panic(errInvalidInput)
@@ -293,11 +320,11 @@ func NewPrimaryKeyColumn(name []byte, value interface{}, option PrimaryKeyOption
 
 func (pkc *PrimaryKeyColumnInner) toColumnValue() *ColumnValue {
 	switch pkc.Type {
-	case otsprotocol.PrimaryKeyType_INTEGER:
+	case PrimaryKeyType_INTEGER:
 		return &ColumnValue{ColumnType_INTEGER, pkc.Value}
-	case otsprotocol.PrimaryKeyType_STRING:
+	case PrimaryKeyType_STRING:
 		return &ColumnValue{ColumnType_STRING, pkc.Value}
-	case otsprotocol.PrimaryKeyType_BINARY:
+	case PrimaryKeyType_BINARY:
 		return &ColumnValue{ColumnType_BINARY, pkc.Value}
 	}
 
@@ -308,6 +335,13 @@ func (pkc *PrimaryKeyColumnInner) toPlainBufferCell() *PlainBufferCell {
 	cell := &PlainBufferCell{}
 	cell.cellName = pkc.Name
 	cell.cellValue = pkc.toColumnValue()
+	if pkc.isInfMin() {
+		cell.pkOption = MIN
+	} else if pkc.isInfMax() {
+		cell.pkOption = MAX
+	} else if pkc.isAutoInc() {
+		cell.pkOption = AUTO_INCREMENT
+	}
 	return cell
 }
 
@@ -348,7 +382,7 @@ func (pkc *PrimaryKeyColumnInner) getCheckSum(crc byte) byte {
 	return pkc.toColumnValue().getCheckSum(crc)
 }
 
-func (pkc *PrimaryKeyColumnInner) writePrimaryKeyColumn(w io.Writer) {
+func (pkc *PrimaryKeyColumnInner) writePrimaryKeyColumn(w *bytes.Buffer) {
 	writeTag(w, TAG_CELL)
 	writeCellName(w, []byte(pkc.Name))
 	if pkc.isInfMin() {
@@ -377,35 +411,12 @@ type PrimaryKey2 struct {
 }
 
 func (pk *PrimaryKey) Build(isDelete bool) []byte {
-	var b bytes.Buffer
-	writeHeader(&b)
-	writeTag(&b, TAG_ROW_PK)
-
-	rowChecksum := byte(0x0)
-	var cellChecksum byte
-
-	for _, column := range pk.PrimaryKeys {
-		primaryKeyColumn := NewPrimaryKeyColumn([]byte(column.ColumnName), column.Value, column.PrimaryKeyOption)
-
-		cellChecksum = crc8Bytes(byte(0x0), []byte(primaryKeyColumn.Name))
-		cellChecksum = primaryKeyColumn.getCheckSum(cellChecksum)
-		rowChecksum = crc8Byte(rowChecksum, cellChecksum)
-		primaryKeyColumn.writePrimaryKeyColumn(&b)
-
-		writeTag(&b, TAG_CELL_CHECKSUM)
-		writeRawByte(&b, cellChecksum)
-	}
-
-	// 没有deleteMarker, 要与0x0做crc.
+	size := primaryKeySize(pk)
 	if isDelete {
-		writeTag(&b, TAG_DELETE_ROW_MARKER)
-		rowChecksum = crc8Byte(rowChecksum, byte(0x1))
-	} else {
-		rowChecksum = crc8Byte(rowChecksum, byte(0x0))
+		size++
 	}
-	writeTag(&b, TAG_ROW_CHECKSUM)
-	writeRawByte(&b, rowChecksum)
-
+	b := bytes.NewBuffer(make([]byte, 0, size))
+	writeRowChecksum(b, writePrimaryKey(b, pk, true), isDelete)
 	return b.Bytes()
 }
 
@@ -433,8 +444,8 @@ func (rpc *RowPutChange) Build() []byte {
 	row := &PlainBufferRow{
 		primaryKey: pkCells,
 		cells:      cells}
-	var b bytes.Buffer
-	row.writeRowWithHeader(&b)
+	b := bytes.NewBuffer(make([]byte, 0, LITTLE_ENDIAN_32_SIZE+row.size()))
+	row.writeRowWithHeader(b)
 
 	return b.Bytes()
 }
@@ -453,8 +464,8 @@ func (ruc *RowUpdateChange) Build() []byte {
 	row := &PlainBufferRow{
 		primaryKey: pkCells,
 		cells:      cells}
-	var b bytes.Buffer
-	row.writeRowWithHeader(&b)
+	b := bytes.NewBuffer(make([]byte, 0, LITTLE_ENDIAN_32_SIZE+row.size()))
+	row.writeRowWithHeader(b)
 
 	return b.Bytes()
 }
@@ -496,6 +507,21 @@ func (columnType DefinedColumnType) ConvertToPbDefinedColumnType() otsprotocol.D
 	}
 }
 
+func ConvertPbDefinedColumnType(columnType otsprotocol.DefinedColumnType) DefinedColumnType {
+	switch columnType {
+	case otsprotocol.DefinedColumnType_DCT_INTEGER:
+		return DefinedColumn_INTEGER
+	case otsprotocol.DefinedColumnType_DCT_DOUBLE:
+		return DefinedColumn_DOUBLE
+	case otsprotocol.DefinedColumnType_DCT_BOOLEAN:
+		return DefinedColumn_BOOLEAN
+	case otsprotocol.DefinedColumnType_DCT_STRING:
+		return DefinedColumn_STRING
+	default:
+		return DefinedColumn_BINARY
+	}
+}
+
 func (loType *LogicalOperator) ConvertToPbLoType() otsprotocol.LogicalOperator {
 	switch *loType {
 	case LO_NOT:
@@ -573,7 +599,7 @@ func (otsClient *TableStoreClient) postReq(req *http.Request, url string) ([]byt
 	}
 	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
+	body, err := readBody(resp)
 	if err != nil {
 		return nil, err, resp.StatusCode, getRequestId(resp)
 	}
@@ -585,6 +611,48 @@ func (otsClient *TableStoreClient) postReq(req *http.Request, url string) ([]byt
 	return body, nil, resp.StatusCode, getRequestId(resp)
 }
 
+// maxResponseSize is the size of the response bodies read at most, far over
+// the responses of the service, against broken proxies.
+const maxResponseSize = 64 << 20
+
+// maxPooledBufferSize is the capacity of the buffers pooled at most, so that
+// the pool does not keep the buffers of the largest responses.
+const maxPooledBufferSize = 4 << 20
+
+var bodyBuffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// readBody reads the body of resp into a slice of its size: the size
+// announced, checked first, or else the size read into a pooled buffer,
+// instead of the slices growing by reading it. Responses built by mock
+// clients may announce no size, 0, with a body.
+func readBody(resp *http.Response) ([]byte, error) {
+	if resp.ContentLength > maxResponseSize {
+		return nil, fmt.Errorf("[tablestore] response of %d bytes, %d at most", resp.ContentLength, maxResponseSize)
+	}
+	if resp.ContentLength > 0 {
+		body := make([]byte, resp.ContentLength)
+		if _, err := io.ReadFull(resp.Body, body); err != nil {
+			return nil, err
+		}
+		return body, nil
+	}
+
+	buffer := bodyBuffers.Get().(*bytes.Buffer)
+	buffer.Reset()
+	defer func() {
+		if buffer.Cap() <= maxPooledBufferSize {
+			bodyBuffers.Put(buffer)
+		}
+	}()
+	if _, err := buffer.ReadFrom(io.LimitReader(resp.Body, maxResponseSize+1)); err != nil {
+		return nil, err
+	}
+	if buffer.Len() > maxResponseSize {
+		return nil, fmt.Errorf("[tablestore] response over %d bytes", maxResponseSize)
+	}
+	return append([]byte(nil), buffer.Bytes()...), nil
+}
+
 func getRequestId(response *http.Response) string {
 	if response == nil || response.Header == nil {
 		return ""
@@ -646,27 +714,39 @@ func (condition *RowCondition) buildCondition() *otsprotocol.RowExistenceExpecta
 }
 
 // build primary key for create table, put row, delete row and update row
-// value only support int64,string,[]byte or you will get panic
+// value only support int64,string,[]byte or PrimaryKeyValue or you will get panic
 func buildPrimaryKey(primaryKeyName string, value interface{}) *PrimaryKeyColumn {
 	// Todo: validate the input
-	return &PrimaryKeyColumn{ColumnName: primaryKeyName, Value: value, PrimaryKeyOption: NONE}
+	if value, ok := value.(PrimaryKeyValue); ok {
+		return &PrimaryKeyColumn{ColumnName: primaryKeyName, Value: value.value, PrimaryKeyOption: value.option}
+	}
+	return &PrimaryKeyColumn{ColumnName: primaryKeyName, Value: plainValue(value), PrimaryKeyOption: NONE}
 }
 
 // value only support int64,string,bool,float64,[]byte. other type will get panic
 func (rowchange *PutRowChange) AddColumn(columnName string, value interface{}) {
+	if !rowchange.frozen.check() {
+		return
+	}
 	// Todo: validate the input
-	column := &AttributeColumn{ColumnName: columnName, Value: value}
+	column := &AttributeColumn{ColumnName: columnName, Value: plainValue(value)}
 	rowchange.Columns = append(rowchange.Columns, *column)
 }
 
 func (rowchange *PutRowChange) SetReturnPk() {
+	if !rowchange.frozen.check() {
+		return
+	}
 	rowchange.ReturnType = ReturnType(ReturnType_RT_PK)
 }
 
 // value only support int64,string,bool,float64,[]byte. other type will get panic
 func (rowchange *PutRowChange) AddColumnWithTimestamp(columnName string, value interface{}, timestamp int64) {
+	if !rowchange.frozen.check() {
+		return
+	}
 	// Todo: validate the input
-	column := &AttributeColumn{ColumnName: columnName, Value: value}
+	column := &AttributeColumn{ColumnName: columnName, Value: plainValue(value)}
 	column.Timestamp = timestamp
 	rowchange.Columns = append(rowchange.Columns, *column)
 }
@@ -689,18 +769,30 @@ func (pk *PrimaryKey) AddPrimaryKeyColumnWithMaxValue(primaryKeyName string) {
 }
 
 func (rowchange *PutRowChange) SetCondition(rowExistenceExpectation RowExistenceExpectation) {
+	if !rowchange.frozen.check() {
+		return
+	}
 	rowchange.Condition = &RowCondition{RowExistenceExpectation: rowExistenceExpectation}
 }
 
 func (rowchange *DeleteRowChange) SetCondition(rowExistenceExpectation RowExistenceExpectation) {
+	if !rowchange.frozen.check() {
+		return
+	}
 	rowchange.Condition = &RowCondition{RowExistenceExpectation: rowExistenceExpectation}
 }
 
 func (Criteria *SingleRowQueryCriteria) SetFilter(filter ColumnFilter) {
+	if !Criteria.frozen.check() {
+		return
+	}
 	Criteria.Filter = filter
 }
 
 func (Criteria *MultiRowQueryCriteria) SetFilter(filter ColumnFilter) {
+	if !Criteria.frozen.check() {
+		return
+	}
 	Criteria.Filter = filter
 }
 
@@ -713,43 +805,64 @@ func NewCompositeColumnCondition(lo LogicalOperator) *CompositeColumnValueFilter
 }
 
 func (rowchange *PutRowChange) SetColumnCondition(condition ColumnFilter) {
+	if !rowchange.frozen.check() {
+		return
+	}
 	rowchange.Condition.ColumnCondition = condition
 }
 
 func (rowchange *UpdateRowChange) SetCondition(rowExistenceExpectation RowExistenceExpectation) {
+	if !rowchange.frozen.check() {
+		return
+	}
 	rowchange.Condition = &RowCondition{RowExistenceExpectation: rowExistenceExpectation}
 }
 
 func (rowchange *UpdateRowChange) SetColumnCondition(condition ColumnFilter) {
+	if !rowchange.frozen.check() {
+		return
+	}
 	rowchange.Condition.ColumnCondition = condition
 }
 
 func (rowchange *DeleteRowChange) SetColumnCondition(condition ColumnFilter) {
+	if !rowchange.frozen.check() {
+		return
+	}
 	rowchange.Condition.ColumnCondition = condition
 }
 
 func (meta *TableMeta) AddPrimaryKeyColumn(name string, keyType PrimaryKeyType) {
-	meta.SchemaEntry = append(meta.SchemaEntry, &PrimaryKeySchema{Name: &name, Type: &keyType})
+	meta.SchemaEntry = append(meta.SchemaEntry, NewPrimaryKeySchema(name, keyType))
 }
 
 func (meta *TableMeta) AddPrimaryKeyColumnOption(name string, keyType PrimaryKeyType, keyOption PrimaryKeyOption) {
-	meta.SchemaEntry = append(meta.SchemaEntry, &PrimaryKeySchema{Name: &name, Type: &keyType, Option: &keyOption})
+	meta.SchemaEntry = append(meta.SchemaEntry, NewPrimaryKeySchema(name, keyType).SetOption(keyOption))
 }
 
 // value only support int64,string,bool,float64,[]byte. other type will get panic
 func (rowchange *UpdateRowChange) PutColumn(columnName string, value interface{}) {
+	if !rowchange.frozen.check() {
+		return
+	}
 	// Todo: validate the input
-	column := &ColumnToUpdate{ColumnName: columnName, Value: value}
+	column := &ColumnToUpdate{ColumnName: columnName, Value: plainValue(value)}
 	rowchange.Columns = append(rowchange.Columns, *column)
 }
 
 func (rowchange *UpdateRowChange) DeleteColumn(columnName string) {
+	if !rowchange.frozen.check() {
+		return
+	}
 	// Todo: validate the input
 	column := &ColumnToUpdate{ColumnName: columnName, Value: nil, Type: DELETE_ALL_VERSION, HasType: true, IgnoreValue: true}
 	rowchange.Columns = append(rowchange.Columns, *column)
 }
 
 func (rowchange *UpdateRowChange) DeleteColumnWithTimestamp(columnName string, timestamp int64) {
+	if !rowchange.frozen.check() {
+		return
+	}
 	// Todo: validate the input
 	column := &ColumnToUpdate{ColumnName: columnName, Value: nil, Type: DELETE_ONE_VERSION, HasType: true, HasTimestamp: true, Timestamp: timestamp, IgnoreValue: true}
 	rowchange.Columns = append(rowchange.Columns, *column)
@@ -760,13 +873,69 @@ func (rowchange *DeleteRowChange) Serialize() []byte {
 }
 
 func (rowchange *PutRowChange) Serialize() []byte {
-	row := buildRowPutChange(rowchange.PrimaryKey, rowchange.Columns)
-	return row.Build()
+	b := bytes.NewBuffer(make([]byte, 0, rowchange.serializedSize()))
+	rowchange.serializeTo(b)
+	return b.Bytes()
 }
 
 func (rowchange *UpdateRowChange) Serialize() []byte {
-	row := buildRowUpdateChange(rowchange.PrimaryKey, rowchange.Columns)
-	return row.Build()
+	b := bytes.NewBuffer(make([]byte, 0, rowchange.serializedSize()))
+	rowchange.serializeTo(b)
+	return b.Bytes()
+}
+
+func (rowchange *DeleteRowChange) serializedSize() int {
+	return primaryKeySize(rowchange.PrimaryKey) + 1
+}
+
+func (rowchange *DeleteRowChange) serializeTo(w *bytes.Buffer) {
+	writeRowChecksum(w, writePrimaryKey(w, rowchange.PrimaryKey, true), true)
+}
+
+func (rowchange *PutRowChange) serializedSize() int {
+	size := primaryKeySize(rowchange.PrimaryKey)
+	if len(rowchange.Columns) > 0 {
+		size++
+	}
+	for i := range rowchange.Columns {
+		column := putColumn(&rowchange.Columns[i])
+		size += columnToUpdateSize(&column)
+	}
+	return size
+}
+
+func (rowchange *PutRowChange) serializeTo(w *bytes.Buffer) {
+	crc := writePrimaryKey(w, rowchange.PrimaryKey, false)
+	if len(rowchange.Columns) > 0 {
+		writeTag(w, TAG_ROW_DATA)
+	}
+	for i := range rowchange.Columns {
+		column := putColumn(&rowchange.Columns[i])
+		crc = crc8Byte(crc, writeColumnToUpdate(w, &column))
+	}
+	writeRowChecksum(w, crc, false)
+}
+
+func (rowchange *UpdateRowChange) serializedSize() int {
+	size := primaryKeySize(rowchange.PrimaryKey)
+	if len(rowchange.Columns) > 0 {
+		size++
+	}
+	for i := range rowchange.Columns {
+		size += columnToUpdateSize(&rowchange.Columns[i])
+	}
+	return size
+}
+
+func (rowchange *UpdateRowChange) serializeTo(w *bytes.Buffer) {
+	crc := writePrimaryKey(w, rowchange.PrimaryKey, false)
+	if len(rowchange.Columns) > 0 {
+		writeTag(w, TAG_ROW_DATA)
+	}
+	for i := range rowchange.Columns {
+		crc = crc8Byte(crc, writeColumnToUpdate(w, &rowchange.Columns[i]))
+	}
+	writeRowChecksum(w, crc, false)
 }
 
 func (rowchange *DeleteRowChange) GetTableName() string {
@@ -821,6 +990,9 @@ func (rowchange *PutRowChange) getCondition() *otsprotocol.Condition {
 }
 
 func (request *BatchWriteRowRequest) AddRowChange(change RowChange) {
+	if !request.frozen.check() {
+		return
+	}
 	if request.RowChangesGroupByTable == nil {
 		request.RowChangesGroupByTable = make(map[string][]RowChange)
 	}
@@ -937,5 +1109,6 @@ func ConvertPbIndexMetaToIndexMeta(meta *otsprotocol.IndexMeta) *IndexMeta {
 		indexmeta.DefinedColumns = append(indexmeta.DefinedColumns, col)
 	}
 
+	indexmeta.SyncPhase = parseIndexSyncPhase(meta.XXX_unrecognized)
 	return indexmeta
 }
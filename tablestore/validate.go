@@ -0,0 +1,172 @@
+package tablestore
+
+import (
+	"fmt"
+	"strings"
+)
+
+// limits of the service checked by Err
+const (
+	maxPrimaryKeyColumns   = 4
+	maxPrimaryKeyValueSize = 1 << 10
+	maxColumnValueSize     = 2 << 20
+	maxColumnsWritten      = 1024
+)
+
+// ValidationError lists the problems of a primary key or of a row change
+// found before sending it, e.g. by PrimaryKey.Err or PutRowChange.Err.
+type ValidationError struct {
+	Errors []error
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = strings.TrimPrefix(err.Error(), "[tablestore] ")
+	}
+	return "[tablestore] invalid request: " + strings.Join(messages, "; ")
+}
+
+type validation struct {
+	errors []error
+}
+
+func (v *validation) add(err error) {
+	if err != nil {
+		v.errors = append(v.errors, err)
+	}
+}
+
+func (v *validation) addf(format string, args ...interface{}) {
+	v.errors = append(v.errors, fmt.Errorf("[tablestore] "+format, args...))
+}
+
+func (v *validation) err() error {
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: v.errors}
+}
+
+// Err returns the problems of pk found without the table schema, nil if
+// there are none: no columns, invalid or repeated names, values of types
+// other than string, int64 and []byte, and values over 1KB.
+func (pk *PrimaryKey) Err() error {
+	v := new(validation)
+	v.primaryKey(pk, true)
+	return v.err()
+}
+
+// primaryKey checks pk, with INF_MIN and INF_MAX values if bound, as in range
+// reads.
+func (v *validation) primaryKey(pk *PrimaryKey, bound bool) {
+	if pk == nil || len(pk.PrimaryKeys) == 0 {
+		v.add(errMissPrimaryKey)
+		return
+	}
+	if len(pk.PrimaryKeys) > maxPrimaryKeyColumns {
+		v.addf("%d primary key columns, %d at most", len(pk.PrimaryKeys), maxPrimaryKeyColumns)
+	}
+	names := make(map[string]bool, len(pk.PrimaryKeys))
+	for i, column := range pk.PrimaryKeys {
+		v.add(validateColumnName(column.ColumnName))
+		if names[column.ColumnName] {
+			v.addf("primary key column %s repeated", column.ColumnName)
+		}
+		names[column.ColumnName] = true
+		switch column.PrimaryKeyOption {
+		case AUTO_INCREMENT:
+			if i == 0 {
+				v.addf("partition key %s auto increment", column.ColumnName)
+			}
+			continue
+		case MIN, MAX:
+			if !bound {
+				v.addf("primary key column %s with an infinite value out of a range", column.ColumnName)
+			}
+			continue
+		}
+		switch value := plainValue(column.Value).(type) {
+		case string:
+			if len(value) > maxPrimaryKeyValueSize {
+				v.addf("primary key column %s of %d bytes, %d at most", column.ColumnName, len(value), maxPrimaryKeyValueSize)
+			}
+		case []byte:
+			if len(value) > maxPrimaryKeyValueSize {
+				v.addf("primary key column %s of %d bytes, %d at most", column.ColumnName, len(value), maxPrimaryKeyValueSize)
+			}
+		case int64:
+		case PrimaryKeyValue:
+			v.addf("primary key column %s of the invalid zero PrimaryKeyValue", column.ColumnName)
+		default:
+			v.addf("primary key column %s is a %T, not a string, int64 or []byte", column.ColumnName, column.Value)
+		}
+	}
+}
+
+// column checks the name and value of a column written.
+func (v *validation) column(name string, value interface{}) {
+	v.add(validateColumnName(name))
+	switch value := plainValue(value).(type) {
+	case string:
+		if len(value) > maxColumnValueSize {
+			v.addf("column %s of %d bytes, %d at most", name, len(value), maxColumnValueSize)
+		}
+	case []byte:
+		if len(value) > maxColumnValueSize {
+			v.addf("column %s of %d bytes, %d at most", name, len(value), maxColumnValueSize)
+		}
+	case int64, float64, bool:
+	default:
+		v.addf("column %s is a %T, not a string, int64, float64, bool or []byte", name, value)
+	}
+}
+
+func (v *validation) change(table string, pk *PrimaryKey, columns int) {
+	if table == "" {
+		v.addf("missing table name")
+	}
+	v.primaryKey(pk, false)
+	if columns > maxColumnsWritten {
+		v.addf("%d columns written, %d at most", columns, maxColumnsWritten)
+	}
+}
+
+// Err returns the problems of the change found without the table schema, nil
+// if there are none, as PrimaryKey.Err does for its primary key and for its
+// columns invalid names, unsupported types and values over 2MB, and whether
+// it was modified while the client held it.
+func (rowchange *PutRowChange) Err() error {
+	v := new(validation)
+	v.add(rowchange.frozen.err())
+	v.change(rowchange.TableName, rowchange.PrimaryKey, len(rowchange.Columns))
+	for _, column := range rowchange.Columns {
+		v.column(column.ColumnName, column.Value)
+	}
+	return v.err()
+}
+
+// Err returns the problems of the change found without the table schema, as
+// PutRowChange.Err does; the columns deleted have no value.
+func (rowchange *UpdateRowChange) Err() error {
+	v := new(validation)
+	v.add(rowchange.frozen.err())
+	v.change(rowchange.TableName, rowchange.PrimaryKey, len(rowchange.Columns))
+	for _, column := range rowchange.Columns {
+		if column.IgnoreValue {
+			v.add(validateColumnName(column.ColumnName))
+		} else {
+			v.column(column.ColumnName, column.Value)
+		}
+	}
+	return v.err()
+}
+
+// Err returns the problems of the change found without the table schema, as
+// PrimaryKey.Err does.
+func (rowchange *DeleteRowChange) Err() error {
+	v := new(validation)
+	v.add(rowchange.frozen.err())
+	v.change(rowchange.TableName, rowchange.PrimaryKey, 0)
+	return v.err()
+}
@@ -0,0 +1,399 @@
+// Package verify counts and checksums the rows of tables, and compares tables
+// row by row, scanning ranges of their primary key in parallel, e.g. to
+// validate a migration or a replica:
+//
+//	report, err := verify.Compare(ctx, source, "orders", target, "orders_v2", verify.Options{Parallelism: 8})
+//	if err != nil {
+//		return err
+//	}
+//	if !report.Equal() {
+//		for _, diff := range report.Diffs {
+//			log.Printf("%s: %v", diff.Kind, diff.PrimaryKey)
+//		}
+//	}
+//
+// Rows are compared by the latest version of their columns; timestamps are
+// ignored. Tables written during the scan are compared at different points
+// in time.
+package verify
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type Options struct {
+	// ranges scanned in parallel, 4 by default
+	Parallelism int
+	// ranges of the primary key scanned, the splits of the source table
+	// computed by ComputeSplitPointsBySize in SplitSize units of 100MB by
+	// default
+	Splits    []*tablestore.Split
+	SplitSize int64
+	// columns compared, all by default
+	Columns []string
+	// max diffs listed in reports, 100 by default
+	MaxDiffs int
+}
+
+func (options *Options) defaults() {
+	if options.Parallelism <= 0 {
+		options.Parallelism = 4
+	}
+	if options.SplitSize <= 0 {
+		options.SplitSize = 1
+	}
+	if options.MaxDiffs <= 0 {
+		options.MaxDiffs = 100
+	}
+}
+
+// Summary is the row count and the checksum of a table. Checksums of tables
+// holding the same rows are equal, whatever the splits they are computed on.
+type Summary struct {
+	Table    string
+	Rows     int64
+	Checksum uint64
+}
+
+func (summary *Summary) add(pk *tablestore.PrimaryKey, hash uint64) {
+	summary.Rows++
+	h := fnv.New64a()
+	h.Write(pk.Build(false))
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], hash)
+	h.Write(b[:])
+	summary.Checksum += h.Sum64()
+}
+
+type DiffKind string
+
+const (
+	// row of the source missing from the target
+	Missing DiffKind = "missing"
+	// row of the target missing from the source
+	Extra DiffKind = "extra"
+	// row of both tables with different columns
+	Mismatch DiffKind = "mismatch"
+)
+
+type Diff struct {
+	Kind       DiffKind
+	PrimaryKey *tablestore.PrimaryKey
+}
+
+// Report is the comparison of two tables.
+type Report struct {
+	Source     Summary
+	Target     Summary
+	Missing    int64
+	Extra      int64
+	Mismatched int64
+	// first diffs in primary key order
+	Diffs []Diff
+}
+
+// Equal reports whether the tables hold the same rows.
+func (report *Report) Equal() bool {
+	return report.Missing == 0 && report.Extra == 0 && report.Mismatched == 0
+}
+
+// Checksum counts and checksums the rows of table.
+func Checksum(ctx context.Context, client tablestore.TableStoreApi, table string, options Options) (*Summary, error) {
+	options.defaults()
+	splits, err := splitsOf(client, table, &options)
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]Summary, len(splits))
+	err = parallel(ctx, len(splits), options.Parallelism, func(ctx context.Context, i int) error {
+		rows := newCursor(client, table, splits[i], &options)
+		for {
+			row, err := rows.next(ctx)
+			if err != nil || row == nil {
+				return err
+			}
+			summaries[i].add(row.PrimaryKey, rowHash(row))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	summary := &Summary{Table: table}
+	for _, s := range summaries {
+		summary.Rows += s.Rows
+		summary.Checksum += s.Checksum
+	}
+	return summary, nil
+}
+
+// Compare compares the rows of sourceTable and of targetTable, whose primary
+// keys must have the same columns.
+func Compare(ctx context.Context, source tablestore.TableStoreApi, sourceTable string, target tablestore.TableStoreApi, targetTable string, options Options) (*Report, error) {
+	options.defaults()
+	splits, err := splitsOf(source, sourceTable, &options)
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]Report, len(splits))
+	err = parallel(ctx, len(splits), options.Parallelism, func(ctx context.Context, i int) error {
+		return compareSplit(ctx, &reports[i], newCursor(source, sourceTable, splits[i], &options),
+			newCursor(target, targetTable, splits[i], &options), options.MaxDiffs)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Source: Summary{Table: sourceTable}, Target: Summary{Table: targetTable}}
+	for _, r := range reports {
+		report.Source.Rows += r.Source.Rows
+		report.Source.Checksum += r.Source.Checksum
+		report.Target.Rows += r.Target.Rows
+		report.Target.Checksum += r.Target.Checksum
+		report.Missing += r.Missing
+		report.Extra += r.Extra
+		report.Mismatched += r.Mismatched
+		report.Diffs = append(report.Diffs, r.Diffs...)
+	}
+	if len(report.Diffs) > options.MaxDiffs {
+		report.Diffs = report.Diffs[:options.MaxDiffs]
+	}
+	return report, nil
+}
+
+// compareSplit merges the rows of a split of both tables, in primary key
+// order.
+func compareSplit(ctx context.Context, report *Report, source, target *cursor, maxDiffs int) error {
+	diff := func(kind DiffKind, pk *tablestore.PrimaryKey) {
+		switch kind {
+		case Missing:
+			report.Missing++
+		case Extra:
+			report.Extra++
+		case Mismatch:
+			report.Mismatched++
+		}
+		if len(report.Diffs) < maxDiffs {
+			report.Diffs = append(report.Diffs, Diff{Kind: kind, PrimaryKey: pk})
+		}
+	}
+	s, err := source.next(ctx)
+	if err != nil {
+		return err
+	}
+	t, err := target.next(ctx)
+	if err != nil {
+		return err
+	}
+	for s != nil || t != nil {
+		c := 0
+		switch {
+		case s == nil:
+			c = 1
+		case t == nil:
+			c = -1
+		default:
+			c = comparePrimaryKeys(s.PrimaryKey, t.PrimaryKey)
+		}
+		if c <= 0 {
+			sourceHash := rowHash(s)
+			report.Source.add(s.PrimaryKey, sourceHash)
+			if c < 0 {
+				diff(Missing, s.PrimaryKey)
+			} else {
+				targetHash := rowHash(t)
+				report.Target.add(t.PrimaryKey, targetHash)
+				if sourceHash != targetHash {
+					diff(Mismatch, s.PrimaryKey)
+				}
+				if t, err = target.next(ctx); err != nil {
+					return err
+				}
+			}
+			if s, err = source.next(ctx); err != nil {
+				return err
+			}
+		} else {
+			report.Target.add(t.PrimaryKey, rowHash(t))
+			diff(Extra, t.PrimaryKey)
+			if t, err = target.next(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func splitsOf(client tablestore.TableStoreApi, table string, options *Options) ([]*tablestore.Split, error) {
+	if options.Splits != nil {
+		return options.Splits, nil
+	}
+	resp, err := client.ComputeSplitPointsBySize(&tablestore.ComputeSplitPointsBySizeRequest{TableName: table, SplitSize: options.SplitSize})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Splits, nil
+}
+
+// parallel runs f for each of n tasks, on at most parallelism goroutines,
+// until one fails.
+func parallel(ctx context.Context, n, parallelism int, f func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tasks := make(chan int)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for w := 0; w < parallelism && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range tasks {
+				if err := f(ctx, i); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case tasks <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(tasks)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// cursor reads the rows of a split one by one.
+type cursor struct {
+	client   tablestore.TableStoreApi
+	criteria *tablestore.RangeRowQueryCriteria
+	rows     []*tablestore.Row
+	done     bool
+}
+
+func newCursor(client tablestore.TableStoreApi, table string, split *tablestore.Split, options *Options) *cursor {
+	criteria := &tablestore.RangeRowQueryCriteria{TableName: table, StartPrimaryKey: split.LowerBound, EndPrimaryKey: split.UpperBound,
+		ColumnsToGet: options.Columns, MaxVersion: 1, Direction: tablestore.FORWARD}
+	return &cursor{client: client, criteria: criteria}
+}
+
+// next returns the next row, nil at the end of the split.
+func (cursor *cursor) next(ctx context.Context) (*tablestore.Row, error) {
+	for len(cursor.rows) == 0 {
+		if cursor.done {
+			return nil, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		resp, err := cursor.client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: cursor.criteria})
+		if err != nil {
+			return nil, err
+		}
+		cursor.rows = resp.Rows
+		if resp.NextStartPrimaryKey == nil {
+			cursor.done = true
+		} else {
+			cursor.criteria.StartPrimaryKey = resp.NextStartPrimaryKey
+		}
+	}
+	row := cursor.rows[0]
+	cursor.rows = cursor.rows[1:]
+	return row, nil
+}
+
+// rowHash hashes the latest value of each column of row, in column name
+// order.
+func rowHash(row *tablestore.Row) uint64 {
+	columns := make([]*tablestore.AttributeColumn, 0, len(row.Columns))
+	seen := make(map[string]bool, len(row.Columns))
+	for _, column := range row.Columns {
+		if !seen[column.ColumnName] {
+			seen[column.ColumnName] = true
+			columns = append(columns, column)
+		}
+	}
+	sort.Slice(columns, func(i, j int) bool {
+		return columns[i].ColumnName < columns[j].ColumnName
+	})
+
+	h := fnv.New64a()
+	var b [8]byte
+	write := func(tag byte, data []byte) {
+		binary.BigEndian.PutUint32(b[:4], uint32(len(data)))
+		h.Write([]byte{tag})
+		h.Write(b[:4])
+		h.Write(data)
+	}
+	for _, column := range columns {
+		write('n', []byte(column.ColumnName))
+		switch value := column.Value.(type) {
+		case string:
+			write('s', []byte(value))
+		case []byte:
+			write('b', value)
+		case int64:
+			binary.BigEndian.PutUint64(b[:], uint64(value))
+			write('i', b[:])
+		case float64:
+			binary.BigEndian.PutUint64(b[:], math.Float64bits(value))
+			write('d', b[:])
+		case bool:
+			if value {
+				write('t', nil)
+			} else {
+				write('f', nil)
+			}
+		}
+	}
+	return h.Sum64()
+}
+
+func comparePrimaryKeys(a, b *tablestore.PrimaryKey) int {
+	for i := 0; i < len(a.PrimaryKeys) && i < len(b.PrimaryKeys); i++ {
+		if c := compareValues(a.PrimaryKeys[i].Value, b.PrimaryKeys[i].Value); c != 0 {
+			return c
+		}
+	}
+	return len(a.PrimaryKeys) - len(b.PrimaryKeys)
+}
+
+func compareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b)
+		}
+	case int64:
+		if b, ok := b.(int64); ok {
+			switch {
+			case a < b:
+				return -1
+			case a > b:
+				return 1
+			}
+			return 0
+		}
+	case []byte:
+		if b, ok := b.([]byte); ok {
+			return bytes.Compare(a, b)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,102 @@
+package verify
+
+import (
+	"context"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"testing"
+)
+
+func createTable(t *testing.T, client tablestore.TableStoreApi, table string, values map[int64]string) {
+	meta := &tablestore.TableMeta{TableName: table}
+	meta.AddPrimaryKeyColumn("id", tablestore.PrimaryKeyType_INTEGER)
+	if _, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}}); err != nil {
+		t.Fatal(err)
+	}
+	for id, value := range values {
+		change := &tablestore.PutRowChange{TableName: table, PrimaryKey: new(tablestore.PrimaryKey)}
+		change.PrimaryKey.AddPrimaryKeyColumn("id", id)
+		change.AddColumn("value", value)
+		change.AddColumn("n", id)
+		change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+		if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: change}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// splits returns the ranges of ids split at points.
+func splits(points ...int64) []*tablestore.Split {
+	lower := new(tablestore.PrimaryKey)
+	lower.AddPrimaryKeyColumnWithMinValue("id")
+	var splits []*tablestore.Split
+	for _, point := range points {
+		upper := new(tablestore.PrimaryKey)
+		upper.AddPrimaryKeyColumn("id", point)
+		splits = append(splits, &tablestore.Split{LowerBound: lower, UpperBound: upper})
+		lower = upper
+	}
+	upper := new(tablestore.PrimaryKey)
+	upper.AddPrimaryKeyColumnWithMaxValue("id")
+	return append(splits, &tablestore.Split{LowerBound: lower, UpperBound: upper})
+}
+
+func TestCompare(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	server.Store.RangeLimit = 2
+	client := server.NewTableStoreClient()
+	values := make(map[int64]string)
+	for i := int64(0); i < 20; i++ {
+		values[i] = "v"
+	}
+	createTable(t, client, "source", values)
+	createTable(t, client, "copy", values)
+	values[3] = "changed"
+	delete(values, 12)
+	values[25] = "v"
+	createTable(t, client, "target", values)
+
+	ctx := context.Background()
+	whole, err := Checksum(ctx, client, "source", Options{Splits: splits()})
+	if err != nil || whole.Rows != 20 {
+		t.Fatalf("unexpected summary %+v, %v", whole, err)
+	}
+	split, err := Checksum(ctx, client, "source", Options{Splits: splits(5, 10, 15), Parallelism: 2})
+	if err != nil || *split != *whole {
+		t.Errorf("checksums differ across splits: %+v, %+v, %v", split, whole, err)
+	}
+
+	report, err := Compare(ctx, client, "source", client, "copy", Options{Splits: splits(7)})
+	if err != nil || !report.Equal() || report.Source.Checksum != report.Target.Checksum || report.Target.Rows != 20 {
+		t.Errorf("unexpected report %+v, %v", report, err)
+	}
+
+	report, err = Compare(ctx, client, "source", client, "target", Options{Splits: splits(7, 14)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Equal() || report.Missing != 1 || report.Extra != 1 || report.Mismatched != 1 || report.Target.Rows != 20 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	expected := []Diff{{Mismatch, nil}, {Missing, nil}, {Extra, nil}}
+	ids := []int64{3, 12, 25}
+	if len(report.Diffs) != 3 {
+		t.Fatalf("unexpected diffs %+v", report.Diffs)
+	}
+	for i, diff := range report.Diffs {
+		if diff.Kind != expected[i].Kind || diff.PrimaryKey.PrimaryKeys[0].Value != ids[i] {
+			t.Errorf("unexpected diff %d: %s %v", i, diff.Kind, diff.PrimaryKey.PrimaryKeys[0].Value)
+		}
+	}
+
+	// the value column only
+	report, err = Compare(ctx, client, "source", client, "target", Options{Splits: splits(), Columns: []string{"n"}, MaxDiffs: 1})
+	if err != nil || report.Mismatched != 0 || len(report.Diffs) != 1 {
+		t.Errorf("unexpected report %+v, %v", report, err)
+	}
+
+	if _, err := Compare(ctx, client, "missing", client, "target", Options{Splits: splits(5)}); err == nil {
+		t.Error("missing table compared")
+	}
+}
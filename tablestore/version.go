@@ -0,0 +1,96 @@
+package tablestore
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// SetAPIVersion sets the API version the client sends with its requests,
+// ApiVersion by default, e.g. to talk to instances serving another version.
+func SetAPIVersion(version string) ClientOption {
+	return func(client *TableStoreClient) {
+		client.apiVersion = version
+	}
+}
+
+// UnsupportedError is the error of an action the instance does not support,
+// e.g. Search on an instance without search indexes or on an older version.
+// Once an action failed so, the client fails it without sending requests,
+// until ResetCapabilities is called. Its message is the one of the service.
+type UnsupportedError struct {
+	Action string
+	Err    error
+}
+
+func (e *UnsupportedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UnsupportedError) Unwrap() error {
+	return e.Err
+}
+
+// IsUnsupported reports whether err is the error of an action the instance
+// does not support, for callers to fall back, e.g. to read without search
+// indexes.
+func IsUnsupported(err error) bool {
+	var unsupported *UnsupportedError
+	return errors.As(err, &unsupported)
+}
+
+// capabilities records the actions the instance of a client does not support.
+type capabilities struct {
+	mu          sync.RWMutex
+	unsupported map[string]error
+}
+
+// Supports reports whether the instance supports action, e.g. "Search", as
+// far as the client knows: true unless the action failed as unsupported.
+func (tableStoreClient *TableStoreClient) Supports(action string) bool {
+	return tableStoreClient.unsupportedError(action) == nil
+}
+
+// ResetCapabilities forgets the actions found unsupported, e.g. once the
+// instance is upgraded.
+func (tableStoreClient *TableStoreClient) ResetCapabilities() {
+	if c := tableStoreClient.capabilities; c != nil {
+		c.mu.Lock()
+		c.unsupported = nil
+		c.mu.Unlock()
+	}
+}
+
+func (tableStoreClient *TableStoreClient) unsupportedError(action string) error {
+	c := tableStoreClient.capabilities
+	if c == nil {
+		return nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if err := c.unsupported[action]; err != nil {
+		return &UnsupportedError{Action: action, Err: err}
+	}
+	return nil
+}
+
+// checkUnsupported returns err, as an UnsupportedError recorded for the
+// action of uri if the action is unsupported: the service fails it with
+// UNSUPPORTED_OPERATION, or the endpoint does not exist, i.e. answers 404
+// without an error of the service. Other errors, e.g. OTSObjectNotExist, which
+// is a 404 too, are about the request, not the action, and are not recorded.
+func (tableStoreClient *TableStoreClient) checkUnsupported(uri string, statusCode int, code string, err error) error {
+	if code != UNSUPPORTED_OPERATION && (code != "" || statusCode != http.StatusNotFound) {
+		return err
+	}
+	action := actionOf(uri)
+	if c := tableStoreClient.capabilities; c != nil {
+		c.mu.Lock()
+		if c.unsupported == nil {
+			c.unsupported = make(map[string]error)
+		}
+		c.unsupported[action] = err
+		c.mu.Unlock()
+	}
+	return &UnsupportedError{Action: action, Err: err}
+}
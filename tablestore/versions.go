@@ -0,0 +1,53 @@
+package tablestore
+
+import "sort"
+
+// VersionedValue is a version of a column value.
+type VersionedValue struct {
+	Timestamp int64
+	Value     interface{}
+}
+
+// Versions returns the versions of the column name among columns, e.g. the
+// columns of a row read with a MaxVersion above 1, newest first.
+func Versions(columns []*AttributeColumn, name string) []VersionedValue {
+	var versions []VersionedValue
+	for _, column := range columns {
+		if column.ColumnName == name {
+			versions = append(versions, VersionedValue{Timestamp: column.Timestamp, Value: column.Value})
+		}
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].Timestamp > versions[j].Timestamp
+	})
+	return versions
+}
+
+// latestBefore returns the newest of versions, sorted newest first, written
+// before ts.
+func latestBefore(versions []VersionedValue, ts int64) (VersionedValue, bool) {
+	i := sort.Search(len(versions), func(i int) bool {
+		return versions[i].Timestamp < ts
+	})
+	if i == len(versions) {
+		return VersionedValue{}, false
+	}
+	return versions[i], true
+}
+
+// GetLatestBefore returns the newest version of the column name among columns
+// written before ts, in milliseconds, and false if there is none.
+func GetLatestBefore(columns []*AttributeColumn, name string, ts int64) (VersionedValue, bool) {
+	return latestBefore(Versions(columns, name), ts)
+}
+
+// GetVersions returns the versions of the column name, newest first.
+func (columnMap *ColumnMap) GetVersions(name string) []VersionedValue {
+	return Versions(columnMap.Columns[name], name)
+}
+
+// GetLatestBefore returns the newest version of the column name written
+// before ts, in milliseconds, and false if there is none.
+func (columnMap *ColumnMap) GetLatestBefore(name string, ts int64) (VersionedValue, bool) {
+	return latestBefore(columnMap.GetVersions(name), ts)
+}
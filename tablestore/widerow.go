@@ -0,0 +1,102 @@
+package tablestore
+
+import (
+	"fmt"
+	"io"
+)
+
+// ColumnIterator reads the columns of a row a few at a time, in column name
+// order, paging with StartColumn and a PaginationFilter, so that rows too
+// large for a response, or for memory, can be read:
+//
+//	criteria := &tablestore.SingleRowQueryCriteria{TableName: "files", PrimaryKey: pk, MaxVersion: 1}
+//	it := tablestore.NewColumnIterator(client, criteria, 1)
+//	for {
+//		column, err := it.Next()
+//		if err == io.EOF {
+//			break
+//		}
+//		...
+//	}
+//
+// The StartColumn and EndColumn of the criteria bound the columns read. The
+// criteria must not have a filter.
+type ColumnIterator struct {
+	client         TableStoreApi
+	criteria       SingleRowQueryCriteria
+	columnsPerRead int32
+	columns        []*AttributeColumn
+	done           bool
+}
+
+// NewColumnIterator returns an iterator reading columnsPerRead columns per
+// GetRow, 1 if 0, with all their versions read.
+func NewColumnIterator(client TableStoreApi, criteria *SingleRowQueryCriteria, columnsPerRead int) *ColumnIterator {
+	if columnsPerRead <= 0 {
+		columnsPerRead = 1
+	}
+	return &ColumnIterator{client: client, criteria: *criteria, columnsPerRead: int32(columnsPerRead)}
+}
+
+// Next returns the next column of the row, io.EOF after the last one or if the
+// row does not exist.
+func (it *ColumnIterator) Next() (*AttributeColumn, error) {
+	for len(it.columns) == 0 {
+		if it.done {
+			return nil, io.EOF
+		}
+		if it.criteria.Filter != nil {
+			return nil, fmt.Errorf("[tablestore] filter of columns iterated")
+		}
+		criteria := it.criteria
+		criteria.Filter = &PaginationFilter{Limit: it.columnsPerRead}
+		resp, err := it.client.GetRow(&GetRowRequest{SingleRowQueryCriteria: &criteria})
+		if err != nil {
+			return nil, err
+		}
+		it.columns = resp.Columns
+		if len(resp.Columns) == 0 {
+			it.done = true
+			continue
+		}
+		// the least name after the last column read
+		next := resp.Columns[len(resp.Columns)-1].ColumnName + "\x00"
+		it.criteria.StartColumn = &next
+	}
+	column := it.columns[0]
+	it.columns = it.columns[1:]
+	return column, nil
+}
+
+// ColumnReader reads the values of the columns iterated, strings or
+// binaries, one after another, holding a page of columns in memory at most.
+type ColumnReader struct {
+	it    *ColumnIterator
+	value []byte
+}
+
+// NewColumnReader returns a reader of the values of the columns of it, e.g.
+// a value written in columns named in order.
+func NewColumnReader(it *ColumnIterator) *ColumnReader {
+	return &ColumnReader{it: it}
+}
+
+func (r *ColumnReader) Read(p []byte) (int, error) {
+	for len(r.value) == 0 {
+		column, err := r.it.Next()
+		if err != nil {
+			return 0, err
+		}
+		switch value := column.Value.(type) {
+		case []byte:
+			r.value = value
+		case string:
+			r.value = []byte(value)
+		default:
+			return 0, fmt.Errorf("[tablestore] column %s is a %T, not a string or binary", column.ColumnName, column.Value)
+		}
+	}
+	n := copy(p, r.value)
+	r.value = r.value[n:]
+	return n, nil
+}
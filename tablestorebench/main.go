@@ -0,0 +1,79 @@
+// Command tablestorebench measures the latency and the consumed capacity
+// units of a mix of requests sent to a TableStore table at a target rate,
+// built on the tablestore/bench package:
+//
+//	tablestorebench -endpoint https://ins.cn-hangzhou.ots.aliyuncs.com -instance ins \
+//		-ak id -sk secret -table bench -create -mix PutRow=1,GetRow=3 -qps 500 -d 1m
+//
+// Credentials default to the environment variables OTS_TEST_ENDPOINT,
+// OTS_TEST_INSTANCENAME, OTS_TEST_KEYID and OTS_TEST_SECRET.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/bench"
+	"os"
+	"time"
+)
+
+func main() {
+	var (
+		endpoint     = flag.String("endpoint", os.Getenv("OTS_TEST_ENDPOINT"), "endpoint of the instance")
+		instanceName = flag.String("instance", os.Getenv("OTS_TEST_INSTANCENAME"), "instance name")
+		accessKeyId  = flag.String("ak", os.Getenv("OTS_TEST_KEYID"), "access key id")
+		accessSecret = flag.String("sk", os.Getenv("OTS_TEST_SECRET"), "access key secret")
+		table        = flag.String("table", "bench", "table name")
+		create       = flag.Bool("create", false, "create the table first")
+		readCU       = flag.Int("read-cu", 0, "reserved read CU of the created table")
+		writeCU      = flag.Int("write-cu", 0, "reserved write CU of the created table")
+		mix          = flag.String("mix", "PutRow=1,GetRow=1", "weights of PutRow, GetRow, GetRange and BatchWriteRow")
+		qps          = flag.Float64("qps", 0, "target requests per second, 0 for as fast as possible")
+		concurrency  = flag.Int("c", 8, "concurrent workers")
+		duration     = flag.Duration("d", 10*time.Second, "duration of the run")
+		requests     = flag.Int64("n", 0, "stop after n requests")
+		keySpace     = flag.Int64("keys", 10000, "number of distinct rows")
+		valueSize    = flag.Int("value-size", 100, "bytes written per row")
+		batchSize    = flag.Int("batch", 100, "rows per BatchWriteRow request")
+		rangeLimit   = flag.Int("range-limit", 100, "max rows per GetRange request")
+		seed         = flag.Int64("seed", 1, "seed of the random sources")
+	)
+	flag.Parse()
+
+	weights, err := bench.ParseMix(*mix)
+	if err != nil {
+		fatal(err)
+	}
+	client := tablestore.NewClient(*endpoint, *instanceName, *accessKeyId, *accessSecret)
+	if *create {
+		if err := bench.CreateTable(client, *table, *readCU, *writeCU); err != nil {
+			fatal(err)
+		}
+		// a new table takes a while before serving requests
+		time.Sleep(time.Minute)
+	}
+
+	report, err := bench.Run(client, bench.Config{
+		TableName:   *table,
+		Mix:         weights,
+		QPS:         *qps,
+		Concurrency: *concurrency,
+		Duration:    *duration,
+		Requests:    *requests,
+		KeySpace:    *keySpace,
+		ValueSize:   *valueSize,
+		BatchSize:   *batchSize,
+		RangeLimit:  int32(*rangeLimit),
+		Seed:        *seed,
+	})
+	if err != nil {
+		fatal(err)
+	}
+	report.WriteTo(os.Stdout)
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "tablestorebench:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
+	"strings"
+	"testing"
+)
+
+func TestCommands(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	server.Store.RangeLimit = 1
+	var out bytes.Buffer
+	cli := &cli{client: server.NewTableStoreClient(), out: &out, format: "table"}
+	run := func(args ...string) string {
+		out.Reset()
+		if err := cli.run(args); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+		return out.String()
+	}
+
+	run("create", "-versions", "2", "orders", "user:string,id:integer")
+	if got := run("list"); got != "orders\n" {
+		t.Errorf("list: %q", got)
+	}
+	if got := run("describe", "orders"); !strings.Contains(got, "primary key          user:string,id:integer\n") || !strings.Contains(got, "max versions         2\n") {
+		t.Errorf("describe:\n%s", got)
+	}
+
+	run("put", "orders", "user=u1,id=1", `{"status":"open","total":9.5,"count":3}`)
+	run("put", "orders", "user=u1,id=2", `{"status":"paid\tlate","data":{"binary":"AAE="}}`)
+	run("put", "orders", "user=u2,id=1", `{"status":"open","ok":true}`)
+
+	if got := run("get", "-columns", "status,total", "orders", "user=u1,id=1"); got != "user  id  status  total\nu1    1   open    9.5\n" {
+		t.Errorf("get:\n%s", got)
+	}
+	if got := run("get", "orders", "user=u1,id=3"); got != "\n" {
+		t.Errorf("get missing row: %q", got)
+	}
+
+	expect := "user  id  count  status      total  data\n" +
+		"u1    1   3      open        9.5    \n" +
+		"u1    2          paid\\tlate         AAE=\n"
+	if got := run("scan", "-start", "user=u1", "-end", "user=u1", "orders"); got != expect {
+		t.Errorf("scan:\n%s\nexpect:\n%s", got, expect)
+	}
+	if got := run("scan", "-reverse", "-limit", "2", "-columns", "status", "orders"); got != "user  id  status\nu2    1   open\nu1    2   paid\\tlate\n" {
+		t.Errorf("reverse scan:\n%s", got)
+	}
+
+	cli.format = "json"
+	expect = `{"id":1,"ok":true,"status":"open","user":"u2"}` + "\n"
+	if got := run("scan", "-start", "user=u2", "orders"); got != expect {
+		t.Errorf("json scan: %s", got)
+	}
+
+	for _, args := range [][]string{
+		{"unknown"},
+		{"get", "orders"},
+		{"get", "orders", "user=u1"},
+		{"get", "orders", "user=u1,id=x"},
+		{"get", "orders", "user=u1,id=1,other=2"},
+		{"scan", "-start", "id=1", "orders"},
+		{"put", "orders", "user=u1,id=1", `{"x":[1]}`},
+		{"put", "orders", "user=u1,id=1", `{"x":{"binary":"%"}}`},
+		{"create", "t", "id:double"},
+		{"create", "t", "id:string:auto"},
+		{"delete", "orders"},
+	} {
+		if err := cli.run(args); err == nil {
+			t.Errorf("expect error for %v", args)
+		}
+	}
+
+	run("delete", "-yes", "orders")
+	if got := run("list"); got != "[]\n" {
+		t.Errorf("list after delete: %q", got)
+	}
+}
+
+func TestRepl(t *testing.T) {
+	server := tablestoretest.NewServer("instance", "id", "secret")
+	defer server.Close()
+	var out bytes.Buffer
+	cli := &cli{client: server.NewTableStoreClient(), out: &out, format: "table"}
+	if err := cli.run([]string{"create", "orders", "user:string,id:integer"}); err != nil {
+		t.Fatal(err)
+	}
+	cli.run([]string{"create", "other", "id:integer"})
+
+	cli.in = strings.NewReader(strings.Join([]string{
+		`put orders user=u1,id=1 '{"status":"open paid"}'`,
+		`put orders user=u1,id=2 '{"status":"open"}'`,
+		`put orders user=u2,id=1 '{"status":"paid"}'`,
+		`select * from orders where user = 'u1' and id=2`,
+		`select status from orders where user=u1 limit 1`,
+		`select user, status from orders where user= 'u3'`,
+		`format json`,
+		`SELECT * FROM orders LIMIT 1`,
+		`select * from orders where status=open`,
+		`sel` + "\t",
+		`select * from o` + "\t",
+		`repl`,
+		`exit`,
+		`list`,
+	}, "\n"))
+	out.Reset()
+	if err := cli.run([]string{"repl"}); err != nil {
+		t.Fatal(err)
+	}
+	expect := "tablestore> tablestore> tablestore> " +
+		"tablestore> user  id  status\nu1    2   open\n" +
+		"tablestore> user  id  status\nu1    1   open paid\n" +
+		"tablestore> \n" +
+		"tablestore> " +
+		`tablestore> {"id":1,"status":"open paid","user":"u1"}` + "\n" +
+		"tablestore> error: status is not a primary key column of orders\n" +
+		"tablestore> select\n" +
+		"tablestore> orders  other\n" +
+		"tablestore> error: already in the repl\n" +
+		"tablestore> "
+	if got := out.String(); got != expect {
+		t.Errorf("repl:\n%s\nexpect:\n%s", got, expect)
+	}
+
+	for _, line := range []string{
+		"select from orders",
+		"select * orders",
+		"select a,,b from orders",
+		"select * from orders where",
+		"select * from orders where =1",
+		"select * from orders limit x",
+		"select * from orders order by id",
+		"format csv",
+		"put orders 'user=u1",
+	} {
+		if err := cli.eval(line); err == nil {
+			t.Errorf("expect error for %q", line)
+		}
+	}
+}
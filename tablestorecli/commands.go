@@ -0,0 +1,530 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/search"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+type command struct {
+	usage string
+	run   func(cli *cli, flags *flag.FlagSet, args []string) error
+	// flags of the command, set on flags before parsing args
+	flags func(flags *flag.FlagSet)
+}
+
+var commands = map[string]*command{
+	"list":     {usage: "list the tables", run: (*cli).list},
+	"describe": {usage: "describe a table: describe table", run: (*cli).describe},
+	"create": {usage: "create a table: create [-ttl seconds] [-versions n] table name:type,...", run: (*cli).create,
+		flags: func(flags *flag.FlagSet) {
+			flags.Int("ttl", -1, "time to live of the data in seconds, -1 for ever")
+			flags.Int("versions", 1, "max versions of columns")
+		}},
+	"delete": {usage: "delete a table: delete -yes table", run: (*cli).deleteTable,
+		flags: func(flags *flag.FlagSet) {
+			flags.Bool("yes", false, "confirm the deletion")
+		}},
+	"get": {usage: "read a row: get [-columns a,b] table pk", run: (*cli).get,
+		flags: func(flags *flag.FlagSet) {
+			flags.String("columns", "", "comma separated columns to get, all by default")
+		}},
+	"put": {usage: "write a row: put table pk '{\"column\": value}'", run: (*cli).put},
+	"scan": {usage: "read a range of rows: scan [-start pk] [-end pk] [-limit n] [-columns a,b] [-reverse] table", run: (*cli).scan,
+		flags: func(flags *flag.FlagSet) {
+			flags.String("start", "", "leading primary key columns of the first rows, the first row by default")
+			flags.String("end", "", "leading primary key columns of the last rows, the last row by default")
+			flags.Int("limit", 100, "max rows, unlimited if 0")
+			flags.String("columns", "", "comma separated columns to get, all by default")
+			flags.Bool("reverse", false, "scan in descending primary key order")
+		}},
+	"search": {usage: "query a search index: search [-term field=value] [-match field=text] [-limit n] table index", run: (*cli).search,
+		flags: func(flags *flag.FlagSet) {
+			flags.String("term", "", "field=value, matching the string value exactly")
+			flags.String("match", "", "field=text, matching the analyzed text")
+			flags.Int("limit", 10, "max rows")
+			flags.String("columns", "", "comma separated columns to get, all by default")
+		}},
+}
+
+func commandNames() []string {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type cli struct {
+	client      tablestore.TableStoreApi
+	in          io.Reader
+	out         io.Writer
+	format      string
+	interactive bool
+}
+
+// run runs the command of args, its name followed by its flags and
+// arguments.
+func (cli *cli) run(args []string) error {
+	command, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	if command.flags != nil {
+		command.flags(flags)
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	return command.run(cli, flags, flags.Args())
+}
+
+func arguments(args []string, names ...string) error {
+	if len(args) != len(names) {
+		return fmt.Errorf("expected arguments: %s", strings.Join(names, " "))
+	}
+	return nil
+}
+
+func flagValue(flags *flag.FlagSet, name string) flag.Getter {
+	return flags.Lookup(name).Value.(flag.Getter)
+}
+
+func stringFlag(flags *flag.FlagSet, name string) string {
+	return flagValue(flags, name).Get().(string)
+}
+
+func columnsFlag(flags *flag.FlagSet) []string {
+	if columns := stringFlag(flags, "columns"); columns != "" {
+		return strings.Split(columns, ",")
+	}
+	return nil
+}
+
+func (cli *cli) list(flags *flag.FlagSet, args []string) error {
+	resp, err := cli.client.ListTable()
+	if err != nil {
+		return err
+	}
+	if cli.format == "json" {
+		return json.NewEncoder(cli.out).Encode(append([]string{}, resp.TableNames...))
+	}
+	for _, name := range resp.TableNames {
+		fmt.Fprintln(cli.out, name)
+	}
+	return nil
+}
+
+// tableDescription is the JSON description of a table.
+type tableDescription struct {
+	Table         string
+	PrimaryKey    []string
+	DefinedColumn []string `json:",omitempty"`
+	TimeToAlive   int
+	MaxVersion    int
+	ReservedRead  int
+	ReservedWrite int
+	Indexes       []string `json:",omitempty"`
+}
+
+func (cli *cli) describe(flags *flag.FlagSet, args []string) error {
+	if err := arguments(args, "table"); err != nil {
+		return err
+	}
+	resp, err := cli.client.DescribeTable(&tablestore.DescribeTableRequest{TableName: args[0]})
+	if err != nil {
+		return err
+	}
+	description := tableDescription{Table: args[0], TimeToAlive: resp.TableOption.TimeToAlive, MaxVersion: resp.TableOption.MaxVersion,
+		ReservedRead: resp.ReservedThroughput.Readcap, ReservedWrite: resp.ReservedThroughput.Writecap}
+	for _, schema := range resp.TableMeta.SchemaEntry {
+		column := *schema.Name + ":" + primaryKeyTypeNames[*schema.Type]
+		if schema.Option != nil && *schema.Option == tablestore.AUTO_INCREMENT {
+			column += ":auto"
+		}
+		description.PrimaryKey = append(description.PrimaryKey, column)
+	}
+	for _, column := range resp.TableMeta.DefinedColumns {
+		description.DefinedColumn = append(description.DefinedColumn, column.Name)
+	}
+	for _, index := range resp.IndexMetas {
+		description.Indexes = append(description.Indexes, index.IndexName)
+	}
+	if cli.format == "json" {
+		return json.NewEncoder(cli.out).Encode(description)
+	}
+	w := tabwriter.NewWriter(cli.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "table\t%s\n", description.Table)
+	fmt.Fprintf(w, "primary key\t%s\n", strings.Join(description.PrimaryKey, ","))
+	if len(description.DefinedColumn) > 0 {
+		fmt.Fprintf(w, "defined columns\t%s\n", strings.Join(description.DefinedColumn, ","))
+	}
+	fmt.Fprintf(w, "time to live\t%d\n", description.TimeToAlive)
+	fmt.Fprintf(w, "max versions\t%d\n", description.MaxVersion)
+	fmt.Fprintf(w, "reserved read/write\t%d/%d\n", description.ReservedRead, description.ReservedWrite)
+	if len(description.Indexes) > 0 {
+		fmt.Fprintf(w, "indexes\t%s\n", strings.Join(description.Indexes, ","))
+	}
+	return w.Flush()
+}
+
+var primaryKeyTypes = map[string]tablestore.PrimaryKeyType{
+	"string":  tablestore.PrimaryKeyType_STRING,
+	"integer": tablestore.PrimaryKeyType_INTEGER,
+	"binary":  tablestore.PrimaryKeyType_BINARY,
+}
+
+var primaryKeyTypeNames = map[tablestore.PrimaryKeyType]string{
+	tablestore.PrimaryKeyType_STRING:  "string",
+	tablestore.PrimaryKeyType_INTEGER: "integer",
+	tablestore.PrimaryKeyType_BINARY:  "binary",
+}
+
+func (cli *cli) create(flags *flag.FlagSet, args []string) error {
+	if err := arguments(args, "table", "name:type,..."); err != nil {
+		return err
+	}
+	meta := &tablestore.TableMeta{TableName: args[0]}
+	for _, column := range strings.Split(args[1], ",") {
+		parts := strings.Split(column, ":")
+		keyType, ok := primaryKeyTypes[strings.ToLower(parts[len(parts)-1])]
+		switch {
+		case len(parts) == 3 && parts[2] == "auto":
+			keyType, ok = primaryKeyTypes[strings.ToLower(parts[1])]
+			ok = ok && keyType == tablestore.PrimaryKeyType_INTEGER
+			meta.AddPrimaryKeyColumnOption(parts[0], keyType, tablestore.AUTO_INCREMENT)
+		case len(parts) == 2:
+			meta.AddPrimaryKeyColumn(parts[0], keyType)
+		default:
+			ok = false
+		}
+		if !ok {
+			return fmt.Errorf("invalid primary key column %q, expected name:string, name:integer[:auto] or name:binary", column)
+		}
+	}
+	option := tablestore.NewTableOption(flagValue(flags, "ttl").Get().(int), flagValue(flags, "versions").Get().(int))
+	_, err := cli.client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: option, ReservedThroughput: &tablestore.ReservedThroughput{}})
+	return err
+}
+
+func (cli *cli) deleteTable(flags *flag.FlagSet, args []string) error {
+	if err := arguments(args, "table"); err != nil {
+		return err
+	}
+	if !flagValue(flags, "yes").Get().(bool) {
+		return fmt.Errorf("deleting table %s and all its rows needs -yes", args[0])
+	}
+	_, err := cli.client.DeleteTable(&tablestore.DeleteTableRequest{TableName: args[0]})
+	return err
+}
+
+// primaryKey parses the comma separated name=value pairs of spec, typed by
+// the schema of table. The columns missing are filled with fill, or are
+// required if fill is NONE.
+func (cli *cli) primaryKey(table string, spec string, fill tablestore.PrimaryKeyOption) (*tablestore.PrimaryKey, error) {
+	values := make(map[string]string)
+	if spec != "" {
+		for _, pair := range strings.Split(spec, ",") {
+			i := strings.IndexByte(pair, '=')
+			if i < 0 {
+				return nil, fmt.Errorf("invalid primary key column %q, expected name=value", pair)
+			}
+			values[pair[:i]] = pair[i+1:]
+		}
+	}
+	return cli.typedPrimaryKey(table, values, fill)
+}
+
+// typedPrimaryKey returns the primary key of the values of table by column,
+// typed by its schema and filled as primaryKey does.
+func (cli *cli) typedPrimaryKey(table string, values map[string]string, fill tablestore.PrimaryKeyOption) (*tablestore.PrimaryKey, error) {
+	resp, err := cli.client.DescribeTable(&tablestore.DescribeTableRequest{TableName: table})
+	if err != nil {
+		return nil, err
+	}
+	pk := new(tablestore.PrimaryKey)
+	filled := false
+	columns := make(map[string]bool)
+	for _, schema := range resp.TableMeta.SchemaEntry {
+		name := *schema.Name
+		columns[name] = true
+		s, ok := values[name]
+		if !ok || filled {
+			switch {
+			case ok:
+				return nil, fmt.Errorf("primary key column %s set after a column missing", name)
+			case fill == tablestore.MIN:
+				pk.AddPrimaryKeyColumnWithMinValue(name)
+			case fill == tablestore.MAX:
+				pk.AddPrimaryKeyColumnWithMaxValue(name)
+			default:
+				return nil, fmt.Errorf("primary key column %s missing", name)
+			}
+			filled = true
+			continue
+		}
+		var value interface{} = s
+		switch *schema.Type {
+		case tablestore.PrimaryKeyType_INTEGER:
+			if value, err = strconv.ParseInt(s, 10, 64); err != nil {
+				return nil, fmt.Errorf("invalid integer %q of primary key column %s", s, name)
+			}
+		case tablestore.PrimaryKeyType_BINARY:
+			if value, err = base64.StdEncoding.DecodeString(s); err != nil {
+				return nil, fmt.Errorf("invalid base64 %q of primary key column %s", s, name)
+			}
+		}
+		pk.AddPrimaryKeyColumn(name, value)
+	}
+	for name := range values {
+		if !columns[name] {
+			return nil, fmt.Errorf("%s is not a primary key column of %s", name, table)
+		}
+	}
+	return pk, nil
+}
+
+func (cli *cli) get(flags *flag.FlagSet, args []string) error {
+	if err := arguments(args, "table", "pk"); err != nil {
+		return err
+	}
+	pk, err := cli.primaryKey(args[0], args[1], tablestore.NONE)
+	if err != nil {
+		return err
+	}
+	rows, err := cli.getRow(args[0], pk, columnsFlag(flags))
+	if err != nil {
+		return err
+	}
+	return cli.printRows(rows)
+}
+
+// getRow reads the row of pk, returning no rows if it does not exist.
+func (cli *cli) getRow(table string, pk *tablestore.PrimaryKey, columns []string) ([]*tablestore.Row, error) {
+	criteria := &tablestore.SingleRowQueryCriteria{TableName: table, PrimaryKey: pk, ColumnsToGet: columns, MaxVersion: 1}
+	resp, err := cli.client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: criteria})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.PrimaryKey.PrimaryKeys) == 0 {
+		return nil, nil
+	}
+	return []*tablestore.Row{{PrimaryKey: &resp.PrimaryKey, Columns: resp.Columns}}, nil
+}
+
+// columnValues parses a JSON object of column values.
+func columnValues(object string) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(object))
+	decoder.UseNumber()
+	var raw map[string]interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid columns: %v", err)
+	}
+	values := make(map[string]interface{}, len(raw))
+	for name, value := range raw {
+		switch v := value.(type) {
+		case string, bool:
+			values[name] = v
+		case json.Number:
+			if n, err := v.Int64(); err == nil {
+				values[name] = n
+			} else if f, err := v.Float64(); err == nil {
+				values[name] = f
+			} else {
+				return nil, fmt.Errorf("invalid number %s of column %s", v, name)
+			}
+		case map[string]interface{}:
+			encoded, ok := v["binary"].(string)
+			if !ok || len(v) != 1 {
+				return nil, fmt.Errorf("invalid value of column %s, expected {\"binary\": base64}", name)
+			}
+			b, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("invalid base64 of column %s", name)
+			}
+			values[name] = b
+		default:
+			return nil, fmt.Errorf("unsupported value of column %s", name)
+		}
+	}
+	return values, nil
+}
+
+func (cli *cli) put(flags *flag.FlagSet, args []string) error {
+	if err := arguments(args, "table", "pk", "columns"); err != nil {
+		return err
+	}
+	pk, err := cli.primaryKey(args[0], args[1], tablestore.NONE)
+	if err != nil {
+		return err
+	}
+	values, err := columnValues(args[2])
+	if err != nil {
+		return err
+	}
+	change := &tablestore.PutRowChange{TableName: args[0], PrimaryKey: pk}
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		change.AddColumn(name, values[name])
+	}
+	_, err = cli.client.PutRow(&tablestore.PutRowRequest{PutRowChange: change})
+	return err
+}
+
+func (cli *cli) scan(flags *flag.FlagSet, args []string) error {
+	if err := arguments(args, "table"); err != nil {
+		return err
+	}
+	start, err := cli.primaryKey(args[0], stringFlag(flags, "start"), tablestore.MIN)
+	if err != nil {
+		return err
+	}
+	end, err := cli.primaryKey(args[0], stringFlag(flags, "end"), tablestore.MAX)
+	if err != nil {
+		return err
+	}
+	criteria := &tablestore.RangeRowQueryCriteria{TableName: args[0], StartPrimaryKey: start, EndPrimaryKey: end,
+		ColumnsToGet: columnsFlag(flags), MaxVersion: 1, Direction: tablestore.FORWARD}
+	if flagValue(flags, "reverse").Get().(bool) {
+		criteria.StartPrimaryKey, criteria.EndPrimaryKey = end, start
+		criteria.Direction = tablestore.BACKWARD
+	}
+	rows, err := cli.getRange(criteria, flagValue(flags, "limit").Get().(int))
+	if err != nil {
+		return err
+	}
+	return cli.printRows(rows)
+}
+
+// getRange reads up to limit rows of criteria, or all of them if limit is 0.
+func (cli *cli) getRange(criteria *tablestore.RangeRowQueryCriteria, limit int) ([]*tablestore.Row, error) {
+	var rows []*tablestore.Row
+	for {
+		if limit > 0 {
+			criteria.Limit = int32(limit - len(rows))
+		}
+		resp, err := cli.client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: criteria})
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, resp.Rows...)
+		if resp.NextStartPrimaryKey == nil || limit > 0 && len(rows) >= limit {
+			return rows, nil
+		}
+		criteria.StartPrimaryKey = resp.NextStartPrimaryKey
+	}
+}
+
+func (cli *cli) search(flags *flag.FlagSet, args []string) error {
+	if err := arguments(args, "table", "index"); err != nil {
+		return err
+	}
+	var query search.Query = &search.MatchAllQuery{}
+	if term := stringFlag(flags, "term"); term != "" {
+		i := strings.IndexByte(term, '=')
+		if i < 0 {
+			return fmt.Errorf("invalid term %q, expected field=value", term)
+		}
+		query = &search.TermQuery{FieldName: term[:i], Term: term[i+1:]}
+	} else if match := stringFlag(flags, "match"); match != "" {
+		i := strings.IndexByte(match, '=')
+		if i < 0 {
+			return fmt.Errorf("invalid match %q, expected field=text", match)
+		}
+		query = &search.MatchQuery{FieldName: match[:i], Text: match[i+1:]}
+	}
+	searchQuery := search.NewSearchQuery().SetQuery(query).SetLimit(int32(flagValue(flags, "limit").Get().(int)))
+	columns := &tablestore.ColumnsToGet{Columns: columnsFlag(flags), ReturnAll: len(columnsFlag(flags)) == 0}
+	request := new(tablestore.SearchRequest).SetTableName(args[0]).SetIndexName(args[1]).SetSearchQuery(searchQuery).SetColumnsToGet(columns)
+	resp, err := cli.client.Search(request)
+	if err != nil {
+		return err
+	}
+	return cli.printRows(resp.Rows)
+}
+
+// printRows prints the latest version of the columns of rows, as tab
+// separated columns with a header, or as JSON lines.
+func (cli *cli) printRows(rows []*tablestore.Row) error {
+	if cli.format == "json" {
+		encoder := json.NewEncoder(cli.out)
+		for _, row := range rows {
+			object := make(map[string]interface{})
+			for _, column := range row.PrimaryKey.PrimaryKeys {
+				object[column.ColumnName] = column.Value
+			}
+			for _, column := range row.Columns {
+				if _, ok := object[column.ColumnName]; !ok {
+					object[column.ColumnName] = column.Value
+				}
+			}
+			if err := encoder.Encode(object); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// columns in order of appearance
+	var names []string
+	index := make(map[string]int)
+	add := func(name string) {
+		if _, ok := index[name]; !ok {
+			index[name] = len(names)
+			names = append(names, name)
+		}
+	}
+	for _, row := range rows {
+		for _, column := range row.PrimaryKey.PrimaryKeys {
+			add(column.ColumnName)
+		}
+	}
+	for _, row := range rows {
+		for _, column := range row.Columns {
+			add(column.ColumnName)
+		}
+	}
+	w := tabwriter.NewWriter(cli.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(names, "\t"))
+	for _, row := range rows {
+		cells := make([]string, len(names))
+		for _, column := range row.PrimaryKey.PrimaryKeys {
+			cells[index[column.ColumnName]] = formatValue(column.Value)
+		}
+		set := make(map[string]bool)
+		for _, column := range row.Columns {
+			if !set[column.ColumnName] {
+				set[column.ColumnName] = true
+				cells[index[column.ColumnName]] = formatValue(column.Value)
+			}
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	return w.Flush()
+}
+
+func formatValue(value interface{}) string {
+	switch value := value.(type) {
+	case []byte:
+		return base64.StdEncoding.EncodeToString(value)
+	case string:
+		quoted := strconv.Quote(value)
+		return quoted[1 : len(quoted)-1]
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,69 @@
+// Command tablestorecli runs operations on the tables and rows of a TableStore
+// instance, printing rows as tab separated columns, or as JSON lines with
+// -format json:
+//
+//	tablestorecli -endpoint https://ins.cn-hangzhou.ots.aliyuncs.com -instance ins -ak id -sk secret list
+//	tablestorecli describe orders
+//	tablestorecli create -ttl 86400 orders user:string,id:integer
+//	tablestorecli put orders user=u1,id=42 '{"status":"open","total":9.5}'
+//	tablestorecli get orders user=u1,id=42
+//	tablestorecli scan -start user=u1 -end user=u1 -limit 10 orders
+//	tablestorecli search -term status=open -limit 10 orders orders_index
+//	tablestorecli delete -yes orders
+//	tablestorecli repl
+//
+// Primary keys are comma separated name=value pairs typed by the schema of
+// the table, binaries being in base64. Scan bounds may set the leading
+// primary key columns only: the others range entirely. Columns put are JSON
+// objects of strings, numbers, booleans and {"binary": base64} binaries.
+//
+// The repl command reads commands and select queries from the standard
+// input, see its help command.
+//
+// Credentials default to the environment variables OTS_TEST_ENDPOINT,
+// OTS_TEST_INSTANCENAME, OTS_TEST_KEYID and OTS_TEST_SECRET.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"os"
+)
+
+func main() {
+	var (
+		endpoint     = flag.String("endpoint", os.Getenv("OTS_TEST_ENDPOINT"), "endpoint of the instance")
+		instanceName = flag.String("instance", os.Getenv("OTS_TEST_INSTANCENAME"), "instance name")
+		accessKeyId  = flag.String("ak", os.Getenv("OTS_TEST_KEYID"), "access key id")
+		accessSecret = flag.String("sk", os.Getenv("OTS_TEST_SECRET"), "access key secret")
+		format       = flag.String("format", "table", "output format of rows, table or json")
+	)
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	client := tablestore.NewClient(*endpoint, *instanceName, *accessKeyId, *accessSecret)
+	cli := &cli{client: client, in: os.Stdin, out: os.Stdout, format: *format}
+	if err := cli.run(flag.Args()); err != nil {
+		fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: tablestorecli [flags] command [command flags] args")
+	fmt.Fprintln(os.Stderr, "\nflags:")
+	flag.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, name := range commandNames() {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", name, commands[name].usage)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "tablestorecli:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// repl is registered by init, as it runs commands itself.
+func init() {
+	commands["repl"] = &command{usage: "read and run commands and select queries interactively, help for details", run: (*cli).repl}
+}
+
+const replHelp = `Commands are those of tablestorecli, and queries:
+
+  select * | column, ... from table [where column = value [and ...]] [limit n]
+
+where the conditions set the leading primary key columns, strings being
+quoted or not. A query of the whole primary key gets the row, others scan
+the rows of the primary key prefix, 100 by default.
+
+  format table | json   sets the output format of rows
+  help                  prints this help
+  exit                  ends the session
+
+Ending a line with a tab lists the commands or tables completing its last
+word.
+`
+
+var errExit = errors.New("exit")
+
+func (cli *cli) repl(flags *flag.FlagSet, args []string) error {
+	if err := arguments(args); err != nil {
+		return err
+	}
+	if cli.interactive {
+		return errors.New("already in the repl")
+	}
+	cli.interactive = true
+	defer func() { cli.interactive = false }()
+
+	scanner := bufio.NewScanner(cli.in)
+	for {
+		fmt.Fprint(cli.out, "tablestore> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(cli.out)
+			return scanner.Err()
+		}
+		line := scanner.Text()
+		if strings.HasSuffix(line, "\t") {
+			completions, err := cli.complete(strings.TrimRight(line, "\t"))
+			if err != nil {
+				fmt.Fprintln(cli.out, "error:", err)
+			} else {
+				fmt.Fprintln(cli.out, strings.Join(completions, "  "))
+			}
+			continue
+		}
+		switch err := cli.eval(strings.TrimSpace(line)); err {
+		case nil:
+		case errExit:
+			return nil
+		default:
+			fmt.Fprintln(cli.out, "error:", err)
+		}
+	}
+}
+
+// eval runs a line of the repl.
+func (cli *cli) eval(line string) error {
+	words, err := splitWords(line)
+	if err != nil || len(words) == 0 {
+		return err
+	}
+	switch strings.ToLower(words[0]) {
+	case "exit", "quit":
+		return errExit
+	case "help":
+		fmt.Fprint(cli.out, replHelp)
+		return nil
+	case "format":
+		if len(words) != 2 || words[1] != "table" && words[1] != "json" {
+			return errors.New("expected format table or format json")
+		}
+		cli.format = words[1]
+		return nil
+	case "select":
+		return cli.query(words[1:])
+	}
+	return cli.run(words)
+}
+
+// splitWords splits line into words separated by spaces, quoted by single
+// or double quotes where they contain spaces.
+func splitWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote %c", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// query runs the select query of words, following select.
+func (cli *cli) query(words []string) error {
+	i := 0
+	for i < len(words) && !strings.EqualFold(words[i], "from") {
+		i++
+	}
+	if i == 0 || i+1 >= len(words) {
+		return errors.New("expected select columns from table")
+	}
+	var columns []string
+	for _, column := range strings.Split(strings.Join(words[:i], ""), ",") {
+		if column == "" {
+			return errors.New("expected columns separated by commas")
+		}
+		columns = append(columns, column)
+	}
+	if len(columns) == 1 && columns[0] == "*" {
+		columns = nil
+	}
+	table := words[i+1]
+	words = words[i+2:]
+
+	values := make(map[string]string)
+	if len(words) > 0 && strings.EqualFold(words[0], "where") {
+		words = words[1:]
+		for {
+			if len(words) == 0 {
+				return errors.New("expected conditions after where")
+			}
+			// column=value, column= value, column =value or column = value
+			condition := words[0]
+			words = words[1:]
+			if !strings.Contains(condition, "=") && len(words) > 0 {
+				condition += words[0]
+				words = words[1:]
+			}
+			if strings.HasSuffix(condition, "=") && len(words) > 0 {
+				condition += words[0]
+				words = words[1:]
+			}
+			j := strings.IndexByte(condition, '=')
+			if j <= 0 {
+				return fmt.Errorf("invalid condition %q, expected column = value", condition)
+			}
+			values[condition[:j]] = condition[j+1:]
+			if len(words) == 0 || !strings.EqualFold(words[0], "and") {
+				break
+			}
+			words = words[1:]
+		}
+	}
+	limit := 100
+	if len(words) == 2 && strings.EqualFold(words[0], "limit") {
+		n, err := strconv.Atoi(words[1])
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid limit %q", words[1])
+		}
+		limit = n
+		words = nil
+	}
+	if len(words) > 0 {
+		return fmt.Errorf("unexpected %q", strings.Join(words, " "))
+	}
+
+	start, err := cli.typedPrimaryKey(table, values, tablestore.MIN)
+	if err != nil {
+		return err
+	}
+	complete := true
+	for _, column := range start.PrimaryKeys {
+		complete = complete && column.PrimaryKeyOption != tablestore.MIN
+	}
+	var rows []*tablestore.Row
+	if complete {
+		rows, err = cli.getRow(table, start, columns)
+	} else {
+		var end *tablestore.PrimaryKey
+		if end, err = cli.typedPrimaryKey(table, values, tablestore.MAX); err != nil {
+			return err
+		}
+		criteria := &tablestore.RangeRowQueryCriteria{TableName: table, StartPrimaryKey: start, EndPrimaryKey: end,
+			ColumnsToGet: columns, MaxVersion: 1, Direction: tablestore.FORWARD}
+		rows, err = cli.getRange(criteria, limit)
+	}
+	if err != nil {
+		return err
+	}
+	return cli.printRows(rows)
+}
+
+// complete returns the words completing the last word of line: commands
+// for the first word, tables for the others.
+func (cli *cli) complete(line string) ([]string, error) {
+	words, err := splitWords(line)
+	if err != nil {
+		return nil, err
+	}
+	prefix := ""
+	if len(words) > 0 && !strings.HasSuffix(line, " ") {
+		prefix = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+
+	var candidates []string
+	if len(words) == 0 {
+		candidates = append(commandNames(), "exit", "format", "help", "select")
+	} else {
+		resp, err := cli.client.ListTable()
+		if err != nil {
+			return nil, err
+		}
+		candidates = resp.TableNames
+	}
+	var completions []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) {
+			completions = append(completions, candidate)
+		}
+	}
+	sort.Strings(completions)
+	return completions, nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+var goTypes = map[string]string{
+	typeString:  "string",
+	typeInteger: "int64",
+	typeDouble:  "float64",
+	typeBoolean: "bool",
+	typeBinary:  "[]byte",
+}
+
+// names used by generated code, parameters must not shadow them
+var reservedParams = map[string]bool{
+	"t": true, "pk": true, "entity": true, "entities": true, "found": true, "err": true,
+	"start": true, "end": true, "api": true, "repo": true, "query": true, "limit": true,
+	"tablestore": true, "orm": true,
+}
+
+// exportedName converts a column or table name such as "user_id" into an
+// exported Go identifier such as "UserId".
+func exportedName(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var buf bytes.Buffer
+	for _, part := range parts {
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		buf.WriteString(string(runes))
+	}
+	result := buf.String()
+	if result == "" || !unicode.IsLetter([]rune(result)[0]) {
+		result = "X" + result
+	}
+	return result
+}
+
+func paramName(name string) string {
+	runes := []rune(exportedName(name))
+	runes[0] = unicode.ToLower(runes[0])
+	result := string(runes)
+	if token.Lookup(result).IsKeyword() || reservedParams[result] {
+		result += "Key"
+	}
+	return result
+}
+
+var funcs = template.FuncMap{
+	"field": func(column *Column) string { return exportedName(column.Name) },
+	"param": func(column *Column) string { return paramName(column.Name) },
+	"type":  func(column *Column) string { return goTypes[column.Type] },
+	"params": func(columns []*Column) string {
+		params := make([]string, len(columns))
+		for i, column := range columns {
+			params[i] = paramName(column.Name) + " " + goTypes[column.Type]
+		}
+		return strings.Join(params, ", ")
+	},
+	"keyFields": func(columns []*Column) string {
+		fields := make([]string, len(columns))
+		for i, column := range columns {
+			fields[i] = exportedName(column.Name) + ": " + paramName(column.Name)
+		}
+		return strings.Join(fields, ", ")
+	},
+}
+
+var fileTemplate = template.Must(template.New("file").Funcs(funcs).Parse(`// Code generated by tablestoregen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/orm"
+)
+{{range .Tables}}{{$struct := .Struct}}{{$first := index .PrimaryKeys 0}}
+const {{$struct}}TableName = "{{.Table}}"
+
+// {{$struct}} is a row of table {{.Table}}.
+type {{$struct}} struct {
+{{- range .PrimaryKeys}}
+	{{field .}} {{type .}} ` + "`" + `tablestore:"{{.Name}},pk{{if .AutoIncrement}},autoincr{{end}}"` + "`" + `
+{{- end}}
+{{- range .Columns}}
+	{{field .}} {{type .}} ` + "`" + `tablestore:"{{.Name}}"` + "`" + `
+{{- end}}
+}
+
+// {{$struct}}PrimaryKey builds the primary key of a row of table {{.Table}}.
+func {{$struct}}PrimaryKey({{params .PrimaryKeys}}) *tablestore.PrimaryKey {
+	pk := new(tablestore.PrimaryKey)
+{{- range .PrimaryKeys}}
+	pk.AddPrimaryKeyColumn("{{.Name}}", {{param .}})
+{{- end}}
+	return pk
+}
+
+// {{$struct}}Table offers typed access to table {{.Table}}.
+type {{$struct}}Table struct {
+	repo *orm.Repository
+}
+
+func New{{$struct}}Table(api tablestore.TableStoreApi) (*{{$struct}}Table, error) {
+	repo, err := orm.NewRepository(api, {{$struct}}TableName, &{{$struct}}{})
+	if err != nil {
+		return nil, err
+	}
+	return &{{$struct}}Table{repo: repo}, nil
+}
+
+func (t *{{$struct}}Table) Repository() *orm.Repository {
+	return t.repo
+}
+
+// Get returns the row with the given primary key, or nil if it does not exist.
+func (t *{{$struct}}Table) Get({{params .PrimaryKeys}}) (*{{$struct}}, error) {
+	entity := &{{$struct}}{ {{- keyFields .PrimaryKeys -}} }
+	found, err := t.repo.Get(entity)
+	if err != nil || !found {
+		return nil, err
+	}
+	return entity, nil
+}
+
+func (t *{{$struct}}Table) Put(entity *{{$struct}}) error {
+	return t.repo.Put(entity)
+}
+
+func (t *{{$struct}}Table) Insert(entity *{{$struct}}) error {
+	return t.repo.Insert(entity)
+}
+
+func (t *{{$struct}}Table) Update(entity *{{$struct}}) error {
+	return t.repo.Update(entity)
+}
+
+func (t *{{$struct}}Table) Delete({{params .PrimaryKeys}}) error {
+	return t.repo.Delete(&{{$struct}}{ {{- keyFields .PrimaryKeys -}} })
+}
+
+func (t *{{$struct}}Table) BatchGet(entities []*{{$struct}}) ([]bool, error) {
+	return t.repo.BatchGet(entities)
+}
+
+// Scan returns the rows of the range described by query, and the primary key
+// the next page starts from, nil if the range is exhausted.
+func (t *{{$struct}}Table) Scan(query *orm.RangeQuery) ([]*{{$struct}}, *tablestore.PrimaryKey, error) {
+	var entities []*{{$struct}}
+	next, err := t.repo.QueryRange(query, &entities)
+	return entities, next, err
+}
+{{- if gt (len .PrimaryKeys) 1}}
+
+// ScanBy{{field $first}} returns at most limit rows whose {{$first.Name}} equals
+// {{param $first}}, 0 means no limit.
+func (t *{{$struct}}Table) ScanBy{{field $first}}({{param $first}} {{type $first}}, limit int) ([]*{{$struct}}, *tablestore.PrimaryKey, error) {
+	start := new(tablestore.PrimaryKey)
+	start.AddPrimaryKeyColumn("{{$first.Name}}", {{param $first}})
+	end := new(tablestore.PrimaryKey)
+	end.AddPrimaryKeyColumn("{{$first.Name}}", {{param $first}})
+{{- range $i, $pk := .PrimaryKeys}}{{if $i}}
+	start.AddPrimaryKeyColumnWithMinValue("{{$pk.Name}}")
+	end.AddPrimaryKeyColumnWithMaxValue("{{$pk.Name}}")
+{{- end}}{{end}}
+	return t.Scan(&orm.RangeQuery{Start: start, End: end, Direction: tablestore.FORWARD, Limit: limit})
+}
+{{- end}}
+{{end}}`))
+
+// generate renders the Go source of def, formatted by gofmt.
+func generate(def *Definition) ([]byte, error) {
+	if err := def.validate(); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := fileTemplate.Execute(&buf, def); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %s", err)
+	}
+	return src, nil
+}
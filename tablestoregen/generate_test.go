@@ -0,0 +1,85 @@
+package main
+
+import (
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	def := &Definition{
+		Package: "model",
+		Tables: []*Table{{
+			Table: "user_info",
+			PrimaryKeys: []*Column{
+				{Name: "user_id", Type: "STRING"},
+				{Name: "type", Type: "integer", AutoIncrement: true},
+			},
+			Columns: []*Column{
+				{Name: "nick-name", Type: "string"},
+				{Name: "score", Type: "double"},
+				{Name: "avatar", Type: "binary"},
+			},
+		}},
+	}
+	src, err := generate(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "tables.go", src, 0); err != nil {
+		t.Fatalf("generated code does not parse: %s\n%s", err, src)
+	}
+	for _, expect := range []string{
+		"type UserInfo struct",
+		"Type     int64   `tablestore:\"type,pk,autoincr\"`",
+		"NickName string  `tablestore:\"nick-name\"`",
+		"func UserInfoPrimaryKey(userId string, typeKey int64) *tablestore.PrimaryKey",
+		"func (t *UserInfoTable) ScanByUserId(userId string, limit int)",
+		"start.AddPrimaryKeyColumnWithMinValue(\"type\")",
+	} {
+		if !strings.Contains(string(src), expect) {
+			t.Errorf("missing %q in generated code:\n%s", expect, src)
+		}
+	}
+}
+
+func TestInvalidDefinition(t *testing.T) {
+	for _, table := range []*Table{
+		{Table: "t"},
+		{Table: "t", PrimaryKeys: []*Column{{Name: "id", Type: "double"}}},
+		{Table: "t", PrimaryKeys: []*Column{{Name: "id", Type: "string", AutoIncrement: true}}},
+		{Table: "t", PrimaryKeys: []*Column{{Name: "id", Type: "string"}}, Columns: []*Column{{Name: "x", Type: "date"}}},
+		{Table: "t", PrimaryKeys: []*Column{{Name: "a_b", Type: "string"}}, Columns: []*Column{{Name: "aB", Type: "string"}}},
+	} {
+		if _, err := generate(&Definition{Package: "model", Tables: []*Table{table}}); err == nil {
+			t.Errorf("expect error for %+v", table)
+		}
+	}
+}
+
+func TestTableFromSchema(t *testing.T) {
+	meta := &tablestore.TableMeta{TableName: "user"}
+	meta.AddPrimaryKeyColumnOption("id", tablestore.PrimaryKeyType_INTEGER, tablestore.AUTO_INCREMENT)
+	meta.AddDefinedColumn("name", tablestore.DefinedColumn_STRING)
+	index := &tablestore.IndexSchema{FieldSchemas: []*tablestore.FieldSchema{
+		{FieldName: str("name"), FieldType: tablestore.FieldType_KEYWORD},
+		{FieldName: str("age"), FieldType: tablestore.FieldType_LONG},
+	}}
+
+	table, err := tableFromSchema(meta, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table.PrimaryKeys) != 1 || !table.PrimaryKeys[0].AutoIncrement || table.PrimaryKeys[0].Type != typeInteger {
+		t.Fatalf("unexpected primary keys %+v", table.PrimaryKeys)
+	}
+	if len(table.Columns) != 2 || table.Columns[0].Name != "name" || table.Columns[1].Type != typeInteger {
+		t.Fatalf("unexpected columns %+v", table.Columns)
+	}
+}
+
+func str(s string) *string {
+	return &s
+}
@@ -0,0 +1,85 @@
+// Command tablestoregen generates Go structs, primary key builders and typed
+// accessors of TableStore tables, built on the tablestore/orm package.
+//
+// The schema is read either from a JSON definition file:
+//
+//	tablestoregen -def schema.json -o model/tables.go
+//
+// or from the instance itself. Each table may be followed by the name of a
+// search index, whose fields are added as attribute columns:
+//
+//	tablestoregen -endpoint https://ins.cn-hangzhou.ots.aliyuncs.com -instance ins \
+//		-ak id -sk secret -package model -table user/user_index,order -o model/tables.go
+//
+// Credentials default to the environment variables OTS_TEST_ENDPOINT,
+// OTS_TEST_INSTANCENAME, OTS_TEST_KEYID and OTS_TEST_SECRET.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+func main() {
+	var (
+		defFile      = flag.String("def", "", "JSON definition file of tables")
+		output       = flag.String("o", "", "output file, stdout if empty")
+		pkg          = flag.String("package", "model", "package name of generated code, overrides the definition file if set explicitly")
+		tables       = flag.String("table", "", "comma separated tables to describe, each optionally followed by /searchIndex")
+		endpoint     = flag.String("endpoint", os.Getenv("OTS_TEST_ENDPOINT"), "endpoint of the instance")
+		instanceName = flag.String("instance", os.Getenv("OTS_TEST_INSTANCENAME"), "instance name")
+		accessKeyId  = flag.String("ak", os.Getenv("OTS_TEST_KEYID"), "access key id")
+		accessSecret = flag.String("sk", os.Getenv("OTS_TEST_SECRET"), "access key secret")
+	)
+	flag.Parse()
+
+	var def *Definition
+	var err error
+	switch {
+	case *defFile != "":
+		def, err = loadDefinition(*defFile)
+		if err == nil && (def.Package == "" || isFlagSet("package")) {
+			def.Package = *pkg
+		}
+	case *tables != "":
+		client := tablestore.NewClient(*endpoint, *instanceName, *accessKeyId, *accessSecret)
+		def, err = describeTables(client, *pkg, strings.Split(*tables, ","))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fatal(err)
+	}
+
+	src, err := generate(def)
+	if err != nil {
+		fatal(err)
+	}
+	if *output == "" {
+		os.Stdout.Write(src)
+		return
+	}
+	if err := ioutil.WriteFile(*output, src, 0644); err != nil {
+		fatal(err)
+	}
+}
+
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "tablestoregen:", err)
+	os.Exit(1)
+}
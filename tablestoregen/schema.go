@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"io/ioutil"
+	"strings"
+)
+
+// Column types accepted in a definition file.
+const (
+	typeString  = "string"
+	typeInteger = "integer"
+	typeDouble  = "double"
+	typeBoolean = "boolean"
+	typeBinary  = "binary"
+)
+
+// Definition is the schema source of the generator. It is either loaded from
+// a JSON definition file or built from DescribeTable/DescribeSearchIndex:
+//
+//	{
+//		"package": "model",
+//		"tables": [{
+//			"table": "user",
+//			"struct": "User",
+//			"primaryKeys": [
+//				{"name": "id", "type": "string"},
+//				{"name": "seq", "type": "integer", "autoIncrement": true}
+//			],
+//			"columns": [
+//				{"name": "name", "type": "string"},
+//				{"name": "age", "type": "integer"}
+//			]
+//		}]
+//	}
+type Definition struct {
+	Package string   `json:"package"`
+	Tables  []*Table `json:"tables"`
+}
+
+type Table struct {
+	Table       string    `json:"table"`
+	Struct      string    `json:"struct,omitempty"`
+	PrimaryKeys []*Column `json:"primaryKeys"`
+	Columns     []*Column `json:"columns,omitempty"`
+}
+
+type Column struct {
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	AutoIncrement bool   `json:"autoIncrement,omitempty"`
+}
+
+func loadDefinition(path string) (*Definition, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	def := new(Definition)
+	if err := json.Unmarshal(data, def); err != nil {
+		return nil, fmt.Errorf("parse %s: %s", path, err)
+	}
+	return def, nil
+}
+
+func (def *Definition) validate() error {
+	if def.Package == "" {
+		return fmt.Errorf("package name is required")
+	}
+	if len(def.Tables) == 0 {
+		return fmt.Errorf("no table defined")
+	}
+	structs := make(map[string]bool)
+	for _, table := range def.Tables {
+		if table.Table == "" {
+			return fmt.Errorf("table name is required")
+		}
+		if table.Struct == "" {
+			table.Struct = exportedName(table.Table)
+		}
+		if structs[table.Struct] {
+			return fmt.Errorf("duplicated struct name %s", table.Struct)
+		}
+		structs[table.Struct] = true
+
+		if len(table.PrimaryKeys) == 0 {
+			return fmt.Errorf("table %s has no primary key", table.Table)
+		}
+		names := make(map[string]bool)
+		for i, column := range append(table.PrimaryKeys, table.Columns...) {
+			isPk := i < len(table.PrimaryKeys)
+			if column.Name == "" {
+				return fmt.Errorf("table %s has a column without name", table.Table)
+			}
+			field := exportedName(column.Name)
+			if names[field] {
+				return fmt.Errorf("table %s: column %s conflicts with another column", table.Table, column.Name)
+			}
+			names[field] = true
+
+			column.Type = strings.ToLower(column.Type)
+			if _, ok := goTypes[column.Type]; !ok {
+				return fmt.Errorf("table %s: unknown type %q of column %s", table.Table, column.Type, column.Name)
+			}
+			if isPk && (column.Type == typeDouble || column.Type == typeBoolean) {
+				return fmt.Errorf("table %s: primary key %s can not be %s", table.Table, column.Name, column.Type)
+			}
+			if column.AutoIncrement && (!isPk || column.Type != typeInteger) {
+				return fmt.Errorf("table %s: only integer primary key can be auto increment", table.Table)
+			}
+		}
+	}
+	return nil
+}
+
+// tableFromSchema converts the result of DescribeTable, and optionally the
+// schema of a search index on the table, into a table definition. Defined
+// columns come first, then search index fields not defined elsewhere.
+func tableFromSchema(meta *tablestore.TableMeta, index *tablestore.IndexSchema) (*Table, error) {
+	table := &Table{Table: meta.TableName}
+	seen := make(map[string]bool)
+	for _, pk := range meta.SchemaEntry {
+		column := &Column{Name: *pk.Name}
+		switch *pk.Type {
+		case tablestore.PrimaryKeyType_INTEGER:
+			column.Type = typeInteger
+		case tablestore.PrimaryKeyType_STRING:
+			column.Type = typeString
+		case tablestore.PrimaryKeyType_BINARY:
+			column.Type = typeBinary
+		default:
+			return nil, fmt.Errorf("table %s: unknown type of primary key %s", meta.TableName, *pk.Name)
+		}
+		column.AutoIncrement = pk.Option != nil && *pk.Option == tablestore.AUTO_INCREMENT
+		table.PrimaryKeys = append(table.PrimaryKeys, column)
+		seen[column.Name] = true
+	}
+
+	for _, defined := range meta.DefinedColumns {
+		column := &Column{Name: defined.Name}
+		switch defined.ColumnType {
+		case tablestore.DefinedColumn_INTEGER:
+			column.Type = typeInteger
+		case tablestore.DefinedColumn_DOUBLE:
+			column.Type = typeDouble
+		case tablestore.DefinedColumn_BOOLEAN:
+			column.Type = typeBoolean
+		case tablestore.DefinedColumn_STRING:
+			column.Type = typeString
+		default:
+			column.Type = typeBinary
+		}
+		table.Columns = append(table.Columns, column)
+		seen[column.Name] = true
+	}
+
+	if index != nil {
+		for _, field := range index.FieldSchemas {
+			if field.FieldName == nil || seen[*field.FieldName] {
+				continue
+			}
+			column := &Column{Name: *field.FieldName}
+			switch field.FieldType {
+			case tablestore.FieldType_LONG:
+				column.Type = typeInteger
+			case tablestore.FieldType_DOUBLE:
+				column.Type = typeDouble
+			case tablestore.FieldType_BOOLEAN:
+				column.Type = typeBoolean
+			default:
+				// keyword, text, geo point and nested fields are all stored as strings
+				column.Type = typeString
+			}
+			table.Columns = append(table.Columns, column)
+			seen[column.Name] = true
+		}
+	}
+	return table, nil
+}
+
+// describeTables builds the definition of tables from a running instance.
+// Each spec is a table name, optionally followed by "/" and the name of a
+// search index whose fields are added as attribute columns.
+func describeTables(client *tablestore.TableStoreClient, pkg string, specs []string) (*Definition, error) {
+	def := &Definition{Package: pkg}
+	for _, spec := range specs {
+		tableName, indexName := spec, ""
+		if i := strings.Index(spec, "/"); i >= 0 {
+			tableName, indexName = spec[:i], spec[i+1:]
+		}
+
+		describeResp, err := client.DescribeTable(&tablestore.DescribeTableRequest{TableName: tableName})
+		if err != nil {
+			return nil, fmt.Errorf("describe table %s: %s", tableName, err)
+		}
+
+		var index *tablestore.IndexSchema
+		if indexName != "" {
+			indexResp, err := client.DescribeSearchIndex(&tablestore.DescribeSearchIndexRequest{TableName: tableName, IndexName: indexName})
+			if err != nil {
+				return nil, fmt.Errorf("describe search index %s: %s", indexName, err)
+			}
+			index = indexResp.Schema
+		}
+
+		table, err := tableFromSchema(describeResp.TableMeta, index)
+		if err != nil {
+			return nil, err
+		}
+		def.Tables = append(def.Tables, table)
+	}
+	return def, nil
+}
@@ -0,0 +1,172 @@
+package writer
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DeadLetter is a row which failed after its retries, kept to be replayed.
+type DeadLetter struct {
+	Id     string
+	Change tablestore.RowChange
+	// code of the error of the service, "" for other errors
+	Code     string
+	Err      error
+	Attempts int
+	Time     time.Time
+}
+
+// DeadLetterSink receives the rows the writer fails to write, e.g. a
+// DeadLetterTable or a DeadLetterFile.
+type DeadLetterSink interface {
+	Deposit(letter *DeadLetter) error
+}
+
+// errorCode returns the code of err if it is an error of the service.
+func errorCode(err error) string {
+	message := err.Error()
+	if !strings.HasPrefix(message, "OTS") {
+		return ""
+	}
+	if i := strings.IndexAny(message, ": "); i >= 0 {
+		return message[:i]
+	}
+	return message
+}
+
+// encodedLetter is a DeadLetter as stored by the sinks.
+type encodedLetter struct {
+	Id        string `json:"id"`
+	Table     string `json:"table"`
+	Operation string `json:"operation"`
+	// row change in plainbuffer format
+	Change    []byte `json:"change"`
+	Condition int    `json:"condition"`
+	// column condition of the change, serialized by ColumnFilter.Serialize
+	ColumnCondition []byte `json:"column_condition,omitempty"`
+	Code            string `json:"code,omitempty"`
+	Error           string `json:"error"`
+	Attempts        int    `json:"attempts"`
+	// unix time in milliseconds
+	Time int64 `json:"time"`
+}
+
+func encodeLetter(letter *DeadLetter) (*encodedLetter, error) {
+	encoded := &encodedLetter{
+		Id:       letter.Id,
+		Table:    letter.Change.GetTableName(),
+		Code:     letter.Code,
+		Attempts: letter.Attempts,
+		Time:     letter.Time.UnixNano() / int64(time.Millisecond),
+	}
+	if letter.Err != nil {
+		encoded.Error = letter.Err.Error()
+	}
+	var condition *tablestore.RowCondition
+	switch change := letter.Change.(type) {
+	case *tablestore.PutRowChange:
+		encoded.Operation, encoded.Change, condition = "put", change.Serialize(), change.Condition
+	case *tablestore.UpdateRowChange:
+		encoded.Operation, encoded.Change, condition = "update", change.Serialize(), change.Condition
+	case *tablestore.DeleteRowChange:
+		encoded.Operation, encoded.Change, condition = "delete", change.Serialize(), change.Condition
+	default:
+		return nil, fmt.Errorf("[tablestore] unsupported row change %T", letter.Change)
+	}
+	if condition != nil {
+		encoded.Condition = int(condition.RowExistenceExpectation)
+		if condition.ColumnCondition != nil {
+			encoded.ColumnCondition = condition.ColumnCondition.Serialize()
+		}
+	}
+	return encoded, nil
+}
+
+// columns of the rows of a DeadLetterTable, whose primary key is made of the
+// string column DeadLetterTableColumn, the table of the change, and of the
+// auto increment column DeadLetterSeqColumn
+const (
+	DeadLetterTableColumn     = "table"
+	DeadLetterSeqColumn       = "seq"
+	DeadLetterIdColumn        = "id"
+	DeadLetterOperationColumn = "operation"
+	DeadLetterChangeColumn    = "change"
+	DeadLetterConditionColumn = "condition"
+	// binary column of the column condition of the change, if any
+	DeadLetterColumnConditionColumn = "column_condition"
+	DeadLetterCodeColumn            = "code"
+	DeadLetterErrorColumn           = "error"
+	DeadLetterAttemptsColumn        = "attempts"
+	DeadLetterTimeColumn            = "time"
+)
+
+// DeadLetterTable stores dead letters in a table, in the order they are
+// deposited.
+type DeadLetterTable struct {
+	client tablestore.TableStoreApi
+	table  string
+}
+
+func NewDeadLetterTable(client tablestore.TableStoreApi, table string) *DeadLetterTable {
+	return &DeadLetterTable{client: client, table: table}
+}
+
+// CreateDeadLetterTable creates a table of dead letters.
+func CreateDeadLetterTable(client tablestore.TableStoreApi, table string) error {
+	meta := &tablestore.TableMeta{TableName: table}
+	meta.AddPrimaryKeyColumn(DeadLetterTableColumn, tablestore.PrimaryKeyType_STRING)
+	meta.AddPrimaryKeyColumnOption(DeadLetterSeqColumn, tablestore.PrimaryKeyType_INTEGER, tablestore.AUTO_INCREMENT)
+	_, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: &tablestore.ReservedThroughput{}})
+	return err
+}
+
+func (sink *DeadLetterTable) Deposit(letter *DeadLetter) error {
+	encoded, err := encodeLetter(letter)
+	if err != nil {
+		return err
+	}
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn(DeadLetterTableColumn, encoded.Table)
+	pk.AddPrimaryKeyColumnWithAutoIncrement(DeadLetterSeqColumn)
+	change := &tablestore.PutRowChange{TableName: sink.table, PrimaryKey: pk}
+	change.AddColumn(DeadLetterIdColumn, encoded.Id)
+	change.AddColumn(DeadLetterOperationColumn, encoded.Operation)
+	change.AddColumn(DeadLetterChangeColumn, encoded.Change)
+	change.AddColumn(DeadLetterConditionColumn, int64(encoded.Condition))
+	if encoded.ColumnCondition != nil {
+		change.AddColumn(DeadLetterColumnConditionColumn, encoded.ColumnCondition)
+	}
+	change.AddColumn(DeadLetterCodeColumn, encoded.Code)
+	change.AddColumn(DeadLetterErrorColumn, encoded.Error)
+	change.AddColumn(DeadLetterAttemptsColumn, int64(encoded.Attempts))
+	change.AddColumn(DeadLetterTimeColumn, encoded.Time)
+	change.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	_, err = sink.client.PutRow(&tablestore.PutRowRequest{PutRowChange: change})
+	return err
+}
+
+// DeadLetterFile writes dead letters to w as JSON lines. It is safe for
+// concurrent use.
+type DeadLetterFile struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewDeadLetterFile(w io.Writer) *DeadLetterFile {
+	return &DeadLetterFile{encoder: json.NewEncoder(w)}
+}
+
+func (sink *DeadLetterFile) Deposit(letter *DeadLetter) error {
+	encoded, err := encodeLetter(letter)
+	if err != nil {
+		return err
+	}
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	return sink.encoder.Encode(encoded)
+}
@@ -0,0 +1,229 @@
+package writer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"io"
+	"time"
+)
+
+type ReplayOptions struct {
+	// letters replayed per second, no limit if 0
+	Rate float64
+	// Skip reports whether a letter is not replayed, e.g. SkipCodes
+	Skip func(letter *DeadLetter) bool
+	// OnReplay is called with every letter replayed and the error of its
+	// change, nil if it is written
+	OnReplay func(letter *DeadLetter, err error)
+}
+
+type ReplayStats struct {
+	Replayed int
+	Skipped  int
+	// letters whose change failed again
+	Failed int
+}
+
+// SkipCodes returns a skip rule of the letters failed with one of codes, e.g.
+// OTSConditionCheckFail for changes which would fail again.
+func SkipCodes(codes ...string) func(letter *DeadLetter) bool {
+	return func(letter *DeadLetter) bool {
+		for _, code := range codes {
+			if letter.Code == code {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (encoded *encodedLetter) decode() (*DeadLetter, error) {
+	pk, columns, _, err := tablestore.DecodeRowChange(encoded.Change)
+	if err != nil {
+		return nil, err
+	}
+	condition := &tablestore.RowCondition{RowExistenceExpectation: tablestore.RowExistenceExpectation(encoded.Condition)}
+	if encoded.ColumnCondition != nil {
+		if condition.ColumnCondition, err = tablestore.DecodeColumnFilter(encoded.ColumnCondition); err != nil {
+			return nil, err
+		}
+	}
+	letter := &DeadLetter{
+		Id:       encoded.Id,
+		Code:     encoded.Code,
+		Attempts: encoded.Attempts,
+		Time:     time.Unix(0, encoded.Time*int64(time.Millisecond)),
+	}
+	if encoded.Error != "" {
+		letter.Err = errors.New(encoded.Error)
+	}
+	switch encoded.Operation {
+	case "put":
+		change := &tablestore.PutRowChange{TableName: encoded.Table, PrimaryKey: pk, Condition: condition}
+		for _, column := range columns {
+			change.Columns = append(change.Columns, tablestore.AttributeColumn{ColumnName: column.ColumnName, Value: column.Value, Timestamp: column.Timestamp})
+		}
+		letter.Change = change
+	case "update":
+		letter.Change = &tablestore.UpdateRowChange{TableName: encoded.Table, PrimaryKey: pk, Columns: columns, Condition: condition}
+	case "delete":
+		letter.Change = &tablestore.DeleteRowChange{TableName: encoded.Table, PrimaryKey: pk, Condition: condition}
+	default:
+		return nil, fmt.Errorf("[tablestore] unknown dead letter operation %q", encoded.Operation)
+	}
+	return letter, nil
+}
+
+// replayer writes the changes of letters one at a time, at the pace of the
+// options.
+type replayer struct {
+	client  tablestore.TableStoreApi
+	options ReplayOptions
+	stats   ReplayStats
+	next    time.Time
+}
+
+// replay writes the change of letter, returning whether it was skipped and
+// the error of the change.
+func (r *replayer) replay(letter *DeadLetter) (bool, error) {
+	if r.options.Skip != nil && r.options.Skip(letter) {
+		r.stats.Skipped++
+		return true, nil
+	}
+	if r.options.Rate > 0 {
+		if wait := time.Until(r.next); wait > 0 {
+			time.Sleep(wait)
+		}
+		r.next = time.Now().Add(time.Duration(float64(time.Second) / r.options.Rate))
+	}
+	var err error
+	switch change := letter.Change.(type) {
+	case *tablestore.PutRowChange:
+		_, err = r.client.PutRow(&tablestore.PutRowRequest{PutRowChange: change})
+	case *tablestore.UpdateRowChange:
+		_, err = r.client.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: change})
+	case *tablestore.DeleteRowChange:
+		_, err = r.client.DeleteRow(&tablestore.DeleteRowRequest{DeleteRowChange: change})
+	}
+	if err != nil {
+		r.stats.Failed++
+	} else {
+		r.stats.Replayed++
+	}
+	if r.options.OnReplay != nil {
+		r.options.OnReplay(letter, err)
+	}
+	return false, err
+}
+
+// ReplayFile writes again by client the changes of the letters of r, written
+// by a DeadLetterFile, in order. Letters failing again are deposited to
+// failed if it is not nil.
+func ReplayFile(client tablestore.TableStoreApi, r io.Reader, failed DeadLetterSink, options ReplayOptions) (ReplayStats, error) {
+	replayer := &replayer{client: client, options: options}
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	for {
+		encoded := new(encodedLetter)
+		if err := decoder.Decode(encoded); err == io.EOF {
+			return replayer.stats, nil
+		} else if err != nil {
+			return replayer.stats, err
+		}
+		letter, err := encoded.decode()
+		if err != nil {
+			return replayer.stats, err
+		}
+		if _, err := replayer.replay(letter); err != nil && failed != nil {
+			letter.Code, letter.Err, letter.Attempts, letter.Time = errorCode(err), err, letter.Attempts+1, time.Now()
+			if err := failed.Deposit(letter); err != nil {
+				return replayer.stats, err
+			}
+		}
+	}
+}
+
+// Replay writes again by client the changes of the letters of the table, in
+// the order they were deposited by table. Letters written are deleted, those
+// failing again are updated with their new error and attempts, and skipped
+// ones are kept.
+func (sink *DeadLetterTable) Replay(client tablestore.TableStoreApi, options ReplayOptions) (ReplayStats, error) {
+	replayer := &replayer{client: client, options: options}
+	criteria := &tablestore.RangeRowQueryCriteria{TableName: sink.table, StartPrimaryKey: new(tablestore.PrimaryKey), EndPrimaryKey: new(tablestore.PrimaryKey), Direction: tablestore.FORWARD, MaxVersion: 1}
+	criteria.StartPrimaryKey.AddPrimaryKeyColumnWithMinValue(DeadLetterTableColumn)
+	criteria.StartPrimaryKey.AddPrimaryKeyColumnWithMinValue(DeadLetterSeqColumn)
+	criteria.EndPrimaryKey.AddPrimaryKeyColumnWithMaxValue(DeadLetterTableColumn)
+	criteria.EndPrimaryKey.AddPrimaryKeyColumnWithMaxValue(DeadLetterSeqColumn)
+	for {
+		resp, err := sink.client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: criteria})
+		if err != nil {
+			return replayer.stats, err
+		}
+		for _, row := range resp.Rows {
+			letter, err := letterOf(row)
+			if err != nil {
+				return replayer.stats, err
+			}
+			skipped, err := replayer.replay(letter)
+			if skipped {
+				continue
+			}
+			if err == nil {
+				_, err = sink.client.DeleteRow(&tablestore.DeleteRowRequest{DeleteRowChange: &tablestore.DeleteRowChange{
+					TableName: sink.table, PrimaryKey: row.PrimaryKey,
+					Condition: &tablestore.RowCondition{RowExistenceExpectation: tablestore.RowExistenceExpectation_IGNORE}}})
+			} else {
+				change := &tablestore.UpdateRowChange{TableName: sink.table, PrimaryKey: row.PrimaryKey}
+				change.PutColumn(DeadLetterCodeColumn, errorCode(err))
+				change.PutColumn(DeadLetterErrorColumn, err.Error())
+				change.PutColumn(DeadLetterAttemptsColumn, int64(letter.Attempts+1))
+				change.PutColumn(DeadLetterTimeColumn, time.Now().UnixNano()/int64(time.Millisecond))
+				change.SetCondition(tablestore.RowExistenceExpectation_EXPECT_EXIST)
+				_, err = sink.client.UpdateRow(&tablestore.UpdateRowRequest{UpdateRowChange: change})
+			}
+			if err != nil {
+				return replayer.stats, err
+			}
+		}
+		if resp.NextStartPrimaryKey == nil {
+			return replayer.stats, nil
+		}
+		criteria.StartPrimaryKey = resp.NextStartPrimaryKey
+	}
+}
+
+// letterOf returns the letter of a row of a DeadLetterTable.
+func letterOf(row *tablestore.Row) (*DeadLetter, error) {
+	encoded := new(encodedLetter)
+	encoded.Table, _ = row.PrimaryKey.PrimaryKeys[0].Value.(string)
+	for _, column := range row.Columns {
+		switch column.ColumnName {
+		case DeadLetterIdColumn:
+			encoded.Id, _ = column.Value.(string)
+		case DeadLetterOperationColumn:
+			encoded.Operation, _ = column.Value.(string)
+		case DeadLetterChangeColumn:
+			encoded.Change, _ = column.Value.([]byte)
+		case DeadLetterConditionColumn:
+			condition, _ := column.Value.(int64)
+			encoded.Condition = int(condition)
+		case DeadLetterColumnConditionColumn:
+			encoded.ColumnCondition, _ = column.Value.([]byte)
+		case DeadLetterCodeColumn:
+			encoded.Code, _ = column.Value.(string)
+		case DeadLetterErrorColumn:
+			encoded.Error, _ = column.Value.(string)
+		case DeadLetterAttemptsColumn:
+			attempts, _ := column.Value.(int64)
+			encoded.Attempts = int(attempts)
+		case DeadLetterTimeColumn:
+			encoded.Time, _ = column.Value.(int64)
+		}
+	}
+	if encoded.Change == nil {
+		return nil, fmt.Errorf("[tablestore] invalid dead letter %v", row.PrimaryKey)
+	}
+	return encoded.decode()
+}
@@ -18,6 +18,61 @@ type Config struct {
 	Concurrent    int
 	FlushInterval time.Duration
 	RetryTimeout  time.Duration
+	// Logger receives failed batches and row retries, nothing is logged if nil
+	Logger tablestore.Logger
+	// OnEvent is called with the events of every row, from the goroutines of
+	// the writer, so it must not block, e.g. to measure delivery latencies.
+	OnEvent func(event *Event)
+	// DeadLetter receives the rows failing after their retries, before their
+	// futures are set; a DeadLetterTable named DeadLetterTable, written by the
+	// client of the writer, if nil and DeadLetterTable is set.
+	DeadLetter      DeadLetterSink
+	DeadLetterTable string
+}
+
+// EventType is a step of the lifecycle of a row added to the writer.
+type EventType int
+
+const (
+	// the row is added by BatchAdd
+	EventEnqueued EventType = iota
+	// the row is added to a batch, once per attempt
+	EventBatched
+	// the batch of the row is sent, once per attempt
+	EventSent
+	// the row is written
+	EventSucceeded
+	// the row failed, and is not retried anymore
+	EventFailed
+)
+
+func (eventType EventType) String() string {
+	switch eventType {
+	case EventEnqueued:
+		return "enqueued"
+	case EventBatched:
+		return "batched"
+	case EventSent:
+		return "sent"
+	case EventSucceeded:
+		return "succeeded"
+	case EventFailed:
+		return "failed"
+	}
+	return fmt.Sprintf("EventType(%d)", int(eventType))
+}
+
+type Event struct {
+	Type  EventType
+	Id    string
+	Table string
+	// attempt of the row, from 1
+	Attempt int
+	Time    time.Time
+	// time since NewBatchAdd of the row
+	Elapsed time.Duration
+	// error of the row, for EventFailed
+	Err error
 }
 
 type BatchAddContext struct {
@@ -36,10 +91,12 @@ type BatchAddResult struct {
 	Err   error
 }
 
+// NewBatchAdd returns the context of writing change, a copy of it kept until
+// it is written, so that the caller may modify or reuse change afterwards.
 func NewBatchAdd(id string, change tablestore.RowChange, future *promise.Future) *BatchAddContext {
 	return &BatchAddContext{
 		id:     id,
-		change: change,
+		change: tablestore.CloneRowChange(change),
 		done:   future,
 		start:  time.Now(),
 	}
@@ -51,6 +108,9 @@ type BatchWriter struct {
 	inputCh      chan *BatchAddContext
 	flushCh      chan struct{}
 	retryTimeout time.Duration
+	logger       tablestore.Logger
+	onEvent      func(event *Event)
+	deadLetter   DeadLetterSink
 
 	cancel context.CancelFunc
 	ctx    context.Context
@@ -73,9 +133,15 @@ func NewBatchWriter(client tablestore.TableStoreApi, conf *Config) *BatchWriter
 		inputCh:       asyncDIn,
 		flushCh:       make(chan struct{}),
 		retryTimeout:  conf.RetryTimeout,
+		logger:        conf.Logger,
+		onEvent:       conf.OnEvent,
+		deadLetter:    conf.DeadLetter,
 		cancel:        cancel,
 		ctx:           ctx,
 	}
+	if w.deadLetter == nil && conf.DeadLetterTable != "" {
+		w.deadLetter = NewDeadLetterTable(client, conf.DeadLetterTable)
+	}
 	ticker := time.NewTicker(conf.FlushInterval)
 	go w.tickFlush(ticker)
 	go w.asyncDispatcher(asyncDIn, uploaderIn)
@@ -91,6 +157,7 @@ func NewBatchWriter(client tablestore.TableStoreApi, conf *Config) *BatchWriter
 }
 
 func (w *BatchWriter) BatchAdd(ctx *BatchAddContext) error {
+	w.emit(EventEnqueued, ctx, nil)
 	select {
 	case w.inputCh <- ctx:
 		return nil
@@ -133,6 +200,7 @@ func (w *BatchWriter) asyncDispatcher(input <-chan *BatchAddContext, output chan
 		select {
 		case req := <-input:
 			batch[req.change.GetTableName()] = append(batch[req.change.GetTableName()], req)
+			w.emit(EventBatched, req, nil)
 			i++
 			if i == limit {
 				send = true
@@ -143,6 +211,7 @@ func (w *BatchWriter) asyncDispatcher(input <-chan *BatchAddContext, output chan
 			select {
 			case req := <-input:
 				batch[req.change.GetTableName()] = append(batch[req.change.GetTableName()], req)
+				w.emit(EventBatched, req, nil)
 				i++
 				if i == limit {
 					send = true
@@ -173,13 +242,17 @@ func (w *BatchWriter) uploader(input <-chan map[string][]*BatchAddContext, outpu
 		select {
 		case reqMap = <-input:
 			otsReq := new(tablestore.BatchWriteRowRequest)
+			rows := 0
 			for _, reqSlice := range reqMap {
 				for _, req := range reqSlice {
 					otsReq.AddRowChange(req.change)
+					w.emit(EventSent, req, nil)
+					rows++
 				}
 			}
 			otsResp, err := w.BatchWriteRow(otsReq)
 			if err != nil {
+				w.log(tablestore.LogWarn, "batch write failed", tablestore.LogField("rows", rows), tablestore.LogField("error", err))
 				for _, reqSlice := range reqMap {
 					for _, req := range reqSlice {
 						req.resp = &BatchAddResult{Err: err}
@@ -224,9 +297,13 @@ func (w *BatchWriter) reducer(input <-chan *BatchAddContext) {
 			} else {
 				dur := defaultBackoff.backoff(req.retries)
 				if time.Now().Add(dur).Sub(req.start) > w.retryTimeout {
+					w.log(tablestore.LogError, "row write failed", tablestore.LogField("id", req.id),
+						tablestore.LogField("retries", req.retries), tablestore.LogField("error", req.resp.Err))
 					writeBack = true
 				} else {
 					req.retries++
+					w.log(tablestore.LogDebug, "row write retried", tablestore.LogField("id", req.id),
+						tablestore.LogField("attempt", req.retries), tablestore.LogField("pause", dur), tablestore.LogField("error", req.resp.Err))
 					go w.backoffRetry(req, dur)
 				}
 
@@ -235,11 +312,58 @@ func (w *BatchWriter) reducer(input <-chan *BatchAddContext) {
 			return
 		}
 		if writeBack {
+			if req.resp.Err == nil {
+				w.emit(EventSucceeded, req, nil)
+			} else {
+				w.emit(EventFailed, req, req.resp.Err)
+				if w.deadLetter != nil {
+					go w.deposit(req)
+					continue
+				}
+			}
 			req.done.Set(req.resp, req.resp.Err)
 		}
 	}
 }
 
+func (w *BatchWriter) log(level tablestore.LogLevel, msg string, fields ...tablestore.Field) {
+	if w.logger != nil {
+		w.logger.Log(level, msg, fields...)
+	}
+}
+
+// deposit sends the failed row of req to the dead letter sink, then sets its
+// future.
+func (w *BatchWriter) deposit(req *BatchAddContext) {
+	letter := &DeadLetter{
+		Id:       req.id,
+		Change:   req.change,
+		Code:     errorCode(req.resp.Err),
+		Err:      req.resp.Err,
+		Attempts: req.retries + 1,
+		Time:     time.Now(),
+	}
+	if err := w.deadLetter.Deposit(letter); err != nil {
+		w.log(tablestore.LogError, "dead letter failed", tablestore.LogField("id", req.id), tablestore.LogField("error", err))
+	}
+	req.done.Set(req.resp, req.resp.Err)
+}
+
+func (w *BatchWriter) emit(eventType EventType, req *BatchAddContext, err error) {
+	if w.onEvent != nil {
+		now := time.Now()
+		w.onEvent(&Event{
+			Type:    eventType,
+			Id:      req.id,
+			Table:   req.change.GetTableName(),
+			Attempt: req.retries + 1,
+			Time:    now,
+			Elapsed: now.Sub(req.start),
+			Err:     err,
+		})
+	}
+}
+
 func (w *BatchWriter) backoffRetry(req *BatchAddContext, backoffDur time.Duration) {
 	time.Sleep(backoffDur)
 	select {
@@ -1,11 +1,17 @@
 package writer
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore"
+	"github.com/aliyun/aliyun-tablestore-go-sdk/tablestore/tablestoretest"
 	"github.com/aliyun/aliyun-tablestore-go-sdk/timeline/promise"
 	"math/rand"
 	"os"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -86,6 +92,256 @@ func BenchmarkBatchWriter_BatchAdd_WriteSpread(b *testing.B) {
 	}
 }
 
+func TestBatchWriter_Events(t *testing.T) {
+	client := tablestoretest.NewClient()
+	meta := &tablestore.TableMeta{TableName: "events"}
+	meta.AddPrimaryKeyColumn(firstPk, tablestore.PrimaryKeyType_STRING)
+	if _, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: new(tablestore.ReservedThroughput)}); err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	events := make(map[string][]EventType)
+	var failed *Event
+	writer := NewBatchWriter(client, &Config{Concurrent: 2, FlushInterval: 5 * time.Millisecond, RetryTimeout: 30 * time.Millisecond,
+		OnEvent: func(event *Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			events[event.Id] = append(events[event.Id], event.Type)
+			if event.Type == EventFailed {
+				failed = event
+			}
+		}})
+	defer writer.Close()
+
+	add := func(id string, condition tablestore.RowExistenceExpectation) *promise.Future {
+		pk := new(tablestore.PrimaryKey)
+		pk.AddPrimaryKeyColumn(firstPk, id)
+		change := &tablestore.PutRowChange{TableName: "events", PrimaryKey: pk}
+		change.AddColumn(attrCol, id)
+		change.SetCondition(condition)
+		f := promise.NewFuture()
+		if err := writer.BatchAdd(NewBatchAdd(id, change, f)); err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	if _, err := add("ok", tablestore.RowExistenceExpectation_IGNORE).Get(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := add("missing", tablestore.RowExistenceExpectation_EXPECT_EXIST).Get(); err == nil {
+		t.Fatal("expect condition check failure")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := events["ok"]; !reflect.DeepEqual(got, []EventType{EventEnqueued, EventBatched, EventSent, EventSucceeded}) {
+		t.Errorf("events %v", got)
+	}
+	got := events["missing"]
+	if len(got) < 5 || got[0] != EventEnqueued || got[len(got)-1] != EventFailed {
+		t.Errorf("failed events %v", got)
+	}
+	if failed == nil || failed.Attempt < 2 || failed.Err == nil || failed.Table != "events" || failed.Elapsed <= 0 {
+		t.Errorf("failed %+v", failed)
+	}
+}
+
+func TestBatchWriter_DeadLetter(t *testing.T) {
+	client := tablestoretest.NewClient()
+	meta := &tablestore.TableMeta{TableName: "events"}
+	meta.AddPrimaryKeyColumn(firstPk, tablestore.PrimaryKeyType_STRING)
+	if _, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: new(tablestore.ReservedThroughput)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateDeadLetterTable(client, "dlq"); err != nil {
+		t.Fatal(err)
+	}
+	update := func(id string) *tablestore.UpdateRowChange {
+		pk := new(tablestore.PrimaryKey)
+		pk.AddPrimaryKeyColumn(firstPk, id)
+		change := &tablestore.UpdateRowChange{TableName: "events", PrimaryKey: pk}
+		change.PutColumn(attrCol, id)
+		change.SetCondition(tablestore.RowExistenceExpectation_EXPECT_EXIST)
+		return change
+	}
+
+	writer := NewBatchWriter(client, &Config{Concurrent: 2, FlushInterval: 5 * time.Millisecond, RetryTimeout: 20 * time.Millisecond, DeadLetterTable: "dlq"})
+	defer writer.Close()
+	f := promise.NewFuture()
+	if err := writer.BatchAdd(NewBatchAdd("missing", update("missing"), f)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Get(); err == nil {
+		t.Fatal("expect condition check failure")
+	}
+	criteria := &tablestore.RangeRowQueryCriteria{TableName: "dlq", StartPrimaryKey: new(tablestore.PrimaryKey), EndPrimaryKey: new(tablestore.PrimaryKey), Direction: tablestore.FORWARD, MaxVersion: 1}
+	criteria.StartPrimaryKey.AddPrimaryKeyColumnWithMinValue(DeadLetterTableColumn)
+	criteria.StartPrimaryKey.AddPrimaryKeyColumnWithMinValue(DeadLetterSeqColumn)
+	criteria.EndPrimaryKey.AddPrimaryKeyColumnWithMaxValue(DeadLetterTableColumn)
+	criteria.EndPrimaryKey.AddPrimaryKeyColumnWithMaxValue(DeadLetterSeqColumn)
+	resp, err := client.GetRange(&tablestore.GetRangeRequest{RangeRowQueryCriteria: criteria})
+	if err != nil || len(resp.Rows) != 1 {
+		t.Fatalf("dead letters %v, %v", resp, err)
+	}
+	columns := make(map[string]interface{})
+	for _, column := range resp.Rows[0].Columns {
+		columns[column.ColumnName] = column.Value
+	}
+	if resp.Rows[0].PrimaryKey.PrimaryKeys[0].Value != "events" || columns[DeadLetterIdColumn] != "missing" || columns[DeadLetterOperationColumn] != "update" ||
+		columns[DeadLetterCodeColumn] != "OTSConditionCheckFail" || columns[DeadLetterAttemptsColumn].(int64) < 2 {
+		t.Errorf("dead letter %v", columns)
+	}
+
+	var file bytes.Buffer
+	other := NewBatchWriter(client, &Config{Concurrent: 1, FlushInterval: 5 * time.Millisecond, RetryTimeout: time.Millisecond, DeadLetter: NewDeadLetterFile(&file)})
+	defer other.Close()
+	f = promise.NewFuture()
+	if err := other.BatchAdd(NewBatchAdd("file", update("file"), f)); err != nil {
+		t.Fatal(err)
+	}
+	f.Get()
+	var letter encodedLetter
+	if err := json.Unmarshal(file.Bytes(), &letter); err != nil {
+		t.Fatal(err)
+	}
+	if letter.Id != "file" || letter.Table != "events" || letter.Condition != int(tablestore.RowExistenceExpectation_EXPECT_EXIST) || letter.Attempts != 1 {
+		t.Errorf("dead letter %+v", letter)
+	}
+	if pk, columns, _, err := tablestore.DecodeRowChange(letter.Change); err != nil || pk.PrimaryKeys[0].Value != "file" || len(columns) != 1 {
+		t.Errorf("change %v %v, %v", pk, columns, err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	client := tablestoretest.NewClient()
+	meta := &tablestore.TableMeta{TableName: "events"}
+	meta.AddPrimaryKeyColumn(firstPk, tablestore.PrimaryKeyType_STRING)
+	if _, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: new(tablestore.ReservedThroughput)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateDeadLetterTable(client, "dlq"); err != nil {
+		t.Fatal(err)
+	}
+	pk := func(id string) *tablestore.PrimaryKey {
+		pk := new(tablestore.PrimaryKey)
+		pk.AddPrimaryKeyColumn(firstPk, id)
+		return pk
+	}
+	put := &tablestore.PutRowChange{TableName: "events", PrimaryKey: pk("a")}
+	put.AddColumn(attrCol, "a")
+	put.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	update := &tablestore.UpdateRowChange{TableName: "events", PrimaryKey: pk("missing")}
+	update.PutColumn(attrCol, "b")
+	update.SetCondition(tablestore.RowExistenceExpectation_EXPECT_EXIST)
+	remove := &tablestore.DeleteRowChange{TableName: "events", PrimaryKey: pk("c")}
+	remove.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	letters := []*DeadLetter{
+		{Id: "a", Change: put, Code: "OTSServerBusy", Err: errors.New("OTSServerBusy: busy"), Attempts: 3, Time: time.Now()},
+		{Id: "b", Change: update, Err: errors.New("timeout"), Attempts: 3, Time: time.Now()},
+		{Id: "c", Change: remove, Attempts: 1, Time: time.Now()},
+	}
+	table := NewDeadLetterTable(client, "dlq")
+	var file bytes.Buffer
+	for _, letter := range letters {
+		if err := table.Deposit(letter); err != nil {
+			t.Fatal(err)
+		}
+		if err := NewDeadLetterFile(&file).Deposit(letter); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var replayed []string
+	start := time.Now()
+	stats, err := table.Replay(client, ReplayOptions{Rate: 100, OnReplay: func(letter *DeadLetter, err error) {
+		replayed = append(replayed, letter.Id)
+	}})
+	if err != nil || stats != (ReplayStats{Replayed: 2, Failed: 1}) {
+		t.Fatalf("stats %+v, %v", stats, err)
+	}
+	if !reflect.DeepEqual(replayed, []string{"a", "b", "c"}) || time.Since(start) < 20*time.Millisecond {
+		t.Errorf("replayed %v in %v", replayed, time.Since(start))
+	}
+	if resp, err := client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: &tablestore.SingleRowQueryCriteria{TableName: "events", PrimaryKey: pk("a"), MaxVersion: 1}}); err != nil || len(resp.Columns) != 1 {
+		t.Errorf("row %v, %v", resp, err)
+	}
+	// the failed letter is kept with its new error
+	stats, err = table.Replay(client, ReplayOptions{Skip: SkipCodes("OTSConditionCheckFail"), OnReplay: func(letter *DeadLetter, err error) {
+		t.Errorf("replayed %s", letter.Id)
+	}})
+	if err != nil || stats != (ReplayStats{Skipped: 1}) {
+		t.Errorf("stats %+v, %v", stats, err)
+	}
+
+	var failed bytes.Buffer
+	stats, err = ReplayFile(client, &file, NewDeadLetterFile(&failed), ReplayOptions{})
+	if err != nil || stats != (ReplayStats{Replayed: 2, Failed: 1}) {
+		t.Fatalf("file stats %+v, %v", stats, err)
+	}
+	var letter encodedLetter
+	if err := json.Unmarshal(failed.Bytes(), &letter); err != nil || letter.Id != "b" || letter.Code != "OTSConditionCheckFail" || letter.Attempts != 4 {
+		t.Errorf("failed letter %+v, %v", letter, err)
+	}
+}
+
+// TestReplayColumnCondition replays letters whose changes have a column
+// condition, which is kept.
+func TestReplayColumnCondition(t *testing.T) {
+	client := tablestoretest.NewClient()
+	meta := &tablestore.TableMeta{TableName: "events"}
+	meta.AddPrimaryKeyColumn(firstPk, tablestore.PrimaryKeyType_STRING)
+	if _, err := client.CreateTable(&tablestore.CreateTableRequest{TableMeta: meta, TableOption: tablestore.NewTableOption(-1, 1), ReservedThroughput: new(tablestore.ReservedThroughput)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateDeadLetterTable(client, "dlq"); err != nil {
+		t.Fatal(err)
+	}
+	pk := new(tablestore.PrimaryKey)
+	pk.AddPrimaryKeyColumn(firstPk, "a")
+	initial := &tablestore.PutRowChange{TableName: "events", PrimaryKey: pk}
+	initial.AddColumn(attrCol, "old")
+	initial.SetCondition(tablestore.RowExistenceExpectation_IGNORE)
+	if _, err := client.PutRow(&tablestore.PutRowRequest{PutRowChange: initial}); err != nil {
+		t.Fatal(err)
+	}
+
+	table := NewDeadLetterTable(client, "dlq")
+	var file bytes.Buffer
+	for _, expected := range []string{"new", "old"} {
+		change := &tablestore.UpdateRowChange{TableName: "events", PrimaryKey: pk}
+		change.PutColumn(attrCol, expected+"er")
+		change.SetCondition(tablestore.RowExistenceExpectation_EXPECT_EXIST)
+		change.SetColumnCondition(tablestore.NewSingleColumnCondition(attrCol, tablestore.CT_EQUAL, expected))
+		letter := &DeadLetter{Id: expected, Change: change, Attempts: 1, Time: time.Now()}
+		if err := table.Deposit(letter); err != nil {
+			t.Fatal(err)
+		}
+		if err := NewDeadLetterFile(&file).Deposit(letter); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	codes := make(map[string]string)
+	stats, err := table.Replay(client, ReplayOptions{OnReplay: func(letter *DeadLetter, err error) {
+		if err != nil {
+			codes[letter.Id] = errorCode(err)
+		}
+	}})
+	if err != nil || stats != (ReplayStats{Replayed: 1, Failed: 1}) || codes["new"] != "OTSConditionCheckFail" {
+		t.Fatalf("stats %+v, %v, %v", stats, codes, err)
+	}
+	resp, err := client.GetRow(&tablestore.GetRowRequest{SingleRowQueryCriteria: &tablestore.SingleRowQueryCriteria{TableName: "events", PrimaryKey: pk, MaxVersion: 1}})
+	if err != nil || len(resp.Columns) != 1 || resp.Columns[0].Value != "older" {
+		t.Fatalf("row %v, %v", resp, err)
+	}
+
+	// the letter of the file replayed again fails on its condition too
+	stats, err = ReplayFile(client, &file, nil, ReplayOptions{})
+	if err != nil || stats != (ReplayStats{Replayed: 0, Failed: 2}) {
+		t.Errorf("file stats %+v, %v", stats, err)
+	}
+}
+
 func initClientFromEnv() tablestore.TableStoreApi {
 	endpoint := os.Getenv("OTS_TEST_ENDPOINT")
 	instanceName := os.Getenv("OTS_TEST_INSTANCENAME")